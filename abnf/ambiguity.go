@@ -0,0 +1,191 @@
+package abnf
+
+// The ambiguity detector (-ambiguity): a diagnostic parse mode that finds the
+// inputs where more than one alternative of an Or matches.
+//
+// The Or is an ordered choice: apply() keeps the first alternative that matches
+// and never looks at the rest. That is what makes a grammar deterministic, and
+// it is also where a whole family of grammar bugs hides - a greedy modifier list
+// that swallows the name behind it, a trailing closure that is really the block
+// of an if, an optional tail that eats the block's terminator. In each of those
+// a LATER alternative would have matched too, just with a different length, and
+// the parse silently went the other way.
+//
+// In this mode every Or that matched also probes its remaining alternatives at
+// the same position and records each one that matches with a different length.
+// Equal lengths are not reported: two alternatives that consume the same text
+// only differ in the tags they produce, which is the usual and intended way to
+// order a keyword before an identifier. After the parse the findings are
+// printed per Or (to stderr, behind the run's own output), with the grammar
+// position, the competing alternatives and the first few input sites.
+//
+// The probes are diagnostics only: they never change what the parse produces.
+// A probe does not probe again (the main parse reaches every Or that matters on
+// its own path), and each Or is probed once per input position however often a
+// backtracking parse applies it there, which keeps the mode usable on the big
+// tests/*-test-full.* files. Side effects of :script() rules inside a probed
+// alternative are not rolled back, like everywhere else in the parser.
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"14.gy/mec/abnf/r"
+)
+
+// ambiguityMaxSites is how many input sites are listed per finding; the rest
+// are only counted.
+const ambiguityMaxSites = 3
+
+type ambProbeKey struct {
+	or  *r.Rule
+	pos int
+}
+
+type ambKey struct {
+	or       *r.Rule
+	taken    int // The alternative the parse took.
+	shadowed int // A later alternative that matched too.
+}
+
+type ambSite struct {
+	pos, takenLen, shadowedLen int // pos is where the first token starts, behind the skipped whitespace.
+}
+
+type ambFinding struct {
+	ambKey
+	count int
+	sites []ambSite
+}
+
+// ambiguityScan is the per-parse state of the detector (pa.amb).
+type ambiguityScan struct {
+	probing  bool
+	probed   map[ambProbeKey]bool
+	findings map[ambKey]*ambFinding
+}
+
+// ambiguityFor returns the detector state for a parse of agrammar, or nil when
+// the mode is off or the grammar is one of the built-in ones (the same choice
+// coverage makes, see coverageFor()).
+func (s *Session) ambiguityFor(agrammar *r.Rules) *ambiguityScan {
+	if !s.DetectAmbiguity || agrammar == AbnfAgrammar || agrammar == jsAgrammar {
+		return nil
+	}
+	return &ambiguityScan{probed: map[ambProbeKey]bool{}, findings: map[ambKey]*ambFinding{}}
+}
+
+// probe tries the alternatives behind the taken one at the position the Or
+// started at (from). The parse position, the error position and the coverage
+// counts are exactly as they were afterwards.
+func (s *ambiguityScan) probe(pa *parser, or *r.Rule, taken, from int, skipSpaceRule *r.Rule, depth int) {
+	if s.probing || taken == len(*or.Childs)-1 {
+		return
+	}
+	key := ambProbeKey{or, from}
+	if s.probed[key] {
+		return
+	}
+	s.probed[key] = true
+
+	end, last, cov := pa.Sdx, pa.lastParsePosition, pa.cov
+	s.probing, pa.cov = true, nil
+	// The Or starts in front of the whitespace (and comments) its first token
+	// skips; the site and the lengths are measured from the first char read.
+	start := from
+	if skipSpaceRule != nil {
+		pa.Sdx = from
+		pa.apply(skipSpaceRule, skipSpaceRule, true, depth+1)
+		start = pa.Sdx
+	}
+	for j := taken + 1; j < len(*or.Childs); j++ {
+		pa.Sdx = from
+		if pa.apply((*or.Childs)[j], skipSpaceRule, false, depth+1) != nil && pa.Sdx != end {
+			k := ambKey{or, taken, j}
+			f := s.findings[k]
+			if f == nil {
+				f = &ambFinding{ambKey: k}
+				s.findings[k] = f
+			}
+			f.count++
+			if len(f.sites) < ambiguityMaxSites {
+				f.sites = append(f.sites, ambSite{start, end - start, pa.Sdx - start})
+			}
+		}
+	}
+	s.probing, pa.cov = false, cov
+	pa.Sdx, pa.lastParsePosition = end, last
+}
+
+// report prints the findings of one parse, ordered by their place in the
+// grammar. The productions and alternatives are named the way the coverage
+// report names them (buildCovTable).
+func (s *ambiguityScan) report(pa *parser) {
+	if len(s.findings) == 0 {
+		return
+	}
+	names := buildCovTable(pa.agrammar)
+	list := make([]*ambFinding, 0, len(s.findings))
+	for _, f := range s.findings {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.or.Pos != b.or.Pos {
+			return a.or.Pos < b.or.Pos
+		}
+		if a.taken != b.taken {
+			return a.taken < b.taken
+		}
+		return a.shadowed < b.shadowed
+	})
+
+	sources := map[string]string{}
+	where := func(p *CoveragePoint) string {
+		if p == nil || p.File == "" {
+			return "?"
+		}
+		src, ok := sources[p.File]
+		if !ok {
+			if dat, err := os.ReadFile(p.File); err == nil {
+				src = StripBOM(string(dat))
+			}
+			sources[p.File] = src
+		}
+		if src == "" || p.Pos <= 0 || p.Pos > len(src) {
+			return p.File
+		}
+		line, col, _ := lineCol(src, p.Pos-1)
+		return fmt.Sprintf("%s:%d:%d", p.File, line, col)
+	}
+	alt := func(or *r.Rule, i int) string {
+		label := covLabel((*or.Childs)[i])
+		if p := names.points[covRef{or, i}]; p != nil {
+			label = p.Label
+		}
+		return "alternative " + strconv.Itoa(i+1) + " " + label
+	}
+
+	fmt.Fprintf(pa.sess.warn, "Ambiguities in %s: %d\n", pa.fileName, len(list))
+	for _, f := range list {
+		p := names.points[covRef{f.or, f.taken}]
+		prod := "?"
+		if p != nil {
+			prod = p.Prod
+		}
+		fmt.Fprintf(pa.sess.warn, "  %s (%s): %s is taken, but %s matches too\n", prod, where(p), alt(f.or, f.taken), alt(f.or, f.shadowed))
+		for _, site := range f.sites {
+			n := site.takenLen
+			if site.shadowedLen > n {
+				n = site.shadowedLen
+			}
+			fmt.Fprintf(pa.sess.warn, "    at %s: %q (taken: %d bytes, other: %d bytes)\n",
+				FileLinePos(pa.fileName, pa.Src, site.pos), clip(pa.Src[site.pos:site.pos+n], 60), site.takenLen, site.shadowedLen)
+		}
+		if f.count > len(f.sites) {
+			fmt.Fprintf(pa.sess.warn, "    ... and %d more\n", f.count-len(f.sites))
+		}
+	}
+}
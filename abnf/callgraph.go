@@ -15,6 +15,7 @@ package abnf
 // the file each run, like the other exports.
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -28,16 +29,6 @@ import (
 	"github.com/llir/llvm/ir/value"
 )
 
-// CallgraphOutPath is set from the -callgraph CLI flag: a .jsonl path holds
-// sdef/scall records for a later -render static, anything else writes DOT.
-// CallgraphAppend (from -callgraph-append) keeps the existing .jsonl and adds to
-// it, so many runs on different files accumulate one codebase-wide graph; the
-// default -callgraph overwrites the file up front, like -trace and -cfgraph.
-var (
-	CallgraphOutPath string
-	CallgraphAppend  bool
-)
-
 type cgDef struct {
 	Name string
 	File string
@@ -50,28 +41,35 @@ type cgCall struct {
 	File string
 }
 
-var (
-	cgMu        sync.Mutex
-	cgFileCount int
-	cgDead      bool // OpenCallgraph could not truncate the .jsonl; appends then skip.
-)
+// callgraphFiles is where a session and its forks write the call graph.
+type callgraphFiles struct {
+	mu        sync.Mutex
+	fileCount int
+	dead      bool // openCallgraph could not truncate the .jsonl; appends then skip.
+}
+
+// callgraphRun is the -callgraph attribution state of a session.
+type callgraphRun struct {
+	module   *ir.Module         // the module currently being built (set by llvm.ir.NewModule)
+	funcFile map[string]funcSrc // IR function name -> where it was compiled from
+}
 
-// OpenCallgraph truncates the -callgraph .jsonl file up front, so a re-run
+// openCallgraph truncates the -callgraph .jsonl file up front, so a re-run
 // overwrites the previous run's graph instead of appending to it - and a run
 // that extracts no records still replaces a stale file rather than leaving the
-// old one in place (the same reason OpenTrace pre-creates the -trace file). The
+// old one in place (the same reason openTrace pre-creates the -trace file). The
 // modules of THIS run still accumulate, because maybeDumpCallgraph appends after
 // this initial truncate. -callgraph-append (CallgraphAppend) skips the truncate
 // to accumulate across many runs; the DOT form writes a whole file per module
 // (os.WriteFile truncates) and needs no pre-truncation.
-func OpenCallgraph() {
-	if CallgraphOutPath == "" || CallgraphAppend || !strings.HasSuffix(CallgraphOutPath, ".jsonl") {
+func (s *Session) openCallgraph() {
+	if s.CallgraphOutPath == "" || s.CallgraphAppend || !strings.HasSuffix(s.CallgraphOutPath, ".jsonl") {
 		return
 	}
-	f, err := os.Create(CallgraphOutPath)
+	f, err := os.Create(s.CallgraphOutPath)
 	if err != nil {
-		cgDead = true
-		fmt.Fprintln(os.Stderr, "callgraph failed: ", err)
+		s.cgFiles.dead = true
+		fmt.Fprintln(s.warn, "callgraph failed: ", err)
 		return
 	}
 	f.Close()
@@ -79,8 +77,8 @@ func OpenCallgraph() {
 
 // Per-function source attribution. A module built from several files (imports
 // compiled into one module, e.g. Kotlin -i) would otherwise stamp EVERY
-// function with the one global traceSrcName, collapsing the whole codebase into
-// a single file. compileFuncFile records the file (and its line-start table)
+// function with the one current source name, collapsing the whole codebase into
+// a single file. callgraphRun.funcFile records the file (and its line-start table)
 // that was active while each IR function was compiled: it is filled at every
 // trace-source push/pop (attributeModuleFuncs) and once before extraction, so
 // each function keeps its own file and line numbers after the source stack has
@@ -91,96 +89,86 @@ type funcSrc struct {
 	starts []int
 }
 
-var (
-	compileModule   *ir.Module // the module currently being built (set by llvm.ir.NewModule)
-	compileFuncFile = map[string]funcSrc{}
-)
-
 // attributeModuleFuncs stamps every not-yet-stamped module function with the
 // CURRENT trace source. Called just before the source is switched (push/pop)
 // and once before extraction.
-func attributeModuleFuncs() {
-	if compileModule == nil || !TraceMarkersWanted() {
+func (s *Session) attributeModuleFuncs() {
+	if s.cg.module == nil || !s.TraceMarkersWanted() {
 		return
 	}
-	for _, f := range compileModule.Funcs {
+	for _, f := range s.cg.module.Funcs {
 		n := f.Name()
-		if _, ok := compileFuncFile[n]; !ok {
-			compileFuncFile[n] = funcSrc{traceSrcName, traceLineStarts}
+		if _, ok := s.cg.funcFile[n]; !ok {
+			s.cg.funcFile[n] = funcSrc{s.src.name, s.src.starts}
 		}
 	}
 }
 
 // beginCompileModule is called by the llvm.ir.NewModule wrapper: it records the
 // module so attributeModuleFuncs can walk it, and clears any prior attribution.
-func beginCompileModule(m *ir.Module) {
-	compileModule = m
-	compileFuncFile = map[string]funcSrc{}
+func (s *Session) beginCompileModule(m *ir.Module) {
+	s.cg.module = m
+	s.cg.funcFile = map[string]funcSrc{}
 }
 
 // maybeDumpCallgraph extracts and writes the static call graph of a module
 // about to be executed (hooked next to maybeDumpCFG).
-func maybeDumpCallgraph(m *ir.Module) {
-	if CallgraphOutPath == "" {
+func (s *Session) maybeDumpCallgraph(m *ir.Module) {
+	if s.CallgraphOutPath == "" {
 		return
 	}
-	defs, calls := extractCallGraph(m)
-	if strings.HasSuffix(CallgraphOutPath, ".jsonl") {
-		appendCallgraphRecords(defs, calls)
+	defs, calls := s.extractCallGraph(m)
+	if strings.HasSuffix(s.CallgraphOutPath, ".jsonl") {
+		s.appendCallgraphRecords(defs, calls)
 		return
 	}
-	cgMu.Lock()
-	n := cgFileCount
-	cgFileCount++
-	cgMu.Unlock()
-	path := CallgraphOutPath
-	if n > 0 {
-		if dot := strings.LastIndex(path, "."); dot > 0 {
-			path = fmt.Sprintf("%s-%d%s", path[:dot], n+1, path[dot:])
-		} else {
-			path = fmt.Sprintf("%s-%d", path, n+1)
-		}
-	}
+	s.cgFiles.mu.Lock()
+	n := s.cgFiles.fileCount
+	s.cgFiles.fileCount++
+	s.cgFiles.mu.Unlock()
+	path := numberedDumpPath(s.CallgraphOutPath, n)
 	var buf strings.Builder
 	writeStaticDot(defs, calls, &buf)
 	if err := os.WriteFile(path, []byte(buf.String()), 0644); err != nil {
-		fmt.Fprintln(os.Stderr, "callgraph dump failed: ", err)
+		fmt.Fprintln(s.warn, "callgraph dump failed: ", err)
 	}
 }
 
 // appendCallgraphRecords adds the records of one module to the .jsonl file. Each
-// run's OpenCallgraph truncated it first (unless -callgraph-append), so this
+// run's openCallgraph truncated it first (unless -callgraph-append), so this
 // accumulates the modules of one run - and, with -callgraph-append, several mec
-// runs on different source files merge into one codebase-wide graph.
-func appendCallgraphRecords(defs []cgDef, calls []cgCall) {
-	if cgDead {
+// runs on different source files merge into one codebase-wide graph. The records
+// of a module go out in one write, under the lock the forks of a session share,
+// so modules compiled side by side do not interleave.
+func (s *Session) appendCallgraphRecords(defs []cgDef, calls []cgCall) {
+	var buf bytes.Buffer
+	for _, d := range defs {
+		line, _ := json.Marshal(&TraceEvent{Ev: "sdef", Name: d.Name, Line: d.Line, Obj: d.File})
+		buf.Write(append(line, '\n'))
+	}
+	for _, c := range calls {
+		line, _ := json.Marshal(&TraceEvent{Ev: "scall", Name: c.From, Key: c.To, Obj: c.File})
+		buf.Write(append(line, '\n'))
+	}
+	s.cgFiles.mu.Lock()
+	defer s.cgFiles.mu.Unlock()
+	if s.cgFiles.dead {
 		return
 	}
-	f, err := os.OpenFile(CallgraphOutPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	f, err := os.OpenFile(s.CallgraphOutPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "callgraph append failed: ", err)
+		fmt.Fprintln(s.warn, "callgraph append failed: ", err)
 		return
 	}
 	defer f.Close()
 	// A failed write (full disk...) must not silently truncate the graph.
-	for _, d := range defs {
-		line, _ := json.Marshal(&TraceEvent{Ev: "sdef", Name: d.Name, Line: d.Line, Obj: d.File})
-		if _, err := f.Write(append(line, '\n')); err != nil {
-			fmt.Fprintln(os.Stderr, "callgraph write failed: ", err)
-			return
-		}
-	}
-	for _, c := range calls {
-		line, _ := json.Marshal(&TraceEvent{Ev: "scall", Name: c.From, Key: c.To, Obj: c.File})
-		if _, err := f.Write(append(line, '\n')); err != nil {
-			fmt.Fprintln(os.Stderr, "callgraph write failed: ", err)
-			return
-		}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		fmt.Fprintln(s.warn, "callgraph write failed: ", err)
 	}
 }
 
 // extractCallGraph walks a module and recovers definitions and call edges.
-func extractCallGraph(m *ir.Module) ([]cgDef, []cgCall) {
+func (s *Session) extractCallGraph(m *ir.Module) ([]cgDef, []cgCall) {
 	strOf := map[value.Value]string{}     // js_str_mem call -> its string literal
 	nameRead := map[value.Value]string{}  // js_scope_get/js_kget call -> the variable name
 	closureFn := map[value.Value]string{} // js_closure call -> IR function name jsf_N
@@ -266,14 +254,15 @@ func extractCallGraph(m *ir.Module) ([]cgDef, []cgCall) {
 	// from "(top)" and it never registers as a definition.
 	// Stamp any functions still unattributed (the main file's, compiled after
 	// the last import popped) with the final source, so every function has one.
-	attributeModuleFuncs()
-	// Each function's own file + line-start table (falls back to the global
-	// source for the single-file case, where compileFuncFile mirrors it anyway).
+	s.attributeModuleFuncs()
+	// Each function's own file + line-start table (falls back to the current
+	// source for the single-file case, where funcFile mirrors it anyway).
+	funcFile, cur := s.cg.funcFile, s.src
 	srcOf := func(f *ir.Func) (string, []int) {
-		if fs, ok := compileFuncFile[f.Name()]; ok {
+		if fs, ok := funcFile[f.Name()]; ok {
 			return fs.file, fs.starts
 		}
-		return traceSrcName, traceLineStarts
+		return cur.name, cur.starts
 	}
 
 	scaffold := func(n string) bool { return n == "jsmain" || n == "jsrun" }
@@ -350,7 +339,7 @@ func extractCallGraph(m *ir.Module) ([]cgDef, []cgCall) {
 		}
 	}
 	if unattributed > 0 {
-		fmt.Fprintf(os.Stderr, "callgraph: %d function(s) had no source file (attribution incomplete)\n", unattributed)
+		fmt.Fprintf(s.warn, "callgraph: %d function(s) had no source file (attribution incomplete)\n", unattributed)
 	}
 	return defs, calls
 }
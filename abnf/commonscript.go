@@ -1,8 +1,8 @@
 package abnf
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
@@ -164,7 +164,14 @@ func (cs *commonscript) Run(name scriptName, src string, ID int) (goja.Value, er
 		}
 	}
 
-	return cs.vm.RunProgram(p)
+	v, err := cs.vm.RunProgram(p)
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		if sbErr, ok := interrupted.Value().(*SandboxError); ok {
+			panic(sbErr) // The watchdog stopped the script: the error is the limit's, not the tag's.
+		}
+	}
+	return v, err
 }
 
 // getCurrentModuleFileName returns the source name of the JS code that is currently being
@@ -182,11 +189,12 @@ func (cs *commonscript) getCurrentModuleFileName() string {
 // NewCommonScript installs everything into the JS VM that parser and compiler scripts have
 // in common: console output, file access, string helpers, and the 'c', 'abnf' and 'llvm'
 // objects. Note that *compilerFuncMap is replaced with a fresh map; the caller can add its
-// own entries afterwards.
-func NewCommonScript(vm *goja.Runtime, compilerFuncMap *map[string]r.Object, preventDefaultOutput bool) *commonscript {
+// own entries afterwards. Output, files and the host API all go through the session s.
+func NewCommonScript(s *Session, vm *goja.Runtime, compilerFuncMap *map[string]r.Object, preventDefaultOutput bool) *commonscript {
 	var common commonscript
 
 	common.vm = vm
+	s.sandbox.watchVM(vm)
 	common.codeCache = make([]cachedProgram, 100)
 	common.codeCacheBySrc = map[string]*goja.Program{}
 
@@ -194,23 +202,23 @@ func NewCommonScript(vm *goja.Runtime, compilerFuncMap *map[string]r.Object, pre
 		vm.Set("print", func(a ...interface{}) (n int, err error) { return 0, nil })
 		vm.Set("println", func(a ...interface{}) (n int, err error) { return 0, nil })
 		vm.Set("printf", func(format string, a ...interface{}) (n int, err error) { return 0, nil })
-	} else { // Script output enabled (routed through outWriter so -pipe can capture it).
-		vm.Set("print", func(a ...interface{}) (int, error) { return fmt.Fprint(outWriter, a...) })
-		vm.Set("println", func(a ...interface{}) (int, error) { return fmt.Fprintln(outWriter, a...) })
-		vm.Set("printf", func(format string, a ...interface{}) (int, error) { return fmt.Fprintf(outWriter, format, a...) })
+	} else { // Script output enabled (routed through the session's output so -pipe can capture it).
+		vm.Set("print", func(a ...interface{}) (int, error) { return fmt.Fprint(s.out, a...) })
+		vm.Set("println", func(a ...interface{}) (int, error) { return fmt.Fprintln(s.out, a...) })
+		vm.Set("printf", func(format string, a ...interface{}) (int, error) { return fmt.Fprintf(s.out, format, a...) })
 	}
 
 	// eprintln is the DIAGNOSTIC channel of the tag scripts (warnings). It goes
-	// straight to standard error - never through outWriter, which -pipe swaps to
+	// to the session's warning writer - never through its output, which -pipe swaps to
 	// capture a producer stage's text, and never into the emitted module. It is
 	// bound outside the quiet branch above on purpose: -q/-qq are about module and
 	// program output, a warning is a diagnostic. The frozen host binds the same
 	// name identically (standardJSBindings in jsrt.go); the two must agree or the
 	// matrix goes red.
-	vm.Set("eprintln", func(a ...interface{}) (int, error) { return fmt.Fprintln(warnWriter, a...) })
+	vm.Set("eprintln", func(a ...interface{}) (int, error) { return fmt.Fprintln(s.warn, a...) })
 
 	vm.Set("sprintf", fmt.Sprintf) // Sprintf is no output.
-	vm.Set("exit", os.Exit)
+	vm.Set("exit", s.exit)
 
 	vm.Set("sleep", func(d time.Duration) { time.Sleep(d * time.Millisecond) })
 
@@ -264,7 +272,7 @@ func NewCommonScript(vm *goja.Runtime, compilerFuncMap *map[string]r.Object, pre
 			return false
 		}
 		includeFileName := filepath.Dir(common.getCurrentModuleFileName()) + string(os.PathSeparator) + filepath.Clean(fileName)
-		dat, err := ioutil.ReadFile(includeFileName)
+		dat, err := s.readHostFile(includeFileName)
 		if err != nil {
 			panic(err)
 		}
@@ -280,9 +288,12 @@ func NewCommonScript(vm *goja.Runtime, compilerFuncMap *map[string]r.Object, pre
 
 	vm.Set("moduleName", common.getCurrentModuleFileName)
 
+	// emit hands a value to the next -pipe segment, as its c.input (pipe.go).
+	vm.Set("emit", s.emit)
+
 	vm.Set("load", func(fileName string) string {
 		loadFileName := filepath.Dir(common.getCurrentModuleFileName()) + string(os.PathSeparator) + filepath.Clean(fileName)
-		dat, err := ioutil.ReadFile(loadFileName)
+		dat, err := s.readHostFile(loadFileName)
 		if err != nil {
 			panic(err)
 		}
@@ -290,12 +301,51 @@ func NewCommonScript(vm *goja.Runtime, compilerFuncMap *map[string]r.Object, pre
 	})
 	vm.Set("store", func(fileName, data string) {
 		storeFileName := filepath.Dir(common.getCurrentModuleFileName()) + string(os.PathSeparator) + filepath.Clean(fileName)
-		err := ioutil.WriteFile(storeFileName, []byte(data), 0644)
+		err := s.writeHostFile(storeFileName, data)
 		if err != nil {
 			panic(err)
 		}
 	})
 
+	// fs, path and env: see hostfs.go, and frozenHostFSBindings for -frozen.
+	hostPathOf := func(p string) string { return hostPath(common.getCurrentModuleFileName(), p) }
+	strArray := func(list []string) *goja.Object {
+		items := make([]interface{}, len(list))
+		for i, v := range list {
+			items[i] = v
+		}
+		return vm.NewArray(items...)
+	}
+	fsObj := vm.NewObject()
+	fsObj.Set("exists", func(p string) bool { return s.hostExists(hostPathOf(p)) })
+	fsObj.Set("stat", func(p string) goja.Value {
+		st, ok := s.hostStat(hostPathOf(p))
+		if !ok {
+			return goja.Null()
+		}
+		o := vm.NewObject()
+		o.Set("name", st.name)
+		o.Set("size", st.size)
+		o.Set("isDir", st.isDir)
+		o.Set("modTime", st.modTime)
+		return o
+	})
+	fsObj.Set("readDir", func(p string) *goja.Object { return strArray(s.hostReadDir(hostPathOf(p))) })
+	fsObj.Set("glob", func(pattern string) *goja.Object {
+		return strArray(s.hostGlob(common.getCurrentModuleFileName(), pattern))
+	})
+	fsObj.Set("mkdirAll", func(p string) { s.hostMkdirAll(hostPathOf(p)) })
+	vm.Set("fs", fsObj)
+	pathObj := vm.NewObject()
+	pathObj.Set("join", func(parts ...string) string { return filepath.Join(parts...) })
+	pathObj.Set("dir", filepath.Dir)
+	pathObj.Set("base", filepath.Base)
+	pathObj.Set("rel", hostRel)
+	vm.Set("path", pathObj)
+	envObj := vm.NewObject()
+	envObj.Set("get", s.hostGetenv)
+	vm.Set("env", envObj)
+
 	// correctReferencesAndIDs is a global (not part of abnf.*): it links a freshly
 	// built a-grammar so it can be compiled directly - resolving each Identifier to its
 	// Production and giving each Tag a UID. See references.correctReferencesAndIDs.
@@ -327,7 +377,7 @@ func NewCommonScript(vm *goja.Runtime, compilerFuncMap *map[string]r.Object, pre
 			if fileName == "" || fileName == "undefined" {
 				fileName = common.getCurrentModuleFileName()
 			}
-			productions, err := ParseWithAgrammar(agrammar, srcCode, fileName, options)
+			productions, err := s.parse(agrammar, srcCode, fileName, options)
 			if err != nil {
 				panic(err)
 			}
@@ -337,59 +387,84 @@ func NewCommonScript(vm *goja.Runtime, compilerFuncMap *map[string]r.Object, pre
 		// named rule (e.g. "Statement") rather than the grammar's declared :startRule().
 		// Used by the -main snippet form to parse a code fragment of the target language.
 		"parseFrom": func(agrammar *r.Rules, srcCode string, startRule string) *r.Rules {
-			productions, err := ParseWithAgrammar(agrammar, srcCode, common.getCurrentModuleFileName(), &Parseropts{StartRule: startRule})
+			productions, err := s.parse(agrammar, srcCode, common.getCurrentModuleFileName(), &Parseropts{StartRule: startRule})
 			if err != nil {
 				panic(err)
 			}
 			return productions
 		},
 		"compileRunStartScript": func(asg *r.Rules, aGrammar *r.Rules, slot int, traceEnabled bool) interface{} {
-			return compileASGInternal(asg, aGrammar, common.getCurrentModuleFileName(), slot, traceEnabled, preventDefaultOutput)
+			return s.compileASG(asg, aGrammar, common.getCurrentModuleFileName(), slot, traceEnabled, preventDefaultOutput)
 		},
+		// -repl (repl.go): c.repl is set, replRead reads the next line (null at the
+		// end of the input), replParse parses one and tells an unfinished one ("").
+		"repl":      s.Repl,
+		"replRead":  s.replRead,
+		"replParse": s.replParse,
+
 		"ABNFagrammar": AbnfAgrammar,
-		// True when -trace/-cfgraph collect source positions: the compilers then
-		// emit js_srcpos statement markers (see lib/compile-core.js stmtPos).
-		"tracing": TraceMarkersWanted(),
+		// True when -trace/-cfgraph/-pdebug collect source positions: the
+		// compilers then emit js_srcpos statement markers (see
+		// lib/compile-core.js stmtPos); under -pdebug (debugging) with the scope.
+		"tracing":   s.TraceMarkersWanted(),
+		"debugging": s.ProgramDebugger != nil,
 		// Import policy + source positions for clean grammar errors. warnImports
 		// is the -warn-imports flag; file is the program being compiled; lineOf
 		// turns an up.pos byte offset into a 1-based line (0 if unknown).
-		"warnImports":     WarnUnresolvedImports,
-		"warnUnsupported": WarnUnsupported,
-		"rtPrims":         RuntimePrims,
-		"rtLib":           RuntimeLib,
-		"file":            traceSrcName,
-		"lineOf":          func(pos int) int { return lineOfPos(pos) },
+		"warnImports":     s.WarnUnresolvedImports,
+		"warnUnsupported": s.WarnUnsupported,
+		"rtPrims":         s.RuntimePrims,
+		"rtLib":           s.RuntimeLib,
+		"file":            s.src.name,
+		"lineOf":          func(pos int) int { return s.lineOfPos(pos) },
+		// report hands a finding to the -diagnostics reporter: report(severity,
+		// code, message, file, pos) with pos an up.pos byte offset. It answers
+		// false without -diagnostics, and the script prints its text instead.
+		"report": s.reportDiag,
 		// The entry-point function name (-main flag, default "main").
-		"mainName": EntryPoint,
+		"mainName": s.EntryPoint,
 		// Output path for a native executable (-exe flag); "" means run in the IR
 		// interpreter instead. A -to-llvm-ir grammar hands its module to
 		// llvm.BuildExecutable when this is set.
-		"exePath": ExePath,
+		"exePath": s.ExePath,
 		// The runtime a native build links with the module (-rt, repeatable). A
 		// grammar hands it to llvm.BuildExecutable; supplying anything here also
 		// turns an unresolved symbol from a zero stub into a hard error.
-		"runtime": RuntimeInputs,
+		"runtime": s.RuntimeInputs,
+		// The program's command line arguments (after --) and standard input
+		// (-stdin): what the interpreter halves hand to sys.argv, main(args),
+		// input() and the like.
+		"args":  s.progArgs(),
+		"stdin": s.Stdin,
+		// The value the previous -pipe segment emit()ted, or null (pipe.go).
+		"input": s.pipe.input,
 		// Project-file imports (the -i include roots): findImport locates a
 		// grammar-mapped relative path ("a/b/C.kt"), readFile loads it, and
 		// pushSource/popSource swap the file/line attribution around the
 		// imported file's nested c.parse + c.compile walk. curFile is the
 		// dynamic variant of "file" (which is snapshotted at map creation).
-		"curFile":        func() string { return traceSrcName },
-		"findImport":     func(relPath string) string { return findImportFile(relPath) },
-		"readFile":       func(path string) string { return readImportFile(path) },
-		"pushSource":     func(name, text string) { pushTraceSource(name, text) },
-		"pushSourceFile": func(name string) { pushTraceSourceFile(name) },
-		"popSource":      func() { popTraceSource() },
+		"curFile":        func() string { return s.src.name },
+		"findImport":     func(relPath string) string { return s.findImportFile(relPath) },
+		"readFile":       func(path string) string { return s.readImportFile(path) },
+		"pushSource":     func(name, text string) { s.pushTraceSource(name, text) },
+		"pushSourceFile": func(name string) { s.pushTraceSourceFile(name) },
+		"popSource":      func() { s.popTraceSource() },
 	}
 	// The three host API objects are wrapped for goja ONCE per member instead of
 	// per access (see hostAPIObject). c.localAsg is the only entry a run rebinds
 	// (per tag / per :script()), so it is the only one read through every time.
 	vm.Set("c", newHostAPIObject(vm, compilerFuncMap, "localAsg"))
-	vm.Set("abnf", newHostAPIObject(vm, r.AbnfFuncMap))
-	vm.Set("llvm", newHostAPIObject(vm, llvmFuncMap))
+	vm.Set("abnf", newHostAPIObject(vm, s.abnfFuncs(common.getCurrentModuleFileName)))
+	vm.Set("llvm", newHostAPIObject(vm, s.llvmFuncs()))
 
 	installGojaCaseMapping(vm)
 
+	// The embedder's Go functions and values (hostbind.go) come last, so they
+	// win over the built-in API like the frozen bindings do.
+	for name, v := range s.hostBindings() {
+		vm.Set(name, v)
+	}
+
 	return &common
 }
 
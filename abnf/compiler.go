@@ -7,71 +7,6 @@ import (
 	"14.gy/mec/abnf/r"
 )
 
-// WarnUnresolvedImports is set from the -warn-imports CLI flag. When false (the
-// default) a program import a grammar cannot resolve aborts the compile; when
-// true such an import is reported as a warning and skipped. Grammars read it as
-// c.warnImports and turn it into the policy via lib resolveImports().
-var WarnUnresolvedImports = false
-
-// WarnUnsupported is set from the -warn-unsupported CLI flag. When false (the
-// default) a parsed-but-not-implemented construct aborts the compile with a
-// clean file:line message; when true it is reported as a warning and replaced by
-// a benign placeholder (a no-op statement / undefined expression) so the rest of
-// the program still compiles - enough to build call graphs, CFGs and traces from
-// a language that is only partially understood. Grammars read it as
-// c.warnUnsupported via the lib notImplemented() family.
-var WarnUnsupported = false
-
-// RuntimePrims is set from the -rt-prims CLI flag. It asks a compiler grammar to
-// implement the derivable half of its runtime IN the source language instead of
-// calling the Go externals: languages/metajs-to-llvm-ir.abnf then compiles
-// languages/lib/rt-prims.metajs into the emitted module and routes js_ne, js_le,
-// js_typeof and friends to those IR functions, so whatever is still `declare`d
-// afterwards is the measured floor of primitives that must be written in C
-// (docs/runtime-rework-plan.md, phase 1). Grammars read it as c.rtPrims.
-var RuntimePrims = false
-
-// RuntimeLib is set from the -rt-lib CLI flag. It asks metajs-to-llvm-ir.abnf to
-// compile its input as a LINKABLE RUNTIME LIBRARY (layer 2 of
-// docs/runtime-rework-plan.md) rather than as a program: every top-level js_*
-// function gets an exported C-ABI shim, the module's own function/string names are
-// offset so they cannot collide with the program module it is linked against, and
-// the function table it emits is jsdispatch_ext (the tail the program's own
-// jsdispatch falls through to) instead of jsdispatch. Grammars read it as c.rtLib.
-var RuntimeLib = false
-
-// EntryPoint is the name of the top-level function a compiled program calls as
-// its entry point, set from the -main CLI flag. Grammars read it as c.mainName; it
-// lets a program whose entry function is not named main - or a real-world file with
-// no main() at all - be run from a chosen function instead. Empty means "unset": each
-// grammar then falls back to its own default entry (main for most, Main for C#).
-var EntryPoint = ""
-
-// ExePath is the output path for a native executable, set from the -exe CLI flag.
-// A -to-llvm-ir grammar reads it as c.exePath: when non-empty it hands the built
-// ir.Module to llvm.BuildExecutable (clang) and writes a real binary instead of
-// running the module in the built-in IR interpreter. Empty means "unset".
-var ExePath = ""
-
-// RuntimeInputs are extra files clang links into the -exe build alongside the
-// emitted module, set from the -rt CLI flag (repeatable): .c sources, .ll modules,
-// .o objects, .a archives - anything one clang invocation accepts. Grammars read
-// the list as c.runtime and hand it to llvm.BuildExecutable, which also merges it
-// in on its own, so a grammar that supplies its own runtime and a user who adds one
-// on the command line compose instead of overriding each other.
-//
-// Declaring a runtime also changes what an unresolved symbol MEANS: see
-// buildExecutable in llvmmap.go - it is then an error, not a zero stub.
-var RuntimeInputs []string
-
-// LinkDirs and LinkLibs are the -L and -l passthrough for the -exe link, so a
-// build can use real system libraries (e.g. -l m). They reach clang verbatim, in
-// command line order, after the module and the runtime inputs.
-var (
-	LinkDirs []string
-	LinkLibs []string
-)
-
 // ----------------------------------------------------------------------------
 // ASG compiler
 
@@ -183,9 +118,11 @@ func appendUpValue(dst []interface{}, v r.Object) []interface{} {
 }
 
 type compiler struct {
+	sess       *Session
 	eng        scriptEngine
-	fileName   string // The compile target (the parsed input file).
-	moduleName string // The grammar's :origin() (fallback: fileName). Tag scripts run under this module, so their include/load/store resolve grammar-relative.
+	fileName   string     // The compile target (the parsed input file).
+	moduleName string     // The grammar's :origin() (fallback: fileName). Tag scripts run under this module, so their include/load/store resolve grammar-relative.
+	debug      *debugWalk // The -debug state of this walk (debugger.go); nil when nobody debugs it.
 }
 
 //	 OUT
@@ -303,11 +240,19 @@ func (co *compiler) compileRule(rule *r.Rule, localASG *r.Rules, slot int, depth
 		addLtrIn(co.eng.Ltr(), rule.String)
 		return map[string]r.Object{"in": rule.String, "stack": []interface{}{}}
 	case r.Tag:
+		debugged := co.debug != nil && co.debug.enter(rule, slot)
 		// First collect all the data.
 		upStream := co.compile(rule.Childs, slot, depth+1) // Evaluate the child productions of the TAG to collect their values.
 		// The tag sees the source position of its node as up.pos (the builders
 		// capture it for traces and diagrams); it does not propagate upwards.
 		upStream["pos"] = rule.Pos
+		if d := co.sess.ProgramDebugger; d != nil {
+			// -pdebug stops a statement where it starts: the markers carry
+			// up.start as well (lib/compile-core.js stmtPos).
+			if start, ok := d.tagStarts[rule]; ok {
+				upStream["start"] = start
+			}
+		}
 		if localASG == nil {
 			localASG = &r.Rules{rule}
 		}
@@ -315,8 +260,15 @@ func (co *compiler) compileRule(rule *r.Rule, localASG *r.Rules, slot int, depth
 		// lives there), so a load()/include() in a tag resolves relative to the
 		// grammar under goja exactly like under -frozen; the position suffix
 		// still names the input node for error messages.
+		if debugged {
+			co.debug.tag(upStream, localASG, slot, depth)
+		}
 		co.eng.RunTagCode(rule, nodeScript(co.moduleName, ":tag:pos:", rule.Pos), upStream, localASG, slot, depth)
+		if debugged {
+			co.debug.leave()
+		}
 		delete(upStream, "pos")
+		delete(upStream, "start")
 		return upStream
 	default:
 		// Not all rules have childs. E.g. a Number (from :number()) is a leaf like a Token, but without text.
@@ -328,10 +280,10 @@ func (co *compiler) compileRule(rule *r.Rule, localASG *r.Rules, slot int, depth
 	return map[string]r.Object{"in": ""}
 }
 
-func compileASGInternal(asg *r.Rules, aGrammar *r.Rules, fileName string, slot int, traceEnabled bool, preventDefaultOutput bool) interface{} {
-	var co compiler
+func (s *Session) compileASG(asg *r.Rules, aGrammar *r.Rules, fileName string, slot int, traceEnabled bool, preventDefaultOutput bool) interface{} {
+	co := compiler{sess: s}
 
-	if UseFrozenScripts {
+	if s.Frozen {
 		co.eng = newFrozenEngine(&co, asg, aGrammar, traceEnabled, preventDefaultOutput)
 	} else {
 		co.eng = NewCompilerScript(&co, asg, aGrammar, traceEnabled, preventDefaultOutput)
@@ -346,6 +298,13 @@ func compileASGInternal(asg *r.Rules, aGrammar *r.Rules, fileName string, slot i
 		co.moduleName = co.fileName
 	}
 
+	// The built-in a-grammars are not debugged: their tags are no file's, and
+	// stepping through the compile of the grammar itself would only be in the way.
+	if s.Debugger != nil && aGrammar != AbnfAgrammar && aGrammar != jsAgrammar {
+		co.debug = s.Debugger.walk(&co, aGrammar)
+		defer co.debug.end()
+	}
+
 	startScript := r.GetStartScript(aGrammar)
 
 	var res interface{}
@@ -365,15 +324,20 @@ func compileASGInternal(asg *r.Rules, aGrammar *r.Rules, fileName string, slot i
 
 // CompileASG compiles an "abstract semantic graph". This is similar to an AST, but it also contains the semantic of the language.
 // The aGrammar is only needed for its start script (the parser needs it for everything else, the ASG already contains the rest).
-func CompileASG(asg *r.Rules, aGrammar *r.Rules, fileName string, slot int, traceEnabled, preventDefaultOutput bool) (res *r.Rules, e error) {
+func CompileASG(asg *r.Rules, aGrammar *r.Rules, fileName string, slot int, traceEnabled, preventDefaultOutput bool) (*r.Rules, error) {
+	return defaultSession().compile(asg, aGrammar, fileName, slot, traceEnabled, preventDefaultOutput)
+}
+
+func (s *Session) compile(asg *r.Rules, aGrammar *r.Rules, fileName string, slot int, traceEnabled, preventDefaultOutput bool) (res *r.Rules, e error) {
+	defer s.sandbox.enter()()
 	defer func() {
 		if err := recover(); err != nil {
 			res = nil
-			e = fmt.Errorf("%s", err)
+			e = recoveredError(err)
 		}
 	}()
 
-	resObj := compileASGInternal(asg, aGrammar, fileName, slot, traceEnabled, preventDefaultOutput)
+	resObj := s.compileASG(asg, aGrammar, fileName, slot, traceEnabled, preventDefaultOutput)
 
 	// If the start script returned an a-grammar, convert and return it. Everything else
 	// (e.g. a number or a string from a calculator grammar) results in res == nil.
@@ -2,7 +2,7 @@ package abnf
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"regexp"
 	"strings"
 
@@ -92,35 +92,36 @@ func sprintTraceStack(stack []r.Object, space string) string {
 
 // traceTagTop/traceTagBottom print the tag trace (the -vvN / c.compile(..., true)
 // debug aid) around one tag execution. Both engines share them, and they write
-// to STDERR: printing to stdout corrupted the -q byte identity and would leak
-// into the next -pipe segment's input.
-func traceTagTop(traceCount int, tag *r.Rule, slot int, depth int, stack []r.Object, ltr map[string]r.Object, upStream map[string]r.Object) {
+// to the session's warning writer (STDERR on the command line): printing to
+// stdout corrupted the -q byte identity and would leak into the next -pipe
+// segment's input.
+func traceTagTop(w io.Writer, traceCount int, tag *r.Rule, slot int, depth int, stack []r.Object, ltr map[string]r.Object, upStream map[string]r.Object) {
 	space := "  "
 
 	code := (*tag.CodeChilds)[slot].String
 
-	fmt.Fprint(os.Stderr, ">>>>>>>>>> Code block. Depth:", depth, "  Run # (", traceCount, "), ", tag.ToString(), "\n")
+	fmt.Fprint(w, ">>>>>>>>>> Code block. Depth:", depth, "  Run # (", traceCount, "), ", tag.ToString(), "\n")
 	removeSpace1 := regexp.MustCompile(`[ \t]+`)
 	code = removeSpace1.ReplaceAllString(code, " ")
 	removeSpace2 := regexp.MustCompile(`[\n\r]\s+`)
 	code = removeSpace2.ReplaceAllString(code, "\n")
 	code = strings.ReplaceAll(code, "\n", "\n"+space)
 
-	fmt.Fprint(os.Stderr, space, "--\n", space, code, "\n")
+	fmt.Fprint(w, space, "--\n", space, code, "\n")
 
-	fmt.Fprint(os.Stderr, space, "---\n", space, ">>>>Before call:\n")
-	fmt.Fprint(os.Stderr, space, ">>stack:\n", sprintTraceStack(stack, space), space, "--\n")
-	fmt.Fprint(os.Stderr, space, ">>ltr: ", fmt.Sprintf("%v", ltr), "\n", space, "--\n")
-	fmt.Fprint(os.Stderr, space, ">>up: ", fmt.Sprintf("%v", upStream), "\n")
-	fmt.Fprint(os.Stderr, space, "---\n", space, ">>>>Code output:\n")
+	fmt.Fprint(w, space, "---\n", space, ">>>>Before call:\n")
+	fmt.Fprint(w, space, ">>stack:\n", sprintTraceStack(stack, space), space, "--\n")
+	fmt.Fprint(w, space, ">>ltr: ", fmt.Sprintf("%v", ltr), "\n", space, "--\n")
+	fmt.Fprint(w, space, ">>up: ", fmt.Sprintf("%v", upStream), "\n")
+	fmt.Fprint(w, space, "---\n", space, ">>>>Code output:\n")
 }
 
-func traceTagBottom(stack []r.Object, ltr map[string]r.Object, upStream map[string]r.Object) {
+func traceTagBottom(w io.Writer, stack []r.Object, ltr map[string]r.Object, upStream map[string]r.Object) {
 	space := "  "
-	fmt.Fprint(os.Stderr, space, "---\n", space, ">>>>After call:\n")
-	fmt.Fprint(os.Stderr, space, ">>stack:\n", sprintTraceStack(stack, space), space, "--\n")
-	fmt.Fprint(os.Stderr, space, ">>ltr: ", fmt.Sprintf("%v", ltr), "\n", space, "--\n")
-	fmt.Fprint(os.Stderr, space, ">>up: ", fmt.Sprintf("%v", upStream), "\n", space, "--\n\n\n")
+	fmt.Fprint(w, space, "---\n", space, ">>>>After call:\n")
+	fmt.Fprint(w, space, ">>stack:\n", sprintTraceStack(stack, space), space, "--\n")
+	fmt.Fprint(w, space, ">>ltr: ", fmt.Sprintf("%v", ltr), "\n", space, "--\n")
+	fmt.Fprint(w, space, ">>up: ", fmt.Sprintf("%v", upStream), "\n", space, "--\n\n\n")
 }
 
 // HandleTagCode executes the JS code of the given slot of a Tag (the ASG carries multiple
@@ -159,7 +160,7 @@ func (cs *compilerscript) HandleTagCode(tag *r.Rule, name scriptName, upStream m
 
 	if cs.traceEnabled {
 		cs.traceCount++
-		traceTagTop(cs.traceCount, tag, slot, depth, cs.Stack, cs.LtrStream, upStream)
+		traceTagTop(cs.co.sess.warn, cs.traceCount, tag, slot, depth, cs.Stack, cs.LtrStream, upStream)
 	}
 
 	code := (*tag.CodeChilds)[slot].String
@@ -170,7 +171,7 @@ func (cs *compilerscript) HandleTagCode(tag *r.Rule, name scriptName, upStream m
 	}
 
 	if cs.traceEnabled {
-		traceTagBottom(cs.Stack, cs.LtrStream, upStream)
+		traceTagBottom(cs.co.sess.warn, cs.Stack, cs.LtrStream, upStream)
 	}
 
 	return v
@@ -194,7 +195,7 @@ func (cs *compilerscript) Ltr() map[string]r.Object {
 // initFuncMap installs the compiler specific JS API on top of the common one:
 // the local and global stack functions, 'ltr', and the c.compile()/c.asg/c.agrammar entries.
 func (cs *compilerscript) initFuncMap() {
-	cs.common = NewCommonScript(cs.vm, &cs.compilerFuncMap, cs.preventDefaultOutput)
+	cs.common = NewCommonScript(cs.co.sess, cs.vm, &cs.compilerFuncMap, cs.preventDefaultOutput)
 
 	cs.vm.Set("popg", func() interface{} {
 		if len(cs.Stack) > 0 {
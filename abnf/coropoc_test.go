@@ -45,7 +45,7 @@ func TestCoroPoC(t *testing.T) {
 			t.Fatalf("llvm.Run half failed: %v", r)
 		}
 	}()
-	res := runJSModule(m, "jsmain")
+	res := defaultSession().runJSModule(m, "jsmain")
 	// '#' so build.sh can strip this line and diff the rest against the native
 	// binary's stdout without the two halves needing to agree on it.
 	fmt.Fprintf(os.Stderr, "# coro PoC: llvm.Run returned %d\n", res.Ret)
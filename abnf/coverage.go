@@ -0,0 +1,592 @@
+package abnf
+
+// Grammar coverage (-grammar-coverage): which parts of a grammar a set of
+// programs actually exercises.
+//
+// A coverage point is one place of a grammar that a parse can "take": a
+// production, one alternative of an Or, the body of an Optional, or a Tag. The
+// points of an a-grammar are found once, by walking each production's body, and
+// named structurally - the production plus the child index path down to the
+// point (Expr/0.2|1 is the second alternative of the Or that is child 2 of child
+// 0 of Expr) - so the same grammar yields the same names on every run, no
+// matter which engine or which program drives the parse.
+//
+// The parser counts a point each time it matches (see the pa.cov hooks in
+// apply()), into tables of its session's own. Every parse that ends merges its
+// counts into the coverageRun, which the session shares with its forks, so the
+// workers of a -batch count into one place without a lock on the hot path. The
+// run is written to the -grammar-coverage file once, when the session closes or
+// exit() ends the process. The file - like -callgraph-append - is never
+// truncated: the counts of many runs over a test corpus accumulate into one
+// file, and -render coverage / coverage-html annotate them onto the grammar
+// source.
+//
+// Only grammars that come from a file are measured. The built-in ABNF a-grammar
+// (which parses every grammar and :include() fragment) and the frozen MetaJS
+// a-grammar (which parses the tag scripts under -frozen) are infrastructure, not
+// the grammar under test; leaving them out is also what makes a goja run and a
+// -frozen run of the same program record the same file. The productions merged
+// in from :include() fragments ARE measured, attributed to their own file.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf/r"
+)
+
+// The kinds of coverage point.
+const (
+	covProduction  = "production"
+	covAlternative = "alternative"
+	covOptional    = "optional"
+	covTag         = "tag"
+)
+
+// CoveragePoint is one line of the -grammar-coverage file.
+type CoveragePoint struct {
+	File  string `json:"file"`            // The grammar (or :include() fragment) file the point is written in.
+	Kind  string `json:"kind"`            // production, alternative, optional or tag.
+	Prod  string `json:"prod"`            // The production the point belongs to.
+	Path  string `json:"path"`            // The child index path inside the production ("" for the production itself).
+	Pos   int    `json:"pos"`             // Byte offset in File where the point's rule was defined (0 = unknown).
+	Label string `json:"label,omitempty"` // A short rendering of the rule, for the report.
+	Hits  int    `json:"hits"`
+}
+
+func (p *CoveragePoint) key() string {
+	return p.File + "\x00" + p.Prod + "\x00" + p.Kind + "\x00" + p.Path
+}
+
+// covRef addresses a point from the parser's side: the grammar rule, plus the
+// alternative index for an Or (-1 for every other kind).
+type covRef struct {
+	rule *r.Rule
+	alt  int
+}
+
+// covTable holds the points of one a-grammar, as one session counts them.
+type covTable struct {
+	size   int // len(*agrammar) when the table was built; an :include() grows it.
+	points map[covRef]*CoveragePoint
+	files  map[string]bool // The files the points are written in.
+}
+
+// coverageRun is the -grammar-coverage state of a session and its forks: the
+// counts of every parse that ended, by point key.
+type coverageRun struct {
+	mu     sync.Mutex
+	points map[string]*CoveragePoint
+	files  map[string]bool           // The files measured.
+	base   map[string]*CoveragePoint // The file's content as it was before this run (read on the first flush).
+	dirty  bool                      // Counts merged since the last flush.
+}
+
+// coverageFor returns the coverage table of an a-grammar, or nil when coverage
+// is off or the grammar is not measured. Called once per parse, after the
+// :include() commands have assembled the grammar.
+func (s *Session) coverageFor(agrammar *r.Rules) *covTable {
+	if s.CoverageOutPath == "" || agrammar == nil || agrammar == AbnfAgrammar || agrammar == jsAgrammar {
+		return nil
+	}
+	if s.covTables == nil {
+		s.covTables = map[*r.Rules]*covTable{}
+	}
+	t := s.covTables[agrammar]
+	if t != nil && t.size == len(*agrammar) {
+		return t
+	}
+	// New, or grown by an :include() since: rebuild, keeping the counts of the
+	// points that survive (the rules themselves are the same pointers).
+	nt := buildCovTable(agrammar)
+	if t != nil {
+		for ref, p := range t.points {
+			if np := nt.points[ref]; np != nil {
+				np.Hits += p.Hits
+			}
+		}
+	}
+	if len(nt.points) == 0 {
+		return nil
+	}
+	s.covTables[agrammar] = nt
+	return nt
+}
+
+// buildCovTable collects the points of an a-grammar. The top level list is
+// split into files by the :origin() stamps: CompileASG appends the stamp BEHIND
+// a grammar's rules, and an :include() appends the fragment's rules (with their
+// own stamp) behind the includer's, so every production belongs to the first
+// stamp that follows it.
+func buildCovTable(agrammar *r.Rules) *covTable {
+	t := &covTable{size: len(*agrammar), points: map[covRef]*CoveragePoint{}, files: map[string]bool{}}
+	file := ""
+	for i := len(*agrammar) - 1; i >= 0; i-- {
+		rule := (*agrammar)[i]
+		if rule.Operator == r.Command && rule.String == "origin" && rule.CodeChilds != nil && len(*rule.CodeChilds) > 0 {
+			file = (*rule.CodeChilds)[0].String
+			continue
+		}
+		if rule.Operator != r.Production || file == "" {
+			continue
+		}
+		t.files[file] = true
+		t.points[covRef{rule, -1}] = &CoveragePoint{File: file, Kind: covProduction, Prod: rule.String, Pos: rule.Pos, Label: rule.String}
+		t.walk(file, rule.String, rule.Childs, "")
+	}
+	return t
+}
+
+// walk adds the points inside one production body. It does not follow
+// Identifiers: the production they name has its own points.
+func (t *covTable) walk(file, prod string, rules *r.Rules, path string) {
+	if rules == nil {
+		return
+	}
+	for i, rule := range *rules {
+		p := path + "." + itoa(i)
+		if path == "" {
+			p = itoa(i)
+		}
+		switch rule.Operator {
+		case r.Or:
+			for j, alt := range *rule.Childs {
+				ap := p + "|" + itoa(j)
+				pos := alt.Pos
+				if pos == 0 {
+					pos = rule.Pos
+				}
+				t.points[covRef{rule, j}] = &CoveragePoint{File: file, Kind: covAlternative, Prod: prod, Path: ap, Pos: pos, Label: covLabel(alt)}
+				t.walk(file, prod, &r.Rules{alt}, ap)
+			}
+			continue
+		case r.Optional:
+			t.points[covRef{rule, -1}] = &CoveragePoint{File: file, Kind: covOptional, Prod: prod, Path: p, Pos: rule.Pos, Label: covLabel(rule)}
+		case r.Tag:
+			t.points[covRef{rule, -1}] = &CoveragePoint{File: file, Kind: covTag, Prod: prod, Path: p, Pos: rule.Pos, Label: "<~~ " + compactCode(rule.CodeChilds) + " ~~>"}
+		}
+		t.walk(file, prod, rule.Childs, p)
+	}
+}
+
+// hit counts one match of a point. A rule without a point (one that is not
+// measured, e.g. a synthetic sequence) is ignored.
+func (t *covTable) hit(rule *r.Rule, alt int) {
+	if p := t.points[covRef{rule, alt}]; p != nil {
+		p.Hits++
+	}
+}
+
+// covLabel renders a rule for the report: the structure-only tree, without the
+// color escapes the error dump may carry, and cut to one short line.
+func covLabel(rule *r.Rule) string {
+	return clip(stripANSI(rule.SerializeMinimal()), 60)
+}
+
+// compactCode joins a tag's code and collapses its whitespace to one short line.
+func compactCode(code *r.Rules) string {
+	if code == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range *code {
+		b.WriteString(c.String)
+		b.WriteByte(' ')
+	}
+	return clip(strings.Join(strings.Fields(b.String()), " "), 40)
+}
+
+func clip(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "..."
+}
+
+// stripANSI removes the CSI color sequences r.ColorErrorOutput adds.
+func stripANSI(s string) string {
+	if !strings.ContainsRune(s, 0x1b) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x1b && i+1 < len(s) && s[i+1] == '[' {
+			j := i + 2
+			for j < len(s) && (s[j] < '@' || s[j] > '~') {
+				j++
+			}
+			i = j
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// mergeCoverage moves the counts of a parse from the session's table into the
+// run it shares with its forks. The table starts from zero again, so the next
+// parse with the same grammar does not count the same matches twice.
+func (s *Session) mergeCoverage(t *covTable) {
+	c := s.coverage
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.points == nil {
+		c.points, c.files = map[string]*CoveragePoint{}, map[string]bool{}
+	}
+	for f := range t.files {
+		c.files[f] = true
+	}
+	for _, p := range t.points {
+		k := p.key()
+		if m := c.points[k]; m != nil { // Counted before, or the same file measured through two grammars (a shared fragment).
+			m.Hits += p.Hits
+		} else {
+			cp := *p
+			c.points[k] = &cp
+		}
+		p.Hits = 0
+	}
+	c.dirty = true
+}
+
+// flushCoverage writes the counts of this run to the -grammar-coverage file. It
+// runs when the session closes and before exit() ends the process - most
+// language tests end in the program's own exit(), which never returns to main -
+// and writes nothing when no parse ended since the last time. The file is
+// rewritten whole (temp file + rename), as the file's content before this run
+// plus everything counted since, so a second flush does not count twice.
+//
+// A grammar file measured in this run REPLACES its old points: when the grammar
+// was edited between runs, a point whose path no longer exists is dropped with
+// its counts, and the counts of the points that still exist carry over.
+func (s *Session) flushCoverage() {
+	c := s.coverage
+	if s.CoverageOutPath == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return
+	}
+	if c.base == nil {
+		c.base = map[string]*CoveragePoint{}
+		if pts, err := readCoverage(s.CoverageOutPath); err == nil {
+			for _, p := range pts {
+				c.base[p.key()] = p
+			}
+		}
+	}
+	merged := map[string]*CoveragePoint{}
+	for k, p := range c.points {
+		cp := *p
+		if b := c.base[k]; b != nil {
+			cp.Hits += b.Hits
+		}
+		merged[k] = &cp
+	}
+	for k, b := range c.base {
+		if !c.files[b.File] {
+			merged[k] = b
+		}
+	}
+	if err := writeCoverage(s.CoverageOutPath, merged); err != nil {
+		fmt.Fprintln(s.warn, "grammar coverage failed: ", err)
+	}
+	c.dirty = false
+}
+
+func writeCoverage(path string, points map[string]*CoveragePoint) error {
+	list := make([]*CoveragePoint, 0, len(points))
+	for _, p := range points {
+		list = append(list, p)
+	}
+	sortCoverage(list)
+	var b strings.Builder
+	for _, p := range list {
+		line, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".mec-coverage-*")
+	if err != nil {
+		return err
+	}
+	_, werr := tmp.WriteString(b.String())
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil {
+		os.Remove(tmp.Name())
+		if werr != nil {
+			return werr
+		}
+		return cerr
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func readCoverage(path string) ([]*CoveragePoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var pts []*CoveragePoint
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var p CoveragePoint
+		if json.Unmarshal(sc.Bytes(), &p) != nil || p.Kind == "" {
+			continue
+		}
+		pts = append(pts, &p)
+	}
+	return pts, sc.Err()
+}
+
+// sortCoverage orders points by file, then by source position (the order the
+// report reads them in), then by name for points at the same offset.
+func sortCoverage(pts []*CoveragePoint) {
+	sort.Slice(pts, func(i, j int) bool {
+		a, b := pts[i], pts[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Pos != b.Pos {
+			return a.Pos < b.Pos
+		}
+		if a.Prod != b.Prod {
+			return a.Prod < b.Prod
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Path < b.Path
+	})
+}
+
+// ----------------------------------------------------------------------------
+// The report (-render coverage / coverage-html)
+
+// covStats counts the covered and the total points of each kind.
+type covStats map[string][2]int
+
+func (s covStats) add(p *CoveragePoint) {
+	c := s[p.Kind]
+	if p.Hits > 0 {
+		c[0]++
+	}
+	c[1]++
+	s[p.Kind] = c
+}
+
+func (s covStats) String() string {
+	var parts []string
+	for _, k := range []string{covProduction, covAlternative, covOptional, covTag} {
+		c := s[k]
+		if c[1] == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%ss %d/%d (%.1f%%)", k, c[0], c[1], 100*float64(c[0])/float64(c[1])))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// covWhat names a point in a sentence: "alternative 3 of Expr".
+func covWhat(p *CoveragePoint) string {
+	switch p.Kind {
+	case covProduction:
+		return "production " + p.Prod
+	case covAlternative:
+		alt := p.Path[strings.LastIndexByte(p.Path, '|')+1:]
+		n := 0
+		fmt.Sscan(alt, &n)
+		return fmt.Sprintf("alternative %d of %s: %s", n+1, p.Prod, p.Label)
+	}
+	return p.Kind + " in " + p.Prod + ": " + p.Label
+}
+
+// RenderCoverage reads a -grammar-coverage file and writes the report to out:
+// per grammar file a summary line, then the grammar source with every line that
+// holds a point marked - "+" when all its points matched, "!" when one did not -
+// and each uncovered point spelled out under its line with a caret at its
+// column. asHTML renders the same as one standalone HTML page, with the
+// uncovered lines highlighted and a hover title on every marker.
+func RenderCoverage(asHTML bool, path string, out io.Writer) error {
+	if path == "" {
+		return fmt.Errorf("-render coverage needs the -grammar-coverage <file> flag as its input")
+	}
+	pts, err := readCoverage(path)
+	if err != nil {
+		return err
+	}
+	sortCoverage(pts)
+	byFile := map[string][]*CoveragePoint{}
+	var files []string
+	total := covStats{}
+	for _, p := range pts {
+		if byFile[p.File] == nil {
+			files = append(files, p.File)
+		}
+		byFile[p.File] = append(byFile[p.File], p)
+		total.add(p)
+	}
+
+	w := bufio.NewWriter(out)
+	if asHTML {
+		fmt.Fprint(w, covHTMLHead)
+		fmt.Fprintf(w, "<h1>Grammar coverage</h1>\n<p>%s</p>\n", html.EscapeString(total.String()))
+	} else {
+		fmt.Fprintf(w, "Grammar coverage: %s\n", total)
+	}
+	for _, f := range files {
+		renderCoverageFile(w, f, byFile[f], asHTML)
+	}
+	if asHTML {
+		fmt.Fprint(w, "</body>\n</html>\n")
+	}
+	return w.Flush()
+}
+
+func renderCoverageFile(w *bufio.Writer, file string, pts []*CoveragePoint, asHTML bool) {
+	stats := covStats{}
+	for _, p := range pts {
+		stats.add(p)
+	}
+	src := ""
+	if dat, err := os.ReadFile(file); err == nil {
+		src = StripBOM(string(dat))
+	}
+
+	// The points by line, placed on the last char of their rule (a Pos is the
+	// offset right BEHIND the rule). A point whose position is unknown (or no
+	// longer fits a since edited file) is listed at the end instead.
+	type placed struct {
+		p   *CoveragePoint
+		col int
+	}
+	lines := strings.Split(src, "\n")
+	byLine := map[int][]placed{}
+	var unplaced []*CoveragePoint
+	for _, p := range pts {
+		if src == "" || p.Pos <= 0 || p.Pos > len(src) {
+			unplaced = append(unplaced, p)
+			continue
+		}
+		line, col, _ := lineCol(src, p.Pos-1)
+		byLine[line] = append(byLine[line], placed{p, col})
+	}
+
+	if asHTML {
+		fmt.Fprintf(w, "<h2>%s</h2>\n<p>%s</p>\n<pre>", html.EscapeString(file), html.EscapeString(stats.String()))
+		for i, text := range lines {
+			here := byLine[i+1]
+			class := ""
+			if len(here) > 0 {
+				class = "hit"
+				for _, pl := range here {
+					if pl.p.Hits == 0 {
+						class = "miss"
+					}
+				}
+			}
+			// Markers go in at their column, right to left so the earlier
+			// columns stay valid.
+			runes := []rune(text)
+			var b strings.Builder
+			last := len(runes)
+			sort.SliceStable(here, func(a, b int) bool { return here[a].col > here[b].col })
+			var parts []string
+			for _, pl := range here {
+				c := pl.col // Behind the rule's last char.
+				if c > last {
+					c = last
+				}
+				parts = append(parts, html.EscapeString(string(runes[c:last])))
+				mark, cls := "✓", "ok"
+				if pl.p.Hits == 0 {
+					mark, cls = "✗", "no"
+				}
+				parts = append(parts, fmt.Sprintf(`<span class="%s" title="%s (%d hits)">%s</span>`, cls, html.EscapeString(covWhat(pl.p)), pl.p.Hits, mark))
+				last = c
+			}
+			parts = append(parts, html.EscapeString(string(runes[:last])))
+			for k := len(parts) - 1; k >= 0; k-- {
+				b.WriteString(parts[k])
+			}
+			if class != "" {
+				fmt.Fprintf(w, `<span class="ln">%5d</span> <span class="%s">%s</span>`+"\n", i+1, class, b.String())
+			} else {
+				fmt.Fprintf(w, `<span class="ln">%5d</span> %s`+"\n", i+1, b.String())
+			}
+		}
+		fmt.Fprint(w, "</pre>\n")
+		for _, p := range unplaced {
+			fmt.Fprintf(w, "<p class=\"%s\">%s (%d hits)</p>\n", map[bool]string{true: "hit", false: "miss"}[p.Hits > 0], html.EscapeString(covWhat(p)), p.Hits)
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "\n== %s: %s\n", file, stats)
+	for i, text := range lines {
+		here := byLine[i+1]
+		mark := " "
+		for _, pl := range here {
+			if mark == " " {
+				mark = "+"
+			}
+			if pl.p.Hits == 0 {
+				mark = "!"
+			}
+		}
+		fmt.Fprintf(w, "%s %5d | %s\n", mark, i+1, text)
+		for _, pl := range here {
+			if pl.p.Hits > 0 {
+				continue
+			}
+			fmt.Fprintf(w, "        | %s^ uncovered %s\n", strings.Repeat(" ", pl.col-1), covWhat(pl.p))
+		}
+	}
+	for _, p := range unplaced {
+		if p.Hits == 0 {
+			fmt.Fprintf(w, "uncovered %s\n", covWhat(p))
+		}
+	}
+}
+
+const covHTMLHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Grammar coverage</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+pre { font-family: monospace; line-height: 1.35; }
+.ln { color: #999; user-select: none; }
+.hit { background: #e6ffe6; }
+.miss { background: #ffe0e0; }
+.ok { color: #2a2; font-weight: bold; cursor: help; }
+.no { color: #fff; background: #d22; font-weight: bold; cursor: help; }
+</style>
+</head>
+<body>
+`
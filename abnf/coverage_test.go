@@ -0,0 +1,156 @@
+package abnf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestGrammarCoverageAccumulates pins what -grammar-coverage promises a test
+// corpus: every alternative, option and production is a point of its own, a
+// point the programs never take stays in the file with zero hits (that is the
+// whole report), and a second run ADDS to the first instead of replacing it.
+//
+// The points are named structurally and looked up by rule pointer, so the one
+// subtle part is the rebuild after the grammar is compiled again: the second
+// run below compiles a fresh a-grammar from the same source, and its counts
+// must still land on the points the first run wrote.
+func TestGrammarCoverageAccumulates(t *testing.T) {
+	dir := t.TempDir()
+	grammarFile := filepath.Join(dir, "g.abnf")
+	src := ":startRule(S) ;\nS = { Item } ;\nItem = \"a\" | \"b\" [ \"!\" ] | \"c\" ;\n"
+	if err := os.WriteFile(grammarFile, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	eng := NewEngine()
+	eng.CoverageOutPath = filepath.Join(dir, "cov.jsonl")
+
+	// Each run is a session of its own, like each mec process is; it writes
+	// the file when it closes.
+	run := func(prog string) {
+		s := eng.NewSession(nil, nil)
+		defer s.Close()
+		asg, err := s.Parse(AbnfAgrammar, src, grammarFile, &Parseropts{PreventDefaultOutput: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := s.Compile(asg, AbnfAgrammar, grammarFile, 0, false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Parse(g, prog, "prog", &Parseropts{PreventDefaultOutput: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hits := func() map[string]int {
+		pts, err := readCoverage(eng.CoverageOutPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := map[string]int{}
+		for _, p := range pts {
+			if p.File != grammarFile {
+				t.Fatalf("point attributed to %q, want %q", p.File, grammarFile)
+			}
+			m[p.Prod+" "+p.Kind+" "+p.Path] = p.Hits
+		}
+		return m
+	}
+
+	run("a b a")
+	got := hits()
+	for k, want := range map[string]int{
+		"S production ":         1,
+		"Item production ":      3,
+		"Item alternative 0|0":  2,
+		"Item alternative 0|1":  1,
+		"Item alternative 0|2":  0,
+		"Item optional 0|1.0.1": 0,
+	} {
+		if n, ok := got[k]; !ok || n != want {
+			t.Fatalf("after run 1: %q = %d (present %v), want %d; all: %v", k, n, ok, want, got)
+		}
+	}
+
+	// The second run takes the option and the third alternative; the counts of
+	// the first run must still be there.
+	run("b! c")
+	got = hits()
+	for k, want := range map[string]int{
+		"Item alternative 0|0":  2,
+		"Item alternative 0|1":  2,
+		"Item alternative 0|2":  1,
+		"Item optional 0|1.0.1": 1,
+	} {
+		if got[k] != want {
+			t.Fatalf("after run 2: %q = %d, want %d; all: %v", k, got[k], want, got)
+		}
+	}
+
+	var out strings.Builder
+	if err := RenderCoverage(false, eng.CoverageOutPath, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "uncovered") {
+		t.Fatalf("everything was covered, but the report says otherwise:\n%s", out.String())
+	}
+}
+
+// TestGrammarCoverageForks parses with forks of one session at once, as -batch
+// does: their counts add up in the one file the session writes when it closes,
+// and nothing is written before that.
+func TestGrammarCoverageForks(t *testing.T) {
+	dir := t.TempDir()
+	grammarFile := filepath.Join(dir, "g.abnf")
+	src := ":startRule(S) ;\nS = { Item } ;\nItem = \"a\" | \"b\" ;\n"
+	eng := NewEngine()
+	eng.CoverageOutPath = filepath.Join(dir, "cov.jsonl")
+	s := eng.NewSession(nil, nil)
+	g, err := s.CompileGrammar(src, grammarFile, 0, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AssembleIncludes(g, grammarFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	const forks = 8
+	var wg sync.WaitGroup
+	for i := 0; i < forks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f := s.Fork(nil, nil)
+			for j := 0; j < 10; j++ {
+				if _, err := f.Parse(g, "a b a", "prog", &Parseropts{PreventDefaultOutput: true}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := os.Stat(eng.CoverageOutPath); !os.IsNotExist(err) {
+		t.Fatalf("the file is written before the session closes: %v", err)
+	}
+	s.Close()
+	s.Close() // A second close writes the same counts, not twice them.
+	pts, err := readCoverage(eng.CoverageOutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, p := range pts {
+		got[p.Prod+" "+p.Kind+" "+p.Path] = p.Hits
+	}
+	for k, want := range map[string]int{
+		"S production ":        forks * 10,
+		"Item production ":     forks * 30,
+		"Item alternative 0|0": forks * 20,
+		"Item alternative 0|1": forks * 10,
+	} {
+		if got[k] != want {
+			t.Errorf("%q = %d, want %d; all: %v", k, got[k], want, got)
+		}
+	}
+}
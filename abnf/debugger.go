@@ -0,0 +1,864 @@
+package abnf
+
+// The -debug debugger: breakpoints and stepping in the compile walk.
+//
+// Debugging a tag used to mean println() in its code and reading the -vv trace.
+// A Debugger stops the walk of compiler.go at the Tag nodes of the ASG instead,
+// at two events per node:
+//
+//	enter   the walk arrives at the node, before its childs are compiled
+//	tag     the childs are done and the tag's code is about to run: up, the
+//	        local and global stacks and the matched text are what it will see
+//
+// The nodes the walk is inside of are the PATH: the enclosing tags from the root
+// of the ASG down to the stop, outermost first (a c.compile() a tag starts, and
+// a compile a tag starts on another grammar, continue it). Stepping moves along
+// the walk in the order it runs, which is bottom-up for the code:
+//
+//	step    stop at the next event
+//	next    stop at the next event on this level of the path or above: from an
+//	        enter, the tag of the same node (its childs run through); from a tag,
+//	        the next sibling or the parent
+//	out     stop at the next event above: the tag of the parent
+//
+// A breakpoint stops the tag event of every node it matches:
+//
+//	Expr          the tags of production Expr
+//	calc.abnf:12  the tags whose code spans line 12 of the grammar file, or
+//	prog.txt:3    the nodes whose match ends on line 3 of the program file
+//	prog.txt:3:7  ... at column 7
+//	@3, @3:7      the same in any program file
+//
+// A file matches by its path or by a tail of it (calc.abnf finds
+// languages/calc.abnf). Production names and grammar lines come from the
+// :origin() stamps of the a-grammar, like in coverage.go, and the grammar files
+// themselves; the program positions from the ASG (a Tag's Pos is the end of its
+// match) and the source the session parsed.
+//
+// The debugger does not know how to talk to a person: at every stop it hands a
+// DebugStop to its Stopped function and goes on as that answers. DebugLines is
+// the line protocol of ./mec -debug; main's debug.go serves the same stops to
+// an editor over the Debug Adapter Protocol. Both engines work the same way,
+// because everything goes through the scriptEngine interface: the stop shows
+// Ltr() and the up map the engine gets, and DebugStop.Eval runs code with
+// RunTagCode in the scope of the tag.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"14.gy/mec/abnf/r"
+)
+
+// DebugAction is how the walk goes on after a stop.
+type DebugAction int
+
+const (
+	DebugContinue DebugAction = iota // Run to the next breakpoint.
+	DebugStepIn                      // Stop at the next event.
+	DebugStepOver                    // Stop at the next event on this level of the path or above.
+	DebugStepOut                     // Stop at the next event above this level.
+	DebugQuit                        // End the run (exit status 1).
+)
+
+// DebugBreaks is what the two debuggers share: the breakpoints, the stop at the
+// start, and the end of the run. Break, Delete and Breakpoints may be called
+// from any goroutine.
+type DebugBreaks struct {
+	// StopOnEntry stops at the first event of the run, breakpoints or not.
+	StopOnEntry bool
+	// Ended, if set, is told once when the run ends, with the exit status:
+	// Finish calls it, and an exit() of a script or program does.
+	Ended func(code int)
+
+	mu     sync.Mutex
+	breaks []*Breakpoint
+	lastID int
+	ended  bool
+}
+
+// Debugger is the breakpoints and the stepping state of a debugged run. Set it
+// as Engine.Debugger. Only one walk may run under it at a time (no -batch).
+type Debugger struct {
+	DebugBreaks
+	// Stopped is told of every stop and answers how the walk goes on. It runs on
+	// the goroutine of the walk, which waits for it.
+	Stopped func(st *DebugStop) DebugAction
+
+	sources map[string]string // The program texts the session parsed, by file.
+	files   map[string]*debugFile
+
+	frames    []DebugFrame // The path, across nested walks.
+	started   bool
+	step      DebugAction
+	stepDepth int
+}
+
+// NewDebugger returns a debugger that asks stopped at every stop.
+func NewDebugger(stopped func(st *DebugStop) DebugAction) *Debugger {
+	return &Debugger{Stopped: stopped, sources: map[string]string{}, files: map[string]*debugFile{}}
+}
+
+// Breakpoint is one breakpoint: a production, a line of a file, or a program
+// position in any file (File empty). Hits counts its stops.
+type Breakpoint struct {
+	ID         int
+	Spec       string
+	Production string
+	File       string
+	Line, Col  int
+	Hits       int
+}
+
+// ParseBreakpoint reads a breakpoint spec: NAME, FILE:LINE, FILE:LINE:COL,
+// @LINE or @LINE:COL (see the top of this file).
+func ParseBreakpoint(spec string) (*Breakpoint, error) {
+	bp := &Breakpoint{Spec: spec}
+	bad := fmt.Errorf("bad breakpoint %q: want a production, FILE:LINE[:COL] or @LINE[:COL]", spec)
+	if spec == "" {
+		return nil, bad
+	}
+	if spec[0] == '@' {
+		if !bp.position(spec[1:]) {
+			return nil, bad
+		}
+		return bp, nil
+	}
+	if strings.IndexByte(spec, ':') > 0 {
+		// The position is the last one or two numbers, the file the rest (a
+		// Windows drive letter has no number behind its colon).
+		parts := strings.Split(spec, ":")
+		n := 0
+		for n < 2 && n < len(parts)-1 {
+			if _, err := strconv.Atoi(parts[len(parts)-1-n]); err != nil {
+				break
+			}
+			n++
+		}
+		if n == 0 || !bp.position(strings.Join(parts[len(parts)-n:], ":")) {
+			return nil, bad
+		}
+		bp.File = filepath.Clean(strings.Join(parts[:len(parts)-n], ":"))
+		return bp, nil
+	}
+	for i, ch := range spec {
+		if !(isLetter(byte(ch)) || ch == '_' || i > 0 && ch >= '0' && ch <= '9') {
+			return nil, bad
+		}
+	}
+	bp.Production = spec
+	return bp, nil
+}
+
+// position reads LINE or LINE:COL into bp.
+func (bp *Breakpoint) position(s string) bool {
+	line, col := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		line, col = s[:i], s[i+1:]
+	}
+	var err error
+	if bp.Line, err = strconv.Atoi(line); err != nil || bp.Line < 1 {
+		return false
+	}
+	if col != "" {
+		if bp.Col, err = strconv.Atoi(col); err != nil || bp.Col < 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Break sets the breakpoint spec and returns it.
+func (d *DebugBreaks) Break(spec string) (*Breakpoint, error) {
+	bp, err := ParseBreakpoint(spec)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastID++
+	bp.ID = d.lastID
+	d.breaks = append(d.breaks, bp)
+	return bp, nil
+}
+
+// Delete removes the breakpoint with the given ID; 0 removes all of them. It
+// reports whether there was one.
+func (d *DebugBreaks) Delete(id int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	kept := d.breaks[:0]
+	found := false
+	for _, bp := range d.breaks {
+		if id == 0 || bp.ID == id {
+			found = true
+			continue
+		}
+		kept = append(kept, bp)
+	}
+	d.breaks = kept
+	return found
+}
+
+// Breakpoints returns copies of the breakpoints, in the order they were set.
+func (d *DebugBreaks) Breakpoints() []Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := make([]Breakpoint, len(d.breaks))
+	for i, bp := range d.breaks {
+		res[i] = *bp
+	}
+	return res
+}
+
+// Finish tells Ended that the run is over, once.
+func (d *DebugBreaks) Finish(code int) {
+	d.mu.Lock()
+	done := d.ended
+	d.ended = true
+	d.mu.Unlock()
+	if !done && d.Ended != nil {
+		d.Ended(code)
+	}
+}
+
+// matches reports whether the breakpoint stops at the tag of fr.
+func (bp *Breakpoint) matches(fr *DebugFrame) bool {
+	if bp.Production != "" {
+		return fr.Production == bp.Production
+	}
+	atInput := fr.Line == bp.Line && (bp.Col == 0 || fr.Col == bp.Col)
+	if bp.File == "" {
+		return atInput
+	}
+	if fr.GrammarLine > 0 && bp.Line >= fr.GrammarLine && bp.Line <= fr.GrammarEndLine && sameDebugFile(bp.File, fr.GrammarFile) {
+		return true
+	}
+	return atInput && sameDebugFile(bp.File, fr.File)
+}
+
+// sameDebugFile reports whether the file a breakpoint names is file: the same
+// path, the same absolute path, or a tail of it.
+func sameDebugFile(spec, file string) bool {
+	if file == "" {
+		return false
+	}
+	file = filepath.Clean(file)
+	if spec == file || strings.HasSuffix(filepath.ToSlash(file), "/"+filepath.ToSlash(spec)) {
+		return true
+	}
+	a, err1 := filepath.Abs(spec)
+	b, err2 := filepath.Abs(file)
+	return err1 == nil && err2 == nil && a == b
+}
+
+// source remembers the text of a parsed file, for the positions of the walk
+// that compiles its ASG.
+func (d *Debugger) source(file, text string) {
+	d.mu.Lock()
+	d.sources[filepath.Clean(file)] = text
+	d.mu.Unlock()
+}
+
+// ----------------------------------------------------------------------------
+// The stops
+
+// DebugFrame is one Tag node of the path.
+type DebugFrame struct {
+	Production     string // The production the tag is written in ("" when the a-grammar has no :origin()).
+	GrammarFile    string
+	GrammarLine    int // The lines of the tag in the grammar file (0 when unknown).
+	GrammarEndLine int
+	File           string // The program file the walk compiles.
+	Line, Col      int    // Where the node's match ends in it (0 when unknown).
+	Code           string // The tag's code for the slot the walk runs.
+}
+
+// DebugStop is the walk standing at one event. Up and the stacks are the live
+// values the tag's code will see and change; a front end only reads them.
+type DebugStop struct {
+	Debugger   *Debugger
+	Reason     string      // "entry", "step" or "breakpoint".
+	Breakpoint *Breakpoint // The breakpoint that stopped the walk (Reason "breakpoint").
+	Event      string      // "enter" or "tag".
+	Path       []DebugFrame
+	Text       string              // The matched text: up.in, or the node's tokens at an enter.
+	Up         map[string]r.Object // The tag's up (nil at an enter: the childs have not run).
+	Ltr        map[string]r.Object
+	Local      []interface{} // up.stack.
+	Global     []r.Object    // The global stack (ltr.stack).
+	SourceLine string        // The line of the program the match ends on.
+
+	eval func(code string) (r.Object, error)
+}
+
+// Frame is the node the walk stands at: the last of the path.
+func (st *DebugStop) Frame() *DebugFrame {
+	return &st.Path[len(st.Path)-1]
+}
+
+// Eval runs code as a tag of the node would run: with its up, ltr and stacks,
+// so push(), pop() and assignments change them. It returns the completion value.
+func (st *DebugStop) Eval(code string) (r.Object, error) {
+	if st.eval == nil {
+		return nil, fmt.Errorf("there is no up before the childs ran; step to the tag first")
+	}
+	return st.eval(code)
+}
+
+// Where is the stop in one line: why, the tag, and the input it matched.
+func (st *DebugStop) Where() string {
+	fr := st.Frame()
+	why := st.Reason
+	if st.Breakpoint != nil {
+		why = "breakpoint " + strconv.Itoa(st.Breakpoint.ID)
+	}
+	what := "tag of"
+	if st.Event == "enter" {
+		what = "entering"
+	}
+	name := fr.Production
+	if name == "" {
+		name = "(a tag)"
+	}
+	res := fmt.Sprintf("stopped (%s): %s %s", why, what, name)
+	if fr.GrammarLine > 0 {
+		res += " at " + fr.GrammarFile + ":" + strconv.Itoa(fr.GrammarLine)
+	}
+	if fr.Line > 0 {
+		res += fmt.Sprintf(", input %s:%d:%d", fr.File, fr.Line, fr.Col)
+	}
+	return res + " " + strconv.Quote(clip(st.Text, 60))
+}
+
+// debugFile is a grammar file's text, read on demand for the lines of its tags.
+type debugFile struct {
+	text   string
+	starts []int
+}
+
+func (d *Debugger) grammarFile(name string) *debugFile {
+	if f := d.files[name]; f != nil {
+		return f
+	}
+	f := &debugFile{}
+	if dat, err := os.ReadFile(name); err == nil {
+		f.text = StripBOM(string(dat))
+		f.starts = lineStarts(f.text)
+	}
+	d.files[name] = f
+	return f
+}
+
+func lineStarts(text string) []int {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// lineColIn converts a byte offset into a 1-based line and column.
+func lineColIn(pos int, starts []int) (int, int) {
+	line := sort.Search(len(starts), func(i int) bool { return starts[i] > pos })
+	if line == 0 {
+		return 0, 0
+	}
+	return line, pos - starts[line-1] + 1
+}
+
+// ----------------------------------------------------------------------------
+// The walk
+
+// debugTag is where a tag of the a-grammar is written.
+type debugTag struct {
+	prod          string
+	file          string
+	line, endLine int
+}
+
+// debugWalk is one compile walk under the debugger (compiler.debug).
+type debugWalk struct {
+	d      *Debugger
+	co     *compiler
+	src    string
+	starts []int
+	tags   map[*r.Rules]debugTag // By the CodeChilds a grammar tag shares with its ASG nodes.
+	mark   int                   // The length of the path when the walk started.
+}
+
+// walk starts debugging the walk of co, which compiles with aGrammar.
+func (d *Debugger) walk(co *compiler, aGrammar *r.Rules) *debugWalk {
+	d.mu.Lock()
+	src := d.sources[co.fileName]
+	d.mu.Unlock()
+	w := &debugWalk{d: d, co: co, src: src, starts: lineStarts(src), tags: map[*r.Rules]debugTag{}, mark: len(d.frames)}
+	file := ""
+	for i := len(*aGrammar) - 1; i >= 0; i-- {
+		rule := (*aGrammar)[i]
+		if rule.Operator == r.Command && rule.String == "origin" && rule.CodeChilds != nil && len(*rule.CodeChilds) > 0 {
+			file = (*rule.CodeChilds)[0].String
+			continue
+		}
+		if rule.Operator == r.Production && file != "" {
+			w.addTags(d.grammarFile(file), file, rule.String, rule.Childs)
+		}
+	}
+	return w
+}
+
+// addTags records the tags of one production body.
+func (w *debugWalk) addTags(f *debugFile, file, prod string, rules *r.Rules) {
+	if rules == nil {
+		return
+	}
+	for _, rule := range *rules {
+		if rule.Operator == r.Tag && rule.CodeChilds != nil {
+			t := debugTag{prod: prod, file: file}
+			if f.text != "" && rule.Pos > 0 && rule.Pos <= len(f.text) {
+				// The Pos of a tag is behind its '>'; its '<' is the last one in
+				// front of its first code, whose Pos is behind the code.
+				t.endLine, _ = lineColIn(rule.Pos-1, f.starts)
+				t.line = t.endLine
+				if len(*rule.CodeChilds) > 0 {
+					code := (*rule.CodeChilds)[0]
+					if end := code.Pos - len(code.String); end > 0 && end <= rule.Pos {
+						if lt := strings.LastIndexByte(f.text[:end], '<'); lt >= 0 {
+							t.line, _ = lineColIn(lt, f.starts)
+						}
+					}
+				}
+			}
+			w.tags[rule.CodeChilds] = t
+		}
+		w.addTags(f, file, prod, rule.Childs)
+	}
+}
+
+// end drops what a walk that failed left on the path.
+func (w *debugWalk) end() {
+	w.d.frames = w.d.frames[:w.mark]
+}
+
+// enter is the walk arriving at a Tag node. It puts the node on the path and
+// reports whether it did: a tag without code for the slot runs nothing, so the
+// debugger passes it by.
+func (w *debugWalk) enter(rule *r.Rule, slot int) bool {
+	if rule.CodeChilds == nil || slot >= len(*rule.CodeChilds) {
+		return false
+	}
+	t := w.tags[rule.CodeChilds]
+	fr := DebugFrame{Production: t.prod, GrammarFile: t.file, GrammarLine: t.line, GrammarEndLine: t.endLine, File: w.co.fileName, Code: (*rule.CodeChilds)[slot].String}
+	if w.src != "" && rule.Pos <= len(w.src) {
+		pos := rule.Pos - 1
+		if pos < 0 {
+			pos = 0
+		}
+		fr.Line, fr.Col = lineColIn(pos, w.starts)
+	}
+	w.d.frames = append(w.d.frames, fr)
+	w.event(&DebugStop{Event: "enter", Text: tokenText(rule)})
+	return true
+}
+
+// tag is the walk about to run the code of the node it entered last.
+func (w *debugWalk) tag(up map[string]r.Object, localASG *r.Rules, slot, depth int) {
+	st := &DebugStop{Event: "tag", Up: up, Ltr: w.co.eng.Ltr()}
+	// The stacks are read again after an Eval, which may have pushed.
+	read := func() {
+		st.Text, _ = up["in"].(string)
+		st.Local, _ = up["stack"].([]interface{})
+		if g, ok := st.Ltr["stack"].(*[]r.Object); ok {
+			st.Global = *g
+		}
+	}
+	read()
+	st.eval = func(code string) (v r.Object, err error) {
+		defer func() {
+			read()
+			if p := recover(); p != nil {
+				if _, ok := p.(*ExitError); ok {
+					panic(p)
+				}
+				v, err = nil, recoveredError(p)
+			}
+		}()
+		codes := make(r.Rules, slot+1)
+		for i := range codes {
+			codes[i] = &r.Rule{Operator: r.Token}
+		}
+		codes[slot].String = code
+		v, _ = w.co.eng.RunTagCode(&r.Rule{Operator: r.Tag, CodeChilds: &codes}, fileScript("(debug)"), up, localASG, slot, depth)
+		return v, nil
+	}
+	w.event(st)
+}
+
+// leave takes the node off the path after its code ran.
+func (w *debugWalk) leave() {
+	w.d.frames = w.d.frames[:len(w.d.frames)-1]
+}
+
+// event decides whether the walk stops, and stops it.
+func (w *debugWalk) event(st *DebugStop) {
+	d := w.d
+	depth := len(d.frames)
+	fr := &d.frames[depth-1]
+	if st.Event == "tag" {
+		d.mu.Lock()
+		for _, bp := range d.breaks {
+			if bp.matches(fr) {
+				bp.Hits++
+				cp := *bp
+				st.Reason, st.Breakpoint = "breakpoint", &cp
+				break
+			}
+		}
+		d.mu.Unlock()
+	}
+	if st.Reason == "" {
+		switch {
+		case !d.started && d.StopOnEntry:
+			st.Reason = "entry"
+		case d.step == DebugStepIn,
+			d.step == DebugStepOver && depth <= d.stepDepth,
+			d.step == DebugStepOut && depth < d.stepDepth:
+			st.Reason = "step"
+		}
+	}
+	d.started = true
+	if st.Reason == "" || d.Stopped == nil {
+		return
+	}
+	st.Debugger = d
+	st.Path = append([]DebugFrame{}, d.frames...)
+	if fr.Line > 0 && fr.Line <= len(w.starts) {
+		end := len(w.src)
+		if fr.Line < len(w.starts) {
+			end = w.starts[fr.Line] - 1
+		}
+		st.SourceLine = strings.TrimRight(w.src[w.starts[fr.Line-1]:end], "\r")
+	}
+	action := d.Stopped(st)
+	if action == DebugQuit {
+		w.co.sess.exit(1)
+	}
+	d.step, d.stepDepth = action, depth
+}
+
+// tokenText is the text of the tokens under rule, what up.in of its tag will be.
+func tokenText(rule *r.Rule) string {
+	var b strings.Builder
+	var walk func(*r.Rule)
+	walk = func(rule *r.Rule) {
+		if rule.Operator == r.Token {
+			b.WriteString(rule.String)
+			return
+		}
+		if rule.Childs != nil {
+			for _, c := range *rule.Childs {
+				walk(c)
+			}
+		}
+	}
+	walk(rule)
+	return b.String()
+}
+
+// ----------------------------------------------------------------------------
+// Values
+
+// DebugValue renders a value of the walk for a person: strings quoted, arrays
+// and objects of both engines spelled out a few levels deep, rules as the
+// trace prints them.
+func DebugValue(v r.Object) string {
+	return clip(debugValue(v, 3), 300)
+}
+
+func debugValue(v r.Object, depth int) string {
+	names, vals, list := debugFields(v)
+	if names == nil {
+		switch t := v.(type) {
+		case nil:
+			return "undefined"
+		case string:
+			return strconv.Quote(t)
+		case *string:
+			return strconv.Quote(*t)
+		case *ltrText:
+			return strconv.Quote(t.String())
+		case *r.Rule:
+			return t.ToString()
+		case map[string]r.Object, *jsObject:
+			return "{}"
+		case fmt.Stringer:
+			return t.String()
+		}
+		if list {
+			return "[]"
+		}
+		return fmt.Sprintf("%v", v)
+	}
+	if depth == 0 {
+		if list {
+			return "[…]"
+		}
+		return "{…}"
+	}
+	parts := make([]string, len(vals))
+	for i, e := range vals {
+		parts[i] = debugValue(e, depth-1)
+		if !list {
+			parts[i] = names[i] + ": " + parts[i]
+		}
+	}
+	if list {
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// DebugFields returns the members of a value that has any - the elements of an
+// array, the properties of an object - for a front end that unfolds it.
+func DebugFields(v r.Object) (names []string, values []r.Object) {
+	names, values, _ = debugFields(v)
+	return names, values
+}
+
+// debugFields returns the members of v, and whether v is a list (an empty one
+// has no members).
+func debugFields(v r.Object) ([]string, []r.Object, bool) {
+	var elems []interface{}
+	switch t := v.(type) {
+	case []interface{}:
+		elems = t
+	case *[]r.Object:
+		elems = *t
+	case *jsArray:
+		elems = t.elems
+	case map[string]r.Object:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		vals := make([]r.Object, len(keys))
+		for i, k := range keys {
+			vals[i] = t[k]
+		}
+		if len(keys) == 0 {
+			return nil, nil, false
+		}
+		return keys, vals, false
+	case *jsObject:
+		if len(t.keys) == 0 {
+			return nil, nil, false
+		}
+		vals := make([]r.Object, len(t.keys))
+		for i, k := range t.keys {
+			vals[i] = t.props[k]
+		}
+		return append([]string{}, t.keys...), vals, false
+	default:
+		return nil, nil, false
+	}
+	if len(elems) == 0 {
+		return nil, nil, true
+	}
+	names := make([]string, len(elems))
+	for i := range elems {
+		names[i] = strconv.Itoa(i)
+	}
+	return names, elems, true
+}
+
+// ----------------------------------------------------------------------------
+// The line protocol
+
+const debugHelp = `commands:
+  c, continue      run to the next breakpoint
+  s, step          stop at the next event
+  n, next          stop at the next event on this level or above (skip the childs)
+  o, out           stop at the tag of the parent
+  b, break SPEC    set a breakpoint: PRODUCTION, FILE:LINE[:COL] or @LINE[:COL]
+  d, delete [ID]   delete a breakpoint (all of them without an ID)
+  i, breaks        list the breakpoints
+  w, where         where the walk stands, with the input line
+  bt, path         the path: the enclosing tags, outermost first
+  up               the tag's up
+  ltr              the global variables
+  stack            the local stack (up.stack)
+  gstack           the global stack (ltr.stack)
+  text             the matched text
+  code             the tag's code
+  p, eval CODE     run CODE in the tag's scope and print its value
+  q, quit          end the run
+An empty line repeats c, s, n and o.
+`
+
+// DebugLines returns the line protocol of ./mec -debug: at every stop it writes
+// where the walk stands to out and reads commands from in until one moves on.
+// At the end of in the run continues without stopping.
+func DebugLines(in io.Reader, out io.Writer) func(st *DebugStop) DebugAction {
+	p := &debugPrompt{br: bufio.NewReader(in), out: out, help: debugHelp}
+	return func(st *DebugStop) DebugAction {
+		return p.run(&st.Debugger.DebugBreaks, st.Where(), func(cmd, arg string) bool {
+			fr := st.Frame()
+			switch cmd {
+			case "w", "where":
+				fmt.Fprintln(out, st.Where())
+				if st.SourceLine != "" {
+					fmt.Fprintf(out, "  %s\n  %s^\n", st.SourceLine, strings.Repeat(" ", fr.Col-1))
+				}
+			case "bt", "path":
+				for i, f := range st.Path {
+					fmt.Fprintf(out, "%2d  %s", i, f.Production)
+					if f.GrammarLine > 0 {
+						fmt.Fprintf(out, " at %s:%d", f.GrammarFile, f.GrammarLine)
+					}
+					if f.Line > 0 {
+						fmt.Fprintf(out, ", input %s:%d:%d", f.File, f.Line, f.Col)
+					}
+					fmt.Fprintln(out)
+				}
+			case "up":
+				if st.Up == nil {
+					fmt.Fprintln(out, "(none before the childs ran)")
+					break
+				}
+				debugPrintFields(out, st.Up)
+			case "ltr":
+				debugPrintFields(out, st.Ltr)
+			case "stack":
+				debugPrintFields(out, st.Local)
+			case "gstack":
+				debugPrintFields(out, st.Global)
+			case "text":
+				fmt.Fprintln(out, strconv.Quote(st.Text))
+			case "code":
+				fmt.Fprintln(out, strings.TrimSpace(fr.Code))
+			case "p", "eval":
+				v, err := st.Eval(arg)
+				if err != nil {
+					fmt.Fprintln(out, err)
+				} else {
+					fmt.Fprintln(out, DebugValue(v))
+				}
+			default:
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// debugPrompt reads the commands of a line protocol. It does the commands both
+// debuggers have - moving on and the breakpoints - and hands the others to the
+// debugger's own.
+type debugPrompt struct {
+	br   *bufio.Reader
+	out  io.Writer
+	help string
+	eof  bool
+	last string // The last c, s, n or o, which an empty line repeats.
+}
+
+// run writes where and reads commands until one moves on. other does a command
+// of the debugger and reports whether it knew it.
+func (p *debugPrompt) run(b *DebugBreaks, where string, other func(cmd, arg string) bool) DebugAction {
+	if p.eof {
+		return DebugContinue
+	}
+	out := p.out
+	fmt.Fprintln(out, where)
+	for {
+		fmt.Fprint(out, "(debug) ")
+		line, err := p.br.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(out)
+			p.eof = true
+			return DebugContinue
+		}
+		cmd, arg := strings.TrimSpace(line), ""
+		if i := strings.IndexAny(cmd, " \t"); i >= 0 {
+			cmd, arg = cmd[:i], strings.TrimSpace(cmd[i+1:])
+		}
+		if cmd == "" {
+			cmd = p.last
+		}
+		switch cmd {
+		case "c", "continue", "s", "step", "n", "next", "o", "out":
+			p.last = cmd
+		}
+		switch cmd {
+		case "":
+		case "c", "continue":
+			return DebugContinue
+		case "s", "step":
+			return DebugStepIn
+		case "n", "next":
+			return DebugStepOver
+		case "o", "out":
+			return DebugStepOut
+		case "q", "quit":
+			return DebugQuit
+		case "b", "break":
+			if bp, err := b.Break(arg); err != nil {
+				fmt.Fprintln(out, err)
+			} else {
+				fmt.Fprintf(out, "breakpoint %d: %s\n", bp.ID, bp.Spec)
+			}
+		case "d", "delete":
+			id := 0
+			if arg != "" {
+				id, _ = strconv.Atoi(arg)
+				if id <= 0 {
+					fmt.Fprintf(out, "no breakpoint %q\n", arg)
+					continue
+				}
+			}
+			if !b.Delete(id) {
+				fmt.Fprintf(out, "no breakpoint %s\n", arg)
+			}
+		case "i", "breaks":
+			bps := b.Breakpoints()
+			if len(bps) == 0 {
+				fmt.Fprintln(out, "no breakpoints")
+			}
+			for _, bp := range bps {
+				fmt.Fprintf(out, "%d: %s (%d hits)\n", bp.ID, bp.Spec, bp.Hits)
+			}
+		case "h", "help":
+			fmt.Fprint(out, p.help)
+		default:
+			if !other(cmd, arg) {
+				fmt.Fprintf(out, "unknown command %q (help lists them)\n", cmd)
+			}
+		}
+	}
+}
+
+// debugPrintFields prints the members of v, one per line.
+func debugPrintFields(out io.Writer, v r.Object) {
+	names, vals := DebugFields(v)
+	if names == nil {
+		if v == nil {
+			fmt.Fprintln(out, "(none)")
+		} else {
+			fmt.Fprintln(out, DebugValue(v))
+		}
+		return
+	}
+	for i, n := range names {
+		fmt.Fprintf(out, "  %s: %s\n", n, DebugValue(vals[i]))
+	}
+}
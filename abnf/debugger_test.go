@@ -0,0 +1,93 @@
+package abnf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDebugger drives the line protocol through a small grammar on both
+// engines: the breakpoints of all three kinds stop where they should, stepping
+// follows the walk, and code run at a stop changes what the tag then sees.
+func TestDebugger(t *testing.T) {
+	dir := t.TempDir()
+	grammarFile := filepath.Join(dir, "sum.abnf")
+	src := `:startRule(Sum) ;
+:whitespace(Ws) ;
+Sum    <~~ let b = pop(); let a = pop()
+           pushg(a + "," + b) ~~>
+       = Num "+" Num ;
+Num    = @+"0123456789" <~~ push(up.in) ~~> ;
+Ws     = { @" \n" } ;
+:startScript(~~ c.compile(c.asg); println(popg()) ~~) ;
+`
+	if err := os.WriteFile(grammarFile, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmds := strings.Join([]string{
+		"up",        // First Num, by its production.
+		"d 3",       // No more stops at Num,
+		"c",         // so the next one is the second Num, by its input position.
+		"text",      //
+		"p push(7)", // The second Num now leaves two values,
+		"s",         // it runs, and the next event is the tag of Sum, by its grammar line.
+		"stack",     //
+		"bt",        //
+		"c",
+	}, "\n") + "\n"
+	want := `stopped (breakpoint 3): tag of Num at sum.abnf:6, input prog.txt:1:1 "1"
+  in: "1"
+  pos: 1
+  stack: []
+stopped (breakpoint 2): tag of Num at sum.abnf:6, input prog.txt:2:3 "22"
+"22"
+undefined
+stopped (breakpoint 1): tag of Sum at sum.abnf:3, input prog.txt:2:3 "1+22"
+  0: "1"
+  1: 7
+  2: "22"
+ 0  Sum at sum.abnf:3, input prog.txt:2:3
+`
+	for _, frozen := range []bool{false, true} {
+		eng := NewEngine()
+		eng.Frozen = frozen
+		var log, out strings.Builder
+		eng.Debugger = NewDebugger(DebugLines(strings.NewReader(cmds), &log))
+		for _, b := range []string{"sum.abnf:4", "@2:3", "Num"} {
+			if _, err := eng.Debugger.Break(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s := eng.NewSession(&out, &log)
+		g, err := s.CompileGrammar(src, grammarFile, 0, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		asg, err := s.Parse(g, "1 +\n 22", "prog.txt", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Compile(asg, g, "prog.txt", 0, false, false); err != nil {
+			t.Fatal(err)
+		}
+		got := strings.ReplaceAll(strings.ReplaceAll(log.String(), "(debug) ", ""), grammarFile, "sum.abnf")
+		if got != want {
+			t.Errorf("frozen=%v: the session went\n%s\nwant\n%s", frozen, got, want)
+		}
+		if out.String() != "7,22\n" {
+			t.Errorf("frozen=%v: the program printed %q, want the pushed 7 in front of 22", frozen, out.String())
+		}
+	}
+
+	for _, spec := range []string{"Expr", "g.abnf:12", `C:\g.abnf:3:4`, "@7", "@7:2"} {
+		if _, err := ParseBreakpoint(spec); err != nil {
+			t.Errorf("%s: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "@", "g.abnf:x", "1Expr", "@0"} {
+		if _, err := ParseBreakpoint(spec); err == nil {
+			t.Errorf("%q is taken as a breakpoint", spec)
+		}
+	}
+}
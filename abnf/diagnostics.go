@@ -0,0 +1,377 @@
+package abnf
+
+// Structured diagnostics (-diagnostics json|sarif): one reporter for everything
+// a run has to say about its sources.
+//
+// Without the flag every finding is a line of text on stderr, and each kind has
+// its own wording: a parse that stopped early, a -verify issue, a -warn-imports
+// or -warn-unsupported warning, a compile or runtime failure. With it they all
+// become a Diagnostic - severity, code, message, file, line, column, end and
+// related locations - and go to a DiagnosticReporter instead, which writes
+//
+//	json   one JSON object per line, as each diagnostic is reported, and
+//	sarif  a SARIF 2.1.0 log of all of them when the reporter is closed (the
+//	       format GitHub code scanning and most CI annotators read).
+//
+// The producers convert themselves: VerifyIssue.Diagnostic, Session.ReportError
+// for the error of a Parse or Compile (the *ParseError of a parse carries its
+// position, a jsProgramPanic is a runtime error), and c.report for the scripts -
+// lib/compile-core.js and lib/interp-core.js route their import and
+// not-implemented findings through it. A c.report without a reporter answers
+// false and the script prints its text line as before, so nothing changes
+// without the flag.
+//
+// The codes are stable names a CI filter can match on:
+//
+//	parse-error        the text could not be parsed to the end
+//	compile-error      a tag script or the compile walk failed
+//	runtime-error      the compiled program aborted
+//	include-error      a grammar's :include() files could not be assembled
+//	unresolved-import  an import no grammar or include root resolves
+//	not-implemented    a construct that parsed but cannot be lowered
+//	undefined, badrange, dupfunc, unreachable   the -verify issue kinds
+//
+// Lines are 1-based. Columns are 1-based and count code points in everything
+// that has the source text at hand (parse errors); c.report knows only the line
+// starts of the program, so its columns count bytes - the same thing on ASCII.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DiagnosticLocation is a place in a source file. Zero fields are unknown (a
+// location without a line names only the file).
+type DiagnosticLocation struct {
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Message   string `json:"message,omitempty"` // What is at a related location.
+}
+
+// Diagnostic is one finding: an error, a warning or a note about a place in a
+// grammar or program source.
+type Diagnostic struct {
+	Severity string `json:"severity"` // "error", "warning" or "note".
+	Code     string `json:"code"`     // A stable name; see the list at the top of this file.
+	Message  string `json:"message"`
+	DiagnosticLocation
+	Related []DiagnosticLocation `json:"related,omitempty"`
+}
+
+// DiagnosticFormats are the formats NewDiagnosticReporter writes.
+var DiagnosticFormats = []string{"json", "sarif"}
+
+// DiagnosticReporter collects the diagnostics of a run and writes them in one
+// format. It is safe for concurrent use: the sessions of a -batch report into
+// the same one.
+type DiagnosticReporter struct {
+	format string
+	w      io.Writer
+	mu     sync.Mutex
+	diags  []Diagnostic // sarif: everything reported, written by Close.
+	errors int
+	closed bool
+}
+
+// NewDiagnosticReporter starts a reporter that writes format ("json" or
+// "sarif") to w.
+func NewDiagnosticReporter(format string, w io.Writer) (*DiagnosticReporter, error) {
+	switch format {
+	case "json", "sarif":
+		return &DiagnosticReporter{format: format, w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown diagnostics format %q (want %s)", format, strings.Join(DiagnosticFormats, " or "))
+}
+
+// Report adds a diagnostic. In json it is written at once; in sarif it waits
+// for Close. A report after Close is dropped.
+func (dr *DiagnosticReporter) Report(d Diagnostic) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if dr.closed {
+		return
+	}
+	if d.Severity == "error" {
+		dr.errors++
+	}
+	if dr.format == "json" {
+		line, _ := json.Marshal(d)
+		dr.w.Write(append(line, '\n'))
+		return
+	}
+	dr.diags = append(dr.diags, d)
+}
+
+// Errors is the number of error diagnostics reported so far.
+func (dr *DiagnosticReporter) Errors() int {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	return dr.errors
+}
+
+// Close ends the report: sarif writes its log now. Closing again does nothing,
+// so every way out of a run can close it.
+func (dr *DiagnosticReporter) Close() error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if dr.closed {
+		return nil
+	}
+	dr.closed = true
+	if dr.format != "sarif" {
+		return nil
+	}
+	data, err := json.MarshalIndent(sarifLog(dr.diags), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = dr.w.Write(append(data, '\n'))
+	return err
+}
+
+// ----------------------------------------------------------------------------
+// SARIF 2.1.0
+
+// sarifLog builds the log of diags: one run of the tool "mec", one rule per
+// code, the results in source order (the sessions of a -batch report in
+// whatever order their files finish).
+func sarifLog(diags []Diagnostic) map[string]interface{} {
+	sorted := append([]Diagnostic{}, diags...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	rules := []interface{}{}
+	ruleIndex := map[string]int{}
+	results := []interface{}{}
+	for _, d := range sorted {
+		idx, ok := ruleIndex[d.Code]
+		if !ok {
+			idx = len(rules)
+			ruleIndex[d.Code] = idx
+			rules = append(rules, map[string]interface{}{"id": d.Code})
+		}
+		res := map[string]interface{}{
+			"ruleId":    d.Code,
+			"ruleIndex": idx,
+			"level":     sarifLevel(d.Severity),
+			"message":   map[string]interface{}{"text": d.Message},
+		}
+		if loc := sarifLocation(d.DiagnosticLocation); loc != nil {
+			res["locations"] = []interface{}{loc}
+		}
+		var related []interface{}
+		for _, rl := range d.Related {
+			if loc := sarifLocation(rl); loc != nil {
+				loc["id"] = len(related)
+				if rl.Message != "" {
+					loc["message"] = map[string]interface{}{"text": rl.Message}
+				}
+				related = append(related, loc)
+			}
+		}
+		if related != nil {
+			res["relatedLocations"] = related
+		}
+		results = append(results, res)
+	}
+	run := map[string]interface{}{
+		"tool":       map[string]interface{}{"driver": map[string]interface{}{"name": "mec", "rules": rules}},
+		"columnKind": "unicodeCodePoints",
+		"results":    results,
+	}
+	// The relative file names are relative to the working directory of the run.
+	if wd, err := os.Getwd(); err == nil {
+		base := sarifFileURI(wd)
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		run["originalUriBaseIds"] = map[string]interface{}{sarifSrcRoot: map[string]interface{}{"uri": base}}
+	}
+	return map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs":    []interface{}{run},
+	}
+}
+
+// sarifSrcRoot is the uriBaseId of the relative file names.
+const sarifSrcRoot = "SRCROOT"
+
+// sarifFileURI is the file: URI of the absolute path p (a Windows path gets the
+// "/" in front of its drive letter that the URI needs).
+func sarifFileURI(p string) string {
+	p = filepath.ToSlash(p)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// sarifArtifact is the artifactLocation of file: an absolute file name as a
+// file: URI, a relative one as an escaped relative reference to SRCROOT.
+func sarifArtifact(file string) map[string]interface{} {
+	if filepath.IsAbs(file) {
+		return map[string]interface{}{"uri": sarifFileURI(file)}
+	}
+	ref := &url.URL{Path: filepath.ToSlash(file)}
+	return map[string]interface{}{"uri": ref.String(), "uriBaseId": sarifSrcRoot}
+}
+
+// sarifLevel maps a severity to a SARIF result level.
+func sarifLevel(severity string) string {
+	switch severity {
+	case "error", "warning", "note":
+		return severity
+	}
+	return "none"
+}
+
+// sarifLocation is the physicalLocation of l, or nil when l names no real file
+// (the "(code)" / "(stdin)" / "(piped)" inputs have no URI to point to).
+func sarifLocation(l DiagnosticLocation) map[string]interface{} {
+	if l.File == "" || strings.HasPrefix(l.File, "(") {
+		return nil
+	}
+	phys := map[string]interface{}{
+		"artifactLocation": sarifArtifact(l.File),
+	}
+	if l.Line > 0 {
+		region := map[string]interface{}{"startLine": l.Line}
+		if l.Column > 0 {
+			region["startColumn"] = l.Column
+		}
+		if l.EndLine > 0 {
+			region["endLine"] = l.EndLine
+		}
+		if l.EndColumn > 0 {
+			region["endColumn"] = l.EndColumn
+		}
+		phys["region"] = region
+	}
+	return map[string]interface{}{"physicalLocation": phys}
+}
+
+// ----------------------------------------------------------------------------
+// The producers
+
+// Diagnostic converts the issue into a diagnostic about the grammar file. A
+// dupfunc issue relates the first declaration.
+func (vi VerifyIssue) Diagnostic(file string) Diagnostic {
+	d := Diagnostic{Severity: "warning", Code: vi.Kind, Message: vi.Message(), DiagnosticLocation: DiagnosticLocation{File: file, Line: vi.Line}}
+	if vi.IsError() {
+		d.Severity = "error"
+	}
+	if vi.Kind == "dupfunc" {
+		if first, err := strconv.Atoi(vi.Detail); err == nil {
+			d.Related = []DiagnosticLocation{{File: file, Line: first, Message: "first declaration of '" + vi.Name + "'"}}
+		}
+	}
+	return d
+}
+
+// ErrorDiagnostic converts the error of a Parse, Compile or CompileGrammar of
+// file into a diagnostic. A parse error has its exact position; a runtime abort
+// of the program, or a run the step limit stopped, names the file; any other
+// failure names the first file:line
+// of file its text mentions, if any (the grammars' messages carry one).
+func ErrorDiagnostic(err error, file string) Diagnostic {
+	switch e := err.(type) {
+	case *ParseError:
+		return Diagnostic{Severity: "error", Code: "parse-error", Message: "not everything could be parsed: the parse ends here",
+			DiagnosticLocation: DiagnosticLocation{File: e.file, Line: e.line, Column: e.column, EndLine: e.endLine, EndColumn: e.endColumn}}
+	case jsProgramPanic:
+		return Diagnostic{Severity: "error", Code: "runtime-error", Message: strings.TrimPrefix(e.msg, "js runtime error: "),
+			DiagnosticLocation: DiagnosticLocation{File: file}}
+	}
+	msg := err.Error()
+	if nl := strings.IndexByte(msg, '\n'); nl >= 0 {
+		msg = msg[:nl] // A tag script's error is followed by the tag and its code.
+	}
+	if _, ok := err.(*StepLimitError); ok {
+		return Diagnostic{Severity: "error", Code: "runtime-error", Message: msg, DiagnosticLocation: DiagnosticLocation{File: file}}
+	}
+	return Diagnostic{Severity: "error", Code: "compile-error", Message: msg, DiagnosticLocation: mentionedLocation(msg, file)}
+}
+
+// mentionedLocation finds the first "file:line" or "file:line:col" in msg.
+func mentionedLocation(msg, file string) DiagnosticLocation {
+	loc := DiagnosticLocation{File: file}
+	if file == "" {
+		return loc
+	}
+	for from := 0; ; {
+		i := strings.Index(msg[from:], file+":")
+		if i < 0 {
+			return loc
+		}
+		rest := msg[from+i+len(file)+1:]
+		if line, n := leadingInt(rest); n > 0 {
+			loc.Line = line
+			if n < len(rest) && rest[n] == ':' {
+				loc.Column, _ = leadingInt(rest[n+1:])
+			}
+			return loc
+		}
+		from += i + 1
+	}
+}
+
+// leadingInt parses the decimal digits s starts with; n is how many there are.
+func leadingInt(s string) (v, n int) {
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		v = v*10 + int(s[n]-'0')
+		n++
+	}
+	return v, n
+}
+
+// ReportError reports the error of a Parse, Compile or CompileGrammar of file
+// to the session's reporter and answers true, or answers false when the
+// session has none (the caller then prints err).
+func (s *Session) ReportError(err error, file string) bool {
+	if s.Diagnostics == nil {
+		return false
+	}
+	s.Diagnostics.Report(ErrorDiagnostic(err, file))
+	return true
+}
+
+// reportDiag is c.report: a script's diagnostic at byte position pos of the
+// current source. Its column counts the runes of the line up to pos, as the
+// SARIF log's columnKind says. It answers false without a reporter.
+func (s *Session) reportDiag(severity, code, message, file string, pos int) bool {
+	if s.Diagnostics == nil {
+		return false
+	}
+	loc := DiagnosticLocation{File: file}
+	if line := s.lineOfPos(pos); line > 0 {
+		loc.Line = line
+		start := s.src.starts[line-1]
+		if start <= pos && pos <= len(s.src.text) {
+			loc.Column = utf8.RuneCountInString(s.src.text[start:pos]) + 1
+		} else {
+			loc.Column = pos - start + 1 // A position past the source known: no text to count.
+		}
+	}
+	s.Diagnostics.Report(Diagnostic{Severity: severity, Code: code, Message: message, DiagnosticLocation: loc})
+	return true
+}
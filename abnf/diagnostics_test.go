@@ -0,0 +1,247 @@
+package abnf
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDiagnostics reports a parse error, a script warning through c.report and
+// the -verify issues of a grammar, and expects them as JSON lines with their
+// positions, and as a SARIF log with one rule per code and the dupfunc's first
+// declaration as a related location.
+func TestDiagnostics(t *testing.T) {
+	var jsonOut bytes.Buffer
+	rep, err := NewDiagnosticReporter("json", &jsonOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng := NewEngine()
+	eng.Diagnostics = rep
+	s := eng.NewSession(nil, nil)
+	opts := &Parseropts{PreventDefaultOutput: true}
+
+	grammar, err := s.CompileGrammar(`:startRule(List) ; List = "a" { "," "a" } ;`, "list.abnf", 0, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Parse(grammar, "a,a\n,b", "in.txt", opts)
+	if err == nil || !s.ReportError(err, "in.txt") {
+		t.Fatalf("the parse did not fail or was not reported: %v", err)
+	}
+
+	warnSrc := ":startScript(~~c.report(\"warning\", \"not-implemented\", \"goto not implemented (ignored)\", c.file, 4)~~) ;"
+	warner, err := s.CompileGrammar(warnSrc, "warn.abnf", 0, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetTraceSource("prog.x", "one\ntwo\n")
+	if _, err := s.Compile(nil, warner, "prog.x", 0, false, true); err != nil {
+		t.Fatal(err)
+	}
+
+	src := ":startScript(~~\n    function f() {}\n    function f() {}\n~~) ;\n:startRule(A) ;\nA = B ;\n"
+	verifyGrammar, err := s.CompileGrammar(src, "v.abnf", 0, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iss := range Verify(verifyGrammar, src, ProductionNames(verifyGrammar)) {
+		rep.Report(iss.Diagnostic("v.abnf"))
+	}
+	rep.Close()
+
+	var got []Diagnostic
+	for _, line := range strings.Split(strings.TrimSpace(jsonOut.String()), "\n") {
+		var d Diagnostic
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			t.Fatalf("not a JSON line: %q: %v", line, err)
+		}
+		got = append(got, d)
+	}
+	want := []Diagnostic{
+		{Severity: "error", Code: "parse-error", DiagnosticLocation: DiagnosticLocation{File: "in.txt", Line: 2, Column: 2}},
+		{Severity: "warning", Code: "not-implemented", DiagnosticLocation: DiagnosticLocation{File: "prog.x", Line: 2, Column: 1}},
+		{Severity: "error", Code: "dupfunc", DiagnosticLocation: DiagnosticLocation{File: "v.abnf", Line: 3}},
+		{Severity: "error", Code: "undefined", DiagnosticLocation: DiagnosticLocation{File: "v.abnf", Line: 6}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d:\n%s", len(got), len(want), jsonOut.String())
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Severity != w.Severity || g.Code != w.Code || g.File != w.File || g.Line != w.Line || g.Column != w.Column || g.Message == "" {
+			t.Errorf("diagnostic %d = %+v, want %+v", i, g, w)
+		}
+	}
+	if dup := got[2]; len(dup.Related) != 1 || dup.Related[0].Line != 2 {
+		t.Errorf("dupfunc does not relate its first declaration: %+v", dup.Related)
+	}
+
+	var sarifOut bytes.Buffer
+	sarif, _ := NewDiagnosticReporter("sarif", &sarifOut)
+	for _, d := range got {
+		sarif.Report(d)
+	}
+	if sarifOut.Len() != 0 {
+		t.Error("a SARIF log is written before Close")
+	}
+	sarif.Close()
+	sarif.Close()
+	var log struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID           string
+				Level            string
+				Locations        []interface{}
+				RelatedLocations []interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(sarifOut.Bytes(), &log); err != nil {
+		t.Fatalf("the SARIF log is not one JSON document: %v\n%s", err, sarifOut.String())
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 4 || len(log.Runs[0].Tool.Driver.Rules) != 4 {
+		t.Fatalf("unexpected SARIF log:\n%s", sarifOut.String())
+	}
+	first := log.Runs[0].Results[0]
+	if first.RuleID != "parse-error" || first.Level != "error" || len(first.Locations) != 1 {
+		t.Errorf("the results are not in source order, or incomplete: %+v", first)
+	}
+
+	if _, err := NewDiagnosticReporter("xml", &sarifOut); err == nil {
+		t.Error("an unknown format is accepted")
+	}
+}
+
+// TestDiagnosticColumns puts the failures behind multibyte characters: the
+// columns count runes (the SARIF log's columnKind), and the parse error spans
+// the word it failed on.
+func TestDiagnosticColumns(t *testing.T) {
+	var jsonOut bytes.Buffer
+	rep, _ := NewDiagnosticReporter("json", &jsonOut)
+	eng := NewEngine()
+	eng.Diagnostics = rep
+	s := eng.NewSession(nil, nil)
+	opts := &Parseropts{PreventDefaultOutput: true}
+
+	grammar, err := s.CompileGrammar(`:startRule(List) ; List = "\u00e4" { "," "\u00e4" } ;`, "list.abnf", 0, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Parse(grammar, "ä,ä\n,ä,ööö ä", "in.txt", opts)
+	if err == nil || !s.ReportError(err, "in.txt") {
+		t.Fatalf("the parse did not fail or was not reported: %v", err)
+	}
+	warner, err := s.CompileGrammar(":startScript(~~c.report(\"warning\", \"not-implemented\", \"x\", c.file, 7)~~) ;", "warn.abnf", 0, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetTraceSource("prog.x", "äöü x\n")
+	if _, err := s.Compile(nil, warner, "prog.x", 0, false, true); err != nil {
+		t.Fatal(err)
+	}
+	rep.Close()
+
+	want := []DiagnosticLocation{
+		{File: "in.txt", Line: 2, Column: 4, EndLine: 2, EndColumn: 7},
+		{File: "prog.x", Line: 1, Column: 5},
+	}
+	lines := strings.Split(strings.TrimSpace(jsonOut.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d:\n%s", len(lines), len(want), jsonOut.String())
+	}
+	var got []Diagnostic
+	for i, line := range lines {
+		var d Diagnostic
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			t.Fatal(err)
+		}
+		d.DiagnosticLocation.Message = ""
+		if d.DiagnosticLocation != want[i] {
+			t.Errorf("diagnostic %d at %+v, want %+v", i, d.DiagnosticLocation, want[i])
+		}
+		got = append(got, d)
+	}
+
+	data, err := json.Marshal(sarifLog(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"region":{"endColumn":7,"endLine":2,"startColumn":4,"startLine":2}`) {
+		t.Errorf("the SARIF region of the parse error is not its span:\n%s", data)
+	}
+}
+
+// TestSarifURIs expects the file names of a SARIF log as URI references: an
+// absolute one as a file: URI, a relative one escaped and based on SRCROOT,
+// which the run resolves to the working directory.
+func TestSarifURIs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs := filepath.Join(wd, "my grammars", "list#1.abnf")
+	log := sarifLog([]Diagnostic{
+		{Severity: "error", Code: "parse-error", DiagnosticLocation: DiagnosticLocation{File: abs, Line: 1}},
+		{Severity: "error", Code: "parse-error", DiagnosticLocation: DiagnosticLocation{File: filepath.Join("my progs", "in 1.txt"), Line: 2}},
+	})
+	data, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Runs []struct {
+			OriginalURIBaseIDs map[string]struct{ URI string } `json:"originalUriBaseIds"`
+			Results            []struct {
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI       string `json:"uri"`
+							URIBaseID string `json:"uriBaseId"`
+						}
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	run := got.Runs[0]
+	dir := filepath.ToSlash(wd)
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	base, err := url.Parse(run.OriginalURIBaseIDs["SRCROOT"].URI)
+	if err != nil || base.Scheme != "file" || base.Path != dir {
+		t.Errorf("SRCROOT is %q", run.OriginalURIBaseIDs["SRCROOT"].URI)
+	}
+	for i, want := range []struct{ uri, baseID, path string }{
+		{"file://" + (&url.URL{Path: filepath.ToSlash(abs)}).EscapedPath(), "", filepath.ToSlash(abs)},
+		{"my%20progs/in%201.txt", "SRCROOT", dir + "my progs/in 1.txt"},
+	} {
+		loc := run.Results[i].Locations[0].PhysicalLocation.ArtifactLocation
+		if loc.URI != want.uri || loc.URIBaseID != want.baseID {
+			t.Errorf("result %d: uri %q (base %q), want %q (base %q)", i, loc.URI, loc.URIBaseID, want.uri, want.baseID)
+			continue
+		}
+		ref, err := url.Parse(loc.URI)
+		if err != nil {
+			t.Errorf("result %d: %v", i, err)
+			continue
+		}
+		if got := base.ResolveReference(ref).Path; got != want.path {
+			t.Errorf("result %d resolves to %q, want %q", i, got, want.path)
+		}
+	}
+}
@@ -0,0 +1,501 @@
+package abnf
+
+// The embeddable API: an Engine holds the options of a run, a Session the state
+// of one.
+//
+// The command line sets its flags once and runs one pipeline per process, so
+// for a long time the options were package-level variables and so was the state
+// a run builds up (the trace file, the current source, which :include()s an
+// a-grammar has merged, where script output goes). A Go program that wants two
+// compilations at the same time - a service that compiles per request - cannot
+// work with that. So the options are the fields of an Engine, and everything a
+// run changes lives in a Session made from it:
+//
+//	eng := abnf.NewEngine()
+//	eng.WarnUnsupported = true
+//	s := eng.NewSession(&out, &warnings)
+//	grammar, err := s.CompileGrammar(src, "calc.abnf", 0, nil, false)
+//	asg, err := s.Parse(grammar, "9*(2+3)", "input", nil)
+//	res, err := s.Compile(asg, grammar, "input", 0, false, false)
+//
+// A session copies the engine's options when it is made, so one Engine can be
+// set up once and hand out sessions to many goroutines. A session itself is not
+// safe for concurrent use: one goroutine runs it, and a second compilation that
+// has to run at the same time gets a session of its own. Everything a session
+// reaches goes through it: the parser (parser.sess), both script engines, the
+// llvm API the scripts call (Session.llvmFuncs) and the IR runtime (jsrt.sess,
+// machine.sess). What remains at package level is read-only after the first use
+// (the built-in a-grammars, the frozen snapshot, the caches on disk, which are
+// shared on purpose and guarded where they fill lazily).
+//
+// The a-grammars are not copied. A grammar with :include()s grows by them on its
+// first parse (see applyCommand), so a grammar that two sessions parse with at
+// the same time has to be complete first: compile it and call AssembleIncludes
+// once, then share it.
+//
+// The package-level functions (ParseWithAgrammar, CompileASG, CompileGrammar,
+// ...) are the older form of the same API. They run in one default session with
+// the default options, writing to stdout and stderr.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"14.gy/mec/abnf/r"
+)
+
+// Engine holds the options of a compilation. The zero value is not ready: use
+// NewEngine, which sets the defaults.
+type Engine struct {
+	// WarnUnresolvedImports is set from the -warn-imports CLI flag. When false
+	// (the default) a program import a grammar cannot resolve aborts the
+	// compile; when true such an import is reported as a warning and skipped.
+	// Grammars read it as c.warnImports and turn it into the policy via lib
+	// resolveImports().
+	WarnUnresolvedImports bool
+
+	// WarnUnsupported is set from the -warn-unsupported CLI flag. When false (the
+	// default) a parsed-but-not-implemented construct aborts the compile with a
+	// clean file:line message; when true it is reported as a warning and replaced
+	// by a benign placeholder (a no-op statement / undefined expression) so the
+	// rest of the program still compiles - enough to build call graphs, CFGs and
+	// traces from a language that is only partially understood. Grammars read it
+	// as c.warnUnsupported via the lib notImplemented() family.
+	WarnUnsupported bool
+
+	// RuntimePrims is set from the -rt-prims CLI flag. It asks a compiler grammar
+	// to implement the derivable half of its runtime IN the source language
+	// instead of calling the Go externals: languages/metajs-to-llvm-ir.abnf then
+	// compiles languages/lib/rt-prims.metajs into the emitted module and routes
+	// js_ne, js_le, js_typeof and friends to those IR functions, so whatever is
+	// still `declare`d afterwards is the measured floor of primitives that must be
+	// written in C (docs/runtime-rework-plan.md, phase 1). Grammars read it as
+	// c.rtPrims.
+	RuntimePrims bool
+
+	// RuntimeLib is set from the -rt-lib CLI flag. It asks metajs-to-llvm-ir.abnf
+	// to compile its input as a LINKABLE RUNTIME LIBRARY (layer 2 of
+	// docs/runtime-rework-plan.md) rather than as a program: every top-level js_*
+	// function gets an exported C-ABI shim, the module's own function/string
+	// names are offset so they cannot collide with the program module it is
+	// linked against, and the function table it emits is jsdispatch_ext (the tail
+	// the program's own jsdispatch falls through to) instead of jsdispatch.
+	// Grammars read it as c.rtLib.
+	RuntimeLib bool
+
+	// EntryPoint is the name of the top-level function a compiled program calls
+	// as its entry point, set from the -main CLI flag. Grammars read it as
+	// c.mainName; it lets a program whose entry function is not named main - or a
+	// real-world file with no main() at all - be run from a chosen function
+	// instead. Empty means "unset": each grammar then falls back to its own
+	// default entry (main for most, Main for C#).
+	EntryPoint string
+
+	// ExePath is the output path for a native executable, set from the -exe CLI
+	// flag. A -to-llvm-ir grammar reads it as c.exePath: when non-empty it hands
+	// the built ir.Module to llvm.BuildExecutable (clang) and writes a real binary
+	// instead of running the module in the built-in IR interpreter.
+	ExePath string
+
+	// RuntimeInputs are extra files clang links into the -exe build alongside the
+	// emitted module, set from the -rt CLI flag (repeatable): .c sources, .ll
+	// modules, .o objects, .a archives - anything one clang invocation accepts.
+	// Grammars read the list as c.runtime and hand it to llvm.BuildExecutable,
+	// which also merges it in on its own, so a grammar that supplies its own
+	// runtime and a user who adds one on the command line compose instead of
+	// overriding each other.
+	//
+	// Declaring a runtime also changes what an unresolved symbol MEANS: see
+	// buildExecutable in llvmmap.go - it is then an error, not a zero stub.
+	RuntimeInputs []string
+
+	// Args and Stdin are what the compiled or interpreted program gets as its
+	// command line and its standard input: the arguments after -- on the mec
+	// command line, and what -stdin passed through (empty without it). Grammars
+	// read them as c.args and c.stdin; a handle-IR program reaches them through
+	// the js_argv and js_stdin_line externs, and llvm.Run hands them to the start
+	// function's argc/argv and to getchar. A native build reads its own.
+	Args  []string
+	Stdin string
+
+	// LinkDirs and LinkLibs are the -L and -l passthrough for the -exe link, so a
+	// build can use real system libraries (e.g. -l m). They reach clang verbatim,
+	// in command line order, after the module and the runtime inputs.
+	LinkDirs []string
+	LinkLibs []string
+
+	// ImportRoots holds the -i include directories, in command-line order. An
+	// import that names a project file is searched relative to the imported-from
+	// program's directory first, then relative to each root.
+	ImportRoots []string
+
+	// Frozen switches the parser and compiler script subsystems from goja to the
+	// frozen MetaJS bootstrap (frozen.go). Set by the -frozen CLI flag.
+	Frozen bool
+
+	// MaxIRSteps is the step budget of one top-level IR call, set from the
+	// -max-steps CLI flag. 0 means "no limit"; newMachine() turns that into a
+	// budget nothing can reach, so the check in run() stays a single comparison.
+	MaxIRSteps int
+
+	// ParseErrorWithCode and ParseErrorUnabridged shape the "not everything could
+	// be parsed" dump of what parsed so far. WithCode shows each tag's code
+	// (SerializeCompact) rather than the structure-only tree (SerializeMinimal);
+	// Unabridged prints the whole thing instead of cutting the middle with [...].
+	// Set from the -error CLI flag: short (default), code, short-all, code-all.
+	ParseErrorWithCode   bool
+	ParseErrorUnabridged bool
+
+	// DetectAmbiguity is set from the -ambiguity CLI flag (ambiguity.go).
+	DetectAmbiguity bool
+
+	// CoverageOutPath is set from the -grammar-coverage CLI flag: the JSON-lines
+	// file the coverage counts accumulate in. Empty disables the measurement (and
+	// with it every hook in the parser).
+	CoverageOutPath string
+
+	// CFGOutPath and TraceOutPath are set from the -cfgraph and -trace CLI flags.
+	CFGOutPath   string
+	TraceOutPath string
+
+	// ASGOutPath is set from the -asg CLI flag: the file the ASG of the final
+	// program's parse is written to, as JSON. Empty writes none.
+	ASGOutPath string
+
+	// IROutPath is set from the -ir CLI flag: the file every module a run
+	// executes is written to, as LLVM IR text. Empty writes none.
+	IROutPath string
+
+	// CallgraphOutPath is set from the -callgraph CLI flag: a .jsonl path holds
+	// sdef/scall records for a later -render static, anything else writes DOT.
+	// CallgraphAppend (from -callgraph-append) keeps the existing .jsonl and adds
+	// to it, so many runs on different files accumulate one codebase-wide graph;
+	// the default -callgraph overwrites the file up front, like -trace and
+	// -cfgraph.
+	CallgraphOutPath string
+	CallgraphAppend  bool
+
+	// Repl is set from the -repl CLI flag. Grammars read it as c.repl: after the
+	// program has run, they read statements with c.replRead and run each one in
+	// the program's scope (repl.go). ReplInput is where the lines come from; nil
+	// reads os.Stdin.
+	Repl      bool
+	ReplInput io.Reader
+
+	// CatchExit decides what exit(n) does, in a tag script or in a program that
+	// llvm.Run / llvm.RunJS runs. Unset, it exits the process, which is what the
+	// command line wants. Set, it ends only the session call that is running:
+	// Parse, Compile, CompileGrammar or RunPipeline returns an *ExitError with n.
+	CatchExit bool
+
+	// Diagnostics is the -diagnostics reporter (diagnostics.go). Set, the
+	// scripts' c.report and ReportError send their findings to it as structured
+	// records; nil leaves them the text lines they always were. The sessions of
+	// a -batch share it, and a process exit(n) closes it.
+	Diagnostics *DiagnosticReporter
+
+	// Debugger is the -debug debugger (debugger.go). Set, the compile walks of
+	// the sessions stop at its breakpoints and steps, and tell it where they
+	// stand; nil walks without the hooks. A Debugger follows one run at a time,
+	// so a -batch cannot share one.
+	Debugger *Debugger
+
+	// ProgramDebugger is the -pdebug debugger (progdebugger.go). Set, the
+	// compilers mark every statement with its position and scope, and the
+	// programs llvm.RunJS runs stop at its breakpoints and steps.
+	ProgramDebugger *ProgramDebugger
+
+	// Bindings are the Go values the tag scripts of the sessions see as
+	// globals, by name; Bind adds to them (hostbind.go).
+	Bindings map[string]interface{}
+
+	// Sandbox is the -sandbox policy (sandbox.go). Set, the scripts reach only
+	// the files below its directories, exit() acts as under CatchExit, and each
+	// session runs within its time and memory limits; nil trusts the grammars.
+	Sandbox *Sandbox
+}
+
+// ExitError is the error of a session call that a script or program ended with
+// exit(n) while the engine had CatchExit set. Code 0 is not a failure, only the
+// end of the run.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("exit status %d", e.Code) }
+
+// exit is exit(n) for the scripts and the programs of this session.
+func (s *Session) exit(code int) {
+	if s.CatchExit {
+		panic(&ExitError{Code: code})
+	}
+	if s.Diagnostics != nil {
+		s.Diagnostics.Close() // A SARIF log is written at the end, and this is it.
+	}
+	s.flushCoverage()
+	if s.Debugger != nil {
+		s.Debugger.Finish(code)
+	}
+	if s.ProgramDebugger != nil {
+		s.ProgramDebugger.Finish(code)
+	}
+	os.Exit(code)
+}
+
+// recoveredError turns what a session entry point recovered into its error. An
+// *ExitError stays itself, so the caller can tell an exit from a failure, and so
+// does a *ParseError, so -repl can tell an unfinished statement, and a
+// jsProgramPanic, so -diagnostics can tell a runtime error (the text of both is
+// the same as before). A *SandboxError and a *StepLimitError stay themselves
+// too, so an embedder can tell which limit stopped the run.
+func recoveredError(p interface{}) error {
+	switch e := p.(type) {
+	case *ExitError:
+		return e
+	case *ParseError:
+		return e
+	case jsProgramPanic:
+		return e
+	case *SandboxError:
+		return e
+	case *StepLimitError:
+		return e
+	}
+	return fmt.Errorf("%s", p)
+}
+
+// NewEngine returns an Engine with the default options.
+func NewEngine() *Engine {
+	return &Engine{MaxIRSteps: machineMaxStepsDefault}
+}
+
+// Session is one run of an Engine: the options it was made with, where its
+// output goes, and the state its parses and compiles build up. See the top of
+// this file.
+type Session struct {
+	Engine // A copy: changing the Engine later does not change a running session.
+
+	// out is where the annotation scripts' print / println / printf and the
+	// programs they run send their output. SetOutput redirects it so that one
+	// pipeline stage's text output can be captured and fed as the program input
+	// of the next stage - the -pipe mode of main.go.
+	out io.Writer
+	// warn is where DIAGNOSTICS go: the `eprintln` host function of the tag
+	// scripts, the runtime warnings, the -ambiguity report. Unlike out it is
+	// deliberately NOT redirectable:
+	//
+	//   - a warning must never land inside an emitted module (it would make the
+	//     module unparseable) or inside a program's own output, and
+	//   - it must never be captured by -pipe, which swaps out to collect one
+	//     stage's text as the next stage's SOURCE - a warning in there would be
+	//     fed to the next grammar as program text.
+	//
+	// It is also not silenced by -q/-qq: those flags are about module and program
+	// output, and a warning is a diagnostic about the compile, not output.
+	warn io.Writer
+
+	pack      packState              // The language pack in use (pack.go).
+	src       traceSource            // The program source positions refer to (trace.go).
+	trace     *traceStream           // The -trace file and the -cfgraph count (trace.go); shared with forks.
+	cgFiles   *callgraphFiles        // The -callgraph files (callgraph.go); shared with forks.
+	cg        callgraphRun           // The -callgraph attribution of the module being built.
+	coverage  *coverageRun           // The -grammar-coverage counts (coverage.go); shared with forks.
+	covTables map[*r.Rules]*covTable // The counts of the parses running, per a-grammar.
+	llvm      map[string]r.Object    // The llvm object of the scripts (Session.llvmFuncs).
+	inputs    map[string]bool        // The files read from disk for the languages (Inputs).
+	repl      replState              // The -repl input and the runtime it keeps (repl.go).
+	sandbox   *sandboxRun            // The limits of Engine.Sandbox (sandbox.go); nil without one.
+	pipe      pipeState              // emit() and c.input, the structured channel of -pipe (pipe.go).
+}
+
+// NewSession starts a session with the engine's options. Script and program
+// output goes to out, diagnostics to warn; nil discards them.
+func (e *Engine) NewSession(out, warn io.Writer) *Session {
+	if out == nil {
+		out = io.Discard
+	}
+	if warn == nil {
+		warn = io.Discard
+	}
+	builtinsOnce.Do(linkBuiltins)
+	s := &Session{Engine: *e, out: out, warn: warn, trace: &traceStream{}, cgFiles: &callgraphFiles{}, coverage: &coverageRun{}}
+	if e.Sandbox != nil {
+		s.sandbox = newSandboxRun(e.Sandbox)
+		s.CatchExit = true // A sandboxed script must not end the host.
+	}
+	return s
+}
+
+// Fork starts a session for a run that goes on next to s, in a goroutine of its
+// own: the same options, its own state and writers, but the -trace stream, the
+// -cfgraph numbering, the -callgraph files and the -grammar-coverage counts are
+// s's. The forks of a batch over many files so write one trace, one call graph
+// and one coverage file between them, instead of each truncating what the
+// others wrote; the coverage file is written when s closes.
+func (s *Session) Fork(out, warn io.Writer) *Session {
+	f := s.Engine.NewSession(out, warn)
+	f.trace, f.cgFiles, f.coverage = s.trace, s.cgFiles, s.coverage
+	return f
+}
+
+var builtinsOnce sync.Once
+
+// linkBuiltins links the built-in a-grammars before the first session can parse
+// with them: every parse links its a-grammar, and it is the first linking that
+// writes. After it, the sessions only read them.
+func linkBuiltins() {
+	NewReferences().correctReferencesAndIDs(AbnfAgrammar)
+	if jsAgrammar != nil {
+		NewReferences().correctReferencesAndIDs(jsAgrammar)
+	}
+}
+
+var (
+	defaultOnce sync.Once
+	defaultSess *Session
+)
+
+// defaultSession is the session of the package-level functions: default options,
+// stdout and stderr.
+func defaultSession() *Session {
+	defaultOnce.Do(func() { defaultSess = NewEngine().NewSession(os.Stdout, os.Stderr) })
+	return defaultSess
+}
+
+// SetOutput redirects the script output of the default session to w and returns
+// the previous writer, so the caller can restore it afterwards (pass the returned
+// value, or os.Stdout, back).
+func SetOutput(w io.Writer) io.Writer {
+	return defaultSession().SetOutput(w)
+}
+
+// SetOutput redirects script and program output to w and returns the previous
+// writer, so the caller can restore it afterwards.
+func (s *Session) SetOutput(w io.Writer) io.Writer {
+	prev := s.out
+	s.out = w
+	return prev
+}
+
+// progArgs is c.args: Args, and an empty array rather than null when there are
+// none (a run without --), which the frozen runtime would hand on as null.
+func (s *Session) progArgs() []string {
+	if s.Args == nil {
+		return []string{}
+	}
+	return s.Args
+}
+
+// Open prepares the session's output files: it truncates the -trace and
+// -callgraph files up front, so a run that writes nothing to them does not leave
+// a stale file from an earlier run behind. Close closes them again.
+func (s *Session) Open() {
+	s.openTrace()
+	s.openCallgraph()
+}
+
+// Close ends the session: it closes the -trace file (writes are unbuffered,
+// nothing to flush) and writes the -grammar-coverage counts. Closing twice is
+// harmless.
+func (s *Session) Close() {
+	s.closeTrace()
+	s.flushCoverage()
+}
+
+// Parse parses the target text src with the given a-grammar and returns the
+// resulting ASG, like ParseWithAgrammar. opts may be nil.
+func (s *Session) Parse(agrammar *r.Rules, src, fileName string, opts *Parseropts) (*r.Rules, error) {
+	if opts == nil {
+		opts = &Parseropts{}
+	}
+	asg, err := s.parse(agrammar, src, fileName, opts)
+	if err == nil && s.ASGOutPath != "" && fileName == s.src.name {
+		s.dumpASG(asg)
+	}
+	return asg, err
+}
+
+// dumpASG writes the ASG of the final program to the -asg file, in the JSON
+// interchange format of abnf/r/marshal.go.
+func (s *Session) dumpASG(asg *r.Rules) {
+	dat, err := r.Marshal(asg, r.MarshalJSON)
+	if err == nil {
+		err = os.WriteFile(s.ASGOutPath, dat, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(s.warn, "asg dump failed: ", err)
+	}
+}
+
+// Compile compiles an ASG with the start script of its a-grammar, like CompileASG.
+func (s *Session) Compile(asg, agrammar *r.Rules, fileName string, slot int, traceEnabled, preventDefaultOutput bool) (*r.Rules, error) {
+	return s.compile(asg, agrammar, fileName, slot, traceEnabled, preventDefaultOutput)
+}
+
+// RunPipeline runs a chain of files the way the command line does: the first
+// file is a grammar, compiled by the built-in a-grammar (or a language pack, see
+// IsPack), and every further file is parsed and compiled by the a-grammar the
+// file before it compiled to. When the last a-grammar has a :startScript() but
+// no :startRule(), it runs on an empty input. srcs holds the sources of the
+// files; nil reads them. The result is what the last file compiled to: an
+// a-grammar, or nil for a program (its output went to the session's writer).
+func (s *Session) RunPipeline(files, srcs []string, opts *Parseropts) (*r.Rules, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files")
+	}
+	if opts == nil {
+		opts = &Parseropts{}
+	}
+	if srcs == nil {
+		srcs = make([]string, len(files))
+		for i, file := range files {
+			if i == 0 && IsPack(file) {
+				continue
+			}
+			dat, err := s.readHostFile(file)
+			if err != nil {
+				return nil, err
+			}
+			srcs[i] = StripBOM(string(dat))
+		}
+	}
+	if len(srcs) != len(files) {
+		return nil, fmt.Errorf("%d files but %d sources", len(files), len(srcs))
+	}
+	grammar := AbnfAgrammar
+	for i, file := range files {
+		if i == len(files)-1 {
+			s.SetTraceSource(file, srcs[i]) // Positions in traces and diagrams refer to the final program.
+		}
+		var err error
+		switch {
+		case i == 0 && IsPack(file):
+			grammar, err = s.OpenPack(file)
+		case grammar == AbnfAgrammar:
+			grammar, err = s.CompileGrammar(srcs[i], file, 0, opts, opts.PreventDefaultOutput)
+		default:
+			grammar, err = s.runStage(grammar, file, srcs[i], opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if grammar == nil && i < len(files)-1 {
+			return nil, fmt.Errorf("%s did not compile to an a-grammar, so %s cannot be parsed with it", file, files[i+1])
+		}
+	}
+	if GrammarStartScriptOnly(grammar) {
+		return s.runStage(grammar, "", "", opts)
+	}
+	return grammar, nil
+}
+
+// runStage parses one file of a pipeline and compiles its ASG.
+func (s *Session) runStage(grammar *r.Rules, file, src string, opts *Parseropts) (*r.Rules, error) {
+	asg, err := s.parse(grammar, src, file, opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.compile(asg, grammar, file, 0, opts.TraceEnabled, opts.PreventDefaultOutput)
+}
@@ -0,0 +1,286 @@
+package abnf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"14.gy/mec/abnf/r"
+)
+
+// TestEngineParallelSessions runs different languages side by side, each in a
+// session of its own, and checks that every program's output lands in its own
+// session's writer and nowhere else. Run it under -race: what it guards is the
+// state that used to be package-level (the output writer, the trace source, the
+// Java and Kotlin runtime holders, the linked built-ins), and a data race there
+// is the failure this test exists to catch, even when the outputs happen to come
+// out right.
+func TestEngineParallelSessions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles four language grammars")
+	}
+	lang := func(name string) string { return filepath.Join("..", "languages", name) }
+	type job struct {
+		grammar, file, src string
+		want               func(i int) string
+	}
+	jobs := []job{
+		{lang("calculator-global-stack-interpreter.abnf"), "calc.txt", "", func(i int) string {
+			return fmt.Sprintf("RESULT: %d", 1+2*i)
+		}},
+		{lang("python-to-llvm-ir.abnf"), "prog.py", "", func(i int) string {
+			return fmt.Sprintf("py %d", 3*i)
+		}},
+		{lang("java-to-llvm-ir.abnf"), "Main.java", "", func(i int) string {
+			return fmt.Sprintf("caught / by zero %d", i)
+		}},
+		{lang("kotlin-to-llvm-ir.abnf"), "main.kt", "", func(i int) string {
+			return fmt.Sprintf("k%d", i)
+		}},
+	}
+	src := func(j, i int) string {
+		switch j {
+		case 0:
+			return fmt.Sprintf("1+2*%d\n", i)
+		case 1:
+			return fmt.Sprintf("print(\"py\", 3 * %d)\n", i)
+		case 2:
+			return fmt.Sprintf("public class Main {\n    public static void main(String[] args) {\n"+
+				"        try { int z = 0; System.out.println(5 / z); }\n"+
+				"        catch (ArithmeticException e) { System.out.println(\"caught \" + e.getMessage() + \" %d\"); }\n"+
+				"    }\n}\n", i)
+		default:
+			return fmt.Sprintf("fun main() {\n    val s = with(StringBuilder()) { append(\"k\"); append(%d); toString() }\n    println(s)\n}\n", i)
+		}
+	}
+
+	eng := NewEngine()
+	eng.CatchExit = true // The -to-llvm-ir grammars end with exit(result).
+	const rounds = 2
+	var wg sync.WaitGroup
+	errs := make(chan error, len(jobs)*rounds)
+	for j := range jobs {
+		for i := 1; i <= rounds; i++ {
+			wg.Add(1)
+			go func(j, i int) {
+				defer wg.Done()
+				var out, warn bytes.Buffer
+				s := eng.NewSession(&out, &warn)
+				jb := jobs[j]
+				grammarSrc, err := s.readHostFile(jb.grammar)
+				if err != nil {
+					errs <- err
+					return
+				}
+				_, err = s.RunPipeline([]string{jb.grammar, jb.file}, []string{string(grammarSrc), src(j, i)}, nil)
+				var exit *ExitError
+				if errors.As(err, &exit) && exit.Code == 0 {
+					err = nil
+				}
+				if err != nil {
+					errs <- fmt.Errorf("%s #%d: %v\n%s", jb.file, i, err, warn.String())
+					return
+				}
+				if got, want := strings.TrimSpace(out.String()), jb.want(i); !strings.Contains(got, want) {
+					errs <- fmt.Errorf("%s #%d: output %q, want it to contain %q", jb.file, i, got, want)
+				}
+			}(j, i)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestEngineForksShareGrammar is the -batch setup: one a-grammar, compiled and
+// assembled once, parsed and compiled with by many forks of one session at the
+// same time. The grammar is read-only for them apart from caches the parser
+// fills on it, and those must be safe to fill concurrently (see r.SeqWrapper).
+func TestEngineForksShareGrammar(t *testing.T) {
+	file := filepath.Join("..", "languages", "calculator-global-stack-interpreter.abnf")
+	s := NewEngine().NewSession(nil, nil)
+	src, err := s.readHostFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grammar, err := s.CompileGrammar(string(src), file, 0, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AssembleIncludes(grammar, file, &Parseropts{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// All forks parse first, then all compile: a compile takes locks (the script
+	// caches), and on a single CPU those would order one fork's parse after the
+	// last one's, hiding from the race detector what a parallel batch really does.
+	const n = 8
+	forks := make([]*Session, n)
+	outs := make([]bytes.Buffer, n)
+	asgs := make([]*r.Rules, n)
+	errs := make([]error, n)
+	parallel := func(run func(i int)) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+	for i := range forks {
+		forks[i] = s.Fork(&outs[i], nil)
+	}
+	parallel(func(i int) {
+		asgs[i], errs[i] = forks[i].Parse(grammar, fmt.Sprintf("%d*(2+3)", i), "prog", &Parseropts{})
+	})
+	parallel(func(i int) {
+		if errs[i] == nil {
+			_, errs[i] = forks[i].Compile(asgs[i], grammar, "prog", 0, false, false)
+		}
+	})
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("fork %d: %v", i, errs[i])
+		}
+		if want := fmt.Sprintf("RESULT: %d", i*5); !strings.Contains(outs[i].String(), want) {
+			t.Errorf("fork %d printed %q, want %q in it", i, outs[i].String(), want)
+		}
+	}
+}
+
+// TestIncludeOnce merges two :include() fragments that share a helper
+// fragment, which in turn includes one of them again, and uses the a-grammar in
+// two sessions: every file is merged once, however often it is reached.
+func TestIncludeOnce(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.abnf":   `:startRule(List) ; :include("a.abnf") ; :include("b.abnf") ; List = A B ;`,
+		"a.abnf":      `:include("common.abnf") ; A = "a" C ;`,
+		"b.abnf":      `:include("common.abnf") ; B = "b" C ;`,
+		"common.abnf": `:include("a.abnf") ; C = "c" ;`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := filepath.Join(dir, "main.abnf")
+	eng := NewEngine()
+	grammar, err := eng.NewSession(nil, nil).CompileGrammar(files["main.abnf"], main, 0, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := eng.NewSession(nil, nil).Parse(grammar, "acbc", "prog", &Parseropts{PreventDefaultOutput: true}); err != nil {
+			t.Fatalf("session %d: %v", i, err)
+		}
+	}
+	var prods []string
+	for _, rule := range *grammar {
+		if rule.Operator == r.Production {
+			prods = append(prods, rule.String)
+		}
+	}
+	if got := strings.Join(prods, " "); got != "List A B C" {
+		t.Errorf("the merged productions are %s, want List A B C", got)
+	}
+}
+
+// TestEngineProgramArgs hands a command line and an input to programs through
+// Engine.Args and Engine.Stdin (mec prog -- args, -stdin) on both engines: a C
+// main(argc, argv) under llvm.Run, Python's sys.argv and input() through the
+// js_argv and js_stdin_line externs, and the same through c.args and c.stdin
+// in the Python interpreter - also for a run without --, where c.args is empty.
+func TestEngineProgramArgs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles three language grammars")
+	}
+	lang := func(name string) string { return filepath.Join("..", "languages", name) }
+	pyArgs := "import sys\nprint(sys.argv)\nprint(input('> '))\nprint(input())\n" +
+		"try:\n    input()\nexcept EOFError as e:\n    print('eof:', e)\n"
+	pyWant := "['args.py', 'one', 'two words']\n> line 1\nline 2\neof: EOF when reading a line\n"
+	cases := []struct {
+		grammar, file, src string
+		args               []string // nil is a run without --.
+		want               []string
+	}{
+		{lang("c-to-llvm-ir.abnf"), "args.c",
+			"int main(int argc, char **argv) {\n" +
+				"    int i;\n" +
+				"    for (i = 1; i < argc; i++) { char *a = argv[i]; while (*a) { putchar(*a); a++; } putchar(10); }\n" +
+				"    i = getchar();\n" +
+				"    while (i > 0) { putchar(i); i = getchar(); }\n" +
+				"    return argc;\n" +
+				"}\n",
+			[]string{"one", "two words"},
+			[]string{"one\ntwo words\nline 1\r\nline 2\n", "main() returned 3"}},
+		{lang("python-to-llvm-ir.abnf"), "args.py", pyArgs, []string{"one", "two words"}, []string{pyWant}},
+		{lang("python-interpreter.abnf"), "args.py", pyArgs, []string{"one", "two words"}, []string{pyWant}},
+		{lang("python-interpreter.abnf"), "noargs.py", "import sys\nprint(sys.argv)\n", nil, []string{"['noargs.py']\n"}},
+	}
+	for _, frozen := range []bool{false, true} {
+		for _, tc := range cases {
+			eng := NewEngine()
+			eng.Frozen = frozen
+			eng.CatchExit = true
+			eng.Args = tc.args
+			eng.Stdin = "line 1\r\nline 2\n"
+			var out, warn bytes.Buffer
+			s := eng.NewSession(&out, &warn)
+			grammarSrc, err := s.readHostFile(tc.grammar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = s.RunPipeline([]string{tc.grammar, tc.file}, []string{string(grammarSrc), tc.src}, nil)
+			var exit *ExitError
+			if err != nil && !errors.As(err, &exit) {
+				t.Errorf("frozen=%v: %s %s: %v\n%s", frozen, filepath.Base(tc.grammar), tc.file, err, warn.String())
+				continue
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("frozen=%v: %s %s: output %q, want it to contain %q", frozen, filepath.Base(tc.grammar), tc.file, out.String(), want)
+				}
+			}
+		}
+	}
+}
+
+// TestRunInput pins what llvm.Run's input argument means on both engines: left
+// out or undefined, getchar reads Engine.Stdin; an explicit string, "" too, is
+// the input itself.
+func TestRunInput(t *testing.T) {
+	src := `:startScript(~~
+    var i32 = llvm.types.I32
+    var m = llvm.ir.NewModule()
+    var gc = m.NewFunc("getchar", i32)
+    var b = m.NewFunc("main", i32).NewBlock("entry")
+    b.NewRet(b.NewCall(gc))
+    println(llvm.Run(m, "main").Ret + " " + llvm.Run(m, "main", undefined).Ret + " " +
+        llvm.Run(m, "main", "Z").Ret + " " + (llvm.Run(m, "main", "").Ret == 65))
+~~) ;
+`
+	for _, frozen := range []bool{false, true} {
+		eng := NewEngine()
+		eng.Frozen = frozen
+		eng.Stdin = "A"
+		var out, warn bytes.Buffer
+		s := eng.NewSession(&out, &warn)
+		if _, err := s.RunPipeline([]string{"run.abnf"}, []string{src}, nil); err != nil {
+			t.Fatalf("frozen=%v: %v\n%s", frozen, err, warn.String())
+		}
+		if got, want := out.String(), "65 65 90 false\n"; got != want {
+			t.Errorf("frozen=%v: printed %q, want %q", frozen, got, want)
+		}
+	}
+}
@@ -0,0 +1,1167 @@
+package abnf
+
+// Exporting a-grammars to other grammar formats (-export).
+//
+// The export works on the COMPILED a-grammar (r.Rules) with its :include()
+// fragments merged in (AssembleIncludes), so it sees exactly the productions the
+// parser would use, no matter which front-end syntax (ABNF, EBNF, ...) the
+// grammar was written in. Three text formats and one graphical one exist:
+//
+//	antlr        an ANTLR4 combined grammar (.g4)
+//	ebnf         W3C EBNF, the notation of the XML specification
+//	tree-sitter  a tree-sitter grammar.js
+//	railroad     one standalone SVG railroad diagram per production (railroad.go)
+//
+// An a-grammar is a scannerless PEG: the Or is an ordered choice, every Token
+// and char class skips the current whitespace production in front of it, and a
+// production switches that off with an inline :whitespace(). None of the
+// targets works like that, so the result is a faithful STARTING POINT for a
+// port, not a drop-in replacement:
+//
+//   - The whitespace production named by the global :whitespace() becomes the
+//     skipped token (ANTLR "-> skip", tree-sitter "extras"). A production that
+//     switches whitespace off, or that reads single chars (ranges and char
+//     classes), is lexical: in ANTLR it becomes a lexer rule (a fragment when
+//     only other lexer rules use it), in tree-sitter its body is wrapped into
+//     token() with the lexical productions it uses inlined.
+//   - Tags are exported as the rules inside them; their code is kept as a
+//     comment. :script(), :number() and everything else that needs the runtime
+//     is marked as unsupported in a comment in place.
+//   - A negative lookahead (Not) in front of a negated char class merges into
+//     the class, which every target can express. W3C EBNF additionally writes
+//     "!A B" as the difference "B - A" when both read a single char. Everywhere
+//     else the lookahead is kept as an unsupported comment.
+//   - Times is expanded into copies and options, since only tree-sitter's
+//     regexes know counted repetition and those cannot hold rules.
+//
+// The ordered choice itself is never translated: ANTLR and tree-sitter resolve
+// alternatives by lookahead and W3C EBNF has no semantics for it at all, so an
+// Or that depends on its order (a keyword in front of an identifier) needs a
+// look by hand. -ambiguity finds the ones that matter.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf/r"
+)
+
+// ExportFormats are the valid values of -export.
+var ExportFormats = []string{"antlr", "ebnf", "tree-sitter", "railroad"}
+
+// exportMaxTimes is the largest count a Times is expanded to. Beyond it the
+// minimum is kept and the rest becomes an unbounded repetition, with a comment.
+const exportMaxTimes = 16
+
+// Export writes the assembled a-grammar grammar in format. The text formats are
+// written to out; railroad writes one SVG file per production into the
+// directory dir (created if needed) and ignores out. name names the grammar
+// where the format needs a name (the grammar declaration of ANTLR, the name of
+// the tree-sitter language); it is cleaned up to an identifier here.
+func Export(format string, grammar *r.Rules, name string, out io.Writer, dir string) error {
+	ex := newExporter(grammar)
+	switch format {
+	case "antlr":
+		_, err := io.WriteString(out, ex.antlr(exportIdent(name, false)))
+		return err
+	case "ebnf":
+		_, err := io.WriteString(out, ex.ebnf())
+		return err
+	case "tree-sitter":
+		_, err := io.WriteString(out, ex.treeSitter(strings.ToLower(exportIdent(name, true))))
+		return err
+	case "railroad":
+		if dir == "" {
+			return fmt.Errorf("-export railroad writes one file per production and needs a directory (-o DIR)")
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		for _, prod := range ex.prods {
+			file := filepath.Join(dir, exportIdent(prod.String, false)+".svg")
+			if err := os.WriteFile(file, []byte(ex.railroad(prod)), 0o644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown export format '%s' (use %s)", format, strings.Join(ExportFormats, ", "))
+}
+
+// exportIdent makes an identifier out of a file or production name. Every run
+// of other chars becomes one '_' when snake is set ("kotlin_interpreter"), and
+// a case change otherwise ("KotlinInterpreter").
+func exportIdent(name string, snake bool) string {
+	var b strings.Builder
+	up := !snake
+	for _, c := range name {
+		switch {
+		case c < utf8.RuneSelf && (unicode.IsLetter(c) || unicode.IsDigit(c)):
+			if up {
+				c = unicode.ToUpper(c)
+			}
+			b.WriteRune(c)
+			up = false
+		case snake:
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+		default:
+			up = true
+		}
+	}
+	s := strings.TrimSuffix(b.String(), "_")
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		s = "G" + s
+	}
+	return s
+}
+
+type exporter struct {
+	grammar    *r.Rules
+	prods      []*r.Rule          // In grammar order.
+	byName     map[string]*r.Rule // The productions by name.
+	start      string             // The name of the start production ("" if there is none).
+	whitespace string             // The production named by the global :whitespace() ("" if none).
+	lexical    map[string]bool    // The productions that read single chars (see the file comment).
+	predicate  map[string]bool    // The productions that are nothing but commands (a :script() check).
+	notes      []string           // The global commands that are not exported (header comments).
+}
+
+func newExporter(grammar *r.Rules) *exporter {
+	ex := &exporter{grammar: grammar, byName: map[string]*r.Rule{}, lexical: map[string]bool{}, predicate: map[string]bool{}}
+	for _, rule := range *grammar {
+		switch {
+		case rule.Operator == r.Production:
+			if ex.byName[rule.String] == nil {
+				ex.prods = append(ex.prods, rule)
+				ex.byName[rule.String] = rule
+			}
+		case rule.Operator != r.Command:
+		case rule.String == "startRule":
+			if start := r.GetStartRule(grammar); start != nil {
+				ex.start = start.String
+			}
+		case rule.String == "whitespace":
+			if rule.CodeChilds != nil && len(*rule.CodeChilds) == 1 && (*rule.CodeChilds)[0].Operator == r.Identifier {
+				ex.whitespace = (*rule.CodeChilds)[0].String
+			} else if rule.CodeChilds == nil || len(*rule.CodeChilds) == 0 {
+				ex.notes = append(ex.notes, "Whitespace is not skipped (global :whitespace() without a production).")
+			} else {
+				ex.notes = append(ex.notes, "The global whitespace is not a single production and is not exported: "+covLabel(rule))
+			}
+		case rule.String == "startScript":
+			ex.notes = append(ex.notes, "The :startScript() of the grammar is not exported.")
+		}
+	}
+	for _, prod := range ex.prods {
+		if ex.readsChars(prod.Childs) || prod.String == ex.whitespace {
+			ex.lexical[prod.String] = true
+		}
+		ex.predicate[prod.String] = onlyCommands(prod.Childs)
+	}
+	// A production that only lexical productions use is read inside their
+	// tokens (usually with the whitespace switched off), so it is lexical, too.
+	users := map[string]map[string]bool{}
+	for _, prod := range ex.prods {
+		var walk func(rules *r.Rules)
+		walk = func(rules *r.Rules) {
+			if rules == nil {
+				return
+			}
+			for _, rule := range *rules {
+				if rule.Operator == r.Identifier && rule.String != prod.String {
+					if users[rule.String] == nil {
+						users[rule.String] = map[string]bool{}
+					}
+					users[rule.String][prod.String] = true
+				}
+				walk(rule.Childs)
+			}
+		}
+		walk(prod.Childs)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, prod := range ex.prods {
+			if ex.lexical[prod.String] || prod.String == ex.start || len(users[prod.String]) == 0 {
+				continue
+			}
+			all := true
+			for user := range users[prod.String] {
+				all = all && ex.lexical[user]
+			}
+			if all {
+				ex.lexical[prod.String], changed = true, true
+			}
+		}
+	}
+	return ex
+}
+
+// readsChars reports whether rules switch whitespace off or read single chars
+// (ranges and char classes) directly, without a production in between.
+func (ex *exporter) readsChars(rules *r.Rules) bool {
+	if rules == nil {
+		return false
+	}
+	for _, rule := range *rules {
+		switch rule.Operator {
+		case r.Range, r.CharOf, r.CharsOf:
+			return true
+		case r.Command:
+			if rule.String == "whitespace" && (rule.CodeChilds == nil || len(*rule.CodeChilds) == 0) {
+				return true
+			}
+		case r.Identifier:
+			continue
+		}
+		if ex.readsChars(rule.Childs) {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyCommands reports whether rules hold nothing but commands.
+func onlyCommands(rules *r.Rules) bool {
+	if rules == nil || len(*rules) == 0 {
+		return false
+	}
+	for _, rule := range *rules {
+		switch rule.Operator {
+		case r.Command:
+		case r.Sequence, r.Group:
+			if !onlyCommands(rule.Childs) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// onlyLexical reports whether name (transitively) uses no production that is
+// not lexical, i.e. whether it can be a token of its own. A predicate does not
+// count: it reads nothing, and a token keeps it as a comment.
+func (ex *exporter) onlyLexical(name string, seen map[string]bool) bool {
+	if seen[name] {
+		return true
+	}
+	seen[name] = true
+	prod := ex.byName[name]
+	if prod == nil {
+		return false
+	}
+	ok := true
+	var walk func(rules *r.Rules)
+	walk = func(rules *r.Rules) {
+		if rules == nil || !ok {
+			return
+		}
+		for _, rule := range *rules {
+			if rule.Operator == r.Identifier && !ex.predicate[rule.String] {
+				if !ex.lexical[rule.String] || !ex.onlyLexical(rule.String, seen) {
+					ok = false
+					return
+				}
+			}
+			walk(rule.Childs)
+		}
+	}
+	walk(prod.Childs)
+	return ok
+}
+
+// skippedRepeat returns the { } that makes up the whole whitespace production,
+// or nil. The skipped token must not match the empty string in ANTLR nor in
+// tree-sitter, so its zero-or-more loop is written as one-or-more: there is no
+// difference where it is skipped.
+func skippedRepeat(prod *r.Rule, whitespace string) *r.Rule {
+	if prod.String != whitespace || prod.Childs == nil || len(*prod.Childs) != 1 || (*prod.Childs)[0].Operator != r.Repeat {
+		return nil
+	}
+	return (*prod.Childs)[0]
+}
+
+// timesBounds returns the counts of a Times rule; to is -1 for "unbounded".
+// ok is false when a count is only known at parse time (:number()).
+func timesBounds(rule *r.Rule) (from, to int, ok bool) {
+	if rule.CodeChilds == nil || len(*rule.CodeChilds) == 0 || (*rule.CodeChilds)[0].Operator != r.Number {
+		return 0, 0, false
+	}
+	from, to = (*rule.CodeChilds)[0].Int, (*rule.CodeChilds)[0].Int
+	if len(*rule.CodeChilds) > 1 {
+		switch p := (*rule.CodeChilds)[1]; p.Operator {
+		case r.Number:
+			to = p.Int
+		case r.Token:
+			to = -1
+		default:
+			return 0, 0, false
+		}
+	}
+	return from, to, true
+}
+
+// charSetOf returns the chars a single-char rule matches (a one-char Token or a
+// rune CharOf), for the Not merge.
+func charSetOf(rule *r.Rule) (string, bool) {
+	switch rule.Operator {
+	case r.Token:
+		if utf8.RuneCountInString(rule.String) == 1 {
+			return rule.String, true
+		}
+	case r.CharOf:
+		if rule.Int == r.CharTypeRune {
+			return rule.String, true
+		}
+	case r.Or:
+		set := ""
+		for _, alt := range *rule.Childs {
+			s, ok := charSetOf(alt)
+			if !ok {
+				return "", false
+			}
+			set += s
+		}
+		return set, true
+	case r.Sequence, r.Group:
+		if len(*rule.Childs) == 1 {
+			return charSetOf((*rule.Childs)[0])
+		}
+	}
+	return "", false
+}
+
+// singleChar reports whether rule always reads exactly one char.
+func singleChar(rule *r.Rule) bool {
+	if rule.Operator == r.Range {
+		return true
+	}
+	_, ok := charSetOf(rule)
+	return ok || (rule.Operator == r.CharOf && rule.Int&r.CharTypeByte == 0)
+}
+
+// mergeNot folds a negative lookahead into the negated char class behind it:
+// !"a" @"b" (not a, then any char except b) is the char class "any char except
+// a and b". It returns nil when the pair does not have that form.
+func mergeNot(not, next *r.Rule) *r.Rule {
+	if next.Operator != r.CharOf || next.Int != r.CharTypeNegated || not.Childs == nil || len(*not.Childs) != 1 {
+		return nil
+	}
+	set, ok := charSetOf((*not.Childs)[0])
+	if !ok {
+		return nil
+	}
+	for _, c := range set {
+		if !strings.ContainsRune(next.String, c) {
+			next = &r.Rule{Operator: r.CharOf, Int: r.CharTypeNegated, String: next.String + string(c)}
+		}
+	}
+	return next
+}
+
+// rangeBounds returns the bounds of a Range rule as runes (bytes are mapped to
+// the runes with the same number); ok is false for malformed bounds.
+func rangeBounds(rule *r.Rule) (from, to rune, ok bool) {
+	if rule.CodeChilds == nil || len(*rule.CodeChilds) != 2 {
+		return 0, 0, false
+	}
+	a, b := (*rule.CodeChilds)[0].String, (*rule.CodeChilds)[1].String
+	if rule.Int == r.RangeTypeByte {
+		if len(a) != 1 || len(b) != 1 {
+			return 0, 0, false
+		}
+		return rune(a[0]), rune(b[0]), true
+	}
+	from, _ = utf8.DecodeRuneInString(a)
+	to, _ = utf8.DecodeRuneInString(b)
+	return from, to, a != "" && b != ""
+}
+
+// exportComment makes text safe for a /* */ comment, on one line.
+func exportComment(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return "/* " + strings.ReplaceAll(text, "*/", "* /") + " */"
+}
+
+// tagComment is the comment that keeps the code of a Tag.
+func tagComment(rule *r.Rule) string {
+	return exportComment("tag: " + compactCode(rule.CodeChilds))
+}
+
+// unsupported is the comment for a rule the target cannot express.
+func unsupported(rule *r.Rule) string {
+	if rule.Operator == r.Command {
+		return exportComment("unsupported: " + commandLabel(rule))
+	}
+	return exportComment("unsupported: " + covLabel(rule))
+}
+
+// commandLabel writes an inline command the way the grammar does, with the
+// code of a :script() left out.
+func commandLabel(rule *r.Rule) string {
+	var params []string
+	if rule.CodeChilds != nil && rule.String != "script" {
+		for _, p := range *rule.CodeChilds {
+			switch p.Operator {
+			case r.Identifier:
+				params = append(params, p.String)
+			case r.Token:
+				params = append(params, clip(strconv.Quote(p.String), 20))
+			case r.Number:
+				params = append(params, strconv.Itoa(p.Int))
+			default:
+				params = append(params, "...")
+			}
+		}
+	} else if rule.CodeChilds != nil && len(*rule.CodeChilds) > 0 {
+		params = []string{"..."}
+	}
+	return ":" + rule.String + "(" + strings.Join(params, ", ") + ")"
+}
+
+// ----------------------------------------------------------------------------
+// ANTLR4 and W3C EBNF share the operator syntax ("a b", "a | b", "a?", "a*",
+// "a+" and parentheses); the dialect supplies the terminals.
+
+type ebnfDialect struct {
+	token     func(s string) (string, int)          // A literal and its precedence (several pieces are a sequence).
+	ident     func(name string) string              // A production reference.
+	charClass func(set string, negated bool) string // One char out of set (or, negated, any other char).
+	charRange func(from, to rune) string            // One char out of from...to.
+	not       func(not, next *r.Rule) string        // A Not that did not merge; "" to fall back to a comment.
+	command   func(rule *r.Rule) (string, bool)     // An inline command; false when it is left out entirely.
+}
+
+// The precedences of an expression: what it may be used in without parentheses.
+const (
+	precAlt  = iota // a | b
+	precSeq         // a b
+	precAtom        // a, (a), a?
+)
+
+func (d *ebnfDialect) paren(s string, prec, min int) string {
+	if prec < min {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// seq prints a rule list as a sequence.
+func (d *ebnfDialect) seq(rules *r.Rules) (string, int) {
+	if rules == nil {
+		return "", precAtom
+	}
+	type item struct {
+		s string
+		p int
+	}
+	var items []item
+	comments := 0 // Comments are no items: a lone item keeps its precedence.
+	for i := 0; i < len(*rules); i++ {
+		rule := (*rules)[i]
+		var s string
+		p := precAtom
+		if rule.Operator == r.Not && i+1 < len(*rules) {
+			if merged := mergeNot(rule, (*rules)[i+1]); merged != nil {
+				s, p = d.expr(merged)
+				i++
+			} else if s = d.not(rule, (*rules)[i+1]); s != "" {
+				i++
+			}
+		}
+		if s == "" {
+			s, p = d.expr(rule)
+		}
+		if s == "" {
+			continue
+		}
+		if isComment(s) {
+			comments++
+		}
+		items = append(items, item{s, p})
+	}
+	if len(items) == 0 {
+		return "", precAtom
+	}
+	prec := precAtom
+	if len(items)-comments > 1 {
+		prec = precSeq
+	}
+	parts := make([]string, len(items))
+	for i, it := range items {
+		if prec == precSeq {
+			parts[i] = d.paren(it.s, it.p, precSeq)
+		} else {
+			parts[i] = it.s
+			if !isComment(it.s) {
+				prec = it.p
+			}
+		}
+	}
+	return strings.Join(parts, " "), prec
+}
+
+// isComment reports whether s is nothing but one exportComment().
+func isComment(s string) bool {
+	return strings.HasPrefix(s, "/*") && strings.HasSuffix(s, "*/") && strings.Count(s, "/*") == 1
+}
+
+func (d *ebnfDialect) postfix(rules *r.Rules, op string) string {
+	s, p := d.seq(rules)
+	if s == "" {
+		return ""
+	}
+	return d.paren(s, p, precAtom) + op
+}
+
+func (d *ebnfDialect) expr(rule *r.Rule) (string, int) {
+	switch rule.Operator {
+	case r.Sequence, r.Group:
+		return d.seq(rule.Childs)
+	case r.Or:
+		var alts []string
+		for _, alt := range *rule.Childs {
+			s, p := d.expr(alt)
+			alts = append(alts, d.paren(s, p, precSeq))
+		}
+		if len(alts) == 1 {
+			return d.expr((*rule.Childs)[0])
+		}
+		return strings.Join(alts, " | "), precAlt
+	case r.Optional:
+		return d.postfix(rule.Childs, "?"), precAtom
+	case r.Repeat:
+		return d.postfix(rule.Childs, "*"), precAtom
+	case r.Times:
+		from, to, ok := timesBounds(rule)
+		if !ok {
+			return unsupported(rule), precAtom
+		}
+		s, p := d.seq(rule.Childs)
+		if s == "" {
+			return "", precAtom
+		}
+		item := d.paren(s, p, precAtom)
+		var parts []string
+		note := ""
+		if from > exportMaxTimes || (to > exportMaxTimes && to != from) {
+			note = " " + exportComment("Times "+strconv.Itoa(from)+"..."+strconv.Itoa(to)+" approximated")
+			if from > exportMaxTimes {
+				from = exportMaxTimes
+			}
+			to = -1
+		}
+		for i := 0; i < from; i++ {
+			parts = append(parts, item)
+		}
+		switch {
+		case to < 0:
+			parts = append(parts, item+"*")
+		case to > from:
+			tail := item + "?"
+			for i := to - from - 1; i > 0; i-- {
+				tail = "(" + item + " " + tail + ")?"
+			}
+			parts = append(parts, tail)
+		}
+		if len(parts) == 0 {
+			return "", precAtom
+		}
+		if len(parts) == 1 {
+			return parts[0] + note, precAtom
+		}
+		return strings.Join(parts, " ") + note, precSeq
+	case r.Token:
+		if rule.String == "" {
+			return "", precAtom
+		}
+		return d.token(rule.String)
+	case r.Identifier:
+		return d.ident(rule.String), precAtom
+	case r.Range:
+		from, to, ok := rangeBounds(rule)
+		if !ok {
+			return unsupported(rule), precAtom
+		}
+		return d.charRange(from, to), precAtom
+	case r.CharOf, r.CharsOf:
+		if rule.Int&r.CharTypeByte != 0 && strings.IndexFunc(rule.String, func(c rune) bool { return c >= utf8.RuneSelf }) >= 0 {
+			return unsupported(rule), precAtom
+		}
+		s := d.charClass(rule.String, rule.Int&r.CharTypeNegated != 0)
+		if rule.Operator == r.CharsOf {
+			return s + "+", precSeq // Not an atom: "[a]+*" is no valid postfix chain.
+		}
+		return s, precAtom
+	case r.Not:
+		if s := d.not(rule, nil); s != "" {
+			return s, precAtom
+		}
+		return unsupported(rule), precAtom
+	case r.Tag:
+		s, p := d.seq(rule.Childs)
+		if s == "" {
+			return tagComment(rule), precAtom
+		}
+		return s + " " + tagComment(rule), p
+	case r.Command:
+		if s, ok := d.command(rule); ok {
+			return s, precAtom
+		}
+		return "", precAtom
+	}
+	return unsupported(rule), precAtom
+}
+
+// commandComment is the default for inline commands: :whitespace() becomes a
+// comment, everything else is unsupported.
+func commandComment(rule *r.Rule) (string, bool) {
+	if rule.String == "whitespace" {
+		return exportComment(commandLabel(rule)), true
+	}
+	return unsupported(rule), true
+}
+
+// ----------------------------------------------------------------------------
+// ANTLR4
+
+var antlrKeywords = map[string]bool{
+	"grammar": true, "options": true, "tokens": true, "channels": true, "import": true, "fragment": true,
+	"lexer": true, "parser": true, "mode": true, "returns": true, "locals": true, "throws": true,
+	"catch": true, "finally": true, "EOF": true,
+	// The names the generated code cannot use (the Java target, which is the
+	// strictest of the usual ones).
+	"abstract": true, "assert": true, "boolean": true, "break": true, "byte": true, "case": true,
+	"char": true, "class": true, "const": true, "continue": true, "default": true, "do": true,
+	"double": true, "else": true, "enum": true, "extends": true, "final": true, "float": true,
+	"for": true, "goto": true, "if": true, "implements": true, "instanceof": true, "int": true,
+	"interface": true, "long": true, "native": true, "new": true, "package": true, "private": true,
+	"protected": true, "public": true, "return": true, "short": true, "static": true, "super": true,
+	"switch": true, "synchronized": true, "this": true, "throw": true, "transient": true, "try": true,
+	"void": true, "volatile": true, "while": true, "true": true, "false": true, "null": true,
+}
+
+func antlrEscape(c rune, inSet bool) string {
+	switch c {
+	case '\\':
+		return `\\`
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '\t':
+		return `\t`
+	case '\'':
+		if !inSet {
+			return `\'`
+		}
+	case ']', '-':
+		if inSet {
+			return `\` + string(c)
+		}
+	}
+	if c < 0x20 || c == 0x7f || !unicode.IsPrint(c) {
+		if c > 0xffff {
+			return fmt.Sprintf(`\u{%X}`, c)
+		}
+		return fmt.Sprintf(`\u%04X`, c)
+	}
+	return string(c)
+}
+
+func antlrSet(set string, negated bool) string {
+	var b strings.Builder
+	if negated {
+		b.WriteByte('~')
+	}
+	b.WriteByte('[')
+	for _, c := range set {
+		b.WriteString(antlrEscape(c, true))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+func (ex *exporter) antlr(name string) string {
+	// The names: parser rules start lower case, lexer rules upper case.
+	names := map[string]string{}
+	used := map[string]bool{}
+	unique := func(s string) string {
+		for used[s] || antlrKeywords[s] {
+			s += "_"
+		}
+		used[s] = true
+		return s
+	}
+	lexer := map[string]bool{}
+	for _, prod := range ex.prods {
+		if ex.lexical[prod.String] && ex.onlyLexical(prod.String, map[string]bool{}) {
+			lexer[prod.String] = true
+		}
+	}
+	for _, prod := range ex.prods {
+		c, size := utf8.DecodeRuneInString(prod.String)
+		if lexer[prod.String] {
+			names[prod.String] = unique(string(unicode.ToUpper(c)) + prod.String[size:])
+		} else {
+			names[prod.String] = unique(string(unicode.ToLower(c)) + prod.String[size:])
+		}
+	}
+
+	// The char classes inside parser rules become tokens of their own.
+	var synthetic []string
+	syntheticNames := map[string]string{}
+	inParser := true
+	class := func(s string) string {
+		if !inParser {
+			return s
+		}
+		if n, ok := syntheticNames[s]; ok {
+			return n
+		}
+		n := unique("CHARS_" + strconv.Itoa(len(synthetic)+1))
+		syntheticNames[s] = n
+		synthetic = append(synthetic, n+" : "+s+" ;")
+		return n
+	}
+	// Which lexer rules the parser rules use: the others become fragments.
+	usedByParser := map[string]bool{ex.whitespace: true}
+
+	d := &ebnfDialect{
+		token: func(s string) (string, int) {
+			var b strings.Builder
+			b.WriteByte('\'')
+			for _, c := range s {
+				b.WriteString(antlrEscape(c, false))
+			}
+			b.WriteByte('\'')
+			return b.String(), precAtom
+		},
+		ident: func(name string) string {
+			if !inParser && ex.predicate[name] {
+				return exportComment("unsupported: " + name + ", a :script() check")
+			}
+			if n, ok := names[name]; ok {
+				if inParser && lexer[name] {
+					usedByParser[name] = true
+				}
+				return n
+			}
+			return exportComment("undefined: "+name) + " " + name
+		},
+		charClass: func(set string, negated bool) string { return class(antlrSet(set, negated)) },
+		charRange: func(from, to rune) string {
+			return class("[" + antlrEscape(from, true) + "-" + antlrEscape(to, true) + "]")
+		},
+		not: func(not, next *r.Rule) string { return "" },
+		command: func(rule *r.Rule) (string, bool) {
+			if rule.String == "whitespace" && !inParser {
+				return "", false // A lexer rule never skips whitespace anyway.
+			}
+			return commandComment(rule)
+		},
+	}
+
+	var parserRules []string
+	var lexerRules []*r.Rule
+	lexerText := map[*r.Rule]string{} // Written last, when the fragments are known.
+	for _, prod := range ex.prods {
+		inParser = !lexer[prod.String]
+		body, _ := d.seq(prod.Childs)
+		if rep := skippedRepeat(prod, ex.whitespace); rep != nil {
+			body = d.postfix(rep.Childs, "+")
+		}
+		rule := names[prod.String] + "\n    : " + body + "\n    ;\n"
+		if inParser {
+			parserRules = append(parserRules, rule)
+		} else {
+			lexerRules = append(lexerRules, prod)
+			lexerText[prod] = rule
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Exported from an a-grammar by mec -export antlr.\n")
+	fmt.Fprintf(&b, "// The a-grammar is a PEG: its alternatives are ordered and ANTLR's are not. Check the choices that rely on their order.\n")
+	for _, note := range ex.notes {
+		fmt.Fprintf(&b, "// %s\n", note)
+	}
+	fmt.Fprintf(&b, "\ngrammar %s;\n\n", name)
+	if ex.start != "" {
+		if n, ok := names[ex.start]; ok {
+			// The entry rule of an ANTLR grammar has to consume the whole input.
+			fmt.Fprintf(&b, "%s\n    : %s EOF\n    ;\n\n", unique("start_"), n)
+		}
+	}
+	for _, rule := range parserRules {
+		b.WriteString(rule + "\n")
+	}
+	for _, prod := range lexerRules {
+		rule := lexerText[prod]
+		switch {
+		case prod.String == ex.whitespace:
+			rule = strings.TrimSuffix(rule, "\n    ;\n") + " -> skip\n    ;\n"
+		case !usedByParser[prod.String]:
+			rule = "fragment " + rule
+		}
+		b.WriteString(rule + "\n")
+	}
+	for _, rule := range synthetic {
+		b.WriteString(rule + "\n")
+	}
+	return b.String()
+}
+
+// ----------------------------------------------------------------------------
+// W3C EBNF
+
+// w3cChar writes c for a char class: plain when it is safe, as #xN otherwise.
+func w3cChar(c rune) string {
+	if c < utf8.RuneSelf && (unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("!\"$%&'()*+,./:;<=>?@_`{|}~", c)) {
+		return string(c)
+	}
+	if c >= utf8.RuneSelf && unicode.IsPrint(c) && !unicode.IsSpace(c) {
+		return string(c)
+	}
+	return fmt.Sprintf("#x%X", c)
+}
+
+func (ex *exporter) ebnf() string {
+	d := &ebnfDialect{
+		token: func(s string) (string, int) {
+			// A literal has no escapes: control chars are #xN of their own, and the
+			// quote is the one the text does not contain.
+			var parts []string
+			lit := ""
+			flush := func() {
+				if lit == "" {
+					return
+				}
+				q := `"`
+				if strings.Contains(lit, `"`) {
+					q = "'"
+				}
+				if strings.Contains(lit, `"`) && strings.Contains(lit, "'") {
+					for _, c := range lit {
+						parts = append(parts, fmt.Sprintf("#x%X", c))
+					}
+				} else {
+					parts = append(parts, q+lit+q)
+				}
+				lit = ""
+			}
+			for _, c := range s {
+				if c < 0x20 || c == 0x7f || !unicode.IsPrint(c) {
+					flush()
+					parts = append(parts, fmt.Sprintf("#x%X", c))
+				} else {
+					lit += string(c)
+				}
+			}
+			flush()
+			if len(parts) == 1 {
+				return parts[0], precAtom
+			}
+			return strings.Join(parts, " "), precSeq
+		},
+		ident: func(name string) string { return name },
+		charClass: func(set string, negated bool) string {
+			var b strings.Builder
+			b.WriteByte('[')
+			if negated {
+				b.WriteByte('^')
+			}
+			for _, c := range set {
+				b.WriteString(w3cChar(c))
+			}
+			b.WriteByte(']')
+			return b.String()
+		},
+		charRange: func(from, to rune) string { return "[" + w3cChar(from) + "-" + w3cChar(to) + "]" },
+		command:   commandComment,
+	}
+	d.not = func(not, next *r.Rule) string {
+		// "!A B" is "B, but not A". That is the difference B - A only when both
+		// read exactly one char: a longer A ("!"if" Id") rejects every B that
+		// merely STARTS with it, which no difference can say.
+		if next == nil || not.Childs == nil || len(*not.Childs) != 1 || !singleChar(next) || !singleChar((*not.Childs)[0]) {
+			return ""
+		}
+		a, ap := d.expr((*not.Childs)[0])
+		b, bp := d.expr(next)
+		if a == "" || b == "" || isComment(a) || isComment(b) {
+			return ""
+		}
+		return "(" + d.paren(b, bp, precAtom) + " - " + d.paren(a, ap, precAtom) + ")"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "/* Exported from an a-grammar by mec -export ebnf (W3C EBNF, the notation of the XML specification). */\n")
+	if ex.start != "" {
+		fmt.Fprintf(&b, "/* The start production is %s. */\n", ex.start)
+	}
+	if ex.whitespace != "" {
+		fmt.Fprintf(&b, "/* %s is skipped in front of every terminal, except inside productions with :whitespace(). */\n", ex.whitespace)
+	}
+	for _, note := range ex.notes {
+		fmt.Fprintf(&b, "%s\n", exportComment(note))
+	}
+	width := 0
+	for _, prod := range ex.prods {
+		if n := utf8.RuneCountInString(prod.String); n > width && n <= 24 {
+			width = n
+		}
+	}
+	for _, prod := range ex.prods {
+		body, _ := d.seq(prod.Childs)
+		fmt.Fprintf(&b, "\n%-*s ::= %s", width, prod.String, body)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// ----------------------------------------------------------------------------
+// tree-sitter
+
+func jsString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteString(jsStringChar(c))
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func jsStringChar(c rune) string {
+	switch {
+	case c < 0x20 || c == 0x7f:
+		return fmt.Sprintf(`\x%02X`, c)
+	case !unicode.IsPrint(c) && c <= 0xffff:
+		return fmt.Sprintf(`\u%04X`, c)
+	case !unicode.IsPrint(c):
+		return fmt.Sprintf(`\u{%X}`, c)
+	}
+	return string(c)
+}
+
+// regexChar writes c inside a regex char class.
+func regexChar(c rune) string {
+	if strings.ContainsRune(`\]^-[/`, c) {
+		return `\` + string(c)
+	}
+	return jsStringChar(c)
+}
+
+type treeSitter struct {
+	ex      *exporter
+	inToken map[string]bool // The productions being inlined into the current token() (recursion guard).
+	token   bool            // Inside a token(): productions are inlined.
+}
+
+func tsCall(fn string, args []string) string {
+	if len(args) == 1 && fn != "token" && fn != "optional" && fn != "repeat" && fn != "repeat1" {
+		return args[0]
+	}
+	return fn + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (ts *treeSitter) seq(rules *r.Rules) string {
+	var parts []string
+	comments := ""
+	if rules != nil {
+		for i := 0; i < len(*rules); i++ {
+			rule := (*rules)[i]
+			if rule.Operator == r.Not && i+1 < len(*rules) {
+				if merged := mergeNot(rule, (*rules)[i+1]); merged != nil {
+					rule = merged
+					i++
+				}
+			}
+			s := ts.expr(rule)
+			if isComment(s) {
+				comments += s + " " // A comment alone is no argument.
+				continue
+			}
+			if s != "" {
+				parts = append(parts, comments+s)
+				comments = ""
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return comments + "blank()"
+	}
+	if comments != "" {
+		parts[len(parts)-1] += " " + strings.TrimSpace(comments)
+	}
+	return tsCall("seq", parts)
+}
+
+// class writes a regex of one char class. It is a unicode regex: the a-grammar
+// reads runes, and the \u{...} escapes above 0xFFFF need the flag.
+func (ts *treeSitter) class(body string, many bool) string {
+	if many {
+		body += "+"
+	}
+	return "/" + body + "/u"
+}
+
+func (ts *treeSitter) expr(rule *r.Rule) string {
+	switch rule.Operator {
+	case r.Sequence, r.Group:
+		return ts.seq(rule.Childs)
+	case r.Or:
+		var alts []string
+		for _, alt := range *rule.Childs {
+			alts = append(alts, ts.expr(alt))
+		}
+		return tsCall("choice", alts)
+	case r.Optional:
+		return "optional(" + ts.seq(rule.Childs) + ")"
+	case r.Repeat:
+		return "repeat(" + ts.seq(rule.Childs) + ")"
+	case r.Times:
+		from, to, ok := timesBounds(rule)
+		if !ok {
+			return unsupported(rule)
+		}
+		item := ts.seq(rule.Childs)
+		var parts []string
+		if from > exportMaxTimes || (to > exportMaxTimes && to != from) {
+			parts = append(parts, exportComment("Times "+strconv.Itoa(from)+"..."+strconv.Itoa(to)+" approximated"))
+			if from > exportMaxTimes {
+				from = exportMaxTimes
+			}
+			to = -1
+		}
+		for i := 0; i < from; i++ {
+			parts = append(parts, item)
+		}
+		switch {
+		case to < 0:
+			parts = append(parts, "repeat("+item+")")
+		case to > from:
+			tail := "optional(" + item + ")"
+			for i := to - from - 1; i > 0; i-- {
+				tail = "optional(seq(" + item + ", " + tail + "))"
+			}
+			parts = append(parts, tail)
+		}
+		if len(parts) == 0 {
+			return "blank()"
+		}
+		if strings.HasPrefix(parts[0], "/*") {
+			if len(parts) == 1 {
+				return parts[0] + " blank()"
+			}
+			parts[1] = parts[0] + " " + parts[1]
+			parts = parts[1:]
+		}
+		return tsCall("seq", parts)
+	case r.Token:
+		if rule.String == "" {
+			return "blank()"
+		}
+		return jsString(rule.String)
+	case r.Identifier:
+		if !ts.token {
+			return "$." + rule.String
+		}
+		prod := ts.ex.byName[rule.String]
+		if prod == nil || ts.inToken[rule.String] {
+			return exportComment("unsupported: recursive "+rule.String+" inside token()") + " blank()"
+		}
+		ts.inToken[rule.String] = true
+		s := ts.seq(prod.Childs)
+		delete(ts.inToken, rule.String)
+		return s
+	case r.Range:
+		from, to, ok := rangeBounds(rule)
+		if !ok {
+			return unsupported(rule) + " blank()"
+		}
+		return ts.class("["+regexChar(from)+"-"+regexChar(to)+"]", false)
+	case r.CharOf, r.CharsOf:
+		var b strings.Builder
+		b.WriteByte('[')
+		if rule.Int&r.CharTypeNegated != 0 {
+			b.WriteByte('^')
+		}
+		for _, c := range rule.String {
+			b.WriteString(regexChar(c))
+		}
+		b.WriteByte(']')
+		return ts.class(b.String(), rule.Operator == r.CharsOf)
+	case r.Tag:
+		return ts.seq(rule.Childs) + " " + tagComment(rule)
+	case r.Command:
+		if rule.String == "whitespace" && ts.token {
+			return "" // token() never skips the extras.
+		}
+		s, _ := commandComment(rule)
+		return s
+	}
+	return unsupported(rule)
+}
+
+func (ex *exporter) treeSitter(name string) string {
+	ts := &treeSitter{ex: ex, inToken: map[string]bool{}}
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Exported from an a-grammar by mec -export tree-sitter.\n")
+	fmt.Fprintf(&b, "// The a-grammar is a PEG: its alternatives are ordered and tree-sitter's are not. Check the choices that rely on their order.\n")
+	for _, note := range ex.notes {
+		fmt.Fprintf(&b, "// %s\n", note)
+	}
+	fmt.Fprintf(&b, "\nmodule.exports = grammar({\n  name: %s,\n\n", jsString(name))
+	if ex.whitespace != "" && ex.byName[ex.whitespace] != nil {
+		fmt.Fprintf(&b, "  extras: $ => [$.%s],\n\n", ex.whitespace)
+	} else {
+		fmt.Fprintf(&b, "  extras: $ => [],\n\n")
+	}
+	b.WriteString("  rules: {\n")
+	// tree-sitter starts with the first rule.
+	prods := append([]*r.Rule{}, ex.prods...)
+	sort.SliceStable(prods, func(i, j int) bool { return prods[i].String == ex.start && prods[j].String != ex.start })
+	for _, prod := range prods {
+		// A lexical production is one token: the productions it uses are inlined
+		// (a token() cannot refer to rules) as long as they are lexical, too.
+		ts.token = ex.lexical[prod.String] && ex.onlyLexical(prod.String, map[string]bool{})
+		ts.inToken[prod.String] = true
+		body := ts.seq(prod.Childs)
+		if rep := skippedRepeat(prod, ex.whitespace); rep != nil {
+			body = "repeat1(" + ts.seq(rep.Childs) + ")"
+		}
+		delete(ts.inToken, prod.String)
+		if ts.token {
+			body = "token(" + body + ")"
+		}
+		fmt.Fprintf(&b, "    %s: $ => %s,\n", prod.String, body)
+	}
+	b.WriteString("  },\n});\n")
+	return regexp.MustCompile(`(?m)[ \t]+$`).ReplaceAllString(b.String(), "")
+}
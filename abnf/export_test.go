@@ -0,0 +1,91 @@
+package abnf
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExportFormats pins the translations -export makes for the constructs no
+// target has: the whitespace production turns into the skipped token, a
+// production that switches whitespace off into a token of its own, a lookahead
+// in front of a negated char class into one class, and tags into comments. The
+// railroad diagrams only need to be well-formed SVG, one per production.
+func TestExportFormats(t *testing.T) {
+	dir := t.TempDir()
+	grammarFile := filepath.Join(dir, "g.abnf")
+	src := `:startRule(List) ;
+:whitespace(Space) ;
+List   = "(" [ Item { "," Item } ] ")" ;
+Item   = Name <~~ push(up.in) ~~> | Str ;
+Name   = "a"..."z" :whitespace() { "a"..."z" | "0"..."9" } :whitespace(Space) ;
+Str    = "'" :whitespace() { !"\\" !@"'" | "\\" "a"..."z" } "'" :whitespace(Space) ;
+Space  = { @+" \t\r\n" } ;
+`
+	if err := os.WriteFile(grammarFile, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	asg, err := ParseWithAgrammar(AbnfAgrammar, src, grammarFile, &Parseropts{PreventDefaultOutput: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := CompileASG(asg, AbnfAgrammar, grammarFile, 0, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := func(format string) string {
+		var out strings.Builder
+		if err := Export(format, g, "g-test", &out, ""); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	expect := func(format, out string, wants ...string) {
+		for _, want := range wants {
+			if !strings.Contains(out, want) {
+				t.Errorf("-export %s: missing %q in:\n%s", format, want, out)
+			}
+		}
+	}
+
+	expect("antlr", export("antlr"),
+		"grammar GTest;",
+		"start_\n    : list EOF",
+		"list\n    : '(' (item (',' item)*)? ')'",
+		"item\n    : Name /* tag: push(up.in) */ | Str",
+		"Name\n    : [a-z] ([a-z] | [0-9])*",
+		`~['\\]`, // The lookahead merged into the class.
+		"Space\n    : ([ \\t\\r\\n]+)+ -> skip")
+	expect("ebnf", export("ebnf"),
+		"List  ::= \"(\" (Item (\",\" Item)*)? \")\"",
+		"[^'#x5C]")
+	expect("tree-sitter", export("tree-sitter"),
+		`name: "g_test"`,
+		"extras: $ => [$.Space]",
+		"List: $ => seq(",
+		"Name: $ => token(seq(/[a-z]/u",
+		"Space: $ => token(repeat1(")
+
+	svgDir := filepath.Join(dir, "railroad")
+	if err := Export("railroad", g, "g-test", nil, svgDir); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(svgDir, "*.svg"))
+	if len(files) != 5 {
+		t.Fatalf("railroad: got %d files, want one per production (5): %v", len(files), files)
+	}
+	for _, file := range files {
+		dat, _ := os.ReadFile(file)
+		dec := xml.NewDecoder(strings.NewReader(string(dat)))
+		for {
+			if _, err := dec.Token(); err != nil {
+				if err.Error() != "EOF" {
+					t.Fatalf("railroad: %s is no well-formed XML: %v", file, err)
+				}
+				break
+			}
+		}
+	}
+}
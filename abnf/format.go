@@ -0,0 +1,537 @@
+package abnf
+
+// Formatting annotated EBNF source: what mec -fmt writes. The layout is
+// canonical, a function of the tokens and the comments alone:
+//
+//	Name        = Alt1 | Alt2 ;          a production that fits in formatWidth
+//	Longer      = Alt1                   one that does not, or that spans lines
+//	            | Alt2 ;                 (a tag with line ends in its code): one
+//	            | Alt3 Alt3 Alt3         alternative per line, the | under the =,
+//	              Alt3 Alt3 ;            and an alternative that is still too
+//	                                     long goes on below it
+//	Tagged      <~~ code ~~>             a tag on the name puts the = on the
+//	            = Alt1 ;                 next line
+//	:command(A, "b") ;
+//
+// Names are padded to formatNameWidth; a longer one is followed by one space.
+// Tokens are separated by one space, except that the char set operators
+// (@"ab", !@+"x") and the negative lookahead (!"x") stick to their token,
+// ranges and counts to their bounds ("a"..."z", 2...4 ( X )), and the parens,
+// commas and tag brackets to what they enclose (:whitespace(Ws), <~~ code ~~>).
+// A long alternative is broken in front of a term or a |, never in front of a
+// tag: the term, its tag and whatever else cannot be broken from them go on the
+// next line together when they do not fit, and a tag with line ends in its code
+// always starts its term on a new line. A run that cannot be broken at all may
+// still make a line longer than formatWidth.
+//
+// The tokens, the tag code and the comments are copied verbatim. A comment of
+// its own line stays in front of what follows it, a comment behind a token
+// stays there; only the comments inside the head of a production (name, tag,
+// =) and inside a line command go in front of it. The empty lines between the
+// statements and the comments are kept as they are.
+//
+// The source is only ever re-spaced, so compiling the formatted text yields the
+// same a-grammar; FormatGrammar checks that before it returns anything.
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf/r"
+)
+
+const (
+	formatWidth     = 100 // The line width past which a production is broken up.
+	formatNameWidth = 11  // The width production names are padded to.
+)
+
+// FormatGrammar writes the source of an annotated EBNF grammar in the canonical
+// layout. Both the source and the result must compile, to the same a-grammar up
+// to the source positions.
+func (s *Session) FormatGrammar(src, fileName string) (string, error) {
+	before, err := s.compileSource(src, fileName)
+	if err != nil {
+		return "", err
+	}
+	out, err := formatGrammar(src)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", fileName, err)
+	}
+	after, err := s.compileSource(out, fileName)
+	if err != nil || after.Serialize() != before.Serialize() {
+		return "", fmt.Errorf("%s: the formatted text does not compile to the same a-grammar (a bug of the formatter); the grammar is left as it is", fileName)
+	}
+	return out, nil
+}
+
+// compileSource compiles src with the built-in a-grammar, bypassing the grammar
+// cache: a formatted text is not worth keeping.
+func (s *Session) compileSource(src, fileName string) (*r.Rules, error) {
+	opts := &Parseropts{PreventDefaultOutput: true}
+	asg, err := s.parse(AbnfAgrammar, src, fileName, opts)
+	if err != nil {
+		return nil, err
+	}
+	grammar, err := s.compile(asg, AbnfAgrammar, fileName, 0, false, true)
+	if err == nil && grammar == nil {
+		err = fmt.Errorf("%s did not compile to an a-grammar", fileName)
+	}
+	return grammar, err
+}
+
+type fmtKind int
+
+const (
+	fmtName   fmtKind = iota // A production or command name.
+	fmtNumber                // A count of Times or a command parameter.
+	fmtToken                 // A quoted token or ~~code~~.
+	fmtPunct                 // An operator: = ; | ( ) [ ] { } < > , : ... ..b and the @ ! family.
+)
+
+type fmtComment struct {
+	text   string
+	blanks int // The empty lines in front of it.
+}
+
+type fmtTok struct {
+	kind   fmtKind
+	text   string
+	lead   []fmtComment // The comments on the lines in front of the token.
+	trail  []string     // The comments behind it on its line.
+	blanks int          // The empty lines in front of it (behind its lead comments).
+	cmd    bool         // The parens of a command: :name(...).
+}
+
+func (t *fmtTok) is(op string) bool { return t.kind == fmtPunct && t.text == op }
+
+// fmtOps are the operators, the longer of two with the same prefix first.
+var fmtOps = []string{"...", "..b", "!@b+", "!@b", "!@+", "!@", "!", "@b+", "@b", "@+", "@",
+	"=", ";", "|", "(", ")", "[", "]", "{", "}", "<", ">", ",", ":"}
+
+// lexGrammar splits annotated EBNF source into its tokens, the comments
+// attached to them, and the comments behind the last one.
+func lexGrammar(src string) (toks []*fmtTok, tail []fmtComment, err error) {
+	newlines := 0     // Line ends since the last token or comment.
+	afterTok := false // No line end since the last token: a comment here trails it.
+	var lead []fmtComment
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			newlines++
+			afterTok = false
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			continue
+		case strings.HasPrefix(src[i:], "//"), strings.HasPrefix(src[i:], "/*"):
+			end := len(src)
+			if src[i+1] == '/' {
+				if nl := strings.IndexByte(src[i:], '\n'); nl >= 0 {
+					end = i + nl
+				}
+			} else if close := strings.Index(src[i+2:], "*/"); close >= 0 {
+				end = i + 2 + close + 2
+			} else {
+				return nil, nil, fmt.Errorf("%s: unterminated comment", lineOf(src, i))
+			}
+			text := strings.TrimRight(src[i:end], " \t\r")
+			if afterTok {
+				last := toks[len(toks)-1]
+				last.trail = append(last.trail, text)
+			} else {
+				lead = append(lead, fmtComment{text: text, blanks: blanks(newlines, len(toks) > 0 || len(lead) > 0)})
+			}
+			newlines = 0
+			i = end
+			continue
+		}
+		t := &fmtTok{lead: lead, blanks: blanks(newlines, len(toks) > 0 || len(lead) > 0)}
+		start := i
+		switch {
+		case c == '"' || c == '\'':
+			i++
+			for i < len(src) && src[i] != c {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(src) {
+				return nil, nil, fmt.Errorf("%s: unterminated token", lineOf(src, start))
+			}
+			i++
+			t.kind = fmtToken
+		case strings.HasPrefix(src[i:], "~~"):
+			close := strings.Index(src[i+2:], "~~")
+			if close < 0 {
+				return nil, nil, fmt.Errorf("%s: unterminated ~~code~~", lineOf(src, start))
+			}
+			i += 2 + close + 2
+			t.kind = fmtToken
+		case isLetter(c):
+			for i < len(src) && (isLetter(src[i]) || src[i] >= '0' && src[i] <= '9' || src[i] == '_') {
+				i++
+			}
+			t.kind = fmtName
+		case c == '0':
+			i++
+			t.kind = fmtNumber
+		case c >= '1' && c <= '9':
+			for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+				i++
+			}
+			t.kind = fmtNumber
+		default:
+			for _, op := range fmtOps {
+				if strings.HasPrefix(src[i:], op) {
+					i += len(op)
+					break
+				}
+			}
+			if i == start {
+				return nil, nil, fmt.Errorf("%s: unexpected %q", lineOf(src, start), c)
+			}
+			t.kind = fmtPunct
+		}
+		t.text = src[start:i]
+		toks = append(toks, t)
+		lead = nil
+		newlines = 0
+		afterTok = true
+	}
+	for i := 0; i+2 < len(toks); i++ {
+		if toks[i].is(":") && toks[i+2].is("(") {
+			toks[i+2].cmd = true
+			for j := i + 3; j < len(toks); j++ {
+				if toks[j].is(")") {
+					toks[j].cmd = true
+					break
+				}
+			}
+		}
+	}
+	return toks, lead, nil
+}
+
+// blanks is the number of empty lines in newlines line ends, none at the start
+// of the text.
+func blanks(newlines int, inside bool) int {
+	if !inside || newlines < 2 {
+		return 0
+	}
+	return newlines - 1
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+// lineOf names the line of a byte offset, for the errors of lexGrammar.
+func lineOf(src string, pos int) string {
+	return fmt.Sprintf("line %d", strings.Count(src[:pos], "\n")+1)
+}
+
+// fmtSpace is what separates two tokens on a line.
+func fmtSpace(prev, next *fmtTok) string {
+	switch {
+	case prev.is(":") || prev.is("<") || prev.cmd && prev.is("("):
+		return ""
+	case next.is(",") || next.is(">") || next.cmd:
+		return ""
+	case prev.kind == fmtPunct && (strings.HasPrefix(prev.text, "@") || strings.HasPrefix(prev.text, "!")):
+		return ""
+	case next.is("...") || next.is("..b"):
+		return ""
+	case (prev.is("...") || prev.is("..b")) && !next.is("("):
+		return ""
+	}
+	return " "
+}
+
+// fmtBreakable tells whether a long line may be broken between two tokens
+// with a space between them: in front of a term or a |, not in front of a tag
+// or a closing paren, not behind an opening one or a |.
+func fmtBreakable(prev, next *fmtTok) bool {
+	switch {
+	case next.is("<") || next.is(")") || next.is("]") || next.is("}") || next.is(";"):
+		return false
+	case prev.is("(") || prev.is("[") || prev.is("{") || prev.is("|"):
+		return false
+	}
+	return true
+}
+
+// fmtChunk is the width of what has to follow toks[i] on its line: the token
+// and the tokens behind it up to where the line may be broken next, and tail
+// when that is the end. A token with line ends counts as wider than any line.
+func fmtChunk(toks []*fmtTok, i, tail int) int {
+	n := 0
+	for j := i; ; j++ {
+		if strings.IndexByte(toks[j].text, '\n') >= 0 {
+			return n + formatWidth + 1
+		}
+		n += utf8.RuneCountInString(toks[j].text)
+		if j+1 == len(toks) {
+			return n + tail
+		}
+		next := toks[j+1]
+		space := fmtSpace(toks[j], next)
+		if len(toks[j].trail) > 0 || len(next.lead) > 0 || space != "" && fmtBreakable(toks[j], next) {
+			return n
+		}
+		n += len(space)
+	}
+}
+
+// fmtWriter lays out the tokens of a statement.
+type fmtWriter struct {
+	b      strings.Builder
+	indent string  // Where a broken line goes on.
+	col    int     // The runes on the current line.
+	limit  int     // Break a line before a run of tokens that would end past it (0: never).
+	tail   int     // The runes that follow the last token on its line.
+	prev   *fmtTok // The token before, nil at the start of a line.
+	broken bool    // A line comment ended the line.
+	spaced bool    // A block comment was written behind the token before.
+}
+
+func (w *fmtWriter) write(s string) {
+	w.b.WriteString(s)
+	if nl := strings.LastIndexByte(s, '\n'); nl >= 0 {
+		w.col = utf8.RuneCountInString(s[nl+1:])
+	} else {
+		w.col += utf8.RuneCountInString(s)
+	}
+}
+
+func (w *fmtWriter) newline() {
+	w.write("\n" + w.indent)
+	w.prev, w.broken, w.spaced = nil, false, false
+}
+
+// tokens writes toks, keeping their comments where they are.
+func (w *fmtWriter) tokens(toks []*fmtTok) {
+	for i, t := range toks {
+		for _, c := range t.lead {
+			if w.prev != nil || w.broken {
+				w.newline()
+			}
+			w.write(c.text)
+			w.broken = true
+		}
+		space := ""
+		switch {
+		case w.broken:
+			w.newline()
+		case w.spaced:
+			space = " "
+		case w.prev != nil:
+			space = fmtSpace(w.prev, t)
+		}
+		if space != "" && w.limit > 0 && fmtBreakable(w.prev, t) && w.col+1+fmtChunk(toks, i, w.tail) > w.limit {
+			w.newline()
+			space = ""
+		}
+		w.write(space + t.text)
+		w.prev, w.spaced = t, false
+		for _, c := range t.trail {
+			w.write(" " + c)
+			w.broken = strings.HasPrefix(c, "//")
+			w.spaced = !w.broken
+		}
+	}
+}
+
+// fmtStmt is a production or a line command, up to its ;.
+type fmtStmt struct {
+	toks []*fmtTok
+	head []fmtComment // The comments written in front of it.
+}
+
+// formatGrammar lays out the source of a grammar that compiles.
+func formatGrammar(src string) (string, error) {
+	toks, tail, err := lexGrammar(src)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	comments := func(cs []fmtComment) {
+		for _, c := range cs {
+			b.WriteString(strings.Repeat("\n", c.blanks))
+			b.WriteString(c.text + "\n")
+		}
+	}
+	from := 0
+	for i, t := range toks {
+		if !t.is(";") {
+			continue
+		}
+		st := &fmtStmt{toks: toks[from : i+1]}
+		from = i + 1
+		if err := st.hoist(); err != nil {
+			return "", err
+		}
+		comments(st.head)
+		b.WriteString(strings.Repeat("\n", st.toks[0].blanks))
+		if st.toks[0].kind == fmtName {
+			b.WriteString(st.production())
+		} else {
+			w := &fmtWriter{}
+			w.tokens(st.toks)
+			b.WriteString(w.b.String())
+		}
+		b.WriteString("\n")
+	}
+	if from < len(toks) {
+		return "", fmt.Errorf("the text ends inside a statement: %q", toks[from].text)
+	}
+	comments(tail)
+	return b.String(), nil
+}
+
+// hoist moves the comments that cannot stay where they are in front of the
+// statement: those of a line command but the ones behind its ;, and those in
+// the head of a production. The comments behind the last token of a production
+// move behind its ;.
+func (st *fmtStmt) hoist() error {
+	toks := st.toks
+	take := func(t *fmtTok, withTrail bool) {
+		st.head = append(st.head, t.lead...)
+		t.lead = nil
+		if withTrail {
+			for _, c := range t.trail {
+				st.head = append(st.head, fmtComment{text: c})
+			}
+			t.trail = nil
+		}
+	}
+	// The empty lines between the comments in front and the statement stay in
+	// front of the comments moved there.
+	own := len(toks[0].lead)
+	defer func() {
+		if len(st.head) > own && toks[0].blanks > 0 {
+			st.head[own].blanks, toks[0].blanks = toks[0].blanks, 0
+		}
+	}()
+	last := len(toks) - 1
+	if toks[0].kind != fmtName {
+		for i, t := range toks {
+			take(t, i < last)
+		}
+		return nil
+	}
+	eq := 1
+	if toks[1].is("<") {
+		for eq < last && !toks[eq].is(">") {
+			eq++
+		}
+		eq++
+	}
+	if !toks[eq].is("=") {
+		return fmt.Errorf("production %s: = expected, found %q", toks[0].text, toks[eq].text)
+	}
+	for _, t := range toks[:eq+1] {
+		take(t, true)
+	}
+	take(toks[eq+1], false) // The first token of the expression (or the ;).
+	if before := toks[last-1]; last-1 > eq {
+		toks[last].trail = append(before.trail, toks[last].trail...)
+		before.trail = nil
+	}
+	return nil
+}
+
+// production lays out a production.
+func (st *fmtStmt) production() string {
+	toks := st.toks
+	last := len(toks) - 1
+	eq := 1
+	for !toks[eq].is("=") {
+		eq++
+	}
+	pad := strings.Repeat(" ", formatNameWidth+1)
+	head := fmt.Sprintf("%-*s =", formatNameWidth, toks[0].text)
+	if eq > 1 {
+		w := &fmtWriter{}
+		w.tokens(toks[1:eq])
+		head = fmt.Sprintf("%-*s %s\n%s=", formatNameWidth, toks[0].text, w.b.String(), pad)
+	}
+	expr, semi := toks[eq+1:last], toks[last]
+	comment := "" // A comment behind the ; does not count for the width.
+	for _, c := range semi.trail {
+		comment += " " + c
+	}
+	if len(expr) == 0 {
+		return head + " ;" + comment
+	}
+
+	// The alternatives, split at the | outside of parens; a comment of a | goes
+	// in front of its alternative.
+	inner := false // A comment inside the expression.
+	for _, t := range expr {
+		inner = inner || len(t.lead) > 0 || len(t.trail) > 0
+	}
+	var alts [][]*fmtTok
+	var altHeads [][]fmtComment
+	var pending []fmtComment
+	depth, from := 0, 0
+	for i, t := range expr {
+		switch {
+		case t.is("(") || t.is("[") || t.is("{") || t.is("<"):
+			depth++
+		case t.is(")") || t.is("]") || t.is("}") || t.is(">"):
+			depth--
+		case t.is("|") && depth == 0:
+			alts = append(alts, expr[from:i])
+			altHeads = append(altHeads, pending)
+			pending = append([]fmtComment{}, t.lead...)
+			for _, c := range t.trail {
+				pending = append(pending, fmtComment{text: c})
+			}
+			from = i + 1
+			if from < len(expr) {
+				pending = append(pending, expr[from].lead...)
+				expr[from].lead = nil
+			}
+		}
+	}
+	alts = append(alts, expr[from:])
+	altHeads = append(altHeads, pending)
+
+	if !inner {
+		w := &fmtWriter{}
+		w.tokens(expr)
+		line := head + " " + w.b.String() + " ;"
+		if fits(line[strings.LastIndexByte(head, '\n')+1:]) {
+			return line + comment
+		}
+	}
+	var b strings.Builder
+	b.WriteString(head)
+	for i, alt := range alts {
+		if i > 0 {
+			for _, c := range altHeads[i] {
+				b.WriteString("\n" + pad + c.text)
+			}
+			b.WriteString("\n" + pad + "|")
+		}
+		w := &fmtWriter{indent: pad + "  ", col: len(pad) + 2, limit: formatWidth}
+		if i == 0 { // Behind the head, which a long name makes wider than pad.
+			w.col = utf8.RuneCountInString(head[strings.LastIndexByte(head, '\n')+1:]) + 1
+		}
+		if i == len(alts)-1 {
+			w.tail = len(" ;")
+		}
+		w.tokens(alt)
+		b.WriteString(" " + w.b.String())
+	}
+	b.WriteString(" ;" + comment)
+	return b.String()
+}
+
+// fits tells whether a production laid out on one line stays there: within
+// formatWidth, and without a token that has line ends.
+func fits(s string) bool {
+	return strings.IndexByte(s, '\n') < 0 && utf8.RuneCountInString(s) <= formatWidth
+}
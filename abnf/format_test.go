@@ -0,0 +1,112 @@
+package abnf
+
+import "testing"
+
+// TestFormatGrammar formats a grammar written in every style at once and
+// expects the canonical layout, the comments where they were, the same
+// a-grammar, and no change when the result is formatted again.
+func TestFormatGrammar(t *testing.T) {
+	src := `:startRule( List ) ;   :whitespace(Ws);
+
+
+// A list of items.
+List=Item{","Item}<~~ push(takeAll()) ~~>;
+Item   <~~ push(up.in) ~~>   =   Word|Number|Quoted|Other ;
+Word = @+ "abcdefghijklmnopqrstuvwxyz" | "a" ... "z" :whitespace( ) "'" ; // Trailing.
+Number=2 ... 4( "0"..b"9" ) ;
+Quoted = '"' !@+ '"' '"' |
+  /* Raw. */ 'r' ! "x" '"'  ;
+Other
+  = "alpha" Word "beta" Word "gamma" Word "delta" Word "epsilon" Word "zeta" Word "eta" Word "theta" Word | "iota" ;
+Ws = { @" \n" } ;
+// The end.
+`
+	want := `:startRule(List) ;
+:whitespace(Ws) ;
+
+
+// A list of items.
+List        = Item { "," Item } <~~ push(takeAll()) ~~> ;
+Item        <~~ push(up.in) ~~>
+            = Word | Number | Quoted | Other ;
+Word        = @+"abcdefghijklmnopqrstuvwxyz" | "a"..."z" :whitespace() "'" ; // Trailing.
+Number      = 2...4 ( "0"..b"9" ) ;
+Quoted      = '"' !@+'"' '"'
+            /* Raw. */
+            | 'r' !"x" '"' ;
+Other       = "alpha" Word "beta" Word "gamma" Word "delta" Word "epsilon" Word "zeta" Word "eta"
+              Word "theta" Word
+            | "iota" ;
+Ws          = { @" \n" } ;
+// The end.
+`
+	s := NewEngine().NewSession(nil, nil)
+	got, err := s.FormatGrammar(src, "messy.abnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("formatted:\n%s\nwant:\n%s", got, want)
+	}
+	again, err := s.FormatGrammar(got, "messy.abnf")
+	if err != nil || again != got {
+		t.Fatalf("formatting is not idempotent (%v):\n%s", err, again)
+	}
+	before, _ := s.compileSource(src, "messy.abnf")
+	after, _ := s.compileSource(got, "messy.abnf")
+	if before.Serialize() != after.Serialize() {
+		t.Error("the formatted grammar compiles to another a-grammar")
+	}
+
+	if _, err := s.FormatGrammar("A = ( B ;", "bad.abnf"); err == nil {
+		t.Error("a grammar that does not compile is formatted")
+	}
+}
+
+// TestFormatGrammarSplit expects a production that spans lines (a tag with line
+// ends in its code) to get one alternative per line and its tagged term on a
+// line of its own, a term and its tag to move to the next line together, and
+// the empty lines of the author, two behind the :description(), to stay.
+func TestFormatGrammarSplit(t *testing.T) {
+	src := `:description("A calculator.") ;
+
+
+:startRule(Expression) ;
+
+Expression = Term { ( "+" | "-" ) <~~pushg(up.in)~~> Term <~~
+    pushg(popg() + popg())
+~~> } | "-" Term <~~
+    pushg(-popg())
+~~> ;
+Term = ( Number { ( "*" | "/" | "%" ) <~~ push(up.in) ~~> Number } ) <~~ push(foldChain(takeAll())) ~~> ;
+Number = "0"..."9" ;
+`
+	want := `:description("A calculator.") ;
+
+
+:startRule(Expression) ;
+
+Expression  = Term { ( "+" | "-" ) <~~pushg(up.in)~~>
+              Term <~~
+    pushg(popg() + popg())
+~~> }
+            | "-"
+              Term <~~
+    pushg(-popg())
+~~> ;
+Term        = ( Number { ( "*" | "/" | "%" ) <~~ push(up.in) ~~>
+              Number } ) <~~ push(foldChain(takeAll())) ~~> ;
+Number      = "0"..."9" ;
+`
+	s := NewEngine().NewSession(nil, nil)
+	got, err := s.FormatGrammar(src, "calc.abnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("formatted:\n%s\nwant:\n%s", got, want)
+	}
+	if again, err := s.FormatGrammar(got, "calc.abnf"); err != nil || again != got {
+		t.Fatalf("formatting is not idempotent (%v):\n%s", err, again)
+	}
+}
@@ -153,7 +153,7 @@ func Freeze(grammarPath string, outDir string) error {
 		return fmt.Errorf("cannot parse the bootstrap program: %s\n----\n%s", err, bootstrapSrc)
 	}
 	(*startScript.CodeChilds)[0].String = lib + "\nc.compile(c.asg)\nm\n"
-	modObj := compileASGInternal(asgB, g, "jsbootstrap", 0, false, true)
+	modObj := defaultSession().compileASG(asgB, g, "jsbootstrap", 0, false, true)
 	mod, ok := modObj.(*ir.Module)
 	if !ok {
 		return fmt.Errorf("compiling the bootstrap program yielded %T instead of an IR module", modObj)
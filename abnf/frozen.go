@@ -2,8 +2,8 @@ package abnf
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -38,10 +38,6 @@ import (
 //
 // goja is only needed to (re)create the snapshot with -freeze.
 
-// UseFrozenScripts switches the parser and compiler script subsystems from
-// goja to the frozen MetaJS bootstrap. Set by the -frozen command line flag.
-var UseFrozenScripts = false
-
 // jsBootstrapLL is the frozen IR snapshot: the tag scripts and the emitter
 // library of languages/metajs-to-llvm-ir.abnf, compiled by itself. (Re)generated by
 // 'mec -freeze'.
@@ -56,40 +52,59 @@ const frozenDriverMarker = "// ===== goja driver ====="
 // fkernel holds everything that all frozen engines share: the frozen a-grammar,
 // the bootstrap module, and the cache of compiled scripts. Compiled script
 // modules are context free (all bindings live in the runtimes), so one cache
-// serves every engine.
+// serves every engine - and every Session, which is why it is locked.
 type fkernel struct {
 	jsG      *r.Rules
-	bootMod  *ir.Module            // Parsed lazily by boot().
+	bootOnce sync.Once
+	bootMod  *ir.Module // Parsed lazily by boot().
+
+	mu       sync.Mutex
 	compiled map[string]*ir.Module // script source -> emitted module
 }
 
-var theKernel *fkernel
+var (
+	kernelOnce sync.Once
+	theKernel  *fkernel
+)
 
 func frozenKernel() *fkernel {
-	if theKernel != nil {
-		return theKernel
-	}
 	if jsAgrammar == nil || len(jsBootstrapLL) == 0 {
 		panic("frozen mode needs the bootstrap snapshot: run 'mec -freeze languages/metajs-to-llvm-ir.abnf' and rebuild")
 	}
-	theKernel = &fkernel{
-		jsG:      jsAgrammar,
-		compiled: map[string]*ir.Module{},
-	}
+	kernelOnce.Do(func() {
+		theKernel = &fkernel{
+			jsG:      jsAgrammar,
+			compiled: map[string]*ir.Module{},
+		}
+	})
 	return theKernel
 }
 
+// lookup returns the compiled module of a script source, or nil.
+func (k *fkernel) lookup(code string) *ir.Module {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.compiled[code]
+}
+
+// remember adds a compiled module to the in-process cache.
+func (k *fkernel) remember(code string, mod *ir.Module) {
+	k.mu.Lock()
+	k.compiled[code] = mod
+	k.mu.Unlock()
+}
+
 // boot returns the parsed bootstrap module. It is parsed on first use only:
 // compiling a script needs it, but a run whose scripts all come from the disk
 // cache never pays for parsing the ~650K snapshot.
 func (k *fkernel) boot() *ir.Module {
-	if k.bootMod == nil {
+	k.bootOnce.Do(func() {
 		mod, err := asm.ParseString("jsbootstrap.ll", jsBootstrapLL)
 		if err != nil {
 			panic("cannot parse the frozen bootstrap module: " + err.Error())
 		}
 		k.bootMod = mod
-	}
+	})
 	return k.bootMod
 }
 
@@ -97,10 +112,13 @@ func (k *fkernel) boot() *ir.Module {
 // the bootstrap snapshot: the tag scripts and :script() commands of the
 // frozen js grammar itself (the same collection -freeze embeds). It lets
 // HandleScriptRule decide without parsing the snapshot.
-var bootScriptSet map[string]bool
+var (
+	bootScriptOnce sync.Once
+	bootScriptSet  map[string]bool
+)
 
 func isBootScript(code string) bool {
-	if bootScriptSet == nil {
+	bootScriptOnce.Do(func() {
 		bootScriptSet = map[string]bool{}
 		var collect func(rules *r.Rules)
 		collect = func(rules *r.Rules) {
@@ -124,7 +142,7 @@ func isBootScript(code string) bool {
 			}
 		}
 		collect(jsAgrammar)
-	}
+	})
 	return bootScriptSet[code]
 }
 
@@ -176,6 +194,15 @@ func (we *walkEngine) RunTagCode(tag *r.Rule, name scriptName, upStream map[stri
 			if _, ok := err.(jsProgramPanic); ok {
 				panic(err)
 			}
+			if _, ok := err.(*ExitError); ok {
+				panic(err)
+			}
+			if _, ok := err.(*SandboxError); ok {
+				panic(err)
+			}
+			if _, ok := err.(*StepLimitError); ok {
+				panic(err)
+			}
 			panic(wrapScriptError(err, tag.ToString(), code))
 		}
 	}()
@@ -190,10 +217,10 @@ func (we *walkEngine) RunTagCode(tag *r.Rule, name scriptName, upStream map[stri
 
 // newWalkRuntime creates the runtime for one script compilation: the bootstrap
 // library sees the compile walk (up, push, pop) and the emitter hosts.
-func newWalkRuntime() (*jsrt, *walkEngine) {
+func newWalkRuntime(s *Session) (*jsrt, *walkEngine) {
 	we := &walkEngine{ltr: map[string]r.Object{"in": ""}}
 	bindings := frozenBaseBindings(false)
-	bindings["llvm"] = llvmFuncMap
+	bindings["llvm"] = s.llvmFuncs()
 	bindings["abnf"] = r.AbnfFuncMap
 	bindings["up"] = nil // Replaced per tag below.
 	// The bootstrap compiles TAG SCRIPTS here: they never get js_srcpos
@@ -217,7 +244,7 @@ func newWalkRuntime() (*jsrt, *walkEngine) {
 		we.curUp["stack"] = append(stack, argAt(args, 0))
 		return jsUndef
 	})
-	rt := newJSRT(bindings)
+	rt := newJSRT(s, bindings)
 	we.rt = rt
 	return rt, we
 }
@@ -234,40 +261,18 @@ func newWalkRuntime() (*jsrt, *walkEngine) {
 // independent, so on a multi core machine this is nearly free. Everything here
 // is best effort: a script with no (or a corrupt) cache entry is simply left for
 // compileScript.
-func (k *fkernel) prefetchCachedScripts(agrammar *r.Rules) {
+func (k *fkernel) prefetchCachedScripts(s *Session, agrammar *r.Rules) {
 	scriptCacheInit() // Once, HERE: the workers below must not race on it.
 	if agrammar == nil || scriptCacheDir == "" {
 		return
 	}
 
 	var codes []string
-	seen := map[string]bool{}
-	var collect func(rules *r.Rules)
-	collect = func(rules *r.Rules) {
-		if rules == nil {
-			return
-		}
-		for _, rule := range *rules {
-			if rule.Operator == r.Tag || (rule.Operator == r.Command && rule.String == "script") {
-				if rule.CodeChilds != nil {
-					for _, c := range *rule.CodeChilds {
-						if c.Operator != r.Token || seen[c.String] {
-							continue
-						}
-						seen[c.String] = true
-						if _, done := k.compiled[c.String]; !done {
-							codes = append(codes, c.String)
-						}
-					}
-				}
-			}
-			collect(rule.Childs)
-			if rule.Operator == r.Tag {
-				collect(rule.CodeChilds) // Tags can nest rules inside CodeChilds in theory.
-			}
+	for _, code := range scriptSources(agrammar) {
+		if k.lookup(code) == nil {
+			codes = append(codes, code)
 		}
 	}
-	collect(agrammar)
 
 	if len(codes) < 2 {
 		return
@@ -289,7 +294,7 @@ func (k *fkernel) prefetchCachedScripts(agrammar *r.Rules) {
 		go func() {
 			defer wg.Done()
 			for code := range jobs {
-				if mod := loadCachedScript(code); mod != nil {
+				if mod := loadCachedScript(s, code); mod != nil {
 					results <- loaded{code, mod}
 				}
 			}
@@ -302,39 +307,76 @@ func (k *fkernel) prefetchCachedScripts(agrammar *r.Rules) {
 	wg.Wait()
 	close(results)
 	for res := range results {
-		k.compiled[res.code] = res.mod
+		k.remember(res.code, res.mod)
+	}
+}
+
+// scriptSources returns the distinct annotation scripts of an a-grammar: the
+// code of its tags and :script() commands, in grammar order.
+func scriptSources(agrammar *r.Rules) []string {
+	var codes []string
+	seen := map[string]bool{}
+	var collect func(rules *r.Rules)
+	collect = func(rules *r.Rules) {
+		if rules == nil {
+			return
+		}
+		for _, rule := range *rules {
+			if rule.Operator == r.Tag || (rule.Operator == r.Command && rule.String == "script") {
+				if rule.CodeChilds != nil {
+					for _, c := range *rule.CodeChilds {
+						if c.Operator != r.Token || seen[c.String] {
+							continue
+						}
+						seen[c.String] = true
+						codes = append(codes, c.String)
+					}
+				}
+			}
+			collect(rule.Childs)
+			if rule.Operator == r.Tag {
+				collect(rule.CodeChilds) // Tags can nest rules inside CodeChilds in theory.
+			}
+		}
 	}
+	collect(agrammar)
+	return codes
 }
 
 // compileScript turns one annotation script into an IR module (cached by
-// source, both in process and on disk - see scriptcache.go).
-func (k *fkernel) compileScript(code string, name scriptName) *ir.Module {
-	if mod, ok := k.compiled[code]; ok {
+// source, both in process and on disk - see scriptcache.go). Two sessions that
+// miss on the same script at once both compile it; either module will do.
+func (k *fkernel) compileScript(s *Session, code string, name scriptName) *ir.Module {
+	if mod := k.lookup(code); mod != nil {
 		return mod
 	}
-	if mod := loadCachedScript(code); mod != nil {
-		k.compiled[code] = mod
+	if mod := loadCachedScript(s, code); mod != nil {
+		k.remember(code, mod)
 		return mod
 	}
 
 	// Only from here on is the name needed - so it is formatted here, not on
 	// every one of the ~10 000 tag executions of a grammar compile.
 	scriptFile := name.String()
-	asg, err := ParseWithAgrammar(k.jsG, code, scriptFile, &Parseropts{PreventDefaultOutput: true})
+	asg, err := s.parse(k.jsG, code, scriptFile, &Parseropts{PreventDefaultOutput: true})
+	var sbErr *SandboxError
+	if errors.As(err, &sbErr) {
+		panic(sbErr) // The sandbox stopped the parse; the script is not at fault.
+	}
 	if err != nil {
 		panic(fmt.Sprintf("frozen: cannot parse script %s: %s\nScript was: %s", scriptFile, err, code))
 	}
 
-	rt, we := newWalkRuntime()
+	rt, we := newWalkRuntime(s)
 	maBoot := rt.attach(k.boot())
 	mod, tags := bootObject(rt, maBoot)
 	we.tags = tags
 
-	co := &compiler{eng: we, fileName: scriptFile}
+	co := &compiler{sess: s, eng: we, fileName: scriptFile}
 	co.compile(asg, 0, 0)
 
 	storeCachedScript(code, mod)
-	k.compiled[code] = mod
+	k.remember(code, mod)
 	return mod
 }
 
@@ -399,6 +441,7 @@ type frozenEngine struct {
 }
 
 func newFrozenEngine(co *compiler, asg *r.Rules, aGrammar *r.Rules, traceEnabled, preventDefaultOutput bool) *frozenEngine {
+	s := co.sess
 	eng := &frozenEngine{
 		co:                   co,
 		machines:             map[*ir.Module]*machine{},
@@ -432,7 +475,7 @@ func newFrozenEngine(co *compiler, asg *r.Rules, aGrammar *r.Rules, traceEnabled
 			if fileName == "" || fileName == "undefined" {
 				fileName = eng.fileName
 			}
-			productions, err := ParseWithAgrammar(agrammar, srcCode, fileName, options)
+			productions, err := s.parse(agrammar, srcCode, fileName, options)
 			if err != nil {
 				panic(err)
 			}
@@ -440,44 +483,57 @@ func newFrozenEngine(co *compiler, asg *r.Rules, aGrammar *r.Rules, traceEnabled
 		},
 		// parseFrom parses srcCode from the named start production (see commonscript.go).
 		"parseFrom": func(agrammar *r.Rules, srcCode string, startRule string) *r.Rules {
-			productions, err := ParseWithAgrammar(agrammar, srcCode, eng.fileName, &Parseropts{StartRule: startRule})
+			productions, err := s.parse(agrammar, srcCode, eng.fileName, &Parseropts{StartRule: startRule})
 			if err != nil {
 				panic(err)
 			}
 			return productions
 		},
 		"compileRunStartScript": func(asg *r.Rules, aGrammar *r.Rules, slot int, traceEnabled bool) interface{} {
-			return compileASGInternal(asg, aGrammar, eng.fileName, slot, traceEnabled, eng.preventDefaultOutput)
+			return s.compileASG(asg, aGrammar, eng.fileName, slot, traceEnabled, eng.preventDefaultOutput)
 		},
-		// True when -trace/-cfgraph collect source positions: the compilers then
-		// emit js_srcpos statement markers (see lib/compile-core.js stmtPos).
-		"tracing": TraceMarkersWanted(),
+		// -repl (see commonscript.go and repl.go).
+		"repl":      s.Repl,
+		"replRead":  s.replRead,
+		"replParse": s.replParse,
+		// True when -trace/-cfgraph/-pdebug collect source positions: the
+		// compilers then emit js_srcpos statement markers (see
+		// lib/compile-core.js stmtPos); under -pdebug (debugging) with the scope.
+		"tracing":   s.TraceMarkersWanted(),
+		"debugging": s.ProgramDebugger != nil,
 		// Import policy + source positions for clean grammar errors (mirrors the
 		// goja c map in commonscript.go).
-		"warnImports":     WarnUnresolvedImports,
-		"warnUnsupported": WarnUnsupported,
-		"rtPrims":         RuntimePrims,
-		"rtLib":           RuntimeLib,
-		"file":            traceSrcName,
-		"lineOf":          func(pos int) int { return lineOfPos(pos) },
+		"warnImports":     s.WarnUnresolvedImports,
+		"warnUnsupported": s.WarnUnsupported,
+		"rtPrims":         s.RuntimePrims,
+		"rtLib":           s.RuntimeLib,
+		"file":            s.src.name,
+		"lineOf":          func(pos int) int { return s.lineOfPos(pos) },
+		// The -diagnostics reporter; see commonscript.go.
+		"report": s.reportDiag,
 		// The entry-point function name (-main flag, default "main").
-		"mainName": EntryPoint,
+		"mainName": s.EntryPoint,
 		// Output path for a native executable (-exe flag); see commonscript.go.
-		"exePath": ExePath,
+		"exePath": s.ExePath,
 		// Extra link inputs for the native build (-rt flag); see commonscript.go.
-		"runtime": RuntimeInputs,
+		"runtime": s.RuntimeInputs,
+		// The program's arguments and standard input; see commonscript.go.
+		"args":  s.progArgs(),
+		"stdin": s.Stdin,
+		// The value of the previous -pipe segment; see pipe.go.
+		"input": s.frozenInput(),
 		// Project-file imports (the -i include roots); see commonscript.go.
-		"curFile":        func() string { return traceSrcName },
-		"findImport":     func(relPath string) string { return findImportFile(relPath) },
-		"readFile":       func(path string) string { return readImportFile(path) },
-		"pushSource":     func(name, text string) { pushTraceSource(name, text) },
-		"pushSourceFile": func(name string) { pushTraceSourceFile(name) },
-		"popSource":      func() { popTraceSource() },
+		"curFile":        func() string { return s.src.name },
+		"findImport":     func(relPath string) string { return s.findImportFile(relPath) },
+		"readFile":       func(path string) string { return s.readImportFile(path) },
+		"pushSource":     func(name, text string) { s.pushTraceSource(name, text) },
+		"pushSourceFile": func(name string) { s.pushTraceSourceFile(name) },
+		"popSource":      func() { s.popTraceSource() },
 	}
 
 	bindings := frozenBaseBindings(preventDefaultOutput)
-	bindings["llvm"] = llvmFuncMap
-	bindings["abnf"] = r.AbnfFuncMap
+	bindings["llvm"] = s.llvmFuncs()
+	bindings["abnf"] = s.abnfFuncs(func() string { return eng.fileName })
 	bindings["c"] = eng.cMap
 	bindings["ltr"] = eng.ltrStream
 	bindings["up"] = nil // Replaced per tag execution.
@@ -497,29 +553,33 @@ func newFrozenEngine(co *compiler, asg *r.Rules, aGrammar *r.Rules, traceEnabled
 		eng.references.correctReferencesAndIDs(agrammar)
 	}
 	bindings["load"] = func(fileName string) string {
-		dat, err := ioutil.ReadFile(eng.resolvePath(fileName))
+		dat, err := s.readHostFile(eng.resolvePath(fileName))
 		if err != nil {
 			panic(err)
 		}
 		return string(dat)
 	}
 	bindings["store"] = func(fileName, data string) {
-		if err := ioutil.WriteFile(eng.resolvePath(fileName), []byte(data), 0644); err != nil {
+		if err := s.writeHostFile(eng.resolvePath(fileName), data); err != nil {
 			panic(err)
 		}
 	}
 	bindings["moduleName"] = func() string { return eng.fileName }
+	bindings["emit"] = s.emit
+	for name, api := range frozenHostFSBindings(s, func() string { return eng.fileName }) {
+		bindings[name] = api
+	}
 	bindings["include"] = jsHostFunc("include", func(rt *jsrt, this uint64, args []interface{}) interface{} {
 		fileName := rt.toString(argAt(args, 0))
 		if fileName == "" {
 			return false
 		}
 		resolved := eng.resolvePath(fileName)
-		dat, err := ioutil.ReadFile(resolved)
+		dat, err := s.readHostFile(resolved)
 		if err != nil {
 			panic(err)
 		}
-		mod := frozenKernel().compileScript(StripBOM(string(dat)), fileScript(resolved))
+		mod := frozenKernel().compileScript(s, StripBOM(string(dat)), fileScript(resolved))
 		// The included file runs AS its own module (goja names each program
 		// after its file): a nested include(), load() or moduleName() inside
 		// it resolves relative to the included file, not to the includer -
@@ -530,21 +590,25 @@ func newFrozenEngine(co *compiler, asg *r.Rules, aGrammar *r.Rules, traceEnabled
 		runScriptModule(rt, eng.machineFor(mod), eng.sharedScope)
 		return true
 	})
+	// eval compiles the string like any other script and runs it in the shared
+	// scope, so evaluated code sees (and can create) the script globals.
+	bindings["eval"] = jsHostFunc("eval", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+		mod := frozenKernel().compileScript(s, rt.toString(argAt(args, 0)), fileScript("eval"))
+		return runScriptModule(rt, eng.machineFor(mod), eng.sharedScope)
+	})
+	// The embedder's Go functions and values (hostbind.go) come after the
+	// built-ins, so they win over them like under goja.
+	for name, v := range s.hostBindings() {
+		bindings[name] = v
+	}
 
 	// The walk is about to run this grammar's tag scripts one after another;
 	// whatever of them is already on disk is loaded here, in parallel.
-	frozenKernel().prefetchCachedScripts(aGrammar)
+	frozenKernel().prefetchCachedScripts(s, aGrammar)
 
-	eng.rt = newJSRT(bindings)
+	eng.rt = newJSRT(s, bindings)
 	eng.sharedScope = eng.rt.newScopeHandle(nil)
 
-	// eval compiles the string like any other script and runs it in the shared
-	// scope, so evaluated code sees (and can create) the script globals.
-	eng.rt.setRootVar("eval", jsHostFunc("eval", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-		mod := frozenKernel().compileScript(rt.toString(argAt(args, 0)), fileScript("eval"))
-		return runScriptModule(rt, eng.machineFor(mod), eng.sharedScope)
-	}))
-
 	// The stack functions work on the upStream of the currently running tag.
 	eng.rt.setRootVar("pop", jsHostFunc("pop", func(rt *jsrt, this uint64, args []interface{}) interface{} {
 		stack, ok := eng.curUp["stack"].([]interface{})
@@ -610,11 +674,20 @@ func (eng *frozenEngine) RunTagCode(tag *r.Rule, name scriptName, upStream map[s
 			if _, ok := err.(jsProgramPanic); ok {
 				panic(err)
 			}
+			if _, ok := err.(*ExitError); ok {
+				panic(err)
+			}
+			if _, ok := err.(*SandboxError); ok {
+				panic(err)
+			}
+			if _, ok := err.(*StepLimitError); ok {
+				panic(err)
+			}
 			panic(wrapScriptError(err, tag.ToString(), code))
 		}
 	}()
 
-	mod := frozenKernel().compileScript(code, name)
+	mod := frozenKernel().compileScript(eng.co.sess, code, name)
 	ma := eng.machineFor(mod)
 
 	eng.cMap["localAsg"] = localASG
@@ -624,13 +697,13 @@ func (eng *frozenEngine) RunTagCode(tag *r.Rule, name scriptName, upStream map[s
 
 	if eng.traceEnabled {
 		eng.traceCount++
-		traceTagTop(eng.traceCount, tag, slot, depth, eng.stack, eng.ltrStream, upStream)
+		traceTagTop(eng.co.sess.warn, eng.traceCount, tag, slot, depth, eng.stack, eng.ltrStream, upStream)
 	}
 
 	res := runScriptModule(eng.rt, ma, eng.sharedScope)
 
 	if eng.traceEnabled {
-		traceTagBottom(eng.stack, eng.ltrStream, upStream)
+		traceTagBottom(eng.co.sess.warn, eng.stack, eng.ltrStream, upStream)
 	}
 
 	eng.curUp = savedUp
@@ -690,6 +763,7 @@ func (ps *frozenParserScript) init() {
 	if ps.rt != nil {
 		return
 	}
+	s := ps.pa.sess
 	ps.machines = map[*ir.Module]*machine{}
 	ps.fileName = r.GetOrigin(ps.pa.agrammar)
 	if ps.fileName == "" {
@@ -715,7 +789,7 @@ func (ps *frozenParserScript) init() {
 			if fileName == "" || fileName == "undefined" {
 				fileName = ps.fileName
 			}
-			productions, err := ParseWithAgrammar(agrammar, srcCode, fileName, options)
+			productions, err := s.parse(agrammar, srcCode, fileName, options)
 			if err != nil {
 				panic(err)
 			}
@@ -723,39 +797,44 @@ func (ps *frozenParserScript) init() {
 		},
 		// parseFrom parses srcCode from the named start production (see commonscript.go).
 		"parseFrom": func(agrammar *r.Rules, srcCode string, startRule string) *r.Rules {
-			productions, err := ParseWithAgrammar(agrammar, srcCode, ps.fileName, &Parseropts{StartRule: startRule})
+			productions, err := s.parse(agrammar, srcCode, ps.fileName, &Parseropts{StartRule: startRule})
 			if err != nil {
 				panic(err)
 			}
 			return productions
 		},
 		"compileRunStartScript": func(asg *r.Rules, aGrammar *r.Rules, slot int, traceEnabled bool) interface{} {
-			return compileASGInternal(asg, aGrammar, ps.fileName, slot, traceEnabled, ps.pa.opts.PreventDefaultOutput)
+			return s.compileASG(asg, aGrammar, ps.fileName, slot, traceEnabled, ps.pa.opts.PreventDefaultOutput)
 		},
 		"ABNFagrammar":    AbnfAgrammar,
-		"tracing":         TraceMarkersWanted(),
-		"warnImports":     WarnUnresolvedImports,
-		"warnUnsupported": WarnUnsupported,
-		"rtPrims":         RuntimePrims,
-		"rtLib":           RuntimeLib,
-		"file":            traceSrcName,
-		"lineOf":          func(pos int) int { return lineOfPos(pos) },
-		"mainName":        EntryPoint,
-		"exePath":         ExePath,
-		"runtime":         RuntimeInputs,
+		"tracing":         s.TraceMarkersWanted(),
+		"debugging":       s.ProgramDebugger != nil,
+		"warnImports":     s.WarnUnresolvedImports,
+		"warnUnsupported": s.WarnUnsupported,
+		"rtPrims":         s.RuntimePrims,
+		"rtLib":           s.RuntimeLib,
+		"file":            s.src.name,
+		"lineOf":          func(pos int) int { return s.lineOfPos(pos) },
+		"report":          s.reportDiag,
+		"mainName":        s.EntryPoint,
+		"exePath":         s.ExePath,
+		"runtime":         s.RuntimeInputs,
+		"args":            s.progArgs(),
+		"stdin":           s.Stdin,
+		"input":           s.frozenInput(),
 		// Project-file imports (the -i include roots); mirrors the goja c map in
 		// commonscript.go and the frozen compiler engine, so a parser :script that
 		// resolves an import does not become a latent abort only under -frozen.
-		"curFile":        func() string { return traceSrcName },
-		"findImport":     func(relPath string) string { return findImportFile(relPath) },
-		"readFile":       func(path string) string { return readImportFile(path) },
-		"pushSource":     func(name, text string) { pushTraceSource(name, text) },
-		"pushSourceFile": func(name string) { pushTraceSourceFile(name) },
-		"popSource":      func() { popTraceSource() },
+		"curFile":        func() string { return s.src.name },
+		"findImport":     func(relPath string) string { return s.findImportFile(relPath) },
+		"readFile":       func(path string) string { return s.readImportFile(path) },
+		"pushSource":     func(name, text string) { s.pushTraceSource(name, text) },
+		"pushSourceFile": func(name string) { s.pushTraceSourceFile(name) },
+		"popSource":      func() { s.popTraceSource() },
 	}
 	bindings := frozenBaseBindings(ps.pa.opts.PreventDefaultOutput)
-	bindings["llvm"] = llvmFuncMap
-	bindings["abnf"] = r.AbnfFuncMap
+	bindings["llvm"] = s.llvmFuncs()
+	bindings["abnf"] = s.abnfFuncs(func() string { return ps.fileName })
 	bindings["c"] = ps.cMap
 	bindings["append"] = func(t []interface{}, v ...interface{}) interface{} {
 		tmp := append(t, v...)
@@ -770,29 +849,33 @@ func (ps *frozenParserScript) init() {
 		ps.references.correctReferencesAndIDs(agrammar)
 	}
 	bindings["load"] = func(fileName string) string {
-		dat, err := ioutil.ReadFile(ps.resolvePath(fileName))
+		dat, err := s.readHostFile(ps.resolvePath(fileName))
 		if err != nil {
 			panic(err)
 		}
 		return string(dat)
 	}
 	bindings["store"] = func(fileName, data string) {
-		if err := ioutil.WriteFile(ps.resolvePath(fileName), []byte(data), 0644); err != nil {
+		if err := s.writeHostFile(ps.resolvePath(fileName), data); err != nil {
 			panic(err)
 		}
 	}
 	bindings["moduleName"] = func() string { return ps.fileName }
+	bindings["emit"] = s.emit
+	for name, api := range frozenHostFSBindings(s, func() string { return ps.fileName }) {
+		bindings[name] = api
+	}
 	bindings["include"] = jsHostFunc("include", func(rt *jsrt, this uint64, args []interface{}) interface{} {
 		fileName := rt.toString(argAt(args, 0))
 		if fileName == "" {
 			return false
 		}
 		resolved := ps.resolvePath(fileName)
-		dat, err := ioutil.ReadFile(resolved)
+		dat, err := s.readHostFile(resolved)
 		if err != nil {
 			panic(err)
 		}
-		mod := frozenKernel().compileScript(StripBOM(string(dat)), fileScript(resolved))
+		mod := frozenKernel().compileScript(s, StripBOM(string(dat)), fileScript(resolved))
 		ma, ok := ps.machines[mod]
 		if !ok {
 			ma = ps.rt.attach(mod)
@@ -805,6 +888,18 @@ func (ps *frozenParserScript) init() {
 		runScriptModule(rt, ma, ps.sharedScope)
 		return true
 	})
+	bindings["eval"] = jsHostFunc("eval", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+		mod := frozenKernel().compileScript(s, rt.toString(argAt(args, 0)), fileScript("eval"))
+		ma, ok := ps.machines[mod]
+		if !ok {
+			ma = ps.rt.attach(mod)
+			ps.machines[mod] = ma
+		}
+		return runScriptModule(rt, ma, ps.sharedScope)
+	})
+	for name, v := range s.hostBindings() {
+		bindings[name] = v
+	}
 	bindings["pop"] = jsHostFunc("pop", func(rt *jsrt, this uint64, args []interface{}) interface{} {
 		if len(ps.stack) == 0 {
 			return jsNull
@@ -818,18 +913,9 @@ func (ps *frozenParserScript) init() {
 		return jsUndef
 	})
 
-	ps.rt = newJSRT(bindings)
+	ps.rt = newJSRT(s, bindings)
 	ps.sharedScope = ps.rt.newScopeHandle(nil)
 
-	ps.rt.setRootVar("eval", jsHostFunc("eval", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-		mod := frozenKernel().compileScript(rt.toString(argAt(args, 0)), fileScript("eval"))
-		ma, ok := ps.machines[mod]
-		if !ok {
-			ma = ps.rt.attach(mod)
-			ps.machines[mod] = ma
-		}
-		return runScriptModule(rt, ma, ps.sharedScope)
-	}))
 }
 
 // ensureBootTags attaches the bootstrap module on first need: the grammar
@@ -863,7 +949,7 @@ func (ps *frozenParserScript) HandleScriptRule(rule *r.Rule, localProductions *r
 		ps.rt.call(cl, jsUndef, nil)
 		completion = ps.rt.retSlot
 	} else {
-		mod := frozenKernel().compileScript(code, fileScript(ps.pa.fileName+":parserCommand"))
+		mod := frozenKernel().compileScript(ps.pa.sess, code, fileScript(ps.pa.fileName+":parserCommand"))
 		ma, ok := ps.machines[mod]
 		if !ok {
 			ma = ps.rt.attach(mod)
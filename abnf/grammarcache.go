@@ -0,0 +1,145 @@
+package abnf
+
+// The grammar cache: compiled a-grammars of grammar files, kept on disk across
+// runs.
+//
+// Stage 1 of every run parses the grammar file with the built-in a-grammar and
+// compiles the ASG - for languages/kotlin-to-llvm-ir.abnf that is most of the
+// start-up time of a short test program, and the result is the same every time.
+// Its only inputs are the file name (include paths and the :origin() stamp are
+// derived from it), the source, the slot, and the snapshot: the built-in
+// a-grammar and jsbootstrap.ll. So the compiled a-grammar is stored in the
+// binary form of r.Marshal, keyed by a hash over all of these, and a later run
+// with the same inputs loads it instead of parsing.
+//
+// Each :include() fragment is a grammar file of its own and is cached the same
+// way when the including grammar is first used (applyCommand): an entry holds
+// one file's a-grammar BEFORE its fragments are merged in, so an edited fragment
+// only misses its own entry, and -verify still sees which productions are the
+// file's own. The include()d script libraries are not part of any key: they are
+// read when the tag scripts run, after the cache is done, and do not change the
+// a-grammar.
+//
+// The entries live next to the script cache (scriptcache.go) and follow its
+// rules: the directory is $MEC_SCRIPT_CACHE or <user cache dir>/mec/scripts,
+// MEC_SCRIPT_CACHE=off disables both, writes are atomic, and an unreadable
+// entry is a miss that the next store overwrites.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"14.gy/mec/abnf/r"
+)
+
+// grammarCacheFormat invalidates all grammar entries when the Go side compiles
+// the same source differently (a change in compiler.go or parser.go that the
+// snapshot does not show). Bump it in that case.
+const grammarCacheFormat = "1"
+
+var (
+	grammarCacheKeyOnce sync.Once
+	grammarCacheKey     string // Hash over format+snapshot, "" when the built-in a-grammar cannot be marshaled.
+)
+
+// grammarCachePath maps a grammar file to its cache file ("" when disabled).
+func grammarCachePath(fileName, src string, slot int) string {
+	scriptCacheInit()
+	if scriptCacheDir == "" {
+		return ""
+	}
+	grammarCacheKeyOnce.Do(func() {
+		builtin, err := r.Marshal(AbnfAgrammar, r.MarshalBinary)
+		if err != nil {
+			return
+		}
+		sum := sha256.Sum256([]byte(grammarCacheFormat + "\x00" + scriptCacheKey + "\x00" + string(builtin)))
+		grammarCacheKey = hex.EncodeToString(sum[:])
+	})
+	if grammarCacheKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(grammarCacheKey + "\x00" + fileName + "\x00" + strconv.Itoa(slot) + "\x00" + src))
+	return filepath.Join(scriptCacheDir, hex.EncodeToString(sum[:])+".mecg")
+}
+
+// LoadCachedGrammar returns the cached a-grammar of a grammar file (compiled
+// with the built-in a-grammar into slot), or nil.
+func LoadCachedGrammar(fileName, src string, slot int) *r.Rules {
+	path := grammarCachePath(fileName, src, slot)
+	if path == "" {
+		return nil
+	}
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	grammar, err := r.Unmarshal(dat)
+	if err != nil || grammar == nil {
+		return nil // Corrupt entry: the caller compiles and stores it again.
+	}
+	return grammar
+}
+
+// StoreCachedGrammar stores the a-grammar that a grammar file compiled to. Call
+// it before the a-grammar is used: the first parse with it merges the :include()
+// fragments in. Caching is best effort, a failure only skips the store.
+func StoreCachedGrammar(fileName, src string, slot int, grammar *r.Rules) {
+	path := grammarCachePath(fileName, src, slot)
+	if path == "" || grammar == nil {
+		return
+	}
+	data, err := r.Marshal(grammar, r.MarshalBinary)
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".mec-grammar-*")
+	if err != nil {
+		return
+	}
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if os.Rename(tmp.Name(), path) != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// CompileGrammar parses a grammar file with the built-in a-grammar and compiles
+// the ASG into slot, like ParseWithAgrammar and CompileASG, through the grammar
+// cache. A run with tracing on always parses, since the trace is what it is for.
+func CompileGrammar(src, fileName string, slot int, opts *Parseropts, preventDefaultOutput bool) (*r.Rules, error) {
+	return defaultSession().CompileGrammar(src, fileName, slot, opts, preventDefaultOutput)
+}
+
+// CompileGrammar is the session form of the package-level CompileGrammar.
+func (s *Session) CompileGrammar(src, fileName string, slot int, opts *Parseropts, preventDefaultOutput bool) (*r.Rules, error) {
+	if opts == nil {
+		opts = &Parseropts{}
+	}
+	trace := opts.TraceEnabled
+	if !trace {
+		if grammar := LoadCachedGrammar(fileName, src, slot); grammar != nil {
+			return grammar, nil
+		}
+	}
+	asg, err := s.parse(AbnfAgrammar, src, fileName, opts)
+	if err != nil {
+		return nil, err
+	}
+	grammar, err := s.compile(asg, AbnfAgrammar, fileName, slot, false, preventDefaultOutput)
+	if err != nil {
+		return nil, err
+	}
+	if !trace {
+		StoreCachedGrammar(fileName, src, slot, grammar)
+	}
+	return grammar, nil
+}
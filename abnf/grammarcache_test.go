@@ -0,0 +1,72 @@
+package abnf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGrammarCache compiles a grammar with an :include() fragment twice, and
+// expects the second compile to come from the cache, equal to the first, and
+// to still merge the fragment when used. An edited fragment gets a new entry
+// of its own, and the parse sees the edit.
+func TestGrammarCache(t *testing.T) {
+	dir := t.TempDir()
+	scriptCacheInit()
+	savedDir := scriptCacheDir
+	scriptCacheDir = filepath.Join(dir, "cache")
+	defer func() { scriptCacheDir = savedDir }()
+	if err := os.Mkdir(scriptCacheDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	main := filepath.Join(dir, "main.abnf")
+	frag := filepath.Join(dir, "frag.abnf")
+	src := `:startRule(List) ; :include("frag.abnf") ; List = Item { "," Item } ;`
+	write := func(file, text string) {
+		if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(main, src)
+	write(frag, `Item = "a" ;`)
+	entries := func() int {
+		matches, _ := filepath.Glob(filepath.Join(scriptCacheDir, "*.mecg"))
+		return len(matches)
+	}
+	opts := &Parseropts{PreventDefaultOutput: true}
+
+	first, err := CompileGrammar(src, main, 0, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries() != 1 {
+		t.Fatalf("%d cache entries after the first compile, want 1", entries())
+	}
+	cached := LoadCachedGrammar(main, src, 0)
+	if cached == nil || cached == first {
+		t.Fatal("the compiled grammar is not in the cache")
+	}
+	if path := sameRules(first, cached, "grammar"); path != "" {
+		t.Fatalf("the cached grammar differs at %s", path)
+	}
+	if LoadCachedGrammar(main, src+" ", 0) != nil || LoadCachedGrammar(main, src, 1) != nil {
+		t.Error("the cache ignores the source or the slot")
+	}
+
+	if _, err := ParseWithAgrammar(cached, "a, a", "in.txt", opts); err != nil {
+		t.Fatalf("the cached grammar does not merge its fragment: %v", err)
+	}
+	if entries() != 2 {
+		t.Fatalf("%d cache entries after the fragment was included, want 2", entries())
+	}
+
+	write(frag, `Item = "b" ;`)
+	again, _ := CompileGrammar(src, main, 0, opts, true)
+	if _, err := ParseWithAgrammar(again, "b, b", "in.txt", opts); err != nil {
+		t.Fatalf("the edited fragment is not seen: %v", err)
+	}
+	if entries() != 3 {
+		t.Fatalf("%d cache entries after the fragment was edited, want 3", entries())
+	}
+}
@@ -0,0 +1,724 @@
+package abnf
+
+// Importing grammars written in other notations (-import): IETF ABNF (RFC 5234,
+// with the case-sensitive strings of RFC 7405), ANTLR4 and PEG.js. Each importer
+// reads the foreign grammar and builds an a-grammar from it directly, the same
+// *r.Rules a compiled .abnf file yields, so ParseWithAgrammar runs it without a
+// detour over our own syntax. GrammarSource (grammarsource.go) then writes it
+// out as annotated EBNF, which is where a user starts adding tags.
+//
+// What the notations share is translated one to one: sequences, alternatives,
+// options, repetitions, ranges and char sets. What needs care:
+//
+//   - All three mean the first matching alternative (PEG.js by definition, ABNF
+//     and ANTLR as far as the parser here goes): an alternative that is a prefix
+//     of a later one hides it, exactly as in a grammar written by hand.
+//   - Left recursion (a : a '+' b | b ;), common in ANTLR, loops forever in a
+//     top-down parser. A production that refers to itself first is rewritten to
+//     its non-recursive alternatives followed by a repetition of the rest
+//     (a = b { "+" b }), which accepts the same text.
+//   - Case-insensitive strings become a sequence of two-char sets (@"iI" @"fF").
+//   - A lookahead of anything but a token (&X, !X in PEG.js, a non-greedy loop in
+//     ANTLR) is a Not of that rule; the parser runs it, only our source syntax
+//     has no spelling for it (see GrammarSource).
+//   - Semantic actions, predicates, labels and return values are dropped with a
+//     warning where they could change what is matched: the import is about the
+//     syntax; the semantics are the tags the user writes afterwards.
+//
+// Whitespace is explicit in ABNF and PEG.js, so their grammars switch the
+// implicit skipping off (:whitespace()). ANTLR has a lexer: the rules it skips
+// (-> skip, -> channel(...)) become the :whitespace() production, and a token
+// rule switches skipping off inside itself, like the hand-written grammars do.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf/r"
+)
+
+// ImportFormats lists the notations -import reads, for the usage and errors.
+var ImportFormats = []string{"rfc5234", "antlr", "pegjs"}
+
+// ImportGrammar converts the grammar src, read from fileName and written in the
+// given format, into an a-grammar. Problems that do not stop the import (dropped
+// actions, unsupported constructs with a fallback) are printed as warnings.
+func ImportGrammar(format, src, fileName string) (res *r.Rules, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			res = nil
+			e = fmt.Errorf("%s", err)
+		}
+	}()
+	im := &grammarImport{file: filepath.Clean(fileName), src: StripBOM(src), byName: map[string]*r.Rule{}, warned: map[string]bool{}}
+	switch format {
+	case "rfc5234", "abnf":
+		return im.importRFC5234(), nil
+	case "antlr", "antlr4", "g4":
+		return im.importANTLR(), nil
+	case "pegjs", "peggy":
+		return im.importPEGjs(), nil
+	}
+	return nil, fmt.Errorf("unknown import format %q (valid: %s)", format, strings.Join(ImportFormats, ", "))
+}
+
+// grammarImport is the state all importers share: the source being read and the
+// productions defined so far, in source order.
+type grammarImport struct {
+	file, src string
+	pos       int
+	prods     []*r.Rule
+	byName    map[string]*r.Rule
+	warned    map[string]bool
+}
+
+func (im *grammarImport) fail(pos int, format string, args ...interface{}) {
+	panic(FileLinePos(im.file, im.src, pos) + ": " + fmt.Sprintf(format, args...))
+}
+
+// warn reports a lossy translation once per message, at its first place.
+func (im *grammarImport) warn(pos int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if im.warned[msg] {
+		return
+	}
+	im.warned[msg] = true
+	fmt.Fprintf(os.Stderr, "warning: %s: %s\n", FileLinePos(im.file, im.src, pos), msg)
+}
+
+func (im *grammarImport) eof() bool { return im.pos >= len(im.src) }
+
+// peek returns the byte at the current position plus off, or 0 past the end.
+func (im *grammarImport) peek(off int) byte {
+	if im.pos+off < len(im.src) {
+		return im.src[im.pos+off]
+	}
+	return 0
+}
+
+func (im *grammarImport) at(s string) bool { return strings.HasPrefix(im.src[im.pos:], s) }
+
+// skipCStyle skips whitespace and the // and /* */ comments of ANTLR and PEG.js.
+func (im *grammarImport) skipCStyle() {
+	for !im.eof() {
+		switch {
+		case strings.IndexByte(" \t\r\n\f", im.src[im.pos]) >= 0:
+			im.pos++
+		case im.at("//"):
+			for !im.eof() && im.src[im.pos] != '\n' {
+				im.pos++
+			}
+		case im.at("/*"):
+			end := strings.Index(im.src[im.pos+2:], "*/")
+			if end < 0 {
+				im.fail(im.pos, "unterminated comment")
+			}
+			im.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+// ident reads a name of letters, digits and underscores, or returns "".
+func (im *grammarImport) ident(extra string) string {
+	start := im.pos
+	for !im.eof() {
+		c, size := utf8.DecodeRuneInString(im.src[im.pos:])
+		if !(c == '_' || unicode.IsLetter(c) || im.pos > start && unicode.IsDigit(c) || strings.ContainsRune(extra, c) && im.pos > start) {
+			break
+		}
+		im.pos += size
+	}
+	return im.src[start:im.pos]
+}
+
+// expect consumes s (after the caller skipped whitespace) or fails.
+func (im *grammarImport) expect(s string) {
+	if !im.at(s) {
+		found := "end of file"
+		if !im.eof() {
+			c, _ := utf8.DecodeRuneInString(im.src[im.pos:])
+			found = fmt.Sprintf("%q", c)
+		}
+		im.fail(im.pos, "expected %q, found %s", s, found)
+	}
+	im.pos += len(s)
+}
+
+// skipBalanced skips a bracketed block of embedded code like {...} or [...],
+// nested brackets and the brackets inside quoted strings included. It starts
+// on the opening bracket.
+func (im *grammarImport) skipBalanced(open, close byte) string {
+	start, depth := im.pos, 0
+	for !im.eof() {
+		c := im.src[im.pos]
+		switch {
+		case c == open:
+			depth++
+		case c == close:
+			depth--
+			if depth == 0 {
+				im.pos++
+				return im.src[start:im.pos]
+			}
+		case c == '"' || c == '\'' || c == '`':
+			for im.pos++; !im.eof() && im.src[im.pos] != c && im.src[im.pos] != '\n'; im.pos++ {
+				if im.src[im.pos] == '\\' {
+					im.pos++
+				}
+			}
+		case c == '/' && im.peek(1) == '/':
+			for !im.eof() && im.src[im.pos] != '\n' {
+				im.pos++
+			}
+			continue
+		case c == '/' && im.peek(1) == '*':
+			if end := strings.Index(im.src[im.pos+2:], "*/"); end >= 0 {
+				im.pos += end + 3
+			}
+		}
+		im.pos++
+	}
+	im.fail(start, "unterminated %c%c block", open, close)
+	return ""
+}
+
+// define adds the production name; a second definition appends alternatives,
+// which is what ABNF's =/ means and what the other notations reject.
+func (im *grammarImport) define(name string, body *r.Rule, pos int, incremental bool) *r.Rule {
+	if prod := im.byName[name]; prod != nil {
+		if !incremental {
+			im.fail(pos, "%s is defined twice", name)
+		}
+		old := importSeq(*prod.Childs, prod.Pos)
+		prod.Childs = &r.Rules{importOr(append(importAlternatives(old), importAlternatives(body)...), pos)}
+		return prod
+	}
+	prod := &r.Rule{Operator: r.Production, String: name, Childs: importChilds(body), Pos: pos}
+	im.prods = append(im.prods, prod)
+	im.byName[name] = prod
+	return prod
+}
+
+// uniqueName returns name, or name with a number appended if a production of
+// that name exists already: for the productions an importer adds itself.
+func (im *grammarImport) uniqueName(name string) string {
+	for i, n := 2, name; ; i++ {
+		if im.byName[n] == nil {
+			return n
+		}
+		n = fmt.Sprintf("%s%d", name, i)
+	}
+}
+
+// grammar assembles the result: the header commands, the productions, and the
+// :origin() a compiled grammar carries too. The title defaults to the file
+// name; whitespace is the production to skip between tokens, or "" for none.
+func (im *grammarImport) grammar(title, format, start, whitespace string) *r.Rules {
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(im.file), filepath.Ext(im.file))
+	}
+	rules := &r.Rules{
+		&r.Rule{Operator: r.Command, String: "title", CodeChilds: &r.Rules{importToken(title, 0)}},
+		&r.Rule{Operator: r.Command, String: "description", CodeChilds: &r.Rules{importToken("Imported from "+filepath.Base(im.file)+" ("+format+").", 0)}},
+		&r.Rule{Operator: r.Command, String: "startRule", CodeChilds: &r.Rules{importIdent(start, 0)}},
+	}
+	ws := &r.Rule{Operator: r.Command, String: "whitespace"}
+	if whitespace != "" {
+		ws.CodeChilds = &r.Rules{importIdent(whitespace, 0)}
+	}
+	*rules = append(*rules, ws)
+	for _, prod := range im.prods {
+		importWalk(&r.Rules{prod}, func(rule *r.Rule) { importMergeNot(rule.Childs) })
+	}
+	*rules = append(*rules, im.prods...)
+	*rules = append(*rules, &r.Rule{Operator: r.Command, String: "origin", CodeChilds: &r.Rules{importToken(im.file, 0)}})
+	return rules
+}
+
+// checkReferences fails on a name no production defines. undefined may supply
+// a production for it first (the ABNF core rules, ANTLR's declared tokens).
+func (im *grammarImport) checkReferences(undefined func(name string, pos int) bool) {
+	for i := 0; i < len(im.prods); i++ { // undefined may append productions.
+		importWalk(im.prods[i].Childs, func(rule *r.Rule) {
+			if rule.Operator == r.Identifier && im.byName[rule.String] == nil {
+				if undefined == nil || !undefined(rule.String, rule.Pos) {
+					im.fail(rule.Pos, "%s is used but never defined", rule.String)
+				}
+			}
+		})
+	}
+}
+
+// removeLeftRecursion rewrites a production whose alternatives start with a
+// reference to itself: a = a x | a y | b | c becomes a = ( b | c ) { x | y }.
+// Only direct recursion is handled; a cycle over several productions is left
+// as it is, with a warning.
+func (im *grammarImport) removeLeftRecursion() {
+	for _, prod := range im.prods {
+		var recursive, base []*r.Rule
+		for _, alt := range importAlternatives(importSeq(*prod.Childs, prod.Pos)) {
+			items := importItems(alt)
+			if len(items) > 0 && items[0].Operator == r.Identifier && items[0].String == prod.String {
+				recursive = append(recursive, importSeq(items[1:], alt.Pos))
+			} else {
+				base = append(base, alt)
+			}
+		}
+		if len(recursive) == 0 {
+			continue
+		}
+		if len(base) == 0 {
+			im.fail(prod.Pos, "%s is left recursive and has no alternative to start with", prod.String)
+		}
+		prod.Childs = importChilds(importSeq([]*r.Rule{importOr(base, prod.Pos), importRepeat(importOr(recursive, prod.Pos), prod.Pos)}, prod.Pos))
+	}
+	for _, prod := range im.prods {
+		if first := im.leftCycle(prod, prod.String, map[string]bool{}); first != "" {
+			im.warn(prod.Pos, "%s is left recursive over %s; the parser will not terminate on it", prod.String, first)
+		}
+	}
+}
+
+// leftCycle reports the production through which prod can reach target again
+// without consuming anything, or "".
+func (im *grammarImport) leftCycle(prod *r.Rule, target string, seen map[string]bool) string {
+	if seen[prod.String] {
+		return ""
+	}
+	seen[prod.String] = true
+	for _, first := range importFirsts(prod.Childs) {
+		if first == target && prod.String != target {
+			return prod.String
+		}
+		if next := im.byName[first]; next != nil && first != target {
+			if via := im.leftCycle(next, target, seen); via != "" {
+				return via
+			}
+		}
+	}
+	return ""
+}
+
+// importFirsts lists the productions a rule list can begin with: the first
+// reference of each alternative, looking past options and repetitions, which
+// can match nothing. It is a cheap approximation, good enough for a warning.
+func importFirsts(rules *r.Rules) []string {
+	var names []string
+	if rules == nil {
+		return nil
+	}
+	for _, rule := range *rules {
+		switch rule.Operator {
+		case r.Identifier:
+			return append(names, rule.String)
+		case r.Or:
+			for _, alt := range *rule.Childs {
+				names = append(names, importFirsts(&r.Rules{alt})...)
+			}
+			return names
+		case r.Sequence, r.Group, r.Tag, r.Times:
+			return append(names, importFirsts(rule.Childs)...)
+		case r.Optional, r.Repeat:
+			names = append(names, importFirsts(rule.Childs)...)
+			continue
+		case r.Command, r.Not:
+			continue
+		}
+		return names
+	}
+	return names
+}
+
+// sortedNames lists the keys of a set, sorted, for deterministic messages.
+func sortedNames(set map[string]bool) []string {
+	var names []string
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// importName turns a foreign rule name into one our syntax accepts: a letter
+// first, then letters, digits and underscores (ABNF's hyphens become
+// underscores).
+func importName(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if i == 0 && !letter {
+			b.WriteString("R")
+		}
+		if !letter && !(c >= '0' && c <= '9') {
+			c = '_'
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// ----------------------------------------------------------------------------
+// Rule builders. They keep the shapes the compiled grammars have: a rule list
+// is flat, a Group only where an Or sits inside a sequence, no one-child
+// Sequence or Or.
+
+func importToken(s string, pos int) *r.Rule {
+	return &r.Rule{Operator: r.Token, String: s, Pos: pos}
+}
+
+func importIdent(name string, pos int) *r.Rule {
+	return &r.Rule{Operator: r.Identifier, String: name, Pos: pos}
+}
+
+// importItems returns the items of a sequence, or the rule itself as the one item.
+func importItems(rule *r.Rule) []*r.Rule {
+	if rule.Operator == r.Sequence {
+		return *rule.Childs
+	}
+	return []*r.Rule{rule}
+}
+
+// importChilds is importItems as a rule list, the Childs of an Optional, Repeat,
+// Times or Production. An alternative is not broken up: it is one child, and
+// needs no Group there.
+func importChilds(rule *r.Rule) *r.Rules {
+	if rule.Operator == r.Group {
+		rule = (*rule.Childs)[0]
+	}
+	items := r.Rules(importItems(rule))
+	return &items
+}
+
+// importAlternatives returns the alternatives of an Or, or the rule itself.
+func importAlternatives(rule *r.Rule) []*r.Rule {
+	if rule.Operator == r.Or {
+		return *rule.Childs
+	}
+	if rule.Operator == r.Group && len(*rule.Childs) == 1 && (*rule.Childs)[0].Operator == r.Or {
+		return *(*rule.Childs)[0].Childs
+	}
+	return []*r.Rule{rule}
+}
+
+// importSeq builds a sequence. Nested sequences are flattened and an Or item is
+// grouped; no items is the empty token, which always matches.
+func importSeq(items []*r.Rule, pos int) *r.Rule {
+	var flat r.Rules
+	for _, item := range items {
+		switch {
+		case item.Operator == r.Sequence:
+			flat = append(flat, *item.Childs...)
+		case item.Operator == r.Or:
+			flat = append(flat, importGroup(item))
+		default:
+			flat = append(flat, item)
+		}
+	}
+	switch len(flat) {
+	case 0:
+		return importToken("", pos)
+	case 1:
+		if flat[0].Operator == r.Group {
+			return (*flat[0].Childs)[0]
+		}
+		return flat[0]
+	}
+	return &r.Rule{Operator: r.Sequence, Childs: &flat, Pos: pos}
+}
+
+func importGroup(rule *r.Rule) *r.Rule {
+	if rule.Operator != r.Or {
+		return rule
+	}
+	return &r.Rule{Operator: r.Group, Childs: &r.Rules{rule}, Pos: rule.Pos}
+}
+
+// importOr builds an alternative; nested alternatives are flattened.
+func importOr(alts []*r.Rule, pos int) *r.Rule {
+	var flat r.Rules
+	for _, alt := range alts {
+		flat = append(flat, importAlternatives(alt)...)
+	}
+	if len(flat) == 1 {
+		return flat[0]
+	}
+	return &r.Rule{Operator: r.Or, Childs: &flat, Pos: pos}
+}
+
+func importOptional(rule *r.Rule, pos int) *r.Rule {
+	return &r.Rule{Operator: r.Optional, Childs: importChilds(rule), Pos: pos}
+}
+
+func importRepeat(rule *r.Rule, pos int) *r.Rule {
+	return &r.Rule{Operator: r.Repeat, Childs: importChilds(rule), Pos: pos}
+}
+
+// importTimes builds from...to ( rule ); to < 0 is unbounded. The cases the
+// other operators say better are mapped to them.
+func importTimes(rule *r.Rule, from, to, pos int) *r.Rule {
+	switch {
+	case from == 0 && to < 0:
+		return importRepeat(rule, pos)
+	case from == 0 && to == 1:
+		return importOptional(rule, pos)
+	case from == 1 && to == 1:
+		return rule
+	case from == 0 && to == 0:
+		return importToken("", pos)
+	}
+	bounds := &r.Rules{&r.Rule{Operator: r.Number, Int: from, Pos: pos}}
+	if to < 0 {
+		*bounds = append(*bounds, importToken("...", pos))
+	} else if to != from {
+		*bounds = append(*bounds, &r.Rule{Operator: r.Number, Int: to, Pos: pos})
+	}
+	return &r.Rule{Operator: r.Times, CodeChilds: bounds, Childs: importChilds(rule), Pos: pos}
+}
+
+// importOneOrMore is rule { rule }, as a counted repetition.
+func importOneOrMore(rule *r.Rule, pos int) *r.Rule {
+	return importTimes(rule, 1, -1, pos)
+}
+
+func importNot(rule *r.Rule, pos int) *r.Rule {
+	if rule.Operator == r.Group {
+		rule = (*rule.Childs)[0]
+	}
+	return &r.Rule{Operator: r.Not, Childs: &r.Rules{rule}, Pos: pos}
+}
+
+func importRange(from, to rune, pos int) *r.Rule {
+	if from == to {
+		return importToken(string(from), pos)
+	}
+	return &r.Rule{Operator: r.Range, Int: r.RangeTypeRune, CodeChilds: &r.Rules{importToken(string(from), pos), importToken(string(to), pos)}, Pos: pos}
+}
+
+// importAnyChar matches any one char, the . of ANTLR and PEG.js.
+func importAnyChar(pos int) *r.Rule {
+	return importRange(0, unicode.MaxRune, pos)
+}
+
+// importNever is a rule that cannot match: a stand-in for what has no
+// translation, so the rest of the grammar still works.
+func importNever(pos int) *r.Rule {
+	return importNot(importToken("", pos), pos)
+}
+
+// importCharSet builds a char class from ranges of runes (pairs of bounds):
+// the single chars become one CharOf, each real range a Range. A negated class
+// is one char that none of them matches.
+func importCharSet(bounds [][2]rune, negated bool, pos int) *r.Rule {
+	var singles strings.Builder
+	var alts []*r.Rule
+	for _, b := range bounds {
+		if b[1]-b[0] < 3 {
+			for c := b[0]; c <= b[1]; c++ {
+				if !strings.ContainsRune(singles.String(), c) {
+					singles.WriteRune(c)
+				}
+			}
+		} else {
+			alts = append(alts, importRange(b[0], b[1], pos))
+		}
+	}
+	if singles.Len() > 0 {
+		flags := r.CharTypeRune
+		if negated {
+			flags |= r.CharTypeNegated
+		}
+		set := &r.Rule{Operator: r.CharOf, String: singles.String(), Int: flags, Pos: pos}
+		if len(alts) == 0 {
+			return set
+		}
+		if negated {
+			set.Int = r.CharTypeRune
+		}
+		alts = append([]*r.Rule{set}, alts...)
+	}
+	if len(alts) == 0 { // [] matches nothing, [^] anything.
+		if negated {
+			return importAnyChar(pos)
+		}
+		return importNever(pos)
+	}
+	set := importOr(alts, pos)
+	if negated {
+		return importSeq([]*r.Rule{importNot(set, pos), importAnyChar(pos)}, pos)
+	}
+	return set
+}
+
+// importFoldBounds adds the other case of each letter in the bounds, for the
+// case-insensitive char classes.
+func importFoldBounds(bounds [][2]rune) [][2]rune {
+	out := bounds
+	for _, b := range bounds {
+		if b[1]-b[0] > 256 {
+			continue
+		}
+		for c := b[0]; c <= b[1]; c++ {
+			for _, f := range importOtherCases(c) {
+				out = append(out, [2]rune{f, f})
+			}
+		}
+	}
+	return out
+}
+
+// importOtherCases returns the upper and lower case of c that differ from it.
+// (Not the whole Unicode fold orbit: k would also match the Kelvin sign.)
+func importOtherCases(c rune) []rune {
+	var cases []rune
+	for _, f := range []rune{unicode.ToLower(c), unicode.ToUpper(c)} {
+		if f != c && (len(cases) == 0 || cases[0] != f) {
+			cases = append(cases, f)
+		}
+	}
+	return cases
+}
+
+// importCaseless matches s in any letter case: the letters become two-char
+// sets, the runs between them tokens.
+func importCaseless(s string, pos int) *r.Rule {
+	var items []*r.Rule
+	var run strings.Builder
+	for _, c := range s {
+		folds := string(c)
+		for _, f := range importOtherCases(c) {
+			folds += string(f)
+		}
+		if folds == string(c) {
+			run.WriteRune(c)
+			continue
+		}
+		if run.Len() > 0 {
+			items = append(items, importToken(run.String(), pos))
+			run.Reset()
+		}
+		items = append(items, &r.Rule{Operator: r.CharOf, String: folds, Pos: pos})
+	}
+	if run.Len() > 0 || len(items) == 0 {
+		items = append(items, importToken(run.String(), pos))
+	}
+	return importSeq(items, pos)
+}
+
+// importMergeNot turns a lookahead on single chars in front of any char, !"a"
+// !@"bc" ., into the one negated char set it means, !@"abc": the form our
+// syntax has, and a faster one.
+func importMergeNot(rules *r.Rules) {
+	if rules == nil {
+		return
+	}
+	out := (*rules)[:0]
+	for i := 0; i < len(*rules); i++ {
+		var set strings.Builder
+		j := i
+		for ; j < len(*rules); j++ {
+			not := (*rules)[j]
+			if not.Operator != r.Not {
+				break
+			}
+			child := (*not.Childs)[0]
+			if child.Operator == r.CharOf && child.Int == r.CharTypeRune || child.Operator == r.Token && utf8.RuneCountInString(child.String) == 1 {
+				set.WriteString(child.String)
+				continue
+			}
+			break
+		}
+		if j > i && j < len(*rules) && importIsAnyChar((*rules)[j]) {
+			out = append(out, &r.Rule{Operator: r.CharOf, String: set.String(), Int: r.CharTypeNegated, Pos: (*rules)[i].Pos})
+			i = j
+			continue
+		}
+		out = append(out, (*rules)[i])
+	}
+	*rules = out
+}
+
+func importIsAnyChar(rule *r.Rule) bool {
+	from, to, ok := rangeBounds(rule)
+	return ok && rule.Operator == r.Range && rule.Int == r.RangeTypeRune && from == 0 && to == unicode.MaxRune
+}
+
+// importWalk calls fn for every rule in rules and below, code parameters
+// excluded.
+func importWalk(rules *r.Rules, fn func(rule *r.Rule)) {
+	if rules == nil {
+		return
+	}
+	for _, rule := range *rules {
+		fn(rule)
+		importWalk(rule.Childs, fn)
+	}
+}
+
+// importEscape resolves one backslash escape of the C family at s (which starts
+// after the backslash) and returns the char and the length consumed. It knows
+// the escapes ANTLR and JavaScript share; others stand for the char itself.
+func importEscape(s string) (rune, int) {
+	if s == "" {
+		return '\\', 0
+	}
+	hex := func(digits string) (rune, bool) {
+		var v rune
+		for _, d := range digits {
+			switch {
+			case d >= '0' && d <= '9':
+				v = v*16 + d - '0'
+			case d >= 'a' && d <= 'f':
+				v = v*16 + d - 'a' + 10
+			case d >= 'A' && d <= 'F':
+				v = v*16 + d - 'A' + 10
+			default:
+				return 0, false
+			}
+		}
+		return v, digits != ""
+	}
+	switch s[0] {
+	case 'n':
+		return '\n', 1
+	case 'r':
+		return '\r', 1
+	case 't':
+		return '\t', 1
+	case 'b':
+		return '\b', 1
+	case 'f':
+		return '\f', 1
+	case 'v':
+		return '\v', 1
+	case '0':
+		return 0, 1
+	case 'x':
+		if len(s) >= 3 {
+			if v, ok := hex(s[1:3]); ok {
+				return v, 3
+			}
+		}
+	case 'u':
+		if strings.HasPrefix(s, "u{") {
+			if end := strings.IndexByte(s, '}'); end > 2 {
+				if v, ok := hex(s[2:end]); ok {
+					return v, end + 1
+				}
+			}
+		}
+		if len(s) >= 5 {
+			if v, ok := hex(s[1:5]); ok {
+				return v, 5
+			}
+		}
+	}
+	c, size := utf8.DecodeRuneInString(s)
+	return c, size
+}
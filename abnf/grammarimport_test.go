@@ -0,0 +1,82 @@
+package abnf
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestImportGrammar imports one grammar per notation, parses a text with each
+// result directly, then writes the result as source and parses the text again
+// with what that source compiles to. The inputs lean on the translations that
+// are no one-to-one mapping: ABNF's case-insensitive strings, counts and =/,
+// ANTLR's left recursion, skipped tokens and non-greedy loop, PEG.js's
+// lookaheads.
+func TestImportGrammar(t *testing.T) {
+	tests := []struct {
+		format, file, grammar string
+		good, bad             string
+		wants                 []string // In the written source.
+	}{
+		{"rfc5234", "date.abnf", `
+; A date, the RFC 3339 way
+date        = date-fullyear "-" date-month "-" date-mday [ "T" time ]
+date-fullyear = 4DIGIT
+date-month  = 2DIGIT
+date-mday   = 2DIGIT
+time        = 2DIGIT ":" 2DIGIT *1( ":" 2DIGIT ) zone
+zone        = "Z"
+zone        =/ %x2B / %x2D.2D
+`, "2024-02-29t12:30:59--", "2024-2-29",
+			[]string{":whitespace() ;", `date_fullyear = 4 ( DIGIT ) ;`, `@"Tt"`, `zone          = @"Zz" | "+" | "--" ;`, `DIGIT         = "0"..."9" ;`}},
+
+		{"antlr", "Calc.g4", `
+grammar Calc;
+prog : expr EOF ;
+expr : expr ('*'|'/') expr | expr ('+'|'-') expr | INT | '(' expr ')' ;
+INT : [0-9]+ ;
+COMMENT : '/*' .*? '*/' -> skip ;
+WS : [ \t\r\n]+ -> skip ;
+`, "1 + 2*(3 /* three */ - 4)", "1 + * 2",
+			[]string{":startRule(prog) ;", ":whitespace(Skipped) ;", `expr        = ( INT | "(" expr ")" ) { ( "*" | "/" ) expr | ( "+" | "-" ) expr } ;`,
+				`INT         = "" :whitespace() 1... ( "0"..."9" ) ;`, `COMMENT     = "/*" { !"*/" "\x00"..."\U0010ffff" } "*/" ;`, "Skipped     = { COMMENT | WS } ;"}},
+
+		{"pegjs", "list.pegjs", `
+{ const keep = []; }
+List "list" = head:Word tail:("," _ w:Word { return w; })* { return [head, ...tail]; }
+Word = $(!"end" [a-z]i+) / Quoted
+Quoted = "'" chars:(!['\\] . / "\\" .)* "'"
+_ = [ ]*
+`, "abc, 'x\\'y', Def", "abc, end",
+			[]string{`Word        = !"end" 1... ( @"ABCDEFGHIJKLMNOPQRSTUVWXYZ" | "a"..."z" ) | Quoted ;`, `!@"'\\"`}},
+	}
+	for _, test := range tests {
+		g, err := ImportGrammar(test.format, test.grammar, test.file)
+		if err != nil {
+			t.Fatalf("-import %s: %v", test.format, err)
+		}
+		if _, err := ParseWithAgrammar(g, test.good, "good.txt", &Parseropts{PreventDefaultOutput: true}); err != nil {
+			t.Errorf("-import %s: the imported grammar rejects %q: %v", test.format, test.good, err)
+		}
+		if _, err := ParseWithAgrammar(g, test.bad, "bad.txt", &Parseropts{PreventDefaultOutput: true}); err == nil {
+			t.Errorf("-import %s: the imported grammar accepts %q", test.format, test.bad)
+		}
+
+		src := GrammarSource(g)
+		for _, want := range test.wants {
+			if !strings.Contains(src, want) {
+				t.Errorf("-import %s: missing %q in:\n%s", test.format, want, src)
+			}
+		}
+		asg, err := ParseWithAgrammar(AbnfAgrammar, src, "imported.abnf", &Parseropts{PreventDefaultOutput: true})
+		if err != nil {
+			t.Fatalf("-import %s: the written source does not parse: %v\n%s", test.format, err, src)
+		}
+		compiled, err := CompileASG(asg, AbnfAgrammar, "imported.abnf", 0, false, true)
+		if err != nil {
+			t.Fatalf("-import %s: the written source does not compile: %v", test.format, err)
+		}
+		if _, err := ParseWithAgrammar(compiled, test.good, "good.txt", &Parseropts{PreventDefaultOutput: true}); err != nil {
+			t.Errorf("-import %s: the written source rejects %q: %v", test.format, test.good, err)
+		}
+	}
+}
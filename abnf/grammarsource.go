@@ -0,0 +1,258 @@
+package abnf
+
+// Writing an a-grammar back as annotated EBNF source: what -import prints, so
+// an imported grammar becomes a .abnf file that the user extends with tags.
+// Compiling the written text yields the a-grammar it was written from again,
+// up to the grouping of sequences (which changes nothing about what matches).
+//
+// One construct has no spelling: the source syntax writes a negative lookahead
+// only in front of a token (!"x"), while a Not of any other rule comes from an
+// importer (PEG.js's !e and &e, ANTLR's non-greedy loops). It is written as a
+// comment in place, with a warning; the a-grammar itself keeps it.
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf/r"
+)
+
+// GrammarSource writes grammar in the syntax of languages/abnf-of-abnf.abnf.
+func GrammarSource(grammar *r.Rules) string {
+	var b strings.Builder
+	w := &sourceWriter{}
+	width := 0
+	for _, rule := range *grammar {
+		if rule.Operator == r.Production && utf8.RuneCountInString(rule.String) <= 16 {
+			width = rrMax(width, utf8.RuneCountInString(rule.String))
+		}
+	}
+	width = rrMax(width, 11)
+	last := r.Error
+	for _, rule := range *grammar {
+		switch rule.Operator {
+		case r.Command:
+			if rule.String == "origin" { // CompileASG stamps it again.
+				continue
+			}
+			if last == r.Production {
+				b.WriteString("\n")
+			}
+			b.WriteString(w.command(rule) + " ;\n")
+			if rule.String == "description" || rule.String == "startScript" {
+				b.WriteString("\n")
+			}
+		case r.Production:
+			if last == r.Command {
+				b.WriteString("\n")
+			}
+			name := rule.String
+			if childs := rule.Childs; childs != nil && len(*childs) == 1 && (*childs)[0].Operator == r.Tag && (*childs)[0].CodeChilds != nil {
+				// A tag around the whole production is written on the name.
+				name += " " + w.tagCode((*childs)[0])
+				fmt.Fprintf(&b, "%-*s = %s ;\n", width, name, w.seq((*childs)[0].Childs))
+			} else {
+				fmt.Fprintf(&b, "%-*s = %s ;\n", width, name, w.seq(childs))
+			}
+		}
+		last = rule.Operator
+	}
+	if w.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %d lookahead(s) of more than a token cannot be written as source; they are comments in the output\n", w.dropped)
+	}
+	return b.String()
+}
+
+type sourceWriter struct {
+	dropped int // The Not rules written as comments.
+}
+
+// The precedences of the written expressions: an alternative needs ( ) inside a
+// sequence, a sequence inside a tag.
+const (
+	srcAlt = iota
+	srcSeq
+	srcAtom
+)
+
+// seq writes a rule list as a sequence.
+func (w *sourceWriter) seq(rules *r.Rules) string {
+	if rules == nil || len(*rules) == 0 {
+		return `""`
+	}
+	if len(*rules) == 1 { // The only item: an alternative needs no ( ).
+		return w.expr((*rules)[0], srcAlt)
+	}
+	var items []string
+	for _, rule := range *rules {
+		items = append(items, w.expr(rule, srcSeq))
+	}
+	return strings.Join(items, " ")
+}
+
+// expr writes rule for a place that needs at least the precedence prec.
+func (w *sourceWriter) expr(rule *r.Rule, prec int) string {
+	switch rule.Operator {
+	case r.Sequence:
+		s := w.seq(rule.Childs)
+		if prec > srcSeq && len(*rule.Childs) > 1 {
+			return "( " + s + " )"
+		}
+		return s
+	case r.Group:
+		return "( " + w.seq(rule.Childs) + " )"
+	case r.Or:
+		var alts []string
+		for _, alt := range *rule.Childs {
+			alts = append(alts, w.expr(alt, srcSeq))
+		}
+		if prec > srcAlt {
+			return "( " + strings.Join(alts, " | ") + " )"
+		}
+		return strings.Join(alts, " | ")
+	case r.Optional:
+		return "[ " + w.seq(rule.Childs) + " ]"
+	case r.Repeat:
+		return "{ " + w.seq(rule.Childs) + " }"
+	case r.Times:
+		var bounds []string
+		for _, bound := range *rule.CodeChilds {
+			switch bound.Operator {
+			case r.Number:
+				bounds = append(bounds, strconv.Itoa(bound.Int))
+			case r.Command:
+				bounds = append(bounds, w.command(bound))
+			case r.Token: // The open upper bound.
+				bounds = append(bounds, "")
+			}
+		}
+		return strings.Join(bounds, "...") + " ( " + w.seq(rule.Childs) + " )"
+	case r.Token:
+		return sourceToken(rule.String)
+	case r.Identifier:
+		return rule.String
+	case r.Range:
+		op := "..."
+		if rule.Int == r.RangeTypeByte {
+			op = "..b"
+		}
+		return sourceToken((*rule.CodeChilds)[0].String) + op + sourceToken((*rule.CodeChilds)[1].String)
+	case r.CharOf, r.CharsOf:
+		prefix := "@"
+		if rule.Int&r.CharTypeNegated != 0 {
+			prefix = "!@"
+		}
+		if rule.Int&r.CharTypeByte != 0 {
+			prefix += "b"
+		}
+		if rule.Operator == r.CharsOf {
+			prefix += "+"
+		}
+		return prefix + sourceToken(rule.String)
+	case r.Not:
+		if child := (*rule.Childs)[0]; child.Operator == r.Token {
+			return "!" + sourceToken(child.String)
+		}
+		w.dropped++
+		return "/* not " + strings.Replace(w.expr((*rule.Childs)[0], srcAtom), "*/", "* /", -1) + " */"
+	case r.Tag:
+		if childs := *rule.Childs; len(childs) == 1 && childs[0].Operator != r.Sequence && childs[0].Operator != r.Or && childs[0].Operator != r.Tag {
+			return w.expr(childs[0], srcAtom) + " " + w.tagCode(rule)
+		}
+		return "( " + w.seq(rule.Childs) + " ) " + w.tagCode(rule)
+	case r.Command:
+		return w.command(rule)
+	}
+	return "/* " + rule.Operator.String() + " */"
+}
+
+// tagCode writes the <~~ code ~~> of a tag, or its slots <A, B>.
+func (w *sourceWriter) tagCode(tag *r.Rule) string {
+	var parts []string
+	for _, code := range *tag.CodeChilds {
+		if code.Operator == r.Identifier {
+			parts = append(parts, code.String)
+		} else {
+			parts = append(parts, sourceCode(code.String))
+		}
+	}
+	return "<" + strings.Join(parts, ", ") + ">"
+}
+
+// command writes :name(params); code and text with line breaks keep their form.
+func (w *sourceWriter) command(rule *r.Rule) string {
+	var params []string
+	if rule.CodeChilds != nil {
+		for _, param := range *rule.CodeChilds {
+			switch param.Operator {
+			case r.Identifier:
+				params = append(params, param.String)
+			case r.Number:
+				params = append(params, strconv.Itoa(param.Int))
+			case r.Token:
+				switch {
+				case rule.String == "script" || rule.String == "startScript":
+					params = append(params, sourceCode(param.String))
+				case strings.Contains(param.String, "\n") && sourcePlain(param.String):
+					params = append(params, `"`+param.String+`"`) // A :description() stays readable.
+				default:
+					params = append(params, sourceToken(param.String))
+				}
+			}
+		}
+	}
+	return ":" + rule.String + "(" + strings.Join(params, ", ") + ")"
+}
+
+// sourceToken quotes s as a token: printable ASCII stays, the rest is escaped
+// the way r.Unescape reads it back.
+func sourceToken(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		c, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case c == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c >= 0x20 && c < 0x7f:
+			b.WriteRune(c)
+		case c < 0x80:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		case c <= 0xffff:
+			fmt.Fprintf(&b, `\u%04x`, c)
+		default:
+			fmt.Fprintf(&b, `\U%08x`, c)
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// sourcePlain tells whether s can stand in quotes as it is: printable ASCII
+// and line breaks, no quote and no backslash.
+func sourcePlain(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < 0x20 || c >= 0x7f || c == '"' || c == '\\') && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceCode writes code as ~~ ~~ block, with its tildes escaped.
+func sourceCode(code string) string {
+	return "~~" + strings.Replace(code, "~", `\~`, -1) + "~~"
+}
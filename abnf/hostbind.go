@@ -0,0 +1,82 @@
+package abnf
+
+// Go values of an embedding program for the tag scripts. An embedder that
+// wants its own functions callable from tags (a database lookup, a symbol
+// table, code signing) registers them for every engine of the process, or
+// binds them to one engine:
+//
+//	abnf.RegisterHostFunc("lookup", func(name string) (int, error) { ... })
+//	eng := abnf.NewEngine()
+//	eng.Bind("symbols", &SymbolTable{...})
+//
+// Each becomes a global of the tag scripts of both engines: set with vm.Set
+// under goja, and given to the frozen runtime as a binding, where the
+// reflection bridge that already carries up, c.* and llvm.* calls and reads it
+// (jsrt.go: reflectCall, convertToType, getGoMember). The bridge converts the
+// way goja does, so a grammar sees the same values under either engine:
+//
+//   - arguments: a JS number to any Go integer or float type, a string to a
+//     string, anything to a bool by truthiness, an array to a slice (elementwise),
+//     an object to a map[string]T, null or undefined to the zero value, and
+//     to an interface{} the natural Go value (an integral number as int64);
+//     missing arguments are undefined, and a variadic parameter takes the rest.
+//   - results: none is undefined, one is the value, several are an array; a
+//     trailing error result is dropped when nil and aborts the tag otherwise.
+//   - values: Go numbers read as JS numbers, strings as strings; a map reads
+//     its keys as members, a slice its elements and length, a struct its
+//     exported fields and methods, by their Go names.
+//
+// A binding of the engine wins over a registered function of the same name,
+// and both win over the built-in API, include and eval too (a grammar's own
+// globals win over all). Only what belongs to the running tag stays: up, ltr
+// and the stack functions push, pop, pushg and popg.
+// TestHostBindings runs one grammar over all of it on both engines.
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	hostFuncsMu sync.RWMutex
+	hostFuncs   = map[string]interface{}{} // RegisterHostFunc's, by name.
+)
+
+// RegisterHostFunc makes the Go function fn a global of the tag scripts of
+// every engine, under name. It panics if fn is not a function: registrations
+// run at init time, where a mistake should fail loudly.
+func RegisterHostFunc(name string, fn interface{}) {
+	if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+		panic(fmt.Sprintf("abnf.RegisterHostFunc(%q): %T is not a function", name, fn))
+	}
+	hostFuncsMu.Lock()
+	defer hostFuncsMu.Unlock()
+	hostFuncs[name] = fn
+}
+
+// Bind makes value, a Go function or any other Go value, a global of the tag
+// scripts of the engine's sessions, under name. Sessions made before the call
+// do not see it.
+func (e *Engine) Bind(name string, value interface{}) {
+	bindings := make(map[string]interface{}, len(e.Bindings)+1)
+	for k, v := range e.Bindings { // A copy: the sessions made so far keep theirs.
+		bindings[k] = v
+	}
+	bindings[name] = value
+	e.Bindings = bindings
+}
+
+// hostBindings are the embedder's globals of the session's tag scripts.
+func (s *Session) hostBindings() map[string]interface{} {
+	hostFuncsMu.RLock()
+	all := make(map[string]interface{}, len(hostFuncs)+len(s.Bindings))
+	for name, fn := range hostFuncs {
+		all[name] = fn
+	}
+	hostFuncsMu.RUnlock()
+	for name, v := range s.Bindings {
+		all[name] = v
+	}
+	return all
+}
@@ -0,0 +1,94 @@
+package abnf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testSymbols struct {
+	Name string
+	syms map[string]int
+}
+
+func (t *testSymbols) Size() int { return len(t.syms) }
+
+func (t *testSymbols) Lookup(name string) (int, error) {
+	if v, ok := t.syms[name]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("no symbol %q", name)
+}
+
+// TestHostBindings calls Go functions and reads Go values of an embedder from
+// a start script on both engines: the arguments and the results convert the
+// same way under goja and -frozen, and a failing call aborts the tag on both.
+func TestHostBindings(t *testing.T) {
+	RegisterHostFunc("testAdd", func(a, b int) int { return a + b })
+	defer func() {
+		hostFuncsMu.Lock()
+		delete(hostFuncs, "testAdd")
+		hostFuncsMu.Unlock()
+	}()
+	src := `:startRule(T) ;
+T = "A" ;
+:startScript(~~
+    println(testAdd(2, 3.9) + " " + testAdd("4", true))
+    println(join(["a", "b", 3], "-") + " " + count({x: 1, y: 2}))
+    println(kinds(1, 1.5, "s", true, null, [1], {a: 1}))
+    let parts = split("a,b,c")
+    println(parts.length + " " + parts[1])
+    let p = pair(7)
+    println(p.length + " " + p[0] + " " + p[1])
+    println(symbols.Name + " " + symbols.Size() + " " + symbols.Lookup("x"))
+    println(config.mode + " " + config.level + " " + config.missing)
+    symbols.Lookup("nope")
+~~) ;
+`
+	want := "5 5\na-b-3 2\nint64 float64 string bool <nil> []interface {} map[string]interface {}\n3 b\n2 7 seven\nsyms 1 42\nfast 3 undefined\n"
+	bind := func(eng *Engine) {
+		eng.Bind("join", strings.Join)
+		eng.Bind("count", func(m map[string]int) int { return len(m) })
+		eng.Bind("kinds", func(vs ...interface{}) string {
+			ks := make([]string, len(vs))
+			for i, v := range vs {
+				ks[i] = fmt.Sprintf("%T", v)
+			}
+			return strings.Join(ks, " ")
+		})
+		eng.Bind("split", func(s string) []string { return strings.Split(s, ",") })
+		eng.Bind("pair", func(n int) (int, string) { return n, "seven" })
+		eng.Bind("symbols", &testSymbols{Name: "syms", syms: map[string]int{"x": 42}})
+		eng.Bind("config", map[string]interface{}{"mode": "fast", "level": 3})
+	}
+	bothEngines(t, func(t *testing.T, frozen bool) {
+		out, err := runGrammar(t, src, &grammarRun{frozen: frozen, engine: bind})
+		if err == nil || !strings.Contains(err.Error(), `no symbol "nope"`) {
+			t.Errorf("the failing Lookup gave %v", err)
+		}
+		if out != want {
+			t.Errorf("the script printed\n%s\nwant\n%s", out, want)
+		}
+	})
+}
+
+// TestHostBindingsOverride binds include, a built-in of the scripts, and
+// expects the binding to win in the parser's :script() and in the start script
+// on both engines.
+func TestHostBindingsOverride(t *testing.T) {
+	src := `:startRule(T) ;
+T = "A" :script(~~ println(include("parse")); abnf.newToken("", 0) ~~) ;
+:startScript(~~ println(include("compile")) ~~) ;
+`
+	bothEngines(t, func(t *testing.T, frozen bool) {
+		out, err := runGrammar(t, src, &grammarRun{frozen: frozen, engine: func(eng *Engine) {
+			eng.Bind("include", func(name string) string { return "host include " + name })
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "host include parse\nhost include compile\n"; out != want {
+			t.Errorf("the scripts printed\n%s\nwant\n%s", out, want)
+		}
+	})
+}
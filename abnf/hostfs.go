@@ -0,0 +1,240 @@
+package abnf
+
+// The filesystem, environment and path API of the tag scripts, next to load()
+// and store():
+//
+//	fs.exists(p)       true when p names a file or a directory
+//	fs.stat(p)         {name, size, isDir, modTime} (modTime in ms since the
+//	                   epoch), or null when p does not exist
+//	fs.readDir(p)      the names in directory p, sorted
+//	fs.glob(pattern)   the paths that match pattern (filepath.Match syntax),
+//	                   sorted and spelled like the pattern: relative ones stay
+//	                   relative, so they go to load() as they are
+//	fs.mkdirAll(p)     create p and its missing parents
+//	path.join(a, ...)  path.dir(p)  path.base(p)  path.rel(base, target)
+//	env.get(name)      the environment variable, "" when it is not set
+//
+// A relative fs path is resolved against the directory of the script's module
+// file, as load() resolves it; an absolute one is taken as it is. The path.*
+// functions only compute: they touch nothing and resolve nothing. fs.exists and
+// fs.stat also see the files of a language pack, which load() reads from it.
+// A failure (a missing directory for readDir, a bad pattern, rel of paths that
+// have no relation) aborts the script like a failed load().
+//
+// Both script hosts bind the same functions (commonscript.go for goja and
+// frozenHostFSBindings for -frozen) over the helpers below, and return real
+// arrays and objects of their engine, so a grammar sees the same values under
+// either: tests/hostapi-test.abnf runs them in the goja/-frozen matrix.
+//
+// Under a sandbox (sandbox.go) the fs functions touch nothing outside its
+// directories and env.get answers "" for every name.
+//
+// abnf.saveRules and abnf.loadRules are file APIs too: abnfFuncs gives each
+// script versions that resolve the file like store() and load(), and go
+// through the same Session helpers, so they see the pack and obey the sandbox.
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"14.gy/mec/abnf/r"
+)
+
+// hostStat is what fs.stat returns.
+type hostStat struct {
+	name    string
+	size    int64
+	isDir   bool
+	modTime int64 // Milliseconds since the epoch.
+}
+
+// hostPath resolves the fs path p of a script whose module file is module.
+func hostPath(module, p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(filepath.Dir(module), p)
+}
+
+func (s *Session) hostExists(p string) bool {
+	if _, ok := s.pack.files[p]; ok {
+		return true
+	}
+	s.sandboxAccess(p)
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func (s *Session) hostStat(p string) (hostStat, bool) {
+	if dat, ok := s.pack.files[p]; ok {
+		return hostStat{name: filepath.Base(p), size: int64(len(dat))}, true
+	}
+	s.sandboxAccess(p)
+	fi, err := os.Stat(p)
+	if err != nil {
+		return hostStat{}, false
+	}
+	return hostStat{fi.Name(), fi.Size(), fi.IsDir(), fi.ModTime().UnixNano() / 1e6}, true
+}
+
+func (s *Session) hostReadDir(p string) []string {
+	s.sandboxAccess(p)
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		panic(err)
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names
+}
+
+// hostGlob matches pattern against the filesystem from the module's directory
+// and returns the matches spelled relative to it, unless pattern is absolute.
+// The sandbox checks the pattern alone: its matches lie below the pattern's
+// directory.
+func (s *Session) hostGlob(module, pattern string) []string {
+	s.sandboxAccess(hostPath(module, pattern))
+	matches, err := filepath.Glob(hostPath(module, pattern))
+	if err != nil {
+		panic(err)
+	}
+	if !filepath.IsAbs(pattern) {
+		dir := filepath.Dir(module)
+		for i, m := range matches {
+			if rel, err := filepath.Rel(dir, m); err == nil {
+				matches[i] = rel
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func (s *Session) hostMkdirAll(p string) {
+	s.sandboxAccess(p)
+	if err := os.MkdirAll(p, 0755); err != nil {
+		panic(err)
+	}
+}
+
+func (s *Session) hostGetenv(name string) string {
+	if s.sandbox != nil {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+func hostRel(base, target string) string {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		panic(err)
+	}
+	return rel
+}
+
+// abnfFuncs is the abnf object of a script whose module file is module():
+// r.AbnfFuncMap plus saveRules and loadRules, which write and read an a-grammar
+// or an ASG in the interchange format of r.Marshal (see the README).
+func (s *Session) abnfFuncs(module func() string) map[string]r.Object {
+	funcs := make(map[string]r.Object, len(r.AbnfFuncMap))
+	for name, f := range r.AbnfFuncMap {
+		funcs[name] = f
+	}
+	funcs["saveRules"] = func(rules *r.Rules, fileName string, format string) {
+		data, err := r.Marshal(rules, r.RulesFileFormat(fileName, format))
+		if err == nil {
+			err = s.writeHostFile(hostPath(module(), fileName), string(data))
+		}
+		if err != nil {
+			panic(hostFileError("saveRules", err))
+		}
+	}
+	funcs["loadRules"] = func(fileName string) *r.Rules {
+		data, err := s.readHostFile(hostPath(module(), fileName))
+		var rules *r.Rules
+		if err == nil {
+			rules, err = r.Unmarshal(data)
+		}
+		if err != nil {
+			panic(hostFileError("loadRules: "+fileName, err))
+		}
+		return rules
+	}
+	return funcs
+}
+
+// hostFileError is what a failed file API of the scripts panics with: the
+// sandbox's own error as it is (recoveredError keeps it), any other prefixed.
+func hostFileError(prefix string, err error) interface{} {
+	if denied, ok := err.(*SandboxError); ok {
+		return denied
+	}
+	return prefix + ": " + err.Error()
+}
+
+// frozenHostFSBindings are fs, path and env for the frozen engines; module
+// returns the module file of the running script.
+func frozenHostFSBindings(s *Session, module func() string) map[string]interface{} {
+	str := func(args []interface{}, i int, rt *jsrt) string { return rt.toString(argAt(args, i)) }
+	strings := func(list []string) *jsArray {
+		arr := &jsArray{elems: make([]interface{}, len(list))}
+		for i, v := range list {
+			arr.elems[i] = v
+		}
+		return arr
+	}
+	fs := map[string]interface{}{
+		"exists": jsHostFunc("exists", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			return s.hostExists(hostPath(module(), str(args, 0, rt)))
+		}),
+		"stat": jsHostFunc("stat", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			st, ok := s.hostStat(hostPath(module(), str(args, 0, rt)))
+			if !ok {
+				return jsNull
+			}
+			o := newJSObject()
+			o.set("name", st.name)
+			o.set("size", float64(st.size))
+			o.set("isDir", st.isDir)
+			o.set("modTime", float64(st.modTime))
+			return o
+		}),
+		"readDir": jsHostFunc("readDir", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			return strings(s.hostReadDir(hostPath(module(), str(args, 0, rt))))
+		}),
+		"glob": jsHostFunc("glob", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			return strings(s.hostGlob(module(), str(args, 0, rt)))
+		}),
+		"mkdirAll": jsHostFunc("mkdirAll", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			s.hostMkdirAll(hostPath(module(), str(args, 0, rt)))
+			return jsUndef
+		}),
+	}
+	path := map[string]interface{}{
+		"join": jsHostFunc("join", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			parts := make([]string, len(args))
+			for i := range args {
+				parts[i] = str(args, i, rt)
+			}
+			return filepath.Join(parts...)
+		}),
+		"dir": jsHostFunc("dir", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			return filepath.Dir(str(args, 0, rt))
+		}),
+		"base": jsHostFunc("base", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			return filepath.Base(str(args, 0, rt))
+		}),
+		"rel": jsHostFunc("rel", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			return hostRel(str(args, 0, rt), str(args, 1, rt))
+		}),
+	}
+	env := map[string]interface{}{
+		"get": jsHostFunc("get", func(rt *jsrt, this uint64, args []interface{}) interface{} {
+			return s.hostGetenv(str(args, 0, rt))
+		}),
+	}
+	return map[string]interface{}{"fs": fs, "path": path, "env": env}
+}
@@ -0,0 +1,40 @@
+package abnf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestHostFS runs the fs, path and env API of the scripts on both engines:
+// paths resolve against the grammar's directory, not the working directory,
+// fs.mkdirAll creates what the later calls see, and both print the same.
+func TestHostFS(t *testing.T) {
+	os.Setenv("MEC_HOSTFS_TEST", "set")
+	defer os.Unsetenv("MEC_HOSTFS_TEST")
+	src := `:startRule(Test) ;
+Test = "A" ;
+:startScript(~~
+    fs.mkdirAll("out/sub")
+    store("out/sub/b.txt", "bb")
+    store("out/a.txt", "a")
+    println(fs.exists("out/sub") + " " + fs.stat("out/sub").isDir + " " + fs.stat("out/sub/b.txt").size)
+    println(fs.readDir("out").join(","))
+    let found = fs.glob(path.join("out", "*", "*.txt"))
+    println(found.join(",") + " " + load(found[0]))
+    println(path.rel(path.dir(found[0]), "out/a.txt") + " " + path.base(found[0]))
+    println(env.get("MEC_HOSTFS_TEST") + " " + fs.stat("missing"))
+~~) ;
+`
+	want := "true true 2\na.txt,sub\n" + filepath.Join("out", "sub", "b.txt") + " bb\n" +
+		filepath.Join("..", "a.txt") + " b.txt\nset null\n"
+	bothEngines(t, func(t *testing.T, frozen bool) {
+		out, err := runGrammar(t, src, &grammarRun{frozen: frozen})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("the script printed\n%s\nwant\n%s", out, want)
+		}
+	})
+}
@@ -0,0 +1,647 @@
+package abnf
+
+// The ANTLR4 importer (-import antlr): combined, parser and lexer grammars
+// (.g4). A parser grammar's options { tokenVocab = L; } and an import of other
+// grammars are read from L.g4 next to it, so a split grammar imports from its
+// parser half.
+//
+// ANTLR tokenizes first and parses the tokens; the a-grammar does both in one
+// pass. A parser rule (lower case name) therefore reads its literals with the
+// whitespace skipped in between, and a lexer rule (upper case name) becomes a
+// production that skips the whitespace once, in front, and then switches
+// skipping off: X = "" :whitespace() ... ; - the empty token is where the skip
+// happens. Fragments are called from lexer rules only and need neither. The
+// rules sent to -> skip or to a -> channel() are collected into the whitespace
+// production (Skipped = { WS | COMMENT }).
+//
+// What the lexer decides and a one-pass parser cannot: ANTLR's lexer takes the
+// longest token and, on a tie, the rule that comes first, so an ID rule never
+// swallows the keyword 'if' and 'in' never matches the front of 'int'. Here
+// the first alternative that matches wins, so keywords may have to be guarded
+// by hand in the result (the usual !@"..." after the token).
+//
+// The translation of the rest:
+//
+//	'abc'  [a-z_]  ~[\r\n]  'a'..'z'  .    tokens, char sets and ranges
+//	x? x* x+ (a | b)                       [ x ], { x }, 1... ( x ), groups
+//	x*? y  x+? y                           { !y x } y, x { !y x } y: non-greedy
+//	a : a '+' b | b ;                      a = b { "+" b } ;
+//	label=x  #Alt  {action}  <assoc=right> dropped
+//	{predicate}?                           dropped, with a warning
+//	EOF                                    dropped: a parse always reads all
+//
+// The start rule is the first parser rule that ends with EOF, else the first
+// parser rule.
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf/r"
+)
+
+// antlrImport holds what the rules of all files of one grammar share.
+type antlrImport struct {
+	*grammarImport
+	mainFile    string          // The file -import was given; the others are loaded.
+	lexer       map[string]bool // Lexer rules, fragments included.
+	fragments   map[string]bool
+	skipped     []string // The rules that end in -> skip or -> channel(), in order.
+	declared    map[string]bool
+	usesEOF     map[string]bool
+	caseless    bool
+	pending     []string // Files to read after this one (tokenVocab, import).
+	loaded      map[string]bool
+	title       string // The name of the main grammar.
+	firstParser string
+
+	// The rule being read.
+	inLexerRule, ruleUsesEOF, ruleSkipped bool
+}
+
+func (im *grammarImport) importANTLR() *r.Rules {
+	a := &antlrImport{grammarImport: im, mainFile: im.file, lexer: map[string]bool{}, fragments: map[string]bool{}, declared: map[string]bool{},
+		usesEOF: map[string]bool{}, loaded: map[string]bool{filepath.Clean(im.file): true}}
+	a.file()
+	mainSrc := im.src
+	for len(a.pending) > 0 {
+		path := a.pending[0]
+		a.pending = a.pending[1:]
+		dat, err := os.ReadFile(path)
+		if err != nil {
+			im.fail(0, "cannot read %s: %v", path, err)
+		}
+		im.file, im.src, im.pos = path, StripBOM(string(dat)), 0
+		a.file()
+	}
+	im.file, im.src = a.mainFile, mainSrc
+	if len(im.prods) == 0 {
+		im.fail(0, "no rules found")
+	}
+
+	// Tokens only named in tokens { } (set by actions or a lexer we do not have)
+	// cannot match anything here.
+	im.checkReferences(func(name string, pos int) bool {
+		if !a.declared[name] {
+			return false
+		}
+		im.warn(pos, "the token %s has no lexer rule; it never matches", name)
+		im.define(name, importNever(pos), pos, false)
+		return true
+	})
+
+	// A lexer rule used as a token skips the whitespace in front of it and
+	// none inside.
+	for _, prod := range im.prods {
+		if a.lexer[prod.String] && !a.fragments[prod.String] {
+			*prod.Childs = append(r.Rules{importToken("", prod.Pos), &r.Rule{Operator: r.Command, String: "whitespace", Pos: prod.Pos}}, *prod.Childs...)
+		}
+	}
+	whitespace := ""
+	if len(a.skipped) > 0 {
+		var alts []*r.Rule
+		for _, name := range a.skipped {
+			prod := im.byName[name]
+			if !a.fragments[name] {
+				*prod.Childs = (*prod.Childs)[2:] // Applied as whitespace, the skipping is off anyway.
+			}
+			alts = append(alts, importIdent(name, prod.Pos))
+		}
+		whitespace = im.uniqueName("Skipped")
+		im.define(whitespace, importRepeat(importOr(alts, 0), 0), 0, false)
+	}
+	im.removeLeftRecursion()
+
+	start := a.firstParser
+	for _, prod := range im.prods {
+		if a.usesEOF[prod.String] {
+			start = prod.String
+			break
+		}
+	}
+	if start == "" {
+		start = im.prods[0].String
+	}
+	return im.grammar(a.title, "ANTLR4", start, whitespace)
+}
+
+// file reads one .g4 file: the grammar declaration, the prequel and the rules.
+func (a *antlrImport) file() {
+	a.skipCStyle()
+	for _, kind := range []string{"lexer", "parser"} {
+		if a.atWord(kind) {
+			a.ident("")
+			a.skipCStyle()
+		}
+	}
+	if !a.atWord("grammar") {
+		a.fail(a.pos, "expected a grammar declaration")
+	}
+	a.ident("")
+	a.skipCStyle()
+	if name := a.ident(""); a.title == "" {
+		a.title = name
+	}
+	a.skipCStyle()
+	a.expect(";")
+	for a.skipCStyle(); !a.eof(); a.skipCStyle() {
+		switch {
+		case a.atWord("options"):
+			a.ident("")
+			a.skipCStyle()
+			a.options(a.skipBalanced('{', '}'))
+		case a.atWord("tokens"):
+			a.ident("")
+			a.skipCStyle()
+			block := a.skipBalanced('{', '}')
+			for _, name := range strings.FieldsFunc(block[1:len(block)-1], func(c rune) bool { return c == ',' || unicode.IsSpace(c) }) {
+				a.declared[importName(name)] = true
+			}
+		case a.atWord("channels"):
+			a.ident("")
+			a.skipCStyle()
+			a.skipBalanced('{', '}')
+		case a.atWord("import"):
+			a.ident("")
+			for a.skipCStyle(); !a.at(";"); a.skipCStyle() {
+				name := a.ident("")
+				if a.skipCStyle(); a.at("=") { // import Alias = Name;
+					a.pos++
+					a.skipCStyle()
+					name = a.ident("")
+				}
+				if name == "" {
+					a.fail(a.pos, "expected a grammar name")
+				}
+				a.load(name)
+				if a.skipCStyle(); a.at(",") {
+					a.pos++
+				}
+			}
+			a.pos++
+		case a.at("@"):
+			a.pos++
+			a.ident("")
+			if a.at("::") {
+				a.pos += 2
+				a.ident("")
+			}
+			a.skipCStyle()
+			a.skipBalanced('{', '}')
+		case a.atWord("mode"):
+			a.fail(a.pos, "lexer modes are not supported: the a-grammar has one set of rules")
+		default:
+			a.rule()
+		}
+	}
+}
+
+// atWord tells whether the keyword w (and not a longer name) comes next.
+func (a *antlrImport) atWord(w string) bool {
+	if !a.at(w) {
+		return false
+	}
+	c := a.peek(len(w))
+	return !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9')
+}
+
+// options picks the two grammar options that change what is matched.
+func (a *antlrImport) options(block string) {
+	for _, opt := range strings.Split(block[1:len(block)-1], ";") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "tokenVocab":
+			a.load(value)
+		case "caseInsensitive":
+			a.caseless = value == "true"
+		}
+	}
+}
+
+// load queues the grammar name.g4 from the directory of the current file.
+func (a *antlrImport) load(name string) {
+	path := filepath.Join(filepath.Dir(a.grammarImport.file), name+".g4")
+	if a.loaded[path] {
+		return
+	}
+	a.loaded[path] = true
+	if _, err := os.Stat(path); err != nil {
+		a.warn(a.pos, "%s not found; its rules are missing", path)
+		return
+	}
+	a.pending = append(a.pending, path)
+}
+
+// rule reads one parser or lexer rule with everything around its body.
+func (a *antlrImport) rule() {
+	pos := a.pos
+	fragment := a.atWord("fragment")
+	if fragment {
+		a.ident("")
+		a.skipCStyle()
+	}
+	for _, modifier := range []string{"public", "private", "protected"} {
+		if a.atWord(modifier) {
+			a.ident("")
+			a.skipCStyle()
+		}
+	}
+	raw := a.ident("")
+	if raw == "" {
+		a.fail(a.pos, "expected a rule name")
+	}
+	name := importName(raw)
+	lexer := unicode.IsUpper([]rune(raw)[0])
+	// Arguments, returns, locals, throws, options and @init/@after actions.
+	for a.skipCStyle(); !a.at(":"); a.skipCStyle() {
+		switch {
+		case a.at("["):
+			a.skipBalanced('[', ']')
+		case a.at("{"):
+			a.skipBalanced('{', '}')
+		case a.at("@"):
+			a.pos++
+			a.ident("")
+		case a.atWord("returns") || a.atWord("locals") || a.atWord("options"):
+			a.ident("")
+		case a.atWord("throws"):
+			a.ident("")
+			for a.skipCStyle(); a.ident(".") != ""; a.skipCStyle() {
+				if a.at(",") {
+					a.pos++
+					a.skipCStyle()
+				}
+			}
+		default:
+			a.fail(a.pos, "expected ':' after the rule name %s", raw)
+		}
+	}
+	a.pos++
+	a.inLexerRule, a.ruleUsesEOF, a.ruleSkipped = lexer, false, false
+	body := a.alternatives()
+	a.skipCStyle()
+	a.expect(";")
+	// Exception handlers.
+	for a.skipCStyle(); a.atWord("catch") || a.atWord("finally"); a.skipCStyle() {
+		a.ident("")
+		for a.skipCStyle(); a.at("[") || a.at("{"); a.skipCStyle() {
+			if a.at("[") {
+				a.skipBalanced('[', ']')
+			} else {
+				a.skipBalanced('{', '}')
+			}
+		}
+	}
+	if a.byName[name] != nil && a.grammarImport.file != a.mainFile {
+		return // A rule of the main grammar overrides an imported one.
+	}
+	a.define(name, body, pos, false)
+	if lexer {
+		a.lexer[name] = true
+		a.fragments[name] = fragment
+		if a.ruleSkipped {
+			a.skipped = append(a.skipped, name)
+		}
+	} else if a.firstParser == "" {
+		a.firstParser = name
+	}
+	if a.ruleUsesEOF {
+		a.usesEOF[name] = true
+	}
+}
+
+// alternatives = alternative { "|" alternative }
+func (a *antlrImport) alternatives() *r.Rule {
+	pos := a.pos
+	alts := []*r.Rule{a.alternative()}
+	for a.skipCStyle(); a.at("|"); a.skipCStyle() {
+		a.pos++
+		alts = append(alts, a.alternative())
+	}
+	return importOr(alts, pos)
+}
+
+// antlrElement is one element of an alternative before the non-greedy loops
+// are resolved: those need what follows them.
+type antlrElement struct {
+	rule      *r.Rule
+	nonGreedy byte // '?', '*' or '+' for x??, x*? and x+?; 0 otherwise.
+}
+
+// alternative reads elements up to | ) ; or the lexer commands (-> ...), and
+// drops the #Label of a labeled alternative.
+func (a *antlrImport) alternative() *r.Rule {
+	pos := a.pos
+	var elems []antlrElement
+	for a.skipCStyle(); !a.eof(); a.skipCStyle() {
+		if c := a.src[a.pos]; c == '|' || c == ')' || c == ';' {
+			break
+		}
+		if a.at("->") {
+			a.commands()
+			break
+		}
+		if a.at("#") {
+			a.pos++
+			a.skipCStyle()
+			a.ident("")
+			continue
+		}
+		if elem, ok := a.element(); ok {
+			elems = append(elems, elem)
+		}
+	}
+	return a.resolveNonGreedy(elems, pos)
+}
+
+// resolveNonGreedy turns x*? y into { !y x } y: the loop stops as soon as the
+// rest of the alternative would match. At the end of an alternative a
+// non-greedy loop matches as little as possible, i.e. nothing.
+func (a *antlrImport) resolveNonGreedy(elems []antlrElement, pos int) *r.Rule {
+	var items []*r.Rule
+	for i, elem := range elems {
+		if elem.nonGreedy == 0 {
+			items = append(items, elem.rule)
+			continue
+		}
+		var rest []*r.Rule
+		for _, after := range elems[i+1:] {
+			rest = append(rest, after.rule)
+		}
+		if len(rest) == 0 {
+			if elem.nonGreedy == '+' {
+				items = append(items, elem.rule)
+			}
+			continue
+		}
+		guarded := importSeq([]*r.Rule{importNot(importSeq(rest, pos), pos), elem.rule}, pos)
+		switch elem.nonGreedy {
+		case '?':
+			items = append(items, importOptional(guarded, pos))
+		case '*':
+			items = append(items, importRepeat(guarded, pos))
+		case '+':
+			items = append(items, elem.rule, importRepeat(guarded, pos))
+		}
+	}
+	return importSeq(items, pos)
+}
+
+// commands reads the lexer commands after ->; skip and channel() send the
+// rule to the whitespace.
+func (a *antlrImport) commands() {
+	a.pos += 2
+	for {
+		a.skipCStyle()
+		pos := a.pos
+		cmd := a.ident("")
+		a.skipCStyle()
+		if a.at("(") {
+			a.skipBalanced('(', ')')
+		}
+		switch cmd {
+		case "skip", "channel":
+			a.ruleSkipped = true
+		case "mode", "pushMode", "popMode":
+			a.fail(pos, "lexer modes are not supported: the a-grammar has one set of rules")
+		case "":
+			a.fail(pos, "expected a lexer command")
+		default:
+			a.warn(pos, "the lexer command %s is ignored", cmd)
+		}
+		if a.skipCStyle(); !a.at(",") {
+			return
+		}
+		a.pos++
+	}
+}
+
+// element reads one element with its suffix. Actions, options and labels give
+// no element (ok is false).
+func (a *antlrImport) element() (elem antlrElement, ok bool) {
+	pos := a.pos
+	switch {
+	case a.at("{"):
+		a.skipBalanced('{', '}')
+		if a.at("?") {
+			a.pos++
+			a.warn(pos, "the semantic predicate is dropped: its alternative is always tried")
+		}
+		return elem, false
+	case a.at("<"):
+		a.skipBalanced('<', '>')
+		return elem, false
+	}
+	// A label: name= or name+= in front of the element.
+	saved := a.pos
+	if a.ident("") != "" {
+		a.skipCStyle()
+		if a.at("+=") {
+			a.pos += 2
+			a.skipCStyle()
+		} else if a.at("=") {
+			a.pos++
+			a.skipCStyle()
+		} else {
+			a.pos = saved
+		}
+	}
+	rule := a.atom()
+	if a.at("<") { // Element options like ID<assoc=right>.
+		a.skipBalanced('<', '>')
+	}
+	elem.rule = rule
+	if c := a.peek(0); c == '?' || c == '*' || c == '+' {
+		a.pos++
+		if a.at("?") {
+			a.pos++
+			elem.nonGreedy = c
+		}
+		if rule == nil {
+			return elem, false // EOF* and the like.
+		}
+		switch c {
+		case '?':
+			elem.rule = importOptional(rule, pos)
+		case '*':
+			elem.rule = importRepeat(rule, pos)
+		case '+':
+			elem.rule = importOneOrMore(rule, pos)
+		}
+		if elem.nonGreedy != 0 {
+			elem.rule = rule // resolveNonGreedy builds the loop.
+		}
+	}
+	return elem, elem.rule != nil
+}
+
+// atom reads a reference, literal, set, range, wildcard or block. EOF gives nil.
+func (a *antlrImport) atom() *r.Rule {
+	pos := a.pos
+	switch c := a.peek(0); {
+	case c == '(':
+		a.pos++
+		alts := a.alternatives()
+		a.skipCStyle()
+		a.expect(")")
+		return importGroup(alts)
+	case c == '\'':
+		from := a.literal()
+		a.skipCStyle()
+		if a.at("..") {
+			a.pos += 2
+			a.skipCStyle()
+			to := a.literal()
+			f, t := []rune(from), []rune(to)
+			if len(f) != 1 || len(t) != 1 || t[0] < f[0] {
+				a.fail(pos, "a range needs two single chars in order")
+			}
+			return importRange(f[0], t[0], pos)
+		}
+		if a.caseless && a.inLexerRule {
+			return importCaseless(from, pos)
+		}
+		return importToken(from, pos)
+	case c == '[':
+		return importCharSet(a.charSet(), false, pos)
+	case c == '~':
+		a.pos++
+		a.skipCStyle()
+		return a.negated(pos)
+	case c == '.':
+		a.pos++
+		if !a.inLexerRule {
+			a.warn(pos, "the wildcard . in a parser rule matches one char here, not one token")
+		}
+		return importAnyChar(pos)
+	}
+	raw := a.ident("")
+	if raw == "" {
+		a.fail(pos, "unexpected %q", a.peek(0))
+	}
+	if a.at("[") { // Rule arguments.
+		a.skipBalanced('[', ']')
+	}
+	if raw == "EOF" {
+		a.ruleUsesEOF = true
+		return nil
+	}
+	return importIdent(importName(raw), pos)
+}
+
+// negated reads the set after ~: a char set, a literal or a block of them.
+func (a *antlrImport) negated(pos int) *r.Rule {
+	return importCharSet(a.negatedBounds(pos), true, pos)
+}
+
+func (a *antlrImport) negatedBounds(pos int) [][2]rune {
+	switch {
+	case a.at("["):
+		return a.charSet()
+	case a.at("'"):
+		from := []rune(a.literal())
+		bound := [2]rune{-1, -1}
+		if len(from) == 1 {
+			bound = [2]rune{from[0], from[0]}
+		}
+		if a.skipCStyle(); a.at("..") {
+			a.pos += 2
+			a.skipCStyle()
+			if to := []rune(a.literal()); len(to) == 1 {
+				bound[1] = to[0]
+			}
+		}
+		if bound[0] < 0 || bound[1] < bound[0] {
+			a.fail(pos, "~ needs single chars")
+		}
+		return [][2]rune{bound}
+	case a.at("("):
+		a.pos++
+		var bounds [][2]rune
+		for {
+			a.skipCStyle()
+			bounds = append(bounds, a.negatedBounds(pos)...)
+			if a.skipCStyle(); !a.at("|") {
+				break
+			}
+			a.pos++
+		}
+		a.expect(")")
+		return bounds
+	}
+	a.fail(pos, "~ needs a char set, a char or a block of them")
+	return nil
+}
+
+// literal reads a quoted literal with its escapes.
+func (a *antlrImport) literal() string {
+	start := a.pos
+	a.expect("'")
+	var b strings.Builder
+	for !a.at("'") {
+		if a.eof() || a.src[a.pos] == '\n' {
+			a.fail(start, "unterminated literal")
+		}
+		if a.src[a.pos] == '\\' {
+			c, size := importEscape(a.src[a.pos+1:])
+			b.WriteRune(c)
+			a.pos += 1 + size
+			continue
+		}
+		b.WriteByte(a.src[a.pos])
+		a.pos++
+	}
+	a.pos++
+	return b.String()
+}
+
+// charSet reads a lexer char set like [a-zA-Z_\-] into its bounds.
+func (a *antlrImport) charSet() [][2]rune {
+	start := a.pos
+	a.expect("[")
+	var bounds [][2]rune
+	next := func() rune {
+		if a.eof() {
+			a.fail(start, "unterminated char set")
+		}
+		if a.src[a.pos] == '\\' {
+			if a.peek(1) == 'p' || a.peek(1) == 'P' {
+				a.pos += 2
+				prop := a.skipBalanced('{', '}')
+				a.warn(start, "the Unicode property \\p%s is approximated by all non-ASCII chars", prop)
+				bounds = append(bounds, [2]rune{0x80, unicode.MaxRune})
+				return -1
+			}
+			c, size := importEscape(a.src[a.pos+1:])
+			a.pos += 1 + size
+			return c
+		}
+		c, size := utf8.DecodeRuneInString(a.src[a.pos:])
+		a.pos += size
+		return c
+	}
+	for !a.at("]") {
+		from := next()
+		if from < 0 {
+			continue
+		}
+		to := from
+		if a.at("-") && a.peek(1) != ']' {
+			a.pos++
+			to = next()
+		}
+		bounds = append(bounds, [2]rune{from, to})
+	}
+	a.pos++
+	if a.caseless {
+		bounds = importFoldBounds(bounds)
+	}
+	return bounds
+}
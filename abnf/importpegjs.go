@@ -0,0 +1,308 @@
+package abnf
+
+// The PEG.js importer (-import pegjs): grammars of PEG.js and of its successor
+// Peggy. A PEG means what the parser here does - ordered choice, greedy loops,
+// no backtracking into a loop - so the translation is nearly literal:
+//
+//	a / b            a | b
+//	e? e* e+         [ e ], { e }, 1... ( e )
+//	e|2..4|          2...4 ( e ) (Peggy's counted repetition)
+//	!e  &e           a Not of e, and a Not of that Not
+//	"abc"i  [a-z]i   case-insensitive: @"aA" @"bB" @"cC", the class in both cases
+//	.                any char
+//	$e  @e  label:e  e, e, e - only the value they return differs
+//	{ action }       dropped; &{ } and !{ } predicates with a warning
+//
+// The initializers ({ } and {{ }} in front of the first rule) and the display
+// names (rule "name" = ...) are dropped. PEG.js has no implicit whitespace, so
+// neither has the result. The first rule is the start rule.
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf/r"
+)
+
+type pegImport struct {
+	*grammarImport
+}
+
+func (im *grammarImport) importPEGjs() *r.Rules {
+	p := &pegImport{im}
+	for p.skipCStyle(); p.at("{"); p.skipCStyle() {
+		p.skipBalanced('{', '}') // The initializer, or {{ }} as one nested block.
+	}
+	for ; !p.eof(); p.skipCStyle() {
+		pos := p.pos
+		name := p.ident("")
+		if name == "" {
+			p.fail(pos, "expected a rule name")
+		}
+		if p.skipCStyle(); p.at("\"") || p.at("'") {
+			p.literal() // The display name.
+			p.skipCStyle()
+		}
+		p.expect("=")
+		body := p.choice()
+		if p.skipCStyle(); p.at(";") {
+			p.pos++
+		}
+		im.define(importName(name), body, pos, false)
+	}
+	if len(im.prods) == 0 {
+		im.fail(0, "no rules found")
+	}
+	im.checkReferences(nil)
+	im.removeLeftRecursion()
+	return im.grammar("", "PEG.js", im.prods[0].String, "")
+}
+
+// atRuleStart tells whether a new rule (name, display name, =) begins here:
+// rules are not terminated, so that is where the previous one ends.
+func (p *pegImport) atRuleStart() bool {
+	saved := p.pos
+	defer func() { p.pos = saved }()
+	if p.ident("") == "" {
+		return false
+	}
+	if p.skipCStyle(); p.at("\"") || p.at("'") {
+		p.literal()
+		p.skipCStyle()
+	}
+	return p.at("=")
+}
+
+// choice = sequence { "/" sequence }
+func (p *pegImport) choice() *r.Rule {
+	pos := p.pos
+	alts := []*r.Rule{p.sequence()}
+	for p.skipCStyle(); p.at("/") && !p.at("//") && !p.at("/*"); p.skipCStyle() {
+		p.pos++
+		alts = append(alts, p.sequence())
+	}
+	return importOr(alts, pos)
+}
+
+// sequence reads the elements of one alternative and drops its action.
+func (p *pegImport) sequence() *r.Rule {
+	pos := p.pos
+	var items []*r.Rule
+	for p.skipCStyle(); !p.eof() && !p.atRuleStart(); p.skipCStyle() {
+		if c := p.src[p.pos]; c == '/' || c == ')' || c == ';' {
+			break
+		}
+		if p.at("{") {
+			p.skipBalanced('{', '}')
+			continue
+		}
+		if item := p.labeled(); item != nil {
+			items = append(items, item)
+		}
+	}
+	return importSeq(items, pos)
+}
+
+// labeled = [ "@" ] [ label ":" ] prefixed
+func (p *pegImport) labeled() *r.Rule {
+	if p.at("@") {
+		p.pos++
+		p.skipCStyle()
+	}
+	saved := p.pos
+	if p.ident("") != "" {
+		if p.skipCStyle(); p.at(":") {
+			p.pos++
+			p.skipCStyle()
+		} else {
+			p.pos = saved
+		}
+	}
+	return p.prefixed()
+}
+
+// prefixed = [ "$" | "&" | "!" ] suffixed, or a semantic predicate (nil).
+func (p *pegImport) prefixed() *r.Rule {
+	pos := p.pos
+	switch c := p.peek(0); c {
+	case '$':
+		p.pos++
+		p.skipCStyle()
+		return p.suffixed()
+	case '&', '!':
+		p.pos++
+		if p.skipCStyle(); p.at("{") {
+			p.skipBalanced('{', '}')
+			p.warn(pos, "the semantic predicate %c{ } is dropped: it always holds", c)
+			return nil
+		}
+		not := importNot(p.suffixed(), pos)
+		if c == '&' {
+			return importNot(not, pos)
+		}
+		return not
+	}
+	return p.suffixed()
+}
+
+// suffixed = primary [ "?" | "*" | "+" | "|" count "|" ]
+func (p *pegImport) suffixed() *r.Rule {
+	pos := p.pos
+	rule := p.primary()
+	switch p.skipCStyle(); p.peek(0) {
+	case '?':
+		p.pos++
+		return importOptional(rule, pos)
+	case '*':
+		p.pos++
+		return importRepeat(rule, pos)
+	case '+':
+		p.pos++
+		return importOneOrMore(rule, pos)
+	case '|':
+		p.pos++
+		from, to := p.count()
+		return importTimes(rule, from, to, pos)
+	}
+	return rule
+}
+
+// count reads Peggy's repetition bounds n, n.., ..m or n..m up to the closing |.
+func (p *pegImport) count() (from, to int) {
+	pos := p.pos
+	number := func(none int) int {
+		p.skipCStyle()
+		start := p.pos
+		for !p.eof() && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		if start == p.pos {
+			return none
+		}
+		n, _ := strconv.Atoi(p.src[start:p.pos])
+		return n
+	}
+	from = number(0)
+	to = from
+	if p.skipCStyle(); p.at("..") {
+		p.pos += 2
+		to = number(-1)
+	}
+	if p.skipCStyle(); p.at(",") {
+		p.fail(pos, "a repetition with a delimiter is not supported")
+	}
+	if p.at("{") || p.peek(0) >= 'a' && p.peek(0) <= 'z' || p.peek(0) >= 'A' && p.peek(0) <= 'Z' {
+		p.fail(pos, "a repetition count from code is not supported")
+	}
+	p.expect("|")
+	return from, to
+}
+
+func (p *pegImport) primary() *r.Rule {
+	pos := p.pos
+	switch c := p.peek(0); {
+	case c == '"' || c == '\'':
+		s := p.literal()
+		if p.at("i") && !p.identAfter(1) {
+			p.pos++
+			return importCaseless(s, pos)
+		}
+		return importToken(s, pos)
+	case c == '[':
+		bounds, negated := p.class()
+		if p.at("i") && !p.identAfter(1) {
+			p.pos++
+			bounds = importFoldBounds(bounds)
+		}
+		return importCharSet(bounds, negated, pos)
+	case c == '.':
+		p.pos++
+		return importAnyChar(pos)
+	case c == '(':
+		p.pos++
+		alts := p.choice()
+		p.skipCStyle()
+		p.expect(")")
+		return importGroup(alts)
+	}
+	name := p.ident("")
+	if name == "" {
+		p.fail(pos, "unexpected %q", p.peek(0))
+	}
+	return importIdent(importName(name), pos)
+}
+
+// identAfter tells whether a name char follows at offset off: "abc"in is no
+// case-insensitive literal.
+func (p *pegImport) identAfter(off int) bool {
+	c := p.peek(off)
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// literal reads a JavaScript string literal.
+func (p *pegImport) literal() string {
+	start := p.pos
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.src[p.pos] == '\n' {
+			p.fail(start, "unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == quote {
+			p.pos++
+			return b.String()
+		}
+		if c == '\\' {
+			if p.peek(1) == '\n' { // A line continuation.
+				p.pos += 2
+				continue
+			}
+			r, size := importEscape(p.src[p.pos+1:])
+			b.WriteRune(r)
+			p.pos += 1 + size
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+}
+
+// class reads a char class like [^a-z\]] into its bounds.
+func (p *pegImport) class() (bounds [][2]rune, negated bool) {
+	start := p.pos
+	p.pos++
+	if p.at("^") {
+		p.pos++
+		negated = true
+	}
+	next := func() rune {
+		if p.eof() || p.src[p.pos] == '\n' {
+			p.fail(start, "unterminated char class")
+		}
+		if p.src[p.pos] == '\\' {
+			c, size := importEscape(p.src[p.pos+1:])
+			p.pos += 1 + size
+			return c
+		}
+		c, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		return c
+	}
+	for !p.at("]") {
+		from := next()
+		to := from
+		if p.at("-") && p.peek(1) != ']' {
+			p.pos++
+			to = next()
+		}
+		if to < from {
+			p.fail(start, "the class range %c-%c is empty", from, to)
+		}
+		bounds = append(bounds, [2]rune{from, to})
+	}
+	p.pos++
+	return bounds, negated
+}
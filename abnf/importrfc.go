@@ -0,0 +1,327 @@
+package abnf
+
+// The RFC 5234 importer (-import rfc5234): the ABNF of the IETF, in which most
+// protocol syntax is written (HTTP, URI, SMTP, ...), with the %s/%i string
+// prefixes of RFC 7405.
+//
+// A rule ends where the next one begins, which in ABNF is a name followed by =
+// or =/ (the RFC asks for a new rule to start in column 0, but rules copied out
+// of an RFC are indented as a block, and "name =" is unambiguous anyway). Names
+// are case-insensitive; every reference is spelled the way the rule was first
+// written, with the hyphens turned into underscores. The translation:
+//
+//	"abc", %i"abc"  case-insensitive token, @"aA" @"bB" @"cC"
+//	%s"abc"         the token "abc"
+//	%x41-5A         the range "A"..."Z" (%d and %b alike; values are code points)
+//	%x0D.0A         the token "\r\n"
+//	*X  1*X  2*4X   { X }, 1... ( X ), 2...4 ( X ); *1X and [X] are [ X ]
+//	2X              2 ( X )
+//	a =/ b          appends b as another alternative of a
+//	<prose>         a rule that never matches, with a warning
+//
+// The core rules of the RFC's appendix B (ALPHA, DIGIT, CRLF, ...) are added
+// when they are used but not defined. The first rule is the start rule.
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"14.gy/mec/abnf/r"
+)
+
+// rfcCoreRules is appendix B.1 of RFC 5234, read by the importer itself.
+const rfcCoreRules = `
+ALPHA  = %x41-5A / %x61-7A
+BIT    = "0" / "1"
+CHAR   = %x01-7F
+CR     = %x0D
+CRLF   = CR LF
+CTL    = %x00-1F / %x7F
+DIGIT  = %x30-39
+DQUOTE = %x22
+HEXDIG = DIGIT / "A" / "B" / "C" / "D" / "E" / "F"
+HTAB   = %x09
+LF     = %x0A
+LWSP   = *(WSP / CRLF WSP)
+OCTET  = %x00-FF
+SP     = %x20
+VCHAR  = %x21-7E
+WSP    = SP / HTAB
+`
+
+// rfcImport reads one ABNF text. names maps the lowercased rule names to the
+// spelling used in the a-grammar.
+type rfcImport struct {
+	*grammarImport
+	names map[string]string
+}
+
+func (im *grammarImport) importRFC5234() *r.Rules {
+	rfc := &rfcImport{grammarImport: im, names: map[string]string{}}
+	rfc.rules()
+	if len(im.prods) == 0 {
+		im.fail(0, "no rules found")
+	}
+	start := im.prods[0].String
+
+	// Add the core rules the grammar uses without defining them.
+	core := &rfcImport{grammarImport: &grammarImport{file: "RFC 5234 appendix B.1", src: rfcCoreRules, byName: map[string]*r.Rule{}, warned: map[string]bool{}}, names: map[string]string{}}
+	core.rules()
+	im.checkReferences(func(name string, pos int) bool {
+		prod := core.byName[core.names[strings.ToLower(name)]]
+		if prod == nil {
+			return false
+		}
+		im.prods = append(im.prods, prod)
+		im.byName[name] = prod
+		prod.String = name // Spelled like its first use: DIGIT stays DIGIT, digit digit.
+		importWalk(prod.Childs, func(rule *r.Rule) {
+			if rule.Operator == r.Identifier {
+				rule.String = rfc.name(rule.String)
+			}
+		})
+		return true
+	})
+	im.removeLeftRecursion()
+	return im.grammar("", "RFC 5234 ABNF", start, "")
+}
+
+// name returns the a-grammar spelling of an ABNF rule name.
+func (rfc *rfcImport) name(raw string) string {
+	key := strings.ToLower(raw)
+	if name, ok := rfc.names[key]; ok {
+		return name
+	}
+	name := importName(raw)
+	rfc.names[key] = name
+	return name
+}
+
+// skip skips whitespace, line breaks and ; comments (c-wsp and c-nl).
+func (rfc *rfcImport) skip() {
+	for !rfc.eof() {
+		switch c := rfc.src[rfc.pos]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			rfc.pos++
+		case c == ';':
+			for !rfc.eof() && rfc.src[rfc.pos] != '\n' {
+				rfc.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// ruleName reads a rulename: ALPHA *(ALPHA / DIGIT / "-").
+func (rfc *rfcImport) ruleName() string {
+	start := rfc.pos
+	for !rfc.eof() {
+		c := rfc.src[rfc.pos]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || rfc.pos > start && (c >= '0' && c <= '9' || c == '-')) {
+			break
+		}
+		rfc.pos++
+	}
+	return rfc.src[start:rfc.pos]
+}
+
+// atRuleStart tells whether a new rule (a name and = or =/) begins here.
+func (rfc *rfcImport) atRuleStart() bool {
+	saved := rfc.pos
+	defer func() { rfc.pos = saved }()
+	if rfc.ruleName() == "" {
+		return false
+	}
+	rfc.skip()
+	return rfc.at("=")
+}
+
+func (rfc *rfcImport) rules() {
+	for rfc.skip(); !rfc.eof(); rfc.skip() {
+		pos := rfc.pos
+		raw := rfc.ruleName()
+		if raw == "" {
+			rfc.fail(pos, "expected a rule name")
+		}
+		rfc.skip()
+		rfc.expect("=")
+		incremental := rfc.at("/")
+		if incremental {
+			rfc.pos++
+		}
+		name := rfc.name(raw)
+		if incremental && rfc.byName[name] == nil {
+			rfc.warn(pos, "%s =/ comes before any %s =", raw, raw)
+		}
+		rfc.define(name, rfc.alternation(), pos, incremental)
+	}
+}
+
+// alternation = concatenation *("/" concatenation)
+func (rfc *rfcImport) alternation() *r.Rule {
+	pos := rfc.pos
+	alts := []*r.Rule{rfc.concatenation()}
+	for rfc.skip(); rfc.at("/"); rfc.skip() {
+		rfc.pos++
+		alts = append(alts, rfc.concatenation())
+	}
+	return importOr(alts, pos)
+}
+
+// concatenation = repetition *(1*c-wsp repetition)
+func (rfc *rfcImport) concatenation() *r.Rule {
+	pos := rfc.pos
+	var items []*r.Rule
+	for rfc.skip(); !rfc.eof() && !rfc.atRuleStart(); rfc.skip() {
+		if c := rfc.src[rfc.pos]; c == '/' || c == ')' || c == ']' {
+			break
+		}
+		items = append(items, rfc.repetition())
+	}
+	if len(items) == 0 {
+		rfc.fail(pos, "expected an element")
+	}
+	return importSeq(items, pos)
+}
+
+// repetition = [repeat] element, repeat = 1*DIGIT / (*DIGIT "*" *DIGIT)
+func (rfc *rfcImport) repetition() *r.Rule {
+	pos := rfc.pos
+	from, fromOK := rfc.number(10)
+	if !rfc.at("*") {
+		elem := rfc.element()
+		if fromOK {
+			return importTimes(elem, from, from, pos)
+		}
+		return elem
+	}
+	rfc.pos++
+	to, toOK := rfc.number(10)
+	if !toOK {
+		to = -1
+	}
+	if !fromOK {
+		from = 0
+	}
+	if to >= 0 && to < from {
+		rfc.fail(pos, "%d*%d repeats at most fewer times than at least", from, to)
+	}
+	return importTimes(rfc.element(), from, to, pos)
+}
+
+// number reads digits of the given base, or reports that there are none.
+func (rfc *rfcImport) number(base int) (int, bool) {
+	start := rfc.pos
+	for !rfc.eof() && rfcDigit(rfc.src[rfc.pos], base) {
+		rfc.pos++
+	}
+	if rfc.pos == start {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(rfc.src[start:rfc.pos], base, 32)
+	if err != nil {
+		rfc.fail(start, "the number %s is too large", rfc.src[start:rfc.pos])
+	}
+	return int(v), true
+}
+
+func rfcDigit(c byte, base int) bool {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c-'0') < base
+	case c|0x20 >= 'a' && c|0x20 <= 'f':
+		return base == 16
+	}
+	return false
+}
+
+func (rfc *rfcImport) element() *r.Rule {
+	pos := rfc.pos
+	switch c := rfc.peek(0); {
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		return importIdent(rfc.name(rfc.ruleName()), pos)
+	case c == '(' || c == '[':
+		rfc.pos++
+		alt := rfc.alternation()
+		rfc.skip()
+		if c == '(' {
+			rfc.expect(")")
+			return importGroup(alt)
+		}
+		rfc.expect("]")
+		return importOptional(alt, pos)
+	case c == '"':
+		return importCaseless(rfc.quoted(), pos)
+	case c == '%':
+		rfc.pos++
+		switch rfc.peek(0) {
+		case 's', 'S':
+			rfc.pos++
+			return importToken(rfc.quoted(), pos)
+		case 'i', 'I':
+			rfc.pos++
+			return importCaseless(rfc.quoted(), pos)
+		}
+		return rfc.numVal()
+	case c == '<':
+		end := strings.IndexByte(rfc.src[rfc.pos:], '>')
+		if end < 0 {
+			rfc.fail(pos, "unterminated prose value")
+		}
+		rfc.pos += end + 1
+		rfc.warn(pos, "the prose value %s has no syntax; it never matches", rfc.src[pos:rfc.pos])
+		return importNever(pos)
+	}
+	rfc.fail(pos, "expected an element, found %q", rfc.peek(0))
+	return nil
+}
+
+// quoted reads a char-val: DQUOTE *(%x20-21 / %x23-7E) DQUOTE, no escapes.
+func (rfc *rfcImport) quoted() string {
+	rfc.expect(`"`)
+	end := strings.IndexByte(rfc.src[rfc.pos:], '"')
+	if end < 0 || strings.ContainsAny(rfc.src[rfc.pos:rfc.pos+end], "\r\n") {
+		rfc.fail(rfc.pos-1, "unterminated string")
+	}
+	s := rfc.src[rfc.pos : rfc.pos+end]
+	rfc.pos += end + 1
+	return s
+}
+
+// numVal reads the rest of a num-val after the %: a base letter, a value and
+// either a range (-) or more values of one token (.).
+func (rfc *rfcImport) numVal() *r.Rule {
+	pos := rfc.pos - 1
+	base := map[byte]int{'x': 16, 'X': 16, 'd': 10, 'D': 10, 'b': 2, 'B': 2}[rfc.peek(0)]
+	if base == 0 {
+		rfc.fail(pos, "expected x, d, b, s or i after %%")
+	}
+	rfc.pos++
+	value := func() rune {
+		v, ok := rfc.number(base)
+		if !ok {
+			rfc.fail(rfc.pos, "expected a base %d number", base)
+		}
+		if v > unicode.MaxRune {
+			rfc.fail(pos, "%s is beyond the last code point", rfc.src[pos:rfc.pos])
+		}
+		return rune(v)
+	}
+	first := value()
+	if rfc.at("-") {
+		rfc.pos++
+		last := value()
+		if last < first {
+			rfc.fail(pos, "the range %s is empty", rfc.src[pos:rfc.pos])
+		}
+		return importRange(first, last, pos)
+	}
+	s := string(first)
+	for rfc.at(".") {
+		rfc.pos++
+		s += string(value())
+	}
+	return importToken(s, pos)
+}
@@ -3,26 +3,22 @@ package abnf
 import (
 	"os"
 	"path/filepath"
+	"sort"
 )
 
-// ImportRoots holds the -i include directories, in command-line order. An
-// import that names a project file is searched relative to the imported-from
-// program's directory first, then relative to each root.
-var ImportRoots []string
-
 // findImportFile resolves a grammar-supplied relative path (already mapped
 // from the language's import syntax, e.g. "a/b/C.kt") against the current
 // source file's directory and the -i roots. Returns the first existing
 // regular file as a cleaned path, or "" when nothing matches.
-func findImportFile(relPath string) string {
+func (s *Session) findImportFile(relPath string) string {
 	if relPath == "" || filepath.IsAbs(relPath) {
 		return ""
 	}
-	dirs := make([]string, 0, len(ImportRoots)+1)
-	if traceSrcName != "" {
-		dirs = append(dirs, filepath.Dir(traceSrcName))
+	dirs := make([]string, 0, len(s.ImportRoots)+1)
+	if s.src.name != "" {
+		dirs = append(dirs, filepath.Dir(s.src.name))
 	}
-	dirs = append(dirs, ImportRoots...)
+	dirs = append(dirs, s.ImportRoots...)
 	for _, dir := range dirs {
 		p := filepath.Join(dir, filepath.Clean(relPath))
 		if st, err := os.Stat(p); err == nil && st.Mode().IsRegular() {
@@ -33,7 +29,9 @@ func findImportFile(relPath string) string {
 }
 
 // readImportFile loads a file previously located by findImportFile.
-func readImportFile(path string) string {
+func (s *Session) readImportFile(path string) string {
+	s.sandboxAccess(path)
+	s.noteInput(path)
 	dat, err := os.ReadFile(path)
 	if err != nil {
 		panic("import file vanished: " + path)
@@ -41,30 +39,50 @@ func readImportFile(path string) string {
 	return StripBOM(string(dat))
 }
 
+// noteInput records a file the session read for a language: an :include()
+// fragment, a script library, a runtime module, an imported project file.
+func (s *Session) noteInput(path string) {
+	if s.inputs == nil {
+		s.inputs = map[string]bool{}
+	}
+	s.inputs[filepath.Clean(path)] = true
+}
+
+// Inputs returns the files the session read from disk for its languages, sorted:
+// everything besides the files of the command line that a run depends on. The
+// -watch mode of the command line tool polls them.
+func (s *Session) Inputs() []string {
+	files := make([]string, 0, len(s.inputs))
+	for f := range s.inputs {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
 // pushTraceSource swaps the file/line attribution to an imported file for the
 // duration of its nested compile walk, so warnings and errors inside it carry
 // the right name and line numbers. popTraceSource restores the outer file.
 type savedTraceSource struct {
 	name   string
 	starts []int
+	text   string
 }
 
-var traceSourceStack []savedTraceSource
-
-func pushTraceSource(name, text string) {
-	attributeModuleFuncs() // stamp functions compiled under the OUTGOING source
-	traceSourceStack = append(traceSourceStack, savedTraceSource{traceSrcName, traceLineStarts})
-	SetTraceSource(name, text)
+func (s *Session) pushTraceSource(name, text string) {
+	s.attributeModuleFuncs() // stamp functions compiled under the OUTGOING source
+	s.src.stack = append(s.src.stack, savedTraceSource{s.src.name, s.src.starts, s.src.text})
+	s.SetTraceSource(name, text)
 }
 
-func popTraceSource() {
-	if len(traceSourceStack) == 0 {
+func (s *Session) popTraceSource() {
+	if len(s.src.stack) == 0 {
 		return
 	}
-	attributeModuleFuncs() // stamp functions compiled under the source being popped
-	s := traceSourceStack[len(traceSourceStack)-1]
-	traceSourceStack = traceSourceStack[:len(traceSourceStack)-1]
-	traceSrcName, traceLineStarts = s.name, s.starts
+	s.attributeModuleFuncs() // stamp functions compiled under the source being popped
+	saved := s.src.stack[len(s.src.stack)-1]
+	s.src.stack = s.src.stack[:len(s.src.stack)-1]
+	s.src.name, s.src.starts, s.src.text = saved.name, saved.starts, saved.text
 }
 
 // pushTraceSourceFile re-pushes a source by NAME, reusing the line-start table
@@ -72,8 +90,9 @@ func popTraceSource() {
 // emit each imported file's deferred top-level items under that file's source -
 // so the call graph attributes those functions to their real file - without
 // having to carry the source text around a second time. popTraceSource undoes it.
-func pushTraceSourceFile(name string) {
-	attributeModuleFuncs() // stamp functions compiled under the OUTGOING source
-	traceSourceStack = append(traceSourceStack, savedTraceSource{traceSrcName, traceLineStarts})
-	traceSrcName, traceLineStarts = name, sourceLineStarts[name]
+func (s *Session) pushTraceSourceFile(name string) {
+	s.attributeModuleFuncs() // stamp functions compiled under the OUTGOING source
+	s.src.stack = append(s.src.stack, savedTraceSource{s.src.name, s.src.starts, s.src.text})
+	byName := s.src.byName[name]
+	s.src.name, s.src.starts, s.src.text = name, byName.starts, byName.text
 }
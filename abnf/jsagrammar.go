@@ -8,4 +8,4 @@ import "14.gy/mec/abnf/r"
 // LLVM IR compiler). In frozen mode (-frozen) the Go core parses every
 // annotation script with it - without goja.
 
-var jsAgrammar = &r.Rules{&r.Rule{Operator:r.Command, String:"title", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"MetaJS to LLVM IR compiler"}}}, &r.Rule{Operator:r.Command, String:"description", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"Compiles MetaJS to an LLVM IR module and runs it with the built-in IR interpreter.\n\nThe language is exactly the one of metajs-interpreter.abnf; see there for a description\n(including the bitwise operators and assignment targets that reach through calls).\n\nThe emitted IR is handle threaded code: every dynamic value is an i64 handle into the\nvalue table of the Go side MetaJS runtime (abnf/jsrt.go), and every operation with real\nJS semantics is a call to one of its js_* externals (js_add, js_get, js_call, ...).\nOnly the control flow is real IR: if/while/for/&&/||/?: compile to basic blocks,\nbranches and phis, driven by js_truthy. The handles 0..3 are the constants undefined,\nnull, false and true. Variables live in scope chain objects on the host side\n(js_scope_new, js_scope_get, and the declaring/assigning js_tdecl/js_tset, which\nalso enforce the MetaJS type pinning), and the scope chain is what gives closures\ntheir captured\nenvironment: a function expression becomes an own IR function jsf_N(env, args) plus a\njs_closure(N, currentScope) at the site of its creation. String and number literals\nenter through module globals (js_str_mem) and js_num_i/js_num_str.\n\nEvery tag composes a small code generator function (a 'thunk') out of the thunks of its\nchildren. Expression thunks get the current basic block and return {b: endBlock,\nv: handle value}; statement thunks get the current block and return the block that the\nfollowing code has to continue in (short circuit operators and loops branch, so both\ncan move the insertion point). The top level becomes the function jsmain(env, args),\nwhich runs the program statements and then calls main().\n\nThe exit code of the metacompiler run is the value that main() returns, so MetaJS test\nprograms are self checking: they return 0 on success.\nThe same language with the same semantics is interpreted directly by metajs-interpreter.abnf.\n\nThis grammar has a second purpose: its own tag scripts (and every annotation script of\nthe other grammars) are written in MetaJS, so this compiler can compile the scripts that\ndefine it - that is what makes the frozen, goja free bootstrap possible. As a\nconsequence, every tag script runs under the MetaJS discipline rules when frozen:\ndeclaration before use and the pinned type class, with var v = anytype as the\ndeclared exemption. Under goja only the declaration rule holds (the scripts are\ncompiled as strict-mode JS; goja cannot pin types, and its anytype is plain\nundefined), so the -frozen leg of the test matrix is the conformance check for\ntag scripts."}}}, &r.Rule{Operator:r.Production, String:"Whitespace", Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.CharsOf, String:" \t\r\n"}, &r.Rule{Operator:r.Identifier, String:"Comment"}}}}}}}, &r.Rule{Operator:r.Production, String:"Comment", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"LineComment"}, &r.Rule{Operator:r.Identifier, String:"BlockComment"}}}}}, &r.Rule{Operator:r.Production, String:"LineComment", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"//"}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NotNewline"}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"BlockComment", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"/*"}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NotStar"}, &r.Rule{Operator:r.Sequence, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"*"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"*"}}}, &r.Rule{Operator:r.Identifier, String:"NotStarSlash"}}}}}}}, &r.Rule{Operator:r.Token, String:"*"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"*"}}}, &r.Rule{Operator:r.Token, String:"/"}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"NotNewline", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x00"}, &r.Rule{Operator:r.Token, String:"\t"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\v"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"NotStar", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x00"}, &r.Rule{Operator:r.Token, String:")"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"+"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"NotStarSlash", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x00"}, &r.Rule{Operator:r.Token, String:")"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"+"}, &r.Rule{Operator:r.Token, String:"."}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"Id", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"a"}, &r.Rule{Operator:r.Token, String:"z"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"A"}, &r.Rule{Operator:r.Token, String:"Z"}}}, &r.Rule{Operator:r.Token, String:"_"}, &r.Rule{Operator:r.Token, String:"$"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"a"}, &r.Rule{Operator:r.Token, String:"z"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"A"}, &r.Rule{Operator:r.Token, String:"Z"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Token, String:"_"}, &r.Rule{Operator:r.Token, String:"$"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"KwEnd", Childs:&r.Rules{&r.Rule{Operator:r.Command, String:"script", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\n    (function() {\n        var cc = c.peek(0)\n        return ((cc >= 48 && cc <= 57) || (cc >= 65 && cc <= 90) || cc === 95 || cc === 36 || (cc >= 97 && cc <= 122))\n            ? abnf.newToken(\"\\x01keyword-boundary\", 0)\n            : undefined\n    })()\n"}}}}}, &r.Rule{Operator:r.Production, String:"DqString", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"\""}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(unescapeJs(up.in))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"StrEsc"}, &r.Rule{Operator:r.Identifier, String:"DqPlain"}}}}}}}, &r.Rule{Operator:r.Token, String:"\""}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"SqString", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"'"}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(unescapeJs(up.in))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"StrEsc"}, &r.Rule{Operator:r.Identifier, String:"SqPlain"}}}}}}}, &r.Rule{Operator:r.Token, String:"'"}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"StrEsc", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"\\"}, &r.Rule{Operator:r.Range, Int:1, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" "}, &r.Rule{Operator:r.Token, String:"~"}}}}}, &r.Rule{Operator:r.Production, String:"DqPlain", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" "}, &r.Rule{Operator:r.Token, String:"!"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"#"}, &r.Rule{Operator:r.Token, String:"["}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"]"}, &r.Rule{Operator:r.Token, String:"~"}}}, &r.Rule{Operator:r.CharOf, String:"\t"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x7f"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"SqPlain", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" "}, &r.Rule{Operator:r.Token, String:"&"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Token, String:"["}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"]"}, &r.Rule{Operator:r.Token, String:"~"}}}, &r.Rule{Operator:r.CharOf, String:"\t"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x7f"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"IntLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"1"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"DecLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseFloat(up.in))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"1"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"."}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumHex", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in.split(\"_\").join(\"\")))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"x"}, &r.Rule{Operator:r.Token, String:"X"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Identifier, String:"NumHexDig"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NumHexDig"}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumHexDig", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"a"}, &r.Rule{Operator:r.Token, String:"f"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"A"}, &r.Rule{Operator:r.Token, String:"F"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumBin", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in.split(\"_\").join(\"\").substring(2), 2))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"b"}, &r.Rule{Operator:r.Token, String:"B"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Identifier, String:"NumBinDig"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NumBinDig"}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumBinDig", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"1"}}}}}, &r.Rule{Operator:r.Production, String:"NumOct", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in.split(\"_\").join(\"\").substring(2), 8))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"o"}, &r.Rule{Operator:r.Token, String:"O"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"7"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"7"}}}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumInt", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in.split(\"_\").join(\"\")))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"1"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumDec", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseFloat(up.in.split(\"_\").join(\"\")))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"1"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Sequence, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"."}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NumExp"}}}}}, &r.Rule{Operator:r.Identifier, String:"NumExp"}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumExp", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"e"}, &r.Rule{Operator:r.Token, String:"E"}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"+"}, &r.Rule{Operator:r.Token, String:"-"}}}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}}}}}, &r.Rule{Operator:r.Production, String:"True", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(true)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"true"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}}}, &r.Rule{Operator:r.Production, String:"False", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(false)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"false"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}}}, &r.Rule{Operator:r.Command, String:"startRule", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Program"}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}, &r.Rule{Operator:r.Production, String:"Program", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" buildMain(takeAll()) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Statement"}}}}}}}, &r.Rule{Operator:r.Production, String:"Statement", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(stmtPos(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Block"}, &r.Rule{Operator:r.Identifier, String:"ImportStmt"}, &r.Rule{Operator:r.Identifier, String:"VarDecl"}, &r.Rule{Operator:r.Identifier, String:"If"}, &r.Rule{Operator:r.Identifier, String:"While"}, &r.Rule{Operator:r.Identifier, String:"Do"}, &r.Rule{Operator:r.Identifier, String:"For"}, &r.Rule{Operator:r.Identifier, String:"Switch"}, &r.Rule{Operator:r.Identifier, String:"Return"}, &r.Rule{Operator:r.Identifier, String:"Break"}, &r.Rule{Operator:r.Identifier, String:"Continue"}, &r.Rule{Operator:r.Identifier, String:"TryStmt"}, &r.Rule{Operator:r.Identifier, String:"Throw"}, &r.Rule{Operator:r.Identifier, String:"FuncDecl"}, &r.Rule{Operator:r.Identifier, String:"Empty"}, &r.Rule{Operator:r.Identifier, String:"ExprStmt"}}}}}}}, &r.Rule{Operator:r.Production, String:"ImportStmt", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(metajsImport(takeAll(), up.pos)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwImport"}, &r.Rule{Operator:r.Identifier, String:"ModPath"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"ModPath", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ModDq"}, &r.Rule{Operator:r.Identifier, String:"ModSq"}}}}}, &r.Rule{Operator:r.Production, String:"ModDq", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"\""}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(unescapeJs(up.in)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"StrEsc"}, &r.Rule{Operator:r.Identifier, String:"DqPlain"}}}}}}}, &r.Rule{Operator:r.Token, String:"\""}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"ModSq", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"'"}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(unescapeJs(up.in)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"StrEsc"}, &r.Rule{Operator:r.Identifier, String:"SqPlain"}}}}}}}, &r.Rule{Operator:r.Token, String:"'"}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"Switch", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeSwitch(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwSwitch"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Token, String:"{"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"CaseLabel"}, &r.Rule{Operator:r.Identifier, String:"DefaultLabel"}, &r.Rule{Operator:r.Identifier, String:"Statement"}}}}}, &r.Rule{Operator:r.Token, String:"}"}}}}}, &r.Rule{Operator:r.Production, String:"CaseLabel", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({casev: pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwCase"}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}, &r.Rule{Operator:r.Token, String:":"}}}}}, &r.Rule{Operator:r.Production, String:"DefaultLabel", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({isdflt: true}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwDefault"}, &r.Rule{Operator:r.Token, String:":"}}}}}, &r.Rule{Operator:r.Production, String:"Block", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeBlockStmt(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"{"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Statement"}}}, &r.Rule{Operator:r.Token, String:"}"}}}}}, &r.Rule{Operator:r.Production, String:"VarDecl", Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"VarDeclCore"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}, &r.Rule{Operator:r.Production, String:"VarDeclCore", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeSeq(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwVar"}, &r.Rule{Operator:r.Identifier, String:"Declarator"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Identifier, String:"Declarator"}}}}}}}, &r.Rule{Operator:r.Production, String:"Declarator", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeDecl(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"="}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"If", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeIf(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwIf"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Identifier, String:"Statement"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwElse"}, &r.Rule{Operator:r.Identifier, String:"Statement"}}}}}}}, &r.Rule{Operator:r.Production, String:"While", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeWhile(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwWhile"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Identifier, String:"Statement"}}}}}, &r.Rule{Operator:r.Production, String:"Do", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeDo(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwDo"}, &r.Rule{Operator:r.Identifier, String:"Statement"}, &r.Rule{Operator:r.Identifier, String:"KwWhile"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"For", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeFor(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwFor"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ForInit"}}}, &r.Rule{Operator:r.Token, String:";"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ForCond"}}}, &r.Rule{Operator:r.Token, String:";"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ForPost"}}}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Identifier, String:"Statement"}}}}}, &r.Rule{Operator:r.Production, String:"ForInit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({k:\"init\", t:pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ForVar"}, &r.Rule{Operator:r.Identifier, String:"ForExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"ForVar", Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"VarDeclCore"}}}, &r.Rule{Operator:r.Production, String:"ForExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(exprToClause(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}}}}}, &r.Rule{Operator:r.Production, String:"ForCond", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({k:\"cond\", t:pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}}}}}, &r.Rule{Operator:r.Production, String:"ForPost", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({k:\"post\", t:exprToClause(pop())}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}}}}}, &r.Rule{Operator:r.Production, String:"Return", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeReturn(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwReturn"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"Break", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeBreak()) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwBreak"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"Continue", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeContinue()) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwContinue"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"Throw", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeThrow(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwThrow"}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"TryStmt", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeTry(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwTry"}, &r.Rule{Operator:r.Identifier, String:"TryBody"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"CatchClause"}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"FinallyClause"}}}}}}}, &r.Rule{Operator:r.Production, String:"TryBody", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({trybody: pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"CatchClause", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeCatch(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwCatch"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Token, String:")"}}}, &r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"FinallyClause", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({finbody: pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwFinally"}, &r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"FuncDecl", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeFuncDecl(pop(), pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwFunction"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Identifier, String:"ParamList"}, &r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"ParamList", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(takeAll()) /* Collect the parameter names into one array. */ "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}}}}}, &r.Rule{Operator:r.Token, String:")"}}}}}, &r.Rule{Operator:r.Production, String:"Empty", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(function(b) { return b }) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}, &r.Rule{Operator:r.Production, String:"ExprStmt", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(exprToStmt(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"Expression", Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}, &r.Rule{Operator:r.Production, String:"AssignExpr", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Assignment"}, &r.Rule{Operator:r.Identifier, String:"CondExpr"}}}}}, &r.Rule{Operator:r.Production, String:"Assignment", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeAssign(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Target"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"+="}, &r.Rule{Operator:r.Token, String:"-="}, &r.Rule{Operator:r.Token, String:"*="}, &r.Rule{Operator:r.Token, String:"/="}, &r.Rule{Operator:r.Token, String:"%="}, &r.Rule{Operator:r.Token, String:"="}}}}}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}, &r.Rule{Operator:r.Production, String:"Target", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeTargetRef(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"CallSuffix"}, &r.Rule{Operator:r.Identifier, String:"DotSuffix"}, &r.Rule{Operator:r.Identifier, String:"IndexSuffix"}}}}}}}}}, &r.Rule{Operator:r.Production, String:"CondExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeCond(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"OrExpr"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"?"}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}, &r.Rule{Operator:r.Token, String:":"}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"OrExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeOrAnd(takeAll(), true)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AndExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"||"}, &r.Rule{Operator:r.Identifier, String:"AndExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"AndExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeOrAnd(takeAll(), false)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"BitOrExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"&&"}, &r.Rule{Operator:r.Identifier, String:"BitOrExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"BitOrExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"BitXorExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(\"|\") "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"|"}}}, &r.Rule{Operator:r.Identifier, String:"BitXorExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"BitXorExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"BitAndExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(\"^\") "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"^"}}}, &r.Rule{Operator:r.Identifier, String:"BitAndExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"BitAndExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"EqExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(\"&\") "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"&"}}}, &r.Rule{Operator:r.Identifier, String:"EqExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"EqExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"RelExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"==="}, &r.Rule{Operator:r.Token, String:"!=="}, &r.Rule{Operator:r.Token, String:"=="}, &r.Rule{Operator:r.Token, String:"!="}}}}}, &r.Rule{Operator:r.Identifier, String:"RelExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"RelExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ShiftExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"<="}, &r.Rule{Operator:r.Token, String:">="}, &r.Rule{Operator:r.Token, String:"<"}, &r.Rule{Operator:r.Token, String:">"}}}}}, &r.Rule{Operator:r.Identifier, String:"ShiftExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"ShiftExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AddExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"<<"}, &r.Rule{Operator:r.Token, String:">>>"}, &r.Rule{Operator:r.Token, String:">>"}}}}}, &r.Rule{Operator:r.Identifier, String:"AddExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"AddExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"MulExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"+"}, &r.Rule{Operator:r.Token, String:"-"}}}}}, &r.Rule{Operator:r.Identifier, String:"MulExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"MulExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"UnaryExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"*"}, &r.Rule{Operator:r.Token, String:"/"}, &r.Rule{Operator:r.Token, String:"%"}}}}}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"UnaryExpr", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"PreIncDec"}, &r.Rule{Operator:r.Identifier, String:"Neg"}, &r.Rule{Operator:r.Identifier, String:"Not"}, &r.Rule{Operator:r.Identifier, String:"BitNot"}, &r.Rule{Operator:r.Identifier, String:"Typeof"}, &r.Rule{Operator:r.Identifier, String:"PostfixExpr"}}}}}, &r.Rule{Operator:r.Production, String:"PreIncDec", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makePreIncDec(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"++"}, &r.Rule{Operator:r.Token, String:"--"}}}}}, &r.Rule{Operator:r.Identifier, String:"Target"}}}}}, &r.Rule{Operator:r.Production, String:"Neg", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeUnary(pop(), \"js_neg\")) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"-"}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}, &r.Rule{Operator:r.Production, String:"Not", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeUnary(pop(), \"js_not\")) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"!"}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}, &r.Rule{Operator:r.Production, String:"BitNot", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeBitNot(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"~"}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}, &r.Rule{Operator:r.Production, String:"Typeof", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeUnary(pop(), \"js_typeof\")) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwTypeof"}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}, &r.Rule{Operator:r.Production, String:"PostfixExpr", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"IncDec"}, &r.Rule{Operator:r.Identifier, String:"CallMember"}}}}}, &r.Rule{Operator:r.Production, String:"IncDec", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeIncDec(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Target"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"++"}, &r.Rule{Operator:r.Token, String:"--"}}}}}}}}}, &r.Rule{Operator:r.Production, String:"CallMember", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldCallMember(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Primary"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"CallSuffix"}, &r.Rule{Operator:r.Identifier, String:"DotSuffix"}, &r.Rule{Operator:r.Identifier, String:"IndexSuffix"}}}}}}}}}, &r.Rule{Operator:r.Production, String:"CallSuffix", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({kind:\"call\", args: takeAll()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AssignExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}, &r.Rule{Operator:r.Token, String:")"}}}}}, &r.Rule{Operator:r.Production, String:"DotSuffix", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"."}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({kind:\"member\", key: makeConst(up.in)}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}}}, &r.Rule{Operator:r.Production, String:"IndexSuffix", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({kind:\"member\", key: pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"["}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:"]"}}}}}, &r.Rule{Operator:r.Production, String:"Primary", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Sequence, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}}}, &r.Rule{Operator:r.Identifier, String:"FunctionExpr"}, &r.Rule{Operator:r.Identifier, String:"ObjectLit"}, &r.Rule{Operator:r.Identifier, String:"ArrayLit"}, &r.Rule{Operator:r.Identifier, String:"StringLit"}, &r.Rule{Operator:r.Identifier, String:"NumberLit"}, &r.Rule{Operator:r.Identifier, String:"True"}, &r.Rule{Operator:r.Identifier, String:"False"}, &r.Rule{Operator:r.Identifier, String:"Null"}, &r.Rule{Operator:r.Identifier, String:"Undefined"}, &r.Rule{Operator:r.Identifier, String:"VarRef"}}}}}, &r.Rule{Operator:r.Production, String:"FunctionExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeFunctionExpr(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwFunction"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Identifier, String:"ParamList"}, &r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"ObjectLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeObject(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"{"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"PropDef"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Identifier, String:"PropDef"}}}}}, &r.Rule{Operator:r.Token, String:"}"}}}}}, &r.Rule{Operator:r.Production, String:"PropDef", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeProp(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"PropKey"}, &r.Rule{Operator:r.Token, String:":"}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}, &r.Rule{Operator:r.Production, String:"PropKey", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Identifier, String:"StringLit"}}}}}, &r.Rule{Operator:r.Production, String:"ArrayLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeArray(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"["}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AssignExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}, &r.Rule{Operator:r.Token, String:"]"}}}}}, &r.Rule{Operator:r.Production, String:"Null", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeHandleConst(1)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"null"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}}}, &r.Rule{Operator:r.Production, String:"Undefined", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeHandleConst(0)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"undefined"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}}}, &r.Rule{Operator:r.Production, String:"VarRef", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeVarRef(up.in)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}}}, &r.Rule{Operator:r.Production, String:"StringLit", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"DqString"}, &r.Rule{Operator:r.Identifier, String:"SqString"}}}}}, &r.Rule{Operator:r.Production, String:"NumberLit", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"HexLit"}, &r.Rule{Operator:r.Identifier, String:"DecLit"}}}}}, &r.Rule{Operator:r.Production, String:"HexLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(hexAt(up.in, 2, up.in.length - 2))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0x"}, &r.Rule{Operator:r.Token, String:"0X"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Identifier, String:"HexDigit"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"HexDigit"}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"HexDigit", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"a"}, &r.Rule{Operator:r.Token, String:"f"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"A"}, &r.Rule{Operator:r.Token, String:"F"}}}}}}}, &r.Rule{Operator:r.Production, String:"KwImport", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"import"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwVar", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"var"}, &r.Rule{Operator:r.Token, String:"let"}, &r.Rule{Operator:r.Token, String:"const"}}}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwFunction", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"function"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwIf", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"if"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwElse", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"else"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwWhile", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"while"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwDo", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"do"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwFor", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"for"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwReturn", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"return"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwBreak", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"break"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwContinue", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"continue"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwThrow", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"throw"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwTry", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"try"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwCatch", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"catch"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwFinally", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"finally"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwTypeof", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"typeof"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwSwitch", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"switch"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwCase", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"case"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwDefault", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"default"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Command, String:"startScript", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\n\n    // Shared emitter machinery (module, handle constants, externs, loopStack\n    // protocol, expression/statement builders); see the `core` knobs below.\n    include(\"lib/compile-core.js\")\n\n    // takeAll empties the local stack of the current tag and returns its items in push\n    // order as a plain JS array.\n    // Resolves the JS string escapes (\\n \\t \\r \\0 \\xNN \\uNNNN, and \\c for the char itself).\n    // ----- The emitter state -----\n\n    var i8 = llvm.types.I8\n\n\n    // The handle constants: 0 undefined, 1 null, 2 false, 3 true.\n\n    // All js_* externals get declared on first use. Every parameter and result is i64,\n    // except the string pool pointer of js_str_mem.\n    // One module global per distinct string literal / name.\n    // The function being built, the current scope chain handle (an SSA value), and the\n    // enclosing loops (for break/continue).\n\n    // An i1 for conditional branches: js_truthy(v) != 0.\n    // ----- Expression thunks: function(block) -> {b: endBlock, v: i64 handle} -----\n\n    function makeHandleConst(n) {\n        var c = handle(n)\n        return function(b) { return {b: b, v: c} }\n    }\n    function makeUnary(t, extName) {\n        return function(b) {\n            var r = t(b)\n            return {b: r.b, v: callExt(r.b, extName, [r.v])}\n        }\n    }\n    // ~v is v ^ -1 on the ToInt32 value, so it reuses the xor external.\n    function makeBitNot(t) {\n        return function(b) {\n            var r = t(b)\n            b = r.b\n            return {b: b, v: callExt(b, \"js_bxor\", [r.v, callExt(b, \"js_num_i\", [handle(-1)])])}\n        }\n    }\n\n    binExt = {\"+\": \"js_add\", \"-\": \"js_sub\", \"*\": \"js_mul\", \"/\": \"js_div\", \"%\": \"js_mod\",\n                  \"==\": \"js_eq\", \"!=\": \"js_ne\", \"===\": \"js_seq\", \"!==\": \"js_sne\",\n                  \"<\": \"js_lt\", \">\": \"js_gt\", \"<=\": \"js_le\", \">=\": \"js_ge\",\n                  \"|\": \"js_bor\", \"^\": \"js_bxor\", \"&\": \"js_band\",\n                  \"<<\": \"js_shl\", \">>\": \"js_shr\", \">>>\": \"js_ushr\",\n                  \"+=\": \"js_add\", \"-=\": \"js_sub\", \"*=\": \"js_mul\", \"/=\": \"js_div\", \"%=\": \"js_mod\"}\n    wraps = {} // MetaJS numbers are not wrapped to 32 bit.\n\n    // items = [thunk, op, thunk, op, thunk, ...] -> one left folded thunk.\n    // || and && evaluate lazily and keep the deciding operand, exactly like in JS.\n    // Each step branches: on a decided value the right side is skipped, a phi merges.\n    // items = [thunk] or [condThunk, thenThunk, elseThunk].\n    function makeCond(items) {\n        if (items.length == 1) return items[0]\n        return function(b) {\n            var r = items[0](b)\n            var thenB = curF.NewBlock(\"\")\n            var elseB = curF.NewBlock(\"\")\n            var mergeB = curF.NewBlock(\"\")\n            r.b.NewCondBr(truthy(r.b, r.v), thenB, elseB)\n            var rt = items[1](thenB)\n            rt.b.NewBr(mergeB)\n            var re = items[2](elseB)\n            re.b.NewBr(mergeB)\n            var phi = mergeB.NewPhi([llvm.ir.NewIncoming(rt.v, rt.b), llvm.ir.NewIncoming(re.v, re.b)])\n            return {b: mergeB, v: phi}\n        }\n    }\n\n    function makeArray(items) {\n        return function(b) {\n            var arr = callExt(b, \"js_arr_new\", [])\n            for (var i = 0; i < items.length; i++) {\n                var r = items[i](b)\n                b = r.b\n                callExt(b, \"js_arr_push\", [arr, r.v])\n            }\n            return {b: b, v: arr}\n        }\n    }\n    // PropDef pops [valueThunk, key]; the key is an Id string or a constant string thunk.\n    function makeProp(valT, key) {\n        return {kt: (typeof key == \"string\") ? makeConst(key) : key, t: valT}\n    }\n    function makeObject(props) {\n        return function(b) {\n            var obj = callExt(b, \"js_obj_new\", [])\n            for (var i = 0; i < props.length; i++) {\n                var kr = props[i].kt(b)\n                b = kr.b\n                var vr = props[i].t(b)\n                b = vr.b\n                callExt(b, \"js_set\", [obj, kr.v, vr.v])\n            }\n            return {b: b, v: obj}\n        }\n    }\n\n    // items = [primaryThunk, {kind:\"call\"|\"member\", ...}...]. A member access remembers\n    // its object handle, so that a directly following call uses it as 'this'.\n    foldCallMember = function(items) {\n        if (items.length == 1) return items[0]\n        var primary = items[0]\n        var suffixes = items.slice(1)\n        return function(b) {\n            var r = primary(b)\n            b = r.b\n            var cur = r.v\n            var curThis = hUndef\n            for (var i = 0; i < suffixes.length; i++) {\n                var s = suffixes[i]\n                if (s.kind == \"member\") {\n                    curThis = cur\n                    var kr = s.key(b)\n                    b = kr.b\n                    cur = callExt(b, \"js_get\", [cur, kr.v])\n                } else {\n                    var argsV = callExt(b, \"js_arr_new\", [])\n                    for (var j = 0; j < s.args.length; j++) {\n                        var ar = s.args[j](b)\n                        b = ar.b\n                        callExt(b, \"js_arr_push\", [argsV, ar.v])\n                    }\n                    cur = callExt(b, \"js_call\", [cur, curThis, argsV])\n                    curThis = hUndef\n                }\n            }\n            return {b: b, v: cur}\n        }\n    }\n\n    // Target items = [nameString, suffix marker...] -> reference descriptor.\n    // Walks a target path (members and calls) up to the last element, which must\n    // be a member. Returns {b, obj, key} with the object and the last key evaluated.\n    function emitRefPath(b, ref) {\n        var cur = callExt(b, \"js_scope_get\", [curScopeV, emitStr(b, ref.name)])\n        var curThis = hUndef\n        for (var i = 0; i < ref.path.length - 1; i++) {\n            var s = ref.path[i]\n            if (s.kind == \"member\") {\n                curThis = cur\n                var kr = s.key(b)\n                b = kr.b\n                cur = callExt(b, \"js_get\", [cur, kr.v])\n            } else {\n                var argsV = callExt(b, \"js_arr_new\", [])\n                for (var j = 0; j < s.args.length; j++) {\n                    var ar = s.args[j](b)\n                    b = ar.b\n                    callExt(b, \"js_arr_push\", [argsV, ar.v])\n                }\n                cur = callExt(b, \"js_call\", [cur, curThis, argsV])\n                curThis = hUndef\n            }\n        }\n        var last = ref.path[ref.path.length - 1].key(b)\n        return {b: last.b, obj: cur, key: last.v}\n    }\n    // items = [ref, opString, valueThunk]. The value of an assignment is the assigned value.\n    function makeAssign(items) {\n        var ref = items[0]\n        var op = items[1]\n        var valT = items[2]\n        return function(b) {\n            var r = valT(b)\n            b = r.b\n            var v = r.v\n            if (ref.path.length == 0) {\n                var nameV = emitStr(b, ref.name)\n                if (op != \"=\") {\n                    var old = callExt(b, \"js_scope_get\", [curScopeV, nameV])\n                    v = callExt(b, binExt[op], [old, v])\n                }\n                callExt(b, \"js_tset\", [curScopeV, nameV, v])\n            } else {\n                var p = emitRefPath(b, ref)\n                b = p.b\n                if (op != \"=\") {\n                    var oldM = callExt(b, \"js_get\", [p.obj, p.key])\n                    v = callExt(b, binExt[op], [oldM, v])\n                }\n                callExt(b, \"js_set\", [p.obj, p.key, v])\n            }\n            return {b: b, v: v}\n        }\n    }\n    // items = [ref, \"++\"|\"--\"]. Post increment: the expression value is the old (coerced) one.\n    function makeIncDec(items) {\n        var ref = items[0]\n        var extName = (items[1] == \"++\") ? \"js_add\" : \"js_sub\"\n        return function(b) {\n            var oneV = callExt(b, \"js_num_i\", [handle(1)])\n            if (ref.path.length == 0) {\n                var nameV = emitStr(b, ref.name)\n                var oldV = callExt(b, \"js_tonum\", [callExt(b, \"js_scope_get\", [curScopeV, nameV])])\n                callExt(b, \"js_tset\", [curScopeV, nameV, callExt(b, extName, [oldV, oneV])])\n                return {b: b, v: oldV}\n            }\n            var p = emitRefPath(b, ref)\n            b = p.b\n            var oldM = callExt(b, \"js_tonum\", [callExt(b, \"js_get\", [p.obj, p.key])])\n            callExt(b, \"js_set\", [p.obj, p.key, callExt(b, extName, [oldM, oneV])])\n            return {b: b, v: oldM}\n        }\n    }\n    // Prefix ++/--: like makeIncDec, but the expression value is the new one.\n    function makePreIncDec(ref, op) {\n        var extName = (op == \"++\") ? \"js_add\" : \"js_sub\"\n        return function(b) {\n            var oneV = callExt(b, \"js_num_i\", [handle(1)])\n            if (ref.path.length == 0) {\n                var nameV = emitStr(b, ref.name)\n                var oldV = callExt(b, \"js_tonum\", [callExt(b, \"js_scope_get\", [curScopeV, nameV])])\n                var newV = callExt(b, extName, [oldV, oneV])\n                callExt(b, \"js_tset\", [curScopeV, nameV, newV])\n                return {b: b, v: newV}\n            }\n            var p = emitRefPath(b, ref)\n            b = p.b\n            var oldM = callExt(b, \"js_tonum\", [callExt(b, \"js_get\", [p.obj, p.key])])\n            var newM = callExt(b, extName, [oldM, oneV])\n            callExt(b, \"js_set\", [p.obj, p.key, newM])\n            return {b: b, v: newM}\n        }\n    }\n\n    // ----- Primitives implemented in MetaJS (-rt-prims) -----\n    // Phase 1 of docs/runtime-rework-plan.md asks how small the C floor of the runtime\n    // really is. With -rt-prims this compiler compiles lib/rt-prims.metajs into the\n    // module it is building and routes every primitive DEFINED there to the compiled\n    // MetaJS body instead of declaring the Go external - so whatever the emitted module\n    // still `declare`s afterwards is the measured floor. Without the flag none of this\n    // runs and the output is byte for byte the old one.\n    var funcByIdx = {}   // \"$<jsf index>\" -> the IR function (registerPrim needs the callee)\n    var primShim = {}    // \"$js_ne\" -> the IR function the operator now calls\n    var inPrims = false  // True while lib/rt-prims.metajs is emitted (makeFuncDecl then\n                         // knows that each declaration it sees IS a primitive).\n\n    // The routing point: the same contract as compile-core's callExt, plus the lookup.\n    // It stays live while the primitives themselves are emitted, so a primitive can be\n    // written on top of the ones ABOVE it in lib/rt-prims.metajs (js_ne uses ==, which\n    // is js_eq, three lines up). It cannot accidentally recurse: registerPrim runs\n    // AFTER the body it registers, so a primitive using itself finds no shim yet and\n    // quietly falls back to the external - visible as a leftover `declare` in the\n    // emitted module, which is exactly the measurement.\n    callExt = function(b, name, args) {\n        noteExt(name)   // compile-core's block-scope elision counts declarations here.\n        var sh = primShim[\"$\" + name]\n        if (sh != undefined) { return b.NewCall(sh, args) }\n        return b.NewCall(getExtern(name, args.length), args)\n    }\n\n    // One shim per primitive: a function with the EXTERNAL's signature (i64 in, i64 out)\n    // that packs its arguments into a js array and calls the compiled MetaJS body as a\n    // direct IR call. Not through js_call: that is a floor primitive itself, and going\n    // through it would make every routed operator depend on the very machinery it is\n    // supposed to sit on top of. The environment is the undefined handle - the prims\n    // resolve no free name (see the header of lib/rt-prims.metajs).\n    function registerPrim(name, idx, arity) {\n        // The external is already declared: something emitted before this point called\n        // it - which for a primitive being defined here means its own body did (directly\n        // or through a cycle). The routing still works, but the primitive did NOT leave\n        // the floor: the module now carries both a declare and a define of the name.\n        // Say so, instead of letting the measurement quietly lie.\n        if (externs[name] != undefined) {\n            eprintln(\"warning: rt-prims: \" + name + \" is used by its own implementation - it stays a floor primitive\")\n        }\n        var params = []\n        for (var i = 0; i < arity; i++) { params.push(llvm.ir.NewParam(\"\", i64)) }\n        // The shim carries a PRIVATE symbol name, not the external's. Nothing looks\n        // it up by name - every routed call goes through primShim, which holds the IR\n        // function itself - so the name is free, and taking the external's name was a\n        // link-time collision waiting to happen: the C floor defines all thirteen of\n        // these, so `-rt-prims -exe` failed with \"13 symbol(s) are defined MORE THAN\n        // ONCE\" (js_eq, js_ge, js_gt, js_le, js_ne, js_neg, js_not, js_num_str,\n        // js_sne, js_sub, js_tonum, js_typeof, js_ushr) and the two flags could not be\n        // combined at all - open item 12 of docs/runtime-next-plan.md. It also\n        // collided with the module's OWN declare in the self-use case the warning\n        // above reports. The measurement is untouched: it counts what the module still\n        // `declare`s, and a shimmed name never reaches getExtern.\n        var sh = m.NewFunc(\"jsprim_\" + name, i64, params)\n        var b = sh.NewBlock(\"entry\")\n        var argsV = b.NewCall(getExtern(\"js_arr_new\", 0), [])\n        for (var i = 0; i < arity; i++) { b.NewCall(getExtern(\"js_arr_push\", 2), [argsV, sh.Params[i]]) }\n        b.NewRet(b.NewCall(funcByIdx[\"$\" + idx], [hUndef, argsV]))\n        primShim[\"$\" + name] = sh\n    }\n\n    // Compile lib/rt-prims.metajs and emit its top-level function declarations. The\n    // declaring statements land in jsrtprims, which is NEVER called: only the jsf_N\n    // bodies they create matter, and makeFuncDecl hands each one to registerPrim.\n    // load() reads relative to the grammar file under both engines. The c.parse guard\n    // keeps this out of the frozen TAG-script runtime, whose c carries only `tracing`\n    // (abnf/frozen.go, newWalkRuntime): tag scripts keep the Go floor, so the bootstrap\n    // does not pay for the measurement.\n    function emitPrims() {\n        if (c.rtPrims != true) { return false }\n        if (c.parse == undefined) { return false }\n        var src = load(\"lib/rt-prims.metajs\")\n        var asg = c.parse(c.agrammar, src, null, \"lib/rt-prims.metajs\")\n        c.pushSource(\"lib/rt-prims.metajs\", src)\n        importDepth = importDepth + 1 // Stash the top-level thunks; do not build a second jsrun.\n        c.compile(asg)\n        importDepth = importDepth - 1\n        c.popSource()\n        var g = importedGroups.pop()\n        var pf = m.NewFunc(\"jsrtprims\", i64, [llvm.ir.NewParam(\"env\", i64)])\n        curF = pf\n        var b = pf.NewBlock(\"entry\")\n        curScopeV = pf.Params[0]\n        inPrims = true\n        c.pushSourceFile(g.file)\n        for (var i = 0; i < g.items.length; i++) { b = g.items[i](b) }\n        c.popSource()\n        inPrims = false\n        b.NewRet(hUndef)\n        return true\n    }\n\n    // A function body: an own IR function jsf_N(env, args) whose entry opens a scope on\n    // the passed environment, binds the parameters and 'arguments', and runs the body.\n    // isCtl marks a try/catch body closure: a return/break/continue leaving it emits a\n    // control signal instead of a ret/br (see compile-core inCtlBody / excDispatch).\n    function emitFunction(paramNames, bodyT, isCtl) {\n        funcCount++\n        var idx = funcCount\n        var f = m.NewFunc(\"jsf_\" + idx, i64, [llvm.ir.NewParam(\"env\", i64), llvm.ir.NewParam(\"args\", i64)])\n        funcByIdx[\"$\" + idx] = f // -rt-prims: registerPrim needs the callee, not just its index.\n\n        var savedF = curF\n        var savedScope = curScopeV\n        var savedLoops = loopStack\n        var savedTag = curFTag\n        // A nested function's declarations land in ITS frame, so they must not make the\n        // block that contains the function look like a block that declares (compile-core\n        // makeBlockStmt / declCount).\n        var savedDecl = declCount\n        curF = f\n        curFTag = idx\n        loopStack = []\n        if (isCtl) { ctlEnter(idx) }\n\n        var b = f.NewBlock(\"entry\")\n        curScopeV = callExt(b, \"js_scope_new\", [f.Params[0]])\n        for (var i = 0; i < paramNames.length; i++) {\n            callExt(b, \"js_tdecl\", [curScopeV, emitStr(b, paramNames[i]),\n                                    callExt(b, \"js_arg\", [f.Params[1], handle(i)])])\n        }\n        callExt(b, \"js_tdecl\", [curScopeV, emitStr(b, \"arguments\"), f.Params[1]])\n        var endB = bodyT(b)\n        endB.NewRet(hUndef) // A function without return returns undefined.\n\n        if (isCtl) { ctlLeave() }\n        curF = savedF\n        curScopeV = savedScope\n        loopStack = savedLoops\n        curFTag = savedTag\n        declCount = savedDecl\n        return idx\n    }\n    function makeFunctionExpr(bodyT, paramNames) {\n        return function(b) {\n            var idx = emitFunction(paramNames, bodyT)\n            return {b: b, v: callExt(b, \"js_closure\", [handle(idx), curScopeV])}\n        }\n    }\n\n    // ----- Statement thunks: function(block) -> block to continue in -----\n\n    // An expression in statement position: evaluate the value and record it as the\n    // program completion value (what a goja Run() would return; js_getret reads it).\n    exprToStmt = function(t) {\n        return function(b) {\n            var r = t(b)\n            callExt(r.b, \"js_setret\", [r.v])\n            return r.b\n        }\n    }\n    // For loop init/post clauses: evaluate and drop (they are no statements, so\n    // they must not touch the completion value).\n    function exprToClause(t) {\n        return function(b) { return t(b).b }\n    }\n    // items = [name] or [name, initThunk].\n    function makeDecl(items) {\n        var name = items[0]\n        return function(b) {\n            var v = hUndef\n            if (items.length > 1) {\n                var r = items[1](b)\n                b = r.b\n                v = r.v\n            }\n            callExt(b, \"js_tdecl\", [curScopeV, emitStr(b, name), v])\n            return b\n        }\n    }\n    // items = [cond, then] or [cond, then, else].\n    // Note: the childs lie on the stack in source order, so pop() delivers them reversed.\n    function makeDo(condT, bodyT) {\n        return function(b) {\n            var bodyB = curF.NewBlock(\"\")\n            var condB = curF.NewBlock(\"\")\n            var exitB = curF.NewBlock(\"\")\n            b.NewBr(bodyB)\n            loopStack.push({cont: condB, brk: exitB})\n            bodyT(bodyB).NewBr(condB)\n            loopStack.pop()\n            var r = condT(condB)\n            r.b.NewCondBr(truthy(r.b, r.v), bodyB, exitB)\n            return exitB\n        }\n    }\n    // items = [{k:\"init\"|\"cond\"|\"post\", t:thunk}..., bodyThunk].\n    function makeFor(items) {\n        var bodyT = items.pop()\n        var init = null, cond = null, post = null\n        for (var i = 0; i < items.length; i++) {\n            if (items[i].k == \"init\") init = items[i].t\n            if (items[i].k == \"cond\") cond = items[i].t\n            if (items[i].k == \"post\") post = items[i].t\n        }\n        return function(b) {\n            var saved = curScopeV\n            curScopeV = callExt(b, \"js_scope_new\", [curScopeV]) // The for header is its own scope.\n            if (init != null) b = init(b)\n            var headB = curF.NewBlock(\"\")\n            var bodyB = curF.NewBlock(\"\")\n            var postB = curF.NewBlock(\"\")\n            var exitB = curF.NewBlock(\"\")\n            b.NewBr(headB)\n            if (cond != null) {\n                var r = cond(headB)\n                r.b.NewCondBr(truthy(r.b, r.v), bodyB, exitB)\n            } else {\n                headB.NewBr(bodyB)\n            }\n            loopStack.push({cont: postB, brk: exitB})\n            bodyT(bodyB).NewBr(postB)\n            loopStack.pop()\n            var pb = postB\n            if (post != null) pb = post(postB)\n            pb.NewBr(headB)\n            curScopeV = saved\n            return exitB\n        }\n    }\n    // items = [] or [exprThunk]. retStmt (compile-core) emits a plain ret, or a control\n    // signal when this return leaves a try body. Code behind it is unreachable but\n    // still lands in a valid (dead) block.\n    function makeReturn(items) {\n        var t = items.length > 0 ? items[0] : null\n        return function(b) {\n            var v = hUndef\n            if (t != null) {\n                var r = t(b)\n                b = r.b\n                v = r.v\n            }\n            return retStmt(b, v)\n        }\n    }\n    function makeThrow(t) {\n        return function(b) {\n            var r = t(b)\n            callExt(r.b, \"js_throw\", [r.v])\n            r.b.NewRet(hUndef) // Never reached: js_throw unwinds on the host side.\n            return deadBlock()\n        }\n    }\n    // makeCatch is shared - see lib/compile-core.js.\n    // items = [{trybody}, {catchbody,catchname}?, {finbody}?]. Each body becomes its\n    // own IR closure over the current scope; js_try (jsrt.go) runs the try under a Go\n    // recover, hands a thrown value to the catch closure (a one-parameter function\n    // bound to the catch name) and always runs the finally closure. The try and catch\n    // bodies are ctl closures, so a return/break/continue leaving them becomes a control\n    // signal that excDispatch re-issues here. The finally body is a ctl closure too:\n    // its signal overrides the try/catch completion inside js_try (and cancels a\n    // pending rethrow), like in JS.\n    function makeTry(items) {\n        var tryT = anytype, catchT = anytype, catchName = anytype, finallyT = anytype\n        for (var i = 0; i < items.length; i++) {\n            if (items[i].trybody != undefined) { tryT = items[i].trybody }\n            else if (items[i].catchbody != undefined) { catchT = items[i].catchbody; catchName = items[i].catchname }\n            else if (items[i].finbody != undefined) { finallyT = items[i].finbody }\n        }\n        return function(b) {\n            var tryClo = callExt(b, \"js_closure\", [handle(emitFunction([], tryT, true)), curScopeV])\n            var catchClo = hUndef\n            if (catchT != undefined) {\n                var cn = (catchName != undefined) ? catchName : \"__caught\"\n                catchClo = callExt(b, \"js_closure\", [handle(emitFunction([cn], catchT, true)), curScopeV])\n            }\n            var finClo = hUndef\n            if (finallyT != undefined) {\n                finClo = callExt(b, \"js_closure\", [handle(emitFunction([], finallyT, true)), curScopeV])\n            }\n            var ctl = callExt(b, \"js_try\", [tryClo, catchClo, finClo])\n            return excDispatch(b, ctl)\n        }\n    }\n    // items = [subjThunk, ({casev}|{isdflt}|stmtThunk)...]. The flat label/statement\n    // list is grouped at build time. The dispatch chain compares with js_seq (===);\n    // the case bodies fall through into each other, break jumps to the exit, and\n    // continue still targets the enclosing loop.\n    function makeSwitch(items) {\n        var subj = items[0]\n        var cases = []\n        var cur = null\n        for (var i = 1; i < items.length; i++) {\n            var p = items[i]\n            if (p != undefined && (p.casev != undefined || p.isdflt != undefined)) {\n                cur = {isDefault: p.isdflt != undefined, v: p.casev, body: []}\n                cases.push(cur)\n            } else {\n                if (cur == null) {\n                    println(\"js compiler error: switch: a statement before the first case label\")\n                    exit(1)\n                }\n                cur.body.push(p)\n            }\n        }\n        return function(b) {\n            var r = subj(b)\n            b = r.b\n            var exitB = curF.NewBlock(\"\")\n            var bodyBs = []\n            var dfltB = exitB\n            for (var i = 0; i < cases.length; i++) {\n                bodyBs.push(curF.NewBlock(\"\"))\n                if (cases[i].isDefault && dfltB === exitB) { dfltB = bodyBs[i] }\n            }\n            for (var i = 0; i < cases.length; i++) {\n                if (cases[i].isDefault) { continue }\n                var rc = cases[i].v(b)\n                b = rc.b\n                var nextB = curF.NewBlock(\"\")\n                b.NewCondBr(truthy(b, callExt(b, \"js_seq\", [r.v, rc.v])), bodyBs[i], nextB)\n                b = nextB\n            }\n            b.NewBr(dfltB)\n            var outerCont = loopStack.length > 0 ? loopStack[loopStack.length - 1].cont : null\n            loopStack.push({cont: outerCont, brk: exitB})\n            for (var i = 0; i < cases.length; i++) {\n                var bb = bodyBs[i]\n                var body = cases[i].body\n                for (var j = 0; j < body.length; j++) { bb = body[j](bb) }\n                bb.NewBr(i + 1 < cases.length ? bodyBs[i + 1] : exitB)\n            }\n            loopStack.pop()\n            return exitB\n        }\n    }\n    // Local stack = [name, [paramNames...], bodyThunk] -- declares the closure when executed.\n    function makeFuncDecl(bodyT, paramNames, name) {\n        return function(b) {\n            var idx = emitFunction(paramNames, bodyT)\n            // Inside lib/rt-prims.metajs every declaration IS a primitive: wire the\n            // operator that used to call the external to this body (-rt-prims).\n            if (inPrims) { registerPrim(name, idx, paramNames.length) }\n            var cl = callExt(b, \"js_closure\", [handle(idx), curScopeV])\n            callExt(b, \"js_tdecl\", [curScopeV, emitStr(b, name), cl])\n            return b\n        }\n    }\n\n    // The top level statements become jsrun(scope, args): the caller provides the scope\n    // that the top level declarations land in (the frozen tag executor passes the shared\n    // scope of the compile run, so scripts see each others globals). The return value is\n    // the completion value: what the last executed expression statement produced.\n    // jsmain(env, args) is the standalone entry on top of it: it makes a fresh scope,\n    // runs the program, and then calls main() - the self checking test convention.\n    // ----- Project-file imports (see the ImportStmt rule) -----\n    // compile-core's resolveImport calls fail() on an unresolved import; add a local one.\n    function fail(msg) { println(\"metajs compiler error: \" + msg); exit(1) }\n    function metajsImport(items, pos) {\n        resolveImport(items[items.length - 1], pos)\n        return function(b) { return b }\n    }\n    // MetaJS has no importable stdlib modules, so every import path is a project file.\n    core.stdlibImports = []\n    // An imported file is parsed with this grammar and walked with importDepth > 0, so its\n    // buildMain stashes its top-level thunks into importedItems; the real buildMain prepends\n    // them to jsrun. Imported once; a leading './' is dropped and an extension supplied\n    // before the -i-root search. Declared before buildMain so the vars exist when\n    // the freezer self-compiles the Program tag. importedList is the same set in IMPORT\n    // ORDER, which -rt-lib needs to scan for its exported surface (see there).\n    var importedFiles = {}\n    var importedList = []\n    var importDepth = 0\n    // imported files top-level items: stashImported / emitImported (compile-core)\n    core.importFile = function(path, pos) {\n        var rel = path\n        if (rel.length >= 2 && rel.charAt(0) == \".\" && rel.charAt(1) == \"/\") { rel = rel.substring(2) }\n        // \".js\" is appended only when the path has NO EXTENSION AT ALL. It used to be\n        // appended whenever the path did not already END in \".js\", which meant\n        // `import \"./runtime.metajs\"` searched for `runtime.metajs.js` and failed with\n        // `unresolved import` - the reason the shared layer-2 runtime could not be given\n        // the name docs/runtime-merge-plan.md gives it. `import \"./mod\"` is unchanged, and\n        // so is every path that already carries one. The scan is by hand and backwards to\n        // the first '.' or '/': the frozen subset has no lastIndexOf, its indexOf ignores a\n        // from-index, and the tag script uses no `break` - so the loop ends by driving the\n        // index negative.\n        var hasExt = false\n        var k = rel.length - 1\n        while (k >= 0) {\n            var kc = rel.charAt(k)\n            if (kc == \"/\") { k = 0 - 1 } else {\n                if (kc == \".\") {\n                    hasExt = true\n                    k = 0 - 1\n                } else { k = k - 1 }\n            }\n        }\n        if (!hasExt) { rel = rel + \".js\" }\n        var file = c.findImport(rel)\n        if (file == \"\") { return false }\n        if (importedFiles[\"$\" + file] == true) { return true }\n        importedFiles[\"$\" + file] = true\n        importedList.push(file)\n        var text = c.readFile(file)\n        var asg = c.parse(c.agrammar, text, null, file)\n        c.pushSource(file, text)\n        importDepth = importDepth + 1\n        c.compile(asg)\n        importDepth = importDepth - 1\n        c.popSource()\n        return true\n    }\n\n    function buildMain(items) {\n        // The walk of an imported file ends too (importDepth > 0): stash its top-level\n        // statement thunks for the real jsrun instead of emitting a second one.\n        if (importDepth > 0) {\n            stashImported(items) // stashed with its file; emitted later (compile-core)\n            return\n        }\n        // The MetaJS-implemented primitives go in FIRST: their shims must exist before\n        // any operator of the program is emitted (-rt-prims; a no-op without it).\n        emitPrims()\n        var f = m.NewFunc(\"jsrun\", i64, [llvm.ir.NewParam(\"scope\", i64), llvm.ir.NewParam(\"args\", i64)])\n        curF = f\n        var b = f.NewBlock(\"entry\")\n        curScopeV = f.Params[0]\n        callExt(b, \"js_setret\", [hUndef]) // A program without expression statements completes with undefined.\n        // The imported files' top level goes FIRST. Flipping it to APPEND was measured\n        // and is a LOSS - see the note at the ImportStmt rule.\n        b = emitImported(b)\n        b = makeSeq(items)(b)\n        b.NewRet(callExt(b, \"js_getret\", []))\n\n        var fm = m.NewFunc(\"jsmain\", i64, [llvm.ir.NewParam(\"env\", i64), llvm.ir.NewParam(\"args\", i64)])\n        curF = fm\n        var bm = fm.NewBlock(\"entry\")\n        var sc = callExt(bm, \"js_scope_new\", [fm.Params[0]])\n        bm.NewCall(f, [sc, fm.Params[1]])\n        // The entry point defaults to main() but -main (c.mainName) can name another.\n        var entry = c.mainName\n        if (entry == undefined || entry == \"\") { entry = \"main\" }\n        if (mainIsSnippet(entry)) {\n            curScopeV = sc // The snippet resolves names in the populated program scope.\n            bm = emitMainSnippet(bm, entry, \"Statement\")\n            bm.NewRet(emitNum(bm, 0))\n        } else {\n            var mainV = callExt(bm, \"js_scope_get\", [sc, emitStr(bm, entry)])\n            var argsV = callExt(bm, \"js_arr_new\", [])\n            bm.NewRet(callExt(bm, \"js_call\", [mainV, hUndef, argsV]))\n        }\n    }\n\n    // ===== goja driver =====\n    // Everything below this marker is the driver for the normal (goja) run of this\n    // grammar. The freezer (-freeze) cuts the start script here: only the library above\n    // goes into the bootstrap snapshot; in frozen mode the Go core replaces the driver.\n\n    // ----- layer 2: compile this file as a linkable runtime LIBRARY (-rt-lib) -----\n    // docs/runtime-rework-plan.md phase 4. A target language's compiler emits calls to\n    // js_* externs that are NOT the 48 generic MetaJS ones - js_luarith, js_lueq,\n    // js_lustr and so on. Those are the language's own semantics, they are written in\n    // MetaJS (languages/lib/<lang>-rt.metajs), and -rt-lib compiles such a file into a\n    // module that can be LINKED NEXT TO the program module instead of run.\n    //\n    // Three things separate the two modules, and all three are decided here, before\n    // c.compile, because they are just the counters compile-core names things with:\n    //\n    //   - jsf_N and str.N are OFFSET by a million, so no emitted name of the library\n    //     can collide with one of the program it is linked against. A program with a\n    //     million functions or string literals would collide; nothing here is close.\n    //   - the library's own jsmain/jsrun are RENAMED below (the program defines\n    //     jsmain, and runtime.c's main() calls it).\n    //   - the library's function table is jsdispatch_ext, the tail the PROGRAM's\n    //     jsdispatch falls through to. js_closure stores a raw index and js_call\n    //     resolves it through the one global jsdispatch; chaining is what lets two\n    //     separately compiled modules share that one entry point.\n    var rtLib = (c.rtLib == true)\n    if (rtLib) {\n        funcCount = 1000000\n        strCount = 1000000\n        numCount = 1000000   // jsnum./jsnumg. are module-level symbols too (compile-core emitNum).\n    }\n\n    // Build the module out of the parsed program.\n    c.compile(c.asg)\n\n    if (rtLib) {\n        // The exported surface is every TOP-LEVEL `function js_*` of the source. It is\n        // read off the source text rather than off the module because the module keeps\n        // only jsf_N: a MetaJS function is a value in a scope, and its name lives in the\n        // scope, not in the IR. A line starting in column 0 with `function js_` is a\n        // top-level declaration in a file the frozen subset already forbids ASI in.\n        //\n        // EVERY IMPORTED FILE IS SCANNED TOO, and that is not a convenience. Layer 2\n        // shares its common externs through lib/runtime.metajs\n        // (docs/runtime-merge-plan.md part A), and while only c.file was scanned a\n        // `function js_jadd` written THERE compiled, ran CORRECTLY under llvm.Run, and\n        // was UNDEFINED AT LINK TIME:\n        //     error: 1 unresolved symbol(s), and this build links a runtime ... js_jadd\n        // ./test.sh and --cross are both blind to that - neither builds an -exe - so\n        // tests/clang-check.sh was the only gate that reported it, and it reported it\n        // nine times at once. Concatenating the sources is enough because the scan is\n        // purely lexical and column-0 anchored; the imported files are appended after\n        // c.file so a name declared in both exports from the main file's spelling.\n        var libSrc = c.readFile(c.file)\n        var xi = 0\n        while (xi < importedList.length) {\n            libSrc = libSrc + \"\\n\" + c.readFile(importedList[xi])\n            xi = xi + 1\n        }\n        var seenExport = {}\n        var exports = []\n        var li = 0\n        var line = \"\"\n        while (li <= libSrc.length) {\n            var ch = li < libSrc.length ? libSrc.charAt(li) : \"\\n\"\n            if (ch == \"\\n\") {\n                if (line.length > 12 && line.substring(0, 12) == \"function js_\") {\n                    var op = line.indexOf(\"(\")\n                    var cp = line.indexOf(\")\")\n                    var nm = line.substring(9, op)\n                    var ps = line.substring(op + 1, cp)\n                    // The parameter names, split by hand (the frozen subset has no\n                    // split). A name ending in _raw marks a RAW parameter: see below.\n                    var pnames = []\n                    var cur = \"\"\n                    var pi = 0\n                    while (pi <= ps.length) {\n                        var pc = pi < ps.length ? ps.charAt(pi) : \",\"\n                        if (pc == \",\") {\n                            if (cur.length > 0) { pnames.push(cur) }\n                            cur = \"\"\n                        } else if (pc != \" \" && pc != \"\\t\") { cur = cur + pc }\n                        pi = pi + 1\n                    }\n                    // A RAW RETURN. The mirror image of the _raw parameter below,\n                    // and the trap the PHP port found that the Lua pilot did not:\n                    // not every extern ANSWERS a value handle either. compile-core's\n                    // truthy() emits `icmp ne <call>, 0` straight on the result of\n                    // core.truthyExt, so js_truthy - and every language's own spelling\n                    // of it, php's js_phtruthy among them - answers the raw integer 1\n                    // or 0. A shim that handed back the HANDLE of a MetaJS boolean\n                    // would answer 3 for true and 2 for FALSE, and 2 != 0, so every\n                    // condition in the program would be taken. A top-level function\n                    // whose name ends in __raw is exported under the name WITHOUT that\n                    // suffix and its result is put through the floor's own js_truthy,\n                    // which is exactly the raw 1/0 the caller is comparing against.\n                    var rawRet = false\n                    var sym = nm\n                    if (nm.length > 5 && nm.substring(nm.length - 5, nm.length) == \"__raw\") {\n                        rawRet = true\n                        sym = nm.substring(0, nm.length - 5)\n                    }\n                    // One wrapper per SYMBOL. A name declared in both the main file\n                    // and an imported one would otherwise emit two definitions of the\n                    // same external and the link would fail on a duplicate symbol -\n                    // the mirror of the bug this scan was widened to fix.\n                    if (seenExport[\"$\" + sym] != true) {\n                        seenExport[\"$\" + sym] = true\n                        exports.push({n: sym, s: nm, p: pnames, r: rawRet})\n                    }\n                }\n                line = \"\"\n            } else { line = line + ch }\n            li = li + 1\n        }\n        if (exports.length == 0) {\n            eprintln(\"error: -rt-lib: no top-level 'function js_*' to export\")\n            exit(1)\n        }\n\n        // jsmain is the program's entry point and jsrun is where its top level lives;\n        // both names are taken. Rename them: jsrtlib_run is called by the boot function\n        // below, and the library's jsmain (which would look up a main() that does not\n        // exist here) is renamed out of the way and never called.\n        var runF = undefined\n        var fi = 0\n        while (fi < m.Funcs.length) {\n            var fn = m.Funcs[fi]\n            if (fn.Name() == \"jsrun\") {\n                fn.GlobalName = \"jsrtlib_run\"\n                runF = fn\n            }\n            if (fn.Name() == \"jsmain\") { fn.GlobalName = \"jsrtlib_unused_main\" }\n            fi = fi + 1\n        }\n\n        // One global cell holding the library's own scope, and a boot function that\n        // fills it on first use. Lazy, so the library needs no hook in the program's\n        // startup path: whichever exported extern the program calls first boots it.\n        var envG = m.NewGlobalDef(\"jsrtlib_env\", llvm.constant.NewInt(i64, 0))\n        var bootF = m.NewFunc(\"jsrtlib_boot\", i64, [])\n        var bb0 = bootF.NewBlock(\"entry\")\n        var doB = bootF.NewBlock(\"boot\")\n        var skB = bootF.NewBlock(\"done\")\n        bb0.NewCondBr(bb0.NewICmp(llvm.enum.IPredEQ, bb0.NewLoad(i64, envG), llvm.constant.NewInt(i64, 0)), doB, skB)\n        // Pinned: the library's scope lives in a module global for the whole run, which\n        // is not a place lib/runtime.c's collector can find it (see js_gc_pin there).\n        var scV = callExt(doB, \"js_gc_pin\", [callExt(doB, \"js_scope_new\", [handle(0)])])\n        doB.NewStore(scV, envG)\n        doB.NewCall(runF, [scV, callExt(doB, \"js_arr_new\", [])])\n        doB.NewBr(skB)\n        skB.NewRet(handle(0))\n\n        // One exported shim per function, with the EXTERNAL's signature (i64 in, i64\n        // out). It boots, looks the name up in the library scope and calls it through\n        // js_call - the same path any MetaJS call takes, so a library function is\n        // reached exactly as it would be from MetaJS source.\n        var ei = 0\n        while (ei < exports.length) {\n            var ex = exports[ei]\n            var params = []\n            var pj = 0\n            while (pj < ex.p.length) {\n                params.push(llvm.ir.NewParam(\"\", i64))\n                pj = pj + 1\n            }\n            var sf = m.NewFunc(ex.n, i64, params)\n            // The CALLEE is cached in a global of its own. Without it every call of\n            // the extern walks the library scope by name (a linear compare over every\n            // function in the file), which is the single most expensive thing an\n            // exported shim can do: the callee never changes after boot.\n            var fG = m.NewGlobalDef(\"jsrtlib_f_\" + ex.n, llvm.constant.NewInt(i64, 0))\n            var sb = sf.NewBlock(\"entry\")\n            var lkB = sf.NewBlock(\"lookup\")\n            var goB = sf.NewBlock(\"go\")\n            sb.NewCondBr(sb.NewICmp(llvm.enum.IPredEQ, sb.NewLoad(i64, fG), llvm.constant.NewInt(i64, 0)), lkB, goB)\n            lkB.NewCall(bootF, [])\n            // Pinned for the same reason as jsrtlib_env: the resolved closure is cached\n            // in a module global and is otherwise invisible to the collector.\n            lkB.NewStore(callExt(lkB, \"js_gc_pin\",\n                [callExt(lkB, \"js_scope_get\", [lkB.NewLoad(i64, envG), emitStr(lkB, ex.s)])]), fG)\n            lkB.NewBr(goB)\n            sb = goB\n            var fV = sb.NewLoad(i64, fG)\n            var aV = callExt(sb, \"js_arr_new\", [])\n            pj = 0\n            while (pj < ex.p.length) {\n                // A RAW parameter. Not every argument of an extern is a value handle:\n                // the operator INDEX of js_luarith / js_lucmp / js_lubit (and the same\n                // trick in other language emitters) is a compile-time constant the\n                // grammar writes with handle(k), so the callee gets the small integer\n                // ITSELF, not a handle to it - and 0..3 happen to be the handles of\n                // undefined, null, false and true, which is what a MetaJS body would\n                // see instead. A parameter whose name ends in _raw is therefore boxed\n                // with js_num_i on the way in, so the MetaJS side reads a number.\n                var pv = sf.Params[pj]\n                var pn = ex.p[pj]\n                if (pn.length > 4 && pn.substring(pn.length - 4, pn.length) == \"_raw\") {\n                    pv = callExt(sb, \"js_num_i\", [pv])\n                }\n                callExt(sb, \"js_arr_push\", [aV, pv])\n                pj = pj + 1\n            }\n            var rv = callExt(sb, \"js_call\", [fV, hUndef, aV])\n            if (ex.r) { rv = callExt(sb, \"js_truthy\", [rv]) }\n            sb.NewRet(rv)\n            ei = ei + 1\n        }\n    }\n\n    // emitDispatch adds the FUNCTION TABLE a native build needs. js_closure stores a\n    // raw function INDEX (see the js_closure extern), and under llvm.Run the Go runtime\n    // turns that index back into a callee by looking \"jsf_<idx>\" up in the module it is\n    // attached to. A linked binary has no such reflection, so the module has to carry\n    // the mapping itself: jsdispatch(idx, env, args) compares idx against every emitted\n    // jsf_N and calls it directly. It is emitted ONLY for -exe (and for -rt-lib, which\n    // names it jsdispatch_ext - see there), so every other run of this grammar keeps the\n    // module it always had, byte for byte.\n    //\n    // chainExt asks for the SECOND HALF of the table, and it is what gave MetaJS a\n    // layer 2 (lib/metajs-rt.ll, see libPath below). The library module's own function\n    // indices are offset by a million, so an index >= 1000000 belongs to it and nothing\n    // in the program can collide: the miss arm - and the >= test that short-circuits it -\n    // calls jsdispatch_ext, which the library defines. This is js-to-llvm-ir.abnf's\n    // emitDispatch, unchanged; the mechanism is the reusable part of phase 4 and nothing\n    // in it is any one language's.\n    //\n    // It is asked for ONLY when the default runtime list is linked. With an explicit\n    // -rt (tests/metajs-link-stubrt.c) there IS no layer-2 module, so declaring an\n    // uncallable jsdispatch_ext would either fail the link or - worse - resolve to\n    // nothing; that build keeps the single-table module it always had, byte for byte,\n    // and so do -rt-lib and every non-native run.\n    //\n    // The ext declaration is carried in a ONE-ELEMENT ARRAY rather than in a local that\n    // starts undefined and is reassigned: MetaJS is typed and a local keeps its first\n    // type, which under -frozen turns such a rewrite into a hard error while goja stays\n    // green (docs/abnf-dialect-gotchas.md).\n    function emitDispatch(dname, chainExt) {\n        var idxs = []\n        var fns = []\n        var i = 0\n        while (i < m.Funcs.length) {\n            var f = m.Funcs[i]\n            var nm = f.Name()\n            if (nm.length > 4 && nm.substring(0, 4) == \"jsf_\") {\n                idxs.push(parseInt(nm.substring(4, nm.length)))\n                fns.push(f)\n            }\n            i = i + 1\n        }\n        var exts = []\n        if (chainExt) {\n            exts.push(m.NewFunc(\"jsdispatch_ext\", i64,\n                [llvm.ir.NewParam(\"idx\", i64), llvm.ir.NewParam(\"env\", i64), llvm.ir.NewParam(\"args\", i64)]))\n        }\n        var d = m.NewFunc(dname, i64,\n            [llvm.ir.NewParam(\"idx\", i64), llvm.ir.NewParam(\"env\", i64), llvm.ir.NewParam(\"args\", i64)])\n        var b = d.NewBlock(\"entry\")\n        if (exts.length > 0) {\n            var extB = d.NewBlock(\"ext\")\n            var ownB = d.NewBlock(\"own\")\n            b.NewCondBr(b.NewICmp(llvm.enum.IPredSGE, d.Params[0], llvm.constant.NewInt(i64, 1000000)), extB, ownB)\n            extB.NewRet(extB.NewCall(exts[0], [d.Params[0], d.Params[1], d.Params[2]]))\n            b = ownB\n        }\n        i = 0\n        while (i < fns.length) {\n            var hit = d.NewBlock(\"hit\" + idxs[i])\n            var nxt = d.NewBlock(\"miss\" + idxs[i])\n            b.NewCondBr(b.NewICmp(llvm.enum.IPredEQ, d.Params[0], llvm.constant.NewInt(i64, idxs[i])), hit, nxt)\n            hit.NewRet(hit.NewCall(fns[i], [d.Params[1], d.Params[2]]))\n            b = nxt\n            i = i + 1\n        }\n        if (exts.length > 0) {\n            b.NewRet(b.NewCall(exts[0], [d.Params[0], d.Params[1], d.Params[2]]))\n        } else {\n            b.NewRet(llvm.constant.NewInt(i64, 0))\n        }\n    }\n\n    // A runtime library is not run and not linked here: it is PRINTED, and the printed\n    // module is what the language grammar hands to clang next to lib/runtime.ll.\n    if (rtLib) {\n        emitDispatch(\"jsdispatch_ext\", false)\n        println(m)\n        exit(0)\n    }\n\n    // libPath locates a runtime input next to THIS grammar, so the build does not\n    // depend on the working directory the metacompiler was started in. It used to be\n    // runtimePath(), hard-wired to \"lib/runtime.ll\", because MetaJS linked the C floor\n    // and nothing else; it is the same function every other language grammar has.\n    function libPath(name) {\n        var mn = moduleName()\n        var cut = -1\n        var i = 0\n        while (i < mn.length) {\n            var ch = mn.charAt(i)\n            if (ch == \"/\" || ch == \"\\\\\") { cut = i }\n            i = i + 1\n        }\n        return mn.substring(0, cut + 1) + \"lib/\" + name\n    }\n\n    // With -exe PATH, link the module into a native executable (clang) instead of running\n    // it here. This module is HANDLE IR: every value is an i64 handle and the js_* externs\n    // it declares are the runtime, so the build only produces a working binary when a\n    // runtime that defines them is linked in. That runtime is lib/runtime.ll - the C floor\n    // of docs/runtime-rework-plan.md phase 3, compiled out of lib/runtime.c by\n    // c-to-llvm-ir.abnf (regenerate with tests/gen-runtime-ll.sh). An explicit -rt\n    // REPLACES it rather than adding to it, which is what lets tests/metajs-link-stubrt.c\n    // still stand in for the whole runtime in the link tests. Because a runtime is\n    // declared either way, llvm.BuildExecutable does NOT stub what is left over: a missing\n    // js_* is an error naming the symbol, not a silent zero.\n    //\n    // SINCE THE PART B UNBLOCK there are TWO default inputs, exactly as in the other\n    // fifteen grammars: lib/runtime.ll (the C floor) and lib/metajs-rt.ll (MetaJS's own\n    // layer 2, built from lib/metajs-rt.metajs by tests/gen-metajs-rt-ll.sh - by this\n    // very grammar, with -rt-lib). Without the second one a floor body that moved into\n    // lib/runtime.metajs reached every language's native build except MetaJS's, which is\n    // what left Part B with an empty movable set (docs/runtime-next-plan.md, \"Part B,\n    // move 1\"). An explicit -rt still replaces BOTH, and only the default list gets the\n    // chained function table - see emitDispatch's chainExt.\n    if (c.exePath != undefined && c.exePath != \"\") {\n        var rts = c.runtime\n        var ownRt = (rts == undefined || rts.length == 0)\n        emitDispatch(\"jsdispatch\", ownRt)\n        if (ownRt) { rts = [libPath(\"runtime.ll\"), libPath(\"metajs-rt.ll\")] }\n        var buildErr = llvm.BuildExecutable(m, c.exePath, rts)\n        if (buildErr != \"\") { println(buildErr); exit(1) }\n        println(\"js compiler: wrote executable \" + c.exePath)\n        exit(0)\n    }\n\n    // Show the compiler output (the LLVM IR module).\n    println(m)\n\n    // Run jsmain() with the built-in IR interpreter and the MetaJS handle runtime.\n    // The exit code of this metacompiler run is what main() returned, so test\n    // programs are self checking.\n    var res = llvm.RunJS(m, \"jsmain\")\n    var entryName = c.mainName\n    if (entryName == undefined || entryName == \"\") { entryName = \"main\" }\n    if (mainIsSnippet(entryName)) {\n        println(\"js compiler: -main snippet returned \" + res.Ret)\n    } else {\n        println(\"js compiler: \" + entryName + \"() returned \" + res.Ret)\n    }\n    exit(res.Ret)\n\n"}}}, &r.Rule{Operator:r.Command, String:"origin", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"languages/metajs-to-llvm-ir.abnf"}}}}
+var jsAgrammar = &r.Rules{&r.Rule{Operator:r.Command, String:"title", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"MetaJS to LLVM IR compiler"}}}, &r.Rule{Operator:r.Command, String:"extensions", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:".metajs"}}}, &r.Rule{Operator:r.Command, String:"description", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"Compiles MetaJS to an LLVM IR module and runs it with the built-in IR interpreter.\n\nThe language is exactly the one of metajs-interpreter.abnf; see there for a description\n(including the bitwise operators and assignment targets that reach through calls).\n\nThe emitted IR is handle threaded code: every dynamic value is an i64 handle into the\nvalue table of the Go side MetaJS runtime (abnf/jsrt.go), and every operation with real\nJS semantics is a call to one of its js_* externals (js_add, js_get, js_call, ...).\nOnly the control flow is real IR: if/while/for/&&/||/?: compile to basic blocks,\nbranches and phis, driven by js_truthy. The handles 0..3 are the constants undefined,\nnull, false and true. Variables live in scope chain objects on the host side\n(js_scope_new, js_scope_get, and the declaring/assigning js_tdecl/js_tset, which\nalso enforce the MetaJS type pinning), and the scope chain is what gives closures\ntheir captured\nenvironment: a function expression becomes an own IR function jsf_N(env, args) plus a\njs_closure(N, currentScope) at the site of its creation. String and number literals\nenter through module globals (js_str_mem) and js_num_i/js_num_str.\n\nEvery tag composes a small code generator function (a 'thunk') out of the thunks of its\nchildren. Expression thunks get the current basic block and return {b: endBlock,\nv: handle value}; statement thunks get the current block and return the block that the\nfollowing code has to continue in (short circuit operators and loops branch, so both\ncan move the insertion point). The top level becomes the function jsmain(env, args),\nwhich runs the program statements and then calls main().\n\nThe exit code of the metacompiler run is the value that main() returns, so MetaJS test\nprograms are self checking: they return 0 on success.\nThe same language with the same semantics is interpreted directly by metajs-interpreter.abnf.\n\nThis grammar has a second purpose: its own tag scripts (and every annotation script of\nthe other grammars) are written in MetaJS, so this compiler can compile the scripts that\ndefine it - that is what makes the frozen, goja free bootstrap possible. As a\nconsequence, every tag script runs under the MetaJS discipline rules when frozen:\ndeclaration before use and the pinned type class, with var v = anytype as the\ndeclared exemption. Under goja only the declaration rule holds (the scripts are\ncompiled as strict-mode JS; goja cannot pin types, and its anytype is plain\nundefined), so the -frozen leg of the test matrix is the conformance check for\ntag scripts."}}}, &r.Rule{Operator:r.Production, String:"Whitespace", Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.CharsOf, String:" \t\r\n"}, &r.Rule{Operator:r.Identifier, String:"Comment"}}}}}}}, &r.Rule{Operator:r.Production, String:"Comment", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"LineComment"}, &r.Rule{Operator:r.Identifier, String:"BlockComment"}}}}}, &r.Rule{Operator:r.Production, String:"LineComment", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"//"}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NotNewline"}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"BlockComment", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"/*"}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NotStar"}, &r.Rule{Operator:r.Sequence, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"*"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"*"}}}, &r.Rule{Operator:r.Identifier, String:"NotStarSlash"}}}}}}}, &r.Rule{Operator:r.Token, String:"*"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"*"}}}, &r.Rule{Operator:r.Token, String:"/"}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"NotNewline", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x00"}, &r.Rule{Operator:r.Token, String:"\t"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\v"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"NotStar", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x00"}, &r.Rule{Operator:r.Token, String:")"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"+"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"NotStarSlash", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x00"}, &r.Rule{Operator:r.Token, String:")"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"+"}, &r.Rule{Operator:r.Token, String:"."}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"Id", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"a"}, &r.Rule{Operator:r.Token, String:"z"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"A"}, &r.Rule{Operator:r.Token, String:"Z"}}}, &r.Rule{Operator:r.Token, String:"_"}, &r.Rule{Operator:r.Token, String:"$"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"a"}, &r.Rule{Operator:r.Token, String:"z"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"A"}, &r.Rule{Operator:r.Token, String:"Z"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Token, String:"_"}, &r.Rule{Operator:r.Token, String:"$"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"KwEnd", Childs:&r.Rules{&r.Rule{Operator:r.Command, String:"script", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\n    (function() {\n        var cc = c.peek(0)\n        return ((cc >= 48 && cc <= 57) || (cc >= 65 && cc <= 90) || cc === 95 || cc === 36 || (cc >= 97 && cc <= 122))\n            ? abnf.newToken(\"\\x01keyword-boundary\", 0)\n            : undefined\n    })()\n"}}}}}, &r.Rule{Operator:r.Production, String:"DqString", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"\""}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(unescapeJs(up.in))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"StrEsc"}, &r.Rule{Operator:r.Identifier, String:"DqPlain"}}}}}}}, &r.Rule{Operator:r.Token, String:"\""}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"SqString", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"'"}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(unescapeJs(up.in))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"StrEsc"}, &r.Rule{Operator:r.Identifier, String:"SqPlain"}}}}}}}, &r.Rule{Operator:r.Token, String:"'"}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"StrEsc", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"\\"}, &r.Rule{Operator:r.Range, Int:1, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" "}, &r.Rule{Operator:r.Token, String:"~"}}}}}, &r.Rule{Operator:r.Production, String:"DqPlain", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" "}, &r.Rule{Operator:r.Token, String:"!"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"#"}, &r.Rule{Operator:r.Token, String:"["}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"]"}, &r.Rule{Operator:r.Token, String:"~"}}}, &r.Rule{Operator:r.CharOf, String:"\t"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x7f"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"SqPlain", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" "}, &r.Rule{Operator:r.Token, String:"&"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Token, String:"["}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"]"}, &r.Rule{Operator:r.Token, String:"~"}}}, &r.Rule{Operator:r.CharOf, String:"\t"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\x7f"}, &r.Rule{Operator:r.Token, String:"\U0010ffff"}}}}}}}, &r.Rule{Operator:r.Production, String:"IntLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"1"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"DecLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseFloat(up.in))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"1"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"."}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumHex", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in.split(\"_\").join(\"\")))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"x"}, &r.Rule{Operator:r.Token, String:"X"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Identifier, String:"NumHexDig"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NumHexDig"}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumHexDig", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"a"}, &r.Rule{Operator:r.Token, String:"f"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"A"}, &r.Rule{Operator:r.Token, String:"F"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumBin", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in.split(\"_\").join(\"\").substring(2), 2))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"b"}, &r.Rule{Operator:r.Token, String:"B"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Identifier, String:"NumBinDig"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NumBinDig"}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumBinDig", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"1"}}}}}, &r.Rule{Operator:r.Production, String:"NumOct", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in.split(\"_\").join(\"\").substring(2), 8))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"o"}, &r.Rule{Operator:r.Token, String:"O"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"7"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"7"}}}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumInt", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseInt(up.in.split(\"_\").join(\"\")))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"1"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumDec", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(parseFloat(up.in.split(\"_\").join(\"\")))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"1"}, &r.Rule{Operator:r.Token, String:"9"}}}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Sequence, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"."}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Token, String:"_"}}}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"NumExp"}}}}}, &r.Rule{Operator:r.Identifier, String:"NumExp"}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"NumExp", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"e"}, &r.Rule{Operator:r.Token, String:"E"}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"+"}, &r.Rule{Operator:r.Token, String:"-"}}}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}}}}}, &r.Rule{Operator:r.Production, String:"True", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(true)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"true"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}}}, &r.Rule{Operator:r.Production, String:"False", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(false)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"false"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}}}, &r.Rule{Operator:r.Command, String:"startRule", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Program"}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}, &r.Rule{Operator:r.Production, String:"Program", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" buildMain(takeAll()) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Statement"}}}}}}}, &r.Rule{Operator:r.Production, String:"Statement", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(stmtPos(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Block"}, &r.Rule{Operator:r.Identifier, String:"ImportStmt"}, &r.Rule{Operator:r.Identifier, String:"VarDecl"}, &r.Rule{Operator:r.Identifier, String:"If"}, &r.Rule{Operator:r.Identifier, String:"While"}, &r.Rule{Operator:r.Identifier, String:"Do"}, &r.Rule{Operator:r.Identifier, String:"For"}, &r.Rule{Operator:r.Identifier, String:"Switch"}, &r.Rule{Operator:r.Identifier, String:"Return"}, &r.Rule{Operator:r.Identifier, String:"Break"}, &r.Rule{Operator:r.Identifier, String:"Continue"}, &r.Rule{Operator:r.Identifier, String:"TryStmt"}, &r.Rule{Operator:r.Identifier, String:"Throw"}, &r.Rule{Operator:r.Identifier, String:"FuncDecl"}, &r.Rule{Operator:r.Identifier, String:"Empty"}, &r.Rule{Operator:r.Identifier, String:"ExprStmt"}}}}}}}, &r.Rule{Operator:r.Production, String:"ImportStmt", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(metajsImport(takeAll(), up.pos)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwImport"}, &r.Rule{Operator:r.Identifier, String:"ModPath"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"ModPath", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ModDq"}, &r.Rule{Operator:r.Identifier, String:"ModSq"}}}}}, &r.Rule{Operator:r.Production, String:"ModDq", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"\""}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(unescapeJs(up.in)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"StrEsc"}, &r.Rule{Operator:r.Identifier, String:"DqPlain"}}}}}}}, &r.Rule{Operator:r.Token, String:"\""}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"ModSq", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"'"}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(unescapeJs(up.in)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"StrEsc"}, &r.Rule{Operator:r.Identifier, String:"SqPlain"}}}}}}}, &r.Rule{Operator:r.Token, String:"'"}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}, &r.Rule{Operator:r.Production, String:"Switch", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeSwitch(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwSwitch"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Token, String:"{"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"CaseLabel"}, &r.Rule{Operator:r.Identifier, String:"DefaultLabel"}, &r.Rule{Operator:r.Identifier, String:"Statement"}}}}}, &r.Rule{Operator:r.Token, String:"}"}}}}}, &r.Rule{Operator:r.Production, String:"CaseLabel", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({casev: pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwCase"}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}, &r.Rule{Operator:r.Token, String:":"}}}}}, &r.Rule{Operator:r.Production, String:"DefaultLabel", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({isdflt: true}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwDefault"}, &r.Rule{Operator:r.Token, String:":"}}}}}, &r.Rule{Operator:r.Production, String:"Block", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeBlockStmt(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"{"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Statement"}}}, &r.Rule{Operator:r.Token, String:"}"}}}}}, &r.Rule{Operator:r.Production, String:"VarDecl", Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"VarDeclCore"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}, &r.Rule{Operator:r.Production, String:"VarDeclCore", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeSeq(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwVar"}, &r.Rule{Operator:r.Identifier, String:"Declarator"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Identifier, String:"Declarator"}}}}}}}, &r.Rule{Operator:r.Production, String:"Declarator", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeDecl(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"="}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"If", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeIf(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwIf"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Identifier, String:"Statement"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwElse"}, &r.Rule{Operator:r.Identifier, String:"Statement"}}}}}}}, &r.Rule{Operator:r.Production, String:"While", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeWhile(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwWhile"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Identifier, String:"Statement"}}}}}, &r.Rule{Operator:r.Production, String:"Do", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeDo(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwDo"}, &r.Rule{Operator:r.Identifier, String:"Statement"}, &r.Rule{Operator:r.Identifier, String:"KwWhile"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"For", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeFor(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwFor"}, &r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ForInit"}}}, &r.Rule{Operator:r.Token, String:";"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ForCond"}}}, &r.Rule{Operator:r.Token, String:";"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ForPost"}}}, &r.Rule{Operator:r.Token, String:")"}, &r.Rule{Operator:r.Identifier, String:"Statement"}}}}}, &r.Rule{Operator:r.Production, String:"ForInit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({k:\"init\", t:pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ForVar"}, &r.Rule{Operator:r.Identifier, String:"ForExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"ForVar", Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"VarDeclCore"}}}, &r.Rule{Operator:r.Production, String:"ForExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(exprToClause(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}}}}}, &r.Rule{Operator:r.Production, String:"ForCond", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({k:\"cond\", t:pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}}}}}, &r.Rule{Operator:r.Production, String:"ForPost", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({k:\"post\", t:exprToClause(pop())}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}}}}}, &r.Rule{Operator:r.Production, String:"Return", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeReturn(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwReturn"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"Break", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeBreak()) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwBreak"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"Continue", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeContinue()) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwContinue"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"Throw", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeThrow(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwThrow"}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"TryStmt", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeTry(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwTry"}, &r.Rule{Operator:r.Identifier, String:"TryBody"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"CatchClause"}}}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"FinallyClause"}}}}}}}, &r.Rule{Operator:r.Production, String:"TryBody", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({trybody: pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"CatchClause", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeCatch(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwCatch"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Token, String:")"}}}, &r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"FinallyClause", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({finbody: pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwFinally"}, &r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"FuncDecl", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeFuncDecl(pop(), pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwFunction"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Identifier, String:"ParamList"}, &r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"ParamList", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(takeAll()) /* Collect the parameter names into one array. */ "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}}}}}, &r.Rule{Operator:r.Token, String:")"}}}}}, &r.Rule{Operator:r.Production, String:"Empty", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(function(b) { return b }) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}, &r.Rule{Operator:r.Production, String:"ExprStmt", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(exprToStmt(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:";"}}}}}}}, &r.Rule{Operator:r.Production, String:"Expression", Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}, &r.Rule{Operator:r.Production, String:"AssignExpr", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Assignment"}, &r.Rule{Operator:r.Identifier, String:"CondExpr"}}}}}, &r.Rule{Operator:r.Production, String:"Assignment", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeAssign(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Target"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"+="}, &r.Rule{Operator:r.Token, String:"-="}, &r.Rule{Operator:r.Token, String:"*="}, &r.Rule{Operator:r.Token, String:"/="}, &r.Rule{Operator:r.Token, String:"%="}, &r.Rule{Operator:r.Token, String:"="}}}}}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}, &r.Rule{Operator:r.Production, String:"Target", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeTargetRef(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"CallSuffix"}, &r.Rule{Operator:r.Identifier, String:"DotSuffix"}, &r.Rule{Operator:r.Identifier, String:"IndexSuffix"}}}}}}}}}, &r.Rule{Operator:r.Production, String:"CondExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeCond(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"OrExpr"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"?"}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}, &r.Rule{Operator:r.Token, String:":"}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"OrExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeOrAnd(takeAll(), true)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AndExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"||"}, &r.Rule{Operator:r.Identifier, String:"AndExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"AndExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeOrAnd(takeAll(), false)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"BitOrExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"&&"}, &r.Rule{Operator:r.Identifier, String:"BitOrExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"BitOrExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"BitXorExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(\"|\") "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"|"}}}, &r.Rule{Operator:r.Identifier, String:"BitXorExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"BitXorExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"BitAndExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(\"^\") "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"^"}}}, &r.Rule{Operator:r.Identifier, String:"BitAndExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"BitAndExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"EqExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(\"&\") "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"&"}}}, &r.Rule{Operator:r.Identifier, String:"EqExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"EqExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"RelExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"==="}, &r.Rule{Operator:r.Token, String:"!=="}, &r.Rule{Operator:r.Token, String:"=="}, &r.Rule{Operator:r.Token, String:"!="}}}}}, &r.Rule{Operator:r.Identifier, String:"RelExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"RelExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"ShiftExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"<="}, &r.Rule{Operator:r.Token, String:">="}, &r.Rule{Operator:r.Token, String:"<"}, &r.Rule{Operator:r.Token, String:">"}}}}}, &r.Rule{Operator:r.Identifier, String:"ShiftExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"ShiftExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AddExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"<<"}, &r.Rule{Operator:r.Token, String:">>>"}, &r.Rule{Operator:r.Token, String:">>"}}}}}, &r.Rule{Operator:r.Identifier, String:"AddExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"AddExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"MulExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"+"}, &r.Rule{Operator:r.Token, String:"-"}}}}}, &r.Rule{Operator:r.Identifier, String:"MulExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"MulExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldBinary(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"UnaryExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"*"}, &r.Rule{Operator:r.Token, String:"/"}, &r.Rule{Operator:r.Token, String:"%"}}}}}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}}}, &r.Rule{Operator:r.Production, String:"UnaryExpr", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"PreIncDec"}, &r.Rule{Operator:r.Identifier, String:"Neg"}, &r.Rule{Operator:r.Identifier, String:"Not"}, &r.Rule{Operator:r.Identifier, String:"BitNot"}, &r.Rule{Operator:r.Identifier, String:"Typeof"}, &r.Rule{Operator:r.Identifier, String:"PostfixExpr"}}}}}, &r.Rule{Operator:r.Production, String:"PreIncDec", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makePreIncDec(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"++"}, &r.Rule{Operator:r.Token, String:"--"}}}}}, &r.Rule{Operator:r.Identifier, String:"Target"}}}}}, &r.Rule{Operator:r.Production, String:"Neg", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeUnary(pop(), \"js_neg\")) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"-"}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}, &r.Rule{Operator:r.Production, String:"Not", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeUnary(pop(), \"js_not\")) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"!"}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}, &r.Rule{Operator:r.Production, String:"BitNot", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeBitNot(pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"~"}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}, &r.Rule{Operator:r.Production, String:"Typeof", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeUnary(pop(), \"js_typeof\")) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwTypeof"}, &r.Rule{Operator:r.Identifier, String:"UnaryExpr"}}}}}, &r.Rule{Operator:r.Production, String:"PostfixExpr", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"IncDec"}, &r.Rule{Operator:r.Identifier, String:"CallMember"}}}}}, &r.Rule{Operator:r.Production, String:"IncDec", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeIncDec(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Target"}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"++"}, &r.Rule{Operator:r.Token, String:"--"}}}}}}}}}, &r.Rule{Operator:r.Production, String:"CallMember", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(foldCallMember(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Primary"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"CallSuffix"}, &r.Rule{Operator:r.Identifier, String:"DotSuffix"}, &r.Rule{Operator:r.Identifier, String:"IndexSuffix"}}}}}}}}}, &r.Rule{Operator:r.Production, String:"CallSuffix", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({kind:\"call\", args: takeAll()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AssignExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}, &r.Rule{Operator:r.Token, String:")"}}}}}, &r.Rule{Operator:r.Production, String:"DotSuffix", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"."}, &r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({kind:\"member\", key: makeConst(up.in)}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}}}, &r.Rule{Operator:r.Production, String:"IndexSuffix", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push({kind:\"member\", key: pop()}) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"["}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:"]"}}}}}, &r.Rule{Operator:r.Production, String:"Primary", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Sequence, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"("}, &r.Rule{Operator:r.Identifier, String:"Expression"}, &r.Rule{Operator:r.Token, String:")"}}}, &r.Rule{Operator:r.Identifier, String:"FunctionExpr"}, &r.Rule{Operator:r.Identifier, String:"ObjectLit"}, &r.Rule{Operator:r.Identifier, String:"ArrayLit"}, &r.Rule{Operator:r.Identifier, String:"StringLit"}, &r.Rule{Operator:r.Identifier, String:"NumberLit"}, &r.Rule{Operator:r.Identifier, String:"True"}, &r.Rule{Operator:r.Identifier, String:"False"}, &r.Rule{Operator:r.Identifier, String:"Null"}, &r.Rule{Operator:r.Identifier, String:"Undefined"}, &r.Rule{Operator:r.Identifier, String:"VarRef"}}}}}, &r.Rule{Operator:r.Production, String:"FunctionExpr", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeFunctionExpr(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"KwFunction"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Identifier, String:"ParamList"}, &r.Rule{Operator:r.Identifier, String:"Block"}}}}}, &r.Rule{Operator:r.Production, String:"ObjectLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeObject(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"{"}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"PropDef"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Identifier, String:"PropDef"}}}}}, &r.Rule{Operator:r.Token, String:"}"}}}}}, &r.Rule{Operator:r.Production, String:"PropDef", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeProp(pop(), pop())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"PropKey"}, &r.Rule{Operator:r.Token, String:":"}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}, &r.Rule{Operator:r.Production, String:"PropKey", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(up.in) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}, &r.Rule{Operator:r.Identifier, String:"StringLit"}}}}}, &r.Rule{Operator:r.Production, String:"ArrayLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeArray(takeAll())) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"["}, &r.Rule{Operator:r.Optional, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"AssignExpr"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:","}, &r.Rule{Operator:r.Identifier, String:"AssignExpr"}}}}}, &r.Rule{Operator:r.Token, String:"]"}}}}}, &r.Rule{Operator:r.Production, String:"Null", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeHandleConst(1)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"null"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}}}, &r.Rule{Operator:r.Production, String:"Undefined", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeHandleConst(0)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"undefined"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}}}, &r.Rule{Operator:r.Production, String:"VarRef", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeVarRef(up.in)) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Id"}}}}}, &r.Rule{Operator:r.Production, String:"StringLit", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"DqString"}, &r.Rule{Operator:r.Identifier, String:"SqString"}}}}}, &r.Rule{Operator:r.Production, String:"NumberLit", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"HexLit"}, &r.Rule{Operator:r.Identifier, String:"DecLit"}}}}}, &r.Rule{Operator:r.Production, String:"HexLit", Childs:&r.Rules{&r.Rule{Operator:r.Tag, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:" push(makeConst(hexAt(up.in, 2, up.in.length - 2))) "}}, Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"0x"}, &r.Rule{Operator:r.Token, String:"0X"}}}, &r.Rule{Operator:r.Command, String:"whitespace"}, &r.Rule{Operator:r.Identifier, String:"HexDigit"}, &r.Rule{Operator:r.Repeat, Childs:&r.Rules{&r.Rule{Operator:r.Identifier, String:"HexDigit"}}}, &r.Rule{Operator:r.Command, String:"whitespace", CodeChilds:&r.Rules{&r.Rule{Operator:r.Identifier, String:"Whitespace"}}}}}}}, &r.Rule{Operator:r.Production, String:"HexDigit", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"0"}, &r.Rule{Operator:r.Token, String:"9"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"a"}, &r.Rule{Operator:r.Token, String:"f"}}}, &r.Rule{Operator:r.Range, Int:0, CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"A"}, &r.Rule{Operator:r.Token, String:"F"}}}}}}}, &r.Rule{Operator:r.Production, String:"KwImport", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"import"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwVar", Childs:&r.Rules{&r.Rule{Operator:r.Or, Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"var"}, &r.Rule{Operator:r.Token, String:"let"}, &r.Rule{Operator:r.Token, String:"const"}}}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwFunction", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"function"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwIf", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"if"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwElse", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"else"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwWhile", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"while"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwDo", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"do"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwFor", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"for"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwReturn", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"return"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwBreak", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"break"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwContinue", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"continue"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwThrow", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"throw"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwTry", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"try"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwCatch", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"catch"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwFinally", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"finally"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwTypeof", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"typeof"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwSwitch", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"switch"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwCase", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"case"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Production, String:"KwDefault", Childs:&r.Rules{&r.Rule{Operator:r.Token, String:"default"}, &r.Rule{Operator:r.Identifier, String:"KwEnd"}}}, &r.Rule{Operator:r.Command, String:"startScript", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"\n\n    // Shared emitter machinery (module, handle constants, externs, loopStack\n    // protocol, expression/statement builders); see the `core` knobs below.\n    include(\"lib/compile-core.js\")\n\n    // takeAll empties the local stack of the current tag and returns its items in push\n    // order as a plain JS array.\n    // Resolves the JS string escapes (\\n \\t \\r \\0 \\xNN \\uNNNN, and \\c for the char itself).\n    // ----- The emitter state -----\n\n    var i8 = llvm.types.I8\n\n\n    // The handle constants: 0 undefined, 1 null, 2 false, 3 true.\n\n    // All js_* externals get declared on first use. Every parameter and result is i64,\n    // except the string pool pointer of js_str_mem.\n    // One module global per distinct string literal / name.\n    // The function being built, the current scope chain handle (an SSA value), and the\n    // enclosing loops (for break/continue).\n\n    // An i1 for conditional branches: js_truthy(v) != 0.\n    // ----- Expression thunks: function(block) -> {b: endBlock, v: i64 handle} -----\n\n    function makeHandleConst(n) {\n        var c = handle(n)\n        return function(b) { return {b: b, v: c} }\n    }\n    function makeUnary(t, extName) {\n        return function(b) {\n            var r = t(b)\n            return {b: r.b, v: callExt(r.b, extName, [r.v])}\n        }\n    }\n    // ~v is v ^ -1 on the ToInt32 value, so it reuses the xor external.\n    function makeBitNot(t) {\n        return function(b) {\n            var r = t(b)\n            b = r.b\n            return {b: b, v: callExt(b, \"js_bxor\", [r.v, callExt(b, \"js_num_i\", [handle(-1)])])}\n        }\n    }\n\n    binExt = {\"+\": \"js_add\", \"-\": \"js_sub\", \"*\": \"js_mul\", \"/\": \"js_div\", \"%\": \"js_mod\",\n                  \"==\": \"js_eq\", \"!=\": \"js_ne\", \"===\": \"js_seq\", \"!==\": \"js_sne\",\n                  \"<\": \"js_lt\", \">\": \"js_gt\", \"<=\": \"js_le\", \">=\": \"js_ge\",\n                  \"|\": \"js_bor\", \"^\": \"js_bxor\", \"&\": \"js_band\",\n                  \"<<\": \"js_shl\", \">>\": \"js_shr\", \">>>\": \"js_ushr\",\n                  \"+=\": \"js_add\", \"-=\": \"js_sub\", \"*=\": \"js_mul\", \"/=\": \"js_div\", \"%=\": \"js_mod\"}\n    wraps = {} // MetaJS numbers are not wrapped to 32 bit.\n\n    // items = [thunk, op, thunk, op, thunk, ...] -> one left folded thunk.\n    // || and && evaluate lazily and keep the deciding operand, exactly like in JS.\n    // Each step branches: on a decided value the right side is skipped, a phi merges.\n    // items = [thunk] or [condThunk, thenThunk, elseThunk].\n    function makeCond(items) {\n        if (items.length == 1) return items[0]\n        return function(b) {\n            var r = items[0](b)\n            var thenB = curF.NewBlock(\"\")\n            var elseB = curF.NewBlock(\"\")\n            var mergeB = curF.NewBlock(\"\")\n            r.b.NewCondBr(truthy(r.b, r.v), thenB, elseB)\n            var rt = items[1](thenB)\n            rt.b.NewBr(mergeB)\n            var re = items[2](elseB)\n            re.b.NewBr(mergeB)\n            var phi = mergeB.NewPhi([llvm.ir.NewIncoming(rt.v, rt.b), llvm.ir.NewIncoming(re.v, re.b)])\n            return {b: mergeB, v: phi}\n        }\n    }\n\n    function makeArray(items) {\n        return function(b) {\n            var arr = callExt(b, \"js_arr_new\", [])\n            for (var i = 0; i < items.length; i++) {\n                var r = items[i](b)\n                b = r.b\n                callExt(b, \"js_arr_push\", [arr, r.v])\n            }\n            return {b: b, v: arr}\n        }\n    }\n    // PropDef pops [valueThunk, key]; the key is an Id string or a constant string thunk.\n    function makeProp(valT, key) {\n        return {kt: (typeof key == \"string\") ? makeConst(key) : key, t: valT}\n    }\n    function makeObject(props) {\n        return function(b) {\n            var obj = callExt(b, \"js_obj_new\", [])\n            for (var i = 0; i < props.length; i++) {\n                var kr = props[i].kt(b)\n                b = kr.b\n                var vr = props[i].t(b)\n                b = vr.b\n                callExt(b, \"js_set\", [obj, kr.v, vr.v])\n            }\n            return {b: b, v: obj}\n        }\n    }\n\n    // items = [primaryThunk, {kind:\"call\"|\"member\", ...}...]. A member access remembers\n    // its object handle, so that a directly following call uses it as 'this'.\n    foldCallMember = function(items) {\n        if (items.length == 1) return items[0]\n        var primary = items[0]\n        var suffixes = items.slice(1)\n        return function(b) {\n            var r = primary(b)\n            b = r.b\n            var cur = r.v\n            var curThis = hUndef\n            for (var i = 0; i < suffixes.length; i++) {\n                var s = suffixes[i]\n                if (s.kind == \"member\") {\n                    curThis = cur\n                    var kr = s.key(b)\n                    b = kr.b\n                    cur = callExt(b, \"js_get\", [cur, kr.v])\n                } else {\n                    var argsV = callExt(b, \"js_arr_new\", [])\n                    for (var j = 0; j < s.args.length; j++) {\n                        var ar = s.args[j](b)\n                        b = ar.b\n                        callExt(b, \"js_arr_push\", [argsV, ar.v])\n                    }\n                    cur = callExt(b, \"js_call\", [cur, curThis, argsV])\n                    curThis = hUndef\n                }\n            }\n            return {b: b, v: cur}\n        }\n    }\n\n    // Target items = [nameString, suffix marker...] -> reference descriptor.\n    // Walks a target path (members and calls) up to the last element, which must\n    // be a member. Returns {b, obj, key} with the object and the last key evaluated.\n    function emitRefPath(b, ref) {\n        var cur = callExt(b, \"js_scope_get\", [curScopeV, emitStr(b, ref.name)])\n        var curThis = hUndef\n        for (var i = 0; i < ref.path.length - 1; i++) {\n            var s = ref.path[i]\n            if (s.kind == \"member\") {\n                curThis = cur\n                var kr = s.key(b)\n                b = kr.b\n                cur = callExt(b, \"js_get\", [cur, kr.v])\n            } else {\n                var argsV = callExt(b, \"js_arr_new\", [])\n                for (var j = 0; j < s.args.length; j++) {\n                    var ar = s.args[j](b)\n                    b = ar.b\n                    callExt(b, \"js_arr_push\", [argsV, ar.v])\n                }\n                cur = callExt(b, \"js_call\", [cur, curThis, argsV])\n                curThis = hUndef\n            }\n        }\n        var last = ref.path[ref.path.length - 1].key(b)\n        return {b: last.b, obj: cur, key: last.v}\n    }\n    // items = [ref, opString, valueThunk]. The value of an assignment is the assigned value.\n    function makeAssign(items) {\n        var ref = items[0]\n        var op = items[1]\n        var valT = items[2]\n        return function(b) {\n            var r = valT(b)\n            b = r.b\n            var v = r.v\n            if (ref.path.length == 0) {\n                var nameV = emitStr(b, ref.name)\n                if (op != \"=\") {\n                    var old = callExt(b, \"js_scope_get\", [curScopeV, nameV])\n                    v = callExt(b, binExt[op], [old, v])\n                }\n                callExt(b, \"js_tset\", [curScopeV, nameV, v])\n            } else {\n                var p = emitRefPath(b, ref)\n                b = p.b\n                if (op != \"=\") {\n                    var oldM = callExt(b, \"js_get\", [p.obj, p.key])\n                    v = callExt(b, binExt[op], [oldM, v])\n                }\n                callExt(b, \"js_set\", [p.obj, p.key, v])\n            }\n            return {b: b, v: v}\n        }\n    }\n    // items = [ref, \"++\"|\"--\"]. Post increment: the expression value is the old (coerced) one.\n    function makeIncDec(items) {\n        var ref = items[0]\n        var extName = (items[1] == \"++\") ? \"js_add\" : \"js_sub\"\n        return function(b) {\n            var oneV = callExt(b, \"js_num_i\", [handle(1)])\n            if (ref.path.length == 0) {\n                var nameV = emitStr(b, ref.name)\n                var oldV = callExt(b, \"js_tonum\", [callExt(b, \"js_scope_get\", [curScopeV, nameV])])\n                callExt(b, \"js_tset\", [curScopeV, nameV, callExt(b, extName, [oldV, oneV])])\n                return {b: b, v: oldV}\n            }\n            var p = emitRefPath(b, ref)\n            b = p.b\n            var oldM = callExt(b, \"js_tonum\", [callExt(b, \"js_get\", [p.obj, p.key])])\n            callExt(b, \"js_set\", [p.obj, p.key, callExt(b, extName, [oldM, oneV])])\n            return {b: b, v: oldM}\n        }\n    }\n    // Prefix ++/--: like makeIncDec, but the expression value is the new one.\n    function makePreIncDec(ref, op) {\n        var extName = (op == \"++\") ? \"js_add\" : \"js_sub\"\n        return function(b) {\n            var oneV = callExt(b, \"js_num_i\", [handle(1)])\n            if (ref.path.length == 0) {\n                var nameV = emitStr(b, ref.name)\n                var oldV = callExt(b, \"js_tonum\", [callExt(b, \"js_scope_get\", [curScopeV, nameV])])\n                var newV = callExt(b, extName, [oldV, oneV])\n                callExt(b, \"js_tset\", [curScopeV, nameV, newV])\n                return {b: b, v: newV}\n            }\n            var p = emitRefPath(b, ref)\n            b = p.b\n            var oldM = callExt(b, \"js_tonum\", [callExt(b, \"js_get\", [p.obj, p.key])])\n            var newM = callExt(b, extName, [oldM, oneV])\n            callExt(b, \"js_set\", [p.obj, p.key, newM])\n            return {b: b, v: newM}\n        }\n    }\n\n    // ----- Primitives implemented in MetaJS (-rt-prims) -----\n    // Phase 1 of docs/runtime-rework-plan.md asks how small the C floor of the runtime\n    // really is. With -rt-prims this compiler compiles lib/rt-prims.metajs into the\n    // module it is building and routes every primitive DEFINED there to the compiled\n    // MetaJS body instead of declaring the Go external - so whatever the emitted module\n    // still `declare`s afterwards is the measured floor. Without the flag none of this\n    // runs and the output is byte for byte the old one.\n    var funcByIdx = {}   // \"$<jsf index>\" -> the IR function (registerPrim needs the callee)\n    var primShim = {}    // \"$js_ne\" -> the IR function the operator now calls\n    var inPrims = false  // True while lib/rt-prims.metajs is emitted (makeFuncDecl then\n                         // knows that each declaration it sees IS a primitive).\n\n    // The routing point: the same contract as compile-core's callExt, plus the lookup.\n    // It stays live while the primitives themselves are emitted, so a primitive can be\n    // written on top of the ones ABOVE it in lib/rt-prims.metajs (js_ne uses ==, which\n    // is js_eq, three lines up). It cannot accidentally recurse: registerPrim runs\n    // AFTER the body it registers, so a primitive using itself finds no shim yet and\n    // quietly falls back to the external - visible as a leftover `declare` in the\n    // emitted module, which is exactly the measurement.\n    callExt = function(b, name, args) {\n        noteExt(name)   // compile-core's block-scope elision counts declarations here.\n        var sh = primShim[\"$\" + name]\n        if (sh != undefined) { return b.NewCall(sh, args) }\n        return b.NewCall(getExtern(name, args.length), args)\n    }\n\n    // One shim per primitive: a function with the EXTERNAL's signature (i64 in, i64 out)\n    // that packs its arguments into a js array and calls the compiled MetaJS body as a\n    // direct IR call. Not through js_call: that is a floor primitive itself, and going\n    // through it would make every routed operator depend on the very machinery it is\n    // supposed to sit on top of. The environment is the undefined handle - the prims\n    // resolve no free name (see the header of lib/rt-prims.metajs).\n    function registerPrim(name, idx, arity) {\n        // The external is already declared: something emitted before this point called\n        // it - which for a primitive being defined here means its own body did (directly\n        // or through a cycle). The routing still works, but the primitive did NOT leave\n        // the floor: the module now carries both a declare and a define of the name.\n        // Say so, instead of letting the measurement quietly lie.\n        if (externs[name] != undefined) {\n            eprintln(\"warning: rt-prims: \" + name + \" is used by its own implementation - it stays a floor primitive\")\n        }\n        var params = []\n        for (var i = 0; i < arity; i++) { params.push(llvm.ir.NewParam(\"\", i64)) }\n        // The shim carries a PRIVATE symbol name, not the external's. Nothing looks\n        // it up by name - every routed call goes through primShim, which holds the IR\n        // function itself - so the name is free, and taking the external's name was a\n        // link-time collision waiting to happen: the C floor defines all thirteen of\n        // these, so `-rt-prims -exe` failed with \"13 symbol(s) are defined MORE THAN\n        // ONCE\" (js_eq, js_ge, js_gt, js_le, js_ne, js_neg, js_not, js_num_str,\n        // js_sne, js_sub, js_tonum, js_typeof, js_ushr) and the two flags could not be\n        // combined at all - open item 12 of docs/runtime-next-plan.md. It also\n        // collided with the module's OWN declare in the self-use case the warning\n        // above reports. The measurement is untouched: it counts what the module still\n        // `declare`s, and a shimmed name never reaches getExtern.\n        var sh = m.NewFunc(\"jsprim_\" + name, i64, params)\n        var b = sh.NewBlock(\"entry\")\n        var argsV = b.NewCall(getExtern(\"js_arr_new\", 0), [])\n        for (var i = 0; i < arity; i++) { b.NewCall(getExtern(\"js_arr_push\", 2), [argsV, sh.Params[i]]) }\n        b.NewRet(b.NewCall(funcByIdx[\"$\" + idx], [hUndef, argsV]))\n        primShim[\"$\" + name] = sh\n    }\n\n    // Compile lib/rt-prims.metajs and emit its top-level function declarations. The\n    // declaring statements land in jsrtprims, which is NEVER called: only the jsf_N\n    // bodies they create matter, and makeFuncDecl hands each one to registerPrim.\n    // load() reads relative to the grammar file under both engines. The c.parse guard\n    // keeps this out of the frozen TAG-script runtime, whose c carries only `tracing`\n    // (abnf/frozen.go, newWalkRuntime): tag scripts keep the Go floor, so the bootstrap\n    // does not pay for the measurement.\n    function emitPrims() {\n        if (c.rtPrims != true) { return false }\n        if (c.parse == undefined) { return false }\n        var src = load(\"lib/rt-prims.metajs\")\n        var asg = c.parse(c.agrammar, src, null, \"lib/rt-prims.metajs\")\n        c.pushSource(\"lib/rt-prims.metajs\", src)\n        importDepth = importDepth + 1 // Stash the top-level thunks; do not build a second jsrun.\n        c.compile(asg)\n        importDepth = importDepth - 1\n        c.popSource()\n        var g = importedGroups.pop()\n        var pf = m.NewFunc(\"jsrtprims\", i64, [llvm.ir.NewParam(\"env\", i64)])\n        curF = pf\n        var b = pf.NewBlock(\"entry\")\n        curScopeV = pf.Params[0]\n        inPrims = true\n        c.pushSourceFile(g.file)\n        for (var i = 0; i < g.items.length; i++) { b = g.items[i](b) }\n        c.popSource()\n        inPrims = false\n        b.NewRet(hUndef)\n        return true\n    }\n\n    // A function body: an own IR function jsf_N(env, args) whose entry opens a scope on\n    // the passed environment, binds the parameters and 'arguments', and runs the body.\n    // isCtl marks a try/catch body closure: a return/break/continue leaving it emits a\n    // control signal instead of a ret/br (see compile-core inCtlBody / excDispatch).\n    function emitFunction(paramNames, bodyT, isCtl) {\n        funcCount++\n        var idx = funcCount\n        var f = m.NewFunc(\"jsf_\" + idx, i64, [llvm.ir.NewParam(\"env\", i64), llvm.ir.NewParam(\"args\", i64)])\n        funcByIdx[\"$\" + idx] = f // -rt-prims: registerPrim needs the callee, not just its index.\n\n        var savedF = curF\n        var savedScope = curScopeV\n        var savedLoops = loopStack\n        var savedTag = curFTag\n        // A nested function's declarations land in ITS frame, so they must not make the\n        // block that contains the function look like a block that declares (compile-core\n        // makeBlockStmt / declCount).\n        var savedDecl = declCount\n        curF = f\n        curFTag = idx\n        loopStack = []\n        if (isCtl) { ctlEnter(idx) }\n\n        var b = f.NewBlock(\"entry\")\n        curScopeV = callExt(b, \"js_scope_new\", [f.Params[0]])\n        for (var i = 0; i < paramNames.length; i++) {\n            callExt(b, \"js_tdecl\", [curScopeV, emitStr(b, paramNames[i]),\n                                    callExt(b, \"js_arg\", [f.Params[1], handle(i)])])\n        }\n        callExt(b, \"js_tdecl\", [curScopeV, emitStr(b, \"arguments\"), f.Params[1]])\n        var endB = bodyT(b)\n        endB.NewRet(hUndef) // A function without return returns undefined.\n\n        if (isCtl) { ctlLeave() }\n        curF = savedF\n        curScopeV = savedScope\n        loopStack = savedLoops\n        curFTag = savedTag\n        declCount = savedDecl\n        return idx\n    }\n    function makeFunctionExpr(bodyT, paramNames) {\n        return function(b) {\n            var idx = emitFunction(paramNames, bodyT)\n            return {b: b, v: callExt(b, \"js_closure\", [handle(idx), curScopeV])}\n        }\n    }\n\n    // ----- Statement thunks: function(block) -> block to continue in -----\n\n    // An expression in statement position: evaluate the value and record it as the\n    // program completion value (what a goja Run() would return; js_getret reads it).\n    exprToStmt = function(t) {\n        return function(b) {\n            var r = t(b)\n            callExt(r.b, \"js_setret\", [r.v])\n            return r.b\n        }\n    }\n    // For loop init/post clauses: evaluate and drop (they are no statements, so\n    // they must not touch the completion value).\n    function exprToClause(t) {\n        return function(b) { return t(b).b }\n    }\n    // items = [name] or [name, initThunk].\n    function makeDecl(items) {\n        var name = items[0]\n        return function(b) {\n            var v = hUndef\n            if (items.length > 1) {\n                var r = items[1](b)\n                b = r.b\n                v = r.v\n            }\n            callExt(b, \"js_tdecl\", [curScopeV, emitStr(b, name), v])\n            return b\n        }\n    }\n    // items = [cond, then] or [cond, then, else].\n    // Note: the childs lie on the stack in source order, so pop() delivers them reversed.\n    function makeDo(condT, bodyT) {\n        return function(b) {\n            var bodyB = curF.NewBlock(\"\")\n            var condB = curF.NewBlock(\"\")\n            var exitB = curF.NewBlock(\"\")\n            b.NewBr(bodyB)\n            loopStack.push({cont: condB, brk: exitB})\n            bodyT(bodyB).NewBr(condB)\n            loopStack.pop()\n            var r = condT(condB)\n            r.b.NewCondBr(truthy(r.b, r.v), bodyB, exitB)\n            return exitB\n        }\n    }\n    // items = [{k:\"init\"|\"cond\"|\"post\", t:thunk}..., bodyThunk].\n    function makeFor(items) {\n        var bodyT = items.pop()\n        var init = null, cond = null, post = null\n        for (var i = 0; i < items.length; i++) {\n            if (items[i].k == \"init\") init = items[i].t\n            if (items[i].k == \"cond\") cond = items[i].t\n            if (items[i].k == \"post\") post = items[i].t\n        }\n        return function(b) {\n            var saved = curScopeV\n            curScopeV = callExt(b, \"js_scope_new\", [curScopeV]) // The for header is its own scope.\n            if (init != null) b = init(b)\n            var headB = curF.NewBlock(\"\")\n            var bodyB = curF.NewBlock(\"\")\n            var postB = curF.NewBlock(\"\")\n            var exitB = curF.NewBlock(\"\")\n            b.NewBr(headB)\n            if (cond != null) {\n                var r = cond(headB)\n                r.b.NewCondBr(truthy(r.b, r.v), bodyB, exitB)\n            } else {\n                headB.NewBr(bodyB)\n            }\n            loopStack.push({cont: postB, brk: exitB})\n            bodyT(bodyB).NewBr(postB)\n            loopStack.pop()\n            var pb = postB\n            if (post != null) pb = post(postB)\n            pb.NewBr(headB)\n            curScopeV = saved\n            return exitB\n        }\n    }\n    // items = [] or [exprThunk]. retStmt (compile-core) emits a plain ret, or a control\n    // signal when this return leaves a try body. Code behind it is unreachable but\n    // still lands in a valid (dead) block.\n    function makeReturn(items) {\n        var t = items.length > 0 ? items[0] : null\n        return function(b) {\n            var v = hUndef\n            if (t != null) {\n                var r = t(b)\n                b = r.b\n                v = r.v\n            }\n            return retStmt(b, v)\n        }\n    }\n    function makeThrow(t) {\n        return function(b) {\n            var r = t(b)\n            callExt(r.b, \"js_throw\", [r.v])\n            r.b.NewRet(hUndef) // Never reached: js_throw unwinds on the host side.\n            return deadBlock()\n        }\n    }\n    // makeCatch is shared - see lib/compile-core.js.\n    // items = [{trybody}, {catchbody,catchname}?, {finbody}?]. Each body becomes its\n    // own IR closure over the current scope; js_try (jsrt.go) runs the try under a Go\n    // recover, hands a thrown value to the catch closure (a one-parameter function\n    // bound to the catch name) and always runs the finally closure. The try and catch\n    // bodies are ctl closures, so a return/break/continue leaving them becomes a control\n    // signal that excDispatch re-issues here. The finally body is a ctl closure too:\n    // its signal overrides the try/catch completion inside js_try (and cancels a\n    // pending rethrow), like in JS.\n    function makeTry(items) {\n        var tryT = anytype, catchT = anytype, catchName = anytype, finallyT = anytype\n        for (var i = 0; i < items.length; i++) {\n            if (items[i].trybody != undefined) { tryT = items[i].trybody }\n            else if (items[i].catchbody != undefined) { catchT = items[i].catchbody; catchName = items[i].catchname }\n            else if (items[i].finbody != undefined) { finallyT = items[i].finbody }\n        }\n        return function(b) {\n            var tryClo = callExt(b, \"js_closure\", [handle(emitFunction([], tryT, true)), curScopeV])\n            var catchClo = hUndef\n            if (catchT != undefined) {\n                var cn = (catchName != undefined) ? catchName : \"__caught\"\n                catchClo = callExt(b, \"js_closure\", [handle(emitFunction([cn], catchT, true)), curScopeV])\n            }\n            var finClo = hUndef\n            if (finallyT != undefined) {\n                finClo = callExt(b, \"js_closure\", [handle(emitFunction([], finallyT, true)), curScopeV])\n            }\n            var ctl = callExt(b, \"js_try\", [tryClo, catchClo, finClo])\n            return excDispatch(b, ctl)\n        }\n    }\n    // items = [subjThunk, ({casev}|{isdflt}|stmtThunk)...]. The flat label/statement\n    // list is grouped at build time. The dispatch chain compares with js_seq (===);\n    // the case bodies fall through into each other, break jumps to the exit, and\n    // continue still targets the enclosing loop.\n    function makeSwitch(items) {\n        var subj = items[0]\n        var cases = []\n        var cur = null\n        for (var i = 1; i < items.length; i++) {\n            var p = items[i]\n            if (p != undefined && (p.casev != undefined || p.isdflt != undefined)) {\n                cur = {isDefault: p.isdflt != undefined, v: p.casev, body: []}\n                cases.push(cur)\n            } else {\n                if (cur == null) {\n                    println(\"js compiler error: switch: a statement before the first case label\")\n                    exit(1)\n                }\n                cur.body.push(p)\n            }\n        }\n        return function(b) {\n            var r = subj(b)\n            b = r.b\n            var exitB = curF.NewBlock(\"\")\n            var bodyBs = []\n            var dfltB = exitB\n            for (var i = 0; i < cases.length; i++) {\n                bodyBs.push(curF.NewBlock(\"\"))\n                if (cases[i].isDefault && dfltB === exitB) { dfltB = bodyBs[i] }\n            }\n            for (var i = 0; i < cases.length; i++) {\n                if (cases[i].isDefault) { continue }\n                var rc = cases[i].v(b)\n                b = rc.b\n                var nextB = curF.NewBlock(\"\")\n                b.NewCondBr(truthy(b, callExt(b, \"js_seq\", [r.v, rc.v])), bodyBs[i], nextB)\n                b = nextB\n            }\n            b.NewBr(dfltB)\n            var outerCont = loopStack.length > 0 ? loopStack[loopStack.length - 1].cont : null\n            loopStack.push({cont: outerCont, brk: exitB})\n            for (var i = 0; i < cases.length; i++) {\n                var bb = bodyBs[i]\n                var body = cases[i].body\n                for (var j = 0; j < body.length; j++) { bb = body[j](bb) }\n                bb.NewBr(i + 1 < cases.length ? bodyBs[i + 1] : exitB)\n            }\n            loopStack.pop()\n            return exitB\n        }\n    }\n    // Local stack = [name, [paramNames...], bodyThunk] -- declares the closure when executed.\n    function makeFuncDecl(bodyT, paramNames, name) {\n        return function(b) {\n            var idx = emitFunction(paramNames, bodyT)\n            // Inside lib/rt-prims.metajs every declaration IS a primitive: wire the\n            // operator that used to call the external to this body (-rt-prims).\n            if (inPrims) { registerPrim(name, idx, paramNames.length) }\n            var cl = callExt(b, \"js_closure\", [handle(idx), curScopeV])\n            callExt(b, \"js_tdecl\", [curScopeV, emitStr(b, name), cl])\n            return b\n        }\n    }\n\n    // The top level statements become jsrun(scope, args): the caller provides the scope\n    // that the top level declarations land in (the frozen tag executor passes the shared\n    // scope of the compile run, so scripts see each others globals). The return value is\n    // the completion value: what the last executed expression statement produced.\n    // jsmain(env, args) is the standalone entry on top of it: it makes a fresh scope,\n    // runs the program, and then calls main() - the self checking test convention.\n    // ----- Project-file imports (see the ImportStmt rule) -----\n    // compile-core's resolveImport calls fail() on an unresolved import; add a local one.\n    function fail(msg) { println(\"metajs compiler error: \" + msg); exit(1) }\n    function metajsImport(items, pos) {\n        resolveImport(items[items.length - 1], pos)\n        return function(b) { return b }\n    }\n    // MetaJS has no importable stdlib modules, so every import path is a project file.\n    core.stdlibImports = []\n    // An imported file is parsed with this grammar and walked with importDepth > 0, so its\n    // buildMain stashes its top-level thunks into importedItems; the real buildMain prepends\n    // them to jsrun. Imported once; a leading './' is dropped and an extension supplied\n    // before the -i-root search. Declared before buildMain so the vars exist when\n    // the freezer self-compiles the Program tag. importedList is the same set in IMPORT\n    // ORDER, which -rt-lib needs to scan for its exported surface (see there).\n    var importedFiles = {}\n    var importedList = []\n    var importDepth = 0\n    // imported files top-level items: stashImported / emitImported (compile-core)\n    core.importFile = function(path, pos) {\n        var rel = path\n        if (rel.length >= 2 && rel.charAt(0) == \".\" && rel.charAt(1) == \"/\") { rel = rel.substring(2) }\n        // \".js\" is appended only when the path has NO EXTENSION AT ALL. It used to be\n        // appended whenever the path did not already END in \".js\", which meant\n        // `import \"./runtime.metajs\"` searched for `runtime.metajs.js` and failed with\n        // `unresolved import` - the reason the shared layer-2 runtime could not be given\n        // the name docs/runtime-merge-plan.md gives it. `import \"./mod\"` is unchanged, and\n        // so is every path that already carries one. The scan is by hand and backwards to\n        // the first '.' or '/': the frozen subset has no lastIndexOf, its indexOf ignores a\n        // from-index, and the tag script uses no `break` - so the loop ends by driving the\n        // index negative.\n        var hasExt = false\n        var k = rel.length - 1\n        while (k >= 0) {\n            var kc = rel.charAt(k)\n            if (kc == \"/\") { k = 0 - 1 } else {\n                if (kc == \".\") {\n                    hasExt = true\n                    k = 0 - 1\n                } else { k = k - 1 }\n            }\n        }\n        if (!hasExt) { rel = rel + \".js\" }\n        var file = c.findImport(rel)\n        if (file == \"\") { return false }\n        if (importedFiles[\"$\" + file] == true) { return true }\n        importedFiles[\"$\" + file] = true\n        importedList.push(file)\n        var text = c.readFile(file)\n        var asg = c.parse(c.agrammar, text, null, file)\n        c.pushSource(file, text)\n        importDepth = importDepth + 1\n        c.compile(asg)\n        importDepth = importDepth - 1\n        c.popSource()\n        return true\n    }\n\n    function buildMain(items) {\n        // The walk of an imported file ends too (importDepth > 0): stash its top-level\n        // statement thunks for the real jsrun instead of emitting a second one.\n        if (importDepth > 0) {\n            stashImported(items) // stashed with its file; emitted later (compile-core)\n            return\n        }\n        // The MetaJS-implemented primitives go in FIRST: their shims must exist before\n        // any operator of the program is emitted (-rt-prims; a no-op without it).\n        emitPrims()\n        var f = m.NewFunc(\"jsrun\", i64, [llvm.ir.NewParam(\"scope\", i64), llvm.ir.NewParam(\"args\", i64)])\n        curF = f\n        var b = f.NewBlock(\"entry\")\n        curScopeV = f.Params[0]\n        callExt(b, \"js_setret\", [hUndef]) // A program without expression statements completes with undefined.\n        // The imported files' top level goes FIRST. Flipping it to APPEND was measured\n        // and is a LOSS - see the note at the ImportStmt rule.\n        b = emitImported(b)\n        b = makeSeq(items)(b)\n        b.NewRet(callExt(b, \"js_getret\", []))\n\n        var fm = m.NewFunc(\"jsmain\", i64, [llvm.ir.NewParam(\"env\", i64), llvm.ir.NewParam(\"args\", i64)])\n        curF = fm\n        var bm = fm.NewBlock(\"entry\")\n        var sc = callExt(bm, \"js_scope_new\", [fm.Params[0]])\n        bm.NewCall(f, [sc, fm.Params[1]])\n        // The entry point defaults to main() but -main (c.mainName) can name another.\n        var entry = c.mainName\n        if (entry == undefined || entry == \"\") { entry = \"main\" }\n        if (c.repl) {\n            // -repl: hand the top level over for the lines typed in (lib/compile-core.js).\n            curScopeV = sc\n            emitReplScope(bm)\n            bm.NewRet(hUndef)\n        } else if (mainIsSnippet(entry)) {\n            curScopeV = sc // The snippet resolves names in the populated program scope.\n            bm = emitMainSnippet(bm, entry, \"Statement\")\n            bm.NewRet(emitNum(bm, 0))\n        } else {\n            var mainV = callExt(bm, \"js_scope_get\", [sc, emitStr(bm, entry)])\n            var argsV = callExt(bm, \"js_arr_new\", [])\n            bm.NewRet(callExt(bm, \"js_call\", [mainV, hUndef, argsV]))\n        }\n    }\n\n    // ===== goja driver =====\n    // Everything below this marker is the driver for the normal (goja) run of this\n    // grammar. The freezer (-freeze) cuts the start script here: only the library above\n    // goes into the bootstrap snapshot; in frozen mode the Go core replaces the driver.\n\n    // ----- layer 2: compile this file as a linkable runtime LIBRARY (-rt-lib) -----\n    // docs/runtime-rework-plan.md phase 4. A target language's compiler emits calls to\n    // js_* externs that are NOT the 48 generic MetaJS ones - js_luarith, js_lueq,\n    // js_lustr and so on. Those are the language's own semantics, they are written in\n    // MetaJS (languages/lib/<lang>-rt.metajs), and -rt-lib compiles such a file into a\n    // module that can be LINKED NEXT TO the program module instead of run.\n    //\n    // Three things separate the two modules, and all three are decided here, before\n    // c.compile, because they are just the counters compile-core names things with:\n    //\n    //   - jsf_N and str.N are OFFSET by a million, so no emitted name of the library\n    //     can collide with one of the program it is linked against. A program with a\n    //     million functions or string literals would collide; nothing here is close.\n    //   - the library's own jsmain/jsrun are RENAMED below (the program defines\n    //     jsmain, and runtime.c's main() calls it).\n    //   - the library's function table is jsdispatch_ext, the tail the PROGRAM's\n    //     jsdispatch falls through to. js_closure stores a raw index and js_call\n    //     resolves it through the one global jsdispatch; chaining is what lets two\n    //     separately compiled modules share that one entry point.\n    var rtLib = (c.rtLib == true)\n    if (rtLib) {\n        funcCount = 1000000\n        strCount = 1000000\n        numCount = 1000000   // jsnum./jsnumg. are module-level symbols too (compile-core emitNum).\n    }\n\n    // Build the module out of the parsed program.\n    c.compile(c.asg)\n\n    if (rtLib) {\n        // The exported surface is every TOP-LEVEL `function js_*` of the source. It is\n        // read off the source text rather than off the module because the module keeps\n        // only jsf_N: a MetaJS function is a value in a scope, and its name lives in the\n        // scope, not in the IR. A line starting in column 0 with `function js_` is a\n        // top-level declaration in a file the frozen subset already forbids ASI in.\n        //\n        // EVERY IMPORTED FILE IS SCANNED TOO, and that is not a convenience. Layer 2\n        // shares its common externs through lib/runtime.metajs\n        // (docs/runtime-merge-plan.md part A), and while only c.file was scanned a\n        // `function js_jadd` written THERE compiled, ran CORRECTLY under llvm.Run, and\n        // was UNDEFINED AT LINK TIME:\n        //     error: 1 unresolved symbol(s), and this build links a runtime ... js_jadd\n        // ./test.sh and --cross are both blind to that - neither builds an -exe - so\n        // tests/clang-check.sh was the only gate that reported it, and it reported it\n        // nine times at once. Concatenating the sources is enough because the scan is\n        // purely lexical and column-0 anchored; the imported files are appended after\n        // c.file so a name declared in both exports from the main file's spelling.\n        var libSrc = c.readFile(c.file)\n        var xi = 0\n        while (xi < importedList.length) {\n            libSrc = libSrc + \"\\n\" + c.readFile(importedList[xi])\n            xi = xi + 1\n        }\n        var seenExport = {}\n        var exports = []\n        var li = 0\n        var line = \"\"\n        while (li <= libSrc.length) {\n            var ch = li < libSrc.length ? libSrc.charAt(li) : \"\\n\"\n            if (ch == \"\\n\") {\n                if (line.length > 12 && line.substring(0, 12) == \"function js_\") {\n                    var op = line.indexOf(\"(\")\n                    var cp = line.indexOf(\")\")\n                    var nm = line.substring(9, op)\n                    var ps = line.substring(op + 1, cp)\n                    // The parameter names, split by hand (the frozen subset has no\n                    // split). A name ending in _raw marks a RAW parameter: see below.\n                    var pnames = []\n                    var cur = \"\"\n                    var pi = 0\n                    while (pi <= ps.length) {\n                        var pc = pi < ps.length ? ps.charAt(pi) : \",\"\n                        if (pc == \",\") {\n                            if (cur.length > 0) { pnames.push(cur) }\n                            cur = \"\"\n                        } else if (pc != \" \" && pc != \"\\t\") { cur = cur + pc }\n                        pi = pi + 1\n                    }\n                    // A RAW RETURN. The mirror image of the _raw parameter below,\n                    // and the trap the PHP port found that the Lua pilot did not:\n                    // not every extern ANSWERS a value handle either. compile-core's\n                    // truthy() emits `icmp ne <call>, 0` straight on the result of\n                    // core.truthyExt, so js_truthy - and every language's own spelling\n                    // of it, php's js_phtruthy among them - answers the raw integer 1\n                    // or 0. A shim that handed back the HANDLE of a MetaJS boolean\n                    // would answer 3 for true and 2 for FALSE, and 2 != 0, so every\n                    // condition in the program would be taken. A top-level function\n                    // whose name ends in __raw is exported under the name WITHOUT that\n                    // suffix and its result is put through the floor's own js_truthy,\n                    // which is exactly the raw 1/0 the caller is comparing against.\n                    var rawRet = false\n                    var sym = nm\n                    if (nm.length > 5 && nm.substring(nm.length - 5, nm.length) == \"__raw\") {\n                        rawRet = true\n                        sym = nm.substring(0, nm.length - 5)\n                    }\n                    // One wrapper per SYMBOL. A name declared in both the main file\n                    // and an imported one would otherwise emit two definitions of the\n                    // same external and the link would fail on a duplicate symbol -\n                    // the mirror of the bug this scan was widened to fix.\n                    if (seenExport[\"$\" + sym] != true) {\n                        seenExport[\"$\" + sym] = true\n                        exports.push({n: sym, s: nm, p: pnames, r: rawRet})\n                    }\n                }\n                line = \"\"\n            } else { line = line + ch }\n            li = li + 1\n        }\n        if (exports.length == 0) {\n            eprintln(\"error: -rt-lib: no top-level 'function js_*' to export\")\n            exit(1)\n        }\n\n        // jsmain is the program's entry point and jsrun is where its top level lives;\n        // both names are taken. Rename them: jsrtlib_run is called by the boot function\n        // below, and the library's jsmain (which would look up a main() that does not\n        // exist here) is renamed out of the way and never called.\n        var runF = undefined\n        var fi = 0\n        while (fi < m.Funcs.length) {\n            var fn = m.Funcs[fi]\n            if (fn.Name() == \"jsrun\") {\n                fn.GlobalName = \"jsrtlib_run\"\n                runF = fn\n            }\n            if (fn.Name() == \"jsmain\") { fn.GlobalName = \"jsrtlib_unused_main\" }\n            fi = fi + 1\n        }\n\n        // One global cell holding the library's own scope, and a boot function that\n        // fills it on first use. Lazy, so the library needs no hook in the program's\n        // startup path: whichever exported extern the program calls first boots it.\n        var envG = m.NewGlobalDef(\"jsrtlib_env\", llvm.constant.NewInt(i64, 0))\n        var bootF = m.NewFunc(\"jsrtlib_boot\", i64, [])\n        var bb0 = bootF.NewBlock(\"entry\")\n        var doB = bootF.NewBlock(\"boot\")\n        var skB = bootF.NewBlock(\"done\")\n        bb0.NewCondBr(bb0.NewICmp(llvm.enum.IPredEQ, bb0.NewLoad(i64, envG), llvm.constant.NewInt(i64, 0)), doB, skB)\n        // Pinned: the library's scope lives in a module global for the whole run, which\n        // is not a place lib/runtime.c's collector can find it (see js_gc_pin there).\n        var scV = callExt(doB, \"js_gc_pin\", [callExt(doB, \"js_scope_new\", [handle(0)])])\n        doB.NewStore(scV, envG)\n        doB.NewCall(runF, [scV, callExt(doB, \"js_arr_new\", [])])\n        doB.NewBr(skB)\n        skB.NewRet(handle(0))\n\n        // One exported shim per function, with the EXTERNAL's signature (i64 in, i64\n        // out). It boots, looks the name up in the library scope and calls it through\n        // js_call - the same path any MetaJS call takes, so a library function is\n        // reached exactly as it would be from MetaJS source.\n        var ei = 0\n        while (ei < exports.length) {\n            var ex = exports[ei]\n            var params = []\n            var pj = 0\n            while (pj < ex.p.length) {\n                params.push(llvm.ir.NewParam(\"\", i64))\n                pj = pj + 1\n            }\n            var sf = m.NewFunc(ex.n, i64, params)\n            // The CALLEE is cached in a global of its own. Without it every call of\n            // the extern walks the library scope by name (a linear compare over every\n            // function in the file), which is the single most expensive thing an\n            // exported shim can do: the callee never changes after boot.\n            var fG = m.NewGlobalDef(\"jsrtlib_f_\" + ex.n, llvm.constant.NewInt(i64, 0))\n            var sb = sf.NewBlock(\"entry\")\n            var lkB = sf.NewBlock(\"lookup\")\n            var goB = sf.NewBlock(\"go\")\n            sb.NewCondBr(sb.NewICmp(llvm.enum.IPredEQ, sb.NewLoad(i64, fG), llvm.constant.NewInt(i64, 0)), lkB, goB)\n            lkB.NewCall(bootF, [])\n            // Pinned for the same reason as jsrtlib_env: the resolved closure is cached\n            // in a module global and is otherwise invisible to the collector.\n            lkB.NewStore(callExt(lkB, \"js_gc_pin\",\n                [callExt(lkB, \"js_scope_get\", [lkB.NewLoad(i64, envG), emitStr(lkB, ex.s)])]), fG)\n            lkB.NewBr(goB)\n            sb = goB\n            var fV = sb.NewLoad(i64, fG)\n            var aV = callExt(sb, \"js_arr_new\", [])\n            pj = 0\n            while (pj < ex.p.length) {\n                // A RAW parameter. Not every argument of an extern is a value handle:\n                // the operator INDEX of js_luarith / js_lucmp / js_lubit (and the same\n                // trick in other language emitters) is a compile-time constant the\n                // grammar writes with handle(k), so the callee gets the small integer\n                // ITSELF, not a handle to it - and 0..3 happen to be the handles of\n                // undefined, null, false and true, which is what a MetaJS body would\n                // see instead. A parameter whose name ends in _raw is therefore boxed\n                // with js_num_i on the way in, so the MetaJS side reads a number.\n                var pv = sf.Params[pj]\n                var pn = ex.p[pj]\n                if (pn.length > 4 && pn.substring(pn.length - 4, pn.length) == \"_raw\") {\n                    pv = callExt(sb, \"js_num_i\", [pv])\n                }\n                callExt(sb, \"js_arr_push\", [aV, pv])\n                pj = pj + 1\n            }\n            var rv = callExt(sb, \"js_call\", [fV, hUndef, aV])\n            if (ex.r) { rv = callExt(sb, \"js_truthy\", [rv]) }\n            sb.NewRet(rv)\n            ei = ei + 1\n        }\n    }\n\n    // emitDispatch adds the FUNCTION TABLE a native build needs. js_closure stores a\n    // raw function INDEX (see the js_closure extern), and under llvm.Run the Go runtime\n    // turns that index back into a callee by looking \"jsf_<idx>\" up in the module it is\n    // attached to. A linked binary has no such reflection, so the module has to carry\n    // the mapping itself: jsdispatch(idx, env, args) compares idx against every emitted\n    // jsf_N and calls it directly. It is emitted ONLY for -exe (and for -rt-lib, which\n    // names it jsdispatch_ext - see there), so every other run of this grammar keeps the\n    // module it always had, byte for byte.\n    //\n    // chainExt asks for the SECOND HALF of the table, and it is what gave MetaJS a\n    // layer 2 (lib/metajs-rt.ll, see libPath below). The library module's own function\n    // indices are offset by a million, so an index >= 1000000 belongs to it and nothing\n    // in the program can collide: the miss arm - and the >= test that short-circuits it -\n    // calls jsdispatch_ext, which the library defines. This is js-to-llvm-ir.abnf's\n    // emitDispatch, unchanged; the mechanism is the reusable part of phase 4 and nothing\n    // in it is any one language's.\n    //\n    // It is asked for ONLY when the default runtime list is linked. With an explicit\n    // -rt (tests/metajs-link-stubrt.c) there IS no layer-2 module, so declaring an\n    // uncallable jsdispatch_ext would either fail the link or - worse - resolve to\n    // nothing; that build keeps the single-table module it always had, byte for byte,\n    // and so do -rt-lib and every non-native run.\n    //\n    // The ext declaration is carried in a ONE-ELEMENT ARRAY rather than in a local that\n    // starts undefined and is reassigned: MetaJS is typed and a local keeps its first\n    // type, which under -frozen turns such a rewrite into a hard error while goja stays\n    // green (docs/abnf-dialect-gotchas.md).\n    function emitDispatch(dname, chainExt) {\n        var idxs = []\n        var fns = []\n        var i = 0\n        while (i < m.Funcs.length) {\n            var f = m.Funcs[i]\n            var nm = f.Name()\n            if (nm.length > 4 && nm.substring(0, 4) == \"jsf_\") {\n                idxs.push(parseInt(nm.substring(4, nm.length)))\n                fns.push(f)\n            }\n            i = i + 1\n        }\n        var exts = []\n        if (chainExt) {\n            exts.push(m.NewFunc(\"jsdispatch_ext\", i64,\n                [llvm.ir.NewParam(\"idx\", i64), llvm.ir.NewParam(\"env\", i64), llvm.ir.NewParam(\"args\", i64)]))\n        }\n        var d = m.NewFunc(dname, i64,\n            [llvm.ir.NewParam(\"idx\", i64), llvm.ir.NewParam(\"env\", i64), llvm.ir.NewParam(\"args\", i64)])\n        var b = d.NewBlock(\"entry\")\n        if (exts.length > 0) {\n            var extB = d.NewBlock(\"ext\")\n            var ownB = d.NewBlock(\"own\")\n            b.NewCondBr(b.NewICmp(llvm.enum.IPredSGE, d.Params[0], llvm.constant.NewInt(i64, 1000000)), extB, ownB)\n            extB.NewRet(extB.NewCall(exts[0], [d.Params[0], d.Params[1], d.Params[2]]))\n            b = ownB\n        }\n        i = 0\n        while (i < fns.length) {\n            var hit = d.NewBlock(\"hit\" + idxs[i])\n            var nxt = d.NewBlock(\"miss\" + idxs[i])\n            b.NewCondBr(b.NewICmp(llvm.enum.IPredEQ, d.Params[0], llvm.constant.NewInt(i64, idxs[i])), hit, nxt)\n            hit.NewRet(hit.NewCall(fns[i], [d.Params[1], d.Params[2]]))\n            b = nxt\n            i = i + 1\n        }\n        if (exts.length > 0) {\n            b.NewRet(b.NewCall(exts[0], [d.Params[0], d.Params[1], d.Params[2]]))\n        } else {\n            b.NewRet(llvm.constant.NewInt(i64, 0))\n        }\n    }\n\n    // A runtime library is not run and not linked here: it is PRINTED, and the printed\n    // module is what the language grammar hands to clang next to lib/runtime.ll.\n    if (rtLib) {\n        emitDispatch(\"jsdispatch_ext\", false)\n        println(m)\n        exit(0)\n    }\n\n    // libPath locates a runtime input next to THIS grammar, so the build does not\n    // depend on the working directory the metacompiler was started in. It used to be\n    // runtimePath(), hard-wired to \"lib/runtime.ll\", because MetaJS linked the C floor\n    // and nothing else; it is the same function every other language grammar has.\n    function libPath(name) {\n        var mn = moduleName()\n        var cut = -1\n        var i = 0\n        while (i < mn.length) {\n            var ch = mn.charAt(i)\n            if (ch == \"/\" || ch == \"\\\\\") { cut = i }\n            i = i + 1\n        }\n        return mn.substring(0, cut + 1) + \"lib/\" + name\n    }\n\n    // With -exe PATH, link the module into a native executable (clang) instead of running\n    // it here. This module is HANDLE IR: every value is an i64 handle and the js_* externs\n    // it declares are the runtime, so the build only produces a working binary when a\n    // runtime that defines them is linked in. That runtime is lib/runtime.ll - the C floor\n    // of docs/runtime-rework-plan.md phase 3, compiled out of lib/runtime.c by\n    // c-to-llvm-ir.abnf (regenerate with tests/gen-runtime-ll.sh). An explicit -rt\n    // REPLACES it rather than adding to it, which is what lets tests/metajs-link-stubrt.c\n    // still stand in for the whole runtime in the link tests. Because a runtime is\n    // declared either way, llvm.BuildExecutable does NOT stub what is left over: a missing\n    // js_* is an error naming the symbol, not a silent zero.\n    //\n    // SINCE THE PART B UNBLOCK there are TWO default inputs, exactly as in the other\n    // fifteen grammars: lib/runtime.ll (the C floor) and lib/metajs-rt.ll (MetaJS's own\n    // layer 2, built from lib/metajs-rt.metajs by tests/gen-metajs-rt-ll.sh - by this\n    // very grammar, with -rt-lib). Without the second one a floor body that moved into\n    // lib/runtime.metajs reached every language's native build except MetaJS's, which is\n    // what left Part B with an empty movable set (docs/runtime-next-plan.md, \"Part B,\n    // move 1\"). An explicit -rt still replaces BOTH, and only the default list gets the\n    // chained function table - see emitDispatch's chainExt.\n    if (c.exePath != undefined && c.exePath != \"\") {\n        var rts = c.runtime\n        var ownRt = (rts == undefined || rts.length == 0)\n        emitDispatch(\"jsdispatch\", ownRt)\n        if (ownRt) { rts = [libPath(\"runtime.ll\"), libPath(\"metajs-rt.ll\")] }\n        var buildErr = llvm.BuildExecutable(m, c.exePath, rts)\n        if (buildErr != \"\") { println(buildErr); exit(1) }\n        println(\"js compiler: wrote executable \" + c.exePath)\n        exit(0)\n    }\n\n    // Show the compiler output (the LLVM IR module).\n    if (c.repl) {\n        // -repl: run the program's top level, then the lines typed in (lib/compile-core.js).\n        llvm.RunJS(m, \"jsmain\")\n        replLoopIR({stmt: \"Statement\", expr: \"Expression\",\n                    show: function(b, v) { replShowCall(b, \"println\", v); return b }})\n    }\n\n    println(m)\n\n    // Run jsmain() with the built-in IR interpreter and the MetaJS handle runtime.\n    // The exit code of this metacompiler run is what main() returned, so test\n    // programs are self checking.\n    var res = llvm.RunJS(m, \"jsmain\")\n    var entryName = c.mainName\n    if (entryName == undefined || entryName == \"\") { entryName = \"main\" }\n    if (mainIsSnippet(entryName)) {\n        println(\"js compiler: -main snippet returned \" + res.Ret)\n    } else {\n        println(\"js compiler: \" + entryName + \"() returned \" + res.Ret)\n    }\n    exit(res.Ret)\n\n"}}}, &r.Rule{Operator:r.Command, String:"origin", CodeChilds:&r.Rules{&r.Rule{Operator:r.Token, String:"languages/metajs-to-llvm-ir.abnf"}}}}
@@ -6,7 +6,6 @@ import (
 	"math"
 	"math/big"
 	"math/bits"
-	"os"
 	"reflect"
 	"sort"
 	"strconv"
@@ -333,6 +332,8 @@ type boundMethod struct {
 // jsrt is one MetaJS runtime: a shared value table, a root scope with the host
 // bindings, and any number of attached IR modules (each on its own machine).
 type jsrt struct {
+	sess *Session // The session the runtime runs in: its options and writers.
+
 	// The value table is chunked, not one growing slice: it reaches millions of
 	// entries on a loop-heavy program, and doubling a contiguous slice of that
 	// size copies and re-maps tens of megabytes per growth step (it showed up as
@@ -360,6 +361,8 @@ type jsrt struct {
 
 	lastGets [][2]uint64 // The most recent member lookups (obj, key handles), for error messages.
 
+	stdinPos int // How much of Engine.Stdin js_stdin_line has read.
+
 	// The three RECOVERABLE-ERROR HOOKS, the twins of RT_MISS_VAR / RT_MISS_MEM /
 	// RT_MISS_SET in languages/lib/runtime.c. scopeGet, getMember and setMember
 	// are shared by all sixteen languages and all three used to end in an
@@ -388,6 +391,7 @@ type jsrt struct {
 	traceDepth int
 	traceNames map[*jsClosure]string // Under which name a closure was stored.
 	curPos     int                   // Source offset of the executing statement (js_srcpos), -1 = unknown.
+	dbg        *programRun           // The -pdebug debugger of this program (progdebugger.go), or nil.
 
 	// thisStack is the dynamic `this` of the compiled closures currently on the
 	// call stack: callInner pushes the receiver a call was made with and pops it
@@ -529,6 +533,19 @@ type jsrt struct {
 	// pyAliases memoizes the list[int]-style generic aliases, so the same written
 	// alias is the same value every time (see pyGenericAlias).
 	pyAliases map[string]*jsObject
+	// pyExterns is the extern map the Python registrar installed on this
+	// runtime, kept so a bound builtin can re-enter a wrapped extern.
+	pyExterns map[string]func(args []uint64) uint64
+
+	// phpMainScope is the scope phpmain hands over through js_phrtinit (0 until
+	// it does); phpDumpIds numbers var_dump's objects. See jsrtphp.go.
+	phpMainScope uint64
+	phpDumpIds   map[*jsObject]int
+	// csIdSeq counts the identity hashes handed out so far (csIdHash).
+	csIdSeq int32
+	// jv and kt are the Java and Kotlin halves' per-program state.
+	jv jvState
+	kt ktState
 
 	// curGen is the generator whose body is currently running, so js_yield knows
 	// which one to suspend. Only one goroutine ever runs (the handshake below is
@@ -1230,8 +1247,9 @@ func (rt *jsrt) formatLastGets() string {
 
 // newJSRT creates a runtime. The bindings become the variables of the root
 // scope (the host globals that the compiled programs can see).
-func newJSRT(bindings map[string]interface{}) *jsrt {
+func newJSRT(s *Session, bindings map[string]interface{}) *jsrt {
 	rt := &jsrt{
+		sess:      s,
 		strIntern: map[string]uint64{},
 		numIntern: map[uint64]uint64{},
 		objIntern: map[interface{}]uint64{},
@@ -1253,7 +1271,7 @@ func newJSRT(bindings map[string]interface{}) *jsrt {
 // (memory, globals, functions) whose js_* externals all work on the shared
 // value table and scope world of this runtime.
 func (rt *jsrt) attach(m *ir.Module) *machine {
-	ma := newMachine(m, "")
+	ma := newMachine(rt.sess, m, "")
 	ma.externs = rt.externs(ma)
 	ma.bindExterns() // Resolve every declared function to its handler now, not per call.
 	// A module declares only the externs it uses, so its function list says whether
@@ -1294,6 +1312,8 @@ var jsReclaimable = map[string]bool{"js_scope_new": true, "js_arr_new": true}
 // their callee through rt.call, which boxes a fresh array around the elements,
 // and js_call hands the array itself to a compiled callee - which is why the
 // callee is asked separately whether it keeps it (machine.pin, see recycle).
+// js_srcpos hands the scope of its statement (position 1, under -pdebug only)
+// to the debugger, which keeps the *jsScope and never the handle.
 //
 // js_closure is deliberately absent: it stores the scope HANDLE in the closure,
 // which is exactly how a scope outlives the frame that made it. Any extern not
@@ -1308,6 +1328,7 @@ var jsThroughArgs = map[string]uint32{
 	"js_arr_push": 1 << 0, "js_arg": 1 << 0, "js_pyrest": 1 << 0,
 	"js_pyprint": 1 << 0, "js_pyexc": 1 << 1,
 	"js_call": 1 << 2, "js_mcall": 1 << 2, "js_rmcall": 1 << 2, "js_supercall": 1 << 3,
+	"js_srcpos": 1 << 1,
 }
 
 // releaseHandle drops the value behind a handle the IR machine proved dead. Only
@@ -2955,8 +2976,11 @@ func (rt *jsrt) callH(callee interface{}, this interface{}, args []interface{},
 	if !rt.traced {
 		return rt.callInner(callee, this, args, argsH)
 	}
-	traceEmit(&TraceEvent{Ev: "call", Depth: rt.traceDepth, Line: lineOfPos(rt.curPos), Name: rt.calleeName(callee)})
+	rt.sess.traceEmit(&TraceEvent{Ev: "call", Depth: rt.traceDepth, Line: rt.sess.lineOfPos(rt.curPos), Name: rt.calleeName(callee)})
 	rt.traceDepth++
+	if rt.dbg != nil {
+		rt.dbg.call(rt.calleeName(callee), callee)
+	}
 	savedPos := rt.curPos
 	completed := false
 	// A js_throw panic unwinding through a traced call must still restore the
@@ -2966,15 +2990,21 @@ func (rt *jsrt) callH(callee interface{}, this interface{}, args []interface{},
 		if completed {
 			return
 		}
+		if rt.dbg != nil {
+			rt.dbg.ret()
+		}
 		rt.curPos = savedPos
 		rt.traceDepth--
-		traceEmit(&TraceEvent{Ev: "ret", Depth: rt.traceDepth, Line: lineOfPos(rt.curPos), Val: "throw!"})
+		rt.sess.traceEmit(&TraceEvent{Ev: "ret", Depth: rt.traceDepth, Line: rt.sess.lineOfPos(rt.curPos), Val: "throw!"})
 	}()
 	ret := rt.callInner(callee, this, args, argsH)
 	completed = true
+	if rt.dbg != nil {
+		rt.dbg.ret()
+	}
 	rt.curPos = savedPos // The caller's statement continues after the call.
 	rt.traceDepth--
-	traceEmit(&TraceEvent{Ev: "ret", Depth: rt.traceDepth, Line: lineOfPos(rt.curPos), Val: rt.traceVal(ret)})
+	rt.sess.traceEmit(&TraceEvent{Ev: "ret", Depth: rt.traceDepth, Line: rt.sess.lineOfPos(rt.curPos), Val: rt.traceVal(ret)})
 	return ret
 }
 
@@ -6566,7 +6596,7 @@ func (rt *jsrt) rubyPuts(v interface{}) {
 		}
 		return
 	}
-	fmt.Fprintln(outWriter, wtf8Clean(rt.rubyStr(v)))
+	fmt.Fprintln(rt.sess.out, wtf8Clean(rt.rubyStr(v)))
 }
 
 func (rt *jsrt) rubyStr(v interface{}) string {
@@ -9829,7 +9859,18 @@ func (rt *jsrt) builtinMethod(m *boundMethod, args []interface{}) interface{} {
 		case "charAt":
 			return gojaCharAt(rt.strAt(recv, jsToInt(argN(0))))
 		case "indexOf":
-			return float64(rt.strIndexOf(recv, argS(0)))
+			if len(args) < 2 {
+				return float64(rt.strIndexOf(recv, argS(0)))
+			}
+			// The position argument: the search starts there, clamped to the
+			// string like in goja (jsrtjsprint.go has the same for -js-print).
+			units := rt.strLen(recv)
+			from := clampSubstringIndex(rt.toNumber(args[1]), units)
+			at := rt.strIndexOf(rt.strRange(recv, from, units), argS(0))
+			if at < 0 {
+				return float64(-1)
+			}
+			return float64(from + at)
 		case "replace":
 			return strings.Replace(recv, argS(0), argS(1), 1)
 		case "slice":
@@ -10300,6 +10341,45 @@ func (rt *jsrt) externs(ma *machine) map[string]func(args []uint64) uint64 {
 		"js_scope_get": func(a []uint64) uint64 {
 			return w(rt.scopeGet(rt.scopeOf(a[0]), rt.toString(u(a[1]))))
 		},
+		// -repl: the program hands over its top-level scope, the one the lines
+		// read afterwards run in (repl.go).
+		"js_repl_scope": func(a []uint64) uint64 {
+			rt.sess.repl.scope = rt.scopeOf(a[0])
+			return 0
+		},
+		// The program's command line and standard input (Engine.Args, Engine.Stdin):
+		// js_argv(withName) is the arguments as an array of strings, with the
+		// program's file name in front when withName is true (argv[0] of C and Go,
+		// Python's sys.argv); js_stdin_line(prompt) prints the prompt unless it is
+		// undefined and answers the next input line without its line break, or null
+		// at the end of the input. The twins of both are in languages/lib/runtime.c.
+		"js_argv": func(a []uint64) uint64 {
+			out := &jsArray{}
+			if a[0] == jsHTrue {
+				out.elems = append(out.elems, rt.sess.src.name)
+			}
+			for _, arg := range rt.sess.Args {
+				out.elems = append(out.elems, arg)
+			}
+			return w(out)
+		},
+		"js_stdin_line": func(a []uint64) uint64 {
+			if u(a[0]) != jsUndef {
+				fmt.Fprint(rt.sess.out, rt.toString(u(a[0])))
+			}
+			in := rt.sess.Stdin
+			if rt.stdinPos >= len(in) {
+				return w(jsNull)
+			}
+			line := in[rt.stdinPos:]
+			if i := strings.IndexByte(line, '\n'); i >= 0 {
+				line = line[:i]
+				rt.stdinPos += i + 1
+			} else {
+				rt.stdinPos = len(in)
+			}
+			return w(strings.TrimSuffix(line, "\r"))
+		},
 		"js_scope_set": func(a []uint64) uint64 {
 			rt.scopeSet(rt.scopeOf(a[0]), rt.toString(u(a[1])), u(a[2]))
 			return 0
@@ -10399,11 +10479,15 @@ func (rt *jsrt) externs(ma *machine) map[string]func(args []uint64) uint64 {
 
 		// The source position marker: compiled in per statement when the host
 		// collects positions (c.tracing), so traces and steppers know which
-		// statement executes. Costs one int store at run time.
+		// statement executes. Costs one int store at run time. Under -pdebug
+		// (c.debugging) the scope the statement runs in and its start follow.
 		"js_srcpos": func(a []uint64) uint64 {
 			rt.curPos = int(int64(a[0]))
 			if rt.traced {
-				traceEmit(&TraceEvent{Ev: "stmt", Depth: rt.traceDepth, Line: lineOfPos(rt.curPos)})
+				rt.sess.traceEmit(&TraceEvent{Ev: "stmt", Depth: rt.traceDepth, Line: rt.sess.lineOfPos(rt.curPos)})
+			}
+			if rt.dbg != nil && len(a) > 2 {
+				rt.dbg.stmt(int(int64(a[2])), a[1])
 			}
 			return 0
 		},
@@ -10818,8 +10902,8 @@ func (rt *jsrt) externs(ma *machine) map[string]func(args []uint64) uint64 {
 		// compiled halves read "js runtime error: uncaught exception:
 		// [object Object]" - no message, no class. docs/todo.md 1.7.
 		"js_rtop": func(a []uint64) uint64 {
-			fmt.Fprintln(outWriter, wtf8Clean(rt.rubyExcTopLine(u(a[0]))))
-			os.Exit(1)
+			fmt.Fprintln(rt.sess.out, wtf8Clean(rt.rubyExcTopLine(u(a[0]))))
+			rt.sess.exit(1)
 			return 0
 		},
 		"js_throw": func(a []uint64) uint64 {
@@ -10841,7 +10925,14 @@ func (rt *jsrt) externs(ma *machine) map[string]func(args []uint64) uint64 {
 				depth := len(rt.thisStack)
 				ntDepth := len(rt.newTargetStack)
 				defer func() {
-					if caught = recover(); caught != nil && rt.trackThis {
+					caught = recover()
+					if _, ok := caught.(*ExitError); ok {
+						panic(caught) // exit() runs no catch and no finally.
+					}
+					if _, ok := caught.(*SandboxError); ok {
+						panic(caught) // Neither does the sandbox stopping the run.
+					}
+					if caught != nil && rt.trackThis {
 						if len(rt.thisStack) > depth {
 							rt.thisStack = rt.thisStack[:depth]
 						}
@@ -11702,7 +11793,7 @@ func (rt *jsrt) externs(ma *machine) map[string]func(args []uint64) uint64 {
 		// line) and prints nothing at all for an empty one, which is MRI.
 		"js_rputs": func(a []uint64) uint64 { rt.rubyPuts(u(a[0])); return 0 },
 		"js_rprint": func(a []uint64) uint64 {
-			fmt.Fprint(outWriter, wtf8Clean(rt.rubyStr(u(a[0]))))
+			fmt.Fprint(rt.sess.out, wtf8Clean(rt.rubyStr(u(a[0]))))
 			return 0
 		},
 		// Kernel#p: INSPECT, one argument per line, answering the argument (the
@@ -11716,7 +11807,7 @@ func (rt *jsrt) externs(ma *machine) map[string]func(args []uint64) uint64 {
 				return w(jsNull)
 			}
 			for _, e := range arr.elems {
-				fmt.Fprintln(outWriter, wtf8Clean(rt.rubyInspect(e)))
+				fmt.Fprintln(rt.sess.out, wtf8Clean(rt.rubyInspect(e)))
 			}
 			if len(arr.elems) == 1 {
 				return w(arr.elems[0])
@@ -12683,6 +12774,12 @@ func (rt *jsrt) externs(ma *machine) map[string]func(args []uint64) uint64 {
 				ntDepth := len(rt.newTargetStack)
 				defer func() {
 					if caught := recover(); caught != nil {
+						if _, ok := caught.(*ExitError); ok {
+							panic(caught) // exit() is not a Go panic a recover() can take.
+						}
+						if _, ok := caught.(*SandboxError); ok {
+							panic(caught) // Nor is the sandbox stopping the run.
+						}
 						if rt.trackThis {
 							if len(rt.thisStack) > depth {
 								rt.thisStack = rt.thisStack[:depth]
@@ -13999,7 +14096,7 @@ func (rt *jsrt) externs(ma *machine) map[string]func(args []uint64) uint64 {
 				}
 				out += rt.toString(e)
 			}
-			fmt.Fprintln(outWriter, wtf8Clean(out))
+			fmt.Fprintln(rt.sess.out, wtf8Clean(out))
 			return 0
 		},
 		// A Lua string is a BYTE string, so lua-to-llvm-ir.abnf (like
@@ -14523,7 +14620,7 @@ func (rt *jsrt) externs(ma *machine) map[string]func(args []uint64) uint64 {
 				}
 				out += rt.pyString(e)
 			}
-			fmt.Fprintln(outWriter, wtf8Clean(out))
+			fmt.Fprintln(rt.sess.out, wtf8Clean(out))
 			return 0
 		},
 
@@ -14787,27 +14884,27 @@ func standardJSBindings() map[string]interface{} {
 
 	return map[string]interface{}{
 		"println": jsHostFunc("println", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-			fmt.Fprintln(outWriter, rt.printArgs(args)...)
+			fmt.Fprintln(rt.sess.out, rt.printArgs(args)...)
 			return jsUndef
 		}),
 		"print": jsHostFunc("print", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-			fmt.Fprint(outWriter, rt.printArgs(args)...)
+			fmt.Fprint(rt.sess.out, rt.printArgs(args)...)
 			return jsUndef
 		}),
-		// eprintln is the DIAGNOSTIC channel (warnings): standard error, never
-		// outWriter (which -pipe swaps to capture a stage's text) and never the
+		// eprintln is the DIAGNOSTIC channel (warnings): the session's warn writer, never
+		// its out writer (which -pipe swaps to capture a stage's text) and never the
 		// emitted module. Not silenced by the quiet flags - frozenBaseBindings
 		// leaves it alone where it noops print/println/printf, exactly like the
 		// goja binding in commonscript.go. The two hosts must stay identical.
 		"eprintln": jsHostFunc("eprintln", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-			fmt.Fprintln(warnWriter, rt.printArgs(args)...)
+			fmt.Fprintln(rt.sess.warn, rt.printArgs(args)...)
 			return jsUndef
 		}),
 		"printf": jsHostFunc("printf", func(rt *jsrt, this uint64, args []interface{}) interface{} {
 			if len(args) == 0 {
 				return jsUndef
 			}
-			fmt.Fprintf(outWriter, rt.toString(args[0]), rt.printArgs(args[1:])...)
+			fmt.Fprintf(rt.sess.out, rt.toString(args[0]), rt.printArgs(args[1:])...)
 			return jsUndef
 		}),
 		// fmt.Sprint's text: the same rendering println gives, returned instead of
@@ -14849,7 +14946,7 @@ func standardJSBindings() map[string]interface{} {
 			return jsParseFloat(rt.toString(argAt(args, 0)))
 		}),
 		"exit": jsHostFunc("exit", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-			os.Exit(int(int32(jsToInt(rt.toNumber(argAt(args, 0))))))
+			rt.sess.exit(int(int32(jsToInt(rt.toNumber(argAt(args, 0))))))
 			return jsUndef
 		}),
 		// Standard numeric globals (goja has them natively; the frozen VM did not).
@@ -15002,11 +15099,17 @@ func (rt *jsrt) callEntry(ma *machine, name string, env uint64) uint64 {
 	if !rt.traced {
 		return ma.callByName(name, []uint64{env, rt.wrap(&jsArray{})})
 	}
-	traceEmit(&TraceEvent{Ev: "call", Depth: rt.traceDepth, Name: name})
+	rt.sess.traceEmit(&TraceEvent{Ev: "call", Depth: rt.traceDepth, Name: name})
 	rt.traceDepth++
+	if rt.dbg != nil {
+		rt.dbg.call(name, nil)
+	}
 	h := ma.callByName(name, []uint64{env, rt.wrap(&jsArray{})})
+	if rt.dbg != nil {
+		rt.dbg.ret()
+	}
 	rt.traceDepth--
-	traceEmit(&TraceEvent{Ev: "ret", Depth: rt.traceDepth, Line: lineOfPos(rt.curPos), Val: rt.traceVal(rt.unwrap(h))})
+	rt.sess.traceEmit(&TraceEvent{Ev: "ret", Depth: rt.traceDepth, Line: rt.sess.lineOfPos(rt.curPos), Val: rt.traceVal(rt.unwrap(h))})
 	return h
 }
 
@@ -15171,11 +15274,15 @@ func (rt *jsrt) excText(v interface{}) string {
 
 // module with the standard host bindings and returns its int32 result.
 // This is the program runtime, so the -cfgraph and -trace hooks live here.
-func runJSModule(m *ir.Module, entry string) *RunResult {
-	maybeDumpCFG(m)
-	maybeDumpCallgraph(m)
-	rt := newJSRT(programJSBindings())
+func (s *Session) runJSModule(m *ir.Module, entry string) *RunResult {
+	s.maybeDumpCFG(m)
+	s.maybeDumpCallgraph(m)
+	s.maybeDumpIR(m)
+	rt := newJSRT(s, programJSBindings())
 	rt.enableTrace()
+	if s.ProgramDebugger != nil {
+		rt.dbg = s.ProgramDebugger.run(rt)
+	}
 	ma := rt.attach(m)
 	// An exception that escapes the program's entry point is an uncaught throw;
 	// report it like any other runtime error (the same wording rt.fail gives, so
@@ -15184,25 +15291,33 @@ func runJSModule(m *ir.Module, entry string) *RunResult {
 	// is unchanged, but the tag-script engines can now tell "the program failed"
 	// from "the tag script failed" and diagnose them identically (see the type).
 	defer func() {
-		r := recover()
-		if r == nil {
-			return
-		}
-		if _, ok := r.(jsProgramPanic); ok {
-			panic(r)
-		}
-		if exc, ok := r.(*jsThrown); ok {
-			// excText, not jsvString: String(o) of an object is "[object Object]"
-			// and that is what every uncaught throw carrying a python-style
-			// {__class, args} instance used to print. See excText.
-			panic(jsProgramPanic{"js runtime error: uncaught exception: " + rt.excText(exc.value)})
+		if r := recover(); r != nil {
+			panic(rt.programFailure(r))
 		}
-		panic(jsProgramPanic{fmt.Sprint(r)})
 	}()
+	if s.Repl {
+		s.repl.rt = rt // The lines read afterwards run in this runtime (repl.go).
+	}
 	h := rt.callEntry(ma, entry, 0)
 	return &RunResult{Ret: uint32(rt.toInt32(rt.unwrap(h))), Out: ""}
 }
 
+// programFailure is what a panic that escaped a program's entry point is
+// re-panicked as: a jsProgramPanic, or the *ExitError of an exit(n) and the
+// *SandboxError or *StepLimitError of a limit unchanged.
+func (rt *jsrt) programFailure(r interface{}) interface{} {
+	switch e := r.(type) {
+	case jsProgramPanic, *ExitError, *SandboxError, *StepLimitError:
+		return r
+	case *jsThrown:
+		// excText, not jsvString: String(o) of an object is "[object Object]"
+		// and that is what every uncaught throw carrying a python-style
+		// {__class, args} instance used to print. See excText.
+		return jsProgramPanic{"js runtime error: uncaught exception: " + rt.excText(e.value)}
+	}
+	return jsProgramPanic{fmt.Sprint(r)}
+}
+
 // ----------------------------------------------------------------------------
 // Python's float: a boxed double, so that int and float stay two types
 //
@@ -17051,7 +17166,7 @@ func (rt *jsrt) pyBoundBuiltin(target interface{}, name string) interface{} {
 		// dies with "unknown String method: upper". Re-enter through the extern
 		// instead, which is the same path a written `s.upper()` takes.
 		if _, isStr := target.(string); isStr {
-			if m := pyExternMaps[rt]; m != nil {
+			if m := rt.pyExterns; m != nil {
 				if f := m["js_pymcall"]; f != nil {
 					return rt.unwrap(f([]uint64{rt.wrap(target), rt.wrap(name),
 						rt.wrap(&jsArray{elems: args}), rt.wrap(jsUndef)}))
@@ -17066,16 +17181,14 @@ func (rt *jsrt) pyBoundBuiltin(target interface{}, name string) interface{} {
 	return h
 }
 
-// pyExternMaps remembers the extern table each run installed. The table is
+// pyExterns remembers the extern table the run installed. The table is
 // filled by rxInstallExterns and then WRAPPED by the per-language registrars
 // (rxExtraExterns), so a lookup made at CALL time - which is the only time
 // pyBoundBuiltin looks - sees the fully wrapped entry no matter what order the
 // registrars ran in. Only python's getattr()-produced bound methods read it.
-var pyExternMaps = map[*jsrt]map[string]func(args []uint64) uint64{}
-
 func init() {
 	rxExtraExterns = append(rxExtraExterns, func(rt *jsrt, m map[string]func(args []uint64) uint64) {
-		pyExternMaps[rt] = m
+		rt.pyExterns = m
 	})
 }
 
@@ -1255,11 +1255,11 @@ func init() {
 		m["js_csconsole"] = func(a []uint64) uint64 {
 			o := newJSObject()
 			o.set("WriteLine", jsHostFunc("js_csprint", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-				fmt.Fprint(outWriter, wtf8Clean(rt.cspStr(argAt(args, 0)))+"\n")
+				fmt.Fprint(rt.sess.out, wtf8Clean(rt.cspStr(argAt(args, 0)))+"\n")
 				return jsUndef
 			}))
 			o.set("Write", jsHostFunc("js_cswrite", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-				fmt.Fprint(outWriter, wtf8Clean(rt.cspStr(argAt(args, 0))))
+				fmt.Fprint(rt.sess.out, wtf8Clean(rt.cspStr(argAt(args, 0))))
 				return jsUndef
 			}))
 			return rt.wrap(o)
@@ -1617,9 +1617,7 @@ func (rt *jsrt) csHash(v interface{}) int32 {
 
 // A per-run identity number for a reference: the k-th distinct object asked gets
 // 0x2b3c4d00+k. Reproducible within a run; no assertion may depend on the digits.
-// One compile runs one program, so a package-level counter is per-program - the
-// same reasoning jvpIdent records in abnf/jsrtjava.go.
-var csIdSeq int32
+// The counter is rt.csIdSeq: one runtime runs one program.
 
 func (rt *jsrt) csIdHash(v interface{}) int32 {
 	o, ok := v.(*jsObject)
@@ -1629,8 +1627,8 @@ func (rt *jsrt) csIdHash(v interface{}) int32 {
 	if h, found := o.props["__idhash"]; found {
 		return int32(rt.toNumber(h))
 	}
-	csIdSeq++
-	h := int32(725896960) + csIdSeq
+	rt.csIdSeq++
+	h := int32(725896960) + rt.csIdSeq
 	o.set("__idhash", float64(h))
 	return h
 }
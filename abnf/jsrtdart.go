@@ -328,7 +328,7 @@ func (rt *jsrt) addDartExterns(m map[string]func(args []uint64) uint64) {
 
 	// print(x): Dart's print writes x.toString() followed by a newline.
 	m["js_dartprint"] = func(a []uint64) uint64 {
-		fmt.Fprintln(outWriter, wtf8Clean(rt.dartStr(u(a[0]))))
+		fmt.Fprintln(rt.sess.out, wtf8Clean(rt.dartStr(u(a[0]))))
 		return 0
 	}
 	// The same rendering as a value: string interpolation and an explicit
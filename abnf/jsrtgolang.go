@@ -70,7 +70,6 @@ package abnf
 import (
 	"fmt"
 	"math"
-	"os"
 	"strconv"
 	"strings"
 )
@@ -84,7 +83,7 @@ func init() {
 			if nl {
 				out += "\n"
 			}
-			fmt.Fprint(outWriter, wtf8Clean(out))
+			fmt.Fprint(rt.sess.out, wtf8Clean(out))
 			return 0
 		}
 		m["js_gowrite"] = func(a []uint64) uint64 {
@@ -92,7 +91,7 @@ func init() {
 			if nl {
 				out += "\n"
 			}
-			fmt.Fprint(outWriter, wtf8Clean(out))
+			fmt.Fprint(rt.sess.out, wtf8Clean(out))
 			return 0
 		}
 		m["js_gostr"] = func(a []uint64) uint64 {
@@ -900,8 +899,8 @@ func init() {
 			} else {
 				text = "js runtime error: uncaught exception: " + fmt.Sprint(p)
 			}
-			fmt.Fprint(outWriter, wtf8Clean(text+"\n"))
-			os.Exit(1)
+			fmt.Fprint(rt.sess.out, wtf8Clean(text+"\n"))
+			rt.sess.exit(1)
 			return 0
 		}
 		// The DIVISOR of an integer '/' or '%', checked before the operator runs.
@@ -116,20 +116,24 @@ func jvI(rt *jsrt, v interface{}) int32 { return int32(giVal(rt, v)) }
 // The five runtime-raised exception class descriptors, each registered by NAME
 // by js_jvexc at module init, because the externs that raise them have no access
 // to the program's scope; without one the raise aborts the run instead of
-// throwing. One compile runs one program, so a package-level holder is
-// per-program - the same reasoning the jvpIdent counter below records, and it
-// keeps this out of the shared jsrt struct.
+// throwing. They live on the runtime, next to the identity counter below, so
+// that two programs running side by side each see their own classes.
 //
 // ArithmeticException is "/ by zero" (JLS 15.17.2). The other four: an out-of-range array
 // access, an out-of-range string index or range, a negative array length and a
 // null array reference all THROW rather than abort. Same reasoning, same
 // per-program lifetime; the layer-2 twin is the block of jv*Cls slots in
 // languages/lib/java-rt.metajs.
-var jvArithExcCls *jsObject
-var jvAioobeCls *jsObject
-var jvSioobeCls *jsObject
-var jvNegArrCls *jsObject
-var jvNpeCls *jsObject
+type jvState struct {
+	arithExcCls *jsObject
+	aioobeCls   *jsObject
+	sioobeCls   *jsObject
+	negArrCls   *jsObject
+	npeCls      *jsObject
+
+	ident  map[interface{}]int // see jvpIdentNum
+	identN int
+}
 
 func (rt *jsrt) jvThrowCls(cls *jsObject, msg interface{}) {
 	if cls == nil {
@@ -145,7 +149,7 @@ func (rt *jsrt) jvThrowCls(cls *jsObject, msg interface{}) {
 	panic(&jsThrown{value: o})
 }
 
-func (rt *jsrt) jvThrowArith(msg string) { rt.jvThrowCls(jvArithExcCls, msg) }
+func (rt *jsrt) jvThrowArith(msg string) { rt.jvThrowCls(rt.jv.arithExcCls, msg) }
 
 // Is the value part of the java.lang Throwable hierarchy at all? The 64-deep cap
 // is the one every __class/__super walk here carries (manual chapter 7.9).
@@ -173,13 +177,13 @@ func jvIsThrowable(v interface{}) bool {
 // jvThrowAioobe/jvThrowSioobe/jvThrowRange in languages/lib/java-rt.metajs spell
 // the same three, and tests/java-test-full.java SECTION 34 pins them.
 func (rt *jsrt) jvThrowAioobe(i, n int) {
-	rt.jvThrowCls(jvAioobeCls, fmt.Sprintf("Index %d out of bounds for length %d", i, n))
+	rt.jvThrowCls(rt.jv.aioobeCls, fmt.Sprintf("Index %d out of bounds for length %d", i, n))
 }
 func (rt *jsrt) jvThrowSioobe(i, n int) {
-	rt.jvThrowCls(jvSioobeCls, fmt.Sprintf("Index %d out of bounds for length %d", i, n))
+	rt.jvThrowCls(rt.jv.sioobeCls, fmt.Sprintf("Index %d out of bounds for length %d", i, n))
 }
 func (rt *jsrt) jvThrowRange(b, e, n int) {
-	rt.jvThrowCls(jvSioobeCls, fmt.Sprintf("Range [%d, %d) out of bounds for length %d", b, e, n))
+	rt.jvThrowCls(rt.jv.sioobeCls, fmt.Sprintf("Range [%d, %d) out of bounds for length %d", b, e, n))
 }
 
 // jvArith is one binary arithmetic or bitwise operator on two INTEGRAL operands.
@@ -543,15 +547,15 @@ func init() {
 			}
 			switch rt.toString(u(a[0])) {
 			case "ArithmeticException":
-				jvArithExcCls = o
+				rt.jv.arithExcCls = o
 			case "ArrayIndexOutOfBoundsException":
-				jvAioobeCls = o
+				rt.jv.aioobeCls = o
 			case "StringIndexOutOfBoundsException":
-				jvSioobeCls = o
+				rt.jv.sioobeCls = o
 			case "NegativeArraySizeException":
-				jvNegArrCls = o
+				rt.jv.negArrCls = o
 			case "NullPointerException":
-				jvNpeCls = o
+				rt.jv.npeCls = o
 			}
 			return 0
 		}
@@ -572,7 +576,7 @@ func init() {
 			if isUndefOrNull(o) {
 				// `int[] z = null; z[0]` - a catchable NullPointerException with a
 				// null message, exactly as the interpreter half throws it.
-				rt.jvThrowCls(jvNpeCls, jsNull)
+				rt.jvThrowCls(rt.jv.npeCls, jsNull)
 			}
 			return w(rt.getMember(o, u(a[1])))
 		}
@@ -600,7 +604,7 @@ func init() {
 		m["js_jvnewlen"] = func(a []uint64) uint64 {
 			n := jsToInt(rt.toNumber(u(a[0])))
 			if n < 0 {
-				rt.jvThrowCls(jvNegArrCls, strconv.Itoa(n))
+				rt.jvThrowCls(rt.jv.negArrCls, strconv.Itoa(n))
 			}
 			return a[0]
 		}
@@ -842,11 +846,11 @@ func init() {
 		// emitted closure arrives whole, so the no-argument println(), which
 		// writes just the line terminator, is distinguishable from println(null).
 		m["js_jvprint"] = func(a []uint64) uint64 {
-			fmt.Fprintln(outWriter, wtf8Clean(jvpFirst(rt, u(a[0]))))
+			fmt.Fprintln(rt.sess.out, wtf8Clean(jvpFirst(rt, u(a[0]))))
 			return 0
 		}
 		m["js_jvwrite"] = func(a []uint64) uint64 {
-			fmt.Fprint(outWriter, wtf8Clean(jvpFirst(rt, u(a[0]))))
+			fmt.Fprint(rt.sess.out, wtf8Clean(jvpFirst(rt, u(a[0]))))
 			return 0
 		}
 		// ONE record component of two record instances, compared the way JLS
@@ -1110,7 +1114,7 @@ func (rt *jsrt) jvpRender(v interface{}, depth int) string {
 	case string:
 		return t
 	case *jsArray:
-		return jvpArrayTag(t) + "@" + jvpHash(t)
+		return jvpArrayTag(t) + "@" + rt.jvpHash(t)
 	case *jsObject:
 		return rt.jvpObj(t, depth)
 	}
@@ -1152,7 +1156,7 @@ func (rt *jsrt) jvpObj(o *jsObject, depth int) string {
 		simple, _ := cls.props["__name"].(string)
 		return simple + "[" + strings.Join(parts, ", ") + "]"
 	}
-	return jvpClassName(cls) + "@" + jvpHash(o)
+	return jvpClassName(cls) + "@" + rt.jvpHash(o)
 }
 
 // jvpClassName is the class' BINARY name: a nested type is spelled Outer$Inner,
@@ -1235,32 +1239,33 @@ func jvpElemTag(v interface{}) string {
 // ----------------------------------------------------------------------------
 // Identity hash
 
-// jvpIdent gives every object rendered with an `@` a stable per-run number. Real
+// jvState.ident gives every object rendered with an `@` a stable per-run number. Real
 // java prints System.identityHashCode, which is an address-derived value that
 // changes between two runs of the same program - so it is not reproducible and no
 // test can assert it. What the two halves must agree on is that the same object
 // renders identically twice within a run and that the run as a whole is
-// deterministic, which the counter provides. One compile runs one program, so a
-// package-level counter is per-program.
-var jvpIdent = map[interface{}]int{}
-var jvpIdentN int
+// deterministic, which the counter provides. The counter lives on the runtime
+// (jvState), so it is per-program.
 
 // The NUMBER behind that rendering, which is exactly what Object.hashCode
 // answers in real java: `o.toString()` is getName() + "@" +
 // Integer.toHexString(hashCode()), so the two must agree, and here they do by
 // construction. jvpHash below is this value printed with %x.
-func jvpIdentNum(v interface{}) float64 {
-	n, ok := jvpIdent[v]
+func (rt *jsrt) jvpIdentNum(v interface{}) float64 {
+	if rt.jv.ident == nil {
+		rt.jv.ident = map[interface{}]int{}
+	}
+	n, ok := rt.jv.ident[v]
 	if !ok {
-		jvpIdentN++
-		n = jvpIdentN
-		jvpIdent[v] = n
+		rt.jv.identN++
+		n = rt.jv.identN
+		rt.jv.ident[v] = n
 	}
 	return float64(0x1a2b3c00 + n)
 }
 
-func jvpHash(v interface{}) string {
-	return fmt.Sprintf("%x", int(jvpIdentNum(v)))
+func (rt *jsrt) jvpHash(v interface{}) string {
+	return fmt.Sprintf("%x", int(rt.jvpIdentNum(v)))
 }
 
 // ----------------------------------------------------------------------------
@@ -1354,18 +1359,18 @@ func (rt *jsrt) jvHash(v interface{}) float64 {
 			}
 		}
 	}
-	return jvpIdentNum(v)
+	return rt.jvpIdentNum(v)
 }
 
 // h = 0; h = h*31 + Objects.hashCode(component), at int width - OpenJDK's.
 func (rt *jsrt) jvRecordHash(v interface{}, comps interface{}) float64 {
 	arr, ok := comps.(*jsArray)
 	if !ok {
-		return jvpIdentNum(v)
+		return rt.jvpIdentNum(v)
 	}
 	o, ok := v.(*jsObject)
 	if !ok {
-		return jvpIdentNum(v)
+		return rt.jvpIdentNum(v)
 	}
 	h := int32(0)
 	for _, c := range arr.elems {
@@ -1176,7 +1176,7 @@ func (rt *jsrt) addJSValueExterns(m map[string]func(args []uint64) uint64) {
 			}
 			out += rt.jsvString(e)
 		}
-		fmt.Fprintln(outWriter, wtf8Clean(out))
+		fmt.Fprintln(rt.sess.out, wtf8Clean(out))
 		return 0
 	}
 	// print: the same rendering without the newline and without the separator, which
@@ -1190,7 +1190,7 @@ func (rt *jsrt) addJSValueExterns(m map[string]func(args []uint64) uint64) {
 		for _, e := range args.elems {
 			out += rt.jsvString(e)
 		}
-		fmt.Fprint(outWriter, wtf8Clean(out))
+		fmt.Fprint(rt.sess.out, wtf8Clean(out))
 		return 0
 	}
 	// String(v) / the ToString an interpolation needs.
@@ -1233,9 +1233,9 @@ func (rt *jsrt) addJSValueExterns(m map[string]func(args []uint64) uint64) {
 			}
 			out := wtf8Clean(strJoin(parts, sep))
 			if nl {
-				fmt.Fprintln(outWriter, out)
+				fmt.Fprintln(rt.sess.out, out)
 			} else {
-				fmt.Fprint(outWriter, out)
+				fmt.Fprint(rt.sess.out, out)
 			}
 			return jsUndef
 		}))
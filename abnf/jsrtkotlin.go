@@ -140,14 +140,22 @@ func ktIsIntegral(v interface{}) bool {
 	return false
 }
 
-// ktArithExcCls is the ArithmeticException descriptor a divide by zero throws.
-// The Kotlin compiler grammar has no builtin exception classes to hand over (its
-// `catch` takes the first clause and reads `message`), so the descriptor is built
-// here, once, and its __super chain lets js_ktis answer `e is ArithmeticException`.
-// One compile runs one program, so a package-level holder is per-program.
-var ktArithExcCls *jsObject
-
-// ktExcHier is the builtin throwable hierarchy, built once per program. It is what
+// ktState is the Kotlin half's per-program state. It hangs off the runtime rather
+// than the package so two programs running side by side never share a receiver
+// stack or an exception class; the blocks further down document each field.
+type ktState struct {
+	arithExcCls *jsObject            // see ktExcClass
+	excHier     map[string]*jsObject // see ktExcHierarchy
+	recvStack   []interface{}
+	memberCall  func(recv interface{}, name string, args []interface{}) interface{}
+	isType      func(v interface{}, tname string) bool
+	refs        map[*hostFunc]*ktRefInfo
+	funcNames   map[interface{}]string
+	refRead     func(recv interface{}, name string) interface{}
+	refWrite    func(recv interface{}, name string, v interface{})
+}
+
+// ktExcHierarchy is the builtin throwable hierarchy, built once per program. It is what
 // `Exception("m")` / `IllegalStateException("m")` construct: the Kotlin compiler
 // grammar has no user class for them, and before this the call aborted with
 // "unknown name: Exception" while kotlin-interpreter.abnf ran the same program.
@@ -155,11 +163,9 @@ var ktArithExcCls *jsObject
 // -> Throwable), so js_ktis answers `e is Exception` for one - see the report note
 // about installThrowables in the other half, which parents all of them directly to
 // Throwable and therefore answers false.
-var ktExcHier map[string]*jsObject
-
-func ktExcHierarchy() map[string]*jsObject {
-	if ktExcHier != nil {
-		return ktExcHier
+func (rt *jsrt) ktExcHierarchy() map[string]*jsObject {
+	if rt.kt.excHier != nil {
+		return rt.kt.excHier
 	}
 	mk := func(name string, super *jsObject) *jsObject {
 		o := newJSObject()
@@ -188,7 +194,7 @@ func ktExcHierarchy() map[string]*jsObject {
 	h["UninitializedPropertyAccessException"] = mk("UninitializedPropertyAccessException", h["RuntimeException"])
 	h["StackOverflowError"] = mk("StackOverflowError", h["Error"])
 	h["OutOfMemoryError"] = mk("OutOfMemoryError", h["Error"])
-	ktExcHier = h
+	rt.kt.excHier = h
 	return h
 }
 
@@ -217,22 +223,27 @@ func (rt *jsrt) ktLateinitCheck(o *jsObject, name string, v interface{}) interfa
 }
 
 // ktIsBuiltinExc reports a name the hierarchy above provides.
-func ktIsBuiltinExc(name string) bool {
-	_, ok := ktExcHierarchy()[name]
+func (rt *jsrt) ktIsBuiltinExc(name string) bool {
+	_, ok := rt.ktExcHierarchy()[name]
 	return ok
 }
 
-func ktExcClass() *jsObject {
-	if ktArithExcCls != nil {
-		return ktArithExcCls
+// ktExcClass is the ArithmeticException descriptor a divide by zero throws.
+// The Kotlin compiler grammar has no builtin exception classes to hand over (its
+// `catch` takes the first clause and reads `message`), so the descriptor is built
+// here, once per program, and its __super chain lets js_ktis answer
+// `e is ArithmeticException`.
+func (rt *jsrt) ktExcClass() *jsObject {
+	if rt.kt.arithExcCls != nil {
+		return rt.kt.arithExcCls
 	}
-	ktArithExcCls = ktExcHierarchy()["ArithmeticException"]
-	return ktArithExcCls
+	rt.kt.arithExcCls = rt.ktExcHierarchy()["ArithmeticException"]
+	return rt.kt.arithExcCls
 }
 
 func (rt *jsrt) ktThrowArith(msg string) {
 	o := newJSObject()
-	o.set("__class", ktExcClass())
+	o.set("__class", rt.ktExcClass())
 	// `message` is the property Kotlin's Throwable exposes and the field both
 	// halves read; the interpreter's installThrowables stores it under the same
 	// name.
@@ -755,8 +766,8 @@ func init() {
 			// compareTo) and FALSE here, because jsCompare fell back to comparing the
 			// two objects as values. The probe is on the RECEIVER's descriptor chain,
 			// so a program that declares no compareTo emits and runs exactly as before.
-			if lo, isObj := l.(*jsObject); isObj && ktMemberCall != nil && ktClassChainHas(lo, "compareTo") {
-				c := int(rt.toNumber(ktMemberCall(l, "compareTo", []interface{}{r})))
+			if lo, isObj := l.(*jsObject); isObj && rt.kt.memberCall != nil && ktClassChainHas(lo, "compareTo") {
+				c := int(rt.toNumber(rt.kt.memberCall(l, "compareTo", []interface{}{r})))
 				switch op {
 				case "<":
 					return boolH(c < 0)
@@ -844,7 +855,7 @@ func init() {
 			}
 			// Two callable references / class literals. See ktRefEq; without it the
 			// comparison fell through to identity and `b::v == b::v` was false.
-			if v, decided := ktRefEq(l, r); decided {
+			if v, decided := rt.ktRefEq(l, r); decided {
 				return boolH(v)
 			}
 			// A list, a map or a Pair/Triple compares STRUCTURALLY (ktStructEq): none
@@ -876,7 +887,7 @@ func init() {
 			}
 			// Two callable references / class literals. See ktRefEq; without it the
 			// comparison fell through to identity and `b::v == b::v` was false.
-			if v, decided := ktRefEq(l, r); decided {
+			if v, decided := rt.ktRefEq(l, r); decided {
 				return boolH(!v)
 			}
 			if v, decided := rt.ktStructEq(l, r); decided {
@@ -999,7 +1010,7 @@ func init() {
 		// itself declare; `message` is the field both halves read.
 		m["js_ktnewexc"] = func(a []uint64) uint64 {
 			name := rt.toString(u(a[0]))
-			cls, ok := ktExcHierarchy()[name]
+			cls, ok := rt.ktExcHierarchy()[name]
 			if !ok {
 				rt.fail("unknown builtin exception %s", name)
 			}
@@ -1039,7 +1050,7 @@ func init() {
 		}
 		// ktIsType is js_ktis as a plain Go call, installed here so the collection
 		// builtins (filterIsInstance) can ask the same question the `is` operator asks.
-		ktIsType = func(v interface{}, tname string) bool {
+		rt.kt.isType = func(v interface{}, tname string) bool {
 			return u(m["js_ktis"]([]uint64{w(v), rt.wrapStr(tname)})) == interface{}(true)
 		}
 		m["js_ktis"] = func(a []uint64) uint64 {
@@ -1200,13 +1211,13 @@ func init() {
 		// twelve other languages that use it.
 		m["js_ktprint"] = func(a []uint64) uint64 {
 			return rt.wrap(jsHostFunc("println", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-				fmt.Fprint(outWriter, wtf8Clean(ktpLine(rt, args)+"\n"))
+				fmt.Fprint(rt.sess.out, wtf8Clean(ktpLine(rt, args)+"\n"))
 				return jsUndef
 			}))
 		}
 		m["js_ktwrite"] = func(a []uint64) uint64 {
 			return rt.wrap(jsHostFunc("print", func(rt *jsrt, this uint64, args []interface{}) interface{} {
-				fmt.Fprint(outWriter, wtf8Clean(ktpLine(rt, args)))
+				fmt.Fprint(rt.sess.out, wtf8Clean(ktpLine(rt, args)))
 				return jsUndef
 			}))
 		}
@@ -1246,18 +1257,18 @@ func init() {
 			// the FIRST argument when the reference is unbound (Kotlin's
 			// KProperty1.get(receiver)). The twin is the __propref arm of mcall in
 			// kotlin-interpreter.abnf.
-			if info, isRef := ktRefOf(recv); isRef {
+			if info, isRef := rt.ktRefOf(recv); isRef {
 				switch mname {
 				case "invoke":
 					return w(rt.ktRefApply(info, arr.elems))
 				case "get":
-					return w(ktRefRead(ktRefRecv(info, arr.elems), info.name))
+					return w(rt.kt.refRead(ktRefRecv(info, arr.elems), info.name))
 				case "set":
 					rest := ktRefRest(info, arr.elems)
-					ktRefWrite(ktRefRecv(info, arr.elems), info.name, argAt(rest, 0))
+					rt.kt.refWrite(ktRefRecv(info, arr.elems), info.name, argAt(rest, 0))
 					return w(jsUndef)
 				case "equals":
-					eq, _ := ktRefEq(recv, argAt(arr.elems, 0))
+					eq, _ := rt.ktRefEq(recv, argAt(arr.elems, 0))
 					return boolH(eq)
 				case "toString":
 					return rt.wrapStr(rt.ktpRender(recv, 0))
@@ -1265,7 +1276,7 @@ func init() {
 				if !info.bound {
 					rt.fail("method .%s() of an unbound callable reference ::%s", mname, info.name)
 				}
-				recv = ktRefRead(info.recv, info.name)
+				recv = rt.kt.refRead(info.recv, info.name)
 			}
 			// A KClass receiver.
 			if co, isCls := ktIsClassLit(recv); isCls {
@@ -1275,7 +1286,7 @@ func init() {
 				case "toString":
 					return rt.wrapStr(rt.ktpRender(recv, 0))
 				case "equals":
-					eq, _ := ktRefEq(recv, argAt(arr.elems, 0))
+					eq, _ := rt.ktRefEq(recv, argAt(arr.elems, 0))
 					return boolH(eq)
 				}
 				rt.fail("method .%s() of a class literal", mname)
@@ -1538,23 +1549,23 @@ func init() {
 		// ----- the global builders and the implicit receiver -----
 
 		// ktMemberCall lets the bound-builtin closures reach the whole method surface.
-		ktMemberCall = func(recv interface{}, name string, args []interface{}) interface{} {
+		rt.kt.memberCall = func(recv interface{}, name string, args []interface{}) interface{} {
 			if args == nil {
 				args = []interface{}{}
 			}
 			return u(m["js_ktsmcall"]([]uint64{w(recv), rt.wrapStr(name), w(&jsArray{elems: args})}))
 		}
-		ktRecvStack = nil
+		rt.kt.recvStack = nil
 		// The reference machinery reaches fields through exactly the externs the
 		// emitted code uses, and its two side tables are per-runtime.
-		ktRefRead = func(recv interface{}, name string) interface{} {
+		rt.kt.refRead = func(recv interface{}, name string) interface{} {
 			return u(m["js_ktfget"]([]uint64{w(recv), rt.wrapStr(name)}))
 		}
-		ktRefWrite = func(recv interface{}, name string, v interface{}) {
+		rt.kt.refWrite = func(recv interface{}, name string, v interface{}) {
 			rt.setMember(recv, name, v)
 		}
-		ktRefs = map[*hostFunc]*ktRefInfo{}
-		ktFuncNames = map[interface{}]string{}
+		rt.kt.refs = map[*hostFunc]*ktRefInfo{}
+		rt.kt.funcNames = map[interface{}]string{}
 
 		// js_ktrefbase(scope, "Box") resolves the BASE of a `::`. A base that names a
 		// value answers that value; one that names a TYPE this value model has no
@@ -1622,7 +1633,7 @@ func init() {
 			for s := sc; s != nil; s = s.parent {
 				if v, ok := s.get(name); ok {
 					if isCallable(v) {
-						ktFuncNames[v] = name
+						rt.kt.funcNames[v] = name
 					}
 					return m["js_ktctorref"]([]uint64{w(v)})
 				}
@@ -1638,7 +1649,7 @@ func init() {
 			}
 			r := m["js_ktget"](a)
 			if isCallable(u(r)) {
-				ktFuncNames[u(r)] = name
+				rt.kt.funcNames[u(r)] = name
 			}
 			return m["js_ktctorref"]([]uint64{r})
 		}
@@ -1675,7 +1686,7 @@ func init() {
 		// straight back. The twin is fnRefName in kotlin-interpreter.abnf.
 		m["js_ktnameval"] = func(a []uint64) uint64 {
 			if isCallable(u(a[0])) {
-				ktFuncNames[u(a[0])] = rt.toString(u(a[1]))
+				rt.kt.funcNames[u(a[0])] = rt.toString(u(a[1]))
 			}
 			return a[0]
 		}
@@ -1886,7 +1897,7 @@ func init() {
 			}
 			where := rt.toString(u(a[1]))
 			if u(a[2]) == float64(1) || u(a[2]) == true {
-				fmt.Fprint(warnWriter, "warning: "+where+": delegated property not implemented (ignored)\n")
+				fmt.Fprint(rt.sess.warn, "warning: "+where+": delegated property not implemented (ignored)\n")
 				return w(jsNull)
 			}
 			rt.fail("delegated property not implemented (%s); use -warn-unsupported to ignore", where)
@@ -2212,8 +2223,8 @@ func init() {
 					break
 				}
 			}
-			for i := len(ktRecvStack) - 1; i >= 0; i-- {
-				if v, ok := rt.ktRecvMember(ktRecvStack[i], name, iscall); ok {
+			for i := len(rt.kt.recvStack) - 1; i >= 0; i-- {
+				if v, ok := rt.ktRecvMember(rt.kt.recvStack[i], name, iscall); ok {
 					if rt.traced {
 						rt.trVar("read", name, v)
 					}
@@ -2248,20 +2259,20 @@ func init() {
 			}
 			// A callable reference: KCallable.name. The twin is the __propref arm of
 			// kGetField in kotlin-interpreter.abnf.
-			if info, isRef := ktRefOf(o); isRef {
+			if info, isRef := rt.ktRefOf(o); isRef {
 				if name == "name" {
 					return rt.wrapStr(info.name)
 				}
 				if !info.bound {
 					rt.fail("member .%s of an unbound callable reference ::%s", name, info.name)
 				}
-				return w(ktRefRead(info.recv, info.name))
+				return w(rt.kt.refRead(info.recv, info.name))
 			}
 			// ::topLevelFun is the closure itself, and KFunction.name is the name the
 			// reference site spelled - recorded by js_ktnameval, since a closure
 			// carries none of its own.
 			if isCallable(o) && name == "name" {
-				if n, has := ktFuncNames[o]; has {
+				if n, has := rt.kt.funcNames[o]; has {
 					return rt.wrapStr(n)
 				}
 			}
@@ -3083,7 +3094,7 @@ func (rt *jsrt) ktpRender(v interface{}, depth int) string {
 		// without the reflection library on the class path it prints "property v
 		// (Kotlin reflection is not available)". Neither is reproducible here, so
 		// both halves agree on the short form - a deliberate, recorded divergence.
-		if info, isRef := ktRefOf(t); isRef {
+		if info, isRef := rt.ktRefOf(t); isRef {
 			return "reference " + info.name
 		}
 	case *jsObject:
@@ -4416,7 +4427,7 @@ func (rt *jsrt) ktSeqMethod(o *jsArray, name string, args []interface{}) (interf
 		}
 		out := []interface{}{}
 		for _, e := range es {
-			if ktIsType != nil && ktIsType(e, want) {
+			if rt.kt.isType != nil && rt.kt.isType(e, want) {
 				out = append(out, e)
 			}
 		}
@@ -5150,8 +5161,8 @@ func ktKeyLess(rt *jsrt, a, b interface{}) bool {
 	// compareTo, exactly as `V(1) < V(2)` already did through js_ktcmp. Without this
 	// every element compared as giFloat(...) = NaN, no pair was ever "less", and the
 	// list came back in its original order - silently, in BOTH halves.
-	if ao, isObj := a.(*jsObject); isObj && ktMemberCall != nil && ktClassChainHas(ao, "compareTo") {
-		return rt.toNumber(ktMemberCall(a, "compareTo", []interface{}{b})) < 0
+	if ao, isObj := a.(*jsObject); isObj && rt.kt.memberCall != nil && ktClassChainHas(ao, "compareTo") {
+		return rt.toNumber(rt.kt.memberCall(a, "compareTo", []interface{}{b})) < 0
 	}
 	return giFloat(rt, a) < giFloat(rt, b)
 }
@@ -5358,7 +5369,7 @@ func (rt *jsrt) ktMapMethod(m *jsObject, name string, args []interface{}) (inter
 // member surface already lives above (ktMapMethod, ktPairMethod, ktSbMethod), so
 // the declaration is the whole port.
 //
-// ktRecvStack is the receiver channel. Kotlin's with / run / apply bind their
+// ktState.recvStack is the receiver channel. Kotlin's with / run / apply bind their
 // receiver as `this`, so an unqualified `size` or `append("a")` inside the lambda
 // is a member call on it. The compiler's lambda is a bare IR closure with no
 // receiver slot, so the builder pushes the receiver here for the duration of the
@@ -5366,16 +5377,13 @@ func (rt *jsrt) ktMapMethod(m *jsObject, name string, args []interface{}) (inter
 // which means it can only ever turn "unknown name" into a member read, never
 // change a name that already resolved. The twin is kSetRecv / recvLookup in
 // kotlin-interpreter.abnf.
-var ktRecvStack []interface{}
-
-// ktMemberCall is js_ktsmcall as a plain Go call, installed by the registrar so the
+//
+// ktState.memberCall is js_ktsmcall as a plain Go call, installed by the registrar so the
 // bound-builtin closures below reach the full method surface (including the Regex
 // and shared js_mcall tails) without duplicating its dispatch.
-var ktMemberCall func(recv interface{}, name string, args []interface{}) interface{}
-
-// ktIsType is js_ktis as a plain Go call - the `x is T` test - installed by the
+//
+// ktState.isType is js_ktis as a plain Go call - the `x is T` test - installed by the
 // registrar so filterIsInstance answers exactly what an `is` branch would.
-var ktIsType func(v interface{}, tname string) bool
 
 // ktRecvProps are the names Kotlin declares as PROPERTIES on a builtin receiver;
 // everything else resolves to a bound method, so a lookup never turns a property
@@ -5899,7 +5907,7 @@ func (rt *jsrt) ktRecvMember(recv interface{}, name string, iscall bool) (interf
 	// properties; its METHODS live on the descriptor chain and come back as a bound
 	// callable, so an unqualified `method()` inside the lambda dispatches on the
 	// receiver. recvLookup in kotlin-interpreter.abnf answers exactly this set.
-	if o, isObj := recv.(*jsObject); isObj && ktMemberCall != nil {
+	if o, isObj := recv.(*jsObject); isObj && rt.kt.memberCall != nil {
 		if _, hasCls := o.props["__class"]; hasCls {
 			if v, ok := o.props[name]; ok {
 				return v, true
@@ -5917,13 +5925,13 @@ func (rt *jsrt) ktRecvMember(recv interface{}, name string, iscall bool) (interf
 			if ktClassChainHas(o, name) {
 				self := recv
 				return jsHostFunc(name, func(rt *jsrt, this uint64, args []interface{}) interface{} {
-					return ktMemberCall(self, name, args)
+					return rt.kt.memberCall(self, name, args)
 				}), true
 			}
 			return nil, false
 		}
 	}
-	if !ktIsBuiltinRecv(recv) || ktMemberCall == nil {
+	if !ktIsBuiltinRecv(recv) || rt.kt.memberCall == nil {
 		// A PLAIN OBJECT receiver that is neither a class instance nor one of the
 		// collection kinds: a Pair, a Triple, a Map.Entry, a lazy, a Result, a
 		// MatchResult. Kotlin's `with` binds any receiver at all, and every one of
@@ -5935,7 +5943,7 @@ func (rt *jsrt) ktRecvMember(recv interface{}, name string, iscall bool) (interf
 		// so the three engines agree by construction rather than by coincidence.
 		// Nothing is bound as a METHOD here: a plain object has no runtime method
 		// table to dispatch into, and binding one would swallow every global name.
-		if o, isObj := recv.(*jsObject); isObj && ktMemberCall != nil {
+		if o, isObj := recv.(*jsObject); isObj && rt.kt.memberCall != nil {
 			if _, isClsDesc := o.props["__isclass"]; !isClsDesc {
 				if v, ok := o.props[name]; ok {
 					return v, true
@@ -5944,8 +5952,8 @@ func (rt *jsrt) ktRecvMember(recv interface{}, name string, iscall bool) (interf
 				// (kt_fprobe in kotlin-to-llvm-ir.abnf carries the same guard).
 				_, isClsLit := ktIsClassLit(o)
 				_, isPkg := ktIsPkg(o)
-				if (ktRecvProp(name) || !iscall) && ktRefRead != nil && !isClsLit && !isPkg {
-					if v := ktRefRead(recv, name); !isUndefOrNull(v) {
+				if (ktRecvProp(name) || !iscall) && rt.kt.refRead != nil && !isClsLit && !isPkg {
+					if v := rt.kt.refRead(recv, name); !isUndefOrNull(v) {
 						return v, true
 					}
 				}
@@ -5957,10 +5965,10 @@ func (rt *jsrt) ktRecvMember(recv interface{}, name string, iscall bool) (interf
 		// aborted with
 		// "unknown name: toString" here (todo.md 1.10); js_ktsmcall's own Any arm
 		// answers it once the name resolves at all.
-		if (name == "toString" || name == "hashCode" || name == "equals") && iscall && ktMemberCall != nil {
+		if (name == "toString" || name == "hashCode" || name == "equals") && iscall && rt.kt.memberCall != nil {
 			self := recv
 			return jsHostFunc(name, func(rt *jsrt, this uint64, args []interface{}) interface{} {
-				return ktMemberCall(self, name, args)
+				return rt.kt.memberCall(self, name, args)
 			}), true
 		}
 		return nil, false
@@ -5972,21 +5980,21 @@ func (rt *jsrt) ktRecvMember(recv interface{}, name string, iscall bool) (interf
 	// 'lastIndex'" - and `indices` would have, once it existed. The twin has always
 	// read kGetField here (kRecvProps in kotlin-interpreter.abnf), so this is the Go
 	// side catching up rather than a new rule.
-	if ktRecvProp(name) && ktRefRead != nil {
-		return ktRefRead(recv, name), true
+	if ktRecvProp(name) && rt.kt.refRead != nil {
+		return rt.kt.refRead(recv, name), true
 	}
 	// VALUE POSITION on a builtin receiver: the field read is TRIED, and only a miss
 	// falls through to the bound method below - which is where every name that is not
 	// a property of this receiver still lands, so nothing that resolved stops
 	// resolving. This is the arm that answers `with(1..7 step 2) { first }`.
-	if !iscall && ktRefRead != nil {
-		if v := ktRefRead(recv, name); !isUndefOrNull(v) {
+	if !iscall && rt.kt.refRead != nil {
+		if v := rt.kt.refRead(recv, name); !isUndefOrNull(v) {
 			return v, true
 		}
 	}
 	self := recv
 	return jsHostFunc(name, func(rt *jsrt, this uint64, args []interface{}) interface{} {
-		return ktMemberCall(self, name, args)
+		return rt.kt.memberCall(self, name, args)
 	}), true
 }
 
@@ -6142,8 +6150,8 @@ func (rt *jsrt) ktWithRecv(recv interface{}, f interface{}, args ...interface{})
 	if !isCallable(f) {
 		return jsUndef
 	}
-	ktRecvStack = append(ktRecvStack, recv)
-	defer func() { ktRecvStack = ktRecvStack[:len(ktRecvStack)-1] }()
+	rt.kt.recvStack = append(rt.kt.recvStack, recv)
+	defer func() { rt.kt.recvStack = rt.kt.recvStack[:len(rt.kt.recvStack)-1] }()
 	if cl, ok := f.(*jsClosure); ok {
 		inner := &jsScope{parent: rt.scopeOf(cl.env)}
 		inner.put("this", recv)
@@ -6580,7 +6588,7 @@ func ktGlobalFn(rt *jsrt, name string) interface{} {
 			// silently truncated list. take(n) on an infinite generator still gets
 			// the right answer - it just paid for 100000 elements to get there.
 			if guard >= ktSeqCap {
-				fmt.Fprint(warnWriter, "warning: generateSequence is EAGER here and stopped at "+
+				fmt.Fprint(rt.sess.warn, "warning: generateSequence is EAGER here and stopped at "+
 					strconv.Itoa(ktSeqCap)+" elements; a Sequence is not lazy in this subset\n")
 			}
 			return out
@@ -6695,7 +6703,7 @@ func ktCmpKeys(rt *jsrt, a, b interface{}, desc bool) int {
 // js_try catches. The twin is kRaise in kotlin-interpreter.abnf.
 func (rt *jsrt) ktRaise(cls, msg string) {
 	o := newJSObject()
-	o.set("__class", ktExcHierarchy()[cls])
+	o.set("__class", rt.ktExcHierarchy()[cls])
 	o.set("message", msg)
 	panic(&jsThrown{value: o})
 }
@@ -6884,15 +6892,12 @@ type ktRefInfo struct {
 // makePropRef in the interpreter half.
 type ktTypeName struct{ name string }
 
-var ktRefs map[*hostFunc]*ktRefInfo
-var ktFuncNames map[interface{}]string
-
-func ktRefOf(v interface{}) (*ktRefInfo, bool) {
+func (rt *jsrt) ktRefOf(v interface{}) (*ktRefInfo, bool) {
 	hf, ok := v.(*hostFunc)
-	if !ok || ktRefs == nil {
+	if !ok || rt.kt.refs == nil {
 		return nil, false
 	}
-	info, has := ktRefs[hf]
+	info, has := rt.kt.refs[hf]
 	return info, has
 }
 
@@ -6904,10 +6909,10 @@ func (rt *jsrt) ktMakeRef(info *ktRefInfo) interface{} {
 	hf.fn = func(r *jsrt, this uint64, args []interface{}) interface{} {
 		return r.ktRefApply(info, args)
 	}
-	if ktRefs == nil {
-		ktRefs = map[*hostFunc]*ktRefInfo{}
+	if rt.kt.refs == nil {
+		rt.kt.refs = map[*hostFunc]*ktRefInfo{}
 	}
-	ktRefs[hf] = info
+	rt.kt.refs[hf] = info
 	return hf
 }
 
@@ -6935,25 +6940,23 @@ func (rt *jsrt) ktRefApply(info *ktRefInfo, args []interface{}) interface{} {
 	recv := ktRefRecv(info, args)
 	if o, isObj := recv.(*jsObject); isObj {
 		if ktClassChainHas(o, info.name) {
-			return ktMemberCall(recv, info.name, ktRefRest(info, args))
+			return rt.kt.memberCall(recv, info.name, ktRefRest(info, args))
 		}
 		// A member the receiver really HAS wins over a same-named extension, which is
 		// Kotlin's rule for the call too.
 		if _, own := o.props[info.name]; own {
-			return ktRefRead(recv, info.name)
+			return rt.kt.refRead(recv, info.name)
 		}
 	}
 	if info.ext != nil {
 		return rt.call(info.ext, jsUndef, append([]interface{}{recv}, ktRefRest(info, args)...))
 	}
-	return ktRefRead(recv, info.name)
+	return rt.kt.refRead(recv, info.name)
 }
 
-// ktRefRead / ktRefWrite are KProperty.get and KProperty.set: the property READ and
+// ktState.refRead / refWrite are KProperty.get and KProperty.set: the property READ and
 // WRITE, never the method. They are installed by the registrar so the reference code
 // reaches exactly the field paths the emitted code uses (js_ktfget / js_set).
-var ktRefRead func(recv interface{}, name string) interface{}
-var ktRefWrite func(recv interface{}, name string, v interface{})
 
 // ktConstruct runs a class descriptor's constructor - what `::Box.invoke(7)` and
 // `list.map(::Box)` do. It is the runtime twin of the emitted `new` sequence.
@@ -7028,9 +7031,9 @@ func ktIsClassLit(v interface{}) (*jsObject, bool) {
 // are equal when they name the same member of the same receiver (`b::v == b::v` is
 // true), and two class literals when they name the same class. Answers handled=false
 // for anything that is not one of the two.
-func ktRefEq(l, r interface{}) (bool, bool) {
-	li, lIsRef := ktRefOf(l)
-	ri, rIsRef := ktRefOf(r)
+func (rt *jsrt) ktRefEq(l, r interface{}) (bool, bool) {
+	li, lIsRef := rt.ktRefOf(l)
+	ri, rIsRef := rt.ktRefOf(r)
 	if lIsRef || rIsRef {
 		if !lIsRef || !rIsRef {
 			return false, true
@@ -733,12 +733,10 @@ func (rt *jsrt) phpNeg(v interface{}) interface{} {
 // DivisionByZeroError). The class descriptors live in the emitted module, not
 // here, so phpmain hands its scope over once through js_phrtinit and the raise
 // looks the class up there; without one (an imported fragment, a unit test) the
-// error stays the fatal it was.
-var phpMainScope = map[*jsrt]uint64{}
-
+// error stays the fatal it was. The scope is rt.phpMainScope (0 = none handed over).
 func (rt *jsrt) phpRaise(clsName, msg string) {
-	h, has := phpMainScope[rt]
-	if !has {
+	h := rt.phpMainScope
+	if h == 0 {
 		rt.fail("%s", msg)
 	}
 	// TWO shapes, because layer 2 cannot open a scope (WALL 3 of
@@ -1636,13 +1634,11 @@ func phpIsHole(v interface{}) bool {
 
 // phpDumpIds hands out var_dump's object handles (#1, #2, ...) on first sight,
 // which is enough for a single run's transcript to be stable.
-var phpDumpIds = map[*jsrt]map[*jsObject]int{}
-
 func (rt *jsrt) phpDumpID(o *jsObject) int {
-	m, has := phpDumpIds[rt]
-	if !has {
+	m := rt.phpDumpIds
+	if m == nil {
 		m = map[*jsObject]int{}
-		phpDumpIds[rt] = m
+		rt.phpDumpIds = m
 	}
 	if id, seen := m[o]; seen {
 		return id
@@ -1815,7 +1811,7 @@ func init() {
 		// phpmain hands its scope over once, so phpRaise can find the emitted
 		// DivisionByZeroError / ArithmeticError descriptors.
 		m["js_phrtinit"] = func(a []uint64) uint64 {
-			phpMainScope[rt] = a[0]
+			rt.phpMainScope = a[0]
 			return 0
 		}
 		// The four that REPLACE a jsrt.go entry: each of them was 32 bit or
@@ -25,7 +25,10 @@ package abnf
 // Positions are RUNE indices, matching the JS side's UTF-16 indices for everything
 // in the Basic Multilingual Plane (and therefore for every ASCII pattern).
 
-import "strings"
+import (
+	"strings"
+	"sync"
+)
 
 // ----- Instruction opcodes (see lib/regex.js) -----
 const (
@@ -1610,16 +1613,25 @@ func (re *rxRe) expand(text []rune, m *rxMatch, repl string) string {
 
 // rxCache remembers one compiled program per (flags, source). A literal inside a
 // loop is compiled once even though the emitted IR hands the pattern over as a
-// plain string on every call.
-var rxCache = map[string]*rxRe{}
+// plain string on every call. A compiled program is never changed, so the cache
+// serves every runtime, and every Session.
+var (
+	rxCacheMu sync.Mutex
+	rxCache   = map[string]*rxRe{}
+)
 
 func rxGet(pattern, flags string) *rxRe {
 	key := flags + "\x00" + pattern
-	if re, ok := rxCache[key]; ok {
+	rxCacheMu.Lock()
+	re, ok := rxCache[key]
+	rxCacheMu.Unlock()
+	if ok {
 		return re
 	}
-	re := rxCompile(pattern, flags)
+	re = rxCompile(pattern, flags)
+	rxCacheMu.Lock()
 	rxCache[key] = re
+	rxCacheMu.Unlock()
 	return re
 }
 
@@ -83,7 +83,7 @@ func init() {
 				}
 				out += rt.swDesc(e)
 			}
-			fmt.Fprint(outWriter, wtf8Clean(out+term))
+			fmt.Fprint(rt.sess.out, wtf8Clean(out+term))
 			return 0
 		}
 
@@ -39,7 +39,7 @@ import (
 // unsigned, like C, and it has no opinion about the arena.
 func TestLibcNative(t *testing.T) {
 	// A fresh machine per case, so a bump allocation in one cannot reach the next.
-	newMa := func() *machine { return newMachine(ir.NewModule(), "") }
+	newMa := func() *machine { return newMachine(defaultSession(), ir.NewModule(), "") }
 	put := func(ma *machine, s string) uint64 {
 		a := ma.alloc(uint64(len(s)) + 1)
 		copy(ma.mem[a:], s)
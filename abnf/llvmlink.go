@@ -2,7 +2,6 @@ package abnf
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/llir/llvm/asm"
@@ -77,9 +76,9 @@ func (ma *machine) linkRuntimeModules(m *ir.Module, paths []string) {
 		if !strings.HasSuffix(p, ".ll") {
 			continue
 		}
-		data, err := os.ReadFile(p)
+		data, err := ma.sess.readHostFile(p)
 		if err != nil {
-			panic("llvm.Run(): cannot read the runtime module " + p + ": " + err.Error())
+			panic(hostFileError("llvm.Run(): cannot read the runtime module "+p, err))
 		}
 		rm, err := asm.ParseString(p, string(data))
 		if err != nil {
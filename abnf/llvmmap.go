@@ -3,6 +3,7 @@ package abnf
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"os/exec"
@@ -228,13 +229,7 @@ var llvmFuncMap = map[string]r.Object{ // The LLVM functions.
 		"NewXor":            ir.NewXor,
 		"NewZExt":           ir.NewZExt,
 		"NewLocalIdent":     ir.NewLocalIdent,
-		// Wrapped so the call graph can attribute each function to its own
-		// source file: record the module being built (see beginCompileModule).
-		"NewModule": func() *ir.Module {
-			m := ir.NewModule()
-			beginCompileModule(m)
-			return m
-		},
+		// NewModule is added per session, see Session.llvmFuncs.
 		"NewOperandBundle": ir.NewOperandBundle,
 		"NewParam":         ir.NewParam,
 		"NewBr":            ir.NewBr,
@@ -981,18 +976,56 @@ var llvmFuncMap = map[string]r.Object{ // The LLVM functions.
 	},
 
 	"Callgraph": callgraph,
+	// Eval, Run, RunJS and BuildExecutable are added per session, see
+	// Session.llvmFuncs.
+}
+
+// llvmFuncs returns the llvm object of this session's scripts: llvmFuncMap plus
+// the functions that run or build a module, which use the session's options and
+// writers.
+func (s *Session) llvmFuncs() map[string]r.Object {
+	if s.llvm != nil {
+		return s.llvm
+	}
+	funcs := make(map[string]r.Object, len(llvmFuncMap)+4)
+	for k, v := range llvmFuncMap {
+		funcs[k] = v
+	}
+	irFuncs := map[string]r.Object{}
+	for k, v := range llvmFuncMap["ir"].(map[string]r.Object) {
+		irFuncs[k] = v
+	}
+	// Wrapped so the call graph can attribute each function to its own
+	// source file: record the module being built (see beginCompileModule).
+	irFuncs["NewModule"] = func() *ir.Module {
+		m := ir.NewModule()
+		s.beginCompileModule(m)
+		return m
+	}
+	funcs["ir"] = irFuncs
 	// Eval executes the named function and returns its result (kept for compatibility).
-	"Eval": func(m *ir.Module, start string) uint32 {
-		return run(m, start, "").Ret
-	},
+	funcs["Eval"] = func(m *ir.Module, start string) uint32 {
+		return s.run(m, start, "").Ret
+	}
 	// Run executes the named function with the given stdin content for getchar() and
-	// returns {Ret, Out}. The input parameter can be left out.
-	"Run": run,
+	// returns {Ret, Out}. The input parameter can be left out: getchar() then reads
+	// the program's own input (Engine.Stdin, -stdin); undefined does the same, for a
+	// call that passes the runtime list behind it. An explicit "" is no input.
+	funcs["Run"] = func(m *ir.Module, start string, input interface{}, runtime ...string) *RunResult {
+		text, ok := input.(string)
+		if !ok {
+			text = s.Stdin
+		}
+		return s.run(m, start, text, runtime...)
+	}
 	// RunJS executes a MetaJS module (IR emitted by metajs-to-llvm-ir.abnf, where every
 	// value is an i64 handle and the js_* externals implement the semantics). The
 	// named function is the module entry (usually "jsmain"); its i64 handle result
 	// is converted to an int32 and returned as Ret.
-	"RunJS": runJSModule,
+	funcs["RunJS"] = s.runJSModule
+	// RunJSLine runs one more module in the runtime of the last RunJS program,
+	// with that program's top-level scope as env: a -repl line (repl.go).
+	funcs["RunJSLine"] = s.runJSLine
 	// BuildExecutable writes the module as textual LLVM IR to a temp file and invokes
 	// clang to link a native executable at outPath. Returns "" on success or a
 	// human-readable error string. Driven by the -exe flag (c.exePath) from a compiler
@@ -1002,7 +1035,9 @@ var llvmFuncMap = map[string]r.Object{ // The LLVM functions.
 	// with the module (.c/.ll/.o/.a). It is merged with the -rt flag (c.runtime), and
 	// -L/-l reach clang too. Supplying any of them switches OFF the zero-stubbing of
 	// undefined symbols - see buildExecutable.
-	"BuildExecutable": buildExecutable,
+	funcs["BuildExecutable"] = s.buildExecutable
+	s.llvm = funcs
+	return funcs
 }
 
 // libcExterns are the external functions clang resolves from the real C runtime, so
@@ -1111,12 +1146,12 @@ func undefinedSymbols(m *ir.Module) []string {
 // It is skipped entirely when the build links a runtime (see buildExecutable): there
 // the same symbol is a genuine link error, and papering over it with a zero would
 // reintroduce the malloc-returns-null failure class phase 0 removed.
-func stubUndefined(m *ir.Module) {
+func stubUndefined(m *ir.Module, warn io.Writer) {
 	for _, f := range m.Funcs {
 		if len(f.Blocks) > 0 || libcExterns[f.Name()] {
 			continue
 		}
-		fmt.Fprintln(warnWriter, "warning: no definition for "+f.Name()+
+		fmt.Fprintln(warn, "warning: no definition for "+f.Name()+
 			"; linking a stub that returns zero, so a call to it answers 0/null")
 		blk := f.NewBlock("")
 		switch rt := f.Sig.RetType.(type) {
@@ -1136,10 +1171,10 @@ func stubUndefined(m *ir.Module) {
 // to llvm.BuildExecutable, then what -rt added, in that order and without duplicates.
 // Both sources compose on purpose - a grammar that knows where its own runtime lives
 // should not stop a user from adding a second object file to the same link.
-func linkInputs(fromGrammar []string) []string {
+func linkInputs(fromGrammar, fromFlag []string) []string {
 	seen := map[string]bool{}
 	var out []string
-	for _, list := range [][]string{fromGrammar, RuntimeInputs} {
+	for _, list := range [][]string{fromGrammar, fromFlag} {
 		for _, p := range list {
 			if p == "" || seen[p] {
 				continue
@@ -1312,11 +1347,21 @@ func rdynamicFlags() []string {
 	}
 }
 
-func buildExecutable(m *ir.Module, outPath string, runtime []string) string {
-	inputs := linkInputs(runtime)
-	linkingForReal := len(inputs) > 0 || len(LinkLibs) > 0
+func (s *Session) buildExecutable(m *ir.Module, outPath string, runtime []string) string {
+	inputs := linkInputs(runtime, s.RuntimeInputs)
+	if s.sandbox != nil {
+		// The files first, so a build that reaches out of the allowed
+		// directories is named as that; then clang itself, which the sandbox
+		// never runs.
+		s.sandboxAccess(outPath)
+		for _, p := range inputs {
+			s.sandboxAccess(p)
+		}
+		panic(&SandboxError{"llvm.BuildExecutable would run clang, and the sandbox runs no other programs"})
+	}
+	linkingForReal := len(inputs) > 0 || len(s.LinkLibs) > 0
 	if !linkingForReal {
-		stubUndefined(m)
+		stubUndefined(m, s.warn)
 	}
 	tmp, err := os.CreateTemp("", "mec-*.ll")
 	if err != nil {
@@ -1345,10 +1390,10 @@ func buildExecutable(m *ir.Module, outPath string, runtime []string) string {
 	args := []string{"-Wno-override-module", "-O2", "-o", outPath, tmpName}
 	args = append(args, rdynamicFlags()...)
 	args = append(args, inputs...)
-	for _, d := range LinkDirs {
+	for _, d := range s.LinkDirs {
 		args = append(args, "-L"+d)
 	}
-	for _, l := range LinkLibs {
+	for _, l := range s.LinkLibs {
 		args = append(args, "-l"+l)
 	}
 	out, err := exec.Command(clangBin, args...).CombinedOutput()
@@ -1358,12 +1403,12 @@ func buildExecutable(m *ir.Module, outPath string, runtime []string) string {
 		// duplicateSymbols), so asking it second would let a duplicate keep being
 		// announced as its own opposite.
 		if dup := duplicateSymbols(string(out)); len(dup) > 0 {
-			fmt.Fprintf(warnWriter, "error: %d symbol(s) are defined MORE THAN ONCE"+
+			fmt.Fprintf(s.warn, "error: %d symbol(s) are defined MORE THAN ONCE"+
 				" among the linked inputs:\n", len(dup))
 			for _, name := range dup {
-				fmt.Fprintln(warnWriter, "error:     "+name)
+				fmt.Fprintln(s.warn, "error:     "+name)
 			}
-			fmt.Fprintln(warnWriter, "error: each name above is defined by two or more of the emitted module and the"+
+			fmt.Fprintln(s.warn, "error: each name above is defined by two or more of the emitted module and the"+
 				"\nerror: linked inputs (c.runtime / -rt, -L, -l). Remove one definition; this is NOT"+
 				"\nerror: an unresolved symbol, and adding a definition would make it worse.")
 			return "clang could not link the executable: " + strconv.Itoa(len(dup)) +
@@ -1377,12 +1422,12 @@ func buildExecutable(m *ir.Module, outPath string, runtime []string) string {
 				}
 			}
 			if len(missing) > 0 {
-				fmt.Fprintf(warnWriter, "error: %d unresolved symbol(s), and this build links a runtime,"+
+				fmt.Fprintf(s.warn, "error: %d unresolved symbol(s), and this build links a runtime,"+
 					" so they are NOT stubbed:\n", len(missing))
 				for _, name := range missing {
-					fmt.Fprintln(warnWriter, "error:     "+name)
+					fmt.Fprintln(s.warn, "error:     "+name)
 				}
-				fmt.Fprintln(warnWriter, "error: each name above is declared by the emitted module and defined by"+
+				fmt.Fprintln(s.warn, "error: each name above is declared by the emitted module and defined by"+
 					" neither the module\nerror: nor any linked input (c.runtime / -rt, -L, -l). Implement it in the"+
 					" runtime;\nerror: a stub would answer 0/null at run time instead of failing here.")
 				return "clang could not link the executable: " + strconv.Itoa(len(missing)) +
@@ -1448,17 +1493,13 @@ type RunResult struct {
 
 // machineMaxStepsDefault is the emergency brake against endless loops: the number
 // of IR instructions ONE top-level call may execute before the interpreter gives
-// up. MaxIRSteps carries the effective value (the -max-steps flag writes it), so a
-// legitimately long running program can raise it instead of dying at 1e8.
+// up. Engine.MaxIRSteps carries the effective value (the -max-steps flag writes it),
+// so a legitimately long running program can raise it instead of dying at 1e8.
 const machineMaxStepsDefault = 100000000
 
-// MaxIRSteps is the step budget of one top-level IR call, set from the -max-steps
-// CLI flag. 0 means "no limit"; newMachine() turns that into a budget nothing can
-// reach, so the check in run() stays a single comparison.
-var MaxIRSteps = machineMaxStepsDefault
-
 // machine holds the state of one IR program run.
 type machine struct {
+	sess     *Session              // The session the machine runs in: its options and writers.
 	mem      []byte                // One flat memory arena for globals and allocas. Offset 0 is reserved as null.
 	globals  map[*ir.Global]uint64 // The memory offset of every global.
 	funcs    map[string]*ir.Func   // All module functions by name (for host initiated calls).
@@ -1466,7 +1507,8 @@ type machine struct {
 	inPos    int
 	out      strings.Builder // The stdout content written by putchar() / puts().
 	steps    int             // The instruction budget of the CURRENT top-level call (reset at depth 0).
-	maxSteps int             // The budget's limit, from MaxIRSteps when the machine was made.
+	maxSteps int             // The budget's limit, from Engine.MaxIRSteps when the machine was made.
+	brake    int             // The step count of the next stop: maxSteps, or a sandbox check before it.
 	depth    int             // The call nesting inside this machine, for the steps reset.
 
 	// externs resolves calls to declared functions before the built-in ones
@@ -1500,6 +1542,11 @@ type machine struct {
 	// free() is a no-op here on purpose: the arena never reuses memory, so freeing
 	// cannot produce a dangling reuse that the native binary would not also produce.
 	heapSize map[uint64]uint64
+
+	// sandbox is the session's (sandbox.go), nil without one; maxMem is the
+	// arena's ceiling under it, 0 for none.
+	sandbox *sandboxRun
+	maxMem  uint64
 }
 
 // funcLayout is the decoded program of one function: every value the function
@@ -2006,19 +2053,43 @@ func (ma *machine) releaseFrame(fr *frame) {
 	ma.framePool = append(ma.framePool, fr)
 }
 
-// stepLimitMsg names the safety valve that just tripped. The limit is not a
-// property of the program, so the message says what it is and how to lift it -
-// a long but finite run used to abort with a text that read like a grammar bug.
-func (ma *machine) stepLimitMsg() string {
+// StepLimitError is the error of an IR call that ran more than Engine.MaxIRSteps
+// instructions. The limit is not a property of the program, so the message says
+// what it is and how to lift it - a long but finite run used to abort with a
+// text that read like a grammar bug.
+type StepLimitError struct {
+	Steps int // The limit that was exceeded.
+}
+
+func (e *StepLimitError) Error() string {
 	return fmt.Sprintf("IR interpreter: step limit exceeded - one call ran more than %d instructions.\n"+
 		"This is a safety valve against endless loops, not a limit of the language: if the program\n"+
-		"legitimately runs that long, raise it with -max-steps N (or -max-steps 0 for no limit).", ma.maxSteps)
+		"legitimately runs that long, raise it with -max-steps N (or -max-steps 0 for no limit).", e.Steps)
+}
+
+// stop is where the step loop brakes: at the step limit, or at a poll of the
+// sandbox's watchdog on the way to it.
+func (ma *machine) stop() {
+	if ma.steps > ma.maxSteps {
+		panic(&StepLimitError{Steps: ma.maxSteps})
+	}
+	ma.sandbox.check()
+	ma.brake = ma.nextBrake()
+}
+
+// nextBrake is the step count of the next poll of the sandbox.
+func (ma *machine) nextBrake() int {
+	if ma.maxSteps-ma.steps <= sandboxCheckSteps {
+		return ma.maxSteps
+	}
+	return ma.steps + sandboxCheckSteps
 }
 
 // newMachine loads a module into a fresh machine: it allocates and initializes
 // the globals and indexes the functions.
-func newMachine(m *ir.Module, input string) *machine {
+func newMachine(s *Session, m *ir.Module, input string) *machine {
 	ma := &machine{
+		sess:        s,
 		mem:         make([]byte, 8), // Offset 0 stays unused, so 0 can act as null pointer.
 		globals:     map[*ir.Global]uint64{},
 		funcs:       map[string]*ir.Func{},
@@ -2027,11 +2098,17 @@ func newMachine(m *ir.Module, input string) *machine {
 		sizes:       map[types.Type]uint64{},
 		fieldOffs:   map[*types.StructType][]uint64{},
 		input:       []byte(input),
-		maxSteps:    MaxIRSteps,
+		maxSteps:    s.MaxIRSteps,
 	}
 	if ma.maxSteps <= 0 { // -max-steps 0: no limit, expressed as one nothing can reach.
 		ma.maxSteps = math.MaxInt64
 	}
+	if s.sandbox != nil {
+		ma.sandbox = s.sandbox
+		if s.Sandbox.MaxMemory > 0 {
+			ma.maxMem = uint64(s.Sandbox.MaxMemory)
+		}
+	}
 	for _, g := range m.Globals {
 		off := ma.alloc(ma.sizeOf(g.ContentType))
 		ma.globals[g] = off
@@ -2062,10 +2139,11 @@ func (ma *machine) callByName(name string, args []uint64) uint64 {
 // language whose runtime lives in a separately compiled module (lib/batch-rt.ll)
 // answers identically under the interpreter and as a clang-built binary. See
 // abnf/llvmlink.go.
-func run(m *ir.Module, start string, input string, runtime ...string) *RunResult {
-	maybeDumpCFG(m)
-	maybeDumpCallgraph(m)
-	ma := newMachine(m, input)
+func (s *Session) run(m *ir.Module, start string, input string, runtime ...string) *RunResult {
+	s.maybeDumpCFG(m)
+	s.maybeDumpCallgraph(m)
+	s.maybeDumpIR(m)
+	ma := newMachine(s, m, input)
 	if len(runtime) > 0 {
 		ma.linkRuntimeModules(m, runtime)
 	}
@@ -2073,15 +2151,41 @@ func run(m *ir.Module, start string, input string, runtime ...string) *RunResult
 	if !ok {
 		panic("llvm.Run(): function not found in module: " + start)
 	}
-	// The start function is called with zero values for all of its parameters
-	// (e.g. a main(int argc) still runs).
-	ret := ma.call(f, make([]uint64, len(f.Params)))
+	ret := ma.call(f, ma.entryArgs(f))
 	return &RunResult{Ret: uint32(ret), Out: ma.out.String()}
 }
 
+// entryArgs are the arguments the start function is called with. A start function
+// shaped like main(int argc, char **argv) gets the program's command line: the
+// program's file name, then Engine.Args, as NUL-terminated strings behind a
+// null-terminated pointer array. Every other parameter is zero (e.g. a main(int
+// argc) alone still runs, with argc 0).
+func (ma *machine) entryArgs(f *ir.Func) []uint64 {
+	args := make([]uint64, len(f.Params))
+	if len(f.Params) < 2 {
+		return args
+	}
+	if _, ok := f.Params[0].Typ.(*types.IntType); !ok {
+		return args
+	}
+	if _, ok := f.Params[1].Typ.(*types.PointerType); !ok {
+		return args
+	}
+	argv := append([]string{ma.sess.src.name}, ma.sess.Args...)
+	vec := ma.alloc(uint64(len(argv)+1) * 8)
+	for i, a := range argv {
+		ma.store(vec+uint64(i)*8, rxPtrCopyStr(ma, a), 8)
+	}
+	args[0], args[1] = uint64(len(argv)), vec
+	return args
+}
+
 // alloc reserves size bytes of zeroed memory and returns their offset.
 func (ma *machine) alloc(size uint64) uint64 {
 	off := uint64(len(ma.mem))
+	if ma.maxMem != 0 && off+size > ma.maxMem {
+		panic(&SandboxError{fmt.Sprintf("the program's memory would grow past %d bytes", ma.maxMem)})
+	}
 	ma.mem = append(ma.mem, make([]byte, size)...)
 	return off
 }
@@ -2325,6 +2429,11 @@ func (ma *machine) call(f *ir.Func, args []uint64) uint64 {
 	ma.depth++
 	if ma.depth == 1 {
 		ma.steps = 0
+		ma.brake = ma.maxSteps
+		if ma.sandbox != nil {
+			ma.sandbox.check()
+			ma.brake = ma.nextBrake()
+		}
 	}
 	defer func() {
 		ma.depth--
@@ -2352,8 +2461,8 @@ func (ma *machine) call(f *ir.Func, args []uint64) uint64 {
 			}
 			for i := range b.phis {
 				ma.steps++
-				if ma.steps > ma.maxSteps {
-					panic(ma.stepLimitMsg())
+				if ma.steps > ma.brake {
+					ma.stop()
 				}
 				vals[i] = fr.rd(phiOperand(b.phis[i].incs, prev))
 			}
@@ -2363,8 +2472,8 @@ func (ma *machine) call(f *ir.Func, args []uint64) uint64 {
 		}
 		for i := range b.insts {
 			ma.steps++
-			if ma.steps > ma.maxSteps {
-				panic(ma.stepLimitMsg())
+			if ma.steps > ma.brake {
+				ma.stop()
 			}
 			ma.exec(fr, &b.insts[i], prev)
 		}
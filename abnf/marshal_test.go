@@ -0,0 +1,147 @@
+package abnf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"14.gy/mec/abnf/r"
+)
+
+// TestMarshalRoundTrip sends the built-in a-grammar and an ASG through both
+// encodings of r.Marshal, and through abnf.saveRules/loadRules, and expects
+// every field back - the Pos of every ASG node, the raw bytes of a byte token,
+// and the difference between no child list and an empty one. The loaded
+// a-grammar must also still parse.
+func TestMarshalRoundTrip(t *testing.T) {
+	src := `:startRule(A) ; A = { @b"\xff" | "a"..."z" | B } ; B = "(" [ A ] ")" ;`
+	asg, err := ParseWithAgrammar(AbnfAgrammar, src, "a.abnf", &Parseropts{PreventDefaultOutput: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	odd := &r.Rules{
+		&r.Rule{Operator: r.Token, String: "\xff\x00ä", Pos: -1},
+		&r.Rule{Operator: r.Sequence, Childs: &r.Rules{}},
+		nil,
+		&r.Rule{Operator: r.Times, Childs: &r.Rules{&r.Rule{Operator: r.Token, String: "x"}}, CodeChilds: &r.Rules{&r.Rule{Operator: r.Number, Int: 3}, &r.Rule{Operator: r.Token, String: "..."}}},
+	}
+	dir := t.TempDir()
+	funcs := NewEngine().NewSession(nil, nil).abnfFuncs(func() string { return filepath.Join(dir, "g.abnf") })
+	save := funcs["saveRules"].(func(*r.Rules, string, string))
+	load := funcs["loadRules"].(func(string) *r.Rules)
+
+	for name, rules := range map[string]*r.Rules{"a-grammar": AbnfAgrammar, "ASG": asg, "odd rules": odd} {
+		for _, format := range []string{r.MarshalJSON, r.MarshalBinary} {
+			data, err := r.Marshal(rules, format)
+			if err != nil {
+				t.Fatalf("%s as %s: %v", name, format, err)
+			}
+			back, err := r.Unmarshal(data)
+			if err != nil {
+				t.Fatalf("%s as %s: %v", name, format, err)
+			}
+			if path := sameRules(rules, back, name); path != "" {
+				t.Errorf("%s as %s: differs at %s", name, format, path)
+			}
+
+			file := filepath.Join(dir, "rules."+format)
+			save(rules, file, format)
+			if path := sameRules(rules, load(file), name); path != "" {
+				t.Errorf("%s through saveRules(%s): differs at %s", name, format, path)
+			}
+		}
+	}
+
+	loaded, _ := r.Unmarshal(mustMarshal(t, AbnfAgrammar, r.MarshalBinary))
+	again, err := ParseWithAgrammar(loaded, src, "a.abnf", &Parseropts{PreventDefaultOutput: true})
+	if err != nil {
+		t.Fatalf("the loaded a-grammar does not parse: %v", err)
+	}
+	if path := sameRules(asg, again, "ASG"); path != "" {
+		t.Errorf("the loaded a-grammar parses another ASG: differs at %s", path)
+	}
+
+	data := mustMarshal(t, asg, r.MarshalBinary)
+	for _, bad := range [][]byte{data[:len(data)-3], append(append([]byte{}, data...), 0), []byte(`{"format": "mec-rules", "version": 1, "rules": [{"Operator": "Tock"}]}`), []byte(`{"format": "mec-rules", "version": 99}`), []byte("A = B ;")} {
+		if _, err := r.Unmarshal(bad); err == nil {
+			t.Errorf("Unmarshal accepts %q", bad)
+		}
+	}
+}
+
+// TestScriptSaveRules calls abnf.saveRules and loadRules from a start script on
+// both engines: a relative file name lies next to the grammar, like store()'s.
+func TestScriptSaveRules(t *testing.T) {
+	src := `:startRule(T) ;
+T = "A" ;
+:startScript(~~
+    abnf.saveRules(c.asg, "asg.json")
+    abnf.saveRules(c.asg, "sub/asg.bin")
+    println(abnf.loadRules("asg.json").length + " " + abnf.loadRules("sub/asg.bin").length)
+~~) ;
+`
+	bothEngines(t, func(t *testing.T, frozen bool) {
+		run := &grammarRun{frozen: frozen, dir: t.TempDir()}
+		if err := os.Mkdir(filepath.Join(run.dir, "sub"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		out, err := runGrammar(t, src, run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "1 1\n" {
+			t.Errorf("printed %q", out)
+		}
+		data, err := os.ReadFile(filepath.Join(run.dir, "asg.json"))
+		if err != nil {
+			t.Fatalf("saveRules did not write next to the grammar: %v", err)
+		}
+		if back, err := r.Unmarshal(data); err != nil || sameRules(run.asg, back, "ASG") != "" {
+			t.Errorf("the saved ASG does not read back: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(run.dir, "sub", "asg.bin")); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func mustMarshal(t *testing.T, rules *r.Rules, format string) []byte {
+	data, err := r.Marshal(rules, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// sameRules compares every field, and returns where the first difference is.
+func sameRules(a, b *r.Rules, path string) string {
+	if (a == nil) != (b == nil) {
+		return path + " (nil list)"
+	}
+	if a == nil {
+		return ""
+	}
+	if len(*a) != len(*b) {
+		return path + " (length)"
+	}
+	for i, x := range *a {
+		y := (*b)[i]
+		if (x == nil) != (y == nil) {
+			return path + " (nil rule)"
+		}
+		if x == nil {
+			continue
+		}
+		at := path + "/" + x.Operator.String() + " " + x.String
+		if x.Operator != y.Operator || x.String != y.String || x.Int != y.Int || x.Pos != y.Pos {
+			return at
+		}
+		if diff := sameRules(x.Childs, y.Childs, at+"/Childs"); diff != "" {
+			return diff
+		}
+		if diff := sameRules(x.CodeChilds, y.CodeChilds, at+"/CodeChilds"); diff != "" {
+			return diff
+		}
+	}
+	return ""
+}
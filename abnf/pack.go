@@ -0,0 +1,341 @@
+package abnf
+
+// Language packs: one file that carries everything a language needs to run.
+//
+// A language is more than its .abnf file. It pulls in :include() fragments
+// (languages/lib/*.abnf), include()d and load()ed script libraries
+// (lib/compile-core.js), and the runtime modules its programs link against
+// (lib/runtime.ll), all by paths relative to the grammar file. A pack made
+// with
+//
+//	mec -pack languages/python-to-llvm-ir.abnf -o python.mecpack
+//
+// bundles them into one zip archive:
+//
+//	mecpack.json      the manifest: format, version, grammar name, snapshot key
+//	grammar.mecr      the compiled a-grammar (r.Marshal, binary), its :include()
+//	                  fragments merged in and the :include() commands removed
+//	files/<path>      every other file the language reads, by its path relative
+//	                  to the grammar file
+//	scripts/<hash>    the tag scripts compiled for -frozen, as the script cache
+//	                  stores them (scriptcodec.go), keyed by a hash of the source
+//
+// and `mec python.mecpack prog.py` runs it with no other file present. The pack
+// file then stands in for the grammar's directory: the grammar's :origin() is
+// python.mecpack/python-to-llvm-ir.abnf, so include("lib/compile-core.js")
+// resolves to python.mecpack/lib/compile-core.js, which readHostFile serves from
+// the archive. Files that are not in it are read from disk as usual. A merged
+// fragment keeps an :origin() of its own, python.mecpack/lib/<fragment>.abnf,
+// so the positions of its productions still refer to the fragment.
+//
+// Which files a language reads is only known when its scripts run, so -pack
+// collects them from the string literals of the scripts: a literal like
+// "lib/compile-core.js" that names an existing file next to the script that
+// contains it, or in the grammar's lib/ directory (where the languages' libPath()
+// helpers look), is packed, and a packed .js file is scanned the same way. Only
+// files inside the grammar's directory are packed. Further files go on the
+// command line behind the grammar. The compiled scripts are only used by a
+// binary with the same bootstrap snapshot; any other recompiles them.
+//
+// A native build (-exe) hands the runtime paths to clang, which cannot look into
+// the archive, so it needs the language's files on disk.
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+
+	"14.gy/mec/abnf/r"
+)
+
+// PackVersion is the version -pack writes, and the newest OpenPack reads.
+const PackVersion = 1
+
+const (
+	packFormat   = "mecpack"
+	packManifest = "mecpack.json"
+	packGrammar  = "grammar.mecr"
+)
+
+type packManifestData struct {
+	Format   string `json:"format"`
+	Version  int    `json:"version"`
+	Grammar  string `json:"grammar"`  // The base name of the grammar file.
+	Snapshot string `json:"snapshot"` // scriptSnapshotKey() of the binary that compiled the scripts.
+}
+
+// packState is the pack a session uses: its files by their cleaned path below
+// the pack (as if the pack were a directory), and its compiled scripts by
+// packScriptName.
+type packState struct {
+	files   map[string][]byte
+	scripts map[string][]byte
+}
+
+// IsPack tells whether a file on the command line is a language pack.
+func IsPack(fileName string) bool {
+	return strings.HasSuffix(fileName, ".mecpack")
+}
+
+// readHostFile reads a file a language asks for (an :include() fragment, a
+// script library, a runtime module): from the pack in use if it has the file,
+// from disk otherwise - if the sandbox lets it.
+func (s *Session) readHostFile(path string) ([]byte, error) {
+	if dat, ok := s.pack.files[filepath.Clean(path)]; ok {
+		return dat, nil
+	}
+	if err := s.sandbox.access(path); err != nil {
+		return nil, err
+	}
+	s.noteInput(path)
+	return os.ReadFile(path)
+}
+
+// writeHostFile is store(): it writes a file for a script, if the sandbox lets
+// it.
+func (s *Session) writeHostFile(path, data string) error {
+	if err := s.sandbox.access(path); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(data), 0644)
+}
+
+func packScriptName(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadPackScript returns the compiled module of a script from the pack the
+// session uses, or nil.
+func (s *Session) loadPackScript(code string) *ir.Module {
+	dat, ok := s.pack.scripts[packScriptName(code)]
+	if !ok {
+		return nil
+	}
+	return decodeScriptEntry("script in pack", dat)
+}
+
+// packFileRef matches a string literal that may name a file: a relative path
+// with an extension.
+var packFileRef = regexp.MustCompile("[\"'`]([A-Za-z0-9_][A-Za-z0-9_./-]*\\.[A-Za-z0-9]+)[\"'`]")
+
+// WritePack compiles the grammar file fileName (source src) and writes it, with
+// the files it reads and the extra files, as a language pack to outPath.
+func WritePack(fileName, src string, extra []string, outPath string, opts *Parseropts) error {
+	return defaultSession().WritePack(fileName, src, extra, outPath, opts)
+}
+
+// WritePack is the session form of the package-level WritePack.
+func (s *Session) WritePack(fileName, src string, extra []string, outPath string, opts *Parseropts) (e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("%s", err)
+		}
+	}()
+	grammar, err := s.CompileGrammar(src, fileName, 0, opts, true)
+	if err != nil {
+		return err
+	}
+	if err := s.AssembleIncludes(grammar, fileName, opts); err != nil {
+		return err
+	}
+	// The :origin() stamps of the grammar and of its fragments name their files
+	// relative to the grammar's directory, which OpenPack anchors in the pack.
+	dir := filepath.Dir(fileName)
+	merged := r.Rules{}
+	for _, rule := range *grammar {
+		switch {
+		case rule.Operator == r.Command && rule.String == "include": // Merged in: a second include would define everything twice.
+		case rule.Operator == r.Command && rule.String == "origin" && rule.CodeChilds != nil && len(*rule.CodeChilds) > 0:
+			stamp := *(*rule.CodeChilds)[0]
+			if rel, err := filepath.Rel(dir, stamp.String); err == nil {
+				stamp.String = filepath.ToSlash(rel)
+			}
+			origin := *rule // A copy: the compiled grammar may be shared.
+			origin.CodeChilds = &r.Rules{&stamp}
+			merged = append(merged, &origin)
+		default:
+			merged = append(merged, rule)
+		}
+	}
+	grammar = &merged
+
+	// The files: what the scripts name, then what the named .js files name.
+	files := map[string][]byte{}
+	var scan func(code, from string)
+	add := func(path string) bool {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return false
+		}
+		rel = filepath.ToSlash(rel)
+		if _, done := files[rel]; done {
+			return true
+		}
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+		dat, err := os.ReadFile(path)
+		if err != nil {
+			return false
+		}
+		files[rel] = dat
+		if strings.HasSuffix(rel, ".js") {
+			scan(string(dat), filepath.Dir(path))
+		}
+		return true
+	}
+	scan = func(code, from string) {
+		for _, m := range packFileRef.FindAllStringSubmatch(code, -1) {
+			if !add(filepath.Join(from, m[1])) {
+				add(filepath.Join(dir, "lib", m[1]))
+			}
+		}
+	}
+	codes := scriptSources(grammar)
+	if start := r.GetStartScript(grammar); start != nil && start.CodeChilds != nil {
+		for _, c := range *start.CodeChilds {
+			codes = append(codes, c.String)
+		}
+	}
+	for _, code := range codes {
+		scan(code, dir)
+	}
+	for _, path := range extra {
+		if !add(path) {
+			return fmt.Errorf("%s: not a file inside %s", path, dir)
+		}
+	}
+
+	// The frozen scripts, if this binary has the snapshot to compile them.
+	scripts := map[string][]byte{}
+	if jsAgrammar != nil && len(jsBootstrapLL) > 0 {
+		for rel, dat := range files {
+			if strings.HasSuffix(rel, ".js") {
+				codes = append(codes, StripBOM(string(dat)))
+			}
+		}
+		for _, code := range codes {
+			if isBootScript(code) {
+				continue
+			}
+			func() {
+				defer func() { recover() }() // A file that only looked like a script.
+				scripts[packScriptName(code)] = encodeScriptEntry(frozenKernel().compileScript(s, code, fileScript(fileName)))
+			}()
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	put := func(name string, data []byte) {
+		w, err := zw.Create(name)
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+	manifest, _ := json.MarshalIndent(packManifestData{Format: packFormat, Version: PackVersion, Grammar: filepath.Base(fileName), Snapshot: scriptSnapshotKey()}, "", " ")
+	put(packManifest, manifest)
+	data, err := r.Marshal(grammar, r.MarshalBinary)
+	if err != nil {
+		return err
+	}
+	put(packGrammar, data)
+	for _, rel := range sortedKeys(files) {
+		put("files/"+rel, files[rel])
+	}
+	for _, name := range sortedKeys(scripts) {
+		put("scripts/"+name, scripts[name])
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, buf.Bytes(), 0644)
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// OpenPack reads the language pack at path and puts it in use (see
+// readHostFile). It returns the pack's a-grammar.
+func OpenPack(path string) (*r.Rules, error) {
+	return defaultSession().OpenPack(path)
+}
+
+// OpenPack puts a language pack in use for this session only.
+func (s *Session) OpenPack(path string) (*r.Rules, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a language pack: %v", path, err)
+	}
+	defer zr.Close()
+	entries := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		dat, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, f.Name, err)
+		}
+		entries[f.Name] = dat
+	}
+	var manifest packManifestData
+	if err := json.Unmarshal(entries[packManifest], &manifest); err != nil || manifest.Format != packFormat || manifest.Grammar == "" {
+		return nil, fmt.Errorf("%s: not a language pack (no valid %s)", path, packManifest)
+	}
+	if manifest.Version < 1 || manifest.Version > PackVersion {
+		return nil, fmt.Errorf("%s: pack version %d is not supported (up to %d)", path, manifest.Version, PackVersion)
+	}
+	grammar, err := r.Unmarshal(entries[packGrammar])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %v", path, packGrammar, err)
+	}
+
+	root := filepath.Clean(path)
+	s.pack = packState{files: map[string][]byte{}, scripts: map[string][]byte{}}
+	for name, dat := range entries {
+		switch {
+		case strings.HasPrefix(name, "files/"):
+			s.pack.files[filepath.Join(root, filepath.FromSlash(name[len("files/"):]))] = dat
+		case strings.HasPrefix(name, "scripts/") && manifest.Snapshot == scriptSnapshotKey():
+			s.pack.scripts[name[len("scripts/"):]] = dat
+		}
+	}
+	// The pack is the grammar's directory now: the grammar lies in it under its
+	// base name, and each fragment where it was relative to the grammar. A pack written
+	// before the stamps were relative has the paths of the machine it was made
+	// on; they all name the grammar.
+	for _, rule := range *grammar {
+		if rule.Operator == r.Command && rule.String == "origin" && rule.CodeChilds != nil && len(*rule.CodeChilds) > 0 {
+			stamp := (*rule.CodeChilds)[0]
+			if filepath.IsAbs(stamp.String) || stamp.String == "" {
+				stamp.String = manifest.Grammar
+			}
+			stamp.String = filepath.Join(root, filepath.FromSlash(stamp.String))
+		}
+	}
+	return grammar, nil
+}
@@ -0,0 +1,91 @@
+package abnf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPack packs a grammar with an :include() fragment and a startScript that
+// include()s a script library, moves only the pack to another directory, and
+// expects the pack to parse and run there: the fragment merged in, the library
+// read from the archive, each production stamped with its own file inside the
+// pack. A file outside the grammar's directory is refused.
+func TestPack(t *testing.T) {
+	dir := t.TempDir()
+	scriptCacheInit()
+	savedDir := scriptCacheDir
+	scriptCacheDir = ""
+	defer func() { scriptCacheDir = savedDir }()
+	s := NewEngine().NewSession(os.Stdout, os.Stderr)
+
+	write := func(file, text string) {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lang := filepath.Join(dir, "lang")
+	main := filepath.Join(lang, "main.abnf")
+	src := `:startScript(~~include("lib/x.js"); var packed = greeting;~~) ; :startRule(List) ; :include("lib/frag.abnf") ; List = Item { "," Item } ;`
+	write(main, src)
+	frag := "// The items.\nItem = \"a\" ;\n"
+	write(filepath.Join(lang, "lib", "frag.abnf"), frag)
+	write(filepath.Join(lang, "lib", "x.js"), `var greeting = "from the pack";`)
+	write(filepath.Join(dir, "outside.txt"), "x")
+	opts := &Parseropts{PreventDefaultOutput: true}
+
+	pack := filepath.Join(dir, "lang.mecpack")
+	if err := s.WritePack(main, src, []string{filepath.Join(dir, "outside.txt")}, pack, opts); err == nil {
+		t.Error("WritePack packs a file outside the grammar's directory")
+	}
+	if err := s.WritePack(main, src, nil, pack, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(lang); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(t.TempDir(), "moved.mecpack")
+	if err := os.Rename(pack, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	grammar, err := s.OpenPack(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each production is where it was written, relative to the pack: the
+	// grammar's as moved/main.abnf, the fragment's as moved/lib/frag.abnf.
+	for _, p := range buildCovTable(grammar).points {
+		if p.Kind != covProduction {
+			continue
+		}
+		want, text := filepath.Join(moved, "main.abnf"), src
+		if p.Prod == "Item" {
+			want, text = filepath.Join(moved, "lib", "frag.abnf"), frag
+		}
+		if p.File != want {
+			t.Errorf("production %s is in %s, want %s", p.Prod, p.File, want)
+		}
+		if line, _, _ := lineCol(text, p.Pos-1); p.Prod == "Item" && line != 2 {
+			t.Errorf("production Item is at line %d of its fragment, want 2", line)
+		}
+	}
+	if dat, err := s.readHostFile(filepath.Join(moved, "lib", "x.js")); err != nil || string(dat) != `var greeting = "from the pack";` {
+		t.Fatalf("the script library is not in the pack: %q, %v", dat, err)
+	}
+	asg, err := s.Parse(grammar, "a, a", "in.txt", opts)
+	if err != nil {
+		t.Fatalf("the pack does not parse: %v", err)
+	}
+	if _, err := s.Compile(asg, grammar, "in.txt", 0, false, true); err != nil {
+		t.Fatalf("the pack does not run: %v", err)
+	}
+
+	write(filepath.Join(dir, "bad.mecpack"), "not a zip")
+	if _, err := s.OpenPack(filepath.Join(dir, "bad.mecpack")); err == nil {
+		t.Error("OpenPack accepts a file that is not a pack")
+	}
+}
@@ -4,12 +4,12 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
-	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 
 	"14.gy/mec/abnf/r"
@@ -30,6 +30,8 @@ import (
 // agrammar parser
 
 type parser struct {
+	sess *Session // The session the parse runs in: its options, output and state.
+
 	Src      string   // The target text that gets parsed.
 	Sdx      int      // The current parse position inside Src (byte index).
 	agrammar *r.Rules // The a-grammar that describes the target text.
@@ -53,6 +55,19 @@ type parser struct {
 
 	wsCache   map[*r.Rule]*wsMemo // The memoized whitespace skips, per whitespace rule. See skipSpaces().
 	pureCache map[*r.Rule]bool    // Memoizes isPure() per rule, see there.
+
+	cov *covTable      // The -grammar-coverage points of agrammar; nil when not measured (see coverage.go).
+	amb *ambiguityScan // The -ambiguity detector; nil when off (see ambiguity.go).
+
+	// The recording of Parseropts.Spans (see spans.go); spanProds is nil when off.
+	spanProds map[string]bool    // The productions whose matches are recorded.
+	spans     []ParseSpan        // The matches so far; a failing rule cuts its own off again.
+	wsSpans   map[ParseSpan]bool // The matches inside the whitespace.
+	skipEnds  map[int]int        // Where the last whitespace skip from a position ended.
+
+	// Where the match of every Tag node starts, behind its whitespace: recorded
+	// for -pdebug only (ProgramDebugger.tagStarts), nil otherwise.
+	tagStarts map[*r.Rule]int
 }
 
 // wsMemo is what skipSpaces() remembers about one whitespace rule.
@@ -74,10 +89,21 @@ func (pa *parser) setSrc(src string) {
 	pa.blockList = map[applyKey]bool{}
 }
 
-// includedByGrammar tracks, per a-grammar, which :include() files were already
-// appended (see applyCommand). Package-level because several parser instances
-// may walk the same a-grammar (project-file imports re-enter the parser).
-var includedByGrammar = map[*r.Rules]map[string]bool{}
+// isIncluded reports whether the file fileName is already merged into
+// agrammar. The record is the grammar itself: CompileGrammar stamps every
+// fragment with its :origin(), and the stamp is appended to the a-grammar
+// together with the fragment's productions. So several parser instances (the
+// c.parse of a project-file import re-enters the parser) and several sessions
+// walking the same a-grammar all see the same record, and it goes away with
+// the grammar.
+func isIncluded(agrammar *r.Rules, fileName string) bool {
+	for _, rule := range *agrammar {
+		if rule.Operator == r.Command && rule.String == "origin" && (*rule.CodeChilds)[0].String == fileName {
+			return true
+		}
+	}
+	return false
+}
 
 // Parseropts are the command line options that influence the parser.
 type Parseropts struct {
@@ -87,6 +113,10 @@ type Parseropts struct {
 	// fragment (e.g. a single Statement) of a language rather than a whole program - the
 	// -main snippet form relies on it.
 	StartRule string
+	// Spans, when non-nil, receives where the productions marked with :symbol()
+	// and :highlight() and the Tags matched - also when the parse fails (then
+	// up to where it got). See spans.go.
+	Spans *[]ParseSpan
 }
 
 // getRulePosId maps the pair (rule, position in the target text) to one unique int,
@@ -150,7 +180,7 @@ func (pa *parser) ruleEnter(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces
 	if skipSpaceRule != nil {
 		skip = "  spaces:➰  " // Skip spaces.
 	}
-	fmt.Print(space, ">", depth, "  (", pa.traceCount, ")  ", LinePosFromStrPos(string(pa.Src), pa.Sdx), "  char:", c, skip, rule.ToString(), msg, "\n")
+	fmt.Fprint(pa.sess.out, space, ">", depth, "  (", pa.traceCount, ")  ", LinePosFromStrPos(string(pa.Src), pa.Sdx), "  char:", c, skip, rule.ToString(), msg, "\n")
 	return isBlocked, foundRule, foundSdx
 }
 
@@ -182,7 +212,7 @@ func (pa *parser) ruleExit(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces b
 	if skipSpaceRule != nil {
 		skip = "  spaces:➰  " // Skip spaces.
 	}
-	fmt.Print(times(" ", depth), "<", depth, "  (", pa.traceCount, ")  ", LinePosFromStrPos(string(pa.Src), pa.Sdx), "  char:", c, skip, rule.ToString(), " found:", found != nil, "\n")
+	fmt.Fprint(pa.sess.out, times(" ", depth), "<", depth, "  (", pa.traceCount, ")  ", LinePosFromStrPos(string(pa.Src), pa.Sdx), "  char:", c, skip, rule.ToString(), " found:", found != nil, "\n")
 }
 
 // skipSpaces advances pa.Sdx over the whitespace that ws describes, in front of every
@@ -200,6 +230,17 @@ func (pa *parser) ruleExit(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces b
 // parser state that is not part of the key, and tracing, whose output would otherwise lose
 // the skipped probes.
 func (pa *parser) skipSpaces(ws *r.Rule, depth int) {
+	if pa.skipEnds != nil { // A recorded span starts behind the whitespace, see recordSpan().
+		start := pa.Sdx
+		pa.skipSpacesMemo(ws, depth)
+		pa.skipEnds[start] = pa.Sdx
+		return
+	}
+	pa.skipSpacesMemo(ws, depth)
+}
+
+// skipSpacesMemo is skipSpaces() itself.
+func (pa *parser) skipSpacesMemo(ws *r.Rule, depth int) {
 	memo := pa.wsCache[ws]
 	if memo == nil {
 		// Whether the rule may be memoized only depends on the a-grammar, which does not
@@ -439,34 +480,30 @@ func (pa *parser) applyCommand(rule *r.Rule) {
 		// Include every file only once PER A-GRAMMAR: with nested includes
 		// enabled, two fragments sharing a common helper fragment would
 		// otherwise define its productions twice (a hard error), and a cyclic
-		// include would never terminate. The set is keyed by the a-grammar,
+		// include would never terminate. The record is kept in the a-grammar,
 		// not the parser: re-parsing with the same grammar (c.parse of a
 		// project-file import) must not re-append the included rules.
 		fullFileName = filepath.Clean(fullFileName)
-		included := includedByGrammar[pa.agrammar]
-		if included == nil {
-			included = map[string]bool{}
-			includedByGrammar[pa.agrammar] = included
-		}
-		if included[fullFileName] {
+		if isIncluded(pa.agrammar, fullFileName) {
 			return
 		}
-		included[fullFileName] = true
-		dat, err := ioutil.ReadFile(fullFileName)
+		dat, err := pa.sess.readHostFile(fullFileName)
 		if err != nil {
 			panic(err)
 		}
 		srcCode := StripBOM(string(dat))
 
-		asg, err := ParseWithAgrammar(AbnfAgrammar, srcCode, fullFileName, pa.opts)
-		if err != nil {
-			panic(err)
-		}
-		aGrammar, err := CompileASG(asg, AbnfAgrammar, fullFileName, slot, false, false)
+		aGrammar, err := pa.sess.CompileGrammar(srcCode, fullFileName, slot, pa.opts, false)
 		if err != nil {
 			panic(err)
 		}
 		*pa.agrammar = append(*pa.agrammar, *aGrammar...)
+		if !isIncluded(pa.agrammar, fullFileName) {
+			// The fragment's script returned a grammar stamped with another
+			// origin: record the file all the same.
+			*pa.agrammar = append(*pa.agrammar, &r.Rule{Operator: r.Command, String: "origin",
+				CodeChilds: &r.Rules{&r.Rule{Operator: r.Token, String: fullFileName}}})
+		}
 		// Correct all references: The included productions moved to new positions and
 		// previously unresolved identifiers can now point to them.
 		pa.referencesCache.correctReferencesAndIDs(pa.agrammar)
@@ -478,6 +515,14 @@ func (pa *parser) applyCommand(rule *r.Rule) {
 		// TODO: Maybe use that information.
 	case "description":
 		// TODO: Maybe use that information.
+	case "extensions", "shebangs":
+		// Which programs the grammar is for: read by mec run (languages.go).
+	case "symbol", "highlight":
+		// Editor annotations (see spans.go). Only checked here: a misspelled kind
+		// fails the parse instead of quietly giving no outline.
+		if _, _, _, err := annotation(rule); err != nil {
+			panic(err)
+		}
 	case "origin":
 		// The grammar file this a-grammar was compiled from (stamped by
 		// CompileASG; the start script runs under this module name).
@@ -522,7 +567,8 @@ var emptyProductions = &r.Rules{}
 // a whitespace rule, because then whitespace must not be skipped again (that would recurse
 // forever) and no productions are created.
 func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool, depth int) *r.Rules { // => (localProductions)
-	wasSdx := pa.Sdx // Start position of the rule. Return, if the rule does not match.
+	wasSdx := pa.Sdx           // Start position of the rule. Return, if the rule does not match.
+	spansFrom := len(pa.spans) // The recorded spans a failure cuts off again (see spans.go).
 	// Created lazily (see appendProd and r.AppendPossibleSequence, both of which take a
 	// nil target): most applications are terminals that fail on the first byte or
 	// lookaheads that produce nothing, and eagerly allocating one *r.Rules per apply()
@@ -549,6 +595,7 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 			if newProductions == nil {
 				pa.ruleExit(rule, skipSpaceRule, skippingSpaces, depth, nil, wasSdx, false)
 				pa.Sdx = wasSdx
+				pa.spans = pa.spans[:spansFrom]
 				return nil
 			}
 			if len(*newProductions) > 0 { // Some Commands like :whitespace() have to be handled inside the sequence.
@@ -694,7 +741,8 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 		// like everywhere else.)
 		probe := pa.apply((*rule.Childs)[0], skipSpaceRule, skippingSpaces, depth+1)
 		pa.Sdx = wasSdx
-		if probe != nil { // The child matched: the lookahead fails.
+		pa.spans = pa.spans[:spansFrom] // A lookahead matches nothing of the text.
+		if probe != nil {               // The child matched: the lookahead fails.
 			pa.ruleExit(rule, skipSpaceRule, skippingSpaces, depth, nil, wasSdx, false)
 			return nil
 		}
@@ -767,6 +815,12 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 			if newProductions != nil { // The nil result is used as ERROR. So if a match is successful but has nothing to return, it should only return something empty but not nil.
 				localProductions = r.AppendArrayOfPossibleSequences(localProductions, newProductions)
 				found = true
+				if pa.cov != nil {
+					pa.cov.hit(rule, i)
+				}
+				if pa.amb != nil && !skippingSpaces {
+					pa.amb.probe(pa, rule, i, wasSdx, skipSpaceRule, depth)
+				}
 				break
 			}
 			// pa.Sdx = wasSdx // Should not be necessary, because each apply returns to wasSdx if the rule could not be fully applied.
@@ -803,7 +857,7 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 		rule = cloneRule
 		// Resolve parameters:
 		for i, child := range *rule.CodeChilds {
-			if child.Operator == r.Number {
+			if child.Operator == r.Number || i == 1 && child.Operator == r.Token { // The Token is the open bound of A... ( X ).
 				continue
 			}
 			// TODO: When command is something else as :number(), resolve without checking or forwarding in pa.Src. Those parameters should only exist in and be fetched from agrammar. Make a distinction between forward (pa.Src) looking parameter and backwards (agrammar) looking parameters.
@@ -845,6 +899,7 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 			if newProductions == nil {
 				pa.ruleExit(rule, skipSpaceRule, skippingSpaces, depth, nil, wasSdx, false)
 				pa.Sdx = wasSdx
+				pa.spans = pa.spans[:spansFrom]
 				return nil
 			}
 			localProductions = r.AppendArrayOfPossibleSequences(localProductions, newProductions) // Only append if all child rules matched.
@@ -864,6 +919,10 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 	case r.Optional:
 		newProductions := pa.applyAsSequence(rule, rule.Childs, skipSpaceRule, skippingSpaces, depth+1)
 		localProductions = r.AppendArrayOfPossibleSequences(localProductions, newProductions) // If not all child rules matched, newProductions is nil anyways.
+		// An Optional always matches; it is covered only when its body was taken.
+		if pa.cov != nil && newProductions != nil {
+			pa.cov.hit(rule, -1)
+		}
 	case r.Identifier: // This identifies another rule (and its index), it is basically a link: E.g. to the expression-rule which is at position 3: { "Identifier", "expression", 3 }
 		if rule.Int < 0 || rule.Int >= len(*pa.agrammar) {
 			panic("Unknown production name '" + rule.String + "'. It is used inside the grammar but never defined.")
@@ -875,6 +934,12 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 			return nil
 		}
 		localProductions = r.AppendArrayOfPossibleSequences(localProductions, newProductions)
+		if pa.cov != nil {
+			pa.cov.hit((*pa.agrammar)[rule.Int], -1)
+		}
+		if pa.spanProds != nil && pa.spanProds[rule.String] {
+			pa.recordSpan(rule.String, wasSdx, skippingSpaces)
+		}
 	case r.Tag:
 		newProductions := pa.applyAsSequence(rule, rule.Childs, skipSpaceRule, skippingSpaces, depth+1)
 		if newProductions == nil {
@@ -885,9 +950,23 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 		// Resolve name parameters into their code text. This changes the grammar rule itself,
 		// but the resolution is idempotent, so all later applications just reuse the result.
 		pa.resolveParameterToToken(rule.CodeChilds)
+		if pa.cov != nil {
+			pa.cov.hit(rule, -1)
+		}
+		if pa.spanProds != nil && !skippingSpaces {
+			pa.recordSpan("", wasSdx, false)
+		}
 		// The matched childs get wrapped into a new Tag rule for the ASG. This is the only
 		// grouping that the ASG keeps. Int contains the UID of the script for later caching.
-		localProductions = appendProd(localProductions, &r.Rule{Operator: r.Tag, Int: rule.Int, CodeChilds: rule.CodeChilds, Childs: newProductions, Pos: pa.Sdx})
+		tag := &r.Rule{Operator: r.Tag, Int: rule.Int, CodeChilds: rule.CodeChilds, Childs: newProductions, Pos: pa.Sdx}
+		if pa.tagStarts != nil {
+			start := wasSdx
+			if end, ok := pa.skipEnds[start]; ok && end <= pa.Sdx {
+				start = end
+			}
+			pa.tagStarts[tag] = start
+		}
+		localProductions = appendProd(localProductions, tag)
 	case r.Command:
 		switch rule.String {
 		case "whitespace":
@@ -990,6 +1069,7 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 				if scriptProductions == nil {
 					pa.ruleExit(rule, skipSpaceRule, skippingSpaces, depth, nil, wasSdx, false)
 					pa.Sdx = wasSdx
+					pa.spans = pa.spans[:spansFrom]
 					return nil
 				}
 				if len(*scriptProductions) > 0 {
@@ -1000,6 +1080,8 @@ func (pa *parser) apply(rule *r.Rule, skipSpaceRule *r.Rule, skippingSpaces bool
 			// TODO: Maybe use that information.
 		case "description":
 			// TODO: Maybe use that information.
+		case "extensions", "shebangs":
+			// Which programs the grammar is for: read by mec run (languages.go).
 		case "startRule":
 			// This is used by ParseWithAgrammar().
 		case "startScript":
@@ -1085,15 +1167,20 @@ func (re *references) correctReferencesAndIDs(rules *r.Rules) {
 		re.collectProductionReferences(rules)
 		clear = true
 	}
+	// The links are only written where they change: every parse links its grammar
+	// again, and a grammar that several sessions share (the built-in ones, or one
+	// compiled once and handed to many) must stay read-only once it is linked.
 	for _, rule := range *rules {
 		if rule.Operator == r.Identifier {
 			// An unknown production name cannot be reported here, because it could still be
 			// added later (e.g. by an :include()). So it is only marked with the invalid
 			// position -1. Whoever really uses the Identifier has to check for that marker.
-			if pos, ok := re.productionReferences[rule.String]; ok {
+			pos, ok := re.productionReferences[rule.String]
+			if !ok {
+				pos = -1
+			}
+			if rule.Int != pos {
 				rule.Int = pos
-			} else {
-				rule.Int = -1
 			}
 		} else if rule.Operator == r.Tag || (rule.Operator == r.Command && rule.String == "script") {
 			var allCode string
@@ -1105,12 +1192,14 @@ func (re *references) correctReferencesAndIDs(rules *r.Rules) {
 					allCode += child.String
 				}
 			}
-			if pos, ok := re.tagReferences[allCode]; ok {
-				rule.Int = pos
-			} else {
+			pos, ok := re.tagReferences[allCode]
+			if !ok {
 				re.lastTag++
-				re.tagReferences[allCode] = re.lastTag
-				rule.Int = re.lastTag
+				pos = re.lastTag
+				re.tagReferences[allCode] = pos
+			}
+			if rule.Int != pos {
+				rule.Int = pos
 			}
 		}
 		if rule.Childs != nil && len(*rule.Childs) > 0 {
@@ -1179,26 +1268,21 @@ func mergeTerminals(productions *r.Rules) {
 	*productions = out
 }
 
-// ParseErrorWithCode and ParseErrorUnabridged shape the "not everything could be parsed"
-// dump of what parsed so far. WithCode shows each tag's code (SerializeCompact) rather than
-// the structure-only tree (SerializeMinimal); Unabridged prints the whole thing instead of
-// cutting the middle with [...]. Set from the -error command-line flag (see main.go):
-// short (default), code, short-all, code-all.
-var (
-	ParseErrorWithCode   = false
-	ParseErrorUnabridged = false
-)
-
 // ParseWithAgrammar parses the target text srcCode with the given a-grammar and returns the
 // resulting ASG (abstract semantic graph). fileName is where srcCode came from; it is used
 // for messages and to resolve relative paths. If the a-grammar defines no :startRule(),
 // (nil, nil) is returned: Nothing can be parsed then, which is fine for grammars that only
 // consist of a :startScript().
-func ParseWithAgrammar(agrammar *r.Rules, srcCode, fileName string, options *Parseropts) (res *r.Rules, e error) { // => (productions, error)
+func ParseWithAgrammar(agrammar *r.Rules, srcCode, fileName string, options *Parseropts) (*r.Rules, error) { // => (productions, error)
+	return defaultSession().parse(agrammar, srcCode, fileName, options)
+}
+
+func (s *Session) parse(agrammar *r.Rules, srcCode, fileName string, options *Parseropts) (res *r.Rules, e error) {
+	defer s.sandbox.enter()()
 	defer func() {
 		if err := recover(); err != nil {
 			res = nil
-			e = fmt.Errorf("%s", err)
+			e = recoveredError(err)
 		}
 	}()
 
@@ -1208,7 +1292,12 @@ func ParseWithAgrammar(agrammar *r.Rules, srcCode, fileName string, options *Par
 		return nil, nil
 	}
 
+	if s.Debugger != nil {
+		s.Debugger.source(fileName, srcCode) // For the positions of the walk over this ASG.
+	}
+
 	var pa parser
+	pa.sess = s
 	pa.agrammar = agrammar
 	pa.Src = srcCode
 	pa.Sdx = 0
@@ -1225,7 +1314,7 @@ func ParseWithAgrammar(agrammar *r.Rules, srcCode, fileName string, options *Par
 	pa.referencesCache.correctReferencesAndIDs(pa.agrammar)
 	pa.initialSpaces = &r.Rule{Operator: r.CharsOf, String: "\t\n\r "} // TODO: Make this configurable via JS.
 
-	if UseFrozenScripts {
+	if s.Frozen {
 		pa.ps = newFrozenParserScript(&pa)
 	} else {
 		pa.ps = NewParserScript(&pa, options.PreventDefaultOutput)
@@ -1241,6 +1330,25 @@ func ParseWithAgrammar(agrammar *r.Rules, srcCode, fileName string, options *Par
 		}
 	}
 
+	// Measured only now, when the :include()s have assembled the whole grammar. The
+	// counts are merged even when the parse fails: a failing test program still
+	// exercised the grammar up to the error.
+	if pa.cov = s.coverageFor(pa.agrammar); pa.cov != nil {
+		defer s.mergeCoverage(pa.cov)
+	}
+	if pa.amb = s.ambiguityFor(pa.agrammar); pa.amb != nil {
+		defer pa.amb.report(&pa)
+	}
+	if options != nil && options.Spans != nil {
+		pa.initSpans()
+	}
+	if s.ProgramDebugger != nil {
+		pa.tagStarts = s.ProgramDebugger.tagStarts
+		if pa.skipEnds == nil {
+			pa.skipEnds = map[int]int{}
+		}
+	}
+
 	// The references were corrected above (and again after every :include()), so an
 	// invalid position means the named start production really does not exist.
 	startIdx := startRule.Int
@@ -1263,31 +1371,111 @@ func ParseWithAgrammar(agrammar *r.Rules, srcCode, fileName string, options *Par
 
 	// For the parsing, the start rule is necessary. For the compilation not.
 	newProductions := pa.apply((*pa.agrammar)[startIdx], pa.initialSpaces, false, 0)
+	if pa.cov != nil && newProductions != nil { // The start production is applied directly, not through an Identifier.
+		pa.cov.hit((*pa.agrammar)[startIdx], -1)
+	}
 
 	// Check if the position is at EOF at end of parsing. There can be spaces left, but otherwise its an error:
 	if pa.initialSpaces != nil {
 		pa.apply(pa.initialSpaces, pa.initialSpaces, true, 0) // Skip spaces.
 	}
+	if pa.spanProds != nil {
+		*options.Spans = pa.collectSpans()
+	}
 	if pa.Sdx < len(pa.Src) {
 		// Default is the structure-only tree (least noise); -error code/code-all also show
 		// each tag's code.
 		dump := newProductions.SerializeMinimal()
-		if ParseErrorWithCode {
+		if s.ParseErrorWithCode {
 			dump = newProductions.SerializeCompact()
 		}
 		// -error short-all/code-all print the whole object; otherwise cut the middle. The
 		// dump carries ANSI color escapes only when r.ColorErrorOutput is on, so use the
 		// escape-aware truncator then (a cut never lands inside a color sequence).
 		short := dump
-		if !ParseErrorUnabridged {
+		if !s.ParseErrorUnabridged {
 			short = Shorten(dump)
 			if r.ColorErrorOutput {
 				short = ShortenColored(dump)
 			}
 		}
-		panic(fmt.Sprintf("Not everything could be parsed. Last good parse position: %s\nParsed so far: %s", FileLinePos(pa.fileName, string(pa.Src), pa.lastParsePosition), short))
+		line, column, _ := lineCol(string(pa.Src), pa.lastParsePosition)
+		endLine, endColumn, _ := lineCol(string(pa.Src), unmatchedEnd(pa.Src, pa.lastParsePosition))
+		panic(&ParseError{
+			msg:       fmt.Sprintf("Not everything could be parsed. Last good parse position: %s\nParsed so far: %s", FileLinePos(pa.fileName, string(pa.Src), pa.lastParsePosition), short),
+			atEnd:     pa.lastParsePosition >= len(strings.TrimRight(pa.Src, " \t\r\n")),
+			file:      pa.fileName,
+			line:      line,
+			column:    column,
+			endLine:   endLine,
+			endColumn: endColumn,
+		})
 	}
 
 	mergeTerminals(newProductions)
 	return newProductions, nil
 }
+
+// ParseError is the error of a parse that did not get to the end of the text:
+// what Parse returns for a text the grammar does not match. atEnd tells
+// a text that ran out from one that went wrong: the furthest the parse got is
+// the end of the text, so more text might complete it (-repl then reads a
+// continuation line). file, line and column are the last good parse position,
+// for -diagnostics (diagnostics.go); endLine and endColumn are the end of the
+// word there, which the parse failed on.
+type ParseError struct {
+	msg                string
+	atEnd              bool
+	file               string
+	line, column       int
+	endLine, endColumn int
+}
+
+func (e *ParseError) Error() string { return e.msg }
+
+// unmatchedEnd is the end of the text a parse failed on at pos: the word there,
+// up to the next space, and at least the character at pos unless that ends the
+// line or the text.
+func unmatchedEnd(src string, pos int) int {
+	end := pos
+	for end < len(src) {
+		c, n := utf8.DecodeRuneInString(src[end:])
+		if unicode.IsSpace(c) {
+			break
+		}
+		end += n
+	}
+	if end == pos && pos < len(src) && src[pos] != '\n' && src[pos] != '\r' {
+		_, n := utf8.DecodeRuneInString(src[pos:])
+		end += n
+	}
+	return end
+}
+
+// AssembleIncludes merges the :include() fragments of a compiled a-grammar into
+// it without parsing anything, exactly the way ParseWithAgrammar does before its
+// first parse. Tools that look at the grammar itself instead of running it
+// (-export) need the whole language, not just the file they were pointed at.
+// The includes are registered per a-grammar, so a later parse with the same
+// grammar does not append them a second time.
+func AssembleIncludes(agrammar *r.Rules, fileName string, options *Parseropts) error {
+	return defaultSession().AssembleIncludes(agrammar, fileName, options)
+}
+
+// AssembleIncludes is the package-level AssembleIncludes, in this session.
+func (s *Session) AssembleIncludes(agrammar *r.Rules, fileName string, options *Parseropts) (e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = recoveredError(err)
+		}
+	}()
+
+	pa := parser{sess: s, agrammar: agrammar, opts: options, fileName: filepath.Clean(fileName), referencesCache: NewReferences()}
+	pa.referencesCache.correctReferencesAndIDs(pa.agrammar)
+	for i := 0; i < len(*pa.agrammar); i++ {
+		if rule := (*pa.agrammar)[i]; rule.Operator == r.Command && rule.String == "include" {
+			pa.applyCommand(rule)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package abnf
+
+import (
+	"testing"
+
+	"14.gy/mec/abnf/r"
+)
+
+// TestTimesBounds parses with the counted repetitions A ( X ), A...B ( X ) and
+// the open bound A... ( X ), which only has a lower bound, and with what the
+// RFC 5234 forms 1*( X ) and *3( X ) import to.
+func TestTimesBounds(t *testing.T) {
+	tests := []struct {
+		format, grammar string
+		good, bad       []string
+	}{
+		{"", `:startRule(A) ; A = "a" 2 ( "x" ) "b" ;`, []string{"axxb"}, []string{"axb", "axxxb"}},
+		{"", `:startRule(A) ; A = "a" 0...3 ( "x" ) "b" ;`, []string{"ab", "axb", "axxxb"}, []string{"axxxxb"}},
+		{"", `:startRule(A) ; A = "a" 2... ( "x" ) "b" ;`, []string{"axxb", "axxxxxxxb"}, []string{"ab", "axb"}},
+		{"", `:startRule(A) ; A = "a" 1...( "x" ) "b" ;`, []string{"axb", "axxxb"}, []string{"ab"}},
+		{"rfc5234", `a = "a" 1*( "x" ) "b"`, []string{"axb", "axxxxb"}, []string{"ab"}},
+		{"rfc5234", `a = "a" *3( "x" ) "b"`, []string{"ab", "axxxb"}, []string{"axxxxb"}},
+	}
+	opts := &Parseropts{PreventDefaultOutput: true}
+	for _, test := range tests {
+		var g *r.Rules
+		var err error
+		if test.format == "" {
+			g, err = CompileGrammar(test.grammar, "times.abnf", 0, opts, true)
+		} else {
+			g, err = ImportGrammar(test.format, test.grammar, "times.abnf")
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.grammar, err)
+		}
+		for _, text := range test.good {
+			if _, err := ParseWithAgrammar(g, text, "good.txt", opts); err != nil {
+				t.Errorf("%s rejects %q: %v", test.grammar, text, err)
+			}
+		}
+		for _, text := range test.bad {
+			if _, err := ParseWithAgrammar(g, text, "bad.txt", opts); err == nil {
+				t.Errorf("%s accepts %q", test.grammar, text)
+			}
+		}
+	}
+}
@@ -70,7 +70,7 @@ func (ps *parserscript) HandleScriptRule(rule *r.Rule, localProductions *r.Rules
 // initFuncMap installs the parser specific JS API on top of the common one:
 // accessors for the parse state and a stack that survives between the :script() calls.
 func (ps *parserscript) initFuncMap() {
-	ps.common = NewCommonScript(ps.vm, &ps.compilerFuncMap, ps.preventDefaultOutput)
+	ps.common = NewCommonScript(ps.pa.sess, ps.vm, &ps.compilerFuncMap, ps.preventDefaultOutput)
 
 	ps.compilerFuncMap["getSrc"] = func() string { return ps.pa.Src }
 	ps.compilerFuncMap["setSrc"] = func(src string) { ps.pa.setSrc(src) }
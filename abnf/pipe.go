@@ -0,0 +1,56 @@
+package abnf
+
+// The structured channel of -pipe. The text a pipeline segment prints becomes
+// the program input of the next segment (main.go runPipeline); next to it, a
+// tag script can hand on a VALUE, without printing and re-parsing it:
+//
+//	emit(value)     in a segment: hand value to the next segment (the last
+//	                emit of the segment wins)
+//	c.input         in the next segment: the value, null when there is none
+//
+// The value is what the script passed - an ASG (c.asg, the result of
+// c.parse), an a-grammar, or a JSON-like object or array, which may hold them
+// - exported to Go the way goja exports it (an integral number as int64, an
+// object as a map[string]interface{}, an array as a []interface{}); the frozen
+// runtime's bridge converts the same way (jsrt.go toGoNatural). An ASG keeps
+// the tags of the grammar that parsed it, so c.compile(c.input) runs those.
+//
+// An embedder moves the value itself: Emitted after one call, SetInput before
+// the next.
+
+import "14.gy/mec/abnf/r"
+
+// pipeState is the session's side of the structured channel.
+type pipeState struct {
+	input   r.Object // The scripts' c.input (SetInput).
+	emitted r.Object // The last emit() of the scripts.
+	didEmit bool     // emitted is set (it may be nil: emit(null)).
+}
+
+// SetInput makes v the c.input of the session's scripts from the next Parse or
+// Compile on; nil is no input.
+func (s *Session) SetInput(v r.Object) {
+	s.pipe.input = v
+}
+
+// Emitted returns the value the session's scripts last emit()ted and clears it,
+// so the next call starts without one; ok is false when none did.
+func (s *Session) Emitted() (v r.Object, ok bool) {
+	v, ok = s.pipe.emitted, s.pipe.didEmit
+	s.pipe.emitted, s.pipe.didEmit = nil, false
+	return v, ok
+}
+
+// emit is the emit() of the tag scripts.
+func (s *Session) emit(v interface{}) {
+	s.pipe.emitted, s.pipe.didEmit = v, true
+}
+
+// frozenInput is c.input for the frozen runtime, which reads a nil of a Go map
+// as undefined: no input is null there too.
+func (s *Session) frozenInput() interface{} {
+	if s.pipe.input == nil {
+		return jsNull
+	}
+	return s.pipe.input
+}
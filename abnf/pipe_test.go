@@ -0,0 +1,64 @@
+package abnf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"14.gy/mec/abnf/r"
+)
+
+// TestPipeValues hands a value from the scripts of one grammar to those of the
+// next, the way -pipe does: emit() gives the same Go value on both engines, and
+// c.input reads it back - the ASG in it compiles with the tags that parsed it.
+func TestPipeValues(t *testing.T) {
+	producer := `:startRule(List) ;
+List = ( Item { "," Item } ) ;
+Item = @+"abc" <~~ push(up.in + "!") ~~> ;
+:startScript(~~
+    println("input: " + c.input)
+    emit({asg: c.asg, n: 2, f: 1.5, list: ["x", true, null]})
+~~) ;
+`
+	consumer := `:startRule(T) ;
+T = "A" ;
+:startScript(~~
+    println(c.input.n + " " + c.input.f + " " + c.input.list.length + " " + c.input.list[0])
+    let stack = c.compile(c.input.asg).stack
+    println(stack[0] + " " + stack[1])
+~~) ;
+`
+	bothEngines(t, func(t *testing.T, frozen bool) {
+		eng := NewEngine()
+		eng.Frozen = frozen
+		var out strings.Builder
+		s := eng.NewSession(&out, nil)
+
+		if _, err := runGrammar(t, producer, &grammarRun{sess: s, input: "a,bc"}); err != nil {
+			t.Fatal(err)
+		}
+		v, ok := s.Emitted()
+		m, isMap := v.(map[string]interface{})
+		if !ok || !isMap {
+			t.Fatalf("emitted %#v, %v", v, ok)
+		}
+		if _, isASG := m["asg"].(*r.Rules); !isASG {
+			t.Errorf("the emitted asg is a %T", m["asg"])
+		}
+		if got := fmt.Sprintf("%T %v %T %v %v", m["n"], m["n"], m["f"], m["f"], m["list"]); got != "int64 2 float64 1.5 [x true <nil>]" {
+			t.Errorf("emitted %s", got)
+		}
+		if _, again := s.Emitted(); again {
+			t.Errorf("Emitted did not clear the value")
+		}
+
+		s.SetInput(v)
+		if _, err := runGrammar(t, consumer, &grammarRun{sess: s}); err != nil {
+			t.Fatal(err)
+		}
+		want := "input: null\n2 1.5 3 x\na! bc!\n"
+		if out.String() != want {
+			t.Errorf("the scripts printed\n%s\nwant\n%s", out.String(), want)
+		}
+	})
+}
@@ -0,0 +1,516 @@
+package abnf
+
+// The -pdebug debugger: breakpoints and stepping in the programs llvm.RunJS
+// runs.
+//
+// The handle-IR compilers mark every statement with a js_srcpos call when the
+// host collects positions (lib/compile-core.js stmtPos), and under -pdebug the
+// marker carries the scope the statement runs in as well. A ProgramDebugger
+// hooks that marker in the program runtime (jsrt.go), so one debugger serves
+// every language whose Statement rule applies stmtPos, under goja and -frozen
+// alike. The call stack is the one the tracer keeps (trace.go): a frame per
+// call through rt.callH, named like the call events of -trace (calleeName),
+// with the program's entry function at the bottom. Stepping goes statement by
+// statement:
+//
+//	step    stop at the next statement
+//	next    stop at the next statement of this call or a caller
+//	out     stop at the next statement of a caller
+//
+// The breakpoints are the specs of -debug (ParseBreakpoint), read against the
+// program:
+//
+//	fib            the first statement of every call of fib
+//	prog.js:12     the statements that start on line 12 of the program file
+//	prog.js:12:5   ... at column 5
+//	@12, @12:5     the same, whatever the program file is called
+//
+// A line stops once each time the program comes to it: the statements nested
+// in one that stopped on the same line run through, the next pass of a loop
+// stops again.
+//
+// The variables of a frame are its scopes: the locals (the scopes of the call,
+// innermost first), the closure (the scopes the function was created in) and
+// the globals (the scopes of the first statement of the program). What those
+// held before the first statement ran is the runtime's and the language's
+// prelude and is left out, but for the functions the program declares up front
+// (those have statements with markers). The integer-IR programs of llvm.Run (TinyC, the C subset) have no
+// runtime to hook and do not stop.
+//
+// Like the Debugger of the compile walk, a ProgramDebugger hands every stop to
+// its Stopped function: DebugProgramLines is the line protocol of ./mec
+// -pdebug, main's debug.go serves the stops over the Debug Adapter Protocol.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"14.gy/mec/abnf/r"
+	"github.com/llir/llvm/ir"
+)
+
+// ProgramDebugger is the breakpoints and the stepping state of the programs of
+// a debugged run. Set it as Engine.ProgramDebugger. Only one program may run
+// under it at a time (no -batch).
+type ProgramDebugger struct {
+	DebugBreaks
+	// Stopped is told of every stop and answers how the program goes on. It
+	// runs on the goroutine of the program, which waits for it.
+	Stopped func(st *ProgramStop) DebugAction
+
+	sources   map[string]string // The program texts, by file (SetTraceSource).
+	tagStarts map[*r.Rule]int   // Where the ASG Tag nodes start, for up.start (parser.go).
+
+	started   bool
+	step      DebugAction
+	stepDepth int
+}
+
+// NewProgramDebugger returns a debugger that asks stopped at every stop.
+func NewProgramDebugger(stopped func(st *ProgramStop) DebugAction) *ProgramDebugger {
+	return &ProgramDebugger{Stopped: stopped, sources: map[string]string{}, tagStarts: map[*r.Rule]int{}}
+}
+
+// source remembers the text of a program file, for the lines of the stops.
+func (d *ProgramDebugger) source(file, text string) {
+	d.mu.Lock()
+	d.sources[filepath.Clean(file)] = text
+	d.mu.Unlock()
+}
+
+// ProgramFrame is one call on the stack of a stopped program.
+type ProgramFrame struct {
+	Function  string // The callee, named as -trace names it.
+	File      string
+	Line, Col int // The statement the call executes (0 before its first one, and in a host function).
+
+	scope *jsScope // The scope of that statement.
+	env   *jsScope // The scope the function was created in.
+}
+
+// ProgramStop is the program standing at the start of a statement. The values
+// its scopes show are the live ones; a front end only reads them.
+type ProgramStop struct {
+	Debugger   *ProgramDebugger
+	Reason     string      // "entry", "step" or "breakpoint".
+	Breakpoint *Breakpoint // The breakpoint that stopped the program (Reason "breakpoint").
+	Stack      []ProgramFrame
+	SourceLine string // The line of the program the statement starts on.
+
+	run *programRun
+}
+
+// Frame is the call the program stands in: the last of the stack.
+func (st *ProgramStop) Frame() *ProgramFrame {
+	return &st.Stack[len(st.Stack)-1]
+}
+
+// Where is the stop in one line: why, the function, and the position.
+func (st *ProgramStop) Where() string {
+	fr := st.Frame()
+	why := st.Reason
+	if st.Breakpoint != nil {
+		why = "breakpoint " + strconv.Itoa(st.Breakpoint.ID)
+	}
+	return fmt.Sprintf("stopped (%s): %s at %s:%d:%d", why, fr.Function, fr.File, fr.Line, fr.Col)
+}
+
+// ProgramScope is the variables of one scope of a frame, for a front end to
+// unfold with Fields.
+type ProgramScope struct {
+	Name   string // "locals", "closure" or "globals".
+	names  []string
+	values []interface{}
+}
+
+// Scopes returns the scopes of frame i of the stack (0 is the outermost) that
+// hold a variable, the locals first.
+func (st *ProgramStop) Scopes(i int) []*ProgramScope {
+	fr := &st.Stack[i]
+	root := st.run.rt.root
+	locals := &ProgramScope{Name: "locals"}
+	closure := &ProgramScope{Name: "closure"}
+	globals := &ProgramScope{Name: "globals"}
+	seen := map[string]bool{}
+	cur := locals
+	for sc := fr.scope; sc != nil; sc = sc.parent {
+		if sc == fr.env && sc != root {
+			cur = closure
+		}
+		if sc == root || st.run.prelude[sc] > 0 {
+			cur = globals
+		}
+		for j, n := range sc.names {
+			if j < st.run.prelude[sc] && !st.run.declared(sc.vals[j]) {
+				continue // Bound before the program began, by the runtime or the language's prelude.
+			}
+			if _, ok := sc.vals[j].(*jsScope); ok {
+				continue // A scope the compiled code keeps at hand (python's pyfn*), no variable.
+			}
+			if !seen[n] {
+				seen[n] = true
+				cur.names = append(cur.names, n)
+				cur.values = append(cur.values, sc.vals[j])
+			}
+		}
+	}
+	res := []*ProgramScope{}
+	for _, ps := range []*ProgramScope{locals, closure, globals} {
+		if len(ps.names) > 0 {
+			res = append(res, ps)
+		}
+	}
+	return res
+}
+
+// Lookup reads NAME, NAME.member or NAME[index] (and chains of them) in the
+// scopes of frame i, as the statement there would.
+func (st *ProgramStop) Lookup(i int, expr string) (interface{}, error) {
+	expr = strings.TrimSpace(expr)
+	n := 0
+	for n < len(expr) && (isLetter(expr[n]) || expr[n] == '_' || expr[n] == '$' || n > 0 && expr[n] >= '0' && expr[n] <= '9') {
+		n++
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("bad expression %q: want NAME, NAME.member or NAME[index]", expr)
+	}
+	name, rest := expr[:n], expr[n:]
+	var v interface{}
+	found := false
+	for sc := st.Stack[i].scope; sc != nil && !found; sc = sc.parent {
+		v, found = sc.get(name)
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not defined here", name)
+	}
+	for rest != "" {
+		var key string
+		switch {
+		case rest[0] == '.':
+			n := 1
+			for n < len(rest) && rest[n] != '.' && rest[n] != '[' {
+				n++
+			}
+			key, rest = rest[1:n], rest[n:]
+		case rest[0] == '[' && strings.IndexByte(rest, ']') > 1:
+			end := strings.IndexByte(rest, ']')
+			key, rest = rest[1:end], rest[end+1:]
+			if uq, err := strconv.Unquote(key); err == nil {
+				key = uq
+			}
+		default:
+			return nil, fmt.Errorf("bad expression %q: want NAME, NAME.member or NAME[index]", expr)
+		}
+		names, vals := st.Fields(v)
+		if arr, ok := v.(*jsArray); ok && key == "length" {
+			v = float64(len(arr.elems))
+			continue
+		}
+		found = false
+		for j, n := range names {
+			if n == key {
+				v, found = vals[j], true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s has no member %q", st.Value(v), key)
+		}
+	}
+	return v, nil
+}
+
+// Value renders a value of the program for a person: strings quoted, arrays
+// and objects spelled out a few levels deep, the rest as the program would
+// print it.
+func (st *ProgramStop) Value(v interface{}) string {
+	return clip(st.value(v, 3), 300)
+}
+
+func (st *ProgramStop) value(v interface{}, depth int) string {
+	rt := st.run.rt
+	switch t := v.(type) {
+	case nil:
+		return "undefined"
+	case string:
+		return strconv.Quote(t)
+	case *jsClosure, *hostFunc, *boundMethod:
+		return "function " + rt.calleeName(v)
+	case *jsArray, *jsObject:
+		names, vals := st.Fields(v)
+		_, list := v.(*jsArray)
+		if len(names) > 0 && depth == 0 {
+			if list {
+				return "[…]"
+			}
+			return "{…}"
+		}
+		parts := make([]string, len(vals))
+		for i, e := range vals {
+			parts[i] = st.value(e, depth-1)
+			if !list {
+				parts[i] = names[i] + ": " + parts[i]
+			}
+		}
+		if list {
+			return "[" + strings.Join(parts, ", ") + "]"
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return rt.toString(v)
+}
+
+// Fields returns the members of a value that has any - the variables of a
+// scope, the elements of an array, the properties of an object - for a front
+// end that unfolds it.
+func (st *ProgramStop) Fields(v interface{}) ([]string, []interface{}) {
+	if ps, ok := v.(*ProgramScope); ok {
+		return ps.names, ps.values
+	}
+	names, vals, _ := debugFields(v)
+	return names, vals
+}
+
+// ----------------------------------------------------------------------------
+// The program
+
+// programRun is one program running under the debugger (jsrt.dbg).
+type programRun struct {
+	d      *ProgramDebugger
+	rt     *jsrt
+	file   string
+	src    string
+	starts []int
+	frames []programFrame
+	// The scopes of the program's first statement, with the number of names
+	// each held then: the globals and their prelude.
+	prelude map[*jsScope]int
+	marked  map[*ir.Func]bool // Whether a function has statement markers.
+}
+
+// programFrame is a call of the program: the position and the scope of its
+// last statement, and the line it last stopped on.
+type programFrame struct {
+	name     string
+	pos      int
+	scope    *jsScope
+	env      *jsScope
+	started  bool
+	lastLine int
+	lastPos  int
+}
+
+// run starts debugging the program of rt, before anything of it ran.
+func (d *ProgramDebugger) run(rt *jsrt) *programRun {
+	d.mu.Lock()
+	src := d.sources[filepath.Clean(rt.sess.src.name)]
+	d.mu.Unlock()
+	return &programRun{d: d, rt: rt, file: rt.sess.src.name, src: src, starts: rt.sess.src.starts}
+}
+
+// declared reports whether v is a function compiled from the program: one
+// whose statements carry markers.
+func (p *programRun) declared(v interface{}) bool {
+	c, ok := v.(*jsClosure)
+	if !ok {
+		return false
+	}
+	if m, ok := p.marked[c.fn]; ok {
+		return m
+	}
+	m := false
+	for _, b := range c.fn.Blocks {
+		for _, inst := range b.Insts {
+			if call, ok := inst.(*ir.InstCall); ok && call.Callee.Ident() == "@js_srcpos" {
+				m = true
+			}
+		}
+	}
+	if p.marked == nil {
+		p.marked = map[*ir.Func]bool{}
+	}
+	p.marked[c.fn] = m
+	return m
+}
+
+// call puts a call of callee on the stack.
+func (p *programRun) call(name string, callee interface{}) {
+	env := p.rt.root
+	if c, ok := callee.(*jsClosure); ok && c.env != 0 {
+		if sc, ok := p.rt.unwrap(c.env).(*jsScope); ok {
+			env = sc
+		}
+	}
+	p.frames = append(p.frames, programFrame{name: name, pos: -1, scope: env, env: env})
+}
+
+// ret takes the innermost call off the stack.
+func (p *programRun) ret() {
+	if len(p.frames) > 0 {
+		p.frames = p.frames[:len(p.frames)-1]
+	}
+}
+
+// stmt is the program about to run the statement at pos, in the scope of the
+// handle scopeH. It decides whether the program stops, and stops it.
+func (p *programRun) stmt(pos int, scopeH uint64) {
+	if len(p.frames) == 0 {
+		return
+	}
+	d := p.d
+	depth := len(p.frames)
+	fr := &p.frames[depth-1]
+	fr.pos = pos
+	fr.scope = p.rt.root
+	if scopeH != 0 {
+		if sc, ok := p.rt.unwrap(scopeH).(*jsScope); ok {
+			fr.scope = sc
+		}
+	}
+	if p.prelude == nil {
+		p.prelude = map[*jsScope]int{}
+		for sc := fr.scope; sc != nil; sc = sc.parent {
+			p.prelude[sc] = len(sc.names)
+		}
+	}
+	line, col := lineColIn(pos, p.starts)
+	first := !fr.started
+	again := line != fr.lastLine || pos <= fr.lastPos
+	fr.started, fr.lastLine, fr.lastPos = true, line, pos
+
+	st := &ProgramStop{}
+	d.mu.Lock()
+	for _, bp := range d.breaks {
+		hit := first && bp.Production == fr.name
+		if bp.Production == "" {
+			hit = again && bp.Line == line && (bp.Col == 0 || bp.Col == col) && (bp.File == "" || sameDebugFile(bp.File, p.file))
+		}
+		if hit {
+			bp.Hits++
+			cp := *bp
+			st.Reason, st.Breakpoint = "breakpoint", &cp
+			break
+		}
+	}
+	d.mu.Unlock()
+	if st.Reason == "" {
+		switch {
+		case !d.started && d.StopOnEntry:
+			st.Reason = "entry"
+		case d.step == DebugStepIn,
+			d.step == DebugStepOver && depth <= d.stepDepth,
+			d.step == DebugStepOut && depth < d.stepDepth:
+			st.Reason = "step"
+		}
+	}
+	d.started = true
+	if st.Reason == "" || d.Stopped == nil {
+		return
+	}
+	st.Debugger, st.run = d, p
+	st.Stack = make([]ProgramFrame, len(p.frames))
+	for i, f := range p.frames {
+		st.Stack[i] = ProgramFrame{Function: f.name, File: p.file, scope: f.scope, env: f.env}
+		if f.pos >= 0 {
+			st.Stack[i].Line, st.Stack[i].Col = lineColIn(f.pos, p.starts)
+		}
+	}
+	if line > 0 && line <= len(p.starts) && p.starts[line-1] <= len(p.src) {
+		end := len(p.src)
+		if line < len(p.starts) && p.starts[line]-1 <= end {
+			end = p.starts[line] - 1
+		}
+		st.SourceLine = strings.TrimRight(p.src[p.starts[line-1]:end], "\r")
+	}
+	action := d.Stopped(st)
+	if action == DebugQuit {
+		p.rt.sess.exit(1)
+	}
+	d.step, d.stepDepth = action, depth
+}
+
+// ----------------------------------------------------------------------------
+// The line protocol
+
+const programDebugHelp = `commands:
+  c, continue      run to the next breakpoint
+  s, step          stop at the next statement
+  n, next          stop at the next statement of this call or a caller
+  o, out           stop at the next statement of the caller
+  b, break SPEC    set a breakpoint: FUNCTION, FILE:LINE[:COL] or @LINE[:COL]
+  d, delete [ID]   delete a breakpoint (all of them without an ID)
+  i, breaks        list the breakpoints
+  w, where         where the program stands, with the source line
+  bt               the call stack, innermost first
+  f, frame N       look at call N of bt (0 is where the program stands)
+  l, locals        the variables of the call
+  p, print EXPR    print NAME, NAME.member or NAME[index]
+  q, quit          end the run
+An empty line repeats c, s, n and o.
+`
+
+// DebugProgramLines returns the line protocol of ./mec -pdebug: at every stop
+// it writes where the program stands to out and reads commands from in until
+// one moves on. At the end of in the program runs on without stopping.
+func DebugProgramLines(in io.Reader, out io.Writer) func(st *ProgramStop) DebugAction {
+	p := &debugPrompt{br: bufio.NewReader(in), out: out, help: programDebugHelp}
+	return func(st *ProgramStop) DebugAction {
+		sel := len(st.Stack) - 1 // The frame bt, locals and print look at.
+		return p.run(&st.Debugger.DebugBreaks, st.Where(), func(cmd, arg string) bool {
+			switch cmd {
+			case "w", "where":
+				fmt.Fprintln(out, st.Where())
+				if st.SourceLine != "" {
+					fmt.Fprintf(out, "  %s\n  %s^\n", st.SourceLine, strings.Repeat(" ", st.Frame().Col-1))
+				}
+			case "bt":
+				for i := len(st.Stack) - 1; i >= 0; i-- {
+					fr := st.Stack[i]
+					mark := " "
+					if i == sel {
+						mark = "*"
+					}
+					fmt.Fprintf(out, "%s%2d  %s", mark, len(st.Stack)-1-i, fr.Function)
+					if fr.Line > 0 {
+						fmt.Fprintf(out, " at %s:%d:%d", fr.File, fr.Line, fr.Col)
+					}
+					fmt.Fprintln(out)
+				}
+			case "f", "frame":
+				n, err := strconv.Atoi(arg)
+				if err != nil || n < 0 || n >= len(st.Stack) {
+					fmt.Fprintf(out, "no frame %q\n", arg)
+					break
+				}
+				sel = len(st.Stack) - 1 - n
+				fr := st.Stack[sel]
+				fmt.Fprintf(out, "%2d  %s at %s:%d:%d\n", n, fr.Function, fr.File, fr.Line, fr.Col)
+			case "l", "locals":
+				scopes := st.Scopes(sel)
+				if len(scopes) == 0 {
+					fmt.Fprintln(out, "(no variables)")
+				}
+				for _, ps := range scopes {
+					fmt.Fprintln(out, ps.Name+":")
+					for i, n := range ps.names {
+						fmt.Fprintf(out, "  %s: %s\n", n, st.Value(ps.values[i]))
+					}
+				}
+			case "p", "print":
+				v, err := st.Lookup(sel, arg)
+				if err != nil {
+					fmt.Fprintln(out, err)
+				} else {
+					fmt.Fprintln(out, st.Value(v))
+				}
+			default:
+				return false
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package abnf
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestProgramDebugger drives the line protocol of -pdebug through a small
+// JavaScript program compiled by js-to-llvm-ir.abnf: a function and a line
+// breakpoint stop where they should, the call stack is the program's, and the
+// locals, globals and printed values are read from the runtime's scopes.
+func TestProgramDebugger(t *testing.T) {
+	grammar := filepath.Join("..", "languages", "js-to-llvm-ir.abnf")
+	prog := `function fib(n) {
+    if (n < 2) return n
+    var a = fib(n - 1)
+    return a + fib(n - 2)
+}
+var xs = [1, 2, 3]
+var o = {k: "v", n: xs}
+function main() {
+    for (var i = 0; i < 2; i++) {
+        println(i)
+    }
+}
+println(fib(2))
+`
+	cmds := strings.Join([]string{
+		"bt",        // The first call of fib, by its name.
+		"d 1",       // No more stops in fib,
+		"s",         // but a step goes to its next statement.
+		"l",         //
+		"p o.n[1]",  //
+		"p xs.size", //
+		"c",         // On to the loop, by its line.
+		"w",         //
+		"c",         // The line comes again in the next round.
+		"p i",       //
+		"c",
+	}, "\n") + "\n"
+	want := `stopped (breakpoint 1): fib at prog.js:2:5
+* 0  fib at prog.js:2:5
+  1  jsmain at prog.js:13:1
+stopped (step): fib at prog.js:3:5
+locals:
+  this: undefined
+  n: 2
+  arguments: [2]
+globals:
+  fib: function fib
+  xs: [1, 2, 3]
+  o: {k: "v", n: [1, 2, 3]}
+  main: function main
+2
+[1, 2, 3] has no member "size"
+stopped (breakpoint 2): main at prog.js:10:9
+stopped (breakpoint 2): main at prog.js:10:9
+          println(i)
+          ^
+stopped (breakpoint 2): main at prog.js:10:9
+1
+`
+	eng := NewEngine()
+	eng.CatchExit = true // The -to-llvm-ir grammars end with exit(result).
+	var log, out, warn strings.Builder
+	eng.ProgramDebugger = NewProgramDebugger(DebugProgramLines(strings.NewReader(cmds), &log))
+	for _, b := range []string{"fib", "prog.js:10"} {
+		if _, err := eng.ProgramDebugger.Break(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := eng.NewSession(&out, &warn)
+	grammarSrc, err := s.readHostFile(grammar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.RunPipeline([]string{grammar, "prog.js"}, []string{string(grammarSrc), prog}, nil)
+	var exit *ExitError
+	if errors.As(err, &exit) && exit.Code == 0 {
+		err = nil
+	}
+	if err != nil {
+		t.Fatalf("%v\n%s", err, warn.String())
+	}
+	if got := strings.ReplaceAll(log.String(), "(debug) ", ""); got != want {
+		t.Errorf("the session went\n%s\nwant\n%s", got, want)
+	}
+	if !strings.Contains(out.String(), "1\n0\n1\n") {
+		t.Errorf("the program printed %q, want fib(2) and the loop", out.String())
+	}
+}
@@ -1,6 +1,9 @@
 package r
 
-import "strconv"
+import (
+	"strconv"
+	"strings"
+)
 
 // ----------------------------------------------------------------------------
 // Scripting subsystem mapping for the a-grammar rules
@@ -189,3 +192,18 @@ var AbnfFuncMap = map[string]Object{
 		"ASCII":        NumberTypeASCII,
 	},
 }
+
+// RulesFileFormat is the encoding abnf.saveRules writes fileName in: format,
+// or without one JSON for a name ending in .json and binary for every other.
+// saveRules and loadRules themselves are not in AbnfFuncMap: they touch files,
+// so every script gets the ones of its Session (abnf/hostfs.go), which resolve
+// the name like load() and store() and go through the sandbox.
+func RulesFileFormat(fileName, format string) string {
+	if format != "" {
+		return format
+	}
+	if strings.HasSuffix(strings.ToLower(fileName), ".json") {
+		return MarshalJSON
+	}
+	return MarshalBinary
+}
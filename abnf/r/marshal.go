@@ -0,0 +1,291 @@
+package r
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ----------------------------------------------------------------------------
+// Interchange format for a-grammars and ASGs
+//
+// Serialize() writes Go literals, which only the Go compiler reads back (that is
+// how agrammar.go exists). Marshal and Unmarshal are the round trip for
+// everything else: a pipeline stage saves the a-grammar or ASG it built, and a
+// later process loads it without parsing anything again.
+//
+// Both encodings keep all six fields of every rule, Pos included (an ASG needs
+// it for error messages), and keep a nil child list apart from an empty one.
+// The Int links (Identifier to Production, Tag to code UID) are stored as they
+// are; the parser recomputes them before it uses a grammar anyway.
+//
+// JSON is for reading and for other tools:
+//
+//	{"format": "mec-rules", "version": 1, "rules": [
+//	    {"Operator": "Production", "String": "A", "Pos": 12, "Childs": [
+//	        {"Operator": "Token", "String": "a", "Pos": 16}]}]}
+//
+// A String that is no valid UTF-8 (a byte token like "\xff") would come back as
+// U+FFFD, so it is written as base64 in "Bytes" instead. Zero fields are left
+// out.
+//
+// The binary encoding is compact: the magic "MECR", the version byte, then the
+// rule list. A list is uvarint(len+1), 0 for nil. A rule is its Operator byte
+// (0xff for a nil rule), uvarint(len) and the String bytes, varint Int, varint
+// Pos, the Childs list and the CodeChilds list. The Operator byte is the
+// OperatorID; reordering those constants needs a new MarshalVersion.
+
+// MarshalVersion is the version both encodings write. Unmarshal reads this
+// version and all older ones.
+const MarshalVersion = 1
+
+// The encodings that Marshal writes. JS-Mapping: the format of abnf.saveRules.
+const (
+	MarshalJSON   = "json"
+	MarshalBinary = "binary"
+)
+
+const (
+	marshalMagic  = "MECR"
+	marshalFormat = "mec-rules" // The "format" member of the JSON encoding.
+	marshalNil    = 0xff        // The Operator byte of a nil rule.
+)
+
+// Marshal encodes rules (an a-grammar or an ASG) as format, MarshalJSON or
+// MarshalBinary.
+func Marshal(rules *Rules, format string) ([]byte, error) {
+	switch format {
+	case MarshalJSON:
+		doc := jsonDoc{Format: marshalFormat, Version: MarshalVersion, Rules: toJSONRules(rules)}
+		return json.MarshalIndent(doc, "", " ")
+	case MarshalBinary:
+		var b bytes.Buffer
+		b.WriteString(marshalMagic)
+		b.WriteByte(MarshalVersion)
+		writeBinaryRules(&b, rules)
+		return b.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown rules format %q (want %s or %s)", format, MarshalJSON, MarshalBinary)
+}
+
+// Unmarshal decodes what Marshal wrote; the encoding is detected from the data.
+func Unmarshal(data []byte) (*Rules, error) {
+	if bytes.HasPrefix(data, []byte(marshalMagic)) {
+		return readBinary(data[len(marshalMagic):])
+	}
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		var doc jsonDoc
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if doc.Format != marshalFormat {
+			return nil, fmt.Errorf("not a rules file (format %q, want %q)", doc.Format, marshalFormat)
+		}
+		if doc.Version < 1 || doc.Version > MarshalVersion {
+			return nil, fmt.Errorf("rules version %d is not supported (up to %d)", doc.Version, MarshalVersion)
+		}
+		return fromJSONRules(doc.Rules)
+	}
+	return nil, errors.New("not a rules file (neither JSON nor binary)")
+}
+
+// ---------------
+// JSON
+
+type jsonDoc struct {
+	Format  string       `json:"format"`
+	Version int          `json:"version"`
+	Rules   *[]*jsonRule `json:"rules"`
+}
+
+type jsonRule struct {
+	Operator   string       `json:"Operator"`
+	String     string       `json:"String,omitempty"`
+	Bytes      []byte       `json:"Bytes,omitempty"` // String, if it is no valid UTF-8.
+	Int        int          `json:"Int,omitempty"`
+	Pos        int          `json:"Pos,omitempty"`
+	Childs     *[]*jsonRule `json:"Childs,omitempty"`
+	CodeChilds *[]*jsonRule `json:"CodeChilds,omitempty"`
+}
+
+func toJSONRules(rules *Rules) *[]*jsonRule {
+	if rules == nil {
+		return nil
+	}
+	res := make([]*jsonRule, len(*rules))
+	for i, rule := range *rules {
+		if rule == nil {
+			continue
+		}
+		jr := &jsonRule{Operator: rule.Operator.String(), Int: rule.Int, Pos: rule.Pos, Childs: toJSONRules(rule.Childs), CodeChilds: toJSONRules(rule.CodeChilds)}
+		if utf8.ValidString(rule.String) {
+			jr.String = rule.String
+		} else {
+			jr.Bytes = []byte(rule.String)
+		}
+		res[i] = jr
+	}
+	return &res
+}
+
+// operatorIDs maps the Operator names back to their IDs.
+var operatorIDs = func() map[string]OperatorID {
+	m := map[string]OperatorID{}
+	for id := Error; id <= Identifier; id++ {
+		m[id.String()] = id
+	}
+	return m
+}()
+
+func fromJSONRules(list *[]*jsonRule) (*Rules, error) {
+	if list == nil {
+		return nil, nil
+	}
+	res := make(Rules, len(*list))
+	for i, jr := range *list {
+		if jr == nil {
+			continue
+		}
+		op, ok := operatorIDs[jr.Operator]
+		if !ok {
+			return nil, fmt.Errorf("unknown Operator %q", jr.Operator)
+		}
+		rule := &Rule{Operator: op, String: jr.String, Int: jr.Int, Pos: jr.Pos}
+		if jr.Bytes != nil {
+			rule.String = string(jr.Bytes)
+		}
+		var err error
+		if rule.Childs, err = fromJSONRules(jr.Childs); err != nil {
+			return nil, err
+		}
+		if rule.CodeChilds, err = fromJSONRules(jr.CodeChilds); err != nil {
+			return nil, err
+		}
+		res[i] = rule
+	}
+	return &res, nil
+}
+
+// ---------------
+// Binary
+
+func writeBinaryRules(b *bytes.Buffer, rules *Rules) {
+	var buf [binary.MaxVarintLen64]byte
+	if rules == nil {
+		b.WriteByte(0)
+		return
+	}
+	b.Write(buf[:binary.PutUvarint(buf[:], uint64(len(*rules))+1)])
+	for _, rule := range *rules {
+		if rule == nil {
+			b.WriteByte(marshalNil)
+			continue
+		}
+		b.WriteByte(byte(rule.Operator))
+		b.Write(buf[:binary.PutUvarint(buf[:], uint64(len(rule.String)))])
+		b.WriteString(rule.String)
+		b.Write(buf[:binary.PutVarint(buf[:], int64(rule.Int))])
+		b.Write(buf[:binary.PutVarint(buf[:], int64(rule.Pos))])
+		writeBinaryRules(b, rule.Childs)
+		writeBinaryRules(b, rule.CodeChilds)
+	}
+}
+
+// binaryReader reads the binary encoding; the first error sticks.
+type binaryReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func readBinary(data []byte) (*Rules, error) {
+	if len(data) == 0 {
+		return nil, errors.New("truncated rules file")
+	}
+	if version := int(data[0]); version < 1 || version > MarshalVersion {
+		return nil, fmt.Errorf("rules version %d is not supported (up to %d)", version, MarshalVersion)
+	}
+	br := &binaryReader{data: data, pos: 1}
+	rules := br.rules()
+	if br.err == nil && br.pos != len(data) {
+		br.fail("trailing data")
+	}
+	if br.err != nil {
+		return nil, br.err
+	}
+	return rules, nil
+}
+
+func (br *binaryReader) fail(msg string) {
+	if br.err == nil {
+		br.err = fmt.Errorf("corrupt rules file at byte %d: %s", len(marshalMagic)+br.pos, msg)
+	}
+}
+
+func (br *binaryReader) uvarint() uint64 {
+	n, size := binary.Uvarint(br.data[br.pos:])
+	if size <= 0 {
+		br.fail("bad number")
+		br.pos = len(br.data)
+		return 0
+	}
+	br.pos += size
+	return n
+}
+
+func (br *binaryReader) varint() int {
+	n, size := binary.Varint(br.data[br.pos:])
+	if size <= 0 {
+		br.fail("bad number")
+		br.pos = len(br.data)
+		return 0
+	}
+	br.pos += size
+	return int(n)
+}
+
+func (br *binaryReader) rules() *Rules {
+	n := br.uvarint()
+	if br.err != nil || n == 0 {
+		return nil
+	}
+	if n-1 > uint64(len(br.data)-br.pos) { // Every rule takes a byte at least.
+		br.fail("list too long")
+		return nil
+	}
+	res := make(Rules, n-1)
+	for i := range res {
+		if br.pos >= len(br.data) {
+			br.fail("truncated")
+			return nil
+		}
+		op := br.data[br.pos]
+		br.pos++
+		if op == marshalNil {
+			continue
+		}
+		if OperatorID(op) > Identifier {
+			br.fail(fmt.Sprintf("unknown Operator %d", op))
+			return nil
+		}
+		size := br.uvarint()
+		if size > uint64(len(br.data)-br.pos) {
+			br.fail("truncated string")
+			return nil
+		}
+		rule := &Rule{Operator: OperatorID(op), String: string(br.data[br.pos : br.pos+int(size)])}
+		br.pos += int(size)
+		rule.Int = br.varint()
+		rule.Pos = br.varint()
+		rule.Childs = br.rules()
+		rule.CodeChilds = br.rules()
+		if br.err != nil {
+			return nil
+		}
+		res[i] = rule
+	}
+	return &res
+}
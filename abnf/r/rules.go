@@ -3,6 +3,8 @@ package r
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"unsafe"
 )
 
 // ----------------------------------------------------------------------------
@@ -47,10 +49,14 @@ type Rule struct {
 	Childs     *Rules // The child rules. Used by most Operators.
 	CodeChilds *Rules // The parameters or the code. Only used when Operator == Tag | Command | Range | Times.
 
-	// Cache for SeqWrapper(), see there. Derived data only: it never influences what
-	// this rule means, and Serialize()/Clone() ignore it.
-	seqWrap   *Rule
-	seqChilds *Rules
+	// Cache for SeqWrapper(), see there: a *seqWrapper. Derived data only: it never
+	// influences what this rule means, and Serialize()/Clone() ignore it.
+	seqWrap unsafe.Pointer
+}
+
+type seqWrapper struct {
+	wrap   *Rule
+	childs *Rules
 }
 
 // SeqWrapper returns the synthetic ' Sequence(childs) ' rule that the parser applies
@@ -68,13 +74,17 @@ type Rule struct {
 // nothing about the rule's meaning changes, and childs is checked, so a grammar whose
 // Identifier links moved (an :include() between two parses) rebuilds instead of reusing
 // a stale wrapper.
+//
+// Sessions that parse with one a-grammar at the same time (abnf.Session.Fork) all fill
+// this cache, so the wrapper and the childs it was built for are published together,
+// in one atomic store: a parser sees either no wrapper or a complete one.
 func (rule *Rule) SeqWrapper(childs *Rules) *Rule {
-	if rule.seqWrap != nil && rule.seqChilds == childs {
-		return rule.seqWrap
+	if w := (*seqWrapper)(atomic.LoadPointer(&rule.seqWrap)); w != nil && w.childs == childs {
+		return w.wrap
 	}
-	rule.seqWrap = &Rule{Operator: Sequence, Childs: childs, Pos: rule.Pos}
-	rule.seqChilds = childs
-	return rule.seqWrap
+	w := &seqWrapper{wrap: &Rule{Operator: Sequence, Childs: childs, Pos: rule.Pos}, childs: childs}
+	atomic.StorePointer(&rule.seqWrap, unsafe.Pointer(w))
+	return w.wrap
 }
 
 // Type of a Range String. JS-Mapping: abnf.rangeType
@@ -0,0 +1,306 @@
+package abnf
+
+// Railroad diagrams (-export railroad): one standalone SVG per production,
+// rendered here without any external tool.
+//
+// The layout is the classic one: a diagram is a tree of nodes, each with a
+// width and the extent above (up) and below (down) the line it is entered and
+// left on. A sequence chains its items on that line, a choice stacks its
+// alternatives below the first one with a curve to each, and a repetition
+// draws its item on the line and the way back below it. Optional is a choice
+// between nothing and the item, { } an optional one-or-more loop, and Times a
+// loop labeled with its counts. Tags are drawn as the rules inside them (their
+// code is no syntax), a lookahead as a dashed box, and commands as a plain
+// label. A production reference links to the diagram of that production, so the
+// files of one export can be browsed like the grammar.
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf/r"
+)
+
+// The geometry in px: the chars are monospace, rrCharW wide.
+const (
+	rrCharW   = 8
+	rrBoxH    = 22 // A box is entered in the middle: up = down = rrBoxH/2.
+	rrGap     = 10 // The line between two items of a sequence.
+	rrArc     = 10 // The radius of the curves; a choice or loop takes 2*rrArc on each side.
+	rrVGap    = 10 // The space between the alternatives of a choice.
+	rrLabelH  = 14
+	rrPadding = 20
+)
+
+type rrKind int
+
+const (
+	rrSkip rrKind = iota
+	rrTerminal
+	rrNonTerminal
+	rrLookahead
+	rrComment
+	rrSeq
+	rrChoice
+	rrLoop
+)
+
+type rrNode struct {
+	kind        rrKind
+	text        string    // The text of a box or comment; the label of a loop.
+	items       []*rrNode // The items of a sequence or choice, or the one item of a loop.
+	w, up, down int
+}
+
+func rrBox(kind rrKind, text string) *rrNode {
+	text = clip(text, 40)
+	return &rrNode{kind: kind, text: text, w: utf8.RuneCountInString(text)*rrCharW + 20, up: rrBoxH / 2, down: rrBoxH / 2}
+}
+
+func rrSequence(items []*rrNode) *rrNode {
+	var kept []*rrNode
+	for _, item := range items {
+		if item.kind == rrSeq {
+			kept = append(kept, item.items...)
+		} else if item.kind != rrSkip {
+			kept = append(kept, item)
+		}
+	}
+	switch len(kept) {
+	case 0:
+		return &rrNode{kind: rrSkip}
+	case 1:
+		return kept[0]
+	}
+	n := &rrNode{kind: rrSeq, items: kept}
+	for i, item := range kept {
+		if i > 0 {
+			n.w += rrGap
+		}
+		n.w += item.w
+		n.up = rrMax(n.up, item.up)
+		n.down = rrMax(n.down, item.down)
+	}
+	return n
+}
+
+func rrAlternatives(items []*rrNode) *rrNode {
+	if len(items) == 1 {
+		return items[0]
+	}
+	n := &rrNode{kind: rrChoice, items: items, up: items[0].up, down: items[0].down}
+	inner := 0
+	for i, item := range items {
+		inner = rrMax(inner, item.w)
+		if i > 0 {
+			n.down += rrVGap + rrMax(item.up, 2*rrArc-n.down-rrVGap) + item.down
+		}
+	}
+	n.w = inner + 4*rrArc
+	return n
+}
+
+func rrOneOrMore(item *rrNode, label string) *rrNode {
+	n := &rrNode{kind: rrLoop, items: []*rrNode{item}, text: label, w: item.w + 4*rrArc, up: item.up, down: rrMax(item.down, rrArc) + rrArc}
+	if label != "" {
+		n.down += rrLabelH
+		n.w = rrMax(n.w, utf8.RuneCountInString(label)*rrCharW+4*rrArc)
+	}
+	return n
+}
+
+// rrOf converts a rule list (a sequence) into nodes.
+func rrOf(rules *r.Rules) *rrNode {
+	if rules == nil {
+		return &rrNode{kind: rrSkip}
+	}
+	var items []*rrNode
+	for _, rule := range *rules {
+		items = append(items, rrRule(rule))
+	}
+	return rrSequence(items)
+}
+
+func rrRule(rule *r.Rule) *rrNode {
+	switch rule.Operator {
+	case r.Sequence, r.Group, r.Tag:
+		return rrOf(rule.Childs)
+	case r.Or:
+		var alts []*rrNode
+		for _, alt := range *rule.Childs {
+			alts = append(alts, rrRule(alt))
+		}
+		return rrAlternatives(alts)
+	case r.Optional:
+		return rrAlternatives([]*rrNode{{kind: rrSkip}, rrOf(rule.Childs)})
+	case r.Repeat:
+		return rrAlternatives([]*rrNode{{kind: rrSkip}, rrOneOrMore(rrOf(rule.Childs), "")})
+	case r.Times:
+		from, to, ok := timesBounds(rule)
+		label := "? times"
+		switch {
+		case !ok:
+		case to < 0:
+			label = strconv.Itoa(from) + " or more times"
+		case to == from:
+			label = strconv.Itoa(from) + " times"
+		default:
+			label = strconv.Itoa(from) + " to " + strconv.Itoa(to) + " times"
+		}
+		return rrOneOrMore(rrOf(rule.Childs), label)
+	case r.Token:
+		return rrBox(rrTerminal, strconv.Quote(rule.String))
+	case r.Identifier:
+		return rrBox(rrNonTerminal, rule.String)
+	case r.Range:
+		if from, to, ok := rangeBounds(rule); ok {
+			return rrBox(rrTerminal, strconv.QuoteRune(from)+"-"+strconv.QuoteRune(to))
+		}
+		return rrBox(rrComment, covLabel(rule))
+	case r.CharOf, r.CharsOf:
+		label := "one of "
+		if rule.Int&r.CharTypeNegated != 0 {
+			label = "none of "
+		}
+		if rule.Operator == r.CharsOf {
+			label = strings.Replace(label, "one", "some", 1)
+		}
+		return rrBox(rrTerminal, label+strconv.Quote(rule.String))
+	case r.Not:
+		return rrBox(rrLookahead, "not "+covLabel(&r.Rule{Operator: r.Sequence, Childs: rule.Childs}))
+	case r.Command:
+		n := rrBox(rrComment, covLabel(rule))
+		n.w -= 10
+		return n
+	}
+	return rrBox(rrComment, covLabel(rule))
+}
+
+type rrWriter struct {
+	b strings.Builder
+}
+
+func (w *rrWriter) path(format string, args ...interface{}) {
+	fmt.Fprintf(&w.b, "<path d=\""+format+"\"/>\n", args...)
+}
+
+func (w *rrWriter) line(x1, y, x2 int) {
+	if x2 > x1 {
+		w.path("M%d %dH%d", x1, y, x2)
+	}
+}
+
+// draw draws n with its entry at (x, y).
+func (w *rrWriter) draw(n *rrNode, x, y int) {
+	switch n.kind {
+	case rrSkip:
+		w.line(x, y, x+n.w)
+	case rrTerminal, rrNonTerminal, rrLookahead:
+		class, radius := "t", rrBoxH/2
+		switch n.kind {
+		case rrNonTerminal:
+			class, radius = "n", 0
+			fmt.Fprintf(&w.b, "<a href=\"%s.svg\">", html.EscapeString(exportIdent(n.text, false)))
+		case rrLookahead:
+			class, radius = "l", 4
+		}
+		fmt.Fprintf(&w.b, "<rect class=\"%s\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"%d\"/>", class, x, y-rrBoxH/2, n.w, rrBoxH, radius)
+		fmt.Fprintf(&w.b, "<text x=\"%d\" y=\"%d\">%s</text>", x+n.w/2, y+4, html.EscapeString(n.text))
+		if n.kind == rrNonTerminal {
+			w.b.WriteString("</a>")
+		}
+		w.b.WriteByte('\n')
+	case rrComment:
+		fmt.Fprintf(&w.b, "<text class=\"c\" x=\"%d\" y=\"%d\">%s</text>\n", x+n.w/2, y-4, html.EscapeString(n.text))
+		w.line(x, y, x+n.w)
+	case rrSeq:
+		for i, item := range n.items {
+			if i > 0 {
+				w.line(x, y, x+rrGap)
+				x += rrGap
+			}
+			w.draw(item, x, y)
+			x += item.w
+		}
+	case rrChoice:
+		left, right := x+2*rrArc, x+n.w-2*rrArc
+		w.line(x, y, left)
+		w.line(right, y, x+n.w)
+		yi := y
+		down := 0
+		for i, item := range n.items {
+			if i > 0 {
+				yi = y + down + rrVGap + rrMax(item.up, 2*rrArc-down-rrVGap)
+				w.path("M%d %dQ%d %d %d %dV%dQ%d %d %d %d", x, y, x+rrArc, y, x+rrArc, y+rrArc, yi-rrArc, x+rrArc, yi, left, yi)
+				w.path("M%d %dQ%d %d %d %dV%dQ%d %d %d %d", right, yi, right+rrArc, yi, right+rrArc, yi-rrArc, y+rrArc, right+rrArc, y, x+n.w, y)
+			}
+			w.draw(item, left, yi)
+			w.line(left+item.w, yi, right)
+			down = yi - y + item.down
+		}
+	case rrLoop:
+		item := n.items[0]
+		left, right := x+2*rrArc, x+n.w-2*rrArc
+		w.line(x, y, left)
+		w.draw(item, left, y)
+		w.line(left+item.w, y, x+n.w)
+		back := y + rrMax(item.down, rrArc) + rrArc
+		w.path("M%d %dQ%d %d %d %dV%dQ%d %d %d %dH%dQ%d %d %d %dV%dQ%d %d %d %d",
+			right, y, right+rrArc, y, right+rrArc, y+rrArc, back-rrArc, right+rrArc, back, right, back,
+			left, x+rrArc, back, x+rrArc, back-rrArc, y+rrArc, x+rrArc, y, left, y)
+		if n.text != "" {
+			fmt.Fprintf(&w.b, "<text class=\"c\" x=\"%d\" y=\"%d\">%s</text>\n", x+n.w/2, back+rrLabelH-2, html.EscapeString(n.text))
+		}
+	}
+}
+
+// railroad renders the diagram of one production as a standalone SVG document.
+func (ex *exporter) railroad(prod *r.Rule) string {
+	body := rrOf(prod.Childs)
+	const title = 24
+	width := body.w + 2*rrPadding + 2*rrGap
+	width = rrMax(width, utf8.RuneCountInString(prod.String)*rrCharW+2*rrPadding)
+	height := title + body.up + body.down + 2*rrPadding
+	y := title + rrPadding + body.up
+
+	var w rrWriter
+	fmt.Fprintf(&w.b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width, height, width, height)
+	w.b.WriteString(`<style>
+path { fill: none; stroke: #333; stroke-width: 1.5; }
+rect { stroke: #333; stroke-width: 1.5; }
+rect.t { fill: #e8f4e8; }
+rect.n { fill: #fdf3dc; }
+rect.l { fill: #fff; stroke-dasharray: 4 3; }
+text { font: 13px monospace; text-anchor: middle; }
+text.c { font-size: 11px; fill: #666; }
+text.title { font-weight: bold; text-anchor: start; }
+a:hover rect { fill: #fbe3a6; }
+</style>
+`)
+	fmt.Fprintf(&w.b, "<title>%s</title>\n", html.EscapeString(prod.String))
+	fmt.Fprintf(&w.b, "<text class=\"title\" x=\"%d\" y=\"%d\">%s", rrPadding, rrPadding, html.EscapeString(prod.String))
+	if prod.String == ex.start {
+		w.b.WriteString(" (start)")
+	}
+	w.b.WriteString("</text>\n")
+	// The entry and exit marks, and the body between them.
+	x := rrPadding
+	w.path("M%d %dv%dM%d %dv%d", x, y-rrArc, 2*rrArc, x+4, y-rrArc, 2*rrArc)
+	w.line(x, y, x+rrGap)
+	w.draw(body, x+rrGap, y)
+	x += rrGap + body.w
+	w.line(x, y, x+rrGap)
+	w.path("M%d %dv%dM%d %dv%d", x+rrGap-4, y-rrArc, 2*rrArc, x+rrGap, y-rrArc, 2*rrArc)
+	w.b.WriteString("</svg>\n")
+	return w.b.String()
+}
+
+func rrMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
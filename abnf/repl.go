@@ -0,0 +1,106 @@
+package abnf
+
+// -repl: read statements and run them one by one in the scope of a program.
+//
+//	./mec -repl languages/python-interpreter.abnf [prog.py]
+//
+// The grammar does the work; the engine only lends it what a tag script cannot
+// do itself (Engine.Repl, read by the scripts as c.repl):
+//
+//   - c.replRead(prompt) reads the next line, or answers null at the end of the
+//     input. The prompt goes to the warning writer, so a session's output stays
+//     exactly the program's.
+//   - c.replParse(agrammar, text, rule, final) parses text from the named
+//     production, like c.parseFrom, but a text that merely ENDS too early is not
+//     an error unless final is set: it answers "" for it, so the grammar reads a
+//     continuation line. Any other failure answers its message, a success the
+//     ASG.
+//   - llvm.RunJSLine(m, fn) runs one more module in the runtime a -to-llvm-ir
+//     program ran in under llvm.RunJS. The program hands its top-level scope over
+//     with the js_repl_scope extern; fn(env, args) gets that scope as env, so
+//     what a line declares there, the next line sees. This is the incremental
+//     module: one small module per line, attached next to the program's.
+//
+// The loops themselves are replLoop (lib/interp-core.js) and replLoopIR
+// (lib/compile-core.js).
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"14.gy/mec/abnf/r"
+	"github.com/llir/llvm/ir"
+)
+
+// replState is what a -repl session keeps between the lines.
+type replState struct {
+	in    *bufio.Reader
+	rt    *jsrt    // The runtime of the llvm.RunJS program, which the lines run in.
+	scope *jsScope // The program's top-level scope (js_repl_scope).
+}
+
+// replRead is c.replRead: the next input line without its line break, or nil at
+// the end of the input.
+func (s *Session) replRead(prompt string) interface{} {
+	if s.repl.in == nil {
+		in := s.ReplInput
+		if in == nil {
+			in = os.Stdin
+		}
+		s.repl.in = bufio.NewReader(in)
+	}
+	fmt.Fprint(s.warn, prompt)
+	line, err := s.repl.in.ReadString('\n')
+	if err != nil && line == "" {
+		if err != io.EOF {
+			fmt.Fprintln(s.warn, err)
+		}
+		fmt.Fprintln(s.warn)
+		return nil
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// replParse is c.replParse: the ASG of text parsed from rule, "" for a text that
+// ends before the parse could (unless final), or the first line of the failure
+// message - the position; the dump of what did parse is no help at a prompt.
+func (s *Session) replParse(agrammar *r.Rules, text, rule string, final bool) interface{} {
+	asg, err := s.parse(agrammar, text, "(repl)", &Parseropts{StartRule: rule})
+	if err == nil {
+		return asg
+	}
+	if e, ok := err.(*ParseError); ok && e.atEnd && !final {
+		return ""
+	}
+	msg := err.Error()
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	return msg
+}
+
+// runJSLine is llvm.RunJSLine. A line that fails reports it to the warning
+// writer and answers 1, and the session goes on with the next; exit(n) still
+// ends it.
+func (s *Session) runJSLine(m *ir.Module, fn string) (res *RunResult) {
+	rt := s.repl.rt
+	if rt == nil || s.repl.scope == nil {
+		panic("llvm.RunJSLine: no program has run under -repl to run a line in (llvm.RunJS and js_repl_scope first)")
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			f := rt.programFailure(p)
+			if _, ok := f.(*ExitError); ok {
+				panic(f)
+			}
+			fmt.Fprintln(s.warn, f)
+			res = &RunResult{Ret: 1}
+		}
+	}()
+	ma := rt.attach(m)
+	h := rt.callEntry(ma, fn, rt.wrap(s.repl.scope))
+	return &RunResult{Ret: uint32(rt.toInt32(rt.unwrap(h)))}
+}
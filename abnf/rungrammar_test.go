@@ -0,0 +1,73 @@
+package abnf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"14.gy/mec/abnf/r"
+)
+
+// grammarRun says how runGrammar runs a grammar; the zero value parses "A"
+// with a new goja engine, the grammar in a new temp dir.
+type grammarRun struct {
+	frozen bool
+	dir    string        // The grammar's directory (g.abnf in it); a new temp dir if empty.
+	input  string        // The program text; "A" if empty.
+	engine func(*Engine) // Binds, sandboxes ... the new engine before its session starts.
+	sess   *Session      // Runs in this session instead of a new engine's.
+	asg    *r.Rules      // Set by runGrammar: what the program parsed to.
+}
+
+// runGrammar writes src to the grammar file, compiles it, parses the program
+// with it and compiles that, the way the stages of a run do. It returns what
+// the scripts printed; what they warned is appended to a failure.
+func runGrammar(t *testing.T, src string, o *grammarRun) (string, error) {
+	t.Helper()
+	if o.dir == "" {
+		o.dir = t.TempDir()
+	}
+	if o.input == "" {
+		o.input = "A"
+	}
+	grammarFile := filepath.Join(o.dir, "g.abnf")
+	if err := os.WriteFile(grammarFile, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out, warn strings.Builder
+	s := o.sess
+	if s == nil {
+		eng := NewEngine()
+		eng.Frozen = o.frozen
+		if o.engine != nil {
+			o.engine(eng)
+		}
+		s = eng.NewSession(&out, &warn)
+	}
+	g, err := s.CompileGrammar(src, grammarFile, 0, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.asg, err = s.Parse(g, o.input, filepath.Join(o.dir, "prog.txt"), nil)
+	if err == nil {
+		_, err = s.Compile(o.asg, g, "prog.txt", 0, false, false)
+	}
+	if err != nil && warn.Len() > 0 {
+		err = fmt.Errorf("%w\n%s", err, warn.String())
+	}
+	return out.String(), err
+}
+
+// bothEngines runs f as a subtest under goja and under -frozen: the scripts
+// must behave the same on both.
+func bothEngines(t *testing.T, f func(t *testing.T, frozen bool)) {
+	for _, frozen := range []bool{false, true} {
+		name := "goja"
+		if frozen {
+			name = "frozen"
+		}
+		t.Run(name, func(t *testing.T) { f(t, frozen) })
+	}
+}
@@ -0,0 +1,228 @@
+package abnf
+
+// The sandbox of untrusted grammars and programs (Engine.Sandbox, the -sandbox
+// flag). Without it a tag script can store() anywhere, exit() the host, loop
+// forever and allocate without limit, and a program run by llvm.Run has only
+// the -max-steps brake. Under it:
+//
+//   - load, store, include, abnf.saveRules and loadRules, the fs.* functions
+//     (hostfs.go), the runtime modules llvm.Run links and the imports of a
+//     program reach only files below Sandbox.Dirs; env.get answers "".
+//   - llvm.BuildExecutable fails: the sandbox runs no other programs (clang).
+//   - exit(n), of a script or of a program, ends the session call with an
+//     *ExitError instead of the process, as CatchExit does.
+//   - the session has a wall-clock budget (Timeout, counted from NewSession) and
+//     a memory ceiling (MaxMemory).
+//
+// Every violation is a *SandboxError, whose text says which limit it was.
+//
+// The limits are enforced where the time goes. While a parse or a compile of
+// the session runs, a watchdog goroutine measures the clock and the Go heap;
+// when one is over, it records the error and interrupts the goja runtimes of
+// the session (the tag scripts of the default engine). The IR machine, which
+// runs both the programs and the -frozen tag scripts, polls the recorded error
+// at the start of every top-level call and every sandboxCheckSteps
+// instructions, and checks its own arena against MaxMemory in alloc - so a
+// program's malloc fails exactly at the limit, not a tick later.
+//
+// The heap is the process's, not the session's: MaxMemory bounds the growth of
+// the Go heap since the session started, whoever allocated it. That is a fair
+// measure for a process that runs one sandboxed session at a time (the command
+// line, a -serve child). Sessions that run side by side - the parallel forks of
+// a -batch, an embedder's goroutines - count each other's allocations: one
+// file's big parse can trip the limit of another that allocates nothing, so
+// there MaxMemory is a ceiling for all of them together. The arena cap of the
+// IR machine is the program's own and is exact everywhere.
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Sandbox is the policy of Engine.Sandbox. A zero Timeout or MaxMemory is no
+// limit; no Dirs is no file access at all.
+type Sandbox struct {
+	Dirs      []string      // The directories the scripts and imports may read and write below.
+	Timeout   time.Duration // The wall-clock budget of a session, from NewSession.
+	MaxMemory int64         // The bytes a session's scripts and programs may allocate; the heap part is process-wide (see above).
+}
+
+// SandboxError is the error of a run the sandbox stopped.
+type SandboxError struct {
+	Msg string
+}
+
+func (e *SandboxError) Error() string { return "sandbox: " + e.Msg }
+
+// sandboxCheckSteps is how many IR instructions run between two polls of the
+// watchdog's verdict.
+const sandboxCheckSteps = 1 << 16
+
+// sandboxTick is how often the watchdog measures.
+const sandboxTick = 10 * time.Millisecond
+
+// sandboxRun is the sandbox of one session.
+type sandboxRun struct {
+	policy   *Sandbox
+	dirs     []string  // policy.Dirs, absolute and with their symlinks resolved.
+	deadline time.Time // Zero without a Timeout.
+	baseHeap uint64    // The Go heap when the session started.
+
+	tripped atomic.Value // The *SandboxError that stopped the run, once there is one.
+
+	mu     sync.Mutex
+	active int           // The parses and compiles running; the watchdog runs while there are any.
+	stop   chan struct{} // Closed to end the watchdog.
+	vms    []*goja.Runtime
+}
+
+func newSandboxRun(p *Sandbox) *sandboxRun {
+	sb := &sandboxRun{policy: p, baseHeap: heapBytes()}
+	for _, dir := range p.Dirs {
+		sb.dirs = append(sb.dirs, realPath(dir))
+	}
+	if p.Timeout > 0 {
+		sb.deadline = time.Now().Add(p.Timeout)
+	}
+	return sb
+}
+
+// heapBytes is the memory the Go heap's live (and not yet swept) objects hold.
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// realPath is the absolute path of p with the symlinks of its longest existing
+// prefix resolved, so that neither a link nor a ".." leads out of a directory.
+func realPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.Clean(p)
+	}
+	rest := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(real, rest)
+		}
+		if filepath.Dir(dir) == dir {
+			return abs
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// access answers the error of touching the file p, or nil if it lies below one
+// of the allowed directories.
+func (sb *sandboxRun) access(p string) error {
+	if sb == nil {
+		return nil
+	}
+	real := realPath(p)
+	for _, dir := range sb.dirs {
+		if rel, err := filepath.Rel(dir, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return &SandboxError{fmt.Sprintf("%s is outside the allowed directories (%s)", filepath.Clean(p), strings.Join(sb.policy.Dirs, ", "))}
+}
+
+// enter starts the watchdog for a parse or a compile, unless it already runs
+// for an enclosing one, and returns the function that ends it again.
+func (sb *sandboxRun) enter() func() {
+	if sb == nil || (sb.deadline.IsZero() && sb.policy.MaxMemory <= 0) {
+		return func() {}
+	}
+	sb.mu.Lock()
+	sb.active++
+	if sb.active == 1 {
+		sb.stop = make(chan struct{})
+		go sb.watchdog(sb.stop)
+	}
+	sb.mu.Unlock()
+	return func() {
+		sb.mu.Lock()
+		sb.active--
+		if sb.active == 0 {
+			close(sb.stop)
+		}
+		sb.mu.Unlock()
+	}
+}
+
+func (sb *sandboxRun) watchdog(stop chan struct{}) {
+	tick := time.NewTicker(sandboxTick)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			if err := sb.measure(); err != nil {
+				sb.trip(err)
+				return
+			}
+		}
+	}
+}
+
+// measure answers the limit the session is over, or nil.
+func (sb *sandboxRun) measure() *SandboxError {
+	if !sb.deadline.IsZero() && time.Now().After(sb.deadline) {
+		return &SandboxError{fmt.Sprintf("the run took longer than %v", sb.policy.Timeout)}
+	}
+	if max := sb.policy.MaxMemory; max > 0 {
+		if heap := heapBytes(); heap > sb.baseHeap && int64(heap-sb.baseHeap) > max {
+			return &SandboxError{fmt.Sprintf("the scripts and programs allocated more than %d bytes", max)}
+		}
+	}
+	return nil
+}
+
+// trip records the verdict and interrupts the goja runtimes.
+func (sb *sandboxRun) trip(err *SandboxError) {
+	sb.tripped.Store(err)
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	for _, vm := range sb.vms {
+		vm.Interrupt(err)
+	}
+}
+
+// watchVM subjects a goja runtime of the session to the watchdog.
+func (sb *sandboxRun) watchVM(vm *goja.Runtime) {
+	if sb == nil {
+		return
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.vms = append(sb.vms, vm)
+	if err, ok := sb.tripped.Load().(*SandboxError); ok {
+		vm.Interrupt(err)
+	}
+}
+
+// check panics with the watchdog's verdict, if there is one.
+func (sb *sandboxRun) check() {
+	if err, ok := sb.tripped.Load().(*SandboxError); ok {
+		panic(err)
+	}
+}
+
+// sandboxAccess panics with the sandbox's error if the scripts may not touch p.
+func (s *Session) sandboxAccess(p string) {
+	if err := s.sandbox.access(p); err != nil {
+		panic(err)
+	}
+}
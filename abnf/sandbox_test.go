@@ -0,0 +1,103 @@
+package abnf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSandbox runs the start scripts of small grammars under a Sandbox on both
+// engines: files outside its directory are out of reach to every file API,
+// llvm.BuildExecutable runs no clang, exit() ends only the call, env.get is
+// empty, and an endless loop stops at the time limit.
+func TestSandbox(t *testing.T) {
+	os.Setenv("MEC_SANDBOX_TEST", "set")
+	defer os.Unsetenv("MEC_SANDBOX_TEST")
+	cases := []struct {
+		script string
+		out    string // What the script printed.
+		err    string // The text of the SandboxError, or "exit" for an ExitError.
+	}{
+		{`store("in.txt", "x"); println(load("in.txt") + fs.exists("in.txt"))`, "xtrue\n", ""},
+		{`println("[" + env.get("MEC_SANDBOX_TEST") + "]")`, "[]\n", ""},
+		{`store("../out.txt", "x")`, "", "is outside the allowed directories"},
+		{`include("../lib.js")`, "", "is outside the allowed directories"},
+		{`fs.readDir("..")`, "", "is outside the allowed directories"},
+		{`abnf.saveRules(c.asg, "rules.json"); println(abnf.loadRules("rules.json").length)`, "1\n", ""},
+		{`abnf.saveRules(c.asg, "../rules.json")`, "", "is outside the allowed directories"},
+		{`abnf.loadRules("../rules.json")`, "", "is outside the allowed directories"},
+		{`llvm.Run(llvm.ir.NewModule(), "main", "", ["../rt.ll"])`, "", "is outside the allowed directories"},
+		{`llvm.BuildExecutable(llvm.ir.NewModule(), "DIR/../a.out", [])`, "", "is outside the allowed directories"},
+		{`llvm.BuildExecutable(llvm.ir.NewModule(), "DIR/a.out", ["../rt.c"])`, "", "is outside the allowed directories"},
+		{`llvm.BuildExecutable(llvm.ir.NewModule(), "DIR/a.out", [])`, "", "the sandbox runs no other programs"},
+		{`println("bye"); exit(3); println("not here")`, "bye\n", "exit"},
+		{`let i = 0; while (true) { i++ }`, "", "the run took longer than 300ms"},
+	}
+	bothEngines(t, func(t *testing.T, frozen bool) {
+		for _, tc := range cases {
+			dir := t.TempDir()
+			script := strings.ReplaceAll(tc.script, "DIR", filepath.ToSlash(dir))
+			out, err := runGrammar(t, ":startRule(T) ;\nT = \"A\" ;\n:startScript(~~ "+script+" ~~) ;\n", &grammarRun{
+				frozen: frozen,
+				dir:    dir,
+				engine: func(eng *Engine) { eng.Sandbox = &Sandbox{Dirs: []string{dir}, Timeout: 300 * time.Millisecond} },
+			})
+			var exit *ExitError
+			switch {
+			case tc.err == "" && err != nil:
+				t.Errorf("%s: %v", tc.script, err)
+			case tc.err == "exit" && !(errors.As(err, &exit) && exit.Code == 3):
+				t.Errorf("%s: got %v, want exit status 3", tc.script, err)
+			case tc.err != "" && tc.err != "exit" && (err == nil || !strings.Contains(err.Error(), "sandbox: ") || !strings.Contains(err.Error(), tc.err)):
+				t.Errorf("%s: got %v, want the sandbox's %q", tc.script, err, tc.err)
+			}
+			if out != tc.out {
+				t.Errorf("%s: printed %q, want %q", tc.script, out, tc.out)
+			}
+		}
+	})
+}
+
+// TestSandboxMemory allocates past MaxMemory on both engines: a script that
+// grows the Go heap trips the watchdog's measure, a program's malloc trips the
+// IR machine's arena cap. Either way the session call returns the
+// *SandboxError, not a crash, and no catch of the script takes it.
+func TestSandboxMemory(t *testing.T) {
+	const big = "declare i8* @malloc(i64)\n\ndefine i32 @big() {\n\t%p = call i8* @malloc(i64 268435456)\n\tret i32 7\n}\n"
+	cases := []struct {
+		script string
+		err    string
+	}{
+		{`let s = "x", a = []; while (s.length < 65536) { s = s + s }; while (true) { a.push(s + a.length) }`, "the scripts and programs allocated more than 67108864 bytes"},
+		{`println(llvm.Run(llvm.ir.NewModule(), "big", "", ["DIR/big.ll"]).Ret)`, "the program's memory would grow past 67108864 bytes"},
+		{`let s = "x", a = []; while (s.length < 65536) { s = s + s }; try { while (true) { a.push(s + a.length) } } catch (e) {}; println("caught")`, "the scripts and programs allocated more than 67108864 bytes"},
+	}
+	bothEngines(t, func(t *testing.T, frozen bool) {
+		for _, tc := range cases {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "big.ll"), []byte(big), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			script := strings.ReplaceAll(tc.script, "DIR", filepath.ToSlash(dir))
+			runtime.GC() // The heap measure is the process's: start from what the last case left.
+			out, err := runGrammar(t, ":startRule(T) ;\nT = \"A\" ;\n:startScript(~~ "+script+" ~~) ;\n", &grammarRun{
+				frozen: frozen,
+				dir:    dir,
+				engine: func(eng *Engine) {
+					eng.Sandbox = &Sandbox{Dirs: []string{dir}, Timeout: 30 * time.Second, MaxMemory: 64 << 20}
+				},
+			})
+			var sbErr *SandboxError
+			if !errors.As(err, &sbErr) || !strings.Contains(sbErr.Error(), tc.err) {
+				t.Errorf("%s: got %v, want the sandbox's %q", tc.script, err, tc.err)
+			}
+			if out != "" {
+				t.Errorf("%s: printed %q", tc.script, out)
+			}
+		}
+	})
+}
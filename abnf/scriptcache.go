@@ -24,6 +24,7 @@ import (
 	"encoding/hex"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/llir/llvm/asm"
 	"github.com/llir/llvm/ir"
@@ -34,15 +35,13 @@ import (
 // compiler.go) or when the entry format itself changes. Bump it in that case.
 const scriptCacheFormat = "2"
 
-var scriptCacheDir string  // "" = disabled; set by scriptCacheInit.
-var scriptCacheKey string  // Hash over format+snapshot, mixed into every entry name.
-var scriptCacheReady bool
+var scriptCacheDir string // "" = disabled; set by scriptCacheInit.
+var scriptCacheKey string // Hash over format+snapshot, mixed into every entry name.
+var scriptCacheOnce sync.Once
 
-func scriptCacheInit() {
-	if scriptCacheReady {
-		return
-	}
-	scriptCacheReady = true
+func scriptCacheInit() { scriptCacheOnce.Do(scriptCacheSetup) }
+
+func scriptCacheSetup() {
 	dir := os.Getenv("MEC_SCRIPT_CACHE")
 	switch dir {
 	case "off":
@@ -57,9 +56,16 @@ func scriptCacheInit() {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return
 	}
-	sum := sha256.Sum256([]byte(scriptCacheFormat + "\x00" + jsBootstrapLL))
 	scriptCacheDir = dir
-	scriptCacheKey = hex.EncodeToString(sum[:])
+	scriptCacheKey = scriptSnapshotKey()
+}
+
+// scriptSnapshotKey hashes what a compiled script module depends on besides its
+// source: the entry format and the bootstrap snapshot. Language packs (pack.go)
+// record it too.
+func scriptSnapshotKey() string {
+	sum := sha256.Sum256([]byte(scriptCacheFormat + "\x00" + jsBootstrapLL))
+	return hex.EncodeToString(sum[:])
 }
 
 // scriptCachePath maps a script source to its cache file ("" when disabled).
@@ -75,7 +81,11 @@ func scriptCachePath(code string) string {
 // loadCachedScript returns the cached module of a script source, or nil.
 // Entries are written in the binary form of scriptcodec.go; the .ll fallback is
 // read too, for the modules the codec cannot represent.
-func loadCachedScript(code string) *ir.Module {
+// The language pack the session uses (pack.go) is asked first.
+func loadCachedScript(s *Session, code string) *ir.Module {
+	if mod := s.loadPackScript(code); mod != nil {
+		return mod
+	}
 	path := scriptCachePath(code)
 	if path == "" {
 		return nil
@@ -84,10 +94,17 @@ func loadCachedScript(code string) *ir.Module {
 	if err != nil {
 		return nil
 	}
+	return decodeScriptEntry(path, dat)
+}
+
+// decodeScriptEntry reads a cache entry back into its module, or returns nil
+// for a corrupt one (compileScript then recompiles and overwrites it).
+func decodeScriptEntry(path string, dat []byte) *ir.Module {
 	var mod *ir.Module
+	var err error
 	if len(dat) >= len(scriptBinMagic) && string(dat[:len(scriptBinMagic)]) == string(scriptBinMagic) {
 		if mod, err = decodeModule(dat); err != nil {
-			return nil // Corrupt entry: compileScript recompiles and overwrites it.
+			return nil
 		}
 	} else if mod, err = asm.ParseString(path, string(dat)); err != nil {
 		return nil
@@ -114,13 +131,7 @@ func storeCachedScript(code string, mod *ir.Module) {
 	if path == "" {
 		return
 	}
-	// The binary form loads an order of magnitude faster than LLVM assembly
-	// (see scriptcodec.go). A module the codec does not cover falls back to the
-	// text, which loadCachedScript still reads.
-	data, err := encodeModule(mod)
-	if err != nil {
-		data = []byte(mod.String())
-	}
+	data := encodeScriptEntry(mod)
 	tmp, err := os.CreateTemp(filepath.Dir(path), ".mec-script-*")
 	if err != nil {
 		return
@@ -135,3 +146,15 @@ func storeCachedScript(code string, mod *ir.Module) {
 		os.Remove(tmp.Name())
 	}
 }
+
+// encodeScriptEntry is the cache entry of a compiled module. The binary form
+// loads an order of magnitude faster than LLVM assembly (see scriptcodec.go). A
+// module the codec does not cover falls back to the text, which
+// decodeScriptEntry still reads. Printing a module can panic.
+func encodeScriptEntry(mod *ir.Module) []byte {
+	data, err := encodeModule(mod)
+	if err != nil {
+		data = []byte(mod.String())
+	}
+	return data
+}
@@ -0,0 +1,193 @@
+package abnf
+
+// Parse spans: where the productions a grammar marks for editors matched.
+//
+// Two line commands annotate a language grammar for the language server that
+// mec -lsp <grammar> runs for it (lsp.go):
+//
+//	:symbol(FunDecl, "function", KId) ;    every FunDecl is an outline symbol of
+//	                                        that kind, named by the text of the
+//	                                        first KId inside it (optional; the
+//	                                        first line of the match otherwise)
+//	:highlight(KwFun, KwIf, "keyword") ;   the text of these productions is
+//	                                        highlighted as that token type
+//
+// The kinds are the LSP SymbolKind names (SymbolKinds), the types the standard
+// LSP semantic token types (HighlightTypes). A run ignores both commands; the
+// parser only checks them, so a misspelled kind fails the first parse instead
+// of silently giving no outline.
+//
+// A parse that is asked for its spans (Parseropts.Spans) records where each
+// marked production matched, and where each Tag of the ASG did (the span of a
+// Tag has no production name; mec -lsp folds them). Only the matches that are
+// part of the final parse are kept: the spans recorded inside a rule that
+// fails are dropped with it, so a declaration that was tried and backtracked
+// over leaves nothing behind. The matches inside the whitespace (a Comment
+// marked with :highlight()) are recorded once per position, since the parser
+// skips the same whitespace at the same position again and again.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"14.gy/mec/abnf/r"
+)
+
+// SymbolKinds are the kinds :symbol() accepts. The LSP SymbolKind number of a
+// kind is its index + 1.
+var SymbolKinds = []string{"file", "module", "namespace", "package", "class", "method", "property",
+	"field", "constructor", "enum", "interface", "function", "variable", "constant", "string", "number",
+	"boolean", "array", "object", "key", "null", "enumMember", "struct", "event", "operator", "typeParameter"}
+
+// HighlightTypes are the token types :highlight() accepts: the semantic token
+// types every LSP client knows.
+var HighlightTypes = []string{"namespace", "type", "class", "enum", "interface", "struct", "typeParameter",
+	"parameter", "variable", "property", "enumMember", "event", "function", "method", "macro", "keyword",
+	"modifier", "comment", "string", "number", "regexp", "operator", "decorator"}
+
+// SymbolAnnotation is one :symbol() command.
+type SymbolAnnotation struct {
+	Production string
+	Kind       string // One of SymbolKinds.
+	Name       string // The production whose first match inside names the symbol ("" = none).
+}
+
+// Annotations are the editor annotations of a grammar.
+type Annotations struct {
+	Symbols    []SymbolAnnotation
+	Highlights map[string]string // Production -> one of HighlightTypes.
+}
+
+// ParseSpan is a match recorded by a parse with Parseropts.Spans: byte offsets
+// of the parsed text, without the whitespace in front.
+type ParseSpan struct {
+	Production string // The marked production; "" for a Tag.
+	Start, End int
+}
+
+// GrammarAnnotations collects the :symbol() and :highlight() commands of an
+// a-grammar (assembled with its :include()s, if they have some).
+func GrammarAnnotations(grammar *r.Rules) (*Annotations, error) {
+	an := &Annotations{Highlights: map[string]string{}}
+	if grammar == nil {
+		return an, nil
+	}
+	for _, rule := range *grammar {
+		if rule.Operator != r.Command || rule.String != "symbol" && rule.String != "highlight" {
+			continue
+		}
+		prods, kind, name, err := annotation(rule)
+		if err != nil {
+			return nil, err
+		}
+		if rule.String == "symbol" {
+			an.Symbols = append(an.Symbols, SymbolAnnotation{Production: prods[0], Kind: kind, Name: name})
+			continue
+		}
+		for _, prod := range prods {
+			an.Highlights[prod] = kind
+		}
+	}
+	return an, nil
+}
+
+// annotation reads the parameters of a :symbol() or :highlight() command:
+// :symbol(Production, "kind"[, NameProduction]) or
+// :highlight(Production {, Production}, "type").
+func annotation(rule *r.Rule) (prods []string, kind, name string, err error) {
+	var params r.Rules
+	if rule.CodeChilds != nil {
+		params = *rule.CodeChilds
+	}
+	usage, what, known := `:highlight(Production {, Production}, "type")`, "token type", HighlightTypes
+	if rule.String == "symbol" {
+		usage, what, known = `:symbol(Production, "kind"[, NameProduction])`, "symbol kind", SymbolKinds
+	}
+	kindAt := -1
+	for i, param := range params {
+		switch {
+		case param.Operator == r.Token && kindAt < 0:
+			kindAt = i
+			kind = param.String
+		case param.Operator == r.Identifier && kindAt < 0:
+			prods = append(prods, param.String)
+		case param.Operator == r.Identifier && rule.String == "symbol" && i == kindAt+1 && i == len(params)-1:
+			name = param.String
+		default:
+			return nil, "", "", fmt.Errorf("command :%s() needs the form %s", rule.String, usage)
+		}
+	}
+	if len(prods) == 0 || kindAt < 0 || rule.String == "symbol" && len(prods) != 1 || rule.String == "highlight" && kindAt != len(params)-1 {
+		return nil, "", "", fmt.Errorf("command :%s() needs the form %s", rule.String, usage)
+	}
+	for _, k := range known {
+		if k == kind {
+			return prods, kind, name, nil
+		}
+	}
+	return nil, "", "", fmt.Errorf("unknown %s %q for :%s(%s) (one of: %s)", what, kind, rule.String, prods[0], strings.Join(known, ", "))
+}
+
+// initSpans makes the parse record the spans of the productions the grammar
+// marks. The found list (-lf) hands out a production's earlier result without
+// applying it again, which would lose the spans inside, so it is off while
+// recording.
+func (pa *parser) initSpans() {
+	an, err := GrammarAnnotations(pa.agrammar)
+	if err != nil {
+		panic(err)
+	}
+	pa.spanProds = map[string]bool{}
+	for _, sym := range an.Symbols {
+		pa.spanProds[sym.Production] = true
+		if sym.Name != "" {
+			pa.spanProds[sym.Name] = true
+		}
+	}
+	for prod := range an.Highlights {
+		pa.spanProds[prod] = true
+	}
+	pa.wsSpans = map[ParseSpan]bool{}
+	pa.skipEnds = map[int]int{}
+	opts := *pa.opts
+	opts.UseFoundList = false
+	pa.opts = &opts
+}
+
+// recordSpan records a match of a marked production (or of a Tag, name "")
+// that started at start and ends at the current position. The whitespace the
+// match skipped first is not part of the span.
+func (pa *parser) recordSpan(name string, start int, skippingSpaces bool) {
+	if start >= pa.Sdx {
+		return // Nothing to show.
+	}
+	if skippingSpaces {
+		pa.wsSpans[ParseSpan{Production: name, Start: start, End: pa.Sdx}] = true
+		return
+	}
+	if end, ok := pa.skipEnds[start]; ok && end <= pa.Sdx {
+		start = end
+	}
+	pa.spans = append(pa.spans, ParseSpan{Production: name, Start: start, End: pa.Sdx})
+}
+
+// collectSpans is what a parse recorded, by start, the outer span of two
+// with the same start first.
+func (pa *parser) collectSpans() []ParseSpan {
+	spans := append([]ParseSpan{}, pa.spans...)
+	for span := range pa.wsSpans {
+		spans = append(spans, span)
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		a, b := spans[i], spans[j]
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		if a.End != b.End {
+			return a.End > b.End
+		}
+		return a.Production < b.Production
+	})
+	return spans
+}
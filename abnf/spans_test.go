@@ -0,0 +1,61 @@
+package abnf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestParseSpans records the spans of a grammar's :symbol() and :highlight()
+// productions and its Tags. Bad tries every "fun" first and fails behind it,
+// so its Kw matches must be gone; the comment is matched inside the
+// whitespace and recorded once; a span starts behind the whitespace.
+func TestParseSpans(t *testing.T) {
+	grammar := `:startRule(List) ;
+:whitespace(WS) ;
+:symbol(Fun, "function", Name) ;
+:highlight(Kw, "keyword") ;
+:highlight(Comment, "comment") ;
+WS      = { @+" \n" | Comment } ;
+Comment = "#" { "a"..."z" | " " } ;
+List    = { Item } ;
+Item    = Bad | Fun | Call ;
+Bad     = Kw Name "!" ;
+Fun <~~ push(1) ~~> = Kw Name "(" ")" "{" { Item } "}" ;
+Call    = Name "(" ")" ";" ;
+Kw      = "fun" ;
+Name    = "a"..."z" :whitespace() { "a"..."z" } ;
+`
+	src := "fun a() {\n  # hi\n  b();\n}\nfun c() {}\n"
+	s := NewEngine().NewSession(nil, nil)
+	opts := &Parseropts{PreventDefaultOutput: true}
+	g, err := s.CompileGrammar(grammar, "spans.abnf", 0, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spans []ParseSpan
+	if _, err := s.Parse(g, src, "spans.txt", &Parseropts{PreventDefaultOutput: true, Spans: &spans}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, sp := range spans {
+		got = append(got, fmt.Sprintf("%s %q", sp.Production, src[sp.Start:sp.End]))
+	}
+	want := []string{` "fun a() {\n  # hi\n  b();\n}"`, `Fun "fun a() {\n  # hi\n  b();\n}"`, `Kw "fun"`, `Name "a"`,
+		`Comment "# hi"`, `Name "b"`, ` "fun c() {}"`, `Fun "fun c() {}"`, `Kw "fun"`, `Name "c"`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("spans:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	an, err := GrammarAnnotations(g)
+	if err != nil || len(an.Symbols) != 1 || an.Symbols[0] != (SymbolAnnotation{"Fun", "function", "Name"}) || an.Highlights["Comment"] != "comment" {
+		t.Errorf("annotations: %+v, %v", an, err)
+	}
+	bad, err := s.CompileGrammar(strings.Replace(grammar, `"keyword"`, `"keywords"`, 1), "bad.abnf", 0, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Parse(bad, src, "spans.txt", opts); err == nil || !strings.Contains(err.Error(), `unknown token type "keywords"`) {
+		t.Errorf("a misspelled token type is not reported: %v", err)
+	}
+}
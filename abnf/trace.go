@@ -31,51 +31,54 @@ import (
 	"github.com/llir/llvm/ir/constant"
 )
 
-// CFGOutPath and TraceOutPath are set from the -cfgraph and -trace CLI flags.
-var (
-	CFGOutPath   string
-	TraceOutPath string
-)
-
 // TraceMarkersWanted reports whether the compilers should emit js_srcpos
 // statement markers (the c.tracing value the tag scripts read): positions
-// serve the event stream, the CFG line annotations, and the call graph
-// definition lines.
-func TraceMarkersWanted() bool {
-	return TraceOutPath != "" || CFGOutPath != "" || CallgraphOutPath != ""
+// serve the event stream, the CFG line annotations, the call graph
+// definition lines and the stops of -pdebug.
+func (s *Session) TraceMarkersWanted() bool {
+	return s.TraceOutPath != "" || s.CFGOutPath != "" || s.CallgraphOutPath != "" || s.ProgramDebugger != nil
+}
+
+// traceSource is the program source positions refer to.
+type traceSource struct {
+	name   string
+	starts []int                       // Byte offset of every line start; nil = no source known.
+	text   string                      // The source itself, for the rune columns of -diagnostics.
+	byName map[string]savedTraceSource // file name -> its line-start table and text (for re-push by name).
+	stack  []savedTraceSource
 }
 
 // SetTraceSource registers the program source, so events and CFG labels can
 // carry line numbers instead of raw byte offsets.
-func SetTraceSource(name, text string) {
-	traceSrcName = name
-	traceLineStarts = []int{0}
+func (s *Session) SetTraceSource(name, text string) {
+	s.src.name, s.src.text = name, text
+	s.src.starts = []int{0}
 	for i := 0; i < len(text); i++ {
 		if text[i] == '\n' {
-			traceLineStarts = append(traceLineStarts, i+1)
+			s.src.starts = append(s.src.starts, i+1)
 		}
 	}
 	// Remember each file's table so a source can be re-pushed by name alone
 	// (pushTraceSourceFile) when its deferred items are emitted, without the text.
 	if name != "" {
-		if sourceLineStarts == nil {
-			sourceLineStarts = map[string][]int{}
+		if s.src.byName == nil {
+			s.src.byName = map[string]savedTraceSource{}
 		}
-		sourceLineStarts[name] = traceLineStarts
+		s.src.byName[name] = savedTraceSource{name, s.src.starts, text}
+	}
+	if s.ProgramDebugger != nil {
+		s.ProgramDebugger.source(name, text)
 	}
 }
 
-var (
-	traceSrcName     string
-	traceLineStarts  []int            // Byte offset of every line start; nil = no source known.
-	sourceLineStarts map[string][]int // file name -> its line-start table (for re-push by name).
-)
+// SetTraceSource registers the program source of the default session.
+func SetTraceSource(name, text string) { defaultSession().SetTraceSource(name, text) }
 
 // lineOfPos converts a byte offset to a 1-based line number (0 = unknown),
 // against the current source. lineOfPosIn does the same against an explicit
 // line-start table - the call graph passes each function's OWN file's table so
 // functions compiled from imported files get their own line numbers.
-func lineOfPos(pos int) int { return lineOfPosIn(pos, traceLineStarts) }
+func (s *Session) lineOfPos(pos int) int { return lineOfPosIn(pos, s.src.starts) }
 
 func lineOfPosIn(pos int, starts []int) int {
 	if starts == nil || pos < 0 {
@@ -110,78 +113,84 @@ type TraceEvent struct {
 	Val   string `json:"val,omitempty"`  // The value, rendered and capped.
 }
 
-var (
-	traceMu   sync.Mutex
-	traceFile *os.File // Unbuffered on purpose: exit() ends the process abruptly.
-	traceSeq  int64
-	traceDead bool
-)
+// traceStream is the -trace file of a session and the counts of its -cfgraph
+// and -ir dumps.
+type traceStream struct {
+	mu       sync.Mutex
+	file     *os.File // Unbuffered on purpose: exit() ends the process abruptly.
+	seq      int64
+	dead     bool
+	cfgCount int
+	irCount  int
+}
 
-// OpenTrace creates (and truncates) the -trace file up front. Without the
+// openTrace creates (and truncates) the -trace file up front. Without the
 // eager create, a run that emits no events (interpreter-engine grammars trace
 // nothing) silently left a STALE file from an earlier run in place, and a
 // later -render rendered the wrong program.
-func OpenTrace() {
-	traceMu.Lock()
-	defer traceMu.Unlock()
-	if traceFile != nil || traceDead || TraceOutPath == "" {
+func (s *Session) openTrace() {
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	if s.trace.file != nil || s.trace.dead || s.TraceOutPath == "" {
 		return
 	}
-	f, err := os.Create(TraceOutPath)
+	f, err := os.Create(s.TraceOutPath)
 	if err != nil {
-		traceDead = true
-		fmt.Fprintln(os.Stderr, "trace failed: ", err)
+		s.trace.dead = true
+		fmt.Fprintln(s.warn, "trace failed: ", err)
 		return
 	}
-	traceFile = f
+	s.trace.file = f
 }
 
-func traceEmit(ev *TraceEvent) {
-	traceMu.Lock()
-	defer traceMu.Unlock()
-	if traceFile == nil {
-		if traceDead || TraceOutPath == "" {
+func (s *Session) traceEmit(ev *TraceEvent) {
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	if s.trace.file == nil {
+		if s.trace.dead || s.TraceOutPath == "" {
 			return
 		}
-		f, err := os.Create(TraceOutPath)
+		f, err := os.Create(s.TraceOutPath)
 		if err != nil {
-			traceDead = true
-			fmt.Fprintln(os.Stderr, "trace failed: ", err)
+			s.trace.dead = true
+			fmt.Fprintln(s.warn, "trace failed: ", err)
 			return
 		}
-		traceFile = f
+		s.trace.file = f
 	}
-	traceSeq++
-	ev.Seq = traceSeq
+	s.trace.seq++
+	ev.Seq = s.trace.seq
 	line, err := json.Marshal(ev)
 	if err != nil {
 		return
 	}
 	// A failed write (full disk...) must not silently truncate the stream
 	// with exit 0: report it once and stop tracing.
-	if _, err := traceFile.Write(append(line, '\n')); err != nil {
-		fmt.Fprintln(os.Stderr, "trace write failed: ", err)
-		traceFile.Close()
-		traceFile = nil
-		traceDead = true
+	if _, err := s.trace.file.Write(append(line, '\n')); err != nil {
+		fmt.Fprintln(s.warn, "trace write failed: ", err)
+		s.trace.file.Close()
+		s.trace.file = nil
+		s.trace.dead = true
 	}
 }
 
-// CloseTrace closes the stream (writes are unbuffered, nothing to flush).
-func CloseTrace() {
-	traceMu.Lock()
-	defer traceMu.Unlock()
-	if traceFile != nil {
-		traceFile.Close()
-		traceFile = nil
+// closeTrace closes the stream (writes are unbuffered, nothing to flush).
+func (s *Session) closeTrace() {
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	if s.trace.file != nil {
+		s.trace.file.Close()
+		s.trace.file = nil
 	}
 }
 
 // enableTrace marks this runtime as the traced program runtime. Only
 // runJSModule calls it: the frozen engine's tag-script runtime stays untraced,
-// so both engines produce the same stream for the same program.
+// so both engines produce the same stream for the same program. -pdebug
+// traces too, for the call depth and the names of the callees, and writes
+// nothing.
 func (rt *jsrt) enableTrace() {
-	if TraceOutPath == "" {
+	if rt.sess.TraceOutPath == "" && rt.sess.ProgramDebugger == nil {
 		return
 	}
 	rt.traced = true
@@ -190,6 +199,9 @@ func (rt *jsrt) enableTrace() {
 
 // traceVal renders a value for the stream, capped so events stay one-liners.
 func (rt *jsrt) traceVal(v interface{}) string {
+	if rt.sess.TraceOutPath == "" {
+		return "" // Traced for -pdebug only: no stream to render for.
+	}
 	s := rt.toString(v)
 	if len(s) > 100 {
 		s = s[:100] + "..."
@@ -210,7 +222,7 @@ func (rt *jsrt) noteClosureName(name string, v interface{}) {
 // trVar traces a scope variable event: decl, read or write.
 func (rt *jsrt) trVar(ev, name string, v interface{}) {
 	rt.noteClosureName(name, v)
-	traceEmit(&TraceEvent{Ev: ev, Depth: rt.traceDepth, Line: lineOfPos(rt.curPos), Name: name, Val: rt.traceVal(v)})
+	rt.sess.traceEmit(&TraceEvent{Ev: ev, Depth: rt.traceDepth, Line: rt.sess.lineOfPos(rt.curPos), Name: name, Val: rt.traceVal(v)})
 }
 
 // trMember traces an object member event: mread or mwrite.
@@ -218,7 +230,7 @@ func (rt *jsrt) trMember(ev string, objH uint64, key interface{}, v interface{})
 	keyS := rt.toString(key)
 	rt.noteClosureName(keyS, v)
 	obj := fmt.Sprintf("%s#%d", rt.typeOf(rt.unwrap(objH)), objH)
-	traceEmit(&TraceEvent{Ev: ev, Depth: rt.traceDepth, Line: lineOfPos(rt.curPos), Key: keyS, Obj: obj, Val: rt.traceVal(v)})
+	rt.sess.traceEmit(&TraceEvent{Ev: ev, Depth: rt.traceDepth, Line: rt.sess.lineOfPos(rt.curPos), Key: keyS, Obj: obj, Val: rt.traceVal(v)})
 }
 
 // calleeName resolves what a call event should be called.
@@ -240,39 +252,55 @@ func (rt *jsrt) calleeName(callee interface{}) string {
 // ----------------------------------------------------------------------------
 // The control flow dump (-cfgraph)
 
-var (
-	cfgMu    sync.Mutex
-	cfgCount int
-)
-
 // maybeDumpCFG writes the block graph of a module about to be executed.
 // Multiple executed modules in one run get numbered files.
-func maybeDumpCFG(m *ir.Module) {
-	if CFGOutPath == "" {
+func (s *Session) maybeDumpCFG(m *ir.Module) {
+	if s.CFGOutPath == "" {
 		return
 	}
-	cfgMu.Lock()
-	n := cfgCount
-	cfgCount++
-	cfgMu.Unlock()
+	s.trace.mu.Lock()
+	n := s.trace.cfgCount
+	s.trace.cfgCount++
+	s.trace.mu.Unlock()
 
-	path := CFGOutPath
-	if n > 0 {
-		if dot := strings.LastIndex(path, "."); dot > 0 {
-			path = fmt.Sprintf("%s-%d%s", path[:dot], n+1, path[dot:])
-		} else {
-			path = fmt.Sprintf("%s-%d", path, n+1)
-		}
-	}
+	path := numberedDumpPath(s.CFGOutPath, n)
 	var buf strings.Builder
 	if strings.HasSuffix(path, ".mmd") {
-		writeCFGMermaid(m, &buf)
+		writeCFGMermaid(m, s.src.starts, &buf)
 	} else {
-		writeCFGDot(m, &buf)
+		writeCFGDot(m, s.src.starts, &buf)
 	}
 	if err := os.WriteFile(path, []byte(buf.String()), 0644); err != nil {
-		fmt.Fprintln(os.Stderr, "cfg dump failed: ", err)
+		fmt.Fprintln(s.warn, "cfg dump failed: ", err)
+	}
+}
+
+// maybeDumpIR writes the module to the -ir file, as the grammar's println(m)
+// shows it. Like the -cfgraph dumps, the second module of a run goes to
+// F-2.ll and so on.
+func (s *Session) maybeDumpIR(m *ir.Module) {
+	if s.IROutPath == "" {
+		return
+	}
+	s.trace.mu.Lock()
+	n := s.trace.irCount
+	s.trace.irCount++
+	s.trace.mu.Unlock()
+	if err := os.WriteFile(numberedDumpPath(s.IROutPath, n), []byte(m.String()), 0644); err != nil {
+		fmt.Fprintln(s.warn, "ir dump failed: ", err)
+	}
+}
+
+// numberedDumpPath is the file the n-th (from 0) dump of a run goes to: path
+// itself for the first, then path with -2, -3 ... in front of its extension.
+func numberedDumpPath(path string, n int) string {
+	if n == 0 {
+		return path
+	}
+	if dot := strings.LastIndex(path, "."); dot > 0 {
+		return fmt.Sprintf("%s-%d%s", path[:dot], n+1, path[dot:])
 	}
+	return fmt.Sprintf("%s-%d", path, n+1)
 }
 
 type cfgEdge struct {
@@ -321,8 +349,9 @@ func blockCalls(b *ir.Block) []string {
 }
 
 // blockLines derives the source line range of a block from its js_srcpos
-// markers (present when the module was compiled with -trace or -cfgraph active).
-func blockLines(b *ir.Block) string {
+// markers (present when the module was compiled with -trace or -cfgraph active),
+// against the line-start table of the program source.
+func blockLines(b *ir.Block, starts []int) string {
 	lo, hi := 0, 0
 	for _, inst := range b.Insts {
 		call, ok := inst.(*ir.InstCall)
@@ -333,7 +362,7 @@ func blockLines(b *ir.Block) string {
 		if !ok {
 			continue
 		}
-		line := lineOfPos(int(ci.X.Int64()))
+		line := lineOfPosIn(int(ci.X.Int64()), starts)
 		if line == 0 {
 			continue
 		}
@@ -354,7 +383,7 @@ func blockLines(b *ir.Block) string {
 	}
 }
 
-func writeCFGDot(m *ir.Module, buf *strings.Builder) {
+func writeCFGDot(m *ir.Module, starts []int, buf *strings.Builder) {
 	buf.WriteString("digraph CFG {\n\trankdir=TB;\n\tnode [shape=box, fontname=\"Courier\", fontsize=10];\n")
 	for fi, f := range m.Funcs {
 		if len(f.Blocks) == 0 {
@@ -367,7 +396,7 @@ func writeCFGDot(m *ir.Module, buf *strings.Builder) {
 		fmt.Fprintf(buf, "\tsubgraph cluster_%d {\n\t\tlabel=%q;\n", fi, f.Name())
 		for bi, b := range f.Blocks {
 			label := fmt.Sprintf("%s\n%d inst", blockTitle(b, bi), len(b.Insts))
-			if lines := blockLines(b); lines != "" {
+			if lines := blockLines(b, starts); lines != "" {
 				label = fmt.Sprintf("%s %s\n%d inst", blockTitle(b, bi), lines, len(b.Insts))
 			}
 			if calls := blockCalls(b); len(calls) > 0 {
@@ -393,7 +422,7 @@ func writeCFGDot(m *ir.Module, buf *strings.Builder) {
 	buf.WriteString("}\n")
 }
 
-func writeCFGMermaid(m *ir.Module, buf *strings.Builder) {
+func writeCFGMermaid(m *ir.Module, starts []int, buf *strings.Builder) {
 	buf.WriteString("flowchart TD\n")
 	for fi, f := range m.Funcs {
 		if len(f.Blocks) == 0 {
@@ -406,7 +435,7 @@ func writeCFGMermaid(m *ir.Module, buf *strings.Builder) {
 		fmt.Fprintf(buf, "  subgraph sg%d[%q]\n", fi, f.Name())
 		for bi, b := range f.Blocks {
 			title := blockTitle(b, bi)
-			if lines := blockLines(b); lines != "" {
+			if lines := blockLines(b, starts); lines != "" {
 				title += " " + lines
 			}
 			fmt.Fprintf(buf, "    %s[%q]\n", ids[b], fmt.Sprintf("%s (%d)", title, len(b.Insts)))
@@ -543,7 +572,7 @@ func RenderTrace(kind, path string) error {
 			fmt.Fprintf(out, "\t%q -> var_%s [label=\"%d\", style=%s];\n", k.from, dotID(k.to), edges[k], style)
 		}
 	default:
-		return fmt.Errorf("unknown -render kind %q (use 'calls' or 'vars')", kind)
+		return fmt.Errorf("unknown -render kind %q (use 'calls', 'vars', 'static', 'coverage' or 'coverage-html')", kind)
 	}
 	out.WriteString("}\n")
 	_, err = os.Stdout.WriteString(out.String())
@@ -282,7 +282,8 @@ func Verify(aGrammar *r.Rules, source string, ownNames map[string]bool) []Verify
 	if start != nil {
 		roots := []string{start.String}
 		for _, rule := range *aGrammar {
-			if rule.Operator == r.Command {
+			// :symbol() and :highlight() only annotate productions for editors.
+			if rule.Operator == r.Command && rule.String != "symbol" && rule.String != "highlight" {
 				collectIdentNames(rule.CodeChilds, func(n string) { roots = append(roots, n) })
 			}
 		}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"14.gy/mec/abnf"
+	r "14.gy/mec/abnf/r"
+)
+
+// -batch runs one grammar over many input files:
+//
+//	./mec -batch -j 8 languages/kotlin-to-llvm-ir.abnf -q -callgraph cg.jsonl src/**/*.kt
+//
+// The first file is the grammar (or a language pack, or a grammar in -import
+// notation). It is compiled ONCE, its :include()s assembled, and then every
+// further file is parsed and compiled with it in one of -j workers, each a fork
+// of the run's session (abnf.Session.Fork). The forks share the -trace stream,
+// the -callgraph file and the -grammar-coverage counts, so one batch writes one
+// of each; -callgraph (not only -callgraph-append) therefore already merges the
+// files of the batch.
+//
+// A file's stdout and stderr are buffered and printed in command line order once
+// all files before it are done, so the output reads as if the files had run one
+// after another. A file that fails does not stop the others - exit() in a tag
+// script or program ends only that file (abnf.Engine.CatchExit) - and the run
+// ends with a summary of the failed files, each with the kind of failure.
+
+// batchResult is one file of a batch: what it printed, and how it ended.
+type batchResult struct {
+	out, warn bytes.Buffer
+	kind      string // "" for success, else one of the batch* kinds below.
+	detail    string // The first line of the failure message.
+	done      chan struct{}
+}
+
+// The kinds of failure the summary tells apart.
+const (
+	batchReadError   = "read error"
+	batchParseError  = "parse error"
+	batchUnsupported = "unsupported syntax"
+	batchCompile     = "compile error"
+	batchRuntime     = "runtime error"
+	batchLimit       = "limit exceeded"
+)
+
+// checkBatch rejects the flags that make no sense with -batch: they name one
+// program (-code, -pipe) or one artifact (-exe, -o).
+func checkBatch(o *options) error {
+	switch {
+	case o.codeSet || o.codeStdin:
+		return fmt.Errorf("-batch takes its inputs as files, not -code / -code-stdin")
+	case len(o.pipeBounds) > 0:
+		return fmt.Errorf("-batch and -pipe cannot be combined")
+	case o.exePath != "":
+		return fmt.Errorf("-batch and -exe cannot be combined: every file would write the same executable")
+	case o.verify || o.pretty || o.pack || o.exportFormat != "" || o.speedTest:
+		return fmt.Errorf("-batch runs files; -verify, -pretty, -pack, -export and -speed inspect a grammar")
+	case len(o.files) < 2:
+		return fmt.Errorf("-batch needs a grammar and at least one input file")
+	}
+	return nil
+}
+
+// runBatch compiles the first file's grammar and runs every further file
+// through it, o.jobs at a time. It exits 1 when a file failed.
+func runBatch(sess *abnf.Session, o *options, parseropts *abnf.Parseropts) {
+	dat, err := ioutil.ReadFile(o.files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: ", err)
+		os.Exit(1)
+	}
+	srcs := []string{abnf.StripBOM(string(dat))}
+	grammar := firstGrammar(sess, o, srcs, parseropts)
+	// The workers share the grammar, so it must be complete before the first of
+	// them parses: an :include() merges into the a-grammar on its first parse.
+	if err := sess.AssembleIncludes(grammar, o.files[0], parseropts); err != nil {
+		failIncludes(o, err)
+	}
+
+	inputs := o.files[1:]
+	results := make([]*batchResult, len(inputs))
+	for i := range results {
+		results[i] = &batchResult{done: make(chan struct{})}
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < o.jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := results[i]
+				runBatchFile(sess.Fork(&res.out, &res.warn), grammar, inputs[i], o, *parseropts, res)
+				close(res.done)
+			}
+		}()
+	}
+	go func() {
+		for i := range inputs {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	failed := 0
+	for i, res := range results {
+		<-res.done
+		os.Stderr.Write(res.warn.Bytes())
+		os.Stdout.Write(res.out.Bytes())
+		if res.kind != "" {
+			failed++
+		}
+		results[i] = &batchResult{kind: res.kind, detail: res.detail} // Let the output go.
+	}
+	wg.Wait()
+
+	if !o.quietFull || failed > 0 {
+		fmt.Fprintf(os.Stderr, "batch: %d file(s), %d ok, %d failed\n", len(inputs), len(inputs)-failed, failed)
+	}
+	for i, res := range results {
+		if res.kind != "" {
+			fmt.Fprintf(os.Stderr, "  %s: %s: %s\n", inputs[i], res.kind, res.detail)
+		}
+	}
+	if failed > 0 {
+		exit(1)
+	}
+}
+
+// runBatchFile parses and compiles one input with the shared grammar in its own
+// session, the way runStage does for stage 2 of a plain run, and records how it
+// ended in res. The stage messages go to the file's own stderr buffer.
+func runBatchFile(s *abnf.Session, grammar *r.Rules, file string, o *options, parseropts abnf.Parseropts, res *batchResult) {
+	stderr := &res.warn
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		res.kind, res.detail = batchReadError, err.Error()
+		return
+	}
+	src := abnf.StripBOM(string(dat))
+	s.SetTraceSource(file, src)
+	trace := o.traceAll || o.traceStage[2]
+	verbose := o.verboseAll || o.verboseStage[2]
+	parseropts.TraceEnabled = trace
+	if !o.quietMost {
+		fmt.Fprintf(stderr, "Stage 2: parse %s\n", file)
+	}
+	asg, err := s.Parse(grammar, src, file, &parseropts)
+	if err != nil {
+		if code, exited := exitCode(err); exited && code == 0 {
+			return
+		}
+		if !s.ReportError(err, file) {
+			fmt.Fprintln(stderr, "  ==> Fail")
+			fmt.Fprintln(stderr, err)
+		}
+		res.kind, res.detail = classifyBatchFailure(err, true, res.out.String())
+		return
+	}
+	if !o.quietMost {
+		fmt.Fprintln(stderr, "  ==> Success, generated abstract semantic graph (ASG)")
+		fmt.Fprintf(stderr, "Stage 2: compile\n")
+	}
+	if verbose && asg != nil {
+		fmt.Fprintf(stderr, "   => ASG:  %s\n\n", asg.Serialize())
+	}
+	_, err = s.Compile(asg, grammar, file, o.slotStage[2], trace, o.quietFull)
+	if code, exited := exitCode(err); exited && code == 0 {
+		return // The program (or the compiler) ended itself with exit(0).
+	}
+	if err != nil {
+		if _, exited := exitCode(err); !exited && !s.ReportError(err, file) {
+			fmt.Fprintln(stderr, "  ==> Fail")
+			fmt.Fprintln(stderr, err)
+		}
+		res.kind, res.detail = classifyBatchFailure(err, false, res.out.String())
+		return
+	}
+	if !o.quietMost {
+		fmt.Fprintln(stderr, " ==> Success")
+	}
+}
+
+// exitCode reports whether err is an exit(n) of a script or program, and n.
+func exitCode(err error) (int, bool) {
+	var exit *abnf.ExitError
+	if errors.As(err, &exit) {
+		return exit.Code, true
+	}
+	return 0, false
+}
+
+// classifyBatchFailure names the kind of a failed file for the summary. The
+// session's typed errors say it outright: a text the grammar does not match
+// (*abnf.ParseError), or a run the sandbox or the -max-steps brake stopped. The
+// grammars report the other failures themselves, as the last line they print
+// before exit(1) ("kotlin compiler error: ..."), so a failure that ended in
+// exit(n) is judged by that line, and an error that reached the driver by its
+// own text.
+func classifyBatchFailure(err error, inParse bool, out string) (kind, detail string) {
+	msg := err.Error()
+	var (
+		parseErr   *abnf.ParseError
+		sandboxErr *abnf.SandboxError
+		stepErr    *abnf.StepLimitError
+	)
+	switch {
+	case errors.As(err, &parseErr):
+		return batchParseError, firstLine(msg)
+	case errors.As(err, &sandboxErr), errors.As(err, &stepErr):
+		return batchLimit, firstLine(msg)
+	}
+	_, exited := exitCode(err)
+	if exited {
+		if last := lastLine(out); last != "" {
+			msg = last + " (" + msg + ")"
+		}
+	}
+	detail = firstLine(msg)
+	switch {
+	case strings.Contains(msg, "not implemented ("):
+		return batchUnsupported, detail
+	case inParse && !strings.Contains(msg, "compiler error"):
+		return batchParseError, detail
+	case strings.Contains(msg, "compiler error"):
+		return batchCompile, detail
+	case strings.Contains(msg, "runtime error"), strings.Contains(msg, "IR interpreter:"),
+		strings.Contains(msg, "llvm.Run"):
+		return batchRuntime, detail
+	}
+	if exited {
+		return batchRuntime, detail // A program that ended with a non-zero exit().
+	}
+	return batchCompile, detail
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"14.gy/mec/abnf"
+)
+
+// TestClassifyBatchFailure sorts the session's typed errors by their type and
+// the others by the text the grammar printed last, as the -batch summary does.
+func TestClassifyBatchFailure(t *testing.T) {
+	s := abnf.NewEngine().NewSession(&strings.Builder{}, &strings.Builder{})
+	g, err := s.CompileGrammar(`:startRule(T) ; T = "A" ;`, "g.abnf", 0, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, parseErr := s.Parse(g, "A B", "p.x", nil)
+	if parseErr == nil {
+		t.Fatal("\"A B\" parses")
+	}
+	for _, tc := range []struct {
+		name    string
+		err     error
+		inParse bool
+		out     string
+		kind    string
+	}{
+		{"parse error", parseErr, true, "", batchParseError},
+		{"parse error (compiler error text)", parseErr, true, "kotlin compiler error: x", batchParseError},
+		{"step limit", &abnf.StepLimitError{Steps: 10}, false, "", batchLimit},
+		{"sandbox", fmt.Errorf("at T: %w", &abnf.SandboxError{Msg: "the run took longer than 1s"}), true, "", batchLimit},
+		{"exit after a compiler error", &abnf.ExitError{Code: 1}, false, "kotlin compiler error: x", batchCompile},
+		{"exit after an unsupported construct", &abnf.ExitError{Code: 1}, true, "not implemented (yield)", batchUnsupported},
+		{"exit of the program", &abnf.ExitError{Code: 2}, false, "done", batchRuntime},
+		{"runtime error text", fmt.Errorf("js runtime error: x is undefined"), false, "", batchRuntime},
+		{"tag failure in the parse", fmt.Errorf("ReferenceError: x"), true, "", batchParseError},
+		{"tag failure in the compile", fmt.Errorf("ReferenceError: x"), false, "", batchCompile},
+	} {
+		if kind, _ := classifyBatchFailure(tc.err, tc.inParse, tc.out); kind != tc.kind {
+			t.Errorf("%s: %q, want %q", tc.name, kind, tc.kind)
+		}
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"14.gy/mec/abnf"
+)
+
+// -debug stops the compile walk at breakpoints and steps (abnf/debugger.go),
+// -pdebug the program the walk runs with llvm.RunJS (abnf/progdebugger.go):
+//
+//	./mec -debug calc.abnf prog.calc             stop at the first tag, read commands
+//	./mec -debug -break Expr calc.abnf prog.calc run to the tags of Expr
+//	./mec -debug=dap calc.abnf prog.calc         serve the Debug Adapter Protocol
+//	./mec -pdebug -break fib languages/js-to-llvm-ir.abnf fib.js
+//	                                             run to the first call of fib
+//
+// Plain -debug and -pdebug read their commands from stdin and write to stderr
+// (help lists the commands). =dap speaks DAP on stdin/stdout instead, for an
+// editor: editor/vscode-abnf launches it for a debug configuration of type mec.
+// Stdout is the protocol then, so the program's output reaches the editor as
+// output events and anything else printed to stdout goes to stderr.
+
+// checkDebug rejects what does not combine with -debug or -pdebug.
+func checkDebug(o *options) error {
+	flag := "-debug"
+	if o.pdebug != "" {
+		flag = "-pdebug"
+	}
+	switch {
+	case len(o.breaks) > 0 && o.debug == "" && o.pdebug == "":
+		return fmt.Errorf("-break sets a breakpoint of -debug or -pdebug; it needs one of them")
+	case o.debug != "" && o.pdebug != "":
+		return fmt.Errorf("-debug and -pdebug read the same commands; debug the walk or the program")
+	case o.debug == "" && o.pdebug == "":
+		return nil
+	case o.batch || o.watch || o.repl || o.format || o.speedTest:
+		return fmt.Errorf("%s follows one run of the pipeline; it does not combine with -batch, -watch, -repl, -fmt or -speed", flag)
+	case o.stdin || o.codeStdin:
+		return fmt.Errorf("%s reads its commands from stdin; -stdin and -code-stdin cannot read it too", flag)
+	}
+	for _, b := range o.breaks {
+		if _, err := abnf.ParseBreakpoint(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openDebugger makes the -debug or -pdebug debugger of the run and returns
+// its breakpoints. Under =dap it first waits for the editor to set them.
+func openDebugger(o *options) *abnf.DebugBreaks {
+	var b *abnf.DebugBreaks
+	switch {
+	case o.debug == "dap" || o.pdebug == "dap":
+		o.dap = startDAP(o.pdebug != "")
+		o.debugger, o.pdebugger, b = o.dap.d, o.dap.pd, o.dap.b
+	case o.pdebug != "":
+		o.pdebugger = abnf.NewProgramDebugger(abnf.DebugProgramLines(os.Stdin, os.Stderr))
+		b = &o.pdebugger.DebugBreaks
+	default:
+		o.debugger = abnf.NewDebugger(abnf.DebugLines(os.Stdin, os.Stderr))
+		b = &o.debugger.DebugBreaks
+	}
+	if o.dap == nil {
+		b.StopOnEntry = len(o.breaks) == 0
+	}
+	for _, spec := range o.breaks {
+		b.Break(spec) // Checked by checkDebug.
+	}
+	prev := exit
+	exit = func(code int) {
+		b.Finish(code)
+		prev(code)
+	}
+	return b
+}
+
+// dapServer serves the stops of the debugger to an editor: those of the
+// compile walk (d) or, under -pdebug, those of the program (pd); b is the
+// breakpoints of the one it serves. The protocol runs in a goroutine of its
+// own; the walk runs on the main goroutine and, while it stands at a stop,
+// takes the requests that need the stop from reqs.
+type dapServer struct {
+	in         *bufio.Reader
+	out        io.Writer
+	d          *abnf.Debugger
+	pd         *abnf.ProgramDebugger
+	b          *abnf.DebugBreaks
+	configured chan struct{}
+	reqs       chan *dapRequest
+
+	wmu sync.Mutex // One message at a time on out.
+	seq int
+
+	mu          sync.Mutex
+	stopped     bool
+	sourceBreak map[string][]int // A source's path -> the IDs of its breakpoints.
+	funcBreak   []int
+
+	// The stop the walk or the program stands at, and the values the editor
+	// may unfold: variablesReference n is refs[n-1]. Only the goroutine of the
+	// run uses them.
+	stop  *abnf.DebugStop
+	pstop *abnf.ProgramStop
+	refs  []interface{}
+}
+
+// dapRequest is a request of the editor.
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// startDAP takes stdin and stdout for the protocol and returns once the editor
+// is done configuring. program serves -pdebug, else -debug.
+func startDAP(program bool) *dapServer {
+	s := &dapServer{in: bufio.NewReader(os.Stdin), out: os.Stdout, configured: make(chan struct{}), reqs: make(chan *dapRequest), sourceBreak: map[string][]int{}}
+	os.Stdout = os.Stderr // Nothing but the protocol may reach the real stdout.
+	if program {
+		s.pd = abnf.NewProgramDebugger(s.onProgramStop)
+		s.b = &s.pd.DebugBreaks
+	} else {
+		s.d = abnf.NewDebugger(s.onStop)
+		s.b = &s.d.DebugBreaks
+	}
+	s.b.Ended = s.ended
+	go s.serve()
+	<-s.configured
+	return s
+}
+
+// output is a writer whose text reaches the editor as output events.
+func (s *dapServer) output(category string) io.Writer {
+	return dapOutput{s, category}
+}
+
+type dapOutput struct {
+	s        *dapServer
+	category string
+}
+
+func (o dapOutput) Write(p []byte) (int, error) {
+	o.s.event("output", map[string]interface{}{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
+
+func (s *dapServer) write(msg map[string]interface{}) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	msg["seq"] = s.seq
+	data, err := json.Marshal(msg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mec -debug=dap:", err)
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (s *dapServer) event(name string, body interface{}) {
+	msg := map[string]interface{}{"type": "event", "event": name}
+	if body != nil {
+		msg["body"] = body
+	}
+	s.write(msg)
+}
+
+func (s *dapServer) respond(req *dapRequest, body interface{}, err error) {
+	msg := map[string]interface{}{"type": "response", "request_seq": req.Seq, "command": req.Command, "success": err == nil}
+	if err != nil {
+		msg["message"] = err.Error()
+	} else if body != nil {
+		msg["body"] = body
+	}
+	s.write(msg)
+}
+
+// serve reads the requests until the editor disconnects.
+func (s *dapServer) serve() {
+	configured := false
+	for {
+		data, err := readFramed(s.in)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, "mec -debug=dap:", err)
+			}
+			os.Exit(1)
+		}
+		req := &dapRequest{}
+		if err := json.Unmarshal(data, req); err != nil {
+			fmt.Fprintln(os.Stderr, "mec -debug=dap: bad message:", err)
+			continue
+		}
+		switch req.Command {
+		case "initialize":
+			s.respond(req, map[string]interface{}{
+				"supportsConfigurationDoneRequest": true,
+				"supportsFunctionBreakpoints":      true,
+			}, nil)
+			s.event("initialized", nil)
+		case "launch", "attach":
+			var args struct {
+				StopOnEntry bool `json:"stopOnEntry"`
+			}
+			json.Unmarshal(req.Arguments, &args)
+			s.b.StopOnEntry = args.StopOnEntry
+			s.respond(req, nil, nil)
+		case "setBreakpoints":
+			s.respond(req, s.setBreakpoints(req.Arguments), nil)
+		case "setFunctionBreakpoints":
+			s.respond(req, s.setFunctionBreakpoints(req.Arguments), nil)
+		case "setExceptionBreakpoints":
+			s.respond(req, map[string]interface{}{"breakpoints": []interface{}{}}, nil)
+		case "configurationDone":
+			s.respond(req, nil, nil)
+			if !configured {
+				configured = true
+				close(s.configured)
+			}
+		case "threads":
+			name := "compile walk"
+			if s.pd != nil {
+				name = "program"
+			}
+			s.respond(req, map[string]interface{}{"threads": []interface{}{map[string]interface{}{"id": 1, "name": name}}}, nil)
+		case "disconnect", "terminate":
+			s.respond(req, nil, nil)
+			os.Exit(0)
+		default:
+			s.mu.Lock()
+			stopped := s.stopped
+			s.mu.Unlock()
+			switch {
+			case stopped:
+				s.reqs <- req
+			case req.Command == "stackTrace":
+				s.respond(req, map[string]interface{}{"stackFrames": []interface{}{}, "totalFrames": 0}, nil)
+			default:
+				s.respond(req, nil, fmt.Errorf("%s: the run goes on; it stops at breakpoints only", req.Command))
+			}
+		}
+	}
+}
+
+// setBreakpoints replaces the breakpoints of one source: its lines become
+// FILE:LINE breakpoints.
+func (s *dapServer) setBreakpoints(raw json.RawMessage) map[string]interface{} {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	json.Unmarshal(raw, &args)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.sourceBreak[args.Source.Path] {
+		s.b.Delete(id)
+	}
+	ids := []int{}
+	res := []interface{}{}
+	for _, b := range args.Breakpoints {
+		bp, err := s.b.Break(args.Source.Path + ":" + strconv.Itoa(b.Line))
+		if err != nil {
+			res = append(res, map[string]interface{}{"verified": false, "line": b.Line, "message": err.Error()})
+			continue
+		}
+		ids = append(ids, bp.ID)
+		res = append(res, map[string]interface{}{"id": bp.ID, "verified": true, "line": b.Line})
+	}
+	s.sourceBreak[args.Source.Path] = ids
+	return map[string]interface{}{"breakpoints": res}
+}
+
+// setFunctionBreakpoints replaces the production (or function) breakpoints.
+func (s *dapServer) setFunctionBreakpoints(raw json.RawMessage) map[string]interface{} {
+	var args struct {
+		Breakpoints []struct {
+			Name string `json:"name"`
+		} `json:"breakpoints"`
+	}
+	json.Unmarshal(raw, &args)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.funcBreak {
+		s.b.Delete(id)
+	}
+	s.funcBreak = nil
+	res := []interface{}{}
+	for _, b := range args.Breakpoints {
+		bp, err := s.b.Break(b.Name)
+		if err != nil {
+			res = append(res, map[string]interface{}{"verified": false, "message": err.Error()})
+			continue
+		}
+		s.funcBreak = append(s.funcBreak, bp.ID)
+		res = append(res, map[string]interface{}{"id": bp.ID, "verified": true})
+	}
+	return map[string]interface{}{"breakpoints": res}
+}
+
+// onStop is the debugger's Stopped: it tells the editor and answers its
+// requests about the stop until one of them moves on.
+func (s *dapServer) onStop(st *abnf.DebugStop) abnf.DebugAction {
+	s.stop = st
+	return s.wait(st.Reason, st.Where())
+}
+
+// onProgramStop is onStop for the stops of -pdebug.
+func (s *dapServer) onProgramStop(st *abnf.ProgramStop) abnf.DebugAction {
+	s.pstop = st
+	return s.wait(st.Reason, st.Where())
+}
+
+// wait tells the editor of the stop and answers its requests until one of
+// them moves on.
+func (s *dapServer) wait(reason, where string) abnf.DebugAction {
+	s.refs = nil
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.event("stopped", map[string]interface{}{"reason": reason, "description": where, "threadId": 1, "allThreadsStopped": true})
+	for req := range s.reqs {
+		action := abnf.DebugAction(-1)
+		switch req.Command {
+		case "continue":
+			action = abnf.DebugContinue
+		case "next":
+			action = abnf.DebugStepOver
+		case "stepIn":
+			action = abnf.DebugStepIn
+		case "stepOut":
+			action = abnf.DebugStepOut
+		}
+		if action >= 0 {
+			s.mu.Lock()
+			s.stopped = false
+			s.mu.Unlock()
+			s.respond(req, map[string]interface{}{"allThreadsContinued": true}, nil)
+			return action
+		}
+		body, err := s.answer(req)
+		s.respond(req, body, err)
+	}
+	return abnf.DebugContinue
+}
+
+// answer answers a request about the stop.
+func (s *dapServer) answer(req *dapRequest) (interface{}, error) {
+	if req.Command == "variables" {
+		var args struct {
+			Ref int `json:"variablesReference"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		if args.Ref < 1 || args.Ref > len(s.refs) {
+			return nil, fmt.Errorf("no variables %d", args.Ref)
+		}
+		names, vals := s.fields(s.refs[args.Ref-1])
+		vars := []interface{}{}
+		for i, n := range names {
+			vars = append(vars, map[string]interface{}{"name": n, "value": s.value(vals[i]), "variablesReference": s.ref(vals[i])})
+		}
+		return map[string]interface{}{"variables": vars}, nil
+	}
+	if s.pd != nil {
+		return s.answerProgram(req)
+	}
+	st := s.stop
+	switch req.Command {
+	case "stackTrace":
+		// The innermost node first; frame IDs count the path from the root.
+		frames := []interface{}{}
+		for i := len(st.Path) - 1; i >= 0; i-- {
+			fr := st.Path[i]
+			name := fr.Production
+			if i == len(st.Path)-1 && st.Event == "enter" {
+				name += " (enter)"
+			}
+			if fr.Line > 0 {
+				name += fmt.Sprintf("  %s:%d:%d", filepath.Base(fr.File), fr.Line, fr.Col)
+			}
+			f := map[string]interface{}{"id": i + 1, "name": name, "line": fr.GrammarLine, "column": 1}
+			if fr.GrammarFile != "" {
+				path, _ := filepath.Abs(fr.GrammarFile)
+				f["source"] = map[string]interface{}{"name": filepath.Base(fr.GrammarFile), "path": path}
+			}
+			frames = append(frames, f)
+		}
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		if args.FrameID < 1 || args.FrameID > len(st.Path) {
+			return nil, fmt.Errorf("no frame %d", args.FrameID)
+		}
+		fr := st.Path[args.FrameID-1]
+		node := map[string]interface{}{"production": fr.Production, "code": fr.Code}
+		if fr.GrammarLine > 0 {
+			node["grammar"] = fmt.Sprintf("%s:%d", fr.GrammarFile, fr.GrammarLine)
+		}
+		if fr.Line > 0 {
+			node["input"] = fmt.Sprintf("%s:%d:%d", fr.File, fr.Line, fr.Col)
+		}
+		scopes := []interface{}{}
+		if args.FrameID == len(st.Path) {
+			node["text"] = st.Text
+			if st.Up != nil {
+				scopes = append(scopes, s.scope("up", st.Up))
+			}
+			scopes = append(scopes, s.scope("stack", st.Local), s.scope("global stack", st.Global), s.scope("ltr", st.Ltr))
+		}
+		scopes = append(scopes, s.scope("node", node))
+		return map[string]interface{}{"scopes": scopes}, nil
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		v, err := st.Eval(args.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"result": abnf.DebugValue(v), "variablesReference": s.ref(v)}, nil
+	}
+	return nil, fmt.Errorf("%s is not supported", req.Command)
+}
+
+func (s *dapServer) scope(name string, v interface{}) map[string]interface{} {
+	s.refs = append(s.refs, v)
+	return map[string]interface{}{"name": name, "variablesReference": len(s.refs), "expensive": false}
+}
+
+// ref returns the variablesReference of a value that has members, else 0.
+func (s *dapServer) ref(v interface{}) int {
+	if names, _ := s.fields(v); names == nil {
+		return 0
+	}
+	s.refs = append(s.refs, v)
+	return len(s.refs)
+}
+
+// fields returns the members of a value of the stop.
+func (s *dapServer) fields(v interface{}) ([]string, []interface{}) {
+	if s.pd != nil {
+		return s.pstop.Fields(v)
+	}
+	return abnf.DebugFields(v)
+}
+
+// value renders a value of the stop.
+func (s *dapServer) value(v interface{}) string {
+	if s.pd != nil {
+		return s.pstop.Value(v)
+	}
+	return abnf.DebugValue(v)
+}
+
+// answerProgram answers a request about a stop of the program. Frame IDs
+// count the stack from the bottom, like the path of the walk.
+func (s *dapServer) answerProgram(req *dapRequest) (interface{}, error) {
+	st := s.pstop
+	var args struct {
+		FrameID    int    `json:"frameId"`
+		Expression string `json:"expression"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+	frame := len(st.Stack) - 1 // evaluate without a frame: where the program stands.
+	if args.FrameID != 0 {
+		if args.FrameID < 1 || args.FrameID > len(st.Stack) {
+			return nil, fmt.Errorf("no frame %d", args.FrameID)
+		}
+		frame = args.FrameID - 1
+	}
+	switch req.Command {
+	case "stackTrace":
+		frames := []interface{}{}
+		for i := len(st.Stack) - 1; i >= 0; i-- {
+			fr := st.Stack[i]
+			f := map[string]interface{}{"id": i + 1, "name": fr.Function, "line": fr.Line, "column": fr.Col}
+			if fr.Line > 0 && fr.File != "" {
+				path, _ := filepath.Abs(fr.File)
+				f["source"] = map[string]interface{}{"name": filepath.Base(fr.File), "path": path}
+			}
+			frames = append(frames, f)
+		}
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		scopes := []interface{}{}
+		for _, ps := range st.Scopes(frame) {
+			scopes = append(scopes, s.scope(ps.Name, ps))
+		}
+		return map[string]interface{}{"scopes": scopes}, nil
+	case "evaluate":
+		v, err := st.Lookup(frame, args.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"result": st.Value(v), "variablesReference": s.ref(v)}, nil
+	}
+	return nil, fmt.Errorf("%s is not supported", req.Command)
+}
+
+// ended reports the end of the run.
+func (s *dapServer) ended(code int) {
+	s.event("exited", map[string]interface{}{"exitCode": code})
+	s.event("terminated", nil)
+}
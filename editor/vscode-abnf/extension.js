@@ -0,0 +1,90 @@
+// Starts the mec language server (mec -lsp) for .abnf files when the mec
+// binary is found: the abnf.server.path setting, else mec on the PATH. Without
+// it the extension still highlights; it only says once where the server is.
+//
+// Every entry of the abnf.languages setting starts one more server, mec -lsp
+// <grammar>, for the files of another VSCode language: the grammar's parse
+// errors, outline, folding and highlighting for the language it defines.
+//
+// A debug configuration of type mec runs mec -debug=dap with its args: the
+// breakpoints set in a grammar stop the compile walk at the tags on their lines.
+// With "program": true it runs mec -pdebug=dap instead, and the breakpoints
+// are in the program a -to-llvm-ir grammar compiles and runs.
+'use strict';
+
+const fs = require('fs');
+const path = require('path');
+const vscode = require('vscode');
+
+const clients = [];
+
+// findMec returns the configured server path, or mec found on the PATH, or null.
+function findMec() {
+	const configured = vscode.workspace.getConfiguration('abnf').get('server.path');
+	if (configured) {
+		return configured;
+	}
+	const names = process.platform === 'win32' ? ['mec.exe', 'mec'] : ['mec'];
+	for (const dir of (process.env.PATH || '').split(path.delimiter)) {
+		for (const name of names) {
+			const candidate = path.join(dir, name);
+			try {
+				fs.accessSync(candidate, fs.constants.X_OK);
+				if (fs.statSync(candidate).isFile()) {
+					return candidate;
+				}
+			} catch (e) {
+				// Not here.
+			}
+		}
+	}
+	return null;
+}
+
+function activate(context) {
+	const mec = findMec();
+	if (!mec) {
+		vscode.window.setStatusBarMessage('ABNF: mec is not on the PATH, no language server (set abnf.server.path)', 10000);
+		return;
+	}
+	context.subscriptions.push(vscode.debug.registerDebugAdapterDescriptorFactory('mec', {
+		createDebugAdapterDescriptor(session) {
+			const cfg = session.configuration;
+			const root = session.workspaceFolder ? session.workspaceFolder.uri.fsPath : undefined;
+			return new vscode.DebugAdapterExecutable(mec, [cfg.program ? '-pdebug=dap' : '-debug=dap'].concat(cfg.args || []), { cwd: cfg.cwd || root });
+		},
+	}));
+	let lc;
+	try {
+		lc = require('vscode-languageclient/node');
+	} catch (e) {
+		vscode.window.showWarningMessage('ABNF: run npm install in the extension folder to enable the mec language server.');
+		return;
+	}
+	start(lc, 'abnf', 'mec (ABNF)', mec, ['-lsp'], 'abnf-annotated');
+	const root = vscode.workspace.workspaceFolders ? vscode.workspace.workspaceFolders[0].uri.fsPath : '';
+	for (const entry of vscode.workspace.getConfiguration('abnf').get('languages') || []) {
+		if (!entry.language || !entry.grammar) {
+			continue;
+		}
+		const grammar = path.isAbsolute(entry.grammar) ? entry.grammar : path.join(root, entry.grammar);
+		start(lc, 'mec-' + entry.language, 'mec (' + path.basename(grammar) + ')', mec, ['-lsp', grammar], entry.language);
+	}
+	context.subscriptions.push({ dispose: deactivate });
+}
+
+// start runs one mec -lsp for the files of a VSCode language.
+function start(lc, id, name, mec, args, language) {
+	const server = { command: mec, args: args };
+	const client = new lc.LanguageClient(id, name, { run: server, debug: server }, {
+		documentSelector: [{ scheme: 'file', language: language }],
+	});
+	client.start();
+	clients.push(client);
+}
+
+function deactivate() {
+	return Promise.all(clients.splice(0).map((c) => c.stop()));
+}
+
+module.exports = { activate, deactivate };
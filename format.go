@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"14.gy/mec/abnf"
+)
+
+// -fmt writes grammars in the canonical layout (abnf/format.go):
+//
+//	./mec -fmt grammar.abnf          print the formatted grammar
+//	./mec -fmt -w languages/*.abnf   rewrite the files that are not formatted
+//
+// Without a file it formats stdin to stdout. A grammar that does not compile is
+// reported like a failed first stage and left alone; so is one the formatter
+// would change the a-grammar of, which the formatted text is compiled to check.
+
+// checkFormat rejects what does not combine with -fmt.
+func checkFormat(o *options) error {
+	switch {
+	case o.write && !o.format:
+		return fmt.Errorf("-w rewrites the files -fmt formats; it needs -fmt")
+	case !o.format:
+		return nil
+	case o.write && len(o.files) == 0:
+		return fmt.Errorf("-fmt -w needs the files to rewrite")
+	case len(o.pipeBounds) > 0 || o.batch || o.watch || o.repl || o.codeSet || o.codeStdin:
+		return fmt.Errorf("-fmt formats grammars; it runs no pipeline")
+	}
+	return nil
+}
+
+// runFormat formats the -fmt files, or stdin.
+func runFormat(sess *abnf.Session, o *options) {
+	if len(o.files) == 0 {
+		dat, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading stdin: ", err)
+			exit(1)
+		}
+		out, err := sess.FormatGrammar(abnf.StripBOM(string(dat)), "(stdin)")
+		if err != nil {
+			failStage(sess, err, "(stdin)")
+		}
+		fmt.Print(out)
+		return
+	}
+	failed := false
+	for _, file := range o.files {
+		dat, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			failed = true
+			continue
+		}
+		src := abnf.StripBOM(string(dat))
+		out, err := sess.FormatGrammar(src, file)
+		if err != nil {
+			if !sess.ReportError(err, file) {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			failed = true
+			continue
+		}
+		if !o.write {
+			fmt.Print(out)
+			continue
+		}
+		if out == src {
+			continue
+		}
+		mode := os.FileMode(0o644)
+		if st, err := os.Stat(file); err == nil {
+			mode = st.Mode().Perm()
+		}
+		if err := ioutil.WriteFile(file, []byte(out), mode); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -fmt -w:", err)
+			failed = true
+			continue
+		}
+		fmt.Fprintln(os.Stderr, file)
+	}
+	if failed {
+		exit(1)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The subcommands pick the grammar for a program themselves:
+//
+//	./mec run prog.py            run it (the interpreter grammar, else the -to-llvm-ir one)
+//	./mec interp prog.py         run it with the tree-walking interpreter grammar only
+//	./mec compile prog.py        compile it to IR and run that (the -to-llvm-ir grammar)
+//	./mec build prog.go -o app   link it natively (the -to-llvm-ir grammar with -exe)
+//	./mec languages              list the languages the search path knows
+//
+// The language comes from the program's extension or, failing that, from the
+// interpreter named by its #! line. The grammars come from a registry built from
+// the commands heading every grammar file of the search path: by its :title(),
+// "Kotlin (subset) interpreter" is the interpreter of Kotlin, "Kotlin (subset) to
+// LLVM IR compiler" its compiler, and its :extensions(".kt .kts") and
+// :shebangs("kotlin") say which programs are Kotlin. A new language needs
+// nothing but its grammar files. The search path is $MEC_PATH (a list like
+// $PATH), then languages/ in the working directory, then languages/ next to the
+// mec binary.
+//
+// A subcommand only rewrites the command line into the plain form - the grammar
+// in front of the program - so every other flag works as usual, and the plain
+// form itself is unchanged: only a first argument that is exactly run, interp,
+// compile, build or languages is read as a subcommand (a file of that name is ./run).
+
+// registryGrammar is one grammar file of the search path.
+type registryGrammar struct {
+	path, title, description string
+	language                 string   // Lower-cased, e.g. "kotlin".
+	compiler                 bool     // A "... to LLVM IR compiler" (else an interpreter).
+	exts, shebangs           []string // From :extensions() and :shebangs(), e.g. ".kt", "kotlin".
+}
+
+// languageRegistry is every interpreter and compiler grammar of the search path.
+type languageRegistry struct {
+	grammars []*registryGrammar
+}
+
+var (
+	titleCommand       = regexp.MustCompile(`:title\("((?:[^"\\]|\\.)*)"\)`)
+	descriptionCommand = regexp.MustCompile(`:description\("((?:[^"\\]|\\.)*)"\)`)
+	extensionsCommand  = regexp.MustCompile(`:extensions\("((?:[^"\\]|\\.)*)"\)`)
+	shebangsCommand    = regexp.MustCompile(`:shebangs\("((?:[^"\\]|\\.)*)"\)`)
+)
+
+// languageSearchPath returns the directories searched for grammars, in order.
+func languageSearchPath() []string {
+	var dirs []string
+	if p := os.Getenv("MEC_PATH"); p != "" {
+		dirs = append(dirs, filepath.SplitList(p)...)
+	}
+	dirs = append(dirs, "languages")
+	if exe, err := os.Executable(); err == nil {
+		if exe, err = filepath.EvalSymlinks(exe); err == nil {
+			dirs = append(dirs, filepath.Join(filepath.Dir(exe), "languages"))
+		}
+	}
+	var uniq []string
+	seen := map[string]bool{}
+	for _, d := range dirs {
+		abs, err := filepath.Abs(d)
+		if err != nil || seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		uniq = append(uniq, d)
+	}
+	return uniq
+}
+
+// loadRegistry reads the headings of the grammars in dirs. Only the head of each
+// file is read, where :title(), :extensions() and the like stand: compiling forty
+// grammars to ask for their titles would take seconds.
+func loadRegistry(dirs []string) *languageRegistry {
+	reg := &languageRegistry{}
+	for _, dir := range dirs {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.abnf"))
+		sort.Strings(paths)
+		for _, path := range paths {
+			if g := readGrammarHeading(path); g != nil {
+				reg.grammars = append(reg.grammars, g)
+			}
+		}
+	}
+	return reg
+}
+
+// readGrammarHeading returns the registry entry of the grammar at path, or nil
+// when it has no :title() that names an interpreter or a compiler.
+func readGrammarHeading(path string) *registryGrammar {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	head := make([]byte, 16<<10)
+	n, _ := f.Read(head)
+	src := string(head[:n])
+	m := titleCommand.FindStringSubmatch(src)
+	if m == nil {
+		return nil
+	}
+	g := &registryGrammar{path: path, title: m[1]}
+	if d := descriptionCommand.FindStringSubmatch(src); d != nil {
+		g.description = d[1]
+	}
+	if e := extensionsCommand.FindStringSubmatch(src); e != nil {
+		g.exts = strings.Fields(strings.ToLower(e[1]))
+	}
+	if sb := shebangsCommand.FindStringSubmatch(src); sb != nil {
+		g.shebangs = strings.Fields(sb[1])
+	}
+	title := strings.Replace(g.title, " (subset)", "", 1)
+	if i := strings.Index(title, " to LLVM IR compiler"); i > 0 {
+		g.language, g.compiler = title[:i], true
+	} else if i := strings.Index(title, " interpreter"); i > 0 {
+		g.language = title[:i]
+	} else {
+		return nil // A parser, a preprocessor, a meta grammar: nothing to run a program with.
+	}
+	g.language = strings.ToLower(g.language)
+	return g
+}
+
+// detectLanguage names the language of the program file: by its extension, or
+// by the interpreter of its #! line, as the grammars of the registry declare them.
+func (reg *languageRegistry) detectLanguage(file string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, g := range reg.grammars {
+		if contains(g.exts, ext) {
+			return g.language, nil
+		}
+	}
+	if interp := shebangInterpreter(file); interp != "" {
+		for _, g := range reg.grammars {
+			if contains(g.shebangs, interp) {
+				return g.language, nil
+			}
+		}
+		return "", fmt.Errorf("%s: no known language runs with %s (its #! line)", file, interp)
+	}
+	if ext == "" {
+		return "", fmt.Errorf("%s: no extension and no #! line to tell its language by", file)
+	}
+	return "", fmt.Errorf("%s: no known language has the extension %s (see ./mec languages)", file, ext)
+}
+
+// detection returns the extensions and #! names of lang: those of all its
+// grammars, so one of them declaring them is enough.
+func (reg *languageRegistry) detection(lang string) (exts, shebangs []string) {
+	for _, g := range reg.grammars {
+		if g.language != lang {
+			continue
+		}
+		for _, e := range g.exts {
+			if !contains(exts, e) {
+				exts = append(exts, e)
+			}
+		}
+		for _, sb := range g.shebangs {
+			if !contains(shebangs, sb) {
+				shebangs = append(shebangs, sb)
+			}
+		}
+	}
+	return exts, shebangs
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// shebangInterpreter returns the interpreter a #! line names, without its
+// directory: "#!/usr/bin/env python3" and "#!/usr/bin/python3" both give
+// "python3", "#!/usr/bin/env -S node --flag" gives "node".
+func shebangInterpreter(file string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+	name := filepath.Base(fields[0])
+	if name == "env" {
+		name = ""
+		for _, a := range fields[1:] {
+			if !strings.HasPrefix(a, "-") && !strings.Contains(a, "=") {
+				name = a
+				break
+			}
+		}
+	}
+	return name
+}
+
+// find returns the grammar of lang of the wanted kind; the first one of the
+// search path wins, and within a directory the first by file name.
+func (reg *languageRegistry) find(lang string, compiler bool) *registryGrammar {
+	for _, g := range reg.grammars {
+		if g.language == lang && g.compiler == compiler {
+			return g
+		}
+	}
+	return nil
+}
+
+// isSubcommand reports whether the command line starts with a subcommand.
+func isSubcommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "run", "interp", "compile", "build", "languages":
+		return true
+	}
+	return false
+}
+
+// expandSubcommand rewrites "run|interp|compile|build prog.x [flags]" into the plain
+// command line: the grammar of prog.x's language in front, and for build an -exe
+// from -o (default: the program's name without its extension).
+func expandSubcommand(args []string, reg *languageRegistry) ([]string, error) {
+	cmd, rest := args[0], args[1:]
+	o, err := parseFlags(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.files) == 0 {
+		if o.codeSet || o.codeStdin {
+			return nil, fmt.Errorf("mec %s cannot tell the language of -code / -code-stdin; name the grammar instead: mec GRAMMAR -code ...", cmd)
+		}
+		return nil, fmt.Errorf("mec %s needs a program file", cmd)
+	}
+	if len(o.files) > 1 && !o.batch {
+		return nil, fmt.Errorf("mec %s runs one program, got %d files (use -batch to run several)", cmd, len(o.files))
+	}
+	lang := ""
+	for _, f := range o.files {
+		l, err := reg.detectLanguage(f)
+		if err != nil {
+			return nil, err
+		}
+		if lang != "" && l != lang {
+			return nil, fmt.Errorf("mec %s: %s is %s, but %s is %s", cmd, o.files[0], lang, f, l)
+		}
+		lang = l
+	}
+
+	var g *registryGrammar
+	switch cmd {
+	case "run":
+		if g = reg.find(lang, false); g == nil {
+			g = reg.find(lang, true)
+		}
+	case "interp":
+		g = reg.find(lang, false)
+	case "compile", "build":
+		g = reg.find(lang, true)
+	}
+	if g == nil {
+		kind := map[string]string{"run": "grammar", "interp": "interpreter grammar", "compile": "to-llvm-ir grammar", "build": "to-llvm-ir grammar"}[cmd]
+		return nil, fmt.Errorf("mec %s: no %s for %s in %s", cmd, kind, lang, strings.Join(languageSearchPath(), string(filepath.ListSeparator)))
+	}
+
+	// The program's own arguments (after --) stay last.
+	var progArgs []string
+	for i, a := range rest {
+		if a == "--" {
+			rest, progArgs = rest[:i:i], rest[i:]
+			break
+		}
+	}
+	out := append([]string{g.path}, rest...)
+	if cmd == "build" {
+		exe := o.outPath
+		if exe == "" {
+			base := filepath.Base(o.files[0])
+			if exe = strings.TrimSuffix(base, filepath.Ext(base)); exe == base {
+				exe = "a.out"
+			}
+		}
+		out = append(out, "-exe", exe)
+	}
+	return append(out, progArgs...), nil
+}
+
+// listLanguages prints the registry for "mec languages".
+func listLanguages(reg *languageRegistry) {
+	byLang := map[string][]*registryGrammar{}
+	var langs []string
+	for _, g := range reg.grammars {
+		if byLang[g.language] == nil {
+			langs = append(langs, g.language)
+		}
+		byLang[g.language] = append(byLang[g.language], g)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		exts, shebangs := reg.detection(lang)
+		detect := strings.Join(append(exts, shebangs...), " ")
+		if detect == "" {
+			detect = "(not detected)"
+		}
+		fmt.Printf("%-12s %s\n", lang, detect)
+		for _, g := range byLang[lang] {
+			kind := "interp"
+			if g.compiler {
+				kind = "llvm-ir"
+			}
+			fmt.Printf("  %-7s %s - %s\n", kind, g.path, firstLine(g.description))
+		}
+	}
+}
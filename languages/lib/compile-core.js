@@ -43,6 +43,7 @@ function popName() {
 // resolvable prefixes in core.stdlibImports. Positions come from c.file /
 // c.lineOf(up.pos); -warn-imports / -warn-unsupported arrive as c.warnImports /
 // c.warnUnsupported. `fail` is provided by the grammar (each compiler defines it).
+// Under -diagnostics both findings go to c.report as structured records instead.
 
 // stripWs removes all whitespace from a dotted import path.
 function stripWs(s) {
@@ -65,6 +66,12 @@ function importResolvable(path) {
     }
     return false
 }
+// diagnose reports a finding at byte position pos of file: to the -diagnostics
+// reporter when there is one, else as a "severity: file:line: msg" line on stderr.
+function diagnose(severity, code, msg, file, pos) {
+    if (c.report(severity, code, msg, file, pos)) { return }
+    eprintln(severity + ": " + file + ":" + c.lineOf(pos) + ": " + msg)
+}
 // Resolvable imports are ignored (already provided); an unresolvable one aborts,
 // or warns and continues under -warn-imports.
 function resolveImport(path, pos) {
@@ -74,17 +81,18 @@ function resolveImport(path, pos) {
     // directory and the -i roots): core.importFile parses and walks the file
     // with this grammar and returns true when it took the import.
     if (core.importFile != null && core.importFile(path, pos)) { return }
-    var where = c.curFile() + ":" + c.lineOf(pos)
-    if (c.warnImports) { eprintln("warning: " + where + ": unresolved import '" + path + "' (ignored)"); return }
-    fail("unresolved import '" + path + "' (" + where + "); use -warn-imports to ignore")
+    var file = c.curFile()
+    if (c.warnImports) { diagnose("warning", "unresolved-import", "unresolved import '" + path + "' (ignored)", file, pos); return }
+    if (c.report("error", "unresolved-import", "unresolved import '" + path + "'; use -warn-imports to ignore", file, pos)) { exit(1) }
+    fail("unresolved import '" + path + "' (" + file + ":" + c.lineOf(pos) + "); use -warn-imports to ignore")
 }
 // A construct that parsed but cannot be lowered. Default: abort with a clean
 // file:line message; under -warn-unsupported warn and let the caller place a
 // placeholder so the rest still compiles (enough for call graphs / CFGs / traces).
 function notImpl(construct, pos) {
-    var where = c.file + ":" + c.lineOf(pos)
-    if (c.warnUnsupported) { eprintln("warning: " + where + ": " + construct + " not implemented (ignored)"); return }
-    fail(construct + " not implemented (" + where + "); use -warn-unsupported to ignore")
+    if (c.warnUnsupported) { diagnose("warning", "not-implemented", construct + " not implemented (ignored)", c.file, pos); return }
+    if (c.report("error", "not-implemented", construct + " not implemented; use -warn-unsupported to ignore", c.file, pos)) { exit(1) }
+    fail(construct + " not implemented (" + c.file + ":" + c.lineOf(pos) + "); use -warn-unsupported to ignore")
 }
 // Placeholders - compiler thunks are function(block) -> {b, v} / -> nextBlock.
 function notImplStmt(construct, pos) { notImpl(construct, pos); return function(b) { return b } }
@@ -104,6 +112,92 @@ function emitMainSnippet(b, snippet, stmtRule) {
     return c.compile(frag).stack[0](b)
 }
 
+// ----- -repl: the incremental module -----
+// The compiler half of mec -repl (abnf/repl.go). The grammar's jsmain hands its
+// top-level scope to the runtime with emitReplScope instead of entering main(), runs
+// the module with llvm.RunJS and then calls replLoopIR, which does not return. Every
+// line becomes one more function of the SAME module, jsrepl_N(env, args), whose scope
+// is env itself - the program's top-level scope - so what it declares the next line
+// sees; llvm.RunJSLine loads the grown module next to the ones before and calls it.
+// Growing the module rather than starting a new one keeps every helper a grammar
+// emits once per module (and caches in a variable) valid for the lines too.
+//
+// Reading and continuing lines is interp-core.js's replLoop; opts are the same, except
+// that show(b, v) EMITS the printing of an expression's value v at block b and returns
+// the block to go on in. It is only reached for a value that is neither undefined nor
+// null; replShowCall is the usual body. opts.valued says the grammar's statement
+// thunks answer {b, v} like its expressions (Ruby's do) rather than a block.
+var replCount = 0
+function emitReplScope(b) { callExt(b, "js_repl_scope", [curScopeV]) }
+// replShowCall emits fn(v) for the function bound to the name fn - or reached by a
+// dotted path from one, like "System.out.println" - and answers its value.
+function replShowCall(b, fn, v) {
+    var path = fn.split(".")
+    var fnV = callExt(b, "js_scope_get", [curScopeV, emitStr(b, path[0])])
+    for (var i = 1; i < path.length; i++) { fnV = callExt(b, "js_get", [fnV, emitStr(b, path[i])]) }
+    var argsV = callExt(b, "js_arr_new", [])
+    callExt(b, "js_arr_push", [argsV, v])
+    return callExt(b, "js_call", [fnV, hUndef, argsV])
+}
+function replBlank(s) {
+    for (var i = 0; i < s.length; i++) {
+        var ch = s.charCodeAt(i)
+        if (ch != 32 && ch != 9 && ch != 13) { return false }
+    }
+    return true
+}
+function replLoopIR(opts) {
+    var buf = ""
+    while (true) {
+        var line = c.replRead(buf == "" ? ">>> " : "... ")
+        if (line == null) { exit(0) }
+        if (buf == "" && replBlank(line)) { continue }
+        var ended = replBlank(line)
+        var text = buf == "" ? line : buf + "\n" + line
+        var asg = anytype
+        var isExpr = false
+        if (opts.expr != undefined && buf == "") {
+            asg = c.replParse(c.agrammar, text, opts.expr, true)
+            isExpr = typeof asg != "string"
+        }
+        if (!isExpr) {
+            asg = c.replParse(c.agrammar, text + "\n", opts.stmt, ended)
+            if (asg === "") { buf = text; continue }
+            if (typeof asg == "string") {
+                println("syntax error: " + asg)
+                buf = ""
+                continue
+            }
+            var ch = line.charCodeAt(0)
+            if (buf != "" && !ended && (ch == 32 || ch == 9)) { buf = text; continue }
+        }
+        buf = ""
+        replCount++
+        var f = m.NewFunc("jsrepl_" + replCount, i64, [llvm.ir.NewParam("env", i64), llvm.ir.NewParam("args", i64)])
+        curF = f
+        curScopeV = f.Params[0]
+        loopStack = []
+        var b = f.NewBlock("entry")
+        var t = c.compile(asg).stack[0]
+        if (isExpr) {
+            var r = t(b)
+            b = r.b
+            var showB = f.NewBlock("show")
+            var doneB = f.NewBlock("done")
+            var isNil = b.NewOr(b.NewICmp(llvm.enum.IPredEQ, r.v, hUndef), b.NewICmp(llvm.enum.IPredEQ, r.v, hNull))
+            b.NewCondBr(isNil, doneB, showB)
+            opts.show(showB, r.v).NewBr(doneB)
+            b = doneB
+        } else if (opts.valued) {
+            b = t(b).b
+        } else {
+            b = t(b)
+        }
+        b.NewRet(hUndef)
+        llvm.RunJSLine(m, "jsrepl_" + replCount)
+    }
+}
+
 function hexAt(s, pos, len) {
     var v = 0
     for (var i = 0; i < len; i++) {
@@ -132,6 +226,25 @@ function unescapeJs(s) {
     return out
 }
 
+// ----- The program's command line and standard input -----
+// What mec passes after -- and through -stdin (c.args, c.stdin) reaches the program
+// by two externs, js_argv and js_stdin_line (abnf/jsrt.go, lib/runtime.c), so an
+// -exe binary reads its own instead. emitArgv answers the arguments as an array of
+// strings, behind the program's name when withName is set (sys.argv, os.Args).
+// emitStdinFn answers a function value for the grammar to bind: f(prompt) prints the
+// prompt unless it is undefined and returns the next input line without its line
+// break, or null at the end of the input.
+function emitArgv(b, withName) { return callExt(b, "js_argv", [withName ? hTrue : hFalse]) }
+function emitStdinFn(b) {
+    funcCount++
+    var idx = funcCount
+    var f = m.NewFunc("jsf_" + idx, i64, [llvm.ir.NewParam("env", i64), llvm.ir.NewParam("args", i64)])
+    var fb = f.NewBlock("entry")
+    var prompt = fb.NewCall(getExtern("js_arg", 2), [f.Params[1], handle(0)])
+    fb.NewRet(fb.NewCall(getExtern("js_stdin_line", 1), [prompt]))
+    return callExt(b, "js_closure", [handle(idx), curScopeV])
+}
+
 // ----- The emitter (the same scaffold as metajs-to-llvm-ir.abnf) -----
 
 var i64 = llvm.types.I64
@@ -465,13 +578,21 @@ function excDispatch(b, ctl) {
 // stmtPos wraps a statement thunk with a js_srcpos marker carrying the source
 // position of its node (up.pos), so traces, diagrams and steppers know which
 // statement executes. Only when the host collects positions (c.tracing, i.e.
-// -trace or -cfgraph): otherwise the emitted IR stays exactly as without markers.
+// -trace, -cfgraph or -pdebug): otherwise the emitted IR stays exactly as
+// without markers. Under -pdebug (c.debugging) the marker also carries the scope
+// the statement runs in, for the debugger to show its variables, and where the
+// statement starts (up.pos is where it ends).
 // The grammars apply it with a production level tag on their Statement rule.
 function stmtPos(t) {
     if (!c.tracing || up.pos == undefined) return t
     var pos = up.pos
+    var start = up.start == undefined ? pos : up.start
     return function(b) {
-        callExt(b, "js_srcpos", [handle(pos)])
+        if (c.debugging) {
+            callExt(b, "js_srcpos", [handle(pos), curScopeV == null ? handle(0) : curScopeV, handle(start)])
+        } else {
+            callExt(b, "js_srcpos", [handle(pos)])
+        }
         return t(b)
     }
 }
@@ -62,6 +62,7 @@ var CONT = {sig: "continue"}
 
 function fail(msg) {
     println(core.lang + " interpreter error: " + msg)
+    if (replActive) { throw replFailed } // Ends the -repl line, not the session.
     exit(1)
 }
 
@@ -69,7 +70,8 @@ function fail(msg) {
 // A grammar wires these to its Package/Import/Type-op/... productions and sets the
 // resolvable prefixes in core.stdlibImports. Source positions come from c.file /
 // c.lineOf(up.pos); the -warn-imports / -warn-unsupported flags arrive as
-// c.warnImports / c.warnUnsupported.
+// c.warnImports / c.warnUnsupported. Under -diagnostics both findings go to
+// c.report as structured records instead.
 
 // stripWs removes all whitespace from a dotted import path.
 function stripWs(s) {
@@ -92,6 +94,12 @@ function importResolvable(path) {
     }
     return false
 }
+// diagnose reports a finding at byte position pos of file: to the -diagnostics
+// reporter when there is one, else as a "severity: file:line: msg" line on stderr.
+function diagnose(severity, code, msg, file, pos) {
+    if (c.report(severity, code, msg, file, pos)) { return }
+    eprintln(severity + ": " + file + ":" + c.lineOf(pos) + ": " + msg)
+}
 // Resolvable imports are ignored (already provided); an unresolvable one aborts,
 // or warns and continues under -warn-imports.
 function resolveImport(path, pos) {
@@ -101,17 +109,18 @@ function resolveImport(path, pos) {
     // directory and the -i roots): core.importFile parses and walks the file
     // with this grammar and returns true when it took the import.
     if (core.importFile != null && core.importFile(path, pos)) { return }
-    var where = c.curFile() + ":" + c.lineOf(pos)
-    if (c.warnImports) { eprintln("warning: " + where + ": unresolved import '" + path + "' (ignored)"); return }
-    fail("unresolved import '" + path + "' (" + where + "); use -warn-imports to ignore")
+    var file = c.curFile()
+    if (c.warnImports) { diagnose("warning", "unresolved-import", "unresolved import '" + path + "' (ignored)", file, pos); return }
+    if (c.report("error", "unresolved-import", "unresolved import '" + path + "'; use -warn-imports to ignore", file, pos)) { exit(1) }
+    fail("unresolved import '" + path + "' (" + file + ":" + c.lineOf(pos) + "); use -warn-imports to ignore")
 }
 // A construct that parsed but cannot be lowered. Default: abort with a clean
 // file:line message; under -warn-unsupported warn and let the caller place a
 // placeholder so the rest still runs (enough for call graphs / CFGs / traces).
 function notImpl(construct, pos) {
-    var where = c.file + ":" + c.lineOf(pos)
-    if (c.warnUnsupported) { eprintln("warning: " + where + ": " + construct + " not implemented (ignored)"); return }
-    fail(construct + " not implemented (" + where + "); use -warn-unsupported to ignore")
+    if (c.warnUnsupported) { diagnose("warning", "not-implemented", construct + " not implemented (ignored)", c.file, pos); return }
+    if (c.report("error", "not-implemented", construct + " not implemented; use -warn-unsupported to ignore", c.file, pos)) { exit(1) }
+    fail(construct + " not implemented (" + c.file + ":" + c.lineOf(pos) + "); use -warn-unsupported to ignore")
 }
 // Placeholders - interpreter thunks are function() -> value / signal.
 function notImplStmt(construct, pos) { notImpl(construct, pos); return function() { return undefined } }
@@ -131,6 +140,106 @@ function runMainSnippet(snippet, stmtRule) {
     return c.compile(frag).stack[0]()
 }
 
+// ----- -repl: read statements and run them in the program's scope -----
+// replLoop is the read-eval-print loop of mec -repl (abnf/repl.go). A grammar calls it
+// right after c.compile(c.asg) when c.repl is set, so the program's declarations are
+// made and its top-level code has run; it ends the run with exit(0) at the end of the
+// input. opts.stmt names the production a line is parsed from. opts.expr, when set,
+// is tried first: a line that is an expression prints its value through opts.show,
+// which answers the text to print or null for none (the default prints everything
+// but undefined and null), and opts.thrown, when set, the text of an uncaught
+// exception (default: its value); opts.after runs after every line (JavaScript:
+// the pending jobs of its promises). A line that ends before its statement does is continued
+// ("... "), until the statement parses or an empty line ends it; a continued
+// statement whose last line is indented waits for the empty line as well, because
+// the indented block may go on.
+var replActive = false
+var replFailed = {sig: "repl"}
+function replBlank(s) {
+    for (var i = 0; i < s.length; i++) {
+        var ch = s.charCodeAt(i)
+        if (ch != 32 && ch != 9 && ch != 13) { return false }
+    }
+    return true
+}
+function replLoop(opts) {
+    var show = opts.show
+    if (show == undefined) { show = function(v) { return (v === undefined || v === null) ? null : "" + v } }
+    var buf = ""
+    while (true) {
+        var line = c.replRead(buf == "" ? ">>> " : "... ")
+        if (line == null) { exit(0) }
+        if (buf == "" && replBlank(line)) { continue }
+        var ended = replBlank(line)
+        var text = buf == "" ? line : buf + "\n" + line
+        var asg = anytype
+        var isExpr = false
+        if (opts.expr != undefined && buf == "") {
+            asg = c.replParse(c.agrammar, text, opts.expr, true)
+            isExpr = typeof asg != "string"
+        }
+        if (!isExpr) {
+            asg = c.replParse(c.agrammar, text + "\n", opts.stmt, ended)
+            if (asg === "") { buf = text; continue }
+            if (typeof asg == "string") {
+                println(core.lang + " syntax error: " + asg)
+                buf = ""
+                continue
+            }
+            var ch = line.charCodeAt(0)
+            if (buf != "" && !ended && (ch == 32 || ch == 9)) { buf = text; continue }
+        }
+        buf = ""
+        var saved = scopes
+        replActive = true
+        try {
+            var v = c.compile(asg).stack[0]()
+            if (opts.after != undefined) { opts.after() }
+            if (isExpr) {
+                var shown = show(v)
+                if (shown != null) { println(shown) }
+            }
+        } catch (e) {
+            scopes = saved
+            if (excIsUser(e)) {
+                println(core.lang + " interpreter error: uncaught exception: " + (opts.thrown != undefined ? opts.thrown(e) : e.v))
+            } else if (e !== replFailed) {
+                println(core.lang + " interpreter error: " + e)
+            }
+        }
+        replActive = false
+    }
+}
+
+// ----- The program's command line and standard input -----
+// What mec passes after -- and through -stdin, c.args and c.stdin, in the form the
+// interpreters hand on. progArgv answers a fresh array of the arguments, behind the
+// program's name when withName is set (sys.argv, os.Args). stdinLine(prompt) prints
+// the prompt unless it is undefined and answers the next input line without its line
+// break, or null at the end of the input - the twin of js_stdin_line (abnf/jsrt.go).
+var stdinPos = 0
+function progArgv(withName) {
+    var out = withName ? [c.file] : []
+    for (var i = 0; i < c.args.length; i++) { out.push(c.args[i]) }
+    return out
+}
+function stdinLine(prompt) {
+    if (prompt !== undefined) { print("" + prompt) }
+    var text = c.stdin
+    if (stdinPos >= text.length) { return null }
+    var end = text.indexOf("\n", stdinPos)
+    var line
+    if (end < 0) {
+        line = text.substring(stdinPos)
+        stdinPos = text.length
+    } else {
+        line = text.substring(stdinPos, end)
+        stdinPos = end + 1
+    }
+    if (line.length > 0 && line.charCodeAt(line.length - 1) == 13) { line = line.substring(0, line.length - 1) }
+    return line
+}
+
 // ----- Exceptions (try/catch/finally/throw), shared across the interpreters -----
 // A throw wraps its value in a marker object and raises it as a real host exception,
 // so it unwinds through any depth of expression evaluation up to the nearest catch.
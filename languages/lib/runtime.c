@@ -53,9 +53,11 @@
  */
 
 int putchar(int c);
+int getchar(void);
 int puts(const char *s);
 long write(int fd, const char *buf, unsigned long n);
 void *malloc(unsigned long n);
+void free(void *p);
 char *getenv(const char *name);
 int setjmp(void *env);
 void longjmp(void *env, int v);
@@ -6004,6 +6006,57 @@ long js_arr_new(void)   { return mk_arr(); }
 long js_arr_push(long a, long v) { arr_push(a, v); return 0; }
 long js_arg(long args, long i)   { if (i < arr_len(args)) { return arr_get(args, i); } return H_UNDEF; }
 
+/* The program's command line and standard input, the twins of js_argv and
+ * js_stdin_line in abnf/jsrt.go. main() keeps its argc/argv here; argv[0] is
+ * the executable, which js_argv(true) puts in front of the arguments. */
+long ARGC;
+long ARGV;
+
+long js_argv(long with_name) {
+	long a = mk_arr();
+	char **v = (char **)ARGV;
+	long i = 1;
+	if (with_name == H_TRUE) { i = 0; }
+	while (i < ARGC) {
+		char *s = v[i];
+		long n = 0;
+		while (s[n] != 0) { n = n + 1; }
+		arr_push(a, mk_str(s, n));
+		i = i + 1;
+	}
+	return a;
+}
+/* The next line of stdin without its line break (and a \r before it), after
+ * printing the prompt unless it is undefined; null at the end of the input. */
+long js_stdin_line(long prompt) {
+	long cap = 64;
+	long n = 0;
+	char *buf = malloc(cap);
+	int c = 0;
+	if (prompt != H_UNDEF) { o_str(to_string(prompt)); }
+	c = getchar();
+	if (c < 0) { free(buf); return H_NULL; }
+	while (c >= 0 && c != 10) {
+		if (n + 1 >= cap) {
+			char *nb = malloc(cap * 2);
+			long i = 0;
+			while (i < n) { nb[i] = buf[i]; i = i + 1; }
+			free(buf);
+			buf = nb;
+			cap = cap * 2;
+		}
+		buf[n] = (char)c;
+		n = n + 1;
+		c = getchar();
+	}
+	if (n > 0 && buf[n - 1] == 13) { n = n - 1; }
+	{
+		long h = mk_str(buf, n);
+		free(buf);
+		return h;
+	}
+}
+
 long js_get(long o, long k)          { return get_member(o, k); }
 long js_set(long o, long k, long v)  { set_member(o, k, v); return 0; }
 
@@ -6672,13 +6725,15 @@ void boot(void) {
 	GC_ON = 1;
 }
 
-int main(void) {
+int main(int argc, char **argv) {
 	long r;
 	long buf;
 	long anchor = 0;
 	/* The far end of the C stack scan. The margin covers main's other locals,
 	 * whichever slots the compiler gave them. */
 	GC_STACK_BASE = ((long)&anchor) + 256;
+	ARGC = argc;
+	ARGV = (long)argv;
 	boot();
 	buf = jb_at(0);
 	JB_DEPTH = 1;
@@ -222,6 +222,8 @@
 @.str.140 = global [39 x i8] zeroinitializer
 @RETSLOT = global i64 zeroinitializer
 @.str.141 = global [24 x i8] zeroinitializer
+@ARGC = global i64 zeroinitializer
+@ARGV = global i64 zeroinitializer
 @.str.142 = global [36 x i8] zeroinitializer
 @.str.143 = global [10 x i8] zeroinitializer
 @.str.144 = global [29 x i8] zeroinitializer
@@ -49147,6 +49149,313 @@ dead820:
 	ret i64 0
 }
 
+define i64 @js_argv(i64 %0) {
+entry:
+	%1 = alloca i64
+	store i64 %0, i64* %1
+	%2 = alloca i64
+	%3 = call i64 @mk_arr()
+	store i64 %3, i64* %2
+	%4 = alloca i32*
+	%5 = load i64, i64* @ARGV
+	%6 = inttoptr i64 %5 to i32*
+	%7 = bitcast i32* %6 to i32*
+	store i32* %7, i32** %4
+	%8 = alloca i64
+	%9 = sext i32 1 to i64
+	store i64 %9, i64* %8
+	%10 = load i64, i64* %1
+	%11 = load i64, i64* @H_TRUE
+	%12 = icmp eq i64 %10, %11
+	%13 = zext i1 %12 to i32
+	%14 = icmp ne i32 %13, 0
+	br i1 %14, label %15, label %17
+
+15:
+	%16 = sext i32 0 to i64
+	store i64 %16, i64* %8
+	br label %17
+
+17:
+	br label %18
+
+18:
+	%19 = load i64, i64* %8
+	%20 = load i64, i64* @ARGC
+	%21 = icmp slt i64 %19, %20
+	%22 = zext i1 %21 to i32
+	%23 = icmp ne i32 %22, 0
+	br i1 %23, label %24, label %33
+
+24:
+	%25 = alloca i32*
+	%26 = load i64, i64* %8
+	%27 = load i32*, i32** %4
+	%28 = getelementptr i32*, i32* %27, i64 %26
+	%29 = load i32*, i32** %28
+	%30 = bitcast i32* %29 to i32*
+	store i32* %30, i32** %25
+	%31 = alloca i64
+	%32 = sext i32 0 to i64
+	store i64 %32, i64* %31
+	br label %35
+
+33:
+	%34 = load i64, i64* %2
+	ret i64 %34
+
+35:
+	%36 = load i64, i64* %31
+	%37 = load i32*, i32** %25
+	%38 = getelementptr i8, i32* %37, i64 %36
+	%39 = load i8, i8* %38
+	%40 = sext i8 %39 to i32
+	%41 = icmp ne i32 %40, 0
+	%42 = zext i1 %41 to i32
+	%43 = icmp ne i32 %42, 0
+	br i1 %43, label %44, label %48
+
+44:
+	%45 = load i64, i64* %31
+	%46 = sext i32 1 to i64
+	%47 = add i64 %45, %46
+	store i64 %47, i64* %31
+	br label %35
+
+48:
+	%49 = load i64, i64* %2
+	%50 = load i32*, i32** %25
+	%51 = bitcast i32* %50 to i32*
+	%52 = load i64, i64* %31
+	%53 = call i64 @mk_str(i32* %51, i64 %52)
+	%54 = call i32 @arr_push(i64 %49, i64 %53)
+	%55 = load i64, i64* %8
+	%56 = sext i32 1 to i64
+	%57 = add i64 %55, %56
+	store i64 %57, i64* %8
+	br label %18
+
+dead821:
+	ret i64 0
+}
+
+define i64 @js_stdin_line(i64 %0) {
+entry:
+	%1 = alloca i64
+	store i64 %0, i64* %1
+	%2 = alloca i64
+	%3 = sext i32 64 to i64
+	store i64 %3, i64* %2
+	%4 = alloca i64
+	%5 = sext i32 0 to i64
+	store i64 %5, i64* %4
+	%6 = alloca i32*
+	%7 = load i64, i64* %2
+	%8 = call i32* @malloc(i64 %7)
+	%9 = bitcast i32* %8 to i32*
+	store i32* %9, i32** %6
+	%10 = alloca i32
+	store i32 0, i32* %10
+	%11 = load i64, i64* %1
+	%12 = load i64, i64* @H_UNDEF
+	%13 = icmp ne i64 %11, %12
+	%14 = zext i1 %13 to i32
+	%15 = icmp ne i32 %14, 0
+	br i1 %15, label %16, label %20
+
+16:
+	%17 = load i64, i64* %1
+	%18 = call i64 @to_string(i64 %17)
+	%19 = call i32 @o_str(i64 %18)
+	br label %20
+
+20:
+	%21 = call i32 @getchar()
+	store i32 %21, i32* %10
+	%22 = load i32, i32* %10
+	%23 = icmp slt i32 %22, 0
+	%24 = zext i1 %23 to i32
+	%25 = icmp ne i32 %24, 0
+	br i1 %25, label %26, label %31
+
+26:
+	%27 = load i32*, i32** %6
+	%28 = bitcast i32* %27 to i32*
+	%29 = call i32 @free(i32* %28)
+	%30 = load i64, i64* @H_NULL
+	ret i64 %30
+
+31:
+	br label %32
+
+dead822:
+	br label %31
+
+32:
+	%33 = load i32, i32* %10
+	%34 = icmp sge i32 %33, 0
+	%35 = zext i1 %34 to i32
+	%36 = icmp ne i32 %35, 0
+	%37 = zext i1 %36 to i32
+	%38 = icmp ne i32 %37, 0
+	br i1 %38, label %55, label %61
+
+39:
+	%40 = load i64, i64* %4
+	%41 = sext i32 1 to i64
+	%42 = add i64 %40, %41
+	%43 = load i64, i64* %2
+	%44 = icmp sge i64 %42, %43
+	%45 = zext i1 %44 to i32
+	%46 = icmp ne i32 %45, 0
+	br i1 %46, label %64, label %73
+
+47:
+	%48 = load i64, i64* %4
+	%49 = sext i32 0 to i64
+	%50 = icmp sgt i64 %48, %49
+	%51 = zext i1 %50 to i32
+	%52 = icmp ne i32 %51, 0
+	%53 = zext i1 %52 to i32
+	%54 = icmp ne i32 %53, 0
+	br i1 %54, label %121, label %133
+
+55:
+	%56 = load i32, i32* %10
+	%57 = icmp ne i32 %56, 10
+	%58 = zext i1 %57 to i32
+	%59 = icmp ne i32 %58, 0
+	%60 = zext i1 %59 to i32
+	br label %61
+
+61:
+	%62 = phi i32 [ %37, %32 ], [ %60, %55 ]
+	%63 = icmp ne i32 %62, 0
+	br i1 %63, label %39, label %47
+
+64:
+	%65 = alloca i32*
+	%66 = load i64, i64* %2
+	%67 = sext i32 2 to i64
+	%68 = mul i64 %66, %67
+	%69 = call i32* @malloc(i64 %68)
+	%70 = bitcast i32* %69 to i32*
+	store i32* %70, i32** %65
+	%71 = alloca i64
+	%72 = sext i32 0 to i64
+	store i64 %72, i64* %71
+	br label %89
+
+73:
+	%74 = load i64, i64* %4
+	%75 = load i32*, i32** %6
+	%76 = getelementptr i8, i32* %75, i64 %74
+	%77 = load i32, i32* %10
+	%78 = shl i32 %77, 24
+	%79 = ashr i32 %78, 24
+	%80 = shl i32 %79, 24
+	%81 = ashr i32 %80, 24
+	%82 = shl i32 %81, 24
+	%83 = ashr i32 %82, 24
+	%84 = trunc i32 %83 to i8
+	store i8 %84, i8* %76
+	%85 = load i64, i64* %4
+	%86 = sext i32 1 to i64
+	%87 = add i64 %85, %86
+	store i64 %87, i64* %4
+	%88 = call i32 @getchar()
+	store i32 %88, i32* %10
+	br label %32
+
+89:
+	%90 = load i64, i64* %71
+	%91 = load i64, i64* %4
+	%92 = icmp slt i64 %90, %91
+	%93 = zext i1 %92 to i32
+	%94 = icmp ne i32 %93, 0
+	br i1 %94, label %95, label %112
+
+95:
+	%96 = load i64, i64* %71
+	%97 = load i32*, i32** %65
+	%98 = getelementptr i8, i32* %97, i64 %96
+	%99 = load i64, i64* %71
+	%100 = load i32*, i32** %6
+	%101 = getelementptr i8, i32* %100, i64 %99
+	%102 = load i8, i8* %101
+	%103 = sext i8 %102 to i32
+	%104 = shl i32 %103, 24
+	%105 = ashr i32 %104, 24
+	%106 = shl i32 %105, 24
+	%107 = ashr i32 %106, 24
+	%108 = trunc i32 %107 to i8
+	store i8 %108, i8* %98
+	%109 = load i64, i64* %71
+	%110 = sext i32 1 to i64
+	%111 = add i64 %109, %110
+	store i64 %111, i64* %71
+	br label %89
+
+112:
+	%113 = load i32*, i32** %6
+	%114 = bitcast i32* %113 to i32*
+	%115 = call i32 @free(i32* %114)
+	%116 = load i32*, i32** %65
+	%117 = bitcast i32* %116 to i32*
+	store i32* %117, i32** %6
+	%118 = load i64, i64* %2
+	%119 = sext i32 2 to i64
+	%120 = mul i64 %118, %119
+	store i64 %120, i64* %2
+	br label %73
+
+121:
+	%122 = load i64, i64* %4
+	%123 = sext i32 1 to i64
+	%124 = sub i64 %122, %123
+	%125 = load i32*, i32** %6
+	%126 = getelementptr i8, i32* %125, i64 %124
+	%127 = load i8, i8* %126
+	%128 = sext i8 %127 to i32
+	%129 = icmp eq i32 %128, 13
+	%130 = zext i1 %129 to i32
+	%131 = icmp ne i32 %130, 0
+	%132 = zext i1 %131 to i32
+	br label %133
+
+133:
+	%134 = phi i32 [ %53, %47 ], [ %132, %121 ]
+	%135 = icmp ne i32 %134, 0
+	br i1 %135, label %136, label %140
+
+136:
+	%137 = load i64, i64* %4
+	%138 = sext i32 1 to i64
+	%139 = sub i64 %137, %138
+	store i64 %139, i64* %4
+	br label %140
+
+140:
+	%141 = alloca i64
+	%142 = load i32*, i32** %6
+	%143 = bitcast i32* %142 to i32*
+	%144 = load i64, i64* %4
+	%145 = call i64 @mk_str(i32* %143, i64 %144)
+	store i64 %145, i64* %141
+	%146 = load i32*, i32** %6
+	%147 = bitcast i32* %146 to i32*
+	%148 = call i32 @free(i32* %147)
+	%149 = load i64, i64* %141
+	ret i64 %149
+
+dead823:
+	ret i64 0
+}
+
+declare i32 @getchar()
+
+declare i32 @free(i32* %0)
+
 define i64 @js_get(i64 %0, i64 %1) {
 entry:
 	%2 = alloca i64
@@ -53802,315 +54111,326 @@ entry:
 
 declare i32* @getenv(i32* %0)
 
-define i32 @__mec_body_main() {
+define i32 @__mec_body_main(i32 %0, i32* %1) {
 entry:
-	%0 = alloca i64
-	%1 = alloca i64
-	%2 = alloca i64
-	%3 = sext i32 0 to i64
-	store i64 %3, i64* %2
-	%4 = bitcast i64* %2 to i32*
-	%5 = ptrtoint i32* %4 to i64
-	%6 = sext i32 256 to i64
-	%7 = add i64 %5, %6
-	store i64 %7, i64* @GC_STACK_BASE
-	%8 = call i32 @boot()
-	%9 = sext i32 0 to i64
-	%10 = call i64 @jb_at(i64 %9)
-	store i64 %10, i64* %1
-	%11 = sext i32 1 to i64
-	store i64 %11, i64* @JB_DEPTH
-	%12 = load i64, i64* %1
-	%13 = inttoptr i64 %12 to i32*
-	%14 = bitcast i32* %13 to i32*
-	%15 = call i32 @setjmp(i32* %14)
-	%16 = icmp ne i32 %15, 0
-	%17 = zext i1 %16 to i32
-	%18 = icmp ne i32 %17, 0
-	br i1 %18, label %19, label %71
+	%2 = alloca i32
+	store i32 %0, i32* %2
+	%3 = alloca i32*
+	store i32* %1, i32** %3
+	%4 = alloca i64
+	%5 = alloca i64
+	%6 = alloca i64
+	%7 = sext i32 0 to i64
+	store i64 %7, i64* %6
+	%8 = bitcast i64* %6 to i32*
+	%9 = ptrtoint i32* %8 to i64
+	%10 = sext i32 256 to i64
+	%11 = add i64 %9, %10
+	store i64 %11, i64* @GC_STACK_BASE
+	%12 = load i32, i32* %2
+	%13 = sext i32 %12 to i64
+	store i64 %13, i64* @ARGC
+	%14 = load i32*, i32** %3
+	%15 = bitcast i32* %14 to i32*
+	%16 = ptrtoint i32* %15 to i64
+	store i64 %16, i64* @ARGV
+	%17 = call i32 @boot()
+	%18 = sext i32 0 to i64
+	%19 = call i64 @jb_at(i64 %18)
+	store i64 %19, i64* %5
+	%20 = sext i32 1 to i64
+	store i64 %20, i64* @JB_DEPTH
+	%21 = load i64, i64* %5
+	%22 = inttoptr i64 %21 to i32*
+	%23 = bitcast i32* %22 to i32*
+	%24 = call i32 @setjmp(i32* %23)
+	%25 = icmp ne i32 %24, 0
+	%26 = zext i1 %25 to i32
+	%27 = icmp ne i32 %26, 0
+	br i1 %27, label %28, label %80
 
-19:
-	%20 = alloca i64
-	%21 = load i64, i64* @THROWN
-	%22 = call i64 @exc_text(i64 %21)
-	store i64 %22, i64* %20
-	%23 = sext i32 2 to i64
-	store i64 %23, i64* @OUTFD
-	%24 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 0
-	store i8 106, i8* %24
-	%25 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 1
-	store i8 115, i8* %25
-	%26 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 2
-	store i8 32, i8* %26
-	%27 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 3
-	store i8 114, i8* %27
-	%28 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 4
-	store i8 117, i8* %28
-	%29 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 5
-	store i8 110, i8* %29
-	%30 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 6
-	store i8 116, i8* %30
-	%31 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 7
-	store i8 105, i8* %31
-	%32 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 8
-	store i8 109, i8* %32
-	%33 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 9
-	store i8 101, i8* %33
-	%34 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 10
-	store i8 32, i8* %34
-	%35 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 11
-	store i8 101, i8* %35
-	%36 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 12
+28:
+	%29 = alloca i64
+	%30 = load i64, i64* @THROWN
+	%31 = call i64 @exc_text(i64 %30)
+	store i64 %31, i64* %29
+	%32 = sext i32 2 to i64
+	store i64 %32, i64* @OUTFD
+	%33 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 0
+	store i8 106, i8* %33
+	%34 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 1
+	store i8 115, i8* %34
+	%35 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 2
+	store i8 32, i8* %35
+	%36 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 3
 	store i8 114, i8* %36
-	%37 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 13
-	store i8 114, i8* %37
-	%38 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 14
-	store i8 111, i8* %38
-	%39 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 15
-	store i8 114, i8* %39
-	%40 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 16
-	store i8 58, i8* %40
-	%41 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 17
-	store i8 32, i8* %41
-	%42 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 18
-	store i8 117, i8* %42
-	%43 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 19
-	store i8 110, i8* %43
-	%44 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 20
-	store i8 99, i8* %44
-	%45 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 21
-	store i8 97, i8* %45
-	%46 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 22
-	store i8 117, i8* %46
-	%47 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 23
-	store i8 103, i8* %47
-	%48 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 24
-	store i8 104, i8* %48
-	%49 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 25
-	store i8 116, i8* %49
-	%50 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 26
+	%37 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 4
+	store i8 117, i8* %37
+	%38 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 5
+	store i8 110, i8* %38
+	%39 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 6
+	store i8 116, i8* %39
+	%40 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 7
+	store i8 105, i8* %40
+	%41 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 8
+	store i8 109, i8* %41
+	%42 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 9
+	store i8 101, i8* %42
+	%43 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 10
+	store i8 32, i8* %43
+	%44 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 11
+	store i8 101, i8* %44
+	%45 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 12
+	store i8 114, i8* %45
+	%46 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 13
+	store i8 114, i8* %46
+	%47 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 14
+	store i8 111, i8* %47
+	%48 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 15
+	store i8 114, i8* %48
+	%49 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 16
+	store i8 58, i8* %49
+	%50 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 17
 	store i8 32, i8* %50
-	%51 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 27
-	store i8 101, i8* %51
-	%52 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 28
-	store i8 120, i8* %52
-	%53 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 29
+	%51 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 18
+	store i8 117, i8* %51
+	%52 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 19
+	store i8 110, i8* %52
+	%53 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 20
 	store i8 99, i8* %53
-	%54 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 30
-	store i8 101, i8* %54
-	%55 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 31
-	store i8 112, i8* %55
-	%56 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 32
-	store i8 116, i8* %56
-	%57 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 33
-	store i8 105, i8* %57
-	%58 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 34
-	store i8 111, i8* %58
-	%59 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 35
-	store i8 110, i8* %59
-	%60 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 36
-	store i8 58, i8* %60
-	%61 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 37
-	store i8 32, i8* %61
-	%62 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 38
-	store i8 0, i8* %62
-	%63 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 0
-	%64 = bitcast i8* %63 to i32*
-	%65 = call i32 @o_cstr(i32* %64)
-	%66 = load i64, i64* %20
-	%67 = call i32 @o_str(i64 %66)
-	%68 = call i32 @o_ch(i32 10)
-	%69 = sext i32 1 to i64
-	store i64 %69, i64* @OUTFD
-	%70 = call i32 @exit(i32 1)
-	br label %71
+	%54 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 21
+	store i8 97, i8* %54
+	%55 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 22
+	store i8 117, i8* %55
+	%56 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 23
+	store i8 103, i8* %56
+	%57 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 24
+	store i8 104, i8* %57
+	%58 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 25
+	store i8 116, i8* %58
+	%59 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 26
+	store i8 32, i8* %59
+	%60 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 27
+	store i8 101, i8* %60
+	%61 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 28
+	store i8 120, i8* %61
+	%62 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 29
+	store i8 99, i8* %62
+	%63 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 30
+	store i8 101, i8* %63
+	%64 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 31
+	store i8 112, i8* %64
+	%65 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 32
+	store i8 116, i8* %65
+	%66 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 33
+	store i8 105, i8* %66
+	%67 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 34
+	store i8 111, i8* %67
+	%68 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 35
+	store i8 110, i8* %68
+	%69 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 36
+	store i8 58, i8* %69
+	%70 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 37
+	store i8 32, i8* %70
+	%71 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 38
+	store i8 0, i8* %71
+	%72 = getelementptr [39 x i8], [39 x i8]* @.str.249, i32 0, i32 0
+	%73 = bitcast i8* %72 to i32*
+	%74 = call i32 @o_cstr(i32* %73)
+	%75 = load i64, i64* %29
+	%76 = call i32 @o_str(i64 %75)
+	%77 = call i32 @o_ch(i32 10)
+	%78 = sext i32 1 to i64
+	store i64 %78, i64* @OUTFD
+	%79 = call i32 @exit(i32 1)
+	br label %80
 
-71:
-	%72 = sext i32 0 to i64
-	%73 = sext i32 0 to i64
-	%74 = call i64 @jsmain(i64 %72, i64 %73)
-	store i64 %74, i64* %0
-	%75 = sext i32 0 to i64
-	store i64 %75, i64* @JB_DEPTH
-	%76 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 0
-	store i8 77, i8* %76
-	%77 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 1
-	store i8 69, i8* %77
-	%78 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 2
-	store i8 67, i8* %78
-	%79 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 3
-	store i8 95, i8* %79
-	%80 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 4
-	store i8 71, i8* %80
-	%81 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 5
-	store i8 67, i8* %81
-	%82 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 6
-	store i8 95, i8* %82
-	%83 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 7
-	store i8 83, i8* %83
-	%84 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 8
-	store i8 84, i8* %84
-	%85 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 9
-	store i8 65, i8* %85
-	%86 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 10
-	store i8 84, i8* %86
-	%87 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 11
-	store i8 83, i8* %87
-	%88 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 12
-	store i8 0, i8* %88
-	%89 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 0
-	%90 = bitcast i8* %89 to i32*
-	%91 = call i32* @getenv(i32* %90)
-	%92 = bitcast i32* %91 to i32*
-	%93 = inttoptr i32 0 to i32*
-	%94 = icmp ne i32* %92, %93
-	%95 = zext i1 %94 to i32
-	%96 = icmp ne i32 %95, 0
-	br i1 %96, label %97, label %173
+80:
+	%81 = sext i32 0 to i64
+	%82 = sext i32 0 to i64
+	%83 = call i64 @jsmain(i64 %81, i64 %82)
+	store i64 %83, i64* %4
+	%84 = sext i32 0 to i64
+	store i64 %84, i64* @JB_DEPTH
+	%85 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 0
+	store i8 77, i8* %85
+	%86 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 1
+	store i8 69, i8* %86
+	%87 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 2
+	store i8 67, i8* %87
+	%88 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 3
+	store i8 95, i8* %88
+	%89 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 4
+	store i8 71, i8* %89
+	%90 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 5
+	store i8 67, i8* %90
+	%91 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 6
+	store i8 95, i8* %91
+	%92 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 7
+	store i8 83, i8* %92
+	%93 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 8
+	store i8 84, i8* %93
+	%94 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 9
+	store i8 65, i8* %94
+	%95 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 10
+	store i8 84, i8* %95
+	%96 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 11
+	store i8 83, i8* %96
+	%97 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 12
+	store i8 0, i8* %97
+	%98 = getelementptr [13 x i8], [13 x i8]* @.str.250, i32 0, i32 0
+	%99 = bitcast i8* %98 to i32*
+	%100 = call i32* @getenv(i32* %99)
+	%101 = bitcast i32* %100 to i32*
+	%102 = inttoptr i32 0 to i32*
+	%103 = icmp ne i32* %101, %102
+	%104 = zext i1 %103 to i32
+	%105 = icmp ne i32 %104, 0
+	br i1 %105, label %106, label %182
 
-97:
-	%98 = sext i32 2 to i64
-	store i64 %98, i64* @OUTFD
-	%99 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 0
-	store i8 103, i8* %99
-	%100 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 1
-	store i8 99, i8* %100
-	%101 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 2
-	store i8 58, i8* %101
-	%102 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 3
-	store i8 32, i8* %102
-	%103 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 4
-	store i8 99, i8* %103
-	%104 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 5
-	store i8 111, i8* %104
-	%105 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 6
-	store i8 108, i8* %105
-	%106 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 7
-	store i8 108, i8* %106
-	%107 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 8
-	store i8 101, i8* %107
-	%108 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 9
-	store i8 99, i8* %108
-	%109 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 10
-	store i8 116, i8* %109
-	%110 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 11
-	store i8 105, i8* %110
-	%111 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 12
-	store i8 111, i8* %111
-	%112 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 13
-	store i8 110, i8* %112
-	%113 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 14
-	store i8 115, i8* %113
-	%114 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 15
-	store i8 61, i8* %114
-	%115 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 16
-	store i8 0, i8* %115
-	%116 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 0
-	%117 = bitcast i8* %116 to i32*
-	%118 = call i32 @o_cstr(i32* %117)
-	%119 = load i64, i64* @GC_COUNT
-	%120 = call i64 @d_from_long(i64 %119)
-	%121 = call i64 @mk_num(i64 %120)
-	%122 = call i64 @to_string(i64 %121)
-	%123 = call i32 @o_str(i64 %122)
-	%124 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 0
-	store i8 32, i8* %124
-	%125 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 1
-	store i8 108, i8* %125
-	%126 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 2
-	store i8 105, i8* %126
-	%127 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 3
-	store i8 118, i8* %127
-	%128 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 4
-	store i8 101, i8* %128
-	%129 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 5
-	store i8 61, i8* %129
-	%130 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 6
-	store i8 0, i8* %130
-	%131 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 0
-	%132 = bitcast i8* %131 to i32*
-	%133 = call i32 @o_cstr(i32* %132)
-	%134 = load i64, i64* @GC_LIVE
-	%135 = call i64 @d_from_long(i64 %134)
-	%136 = call i64 @mk_num(i64 %135)
-	%137 = call i64 @to_string(i64 %136)
-	%138 = call i32 @o_str(i64 %137)
-	%139 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 0
-	store i8 32, i8* %139
-	%140 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 1
-	store i8 104, i8* %140
-	%141 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 2
-	store i8 101, i8* %141
-	%142 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 3
-	store i8 97, i8* %142
-	%143 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 4
-	store i8 112, i8* %143
-	%144 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 5
-	store i8 61, i8* %144
-	%145 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 6
-	store i8 0, i8* %145
-	%146 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 0
-	%147 = bitcast i8* %146 to i32*
-	%148 = call i32 @o_cstr(i32* %147)
-	%149 = load i64, i64* @GC_HEAP
-	%150 = call i64 @d_from_long(i64 %149)
-	%151 = call i64 @mk_num(i64 %150)
-	%152 = call i64 @to_string(i64 %151)
-	%153 = call i32 @o_str(i64 %152)
-	%154 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 0
-	store i8 32, i8* %154
-	%155 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 1
-	store i8 112, i8* %155
-	%156 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 2
-	store i8 105, i8* %156
-	%157 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 3
-	store i8 110, i8* %157
-	%158 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 4
-	store i8 110, i8* %158
-	%159 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 5
-	store i8 101, i8* %159
-	%160 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 6
-	store i8 100, i8* %160
-	%161 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 7
-	store i8 61, i8* %161
-	%162 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 8
-	store i8 0, i8* %162
+106:
+	%107 = sext i32 2 to i64
+	store i64 %107, i64* @OUTFD
+	%108 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 0
+	store i8 103, i8* %108
+	%109 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 1
+	store i8 99, i8* %109
+	%110 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 2
+	store i8 58, i8* %110
+	%111 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 3
+	store i8 32, i8* %111
+	%112 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 4
+	store i8 99, i8* %112
+	%113 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 5
+	store i8 111, i8* %113
+	%114 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 6
+	store i8 108, i8* %114
+	%115 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 7
+	store i8 108, i8* %115
+	%116 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 8
+	store i8 101, i8* %116
+	%117 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 9
+	store i8 99, i8* %117
+	%118 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 10
+	store i8 116, i8* %118
+	%119 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 11
+	store i8 105, i8* %119
+	%120 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 12
+	store i8 111, i8* %120
+	%121 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 13
+	store i8 110, i8* %121
+	%122 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 14
+	store i8 115, i8* %122
+	%123 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 15
+	store i8 61, i8* %123
+	%124 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 16
+	store i8 0, i8* %124
+	%125 = getelementptr [17 x i8], [17 x i8]* @.str.251, i32 0, i32 0
+	%126 = bitcast i8* %125 to i32*
+	%127 = call i32 @o_cstr(i32* %126)
+	%128 = load i64, i64* @GC_COUNT
+	%129 = call i64 @d_from_long(i64 %128)
+	%130 = call i64 @mk_num(i64 %129)
+	%131 = call i64 @to_string(i64 %130)
+	%132 = call i32 @o_str(i64 %131)
+	%133 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 0
+	store i8 32, i8* %133
+	%134 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 1
+	store i8 108, i8* %134
+	%135 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 2
+	store i8 105, i8* %135
+	%136 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 3
+	store i8 118, i8* %136
+	%137 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 4
+	store i8 101, i8* %137
+	%138 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 5
+	store i8 61, i8* %138
+	%139 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 6
+	store i8 0, i8* %139
+	%140 = getelementptr [7 x i8], [7 x i8]* @.str.252, i32 0, i32 0
+	%141 = bitcast i8* %140 to i32*
+	%142 = call i32 @o_cstr(i32* %141)
+	%143 = load i64, i64* @GC_LIVE
+	%144 = call i64 @d_from_long(i64 %143)
+	%145 = call i64 @mk_num(i64 %144)
+	%146 = call i64 @to_string(i64 %145)
+	%147 = call i32 @o_str(i64 %146)
+	%148 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 0
+	store i8 32, i8* %148
+	%149 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 1
+	store i8 104, i8* %149
+	%150 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 2
+	store i8 101, i8* %150
+	%151 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 3
+	store i8 97, i8* %151
+	%152 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 4
+	store i8 112, i8* %152
+	%153 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 5
+	store i8 61, i8* %153
+	%154 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 6
+	store i8 0, i8* %154
+	%155 = getelementptr [7 x i8], [7 x i8]* @.str.253, i32 0, i32 0
+	%156 = bitcast i8* %155 to i32*
+	%157 = call i32 @o_cstr(i32* %156)
+	%158 = load i64, i64* @GC_HEAP
+	%159 = call i64 @d_from_long(i64 %158)
+	%160 = call i64 @mk_num(i64 %159)
+	%161 = call i64 @to_string(i64 %160)
+	%162 = call i32 @o_str(i64 %161)
 	%163 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 0
-	%164 = bitcast i8* %163 to i32*
-	%165 = call i32 @o_cstr(i32* %164)
-	%166 = load i64, i64* @PIN_N
-	%167 = call i64 @d_from_long(i64 %166)
-	%168 = call i64 @mk_num(i64 %167)
-	%169 = call i64 @to_string(i64 %168)
-	%170 = call i32 @o_str(i64 %169)
-	%171 = call i32 @o_ch(i32 10)
-	%172 = sext i32 1 to i64
-	store i64 %172, i64* @OUTFD
-	br label %173
+	store i8 32, i8* %163
+	%164 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 1
+	store i8 112, i8* %164
+	%165 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 2
+	store i8 105, i8* %165
+	%166 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 3
+	store i8 110, i8* %166
+	%167 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 4
+	store i8 110, i8* %167
+	%168 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 5
+	store i8 101, i8* %168
+	%169 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 6
+	store i8 100, i8* %169
+	%170 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 7
+	store i8 61, i8* %170
+	%171 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 8
+	store i8 0, i8* %171
+	%172 = getelementptr [9 x i8], [9 x i8]* @.str.254, i32 0, i32 0
+	%173 = bitcast i8* %172 to i32*
+	%174 = call i32 @o_cstr(i32* %173)
+	%175 = load i64, i64* @PIN_N
+	%176 = call i64 @d_from_long(i64 %175)
+	%177 = call i64 @mk_num(i64 %176)
+	%178 = call i64 @to_string(i64 %177)
+	%179 = call i32 @o_str(i64 %178)
+	%180 = call i32 @o_ch(i32 10)
+	%181 = sext i32 1 to i64
+	store i64 %181, i64* @OUTFD
+	br label %182
 
-173:
-	%174 = alloca i64
-	%175 = load i64, i64* %0
-	%176 = call i64 @to_number(i64 %175)
-	store i64 %176, i64* %174
-	%177 = load i64, i64* %174
-	%178 = call i32 @d_is_nan(i64 %177)
-	%179 = icmp ne i32 %178, 0
-	br i1 %179, label %180, label %181
+182:
+	%183 = alloca i64
+	%184 = load i64, i64* %4
+	%185 = call i64 @to_number(i64 %184)
+	store i64 %185, i64* %183
+	%186 = load i64, i64* %183
+	%187 = call i32 @d_is_nan(i64 %186)
+	%188 = icmp ne i32 %187, 0
+	br i1 %188, label %189, label %190
 
-180:
+189:
 	ret i32 0
 
-181:
-	%182 = load i64, i64* %174
-	%183 = call i64 @to_int32(i64 %182)
-	%184 = trunc i64 %183 to i32
-	ret i32 %184
+190:
+	%191 = load i64, i64* %183
+	%192 = call i64 @to_int32(i64 %191)
+	%193 = trunc i64 %192 to i32
+	ret i32 %193
 
-dead911:
-	br label %181
+dead914:
+	br label %190
 
-dead912:
+dead915:
 	ret i32 0
 }
 
@@ -59049,10 +59369,10 @@ entry:
 	ret i32 0
 }
 
-define i32 @main() {
+define i32 @main(i32 %0, i32* %1) {
 entry:
-	%0 = call i32 @__mec_ginit()
-	%1 = call i32 @__mec_body_main()
-	ret i32 %1
+	%2 = call i32 @__mec_ginit()
+	%3 = call i32 @__mec_body_main(i32 %0, i32* %1)
+	ret i32 %3
 }
 
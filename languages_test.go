@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExpandSubcommand detects the language by extension and #! line from the
+// grammars' own :extensions() and :shebangs(), and picks the interpreter for
+// run and interp, the compiler for compile and build.
+func TestExpandSubcommand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		// The python compiler declares nothing: its interpreter speaks for both.
+		"py-interpreter.abnf": ":title(\"Py (subset) interpreter\") ;\n:extensions(\".py .PYW\") ;\n:shebangs(\"python3\") ;\n",
+		"py-to-llvm-ir.abnf":  ":title(\"Py to LLVM IR compiler\") ;\n",
+		"zz-to-llvm-ir.abnf":  ":title(\"Zz to LLVM IR compiler\") ;\n:extensions(\".zz\") ;\n",
+		"a.py":                "print(1)\n",
+		"b.pyw":               "print(1)\n",
+		"script":              "#!/usr/bin/env python3\nprint(1)\n",
+		"tool":                "#!/usr/bin/perl\n",
+		"noext":               "print(1)\n",
+		"c.rb":                "puts 1\n",
+		"p.zz":                "z\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reg := loadRegistry([]string{dir})
+	interp, comp, zz := filepath.Join(dir, "py-interpreter.abnf"), filepath.Join(dir, "py-to-llvm-ir.abnf"), filepath.Join(dir, "zz-to-llvm-ir.abnf")
+	p := func(name string) string { return filepath.Join(dir, name) }
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		want []string
+		err  string
+	}{
+		{"run by extension prefers the interpreter", []string{"run", p("a.py")}, []string{interp, p("a.py")}, ""},
+		{"extensions are matched without case", []string{"run", p("b.pyw")}, []string{interp, p("b.pyw")}, ""},
+		{"interp", []string{"interp", p("a.py"), "-q"}, []string{interp, p("a.py"), "-q"}, ""},
+		{"compile picks the compiler", []string{"compile", p("a.py")}, []string{comp, p("a.py")}, ""},
+		{"build adds -exe", []string{"build", p("a.py")}, []string{comp, p("a.py"), "-exe", "a"}, ""},
+		{"build -o", []string{"build", p("a.py"), "-o", "app"}, []string{comp, p("a.py"), "-o", "app", "-exe", "app"}, ""},
+		{"program arguments stay last", []string{"run", p("a.py"), "--", "x"}, []string{interp, p("a.py"), "--", "x"}, ""},
+		{"run by #! line", []string{"run", p("script")}, []string{interp, p("script")}, ""},
+		{"run falls back to the compiler", []string{"run", p("p.zz")}, []string{zz, p("p.zz")}, ""},
+		{"interp without an interpreter", []string{"interp", p("p.zz")}, nil, "no interpreter grammar for zz"},
+		{"unknown extension", []string{"run", p("c.rb")}, nil, "no known language has the extension .rb"},
+		{"unknown #! interpreter", []string{"run", p("tool")}, nil, "no known language runs with perl"},
+		{"no extension, no #! line", []string{"run", p("noext")}, nil, "no extension and no #! line"},
+	} {
+		got, err := expandSubcommand(tc.args, reg)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: error %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\n got %q\nwant %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,971 @@
+package main
+
+// mec -lsp: a language server for annotated ABNF grammar files, speaking the
+// Language Server Protocol over stdin/stdout (editor/vscode-abnf launches it).
+//
+// Every open .abnf file is compiled by the built-in ABNF a-grammar on each edit,
+// exactly as the first stage of a run compiles it, so the editor sees the same
+// parse errors mec would print. A grammar that compiles is assembled with its
+// :include() fragments and checked by abnf.Verify; the issues are moved from
+// Verify's line numbers to the exact name they are about, in whichever file of
+// the assembly that name sits.
+//
+// Navigation works on an index of the assembled grammar: every production
+// definition and every Identifier that names one, each with its file and byte
+// span. A rule's Pos is the byte offset just behind its name in the source it
+// was compiled from, and the :origin() stamps split the top level list into
+// those sources (an :include() appends the fragment's rules and its own stamp
+// behind the includer's). The index serves go-to-definition, find-references,
+// rename and hover across the fragments; document symbols and completion of
+// production names and :commands round it off.
+//
+// A fragment that is open next to a grammar including it is navigated with that
+// grammar's index, and only its own parse errors are reported: on its own it
+// references productions it does not define, which Verify would call undefined.
+// The index of a file that does not compile is the last one that did, so
+// navigation keeps working while a line is half typed; rename refuses it.
+//
+// Given a grammar file, mec -lsp serves the language of that grammar instead,
+// for whatever files the editor opens with it (lsplang.go).
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf"
+	"14.gy/mec/abnf/r"
+)
+
+// runLSP serves the protocol on stdin/stdout until the client says exit.
+func runLSP(o *options) {
+	eng := abnf.NewEngine()
+	eng.CatchExit = true // A script's exit() must not end the server.
+	eng.ImportRoots = o.importRoots
+	srv := newLSPServer(os.Stdin, os.Stdout, eng)
+	if len(o.files) == 1 {
+		lang, err := loadLSPLanguage(eng, o.files[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		srv.lang = lang
+	}
+	os.Exit(srv.serve())
+}
+
+// lspServer is the protocol half: the framing, the open documents and the
+// dispatch of requests to the grammar half below.
+type lspServer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	eng       *abnf.Engine
+	docs      map[string]*lspDoc  // The open documents by URI.
+	published map[string][]string // Document URI -> the URIs its last analysis sent diagnostics to.
+	lang      *lspLanguage        // The language served by mec -lsp <grammar>; nil serves grammar files.
+	shutdown  bool
+}
+
+// lspDoc is an open document.
+type lspDoc struct {
+	uri, path, text string
+	index           *grammarIndex    // The last analysis that compiled (nil until one does).
+	current         bool             // index was built from text.
+	spans           []abnf.ParseSpan // A program's last parse (mec -lsp <grammar>).
+}
+
+func newLSPServer(in io.Reader, out io.Writer, eng *abnf.Engine) *lspServer {
+	return &lspServer{in: bufio.NewReader(in), out: out, eng: eng, docs: map[string]*lspDoc{}, published: map[string][]string{}}
+}
+
+// lspMessage is a JSON-RPC request, notification or response.
+type lspMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// lspError is a failed request's error, with a JSON-RPC error code.
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *lspError) Error() string { return e.Message }
+
+const (
+	lspInvalidParams  = -32602
+	lspMethodNotFound = -32601
+	lspRequestFailed  = -32803
+)
+
+// serve reads messages until exit (or the end of the input) and returns the
+// process exit code: 0 when a shutdown came first, as the protocol asks.
+func (s *lspServer) serve() int {
+	for {
+		data, err := s.read()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, "mec -lsp:", err)
+			}
+			return 1
+		}
+		var msg lspMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			fmt.Fprintln(os.Stderr, "mec -lsp: bad message:", err)
+			continue
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		result, rerr := s.handle(msg.Method, msg.Params)
+		if msg.ID == nil {
+			continue // A notification: no answer.
+		}
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID}
+		if rerr != nil {
+			e, ok := rerr.(*lspError)
+			if !ok {
+				e = &lspError{Code: lspRequestFailed, Message: rerr.Error()}
+			}
+			resp["error"] = e
+		} else {
+			resp["result"] = result
+		}
+		s.write(resp)
+	}
+}
+
+// read reads one message.
+func (s *lspServer) read() ([]byte, error) {
+	return readFramed(s.in)
+}
+
+// readFramed reads one message: headers, a blank line, then Content-Length
+// bytes. The Debug Adapter Protocol of -debug=dap (debug.go) is framed the same.
+func readFramed(in *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if v := strings.TrimPrefix(line, "Content-Length:"); v != line {
+			if length, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+				return nil, fmt.Errorf("bad Content-Length %q", v)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("a message without Content-Length")
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(in, data)
+	return data, err
+}
+
+// write sends one message.
+func (s *lspServer) write(msg map[string]interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mec -lsp:", err)
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// notify sends a notification to the client.
+func (s *lspServer) notify(method string, params interface{}) {
+	s.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// The protocol's position types. Characters count UTF-16 code units.
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// handle answers one request or takes one notification.
+func (s *lspServer) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		if s.lang != nil {
+			return map[string]interface{}{"capabilities": s.lang.capabilities(), "serverInfo": map[string]interface{}{"name": "mec"}}, nil
+		}
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       map[string]interface{}{"openClose": true, "change": 1, "save": true}, // 1: the whole text on every change.
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"renameProvider":         true,
+				"completionProvider":     map[string]interface{}{"triggerCharacters": []string{":"}},
+			},
+			"serverInfo": map[string]interface{}{"name": "mec"},
+		}, nil
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		doc := &lspDoc{uri: p.TextDocument.URI, path: uriPath(p.TextDocument.URI), text: p.TextDocument.Text}
+		s.docs[doc.uri] = doc
+		s.analyze(doc)
+		return nil, nil
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		doc := s.docs[p.TextDocument.URI]
+		if doc == nil || len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		doc.text = p.ContentChanges[len(p.ContentChanges)-1].Text
+		doc.current = false
+		s.analyze(doc)
+		return nil, nil
+	case "textDocument/didSave":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		// The grammars that include the saved file read it from disk: now they
+		// see the change.
+		if doc := s.docs[p.TextDocument.URI]; doc != nil {
+			for _, other := range s.docs {
+				if other != doc && other.index != nil && other.index.files[doc.path] != nil {
+					s.analyze(other)
+				}
+			}
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		s.publish(p.TextDocument.URI, nil)
+		return nil, nil
+	case "textDocument/definition", "textDocument/references", "textDocument/hover", "textDocument/rename", "textDocument/completion":
+		var p struct {
+			lspTextDocumentPosition
+			Context struct {
+				IncludeDeclaration bool `json:"includeDeclaration"`
+			} `json:"context"`
+			NewName string `json:"newName"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+		doc := s.docs[p.TextDocument.URI]
+		if doc == nil {
+			return nil, nil
+		}
+		switch method {
+		case "textDocument/definition":
+			return s.definition(doc, p.Position), nil
+		case "textDocument/references":
+			return s.references(doc, p.Position, p.Context.IncludeDeclaration), nil
+		case "textDocument/hover":
+			return s.hover(doc, p.Position), nil
+		case "textDocument/rename":
+			return s.rename(doc, p.Position, p.NewName)
+		}
+		return s.completion(doc, p.Position), nil
+	case "textDocument/documentSymbol":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if doc := s.docs[p.TextDocument.URI]; doc != nil {
+			if s.lang != nil {
+				return s.programSymbols(doc), nil
+			}
+			return s.symbols(doc), nil
+		}
+		return nil, nil
+	case "textDocument/foldingRange", "textDocument/semanticTokens/full":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		doc := s.docs[p.TextDocument.URI]
+		if doc == nil || s.lang == nil {
+			return nil, nil
+		}
+		if method == "textDocument/foldingRange" {
+			return s.foldingRanges(doc), nil
+		}
+		return s.semanticTokens(doc), nil
+	}
+	if strings.HasPrefix(method, "$/") {
+		return nil, nil // Optional notifications a server may ignore.
+	}
+	return nil, &lspError{Code: lspMethodNotFound, Message: "unsupported method " + method}
+}
+
+// publish sends the diagnostics of the files one document's analysis reported
+// on (keyed by path), and clears those it reported on last time and not now.
+func (s *lspServer) publish(uri string, byPath map[string][]interface{}) {
+	var sent []string
+	for path, diags := range byPath {
+		target := pathURI(path)
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": target, "diagnostics": diags})
+		sent = append(sent, target)
+	}
+	for _, old := range s.published[uri] {
+		if _, again := byPath[uriPath(old)]; !again {
+			s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": old, "diagnostics": []interface{}{}})
+		}
+	}
+	s.published[uri] = sent
+}
+
+// uriPath is the file path of a file:// URI.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathURI is the file:// URI of a path.
+func pathURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// ----------------------------------------------------------------------------
+// Source text positions
+
+// lspText maps between byte offsets and protocol positions in one text.
+type lspText struct {
+	text   string
+	starts []int // The byte offset of every line start.
+}
+
+func newLSPText(text string) *lspText {
+	t := &lspText{text: text, starts: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			t.starts = append(t.starts, i+1)
+		}
+	}
+	return t
+}
+
+// position is the protocol position of byte offset off.
+func (t *lspText) position(off int) lspPosition {
+	if off > len(t.text) {
+		off = len(t.text)
+	}
+	line := sort.SearchInts(t.starts, off+1) - 1
+	if line < 0 {
+		line = 0
+	}
+	return lspPosition{Line: line, Character: utf16Len(t.text[t.starts[line]:off])}
+}
+
+// offset is the byte offset of protocol position p.
+func (t *lspText) offset(p lspPosition) int {
+	if p.Line >= len(t.starts) {
+		return len(t.text)
+	}
+	off := t.starts[p.Line]
+	for units := 0; off < len(t.text) && t.text[off] != '\n' && units < p.Character; {
+		c, size := utf8.DecodeRuneInString(t.text[off:])
+		units += utf16Len(string(c))
+		off += size
+	}
+	return off
+}
+
+// lineEnd is the byte offset of the end of the line off is on.
+func (t *lspText) lineEnd(off int) int {
+	if i := strings.IndexByte(t.text[off:], '\n'); i >= 0 {
+		return off + i
+	}
+	return len(t.text)
+}
+
+// lineRange is the range of 1-based line, without its indentation.
+func (t *lspText) lineRange(line int) lspRange {
+	if line < 1 || line > len(t.starts) {
+		line = 1
+	}
+	start := t.starts[line-1]
+	end := t.lineEnd(start)
+	for start < end && (t.text[start] == ' ' || t.text[start] == '\t') {
+		start++
+	}
+	for end > start && (t.text[end-1] == ' ' || t.text[end-1] == '\t' || t.text[end-1] == '\r') {
+		end--
+	}
+	return lspRange{t.position(start), t.position(end)}
+}
+
+// utf16Len is the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, c := range s {
+		if c >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// ----------------------------------------------------------------------------
+// The grammar half: analysis and the index
+
+// grammarIndex is what one analysis found: the productions of the assembled
+// grammar and the names that refer to them, by file.
+type grammarIndex struct {
+	root  string                    // The path of the analyzed document.
+	files map[string]*lspText       // Every file of the assembly, by path.
+	defs  map[string]lspSpan        // Production name -> its definition.
+	prods map[string]*r.Rule        // Production name -> the production.
+	refs  map[string][]lspSpan      // Name -> the Identifiers naming it, in file order.
+	order map[string][]string       // Path -> its productions, in definition order.
+	ends  map[string]map[string]int // Path -> production -> the byte offset its body ends at.
+}
+
+// lspSpan is a name's byte span in a file.
+type lspSpan struct {
+	path       string
+	start, end int
+}
+
+// analyze compiles a document, publishes its diagnostics and, when it
+// compiled, replaces its index. The open fragments it includes are analyzed
+// again afterwards: they are now navigated with this index.
+func (s *lspServer) analyze(doc *lspDoc) {
+	if s.lang != nil {
+		s.analyzeProgram(doc)
+		return
+	}
+	s.analyzeOne(doc)
+	if doc.current {
+		for _, other := range s.docs {
+			if other != doc && doc.index.files[other.path] != nil {
+				s.analyzeOne(other)
+			}
+		}
+	}
+}
+
+func (s *lspServer) analyzeOne(doc *lspDoc) {
+	sess := s.eng.NewSession(nil, nil)
+	opts := &abnf.Parseropts{PreventDefaultOutput: true}
+	diags := map[string][]interface{}{doc.path: {}}
+	texts := map[string]*lspText{doc.path: newLSPText(doc.text)}
+	report := func(d abnf.Diagnostic) {
+		if d.File == "" {
+			d.File = doc.path
+		}
+		t := texts[d.File]
+		if t == nil {
+			t = loadLSPText(d.File)
+			texts[d.File] = t
+		}
+		diags[d.File] = append(diags[d.File], lspDiagnostic(t, d))
+	}
+
+	grammar, err := sess.CompileGrammar(doc.text, doc.path, 0, opts, true)
+	if err == nil && grammar == nil {
+		err = fmt.Errorf("the file did not compile to an a-grammar")
+	}
+	if err != nil {
+		report(abnf.ErrorDiagnostic(err, doc.path))
+		doc.current = false
+		s.publish(doc.uri, diags)
+		return
+	}
+	own := abnf.ProductionNames(grammar)
+	if abnf.HasInclude(grammar) {
+		if err := sess.AssembleIncludes(grammar, doc.path, opts); err != nil {
+			d := abnf.ErrorDiagnostic(err, doc.path)
+			if d.Code == "compile-error" {
+				d.Code = "include-error"
+			}
+			report(d)
+		}
+	}
+	doc.index = buildGrammarIndex(doc.path, doc.text, grammar)
+	doc.current = true
+	if s.owner(doc) == nil {
+		for _, iss := range abnf.Verify(grammar, doc.text, own) {
+			report(doc.index.locate(iss))
+		}
+	}
+	s.publish(doc.uri, diags)
+}
+
+// owner is another open document whose grammar includes doc, if any.
+func (s *lspServer) owner(doc *lspDoc) *lspDoc {
+	for _, other := range s.docs {
+		if other != doc && other.index != nil && other.index.root != doc.path && other.index.files[doc.path] != nil {
+			return other
+		}
+	}
+	return nil
+}
+
+// indexOf is the index a document is navigated with: its owner's, if it is an
+// included fragment, else its own. It may be nil.
+func (s *lspServer) indexOf(doc *lspDoc) *grammarIndex {
+	if o := s.owner(doc); o != nil {
+		return o.index
+	}
+	return doc.index
+}
+
+// loadLSPText reads a file of the assembly (an :include()d fragment).
+func loadLSPText(path string) *lspText {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return newLSPText("")
+	}
+	return newLSPText(abnf.StripBOM(string(dat)))
+}
+
+// lspDiagnostic converts a diagnostic into the protocol's form. A position
+// runs to the end of its line; a line without a column is the whole line.
+func lspDiagnostic(t *lspText, d abnf.Diagnostic) map[string]interface{} {
+	rng := t.lineRange(d.Line)
+	if d.Line >= 1 && d.Line <= len(t.starts) && d.Column > 0 {
+		start := t.starts[d.Line-1]
+		end := t.lineEnd(start)
+		off := start
+		for col := 1; col < d.Column && off < end; col++ {
+			_, size := utf8.DecodeRuneInString(t.text[off:])
+			off += size
+		}
+		if off == end && off > start {
+			off-- // At the end of the line: mark its last char.
+		}
+		rng = lspRange{t.position(off), t.position(end)}
+		if d.EndLine > 0 {
+			rng.End = t.position(t.offset(lspPosition{Line: d.EndLine - 1, Character: d.EndColumn - 1}))
+		}
+	}
+	severity := 1
+	switch d.Severity {
+	case "warning":
+		severity = 2
+	case "note":
+		severity = 3
+	}
+	diag := map[string]interface{}{"range": rng, "severity": severity, "code": d.Code, "source": "mec", "message": d.Message}
+	if d.Code == "unreachable" {
+		diag["tags"] = []int{1} // Unnecessary: editors fade the dead production.
+	}
+	var related []interface{}
+	for _, rl := range d.Related {
+		rt := t
+		if rl.File != d.File {
+			rt = loadLSPText(rl.File)
+		}
+		related = append(related, map[string]interface{}{
+			"location": lspLocation{URI: pathURI(rl.File), Range: rt.lineRange(rl.Line)},
+			"message":  rl.Message,
+		})
+	}
+	if related != nil {
+		diag["relatedInformation"] = related
+	}
+	return diag
+}
+
+// buildGrammarIndex indexes an assembled grammar compiled from text at root.
+func buildGrammarIndex(root, text string, grammar *r.Rules) *grammarIndex {
+	ix := &grammarIndex{root: root, files: map[string]*lspText{root: newLSPText(text)},
+		defs: map[string]lspSpan{}, prods: map[string]*r.Rule{}, refs: map[string][]lspSpan{},
+		order: map[string][]string{}, ends: map[string]map[string]int{}}
+	// Every rule belongs to the first :origin() stamp behind it.
+	file := make([]string, len(*grammar))
+	cur := root
+	for i := len(*grammar) - 1; i >= 0; i-- {
+		rule := (*grammar)[i]
+		if rule.Operator == r.Command && rule.String == "origin" && rule.CodeChilds != nil && len(*rule.CodeChilds) > 0 {
+			cur = filepath.Clean((*rule.CodeChilds)[0].String)
+		}
+		file[i] = cur
+	}
+	for i, rule := range *grammar {
+		path := file[i]
+		t := ix.files[path]
+		if t == nil {
+			t = loadLSPText(path)
+			ix.files[path] = t
+		}
+		switch rule.Operator {
+		case r.Production:
+			if _, dup := ix.defs[rule.String]; dup {
+				continue
+			}
+			ix.defs[rule.String] = nameSpan(t, path, rule.String, rule.Pos)
+			ix.prods[rule.String] = rule
+			ix.order[path] = append(ix.order[path], rule.String)
+			end := rule.Pos
+			ix.walk(t, path, rule.Childs, &end)
+			if ix.ends[path] == nil {
+				ix.ends[path] = map[string]int{}
+			}
+			ix.ends[path][rule.String] = end
+		case r.Command:
+			if rule.String != "origin" {
+				end := 0
+				ix.walk(t, path, rule.CodeChilds, &end)
+			}
+		}
+	}
+	for name := range ix.refs {
+		spans := ix.refs[name]
+		sort.SliceStable(spans, func(i, j int) bool {
+			if spans[i].path != spans[j].path {
+				return spans[i].path == root // The analyzed file first.
+			}
+			return spans[i].start < spans[j].start
+		})
+	}
+	return ix
+}
+
+// walk records the Identifiers under rules and raises *end to the furthest
+// position seen. A Tag's code is not walked: the names in a tag are script
+// names, not productions.
+func (ix *grammarIndex) walk(t *lspText, path string, rules *r.Rules, end *int) {
+	if rules == nil {
+		return
+	}
+	for _, rule := range *rules {
+		if rule.Pos > *end {
+			*end = rule.Pos
+		}
+		if rule.Operator == r.Identifier {
+			ix.refs[rule.String] = append(ix.refs[rule.String], nameSpan(t, path, rule.String, rule.Pos))
+		}
+		ix.walk(t, path, rule.Childs, end)
+		if rule.Operator != r.Tag {
+			ix.walk(t, path, rule.CodeChilds, end)
+		}
+	}
+}
+
+// nameSpan is the span of name ending at pos; when the text there is not the
+// name (a rule without a real position), the first whole-word occurrence.
+func nameSpan(t *lspText, path, name string, pos int) lspSpan {
+	if start := pos - len(name); start >= 0 && pos <= len(t.text) && t.text[start:pos] == name {
+		return lspSpan{path, start, pos}
+	}
+	for from := 0; ; {
+		i := strings.Index(t.text[from:], name)
+		if i < 0 {
+			return lspSpan{path, 0, 0}
+		}
+		start := from + i
+		if isNameBoundary(t.text, start-1) && isNameBoundary(t.text, start+len(name)) {
+			return lspSpan{path, start, start + len(name)}
+		}
+		from = start + 1
+	}
+}
+
+// isNameBoundary reports whether the byte at i cannot continue a name.
+func isNameBoundary(text string, i int) bool {
+	if i < 0 || i >= len(text) {
+		return true
+	}
+	return !isNameByte(text[i])
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// locate turns a Verify issue into a diagnostic at the name it is about.
+func (ix *grammarIndex) locate(iss abnf.VerifyIssue) abnf.Diagnostic {
+	d := iss.Diagnostic(ix.root)
+	var span lspSpan
+	switch iss.Kind {
+	case "undefined":
+		if refs := ix.refs[iss.Name]; len(refs) > 0 {
+			span = refs[0]
+		}
+	case "unreachable":
+		span = ix.defs[iss.Name]
+	case "dupfunc":
+		if t := ix.files[ix.root]; iss.Line >= 1 && iss.Line <= len(t.starts) {
+			line := t.text[t.starts[iss.Line-1]:t.lineEnd(t.starts[iss.Line-1])]
+			if i := strings.Index(line, "function "+iss.Name); i >= 0 {
+				start := t.starts[iss.Line-1] + i + len("function ")
+				span = lspSpan{ix.root, start, start + len(iss.Name)}
+			}
+		}
+	}
+	if span.end > span.start {
+		t := ix.files[span.path]
+		from, to := t.position(span.start), t.position(span.end)
+		d.File, d.Line, d.Column, d.EndLine, d.EndColumn = span.path, from.Line+1, utf8.RuneCountInString(t.text[t.starts[from.Line]:span.start])+1, to.Line+1, to.Character+1
+	}
+	return d
+}
+
+// nameAt is the production name at a position of a document, and its span.
+func (ix *grammarIndex) nameAt(path string, off int) (string, lspSpan, bool) {
+	for name, def := range ix.defs {
+		if def.path == path && def.start <= off && off <= def.end {
+			return name, def, true
+		}
+	}
+	for name, refs := range ix.refs {
+		for _, ref := range refs {
+			if ref.path == path && ref.start <= off && off <= ref.end {
+				return name, ref, true
+			}
+		}
+	}
+	return "", lspSpan{}, false
+}
+
+// location is the protocol location of a span.
+func (ix *grammarIndex) location(span lspSpan) lspLocation {
+	t := ix.files[span.path]
+	return lspLocation{URI: pathURI(span.path), Range: lspRange{t.position(span.start), t.position(span.end)}}
+}
+
+// target resolves a request position to a name of the document's index.
+func (s *lspServer) target(doc *lspDoc, pos lspPosition) (*grammarIndex, string, bool) {
+	ix := s.indexOf(doc)
+	if ix == nil || ix.files[doc.path] == nil {
+		return nil, "", false
+	}
+	name, _, ok := ix.nameAt(doc.path, ix.files[doc.path].offset(pos))
+	return ix, name, ok
+}
+
+func (s *lspServer) definition(doc *lspDoc, pos lspPosition) interface{} {
+	ix, name, ok := s.target(doc, pos)
+	if !ok {
+		return nil
+	}
+	def, defined := ix.defs[name]
+	if !defined {
+		return nil
+	}
+	return ix.location(def)
+}
+
+func (s *lspServer) references(doc *lspDoc, pos lspPosition, withDecl bool) interface{} {
+	ix, name, ok := s.target(doc, pos)
+	if !ok {
+		return nil
+	}
+	locs := []lspLocation{}
+	if def, defined := ix.defs[name]; defined && withDecl {
+		locs = append(locs, ix.location(def))
+	}
+	for _, ref := range ix.refs[name] {
+		locs = append(locs, ix.location(ref))
+	}
+	return locs
+}
+
+// hover shows the production a name is about, written back as grammar source.
+func (s *lspServer) hover(doc *lspDoc, pos lspPosition) interface{} {
+	ix, name, ok := s.target(doc, pos)
+	if !ok {
+		return nil
+	}
+	prod := ix.prods[name]
+	if prod == nil {
+		return map[string]interface{}{"contents": map[string]interface{}{"kind": "markdown", "value": "`" + name + "`: no production defines it"}}
+	}
+	src := strings.TrimSpace(abnf.GrammarSource(&r.Rules{prod}))
+	if i := strings.Index(src, " = "); i >= 0 {
+		src = strings.TrimRight(src[:i], " ") + src[i:] // GrammarSource aligns the name to a column.
+	}
+	const maxHover = 2000
+	if len(src) > maxHover {
+		src = src[:maxHover] + " ..."
+	}
+	where := ""
+	if def := ix.defs[name]; def.path != doc.path {
+		where = "\n\nfrom " + filepath.Base(def.path)
+	}
+	return map[string]interface{}{"contents": map[string]interface{}{"kind": "markdown", "value": "```abnf\n" + src + "\n```" + where}}
+}
+
+// rename renames a production at its definition and at every Identifier that
+// names it, in every file of the assembly.
+func (s *lspServer) rename(doc *lspDoc, pos lspPosition, newName string) (interface{}, error) {
+	ix, name, ok := s.target(doc, pos)
+	if !ok {
+		return nil, &lspError{Code: lspRequestFailed, Message: "no production name here"}
+	}
+	if _, defined := ix.defs[name]; !defined {
+		return nil, &lspError{Code: lspRequestFailed, Message: "no production defines " + name}
+	}
+	if newName == "" || newName[0] < 'A' || newName[0] > 'z' || (newName[0] > 'Z' && newName[0] < 'a') {
+		return nil, &lspError{Code: lspInvalidParams, Message: "a production name starts with a letter"}
+	}
+	for i := 0; i < len(newName); i++ {
+		if !isNameByte(newName[i]) {
+			return nil, &lspError{Code: lspInvalidParams, Message: "a production name has only letters, digits and '_'"}
+		}
+	}
+	if _, taken := ix.defs[newName]; taken {
+		return nil, &lspError{Code: lspRequestFailed, Message: "a production " + newName + " already exists"}
+	}
+	for _, d := range s.docs {
+		if ix.files[d.path] != nil && !d.current {
+			return nil, &lspError{Code: lspRequestFailed, Message: filepath.Base(d.path) + " does not compile; fix it before renaming"}
+		}
+	}
+	changes := map[string][]lspTextEdit{}
+	for _, span := range append([]lspSpan{ix.defs[name]}, ix.refs[name]...) {
+		loc := ix.location(span)
+		changes[loc.URI] = append(changes[loc.URI], lspTextEdit{Range: loc.Range, NewText: newName})
+	}
+	return map[string]interface{}{"changes": changes}, nil
+}
+
+// lspCommands are the :commands a grammar can use, for completion.
+var lspCommands = []struct{ name, doc string }{
+	{"startRule", "The production the parser starts with."},
+	{"startScript", "The script the compiler runs first (usually compiles c.asg)."},
+	{"whitespace", "The whitespace skipped before the following tokens and numbers; empty turns it off."},
+	{"include", "Adds the productions of another .abnf file (relative to this one)."},
+	{"script", "A script that runs instead of a parser rule and may emit rules for the text ahead."},
+	{"title", "The title of the grammar."},
+	{"description", "The description of the grammar."},
+	{"extensions", "The file extensions of the programs the grammar is for, e.g. \".py .pyw\" (mec run)."},
+	{"shebangs", "The #! interpreter names of the programs the grammar is for, e.g. \"python3\" (mec run)."},
+	{"number", "Reads size bytes as a number of the given type (inline only)."},
+	{"symbol", "Makes a production an outline symbol of a kind for mec -lsp <grammar>, optionally named by a production inside it."},
+	{"highlight", "Highlights the productions as a semantic token type for mec -lsp <grammar>."},
+	{"done", "Ends the parse successfully here."},
+}
+
+// completion offers the :commands after a colon, the production names
+// elsewhere.
+func (s *lspServer) completion(doc *lspDoc, pos lspPosition) interface{} {
+	t := newLSPText(doc.text)
+	off := t.offset(pos)
+	start := off
+	for start > 0 && isNameByte(doc.text[start-1]) {
+		start--
+	}
+	items := []map[string]interface{}{}
+	if start > 0 && doc.text[start-1] == ':' {
+		for _, c := range lspCommands {
+			items = append(items, map[string]interface{}{"label": c.name, "kind": 14, "detail": ":" + c.name + "()", "documentation": c.doc, "insertText": c.name + "("})
+		}
+		return items
+	}
+	ix := s.indexOf(doc)
+	if ix == nil {
+		return items
+	}
+	names := make([]string, 0, len(ix.defs))
+	for name := range ix.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		item := map[string]interface{}{"label": name, "kind": 3}
+		if def := ix.defs[name]; def.path != doc.path {
+			item["detail"] = filepath.Base(def.path)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// symbols lists the productions a document defines.
+func (s *lspServer) symbols(doc *lspDoc) interface{} {
+	syms := []map[string]interface{}{}
+	ix := s.indexOf(doc)
+	if ix == nil || ix.files[doc.path] == nil {
+		return syms
+	}
+	t := ix.files[doc.path]
+	for _, name := range ix.order[doc.path] {
+		def := ix.defs[name]
+		end := ix.ends[doc.path][name]
+		if semi := strings.IndexByte(t.text[end:], ';'); semi >= 0 {
+			end += semi + 1
+		}
+		syms = append(syms, map[string]interface{}{
+			"name":           name,
+			"kind":           12, // Function: a production is a parse function.
+			"range":          lspRange{t.position(def.start), t.position(end)},
+			"selectionRange": lspRange{t.position(def.start), t.position(def.end)},
+		})
+	}
+	return syms
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"14.gy/mec/abnf"
+)
+
+// lspTestSession is the client side of a session: the framed messages it
+// sends, and what the server answered to them.
+type lspTestSession struct {
+	eng     *abnf.Engine
+	in      bytes.Buffer
+	nextID  int
+	results map[int]json.RawMessage
+	errors  map[int]*lspError
+	notes   []lspTestNote
+}
+
+// lspTestNote is a notification of the server.
+type lspTestNote struct {
+	Method string
+	Params json.RawMessage
+}
+
+func newLSPTestSession() *lspTestSession {
+	eng := abnf.NewEngine()
+	eng.CatchExit = true
+	return &lspTestSession{eng: eng}
+}
+
+func (c *lspTestSession) send(msg map[string]interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(&c.in, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// request sends a request and returns its id.
+func (c *lspTestSession) request(method string, params interface{}) int {
+	c.nextID++
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	return c.nextID
+}
+
+func (c *lspTestSession) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// run ends the session with shutdown and exit, serves it (for lang, if not
+// nil) and reads the server's messages.
+func (c *lspTestSession) run(t *testing.T, lang *lspLanguage) {
+	t.Helper()
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+	var out bytes.Buffer
+	srv := newLSPServer(&c.in, &out, c.eng)
+	srv.lang = lang
+	if code := srv.serve(); code != 0 {
+		t.Fatalf("the server exited with %d after shutdown and exit", code)
+	}
+	c.results, c.errors = map[int]json.RawMessage{}, map[int]*lspError{}
+	framed := bufio.NewReader(&out)
+	for {
+		data, err := readFramed(framed)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *lspError       `json:"error"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("%v: %s", err, data)
+		}
+		switch {
+		case msg.ID == nil:
+			c.notes = append(c.notes, lspTestNote{msg.Method, msg.Params})
+		case msg.Error != nil:
+			c.errors[*msg.ID] = msg.Error
+		default:
+			c.results[*msg.ID] = msg.Result
+		}
+	}
+}
+
+// result decodes the answer to request id into v.
+func (c *lspTestSession) result(t *testing.T, id int, v interface{}) {
+	t.Helper()
+	if e := c.errors[id]; e != nil {
+		t.Fatalf("request %d failed: %s", id, e.Message)
+	}
+	if err := json.Unmarshal(c.results[id], v); err != nil {
+		t.Fatalf("request %d: %v: %s", id, err, c.results[id])
+	}
+}
+
+// diagnostics returns the last diagnostics published for uri.
+func (c *lspTestSession) diagnostics(t *testing.T, uri string) []map[string]interface{} {
+	t.Helper()
+	var diags []map[string]interface{}
+	found := false
+	for _, n := range c.notes {
+		var p struct {
+			URI         string                   `json:"uri"`
+			Diagnostics []map[string]interface{} `json:"diagnostics"`
+		}
+		if n.Method != "textDocument/publishDiagnostics" || json.Unmarshal(n.Params, &p) != nil || p.URI != uri {
+			continue
+		}
+		diags, found = p.Diagnostics, true
+	}
+	if !found {
+		t.Fatalf("no diagnostics published for %s", uri)
+	}
+	return diags
+}
+
+func lspAt(uri string, line, char int) map[string]interface{} {
+	return map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}, "position": lspPosition{line, char}}
+}
+
+func lspRng(line, from, to int) lspRange {
+	return lspRange{lspPosition{line, from}, lspPosition{line, to}}
+}
+
+// TestLSPGrammarSession runs a session on a grammar file: a clean analysis,
+// then definition, references and rename of a production.
+func TestLSPGrammarSession(t *testing.T) {
+	uri := pathURI(filepath.Join(t.TempDir(), "list.abnf"))
+	c := newLSPTestSession()
+	initID := c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.notify("initialized", map[string]interface{}{})
+	c.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+		"uri": uri, "languageId": "abnf", "version": 1,
+		"text": ":startRule(List) ;\n" +
+			"List = Item { \",\" Item } ;\n" +
+			"Item = Name | Number ;\n" +
+			"Name = \"a\" ;\n" +
+			"Number = \"1\" ;\n",
+	}})
+	defID := c.request("textDocument/definition", lspAt(uri, 1, 8))
+	refsAt := lspAt(uri, 1, 20)
+	refsAt["context"] = map[string]interface{}{"includeDeclaration": true}
+	refsID := c.request("textDocument/references", refsAt)
+	renameAt := lspAt(uri, 2, 1)
+	renameAt["newName"] = "Entry"
+	renameID := c.request("textDocument/rename", renameAt)
+	badAt := lspAt(uri, 2, 1)
+	badAt["newName"] = "Name"
+	badID := c.request("textDocument/rename", badAt)
+	c.run(t, nil)
+
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	c.result(t, initID, &init)
+	for _, cap := range []string{"definitionProvider", "referencesProvider", "renameProvider"} {
+		if init.Capabilities[cap] != true {
+			t.Errorf("initialize: %s is %v", cap, init.Capabilities[cap])
+		}
+	}
+	if diags := c.diagnostics(t, uri); len(diags) != 0 {
+		t.Errorf("diagnostics of a clean grammar: %v", diags)
+	}
+
+	var def lspLocation
+	c.result(t, defID, &def)
+	if want := (lspLocation{uri, lspRng(2, 0, 4)}); def != want {
+		t.Errorf("definition: %+v, want %+v", def, want)
+	}
+
+	var refs []lspLocation
+	c.result(t, refsID, &refs)
+	wantRefs := []lspLocation{{uri, lspRng(2, 0, 4)}, {uri, lspRng(1, 7, 11)}, {uri, lspRng(1, 18, 22)}}
+	if !reflect.DeepEqual(refs, wantRefs) {
+		t.Errorf("references:\n got %+v\nwant %+v", refs, wantRefs)
+	}
+
+	var edit struct {
+		Changes map[string][]lspTextEdit `json:"changes"`
+	}
+	c.result(t, renameID, &edit)
+	wantEdit := map[string][]lspTextEdit{uri: {
+		{lspRng(2, 0, 4), "Entry"}, {lspRng(1, 7, 11), "Entry"}, {lspRng(1, 18, 22), "Entry"},
+	}}
+	if !reflect.DeepEqual(edit.Changes, wantEdit) {
+		t.Errorf("rename:\n got %+v\nwant %+v", edit.Changes, wantEdit)
+	}
+	if e := c.errors[badID]; e == nil || e.Message != "a production Name already exists" {
+		t.Errorf("rename onto an existing production: %+v", e)
+	}
+}
+
+// TestLSPSemanticTokens checks the delta encoding of the highlight tokens:
+// the line relative to the last token, the character relative to it on the
+// same line only.
+func TestLSPSemanticTokens(t *testing.T) {
+	dir := t.TempDir()
+	grammar := filepath.Join(dir, "fun.abnf")
+	src := ":startRule(Prog) ;\n" +
+		":highlight(Keyword, \"keyword\") ;\n" +
+		":highlight(Number, \"number\") ;\n" +
+		"Prog = { Fun } ;\n" +
+		"Fun = Keyword Name \"{\" { Number } \"}\" ;\n" +
+		"Keyword = \"fun\" ;\n" +
+		"Name = \"main\" | \"helper\" ;\n" +
+		"Number = \"1\" | \"42\" ;\n"
+	if err := os.WriteFile(grammar, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newLSPTestSession()
+	lang, err := loadLSPLanguage(c.eng, grammar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := pathURI(filepath.Join(dir, "prog.fun"))
+	initID := c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+		"uri": uri, "languageId": "fun", "version": 1,
+		"text": "fun main {\n  1 42\n}\nfun helper { 1 }\n",
+	}})
+	tokID := c.request("textDocument/semanticTokens/full", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}})
+	c.run(t, lang)
+
+	var init struct {
+		Capabilities struct {
+			SemanticTokensProvider struct {
+				Legend struct {
+					TokenTypes []string `json:"tokenTypes"`
+				} `json:"legend"`
+			} `json:"semanticTokensProvider"`
+		} `json:"capabilities"`
+	}
+	c.result(t, initID, &init)
+	if types := init.Capabilities.SemanticTokensProvider.Legend.TokenTypes; !reflect.DeepEqual(types, []string{"keyword", "number"}) {
+		t.Fatalf("legend %v", types)
+	}
+	var toks struct {
+		Data []int `json:"data"`
+	}
+	c.result(t, tokID, &toks)
+	want := []int{
+		0, 0, 3, 0, 0, // fun
+		1, 2, 1, 1, 0, // 1
+		0, 2, 2, 1, 0, // 42, on the same line
+		2, 0, 3, 0, 0, // fun, two lines on
+		0, 13, 1, 1, 0, // 1
+	}
+	if !reflect.DeepEqual(toks.Data, want) {
+		t.Errorf("semantic tokens:\n got %v\nwant %v", toks.Data, want)
+	}
+}
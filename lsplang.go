@@ -0,0 +1,307 @@
+package main
+
+// mec -lsp <grammar>: the language server of the language a grammar defines.
+//
+// Every file the editor opens is parsed with the grammar on each edit, the way
+// the second stage of a run parses a program, and the parse is asked for its
+// spans (abnf/spans.go). From them the server answers
+//
+//	diagnostics      the structured parse error: where the parse got stuck
+//	documentSymbol   the outline: the matches of the :symbol() productions,
+//	                 nested the way they nest in the text
+//	foldingRange     every Tag of the ASG and every symbol that spans lines,
+//	                 and the multi-line comments
+//	semanticTokens   the matches of the :highlight() productions, the inner
+//	                 of two nested ones winning
+//
+// A grammar without annotations still gets diagnostics and folding. The
+// grammar is compiled once, when the server starts; restart it after editing
+// the grammar.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"14.gy/mec/abnf"
+	"14.gy/mec/abnf/r"
+)
+
+// lspLanguage is the language mec -lsp <grammar> serves.
+type lspLanguage struct {
+	path    string
+	grammar *r.Rules
+	symbols map[string]abnf.SymbolAnnotation // By production.
+	types   []string                         // The semantic token legend: the types the grammar highlights with.
+	typeOf  map[string]int                   // Production -> its index in types.
+}
+
+// loadLSPLanguage compiles the grammar of the language to serve, with its
+// :include() fragments.
+func loadLSPLanguage(eng *abnf.Engine, path string) (*lspLanguage, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sess := eng.NewSession(nil, nil)
+	opts := &abnf.Parseropts{PreventDefaultOutput: true}
+	grammar, err := sess.CompileGrammar(abnf.StripBOM(string(dat)), path, 0, opts, true)
+	if err == nil && grammar == nil {
+		err = fmt.Errorf("%s did not compile to an a-grammar", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.GetStartRule(grammar) == nil {
+		return nil, fmt.Errorf("%s has no :startRule(): there is nothing to parse a file with", path)
+	}
+	if err := sess.AssembleIncludes(grammar, path, opts); err != nil {
+		return nil, err
+	}
+	an, err := abnf.GrammarAnnotations(grammar)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	lang := &lspLanguage{path: path, grammar: grammar, symbols: map[string]abnf.SymbolAnnotation{}, typeOf: map[string]int{}}
+	for _, sym := range an.Symbols {
+		if _, dup := lang.symbols[sym.Production]; !dup {
+			lang.symbols[sym.Production] = sym
+		}
+	}
+	index := map[string]int{}
+	for _, typ := range an.Highlights {
+		index[typ] = 0
+	}
+	for typ := range index {
+		lang.types = append(lang.types, typ)
+	}
+	sort.Strings(lang.types)
+	for i, typ := range lang.types {
+		index[typ] = i
+	}
+	for prod, typ := range an.Highlights {
+		lang.typeOf[prod] = index[typ]
+	}
+	return lang, nil
+}
+
+// capabilities are what the server offers for the language.
+func (lang *lspLanguage) capabilities() map[string]interface{} {
+	caps := map[string]interface{}{
+		"textDocumentSync":     map[string]interface{}{"openClose": true, "change": 1}, // 1: the whole text on every change.
+		"foldingRangeProvider": true,
+	}
+	if len(lang.symbols) > 0 {
+		caps["documentSymbolProvider"] = true
+	}
+	if len(lang.types) > 0 {
+		caps["semanticTokensProvider"] = map[string]interface{}{
+			"legend": map[string]interface{}{"tokenTypes": lang.types, "tokenModifiers": []string{}},
+			"full":   true,
+		}
+	}
+	return caps
+}
+
+// analyzeProgram parses a document with the language's grammar, keeps its
+// spans and publishes its parse error, if any. A failed parse keeps the spans
+// of the part it got through.
+func (s *lspServer) analyzeProgram(doc *lspDoc) {
+	sess := s.eng.NewSession(nil, nil)
+	var spans []abnf.ParseSpan
+	_, err := sess.Parse(s.lang.grammar, doc.text, doc.path, &abnf.Parseropts{PreventDefaultOutput: true, Spans: &spans})
+	doc.spans = spans
+	diags := map[string][]interface{}{doc.path: {}}
+	if err != nil {
+		d := abnf.ErrorDiagnostic(err, doc.path)
+		if d.File != doc.path {
+			d.File, d.Line, d.Column = doc.path, 0, 0 // About the grammar, not the text: shown on the first line.
+		}
+		diags[doc.path] = append(diags[doc.path], lspDiagnostic(newLSPText(doc.text), d))
+	}
+	s.publish(doc.uri, diags)
+}
+
+// programSymbols is the outline of a document: its symbol spans, each under
+// the innermost one around it.
+func (s *lspServer) programSymbols(doc *lspDoc) interface{} {
+	t := newLSPText(doc.text)
+	type node struct {
+		span abnf.ParseSpan
+		sym  map[string]interface{}
+		kids []interface{}
+	}
+	var roots []interface{}
+	var stack []*node
+	closeTop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.kids != nil {
+			top.sym["children"] = top.kids
+		}
+	}
+	for i, span := range doc.spans {
+		ann, ok := s.lang.symbols[span.Production]
+		if !ok {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].span.End <= span.Start {
+			closeTop()
+		}
+		name, sel := symbolName(t, doc.spans, i, ann.Name)
+		n := &node{span: span, sym: map[string]interface{}{
+			"name":           name,
+			"kind":           symbolKind(ann.Kind),
+			"range":          lspRange{t.position(span.Start), t.position(span.End)},
+			"selectionRange": lspRange{t.position(sel.Start), t.position(sel.End)},
+		}}
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			parent.kids = append(parent.kids, n.sym)
+		} else {
+			roots = append(roots, n.sym)
+		}
+		stack = append(stack, n)
+	}
+	for len(stack) > 0 {
+		closeTop()
+	}
+	if roots == nil {
+		return []interface{}{}
+	}
+	return roots
+}
+
+// symbolName names the symbol of spans[at]: by the first match of the name
+// production inside it, else by its first line. The span is what the editor
+// selects for the symbol.
+func symbolName(t *lspText, spans []abnf.ParseSpan, at int, nameProd string) (string, abnf.ParseSpan) {
+	sym := spans[at]
+	if nameProd != "" {
+		for _, span := range spans[at+1:] {
+			if span.Start >= sym.End {
+				break
+			}
+			if span.Production == nameProd && span.End <= sym.End {
+				return t.text[span.Start:span.End], span
+			}
+		}
+	}
+	end := t.lineEnd(sym.Start)
+	if end > sym.End {
+		end = sym.End
+	}
+	name := strings.TrimSpace(t.text[sym.Start:end])
+	const maxName = 60
+	if utf8.RuneCountInString(name) > maxName {
+		name = string([]rune(name)[:maxName]) + "..."
+	}
+	if name == "" {
+		name = sym.Production
+	}
+	return name, abnf.ParseSpan{Production: sym.Production, Start: sym.Start, End: end}
+}
+
+// symbolKind is the LSP SymbolKind of a :symbol() kind.
+func symbolKind(kind string) int {
+	for i, k := range abnf.SymbolKinds {
+		if k == kind {
+			return i + 1
+		}
+	}
+	return 13 // Variable.
+}
+
+// foldingRanges folds every Tag, symbol and comment that spans lines. Of the
+// ranges that start on the same line the longest is kept. A range whose last
+// line holds nothing but its closing char ("}") leaves that line visible.
+func (s *lspServer) foldingRanges(doc *lspDoc) interface{} {
+	t := newLSPText(doc.text)
+	ends := map[int]int{}
+	kinds := map[int]string{}
+	for _, span := range doc.spans {
+		_, sym := s.lang.symbols[span.Production]
+		typ, hl := s.lang.typeOf[span.Production]
+		comment := hl && s.lang.types[typ] == "comment"
+		if span.Production != "" && !sym && !comment {
+			continue
+		}
+		from, to := t.position(span.Start).Line, t.position(span.End-1).Line
+		lineStart := t.starts[to]
+		if last := strings.TrimSpace(t.text[lineStart:span.End]); utf8.RuneCountInString(last) <= 1 && !comment {
+			to--
+		}
+		if to <= from || to <= ends[from] {
+			continue
+		}
+		ends[from] = to
+		kinds[from] = ""
+		if comment {
+			kinds[from] = "comment"
+		}
+	}
+	lines := make([]int, 0, len(ends))
+	for from := range ends {
+		lines = append(lines, from)
+	}
+	sort.Ints(lines)
+	ranges := []map[string]interface{}{}
+	for _, from := range lines {
+		fr := map[string]interface{}{"startLine": from, "endLine": ends[from]}
+		if kinds[from] != "" {
+			fr["kind"] = kinds[from]
+		}
+		ranges = append(ranges, fr)
+	}
+	return ranges
+}
+
+// semanticTokens encodes the highlight spans of a document the way the
+// protocol wants them: five ints per token, each position relative to the
+// token before, no token across a line end. The spans are painted onto the
+// text outer first, so the inner of two nested spans wins.
+func (s *lspServer) semanticTokens(doc *lspDoc) interface{} {
+	text := doc.text
+	paint := make([]int8, len(text)) // 0: no token, else the type index + 1.
+	for _, span := range doc.spans {
+		typ, ok := s.lang.typeOf[span.Production]
+		if !ok {
+			continue
+		}
+		for i := span.Start; i < span.End && i < len(text); i++ {
+			paint[i] = int8(typ + 1)
+		}
+	}
+	data := []int{}
+	line, char := 0, 0         // Where the scan is, in protocol positions.
+	prevLine, prevChar := 0, 0 // Where the last token started.
+	for i := 0; i < len(text); {
+		c, size := utf8.DecodeRuneInString(text[i:])
+		if c == '\n' {
+			line, char = line+1, 0
+			i += size
+			continue
+		}
+		if paint[i] == 0 || c == '\r' {
+			char += utf16Len(string(c))
+			i += size
+			continue
+		}
+		typ, startChar, length := paint[i], char, 0
+		for i < len(text) && paint[i] == typ && text[i] != '\n' && text[i] != '\r' {
+			c, size := utf8.DecodeRuneInString(text[i:])
+			length += utf16Len(string(c))
+			i += size
+		}
+		char += length
+		deltaChar := startChar
+		if line == prevLine {
+			deltaChar = startChar - prevChar
+		}
+		data = append(data, line-prevLine, deltaChar, length, int(typ-1), 0)
+		prevLine, prevChar = line, startChar
+	}
+	return map[string]interface{}{"data": data}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestLSPLanguageSession serves a tiny language: the parse error of a broken
+// file, cleared once an edit fixes it, and the outline and folding ranges of a
+// valid one.
+func TestLSPLanguageSession(t *testing.T) {
+	dir := t.TempDir()
+	grammar := filepath.Join(dir, "fun.abnf")
+	src := ":startRule(Prog) ;\n" +
+		":symbol(Fun, \"function\", Name) ;\n" +
+		"Prog = { Fun } ;\n" +
+		"Fun = \"fun\" Name \"{\" { Number } \"}\" ;\n" +
+		"Name = \"main\" | \"helper\" ;\n" +
+		"Number = \"1\" | \"42\" ;\n"
+	if err := os.WriteFile(grammar, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newLSPTestSession()
+	lang, err := loadLSPLanguage(c.eng, grammar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := func(uri, text string) {
+		c.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+			"uri": uri, "languageId": "fun", "version": 1, "text": text,
+		}})
+	}
+	doc := func(uri string) map[string]interface{} {
+		return map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}}
+	}
+	bad, fixed, good := pathURI(filepath.Join(dir, "bad.fun")), pathURI(filepath.Join(dir, "fixed.fun")), pathURI(filepath.Join(dir, "good.fun"))
+
+	initID := c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	open(bad, "fun main {\n  1x\n}\n")
+	open(fixed, "fun main {\n  1 x\n}\n")
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": fixed, "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": "fun main {\n  1\n}\n"}},
+	})
+	open(good, "fun main {\n  1\n  42\n}\nfun helper { 1 }\n")
+	symID := c.request("textDocument/documentSymbol", doc(good))
+	foldID := c.request("textDocument/foldingRange", doc(good))
+	c.run(t, lang)
+
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	c.result(t, initID, &init)
+	if init.Capabilities["documentSymbolProvider"] != true || init.Capabilities["foldingRangeProvider"] != true {
+		t.Errorf("initialize: %v", init.Capabilities)
+	}
+
+	diags := c.diagnostics(t, bad)
+	if len(diags) != 1 {
+		t.Fatalf("diagnostics of bad.fun: %v", diags)
+	}
+	var rng lspRange
+	data, _ := json.Marshal(diags[0]["range"])
+	if err := json.Unmarshal(data, &rng); err != nil {
+		t.Fatal(err)
+	}
+	if rng != lspRng(1, 3, 4) || diags[0]["code"] != "parse-error" || diags[0]["severity"] != 1.0 {
+		t.Errorf("the parse error is at %+v: %v, want the x of line 1", rng, diags[0])
+	}
+	if diags := c.diagnostics(t, fixed); len(diags) != 0 {
+		t.Errorf("diagnostics after the edit fixed the file: %v", diags)
+	}
+	if diags := c.diagnostics(t, good); len(diags) != 0 {
+		t.Errorf("diagnostics of good.fun: %v", diags)
+	}
+
+	type symbol struct {
+		Name           string   `json:"name"`
+		Kind           int      `json:"kind"`
+		Range          lspRange `json:"range"`
+		SelectionRange lspRange `json:"selectionRange"`
+	}
+	var syms []symbol
+	c.result(t, symID, &syms)
+	wantSyms := []symbol{
+		{"main", 12, lspRange{lspPosition{0, 0}, lspPosition{3, 1}}, lspRng(0, 4, 8)},
+		{"helper", 12, lspRng(4, 0, 16), lspRng(4, 4, 10)},
+	}
+	if !reflect.DeepEqual(syms, wantSyms) {
+		t.Errorf("documentSymbol:\n got %+v\nwant %+v", syms, wantSyms)
+	}
+
+	// The closing brace stays visible; the one-line function does not fold.
+	var folds []map[string]interface{}
+	c.result(t, foldID, &folds)
+	if want := []map[string]interface{}{{"startLine": 0.0, "endLine": 2.0}}; !reflect.DeepEqual(folds, want) {
+		t.Errorf("foldingRange: %v, want %v", folds, want)
+	}
+}
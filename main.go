@@ -6,6 +6,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"runtime/debug"
 	"strconv"
 	"strings"
@@ -28,7 +30,13 @@ import (
 // takes no input), its startScript is run; that lets the last file be a
 // startScript-only grammar (e.g. one that builds and runs a module by hand).
 //
-// Flags may appear anywhere among the files:
+// The subcommands run, interp, compile and build put the grammar of a program's language
+// in front of it themselves (languages.go): ./mec run prog.py.
+//
+// Flags may appear anywhere among the files. Everything after -- is the program's
+// own command line (c.args):
+//
+//	./mec languages/python-to-llvm-ir.abnf prog.py -- in.txt -n 3
 //
 //  -v, -vN       verbose for all stages / stage N (ASG + compiled result)
 //  -vv, -vvN     parser+compiler trace for all stages / stage N
@@ -36,9 +44,29 @@ import (
 //  -q, -qq       quiet (program output + errors / errors only)
 //  -error MODE   parse-failure dump detail: short (default; structure + tokens), code (also
 //                each tag's code), short-all / code-all (the whole tree, no [...] abridging)
+//  -diagnostics FMT  report parse failures, -verify issues, -warn-imports / -warn-unsupported
+//                warnings and compile / runtime failures as structured records instead of
+//                text: json (one object per line) or sarif (a SARIF 2.1.0 log, for code scanning)
+//  -diagnostics-out F  write the -diagnostics records to F instead of stderr
 //  -frozen       run the annotation scripts goja-free (see abnf/frozen.go)
 //  -verify       lint the first file's grammar and exit
 //  -pretty       print the first file's serialized a-grammar and exit
+//  -fmt          print the grammar files (stdin without one) in the canonical layout: aligned
+//                names, one alternative per line in a long production, comments kept; -w
+//                rewrites the files instead. A grammar is left alone unless the formatted
+//                text compiles to the same a-grammar
+//  -export FMT   write the first file's a-grammar (with its :include()s) in another
+//                format and exit: antlr (.g4), ebnf (W3C), tree-sitter (grammar.js) or
+//                railroad (one SVG diagram per production, into the -o directory)
+//  -o PATH       the output file (directory for -export railroad); default stdout
+//  -import FMT   the first file is a grammar in another notation, imported instead of
+//                compiled: rfc5234 (IETF ABNF), antlr (.g4) or pegjs (PEG.js/Peggy).
+//                Alone, it writes the result as annotated EBNF to -o (default stdout)
+//                and exits; with further files, they are parsed by the imported grammar
+//  -pack         bundle the first file's language (compiled a-grammar, :include()s, script
+//                libraries, runtime .ll files, -frozen scripts) into the -o file and exit.
+//                Further files are added to the pack. A first file ending in .mecpack is
+//                such a pack, run in place of the grammar: mec python.mecpack prog.py
 //  -i DIR        add an include root for project-file imports (repeatable; an import
 //                like 'a.b.C' is searched as a/b/C.<ext> under the program's own
 //                directory first, then under each -i root in order)
@@ -61,21 +89,83 @@ import (
 //  -code SRC     take the final program's source from SRC (inline) instead of a file,
 //                e.g. languages/calculator-global-stack-interpreter.abnf -code '9*(2+3)'
 //  -code-stdin   take the final program's source from stdin instead of a file
+//  -stdin        pass mec's stdin through to the program: what it reads (input(),
+//                readLine(), getchar() ...) comes from there. Without it a program
+//                reads an empty input
+//  -- ARGS       the rest of the command line is the program's arguments (sys.argv,
+//                os.Args, String[] args, argv ...; c.args to a grammar)
 //  -pipe         start a new pipeline segment: the text a language prints becomes the
 //                program input of the next segment, so one language (e.g. a preprocessor)
 //                can transform the source another language then consumes, e.g.
 //                c-preprocessor.abnf prog.c -pipe c-to-llvm-ir.abnf
+//                A value a script emit()s (an ASG, an a-grammar, a JSON-like object) is handed on
+//                too, as c.input of the next segment's scripts
+//  -batch        run every file after the grammar through it as a program of its own, in
+//                parallel: the grammar is compiled once, each file's output is printed in
+//                order, and a summary lists the files that failed and why. The files share
+//                one -trace stream and one -callgraph file
+//  -j N          the number of -batch workers (default: the number of CPUs)
+//  -watch        keep running: rerun the pipeline whenever the grammar, a fragment or script
+//                library it includes, an imported project file or the program changes
+//  -repl         load the program (optional), then read statements from stdin and run
+//                each in its scope, printing the value of an expression; a statement
+//                that is not finished at the end of a line continues on the next
+//  -lsp          serve the Language Server Protocol on stdin/stdout for .abnf grammar
+//                files: diagnostics, definitions, references, hover, symbols, rename and
+//                completion (editor/vscode-abnf starts it); -lsp G serves the language of
+//                grammar G instead: parse errors, an outline from its :symbol() productions,
+//                folding and :highlight() highlighting for every file the editor opens
+//  -serve ADDR   serve the web playground on ADDR (e.g. :8777): pick a grammar of the
+//                search path, type a program and see its output, ASG, IR, control flow and
+//                call graphs; POST /run {grammar, code, flags} is the same as a JSON API
+//  -debug        stop the compile walk at the first tag (or at the -break points) and read
+//                commands from stdin: step into, over and out of the walk, show up, ltr,
+//                the local and global stacks, the matched text and the path of enclosing
+//                tags, run code in the tag's scope (help lists the commands); -debug=dap
+//                serves the Debug Adapter Protocol on stdin/stdout instead (editor/vscode-abnf)
+//  -pdebug       stop the program llvm.RunJS runs at its first statement (or at the -break
+//                points) and read commands from stdin: step statement by statement, into,
+//                over and out of calls, show the call stack and the variables of every
+//                call; -pdebug=dap serves the Debug Adapter Protocol instead
+//  -break SPEC   a -debug breakpoint (repeatable): a production name, GRAMMAR:LINE (the
+//                tags written on that line), FILE:LINE[:COL] or @LINE[:COL] (the nodes whose
+//                match ends there in the program); under -pdebug a function name,
+//                FILE:LINE[:COL] or @LINE[:COL] of the program
+//  -project F    read the project manifest F (JSON: named targets, each a grammar chain,
+//                sources, -i roots, -rt/-L/-l link inputs, -main, -exe and output files);
+//                without it, mec.json in the working directory is used when no file is
+//                given. Flags on the command line override the manifest's values;
+//                -frozen=false, -warn-imports=false and -warn-unsupported=false switch off
+//                what the manifest switches on
+//  -target NAME  the manifest target to run (default: its "default", or its only target)
 //  -cfgraph F    write the control flow graph of every executed module to file F (DOT; .mmd = Mermaid)
+//  -ir F         write the LLVM IR of every executed module to file F (the second to F-2, ...)
+//  -asg F        write the ASG of the final program's parse to file F (JSON, see abnf/r/marshal.go)
 //  -trace F      stream runtime events to file F as JSON lines; also the -render input
 //  -callgraph F  write the static call graph to file F, overwriting it (.jsonl feeds -render static)
 //  -callgraph-append F  like -callgraph but keeps F and adds to it, to accumulate a graph across many runs
+//  -grammar-coverage F  count which productions, alternatives, options and tags of the
+//                grammars the run's parses matched, and add the counts to file F (JSON
+//                lines, accumulates across runs like -callgraph-append)
 //  -render K     standalone (no pipeline): read the JSON-lines file named by -trace F
 //                and write graph K to stdout as Graphviz DOT, then exit. K = calls | vars
-//                (from a -trace run) or static (from a -callgraph run)
+//                (from a -trace run) or static (from a -callgraph run); K = coverage |
+//                coverage-html reads -grammar-coverage F and writes the annotated grammar
+//                source as text or HTML instead
 //  -freeze F     (re)create the frozen bootstrap snapshot from grammar file F, then exit
 //  -lb, -lf      parser block-list / found-list (debugging aids)
+//  -ambiguity    diagnostic parse: at every Or that matched, also try the later alternatives
+//                and report (stderr) where one of them matches with a different length
 //  -max-steps N  raise the IR interpreter's endless-loop brake: how many instructions ONE
 //                top-level call may run (default 100000000, 0 = no limit)
+//  -sandbox      run untrusted grammars and programs: files only below the directories of
+//                the files given, the -i roots and -sandbox-dir, no exit() of mec itself (the
+//                run ends with the exit code instead), env.get() empty, no clang (no -exe), and
+//                a time and memory limit for the scripts and programs. The -sandbox-* flags
+//                imply it
+//  -sandbox-dir DIR  also allow the files below DIR (repeatable)
+//  -sandbox-timeout D  the run's wall-clock limit, a Go duration (default 30s, 0 = none)
+//  -sandbox-memory MB  the memory the scripts and programs may allocate (default 512, 0 = none)
 //  -speed N      speed test: warm up once, then time N parse+compile cycles of the first file
 
 // options is the parsed command line.
@@ -88,7 +178,7 @@ type options struct {
 	slotStage    map[int]int // Tag slot to compile a stage with (default 0).
 
 	quietMost, quietFull                  bool
-	frozen, verify, pretty                bool
+	frozen, verify, pretty, pack          bool
 	errorMode                             string   // -error short|code|short-all|code-all: parse-failure dump detail (default short).
 	warnImports                           bool     // -warn-imports: warn+skip unresolved imports instead of aborting.
 	importRoots                           []string // -i include roots for project-file imports, in order.
@@ -102,23 +192,77 @@ type options struct {
 	linkLibs                              []string // -l NAME: system libraries passed through to the -exe link.
 	code                                  string   // -code VALUE: the final program's source, given inline instead of as a file.
 	codeSet, codeStdin                    bool     // -code / -code-stdin were passed (codeStdin reads the source from stdin).
+	stdin                                 bool     // -stdin: mec's stdin becomes the program's (abnf.Engine.Stdin).
+	stdinText                             string   // What -stdin read.
+	progArgs                              []string // The arguments after --: the program's command line (abnf.Engine.Args).
 	speedTest, useBlockList, useFoundList bool
-	speedCount                            int   // Timed cycle count for -speed (>0 when set).
-	maxSteps                              int   // -max-steps N: the IR interpreter's per-call instruction budget (0 = no limit).
-	maxStepsSet                           bool  // -max-steps was passed; otherwise the built-in default stands.
-	pipeBounds                            []int // -pipe boundaries: file indices where a new pipeline segment starts.
+	ambiguity                             bool   // -ambiguity: report the Or alternatives that would also have matched.
+	speedCount                            int    // Timed cycle count for -speed (>0 when set).
+	maxSteps                              int    // -max-steps N: the IR interpreter's per-call instruction budget (0 = no limit).
+	maxStepsSet                           bool   // -max-steps was passed; otherwise the built-in default stands.
+	pipeBounds                            []int  // -pipe boundaries: file indices where a new pipeline segment starts.
+	batch                                 bool   // -batch: run every file after the grammar through it, in parallel (batch.go).
+	jobs                                  int    // -j N: the -batch worker count (default: the CPU count).
+	projectPath, target                   string // -project FILE / -target NAME: the manifest and the target of it to run (manifest.go).
+	watch                                 bool   // -watch: rerun the pipeline whenever one of its inputs changes (watch.go).
+	repl                                  bool   // -repl: read and run statements in the program's scope after it ran (repl.go).
+	lsp                                   bool   // -lsp: serve the Language Server Protocol on stdin/stdout (lsp.go).
+	serveAddr                             string // -serve ADDR: serve the web playground on ADDR (serve.go).
+	format, write                         bool   // -fmt / -w: write grammars in the canonical layout, back into their files (format.go).
+	debug, pdebug                         string // -debug / -pdebug: "lines" (commands on stdin) or "dap" (=dap); empty without it (debug.go).
+	diagnostics, diagnosticsOut           string // -diagnostics json|sarif / -diagnostics-out F: report findings as structured records, to F (default stderr).
+	// The -diagnostics reporter, opened by main (nil without the flag).
+	diag *abnf.DiagnosticReporter
+	// The -debug or -pdebug debugger and, under =dap, its server; made by main.
+	debugger  *abnf.Debugger
+	pdebugger *abnf.ProgramDebugger
+	dap       *dapServer
+	breaks    []string // -break SPEC: the breakpoints, in order.
 
 	freezePath, cfgPath, tracePath, callgraphPath, renderKind string
-	callgraphAppend                                           bool // -callgraph-append: add to the .jsonl instead of overwriting (accumulate across runs).
+	callgraphAppend                                           bool   // -callgraph-append: add to the .jsonl instead of overwriting (accumulate across runs).
+	coveragePath                                              string // -grammar-coverage F: the grammar coverage counts accumulate in F.
+	exportFormat, outPath                                     string // -export FMT / -o PATH: write the first file's a-grammar as FMT to PATH.
+	importFormat                                              string // -import FMT: the first file is a grammar in FMT, imported instead of compiled.
+	irPath                                                    string // -ir F: the IR of every executed module goes to F.
+	asgPath                                                   string // -asg F: the ASG of the final program goes to F.
+	// -sandbox, set by it or by any -sandbox-* flag: the run goes under an abnf.Sandbox.
+	sandbox         bool
+	sandboxDirs     []string      // -sandbox-dir DIR: more directories the sandbox allows, in order.
+	sandboxTimeout  time.Duration // -sandbox-timeout D: the sandboxed run's wall-clock limit.
+	sandboxMemoryMB int64         // -sandbox-memory MB: the sandboxed run's memory limit.
+}
+
+// parseArgs parses the command line, behind the arguments of the project
+// manifest it names (manifest.go), if any: the command line is parsed last, so
+// its flags override the manifest's.
+func parseArgs(args []string) (*options, error) {
+	cli, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	margs, err := manifestArgs(cli)
+	if err != nil {
+		return nil, &manifestError{err}
+	}
+	if margs == nil {
+		return cli, nil
+	}
+	return parseFlags(append(margs, args...))
 }
 
-// parseArgs classifies the command line into files (positional) and flags
+// parseFlags classifies the arguments into files (positional) and flags
 // (anything starting with '-'), so the two may be freely interspersed - unlike
 // the standard flag package, which stops at the first positional argument.
-func parseArgs(args []string) (*options, error) {
-	o := &options{verboseStage: map[int]bool{}, traceStage: map[int]bool{}, slotStage: map[int]int{}}
+func parseFlags(args []string) (*options, error) {
+	o := &options{verboseStage: map[int]bool{}, traceStage: map[int]bool{}, slotStage: map[int]int{},
+		sandboxTimeout: 30 * time.Second, sandboxMemoryMB: 512}
 	for i := 0; i < len(args); i++ {
 		a := args[i]
+		if a == "--" {
+			o.progArgs = append(o.progArgs, args[i+1:]...)
+			break
+		}
 		if len(a) == 0 || a[0] != '-' || a == "-" {
 			o.files = append(o.files, a)
 			continue
@@ -139,28 +283,58 @@ func parseArgs(args []string) (*options, error) {
 			i++
 			return args[i], nil
 		}
+		// boolVal returns the value of a boolean flag that a project manifest
+		// can set: true, or what "-flag=true|false" says, so the command line
+		// can switch it off again.
+		boolVal := func() (bool, error) {
+			if !hasVal {
+				return true, nil
+			}
+			b, perr := strconv.ParseBool(val)
+			if perr != nil {
+				return false, fmt.Errorf("flag %s takes no value or =true|=false, got %q", name, val)
+			}
+			return b, nil
+		}
 
 		var err error
 		switch name {
 		case "-q":
-			o.quietMost = true
+			// -q=false is not quiet at all, -qq=false back to -q: both undo
+			// the quiet of a manifest's target.
+			var q bool
+			if q, err = boolVal(); err == nil {
+				o.quietMost, o.quietFull = q, q && o.quietFull
+			}
 		case "-qq":
-			o.quietMost, o.quietFull = true, true
+			var q bool
+			if q, err = boolVal(); err == nil {
+				o.quietFull = q
+				o.quietMost = q || o.quietMost
+			}
 		case "-frozen":
-			o.frozen = true
+			o.frozen, err = boolVal()
 		case "-verify":
 			o.verify = true
 		case "-pretty":
 			o.pretty = true
+		case "-pack":
+			o.pack = true
+		case "-export":
+			o.exportFormat, err = takeVal()
+		case "-o":
+			o.outPath, err = takeVal()
+		case "-import":
+			o.importFormat, err = takeVal()
 		case "-i":
 			var dir string
 			if dir, err = takeVal(); err == nil {
 				o.importRoots = append(o.importRoots, dir)
 			}
 		case "-warn-imports":
-			o.warnImports = true
+			o.warnImports, err = boolVal()
 		case "-warn-unsupported":
-			o.warnUnsupported = true
+			o.warnUnsupported, err = boolVal()
 		case "-rt-prims":
 			o.rtPrims = true
 		case "-rt-lib":
@@ -189,9 +363,12 @@ func parseArgs(args []string) (*options, error) {
 			o.codeSet = true
 		case "-code-stdin":
 			o.codeStdin = true
+		case "-stdin":
+			o.stdin = true
 		case "-pipe":
 			// A pipeline segment boundary: the TEXT output of the segment so far
-			// becomes the program input of the next segment (see runPipeline).
+			// becomes the program input of the next segment, its emit()ted value
+			// the next segment's c.input (see runPipeline).
 			if len(o.files) == 0 {
 				return nil, fmt.Errorf("flag %s needs a preceding segment (grammar + program)", name)
 			}
@@ -205,6 +382,51 @@ func parseArgs(args []string) (*options, error) {
 				}
 				o.speedTest, o.speedCount = true, n
 			}
+		case "-project":
+			o.projectPath, err = takeVal()
+		case "-target":
+			o.target, err = takeVal()
+		case "-watch":
+			o.watch = true
+		case "-repl":
+			o.repl = true
+		case "-lsp":
+			o.lsp = true
+		case "-serve":
+			o.serveAddr, err = takeVal()
+		case "-debug", "-pdebug":
+			mode := "lines"
+			if hasVal {
+				if val != "lines" && val != "dap" {
+					return nil, fmt.Errorf("flag %s takes no value or =dap, got %q", name, val)
+				}
+				mode = val
+			}
+			if name == "-debug" {
+				o.debug = mode
+			} else {
+				o.pdebug = mode
+			}
+		case "-break":
+			var spec string
+			if spec, err = takeVal(); err == nil {
+				o.breaks = append(o.breaks, spec)
+			}
+		case "-fmt":
+			o.format = true
+		case "-w":
+			o.write = true
+		case "-batch":
+			o.batch = true
+		case "-j":
+			var v string
+			if v, err = takeVal(); err == nil {
+				n, serr := strconv.Atoi(v)
+				if serr != nil || n < 1 {
+					return nil, fmt.Errorf("flag %s needs a positive worker count, got %q", name, v)
+				}
+				o.jobs = n
+			}
 		case "-max-steps":
 			var v string
 			if v, err = takeVal(); err == nil {
@@ -214,10 +436,37 @@ func parseArgs(args []string) (*options, error) {
 				}
 				o.maxSteps, o.maxStepsSet = n, true
 			}
+		case "-sandbox":
+			o.sandbox, err = boolVal()
+		case "-sandbox-dir":
+			var dir string
+			if dir, err = takeVal(); err == nil {
+				o.sandbox, o.sandboxDirs = true, append(o.sandboxDirs, dir)
+			}
+		case "-sandbox-timeout":
+			var v string
+			if v, err = takeVal(); err == nil {
+				d, derr := time.ParseDuration(v)
+				if derr != nil || d < 0 {
+					return nil, fmt.Errorf("flag %s needs a non-negative duration like 10s (0 = none), got %q", name, v)
+				}
+				o.sandbox, o.sandboxTimeout = true, d
+			}
+		case "-sandbox-memory":
+			var v string
+			if v, err = takeVal(); err == nil {
+				n, serr := strconv.ParseInt(v, 10, 64)
+				if serr != nil || n < 0 {
+					return nil, fmt.Errorf("flag %s needs a non-negative size in MB (0 = none), got %q", name, v)
+				}
+				o.sandbox, o.sandboxMemoryMB = true, n
+			}
 		case "-lb":
 			o.useBlockList = true
 		case "-lf":
 			o.useFoundList = true
+		case "-ambiguity":
+			o.ambiguity = true
 		case "-v":
 			o.verboseAll = true
 		case "-error":
@@ -228,12 +477,26 @@ func parseArgs(args []string) (*options, error) {
 					return nil, fmt.Errorf("flag %s needs one of short, code, short-all or code-all, got %q", name, o.errorMode)
 				}
 			}
+		case "-diagnostics":
+			if o.diagnostics, err = takeVal(); err == nil {
+				switch o.diagnostics {
+				case "json", "sarif":
+				default:
+					return nil, fmt.Errorf("flag %s needs json or sarif, got %q", name, o.diagnostics)
+				}
+			}
+		case "-diagnostics-out":
+			o.diagnosticsOut, err = takeVal()
 		case "-vv":
 			o.traceAll = true
 		case "-freeze":
 			o.freezePath, err = takeVal()
 		case "-cfgraph":
 			o.cfgPath, err = takeVal()
+		case "-ir":
+			o.irPath, err = takeVal()
+		case "-asg":
+			o.asgPath, err = takeVal()
 		case "-trace":
 			o.tracePath, err = takeVal()
 		case "-callgraph":
@@ -241,6 +504,8 @@ func parseArgs(args []string) (*options, error) {
 		case "-callgraph-append":
 			o.callgraphPath, err = takeVal()
 			o.callgraphAppend = true
+		case "-grammar-coverage":
+			o.coveragePath, err = takeVal()
 		case "-render":
 			o.renderKind, err = takeVal()
 		default:
@@ -295,10 +560,25 @@ func main() {
 		debug.SetGCPercent(300)
 	}
 
-	o, err := parseArgs(os.Args[1:])
+	args := os.Args[1:]
+	if isSubcommand(args) {
+		reg := loadRegistry(languageSearchPath())
+		if args[0] == "languages" {
+			listLanguages(reg)
+			return
+		}
+		var err error
+		if args, err = expandSubcommand(args, reg); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+	}
+	o, err := parseArgs(args)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
-		printUsage()
+		if _, inManifest := err.(*manifestError); !inManifest {
+			printUsage()
+		}
 		os.Exit(2)
 	}
 
@@ -311,13 +591,52 @@ func main() {
 		return
 	}
 	if o.renderKind != "" {
-		if err := abnf.RenderTrace(o.renderKind, o.tracePath); err != nil {
+		var err error
+		if o.renderKind == "coverage" || o.renderKind == "coverage-html" {
+			err = abnf.RenderCoverage(o.renderKind == "coverage-html", o.coveragePath, os.Stdout)
+		} else {
+			err = abnf.RenderTrace(o.renderKind, o.tracePath)
+		}
+		if err != nil {
 			fmt.Fprintln(os.Stderr, "Render failed: ", err)
 			os.Exit(1)
 		}
 		return
 	}
 
+	if o.lsp {
+		if len(o.files) > 1 {
+			fmt.Fprintln(os.Stderr, "Error: -lsp takes at most one file: the grammar of the language to serve")
+			os.Exit(2)
+		}
+		runLSP(o)
+		return
+	}
+
+	if o.serveAddr != "" {
+		if len(o.files) > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -serve takes no files: the playground offers the grammars of the search path")
+			os.Exit(2)
+		}
+		runServe(o.serveAddr)
+		return
+	}
+
+	if err := checkFormat(o); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+	if err := checkDebug(o); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+	if o.repl {
+		if err := checkRepl(o); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+	}
+
 	// -code / -code-stdin supply the final program's source inline (or from stdin) instead
 	// of reading it from a file: the code becomes a synthetic last file that the (compiled)
 	// grammar parses. A grammar file is still required as the first positional argument.
@@ -346,34 +665,48 @@ func main() {
 		o.files = append(o.files, name)
 		codeIdx = len(o.files) - 1
 	}
+	// -stdin hands mec's stdin to the program. It is read up front, so every run of
+	// -watch and every file of -batch sees the whole of it.
+	if o.stdin {
+		if o.codeStdin {
+			fmt.Fprintln(os.Stderr, "Error: -stdin and -code-stdin both read stdin")
+			os.Exit(2)
+		}
+		dat, e := ioutil.ReadAll(os.Stdin)
+		if e != nil {
+			fmt.Fprintln(os.Stderr, "Error reading stdin: ", e)
+			os.Exit(1)
+		}
+		o.stdinText = string(dat)
+	}
+	// -repl without a program starts from an empty one.
+	if o.repl && len(o.files) == 1 && codeIdx < 0 {
+		o.files = append(o.files, "(repl)")
+		codeIdx = len(o.files) - 1
+	}
 
-	abnf.UseFrozenScripts = o.frozen
-	abnf.ParseErrorWithCode = o.errorMode == "code" || o.errorMode == "code-all"
-	abnf.ParseErrorUnabridged = o.errorMode == "short-all" || o.errorMode == "code-all"
 	// Color the parse-error dump only when stderr is a real terminal (not a pipe or
 	// file), respecting the NO_COLOR convention and TERM=dumb.
 	r.ColorErrorOutput = stderrIsTerminal() && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
-	abnf.WarnUnresolvedImports = o.warnImports
-	abnf.ImportRoots = o.importRoots
-	abnf.WarnUnsupported = o.warnUnsupported
-	abnf.RuntimePrims = o.rtPrims
-	abnf.RuntimeLib = o.rtLib
-	if o.maxStepsSet {
-		abnf.MaxIRSteps = o.maxSteps
-	}
-	abnf.EntryPoint = o.entryPoint
-	abnf.ExePath = o.exePath
-	abnf.RuntimeInputs = o.runtimeInputs
-	abnf.LinkDirs = o.linkDirs
-	abnf.LinkLibs = o.linkLibs
-	abnf.CFGOutPath = o.cfgPath
-	abnf.TraceOutPath = o.tracePath
-	abnf.CallgraphOutPath = o.callgraphPath
-	abnf.CallgraphAppend = o.callgraphAppend
-	abnf.OpenTrace() // Truncate up front: a zero-event run must not leave a stale file.
-	defer abnf.CloseTrace()
-	abnf.OpenCallgraph() // Same for -callgraph .jsonl (overwrite); -callgraph-append keeps the old file.
+	if o.diagnostics != "" {
+		openDiagnostics(o)
+		defer o.diag.Close()
+	}
+	if o.debug != "" || o.pdebug != "" {
+		defer openDebugger(o).Finish(0)
+	}
+	sess := newSession(o)
+	sess.Open() // Truncate -trace and -callgraph .jsonl up front: a run that writes nothing must not leave a stale file.
+	defer sess.Close()
+	exit = func(code int) {
+		sess.Close() // The -grammar-coverage counts of a failed run count too.
+		os.Exit(code)
+	}
 
+	if o.format {
+		runFormat(sess, o)
+		return
+	}
 	if len(o.files) == 0 {
 		printUsage()
 		os.Exit(2)
@@ -412,6 +745,28 @@ func main() {
 		}
 	}
 
+	if o.watch {
+		if err := checkWatch(o); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+	}
+	if o.batch {
+		if err := checkBatch(o); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+		if o.jobs == 0 {
+			o.jobs = runtime.NumCPU()
+		}
+		runBatch(sess, o, &abnf.Parseropts{
+			UseBlockList:         o.useBlockList,
+			UseFoundList:         o.useFoundList,
+			PreventDefaultOutput: o.quietFull,
+		})
+		return
+	}
+
 	srcs := make([]string, len(o.files))
 	for i, f := range o.files {
 		if i == codeIdx { // The synthetic -code / -code-stdin file: its source is already in hand.
@@ -433,18 +788,38 @@ func main() {
 	}
 
 	if o.speedTest {
-		speedtest(srcs[0], o.files[0], o.speedCount, o.useBlockList, o.useFoundList)
+		speedtest(sess, srcs[0], o.files[0], o.speedCount, o.useBlockList, o.useFoundList)
 		return
 	}
 
 	// -verify / -pretty inspect the first file's compiled a-grammar and exit.
 	if o.verify || o.pretty {
-		grammar := compileFirst(o.files[0], srcs[0], parseropts, o.quietMost, o.quietFull)
+		grammar := firstGrammar(sess, o, srcs, parseropts)
 		if o.pretty {
 			fmt.Println(abnf.SerializeGrammarPretty(grammar))
 			return
 		}
-		runVerify(o, grammar, srcs, parseropts)
+		runVerify(sess, o, grammar, srcs, parseropts)
+		return
+	}
+	if o.exportFormat != "" {
+		runExport(sess, o, firstGrammar(sess, o, srcs, parseropts), parseropts)
+		return
+	}
+	if o.pack {
+		if o.outPath == "" {
+			fmt.Fprintln(os.Stderr, "Error: -pack needs -o FILE.mecpack")
+			os.Exit(2)
+		}
+		if err := sess.WritePack(o.files[0], srcs[0], o.files[1:], o.outPath, parseropts); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -pack:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// -import with nothing to parse writes the imported grammar as source.
+	if o.importFormat != "" && len(o.files) == 1 {
+		writeOutput(o.outPath, "-import", abnf.GrammarSource(importFirst(sess, o.files[0], srcs[0], o.importFormat)))
 		return
 	}
 
@@ -464,6 +839,10 @@ func main() {
 	// Refuse up front rather than after the fact. The check cannot live after
 	// runPipeline: these language tests are self-checking and propagate the
 	// program's own result through os.Exit, so control never comes back here.
+	if o.exePath != "" && o.sandbox {
+		fmt.Fprintln(os.Stderr, "Error: -exe runs clang, which -sandbox does not allow")
+		os.Exit(2)
+	}
 	if o.exePath != "" && !strings.Contains(srcs[0], "exePath") {
 		fmt.Fprintf(os.Stderr,
 			"error: -exe: %s does not implement c.exePath, so no executable would be produced.\n"+
@@ -475,7 +854,77 @@ func main() {
 		os.Exit(2)
 	}
 
-	runPipeline(o, srcs, parseropts)
+	if o.watch {
+		runWatch(o, codeIdx, codeText, parseropts)
+		return
+	}
+	runPipeline(sess, o, srcs, parseropts)
+}
+
+// newSession makes the session of the run from the command line options.
+func newSession(o *options) *abnf.Session {
+	eng := abnf.NewEngine()
+	eng.Frozen = o.frozen
+	eng.ParseErrorWithCode = o.errorMode == "code" || o.errorMode == "code-all"
+	eng.ParseErrorUnabridged = o.errorMode == "short-all" || o.errorMode == "code-all"
+	eng.WarnUnresolvedImports = o.warnImports
+	eng.ImportRoots = o.importRoots
+	eng.WarnUnsupported = o.warnUnsupported
+	eng.RuntimePrims = o.rtPrims
+	eng.RuntimeLib = o.rtLib
+	if o.maxStepsSet {
+		eng.MaxIRSteps = o.maxSteps
+	}
+	eng.EntryPoint = o.entryPoint
+	eng.ExePath = o.exePath
+	eng.RuntimeInputs = o.runtimeInputs
+	eng.LinkDirs = o.linkDirs
+	eng.LinkLibs = o.linkLibs
+	eng.CFGOutPath = o.cfgPath
+	eng.IROutPath = o.irPath
+	eng.ASGOutPath = o.asgPath
+	eng.TraceOutPath = o.tracePath
+	eng.CallgraphOutPath = o.callgraphPath
+	eng.CallgraphAppend = o.callgraphAppend
+	eng.CoverageOutPath = o.coveragePath
+	eng.DetectAmbiguity = o.ambiguity
+	eng.CatchExit = o.batch || o.watch // One file's (one run's) exit() must not end the batch (the watch).
+	eng.Repl = o.repl
+	eng.Args = o.progArgs
+	eng.Stdin = o.stdinText
+	eng.Diagnostics = o.diag
+	eng.Debugger = o.debugger
+	eng.ProgramDebugger = o.pdebugger
+	if o.sandbox {
+		eng.Sandbox = sandboxPolicy(o)
+	}
+	if o.dap != nil { // Stdout is the protocol: the output goes to the editor.
+		return eng.NewSession(o.dap.output("stdout"), o.dap.output("stderr"))
+	}
+	return eng.NewSession(os.Stdout, os.Stderr)
+}
+
+// sandboxPolicy is the -sandbox policy of the command line: the directories of
+// its files, the -i roots and the -sandbox-dir ones, and its limits.
+func sandboxPolicy(o *options) *abnf.Sandbox {
+	sb := &abnf.Sandbox{Timeout: o.sandboxTimeout, MaxMemory: o.sandboxMemoryMB << 20}
+	seen := map[string]bool{}
+	for _, dir := range append(append(dirsOf(o.files), o.importRoots...), o.sandboxDirs...) {
+		if !seen[dir] {
+			seen[dir] = true
+			sb.Dirs = append(sb.Dirs, dir)
+		}
+	}
+	return sb
+}
+
+// dirsOf returns the directory of each file, in order.
+func dirsOf(files []string) []string {
+	dirs := make([]string, len(files))
+	for i, f := range files {
+		dirs[i] = filepath.Dir(f)
+	}
+	return dirs
 }
 
 // runPipeline executes the file pipeline. Without -pipe there is a single
@@ -484,24 +933,21 @@ func main() {
 // segment: an independent a-grammar chain whose PROGRAM input is the captured
 // text output (script print) of the previous segment - so a language (e.g. a
 // preprocessor) can transform the source before another language consumes it.
-func runPipeline(o *options, srcs []string, parseropts *abnf.Parseropts) {
+// A value the segment's scripts emit() is handed on as well, as c.input of the
+// next one (abnf/pipe.go); a segment that printed nothing but emitted a value
+// may be followed by a startScript-only grammar, which then runs on it.
+func runPipeline(sess *abnf.Session, o *options, srcs []string, parseropts *abnf.Parseropts) {
 	// Segment [start,end) ranges over o.files, split at the -pipe boundaries.
 	bounds := append(append([]int{0}, o.pipeBounds...), len(o.files))
 	globalStage := 0
-	var piped *string // Text output of the previous segment, or nil for the first.
+	var piped *string  // Text output of the previous segment, or nil for the first.
+	valueOnly := false // The previous segment emitted a value and printed nothing.
+	sess.SetInput(nil) // A -watch rerun starts over.
+	sess.Emitted()
 	for s := 0; s+1 < len(bounds); s++ {
 		start, end := bounds[s], bounds[s+1]
 		isLast := s+2 == len(bounds)
 
-		// This segment's grammar files and their sources; a piped-in text from the
-		// previous segment is appended as the final program input.
-		files := append([]string{}, o.files[start:end]...)
-		segSrcs := append([]string{}, srcs[start:end]...)
-		if piped != nil {
-			files = append(files, "(piped)")
-			segSrcs = append(segSrcs, *piped)
-		}
-
 		// A non-last (producer) segment has its stdout captured and fed forward, so
 		// its script output must be enabled even under -q/-qq.
 		quietFull := o.quietFull
@@ -509,43 +955,80 @@ func runPipeline(o *options, srcs []string, parseropts *abnf.Parseropts) {
 		var prevOut io.Writer
 		if !isLast {
 			quietFull = false
-			prevOut = abnf.SetOutput(&buf)
+			prevOut = sess.SetOutput(&buf)
 		}
 		parseropts.PreventDefaultOutput = quietFull
 
-		grammar := abnf.AbnfAgrammar
-		for j := range files {
+		stage := func(grammar *r.Rules, file, src string) *r.Rules {
 			globalStage++
 			verbose := o.verboseAll || o.verboseStage[globalStage]
 			trace := o.traceAll || o.traceStage[globalStage]
-			if isLast && j == len(files)-1 {
+			return runStage(sess, grammar, file, src, globalStage, o.slotStage[globalStage], verbose, trace, o.quietMost, quietFull, parseropts)
+		}
+
+		// This segment's grammar files; a piped-in text from the previous segment
+		// is the final program input after them.
+		grammar := abnf.AbnfAgrammar
+		for j, file := range o.files[start:end] {
+			if isLast && piped == nil && start+j == end-1 {
 				// Positions in traces/diagrams refer to the final program.
-				abnf.SetTraceSource(files[j], segSrcs[j])
+				sess.SetTraceSource(file, srcs[start+j])
+			}
+			if s == 0 && j == 0 && o.importFormat != "" {
+				globalStage++
+				if !o.quietMost {
+					fmt.Fprintf(os.Stderr, "Stage %d: import %s\n", globalStage, file)
+				}
+				grammar = importFirst(sess, file, srcs[start+j], o.importFormat)
+				continue
 			}
-			grammar = runStage(grammar, files[j], segSrcs[j], globalStage, o.slotStage[globalStage], verbose, trace, o.quietMost, quietFull, parseropts)
+			if j == 0 && abnf.IsPack(file) {
+				globalStage++
+				if !o.quietMost {
+					fmt.Fprintf(os.Stderr, "Stage %d: load pack %s\n", globalStage, file)
+				}
+				grammar = openPack(sess, file)
+				continue
+			}
+			grammar = stage(grammar, file, srcs[start+j])
 		}
 
-		// A startScript-only trailing grammar (last segment only) runs on empty input.
-		if isLast && abnf.GrammarStartScriptOnly(grammar) {
-			globalStage++
-			verbose := o.verboseAll || o.verboseStage[globalStage]
-			trace := o.traceAll || o.traceStage[globalStage]
-			runStage(grammar, "", "", globalStage, o.slotStage[globalStage], verbose, trace, o.quietMost, quietFull, parseropts)
+		// An emitted value without text goes to a startScript-only grammar as it
+		// is; otherwise the text is the program, as it always was.
+		byValue := valueOnly && abnf.GrammarStartScriptOnly(grammar)
+		if piped != nil && !byValue {
+			if isLast {
+				sess.SetTraceSource("(piped)", *piped)
+			}
+			grammar = stage(grammar, "(piped)", *piped)
+		}
+
+		// A startScript-only trailing grammar runs on empty input: in the last
+		// segment, and in one that got a value to run on.
+		if (isLast || byValue) && abnf.GrammarStartScriptOnly(grammar) {
+			stage(grammar, "", "")
 		}
 
 		if !isLast {
-			abnf.SetOutput(prevOut)
+			sess.SetOutput(prevOut)
 			t := buf.String()
 			piped = &t
+			v, emitted := sess.Emitted()
+			sess.SetInput(v)
+			valueOnly = emitted && t == ""
 		}
 	}
 }
 
+// exit ends the process with code. Under -watch it ends only the current run of
+// the pipeline instead (watch.go), so runPipeline and what it calls use it.
+var exit = os.Exit
+
 // runStage parses a file with the given a-grammar and compiles the resulting
 // ASG; the compiled result is the a-grammar for the next stage. It exits the
 // process on any error (the exit code of a compiled program is set by the
 // program itself, via the exit() it calls).
-func runStage(grammar *r.Rules, file, src string, stage, slot int, verbose, trace, quietMost, quietFull bool, parseropts *abnf.Parseropts) *r.Rules {
+func runStage(sess *abnf.Session, grammar *r.Rules, file, src string, stage, slot int, verbose, trace, quietMost, quietFull bool, parseropts *abnf.Parseropts) *r.Rules {
 	target := file
 	if target == "" {
 		target = "(run)"
@@ -554,11 +1037,21 @@ func runStage(grammar *r.Rules, file, src string, stage, slot int, verbose, trac
 		fmt.Fprintf(os.Stderr, "Stage %d: parse %s\n", stage, target)
 	}
 	parseropts.TraceEnabled = trace
-	asg, err := abnf.ParseWithAgrammar(grammar, src, file, parseropts)
+	cacheable := grammar == abnf.AbnfAgrammar && !verbose && !trace // A grammar file: see abnf/grammarcache.go.
+	if cacheable {
+		if cached := loadCachedGrammar(file, src, slot); cached != nil {
+			if !quietMost {
+				fmt.Fprintln(os.Stderr, "  ==> Success, compiled a-grammar from the cache")
+			}
+			return cached
+		}
+	}
+	asg, err := sess.Parse(grammar, src, file, parseropts)
+	if code, exited := exitCode(err); exited {
+		exit(code) // A tag script ended the run (-watch catches exit(); see newSession).
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "  ==> Fail")
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		failStage(sess, err, file)
 	}
 	if !quietMost {
 		fmt.Fprintln(os.Stderr, "  ==> Success, generated abstract semantic graph (ASG)")
@@ -570,15 +1063,19 @@ func runStage(grammar *r.Rules, file, src string, stage, slot int, verbose, trac
 	if !quietMost {
 		fmt.Fprintf(os.Stderr, "Stage %d: compile\n", stage)
 	}
-	result, err := abnf.CompileASG(asg, grammar, file, slot, trace, quietFull)
+	result, err := sess.Compile(asg, grammar, file, slot, trace, quietFull)
+	if code, exited := exitCode(err); exited {
+		exit(code)
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "  ==> Fail")
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		failStage(sess, err, file)
 	}
 	if !quietMost {
 		fmt.Fprintln(os.Stderr, " ==> Success")
 	}
+	if cacheable {
+		storeCachedGrammar(file, src, slot, result)
+	}
 	if verbose && result != nil {
 		fmt.Fprintf(os.Stderr, "   => Result:  %s\n\n", result.Serialize())
 	}
@@ -586,29 +1083,104 @@ func runStage(grammar *r.Rules, file, src string, stage, slot int, verbose, trac
 }
 
 // compileFirst parses and compiles the first file with the built-in a-grammar,
-// returning its a-grammar (used by -verify and -pretty). Exits on failure.
-func compileFirst(file, src string, parseropts *abnf.Parseropts, quietMost, quietFull bool) *r.Rules {
-	asg, err := abnf.ParseWithAgrammar(abnf.AbnfAgrammar, src, file, parseropts)
+// returning its a-grammar (used by -verify, -pretty and -export). Exits on failure.
+func compileFirst(sess *abnf.Session, file, src string, parseropts *abnf.Parseropts, quietMost, quietFull bool) *r.Rules {
+	grammar, err := sess.CompileGrammar(src, file, 0, parseropts, quietFull)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "  ==> Fail")
-		fmt.Fprintln(os.Stderr, err)
+		failStage(sess, err, file)
+	}
+	if grammar == nil {
+		fmt.Fprintln(os.Stderr, "Error: the first file did not compile to an a-grammar")
 		os.Exit(1)
 	}
-	grammar, err := abnf.CompileASG(asg, abnf.AbnfAgrammar, file, 0, false, quietFull)
+	return grammar
+}
+
+// firstGrammar returns the first file's a-grammar: imported with -import,
+// loaded from a language pack, compiled otherwise.
+func firstGrammar(sess *abnf.Session, o *options, srcs []string, parseropts *abnf.Parseropts) *r.Rules {
+	if o.importFormat != "" {
+		return importFirst(sess, o.files[0], srcs[0], o.importFormat)
+	}
+	if abnf.IsPack(o.files[0]) {
+		return openPack(sess, o.files[0])
+	}
+	return compileFirst(sess, o.files[0], srcs[0], parseropts, o.quietMost, o.quietFull)
+}
+
+// importFirst converts a grammar written in another notation (-import) into an
+// a-grammar. Exits on failure.
+func importFirst(sess *abnf.Session, file, src, format string) *r.Rules {
+	grammar, err := abnf.ImportGrammar(format, src, file)
+	if err != nil {
+		failStage(sess, err, file)
+	}
+	return grammar
+}
+
+// openPack puts a language pack (-pack) in use and returns its a-grammar. Exits
+// on failure.
+func openPack(sess *abnf.Session, file string) *r.Rules {
+	grammar, err := sess.OpenPack(file)
 	if err != nil {
+		failStage(sess, err, file)
+	}
+	return grammar
+}
+
+// failStage reports the failed parse or compile of file and ends the run: as the
+// "==> Fail" line and the error, or as a diagnostic under -diagnostics.
+func failStage(sess *abnf.Session, err error, file string) {
+	if !sess.ReportError(err, file) {
 		fmt.Fprintln(os.Stderr, "  ==> Fail")
 		fmt.Fprintln(os.Stderr, err)
+	}
+	exit(1)
+}
+
+// writeOutput writes text to the -o file, or to stdout without one.
+func writeOutput(path, flag, text string) {
+	if path == "" {
+		fmt.Print(text)
+		return
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", flag, err)
 		os.Exit(1)
 	}
-	if grammar == nil {
-		fmt.Fprintln(os.Stderr, "Error: the first file did not compile to an a-grammar")
+}
+
+// runExport writes the first file's a-grammar, assembled with its :include()
+// fragments, in the -export format to -o (stdout by default). The grammar is
+// named after the output file, or after the grammar file without one.
+func runExport(sess *abnf.Session, o *options, grammar *r.Rules, parseropts *abnf.Parseropts) {
+	if err := sess.AssembleIncludes(grammar, o.files[0], parseropts); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: -export:", err)
+		os.Exit(1)
+	}
+	name := o.outPath
+	if name == "" || o.exportFormat == "railroad" {
+		name = o.files[0]
+	}
+	name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	out := os.Stdout
+	if o.outPath != "" && o.exportFormat != "railroad" {
+		f, err := os.Create(o.outPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -export:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := abnf.Export(o.exportFormat, grammar, name, out, o.outPath); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: -export:", err)
 		os.Exit(1)
 	}
-	return grammar
 }
 
 // runVerify lints a compiled a-grammar and exits with the right code.
-func runVerify(o *options, grammar *r.Rules, srcs []string, parseropts *abnf.Parseropts) {
+func runVerify(sess *abnf.Session, o *options, grammar *r.Rules, srcs []string, parseropts *abnf.Parseropts) {
 	ownNames := abnf.ProductionNames(grammar) // Before assembly: the grammar's own productions.
 	if abnf.HasInclude(grammar) {
 		// Assemble the :include() fragments by parsing the second file (or empty).
@@ -619,12 +1191,20 @@ func runVerify(o *options, grammar *r.Rules, srcs []string, parseropts *abnf.Par
 		// A failed assembly (a missing or broken :include() file) is the real
 		// finding: swallowed, it surfaced only as an "undefined name" for every
 		// fragment production, hiding the cause.
-		if _, err := abnf.ParseWithAgrammar(grammar, assemblySrc, assemblyName, parseropts); err != nil {
-			fmt.Fprintf(os.Stderr, "%s: error: cannot assemble the grammar's includes: %s\n", o.files[0], err)
-			os.Exit(1)
+		if _, err := sess.Parse(grammar, assemblySrc, assemblyName, parseropts); err != nil {
+			failIncludes(o, err)
 		}
 	}
 	issues := abnf.Verify(grammar, srcs[0], ownNames)
+	if o.diag != nil {
+		for _, iss := range issues {
+			o.diag.Report(iss.Diagnostic(o.files[0]))
+		}
+		if o.diag.Errors() > 0 {
+			exit(1)
+		}
+		return
+	}
 	errors := 0
 	for _, iss := range issues {
 		where := ""
@@ -644,7 +1224,47 @@ func runVerify(o *options, grammar *r.Rules, srcs []string, parseropts *abnf.Par
 		fmt.Fprintf(os.Stderr, "%s: %d issue(s), %d error(s).\n", o.files[0], len(issues), errors)
 	}
 	if errors > 0 {
-		os.Exit(1)
+		exit(1)
+	}
+}
+
+// failIncludes reports that the first file's :include() files could not be
+// assembled and exits. A parse error stays one, at its place in the include.
+func failIncludes(o *options, err error) {
+	if o.diag == nil {
+		fmt.Fprintf(os.Stderr, "%s: error: cannot assemble the grammar's includes: %s\n", o.files[0], err)
+		exit(1)
+	}
+	d := abnf.ErrorDiagnostic(err, o.files[0])
+	if d.Code == "compile-error" {
+		d.Code = "include-error"
+	}
+	o.diag.Report(d)
+	exit(1)
+}
+
+// openDiagnostics opens the -diagnostics reporter on the -diagnostics-out file
+// (stderr without one) and makes exit close it: a SARIF log is written only at
+// the end of the run.
+func openDiagnostics(o *options) {
+	w := io.Writer(os.Stderr)
+	if o.diagnosticsOut != "" {
+		f, err := os.Create(o.diagnosticsOut)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -diagnostics-out:", err)
+			os.Exit(1)
+		}
+		w = f
+	}
+	diag, err := abnf.NewDiagnosticReporter(o.diagnostics, w)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+	o.diag = diag
+	exit = func(code int) {
+		diag.Close()
+		os.Exit(code)
 	}
 }
 
@@ -657,20 +1277,50 @@ func stderrIsTerminal() bool {
 
 func printUsage() {
 	fmt.Fprint(os.Stderr, `Usage: mec [flags] grammar.abnf [file ...]
+       mec run|interp|compile prog.x [flags]
+       mec build prog.x [-o exe] [flags]
+       mec languages
 
 The first file is compiled by the built-in ABNF a-grammar; each further file is
 parsed and compiled by the grammar the previous stage produced. Flags may appear
 anywhere among the files.
 
+The subcommands pick the grammar by the program's extension or #! line, from the
+grammars in $MEC_PATH, ./languages and languages/ next to mec (each grammar names
+its own in :extensions() and :shebangs()): run uses the interpreter (else the
+-to-llvm-ir grammar), interp only the interpreter, compile the -to-llvm-ir grammar,
+and build links an executable (-o, default: the program's name) with the
+-to-llvm-ir grammar and -exe. languages lists what the search path holds.
+
   -v, -vN       verbose for all stages / stage N (ASG + compiled result)
   -vv, -vvN     parser+compiler trace for all stages / stage N
   -slotN V      compile stage N with tag slot V (default 0)
   -q, -qq       quiet (program output + errors / errors only)
   -error MODE   parse-failure dump detail: short (default; structure + tokens), code (also
                 each tag's code), short-all / code-all (the whole tree, no [...] abridging)
+  -diagnostics FMT  report parse failures, -verify issues, -warn-imports / -warn-unsupported
+                warnings and compile / runtime failures as structured records instead of
+                text: json (one object per line) or sarif (a SARIF 2.1.0 log, for code scanning)
+  -diagnostics-out F  write the -diagnostics records to F instead of stderr
   -frozen       run the annotation scripts goja-free (see abnf/frozen.go)
   -verify       lint the first file's grammar and exit
   -pretty       print the first file's serialized a-grammar and exit
+  -fmt          print the grammar files (stdin without one) in the canonical layout: aligned
+                names, one alternative per line in a long production, comments kept; -w
+                rewrites the files instead. A grammar is left alone unless the formatted
+                text compiles to the same a-grammar
+  -export FMT   write the first file's a-grammar (with its :include()s) in another
+                format and exit: antlr (.g4), ebnf (W3C), tree-sitter (grammar.js) or
+                railroad (one SVG diagram per production, into the -o directory)
+  -o PATH       the output file (directory for -export railroad); default stdout
+  -import FMT   the first file is a grammar in another notation, imported instead of
+                compiled: rfc5234 (IETF ABNF), antlr (.g4) or pegjs (PEG.js/Peggy).
+                Alone, it writes the result as annotated EBNF to -o (default stdout)
+                and exits; with further files, they are parsed by the imported grammar
+  -pack         bundle the first file's language (compiled a-grammar, :include()s, script
+                libraries, runtime .ll files, -frozen scripts) into the -o file and exit.
+                Further files are added to the pack. A first file ending in .mecpack is
+                such a pack, run in place of the grammar: mec python.mecpack prog.py
   -i DIR        add an include root for project-file imports (repeatable; an import
                 like 'a.b.C' is searched as a/b/C.<ext> under the program's own
                 directory first, then under each -i root in order)
@@ -693,22 +1343,85 @@ anywhere among the files.
   -code SRC     take the final program's source from SRC (inline) instead of a file,
                 e.g. languages/calculator-global-stack-interpreter.abnf -code '9*(2+3)'
   -code-stdin   take the final program's source from stdin instead of a file
+  -stdin        pass mec's stdin through to the program: what it reads (input(),
+                readLine(), getchar() ...) comes from there. Without it a program
+                reads an empty input
+  -- ARGS       the rest of the command line is the program's arguments (sys.argv,
+                os.Args, String[] args, argv ...; c.args to a grammar)
   -pipe         start a new pipeline segment: the text a language prints becomes the
                 program input of the next segment, so one language (e.g. a preprocessor)
                 can transform the source another language then consumes, e.g.
                 c-preprocessor.abnf prog.c -pipe c-to-llvm-ir.abnf
+                A value a script emit()s (an ASG, an a-grammar, a JSON-like object) is handed on
+                too, as c.input of the next segment's scripts
+  -batch        run every file after the grammar through it as a program of its own, in
+                parallel: the grammar is compiled once, each file's output is printed in
+                order, and a summary lists the files that failed and why. The files share
+                one -trace stream and one -callgraph file
+  -j N          the number of -batch workers (default: the number of CPUs)
+  -watch        keep running: rerun the pipeline whenever the grammar, a fragment or script
+                library it includes, an imported project file or the program changes
+  -repl         load the program (optional), then read statements from stdin and run
+                each in its scope, printing the value of an expression; a statement
+                that is not finished at the end of a line continues on the next
+  -lsp          serve the Language Server Protocol on stdin/stdout for .abnf grammar
+                files: diagnostics, definitions, references, hover, symbols, rename and
+                completion (editor/vscode-abnf starts it); -lsp G serves the language of
+                grammar G instead: parse errors, an outline from its :symbol() productions,
+                folding and :highlight() highlighting for every file the editor opens
+  -serve ADDR   serve the web playground on ADDR (e.g. :8777): pick a grammar of the
+                search path, type a program and see its output, ASG, IR, control flow and
+                call graphs; POST /run {grammar, code, flags} is the same as a JSON API
+  -debug        stop the compile walk at the first tag (or at the -break points) and read
+                commands from stdin: step into, over and out of the walk, show up, ltr,
+                the local and global stacks, the matched text and the path of enclosing
+                tags, run code in the tag's scope (help lists the commands); -debug=dap
+                serves the Debug Adapter Protocol on stdin/stdout instead (editor/vscode-abnf)
+  -pdebug       stop the program llvm.RunJS runs at its first statement (or at the -break
+                points) and read commands from stdin: step statement by statement, into,
+                over and out of calls, show the call stack and the variables of every
+                call; -pdebug=dap serves the Debug Adapter Protocol instead
+  -break SPEC   a -debug breakpoint (repeatable): a production name, GRAMMAR:LINE (the
+                tags written on that line), FILE:LINE[:COL] or @LINE[:COL] (the nodes whose
+                match ends there in the program); under -pdebug a function name,
+                FILE:LINE[:COL] or @LINE[:COL] of the program
+  -project F    read the project manifest F (JSON: named targets, each a grammar chain,
+                sources, -i roots, -rt/-L/-l link inputs, -main, -exe and output files);
+                without it, mec.json in the working directory is used when no file is
+                given. Flags on the command line override the manifest's values;
+                -frozen=false, -warn-imports=false and -warn-unsupported=false switch off
+                what the manifest switches on
+  -target NAME  the manifest target to run (default: its "default", or its only target)
   -cfgraph F    write the control flow graph of every executed module to file F (DOT; .mmd = Mermaid)
+  -ir F         write the LLVM IR of every executed module to file F (the second to F-2, ...)
+  -asg F        write the ASG of the final program's parse to file F (JSON, see abnf/r/marshal.go)
   -trace F      stream runtime events to file F as JSON lines; also the -render input
   -callgraph F  write the static call graph to file F, overwriting it (.jsonl feeds -render static)
   -callgraph-append F
                 like -callgraph but keeps F and adds to it, to accumulate a graph across many runs
+  -grammar-coverage F
+                count which productions, alternatives, options and tags of the
+                grammars the run's parses matched, and add the counts to file F (JSON
+                lines, accumulates across runs like -callgraph-append)
   -render K     standalone (no pipeline): read the JSON-lines file named by -trace F
                 and write graph K to stdout as Graphviz DOT, then exit. K = calls | vars
-                (from a -trace run) or static (from a -callgraph run)
+                (from a -trace run) or static (from a -callgraph run); K = coverage |
+                coverage-html reads -grammar-coverage F and writes the annotated grammar
+                source as text or HTML instead
   -freeze F     (re)create the frozen bootstrap snapshot from grammar file F, then exit
   -lb, -lf      parser block-list / found-list (debugging aids)
+  -ambiguity    diagnostic parse: at every Or that matched, also try the later alternatives
+                and report (stderr) where one of them matches with a different length
   -max-steps N  raise the IR interpreter's endless-loop brake: how many instructions ONE
                 top-level call may run (default 100000000, 0 = no limit)
+  -sandbox      run untrusted grammars and programs: files only below the directories of
+                the files given, the -i roots and -sandbox-dir, no exit() of mec itself (the
+                run ends with the exit code instead), env.get() empty, no clang (no -exe), and
+                a time and memory limit for the scripts and programs. The -sandbox-* flags
+                imply it
+  -sandbox-dir DIR  also allow the files below DIR (repeatable)
+  -sandbox-timeout D  the run's wall-clock limit, a Go duration (default 30s, 0 = none)
+  -sandbox-memory MB  the memory the scripts and programs may allocate (default 512, 0 = none)
   -speed N      speed test: warm up once, then time N parse+compile cycles of the first file
 `)
 }
@@ -719,7 +1432,7 @@ anywhere among the files.
 // the repeated cycles: N parses, then N compiles of the pre-parsed ASG. The
 // result therefore reflects steady-state throughput, not the program start-up or
 // the file I/O.
-func speedtest(src, fileName string, count int, useBlockList, useFoundList bool) {
+func speedtest(sess *abnf.Session, src, fileName string, count int, useBlockList, useFoundList bool) {
 	parseropts := &abnf.Parseropts{
 		UseBlockList:         useBlockList,
 		UseFoundList:         useFoundList,
@@ -728,12 +1441,12 @@ func speedtest(src, fileName string, count int, useBlockList, useFoundList bool)
 	}
 
 	// Warm up once, untimed.
-	asg, err := abnf.ParseWithAgrammar(abnf.AbnfAgrammar, src, fileName, parseropts)
+	asg, err := sess.Parse(abnf.AbnfAgrammar, src, fileName, parseropts)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Speed test: parse failed:", err)
 		return
 	}
-	if _, err = abnf.CompileASG(asg, abnf.AbnfAgrammar, fileName, 0, false, true); err != nil {
+	if _, err = sess.Compile(asg, abnf.AbnfAgrammar, fileName, 0, false, true); err != nil {
 		fmt.Fprintln(os.Stderr, "Speed test: compile failed:", err)
 		return
 	}
@@ -741,7 +1454,7 @@ func speedtest(src, fileName string, count int, useBlockList, useFoundList bool)
 	// Time N parse cycles.
 	start := time.Now()
 	for i := 0; i < count; i++ {
-		if asg, err = abnf.ParseWithAgrammar(abnf.AbnfAgrammar, src, fileName, parseropts); err != nil {
+		if asg, err = sess.Parse(abnf.AbnfAgrammar, src, fileName, parseropts); err != nil {
 			fmt.Fprintln(os.Stderr, "Speed test: parse failed:", err)
 			return
 		}
@@ -751,7 +1464,7 @@ func speedtest(src, fileName string, count int, useBlockList, useFoundList bool)
 	// Time N compile cycles on the ASG from the last parse.
 	start = time.Now()
 	for i := 0; i < count; i++ {
-		if _, err = abnf.CompileASG(asg, abnf.AbnfAgrammar, fileName, 0, false, true); err != nil {
+		if _, err = sess.Compile(asg, abnf.AbnfAgrammar, fileName, 0, false, true); err != nil {
 			fmt.Fprintln(os.Stderr, "Speed test: compile failed:", err)
 			return
 		}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A project manifest names a project's command lines once, instead of in every
+// Makefile rule and editor launch configuration:
+//
+//	{
+//	  "default": "app",
+//	  "targets": {
+//	    "app": {
+//	      "grammars": ["languages/kotlin-to-llvm-ir.abnf"],
+//	      "sources":  ["app/src/main/Main.kt"],
+//	      "include":  ["app/src/main/java"],
+//	      "warnImports": true
+//	    },
+//	    "native": {
+//	      "extends": "app",
+//	      "runtime": ["rt/io.c"], "linkLibs": ["m"],
+//	      "exe": "build/app"
+//	    }
+//	  }
+//	}
+//
+// It is read from -project FILE, or from mec.json in the working directory when
+// -target is given or the command line names no file (so a bare "./mec" runs the
+// project). A target is turned into command line arguments that go in
+// FRONT of the real ones: the command line is parsed after it, so a flag given
+// there overrides the manifest's value, and a boolean the target switches on
+// is switched off by -frozen=false, -warn-imports=false,
+// -warn-unsupported=false, -sandbox=false or -q=false. A list flag given on the command line
+// (-i, -rt, -L, -l) replaces the target's list rather than adding to it, and
+// files given on the command line (or -code / -code-stdin) take the place of the
+// target's sources; its grammar chain stays. Paths are relative to the manifest's
+// directory, except inside "args", which are passed on verbatim.
+
+// manifestName is the manifest looked for in the working directory.
+const manifestName = "mec.json"
+
+// manifest is a parsed project manifest.
+type manifest struct {
+	Default string                     `json:"default"` // The target run without -target; may be omitted when there is only one.
+	Targets map[string]*manifestTarget `json:"targets"`
+}
+
+// manifestTarget is one named command line. Each field stands for the flag it
+// is named after. The booleans and quiet are pointers, so that a target that
+// says false (or "") is told apart from one that does not say: the first
+// switches off what the target it extends switches on.
+type manifestTarget struct {
+	Extends         string   `json:"extends"`  // A target whose fields this one starts from.
+	Grammars        []string `json:"grammars"` // The grammar chain: the pipeline's first files.
+	Sources         []string `json:"sources"`  // The files the last grammar parses.
+	Include         []string `json:"include"`  // -i
+	Runtime         []string `json:"runtime"`  // -rt
+	LinkDirs        []string `json:"linkDirs"` // -L
+	LinkLibs        []string `json:"linkLibs"` // -l
+	Main            string   `json:"main"`     // -main
+	Exe             string   `json:"exe"`      // -exe
+	Cfgraph         string   `json:"cfgraph"`
+	Trace           string   `json:"trace"`
+	Callgraph       string   `json:"callgraph"`
+	Quiet           *string  `json:"quiet"` // "q", "qq", or "" for not quiet.
+	Frozen          *bool    `json:"frozen"`
+	WarnImports     *bool    `json:"warnImports"`
+	WarnUnsupported *bool    `json:"warnUnsupported"`
+	Sandbox         *bool    `json:"sandbox"`
+	Args            []string `json:"args"` // Any further flags, as on the command line.
+}
+
+// manifestError is a broken manifest or target, which the usage text would not
+// help with.
+type manifestError struct{ err error }
+
+func (e *manifestError) Error() string { return e.err.Error() }
+
+// loadManifest reads and checks the manifest at path.
+func loadManifest(path string) (*manifest, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.DisallowUnknownFields() // A misspelt key would otherwise be dropped without a word.
+	var m manifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(m.Targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets", path)
+	}
+	if m.Default != "" && m.Targets[m.Default] == nil {
+		return nil, fmt.Errorf("%s: the default target %q is not defined", path, m.Default)
+	}
+	for name, t := range m.Targets {
+		if t == nil {
+			return nil, fmt.Errorf("%s: target %q is null", path, name)
+		}
+		if t.Quiet != nil {
+			switch *t.Quiet {
+			case "", "q", "qq":
+			default:
+				return nil, fmt.Errorf("%s: target %q: quiet must be \"q\", \"qq\" or \"\", got %q", path, name, *t.Quiet)
+			}
+		}
+		for _, a := range t.Args {
+			if a == "-project" || a == "-target" || strings.HasPrefix(a, "-project=") || strings.HasPrefix(a, "-target=") {
+				return nil, fmt.Errorf("%s: target %q: %s cannot appear in a manifest", path, name, a)
+			}
+		}
+	}
+	return &m, nil
+}
+
+// target returns the named target, or the default one for "", with the targets
+// it extends folded in.
+func (m *manifest) target(name string) (*manifestTarget, error) {
+	if name == "" {
+		name = m.Default
+	}
+	if name == "" {
+		if len(m.Targets) > 1 {
+			return nil, fmt.Errorf("the manifest has %d targets (%s) and no default; choose one with -target", len(m.Targets), m.targetNames())
+		}
+		for n := range m.Targets {
+			name = n
+		}
+	}
+	var chain []*manifestTarget
+	seen := map[string]bool{}
+	for n := name; n != ""; n = m.Targets[n].Extends {
+		if seen[n] {
+			return nil, fmt.Errorf("target %q extends itself", n)
+		}
+		seen[n] = true
+		if m.Targets[n] == nil {
+			return nil, fmt.Errorf("no target %q (targets: %s)", n, m.targetNames())
+		}
+		chain = append(chain, m.Targets[n])
+	}
+	t := &manifestTarget{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		t.extend(chain[i])
+	}
+	return t, nil
+}
+
+func (m *manifest) targetNames() string {
+	names := make([]string, 0, len(m.Targets))
+	for n := range m.Targets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// extend overlays the fields o sets on t. A boolean o sets to false is set, and
+// wins like any other value. Args accumulate, so a target can add a flag to the
+// ones of the target it extends.
+func (t *manifestTarget) extend(o *manifestTarget) {
+	list := func(dst *[]string, src []string) {
+		if src != nil {
+			*dst = src
+		}
+	}
+	str := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	set := func(dst **bool, src *bool) {
+		if src != nil {
+			*dst = src
+		}
+	}
+	list(&t.Grammars, o.Grammars)
+	list(&t.Sources, o.Sources)
+	list(&t.Include, o.Include)
+	list(&t.Runtime, o.Runtime)
+	list(&t.LinkDirs, o.LinkDirs)
+	list(&t.LinkLibs, o.LinkLibs)
+	str(&t.Main, o.Main)
+	str(&t.Exe, o.Exe)
+	str(&t.Cfgraph, o.Cfgraph)
+	str(&t.Trace, o.Trace)
+	str(&t.Callgraph, o.Callgraph)
+	if o.Quiet != nil {
+		t.Quiet = o.Quiet
+	}
+	set(&t.Frozen, o.Frozen)
+	set(&t.WarnImports, o.WarnImports)
+	set(&t.WarnUnsupported, o.WarnUnsupported)
+	set(&t.Sandbox, o.Sandbox)
+	t.Args = append(t.Args, o.Args...)
+}
+
+// args renders the target as the command line arguments that stand in front of
+// the real ones, cli. dir is the manifest's directory, which the target's paths
+// are relative to.
+func (t *manifestTarget) args(dir string, cli *options) []string {
+	path := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	var a []string
+	flag := func(name, val string) {
+		if val != "" {
+			a = append(a, name, path(val))
+		}
+	}
+	// A list the command line gives replaces the target's.
+	list := func(name string, vals, cliVals []string) {
+		if len(cliVals) == 0 {
+			for _, v := range vals {
+				flag(name, v)
+			}
+		}
+	}
+	if t.Quiet != nil && *t.Quiet != "" {
+		a = append(a, "-"+*t.Quiet)
+	}
+	on := func(name string, b *bool) {
+		if b != nil && *b {
+			a = append(a, name)
+		}
+	}
+	on("-frozen", t.Frozen)
+	on("-warn-imports", t.WarnImports)
+	on("-warn-unsupported", t.WarnUnsupported)
+	on("-sandbox", t.Sandbox)
+	list("-i", t.Include, cli.importRoots)
+	list("-rt", t.Runtime, cli.runtimeInputs)
+	list("-L", t.LinkDirs, cli.linkDirs)
+	if len(cli.linkLibs) == 0 {
+		for _, lib := range t.LinkLibs {
+			a = append(a, "-l", lib) // A library name, not a path.
+		}
+	}
+	if t.Main != "" {
+		a = append(a, "-main", t.Main)
+	}
+	flag("-exe", t.Exe)
+	flag("-cfgraph", t.Cfgraph)
+	flag("-trace", t.Trace)
+	flag("-callgraph", t.Callgraph)
+	a = append(a, t.Args...)
+	for _, g := range t.Grammars {
+		a = append(a, path(g))
+	}
+	if len(cli.files) == 0 && !cli.codeSet && !cli.codeStdin {
+		for _, s := range t.Sources {
+			a = append(a, path(s))
+		}
+	}
+	return a
+}
+
+// manifestArgs returns the arguments the manifest of the command line cli
+// contributes, or nil when the run uses none. Without -project, a mec.json in
+// the working directory is picked up by -target, or by a command line that
+// names no file and is not a standalone mode (-render, -freeze) - never by an
+// ordinary "./mec grammar.abnf prog.x".
+func manifestArgs(cli *options) ([]string, error) {
+	path := cli.projectPath
+	if path == "" {
+		if cli.target == "" && (len(cli.files) > 0 || cli.renderKind != "" || cli.freezePath != "") {
+			return nil, nil
+		}
+		if _, err := os.Stat(manifestName); err != nil {
+			if cli.target != "" {
+				return nil, fmt.Errorf("-target %s, but there is no %s in the working directory (pass -project FILE)", cli.target, manifestName)
+			}
+			return nil, nil
+		}
+		path = manifestName
+	}
+	m, err := loadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := m.target(cli.target)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return t.args(filepath.Dir(path), cli), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestManifestBooleans runs a target that switches frozen, warnImports and
+// warnUnsupported on, and expects the command line to switch each of them off
+// again with -flag=false, and to leave the others as the manifest has them.
+func TestManifestBooleans(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "mec.json")
+	manifest := `{"targets": {"app": {"grammars": ["g.abnf"], "sources": ["p.x"],
+		"frozen": true, "warnImports": true, "warnUnsupported": true}}}`
+	if err := os.WriteFile(project, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		args                                 []string
+		frozen, warnImports, warnUnsupported bool
+	}{
+		{nil, true, true, true},
+		{[]string{"-frozen=false"}, false, true, true},
+		{[]string{"-warn-imports=false", "-warn-unsupported=0"}, true, false, false},
+		{[]string{"-frozen=false", "-frozen"}, true, true, true},
+	} {
+		o, err := parseArgs(append([]string{"-project", project}, tc.args...))
+		if err != nil {
+			t.Fatalf("%v: %v", tc.args, err)
+		}
+		if o.frozen != tc.frozen || o.warnImports != tc.warnImports || o.warnUnsupported != tc.warnUnsupported {
+			t.Errorf("%v: frozen %v, warnImports %v, warnUnsupported %v; want %v, %v, %v", tc.args,
+				o.frozen, o.warnImports, o.warnUnsupported, tc.frozen, tc.warnImports, tc.warnUnsupported)
+		}
+	}
+	if _, err := parseArgs([]string{"-project", project, "-frozen=off"}); err == nil {
+		t.Error("-frozen=off is accepted")
+	}
+}
+
+// TestManifestExtends switches frozen, quiet and sandbox on in a target and off
+// again in one that extends it: the child's false wins, and what it leaves out
+// it keeps from the parent. -q=false undoes the quiet of a target too.
+func TestManifestExtends(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "mec.json")
+	manifest := `{"targets": {
+		"base": {"grammars": ["g.abnf"], "sources": ["p.x"],
+			"frozen": true, "quiet": "qq", "sandbox": true, "warnImports": true},
+		"loud": {"extends": "base", "frozen": false, "quiet": "", "sandbox": false},
+		"louder": {"extends": "loud", "warnUnsupported": true},
+		"again": {"extends": "loud", "frozen": true, "quiet": "q"}}}`
+	if err := os.WriteFile(project, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		args                                           []string
+		frozen, quietMost, quietFull, sandbox, imports bool
+	}{
+		{[]string{"-target", "base"}, true, true, true, true, true},
+		{[]string{"-target", "loud"}, false, false, false, false, true},
+		{[]string{"-target", "louder"}, false, false, false, false, true},
+		{[]string{"-target", "again"}, true, true, false, false, true},
+		{[]string{"-target", "base", "-q=false", "-sandbox=false"}, true, false, false, false, true},
+		{[]string{"-target", "base", "-qq=false"}, true, true, false, true, true},
+	} {
+		o, err := parseArgs(append([]string{"-project", project}, tc.args...))
+		if err != nil {
+			t.Fatalf("%v: %v", tc.args, err)
+		}
+		if o.frozen != tc.frozen || o.quietMost != tc.quietMost || o.quietFull != tc.quietFull || o.sandbox != tc.sandbox || o.warnImports != tc.imports {
+			t.Errorf("%v: frozen %v, quiet %v/%v, sandbox %v, warnImports %v; want %v, %v/%v, %v, %v", tc.args,
+				o.frozen, o.quietMost, o.quietFull, o.sandbox, o.warnImports,
+				tc.frozen, tc.quietMost, tc.quietFull, tc.sandbox, tc.imports)
+		}
+	}
+}
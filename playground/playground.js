@@ -0,0 +1,353 @@
+/* playground.js - the page of mec -serve (serve.go).
+ *
+ * Lists the grammars of GET /grammars, sends the program to POST /run and shows
+ * the answer in tabs: the output (and errors), the ASG, the IR of every module
+ * the run executed, and their control flow and call graphs. A graph is laid out
+ * here, in 2D, with a small force simulation drawn as SVG; the 3D button opens
+ * it in the viz/graph3d viewer the server also serves.
+ *
+ * The program typed for a grammar is kept in localStorage, per grammar, and so
+ * is the grammar picked last.
+ */
+(function () {
+  'use strict';
+
+  var $ = function (id) { return document.getElementById(id); };
+  var elGrammar = $('grammar'), elFlags = $('flags'), elRun = $('run'), elStatus = $('status');
+  var elCode = $('code'), elTabs = $('tabs'), elTools = $('tools'), elView = $('view');
+
+  var result = null;      // the last POST /run answer
+  var tab = 'output';
+  var module = 0;         // the module the IR and graph tabs show
+  var asDot = false;      // graph tabs: the DOT text instead of the drawing
+
+  var TABS = [
+    { id: 'output', name: 'Output' },
+    { id: 'asg', name: 'ASG' },
+    { id: 'ir', name: 'IR', list: 'ir' },
+    { id: 'cfg', name: 'CFG', list: 'cfg', graph: true },
+    { id: 'callgraph', name: 'Call graph', list: 'callgraph', graph: true }
+  ];
+
+  // ---- grammars and the program -------------------------------------------
+  function codeKey() { return 'mec-playground:' + elGrammar.value; }
+
+  function loadGrammars() {
+    fetch('grammars').then(function (r) { return r.json(); }).then(function (list) {
+      var groups = Object.create(null);
+      list.forEach(function (g) {
+        var grp = groups[g.language];
+        if (!grp) {
+          grp = groups[g.language] = document.createElement('optgroup');
+          grp.label = g.language;
+          elGrammar.appendChild(grp);
+        }
+        var o = document.createElement('option');
+        o.value = g.path;
+        o.textContent = g.title + ' - ' + g.path.split('/').pop();
+        grp.appendChild(o);
+      });
+      var last = localStorage.getItem('mec-playground:grammar');
+      if (last && list.some(function (g) { return g.path === last; })) elGrammar.value = last;
+      elCode.value = localStorage.getItem(codeKey()) || '';
+    }).catch(function (e) { status('cannot list the grammars: ' + e.message, true); });
+  }
+
+  elGrammar.addEventListener('change', function () {
+    localStorage.setItem('mec-playground:grammar', elGrammar.value);
+    elCode.value = localStorage.getItem(codeKey()) || '';
+  });
+  elCode.addEventListener('input', function () { localStorage.setItem(codeKey(), elCode.value); });
+  elCode.addEventListener('keydown', function (e) {
+    if (e.key === 'Enter' && (e.ctrlKey || e.metaKey)) { e.preventDefault(); run(); return; }
+    if (e.key === 'Tab' && !e.shiftKey) { // A tab in the program, not a move to the next field.
+      e.preventDefault();
+      var s = elCode.selectionStart;
+      elCode.value = elCode.value.slice(0, s) + '\t' + elCode.value.slice(elCode.selectionEnd);
+      elCode.selectionStart = elCode.selectionEnd = s + 1;
+      localStorage.setItem(codeKey(), elCode.value);
+    }
+  });
+  elRun.addEventListener('click', run);
+
+  function status(text, bad) {
+    elStatus.textContent = text;
+    elStatus.className = bad ? 'bad' : '';
+  }
+
+  // splitFlags splits the flags field at spaces, keeping "quoted words" whole.
+  function splitFlags(text) {
+    var out = [], re = /"((?:[^"\\]|\\.)*)"|(\S+)/g, m;
+    while ((m = re.exec(text))) out.push(m[1] !== undefined ? m[1].replace(/\\(.)/g, '$1') : m[2]);
+    return out;
+  }
+
+  function run() {
+    if (elRun.disabled || !elGrammar.value) return;
+    elRun.disabled = true;
+    status('running ...');
+    fetch('run', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ grammar: elGrammar.value, code: elCode.value, flags: splitFlags(elFlags.value) })
+    }).then(function (r) {
+      return r.json().then(function (body) {
+        if (!r.ok) throw new Error(body.error || ('HTTP ' + r.status));
+        return body;
+      });
+    }).then(function (res) {
+      result = res;
+      module = 0;
+      var s = 'ran in ' + res.millis + ' ms, exit code ' + res.exitCode;
+      if (res.timedOut) s = 'stopped after ' + res.millis + ' ms: the run took too long';
+      if (res.truncated) s += ', output cut';
+      status(s, res.timedOut || res.exitCode !== 0);
+      show();
+    }).catch(function (e) {
+      status(e.message, true);
+    }).then(function () { elRun.disabled = false; });
+  }
+
+  // ---- the tabs -----------------------------------------------------------
+  function show() {
+    elTabs.textContent = '';
+    TABS.forEach(function (t) {
+      var b = document.createElement('button');
+      b.textContent = t.name;
+      if (t.list && result && result[t.list] && result[t.list].length > 1) {
+        var c = document.createElement('span');
+        c.className = 'count';
+        c.textContent = ' ' + result[t.list].length;
+        b.appendChild(c);
+      }
+      b.className = t.id === tab ? 'on' : '';
+      b.addEventListener('click', function () { tab = t.id; show(); });
+      elTabs.appendChild(b);
+    });
+    elTools.textContent = '';
+    elView.textContent = '';
+    if (!result) return;
+    var t = TABS.filter(function (x) { return x.id === tab; })[0];
+    if (t.id === 'output') {
+      text(result.output, '(no output)');
+      if (result.errors) text(result.errors).className = 'errors';
+      return;
+    }
+    if (t.id === 'asg') {
+      if (!result.asg) { empty('No ASG: the parse failed.'); return; }
+      var tree = document.createElement('div');
+      tree.className = 'tree';
+      asgRules(result.asg.rules || [], tree, 0);
+      elView.appendChild(tree);
+      return;
+    }
+    var list = result[t.list] || [];
+    if (!list.length) {
+      empty(t.graph ? 'No module ran: the graphs are of the modules a -to-llvm-ir grammar runs.' : 'No module ran: the IR is that of a -to-llvm-ir grammar.');
+      return;
+    }
+    if (module >= list.length) module = 0;
+    if (list.length > 1) tools(moduleSelect(list.length));
+    if (!t.graph) { text(list[module]); return; }
+    var dot = list[module];
+    tools(toggle(asDot ? 'Drawing' : 'DOT', function () { asDot = !asDot; show(); }));
+    tools(toggle('3D', function () { open3D(t.name, dot); }));
+    if (asDot) { text(dot); return; }
+    draw(parseDot(dot));
+  }
+
+  function text(s, none) {
+    var pre = document.createElement('pre');
+    pre.textContent = s || none || '';
+    elView.appendChild(pre);
+    return pre;
+  }
+  function empty(s) {
+    var d = document.createElement('div');
+    d.className = 'empty';
+    d.textContent = s;
+    elView.appendChild(d);
+  }
+  function tools(el) { elTools.appendChild(el); }
+  function toggle(name, fn) {
+    var b = document.createElement('button');
+    b.textContent = name;
+    b.addEventListener('click', fn);
+    return b;
+  }
+  function moduleSelect(n) {
+    var sel = document.createElement('select');
+    for (var i = 0; i < n; i++) {
+      var o = document.createElement('option');
+      o.value = i;
+      o.textContent = 'module ' + (i + 1);
+      sel.appendChild(o);
+    }
+    sel.value = module;
+    sel.addEventListener('change', function () { module = +sel.value; show(); });
+    return sel;
+  }
+
+  // asgRules adds the rules of an ASG (the JSON of abnf/r/marshal.go) to parent
+  // as a tree that folds: a tag shows its code, a run of tokens is one string,
+  // the way the parse error dump shows them.
+  function asgRules(rules, parent, depth) {
+    var run = '';
+    function flush() {
+      if (!run) return;
+      var d = document.createElement('div');
+      d.className = 'token';
+      d.textContent = JSON.stringify(run);
+      parent.appendChild(d);
+      run = '';
+    }
+    rules.forEach(function (rule) {
+      if (rule && rule.Operator === 'Token') { run += rule.String || ''; return; }
+      flush();
+      if (!rule) return;
+      var label = rule.Operator;
+      if (rule.String) label += ' ' + JSON.stringify(rule.String);
+      if (rule.Operator === 'Tag' && rule.CodeChilds) {
+        var code = rule.CodeChilds.map(function (c) { return c.String || ''; }).join('').replace(/\s+/g, ' ').trim();
+        if (code.length > 70) code = code.slice(0, 70) + '...';
+        label = 'code{' + code + '}';
+      }
+      if (!rule.Childs || !rule.Childs.length) {
+        var leaf = document.createElement('div');
+        leaf.textContent = label;
+        parent.appendChild(leaf);
+        return;
+      }
+      var det = document.createElement('details');
+      det.open = depth < 4;
+      var sum = document.createElement('summary');
+      sum.textContent = label;
+      det.appendChild(sum);
+      asgRules(rule.Childs, det, depth + 1);
+      parent.appendChild(det);
+    });
+    flush();
+  }
+
+  // open3D shows the graph in viz/graph3d.html, in a window of its own.
+  function open3D(name, dot) {
+    var w = window.open('viz/graph3d.html');
+    if (!w) { status('the browser blocked the 3D window', true); return; }
+    w.addEventListener('load', function () { w.__graph3d.loadText(name + '.dot', dot); });
+  }
+
+  // ---- graphs -------------------------------------------------------------
+  // parseDot reads the DOT of writeCFGDot and writeStaticDot: quoted node ids
+  // with a label, "a" -> "b" edges, and style=dashed for the callees outside.
+  function parseDot(text) {
+    var byId = Object.create(null), nodes = [], links = [];
+    var reEdge = /^\s*"((?:[^"\\]|\\.)*)"\s*->\s*"((?:[^"\\]|\\.)*)"/;
+    var reNode = /^\s*"((?:[^"\\]|\\.)*)"\s*(?:\[(.*)\])?\s*;?\s*$/;
+    var reLabel = /label\s*=\s*"((?:[^"\\]|\\.)*)"/;
+    function node(id) {
+      var n = byId[id];
+      if (!n) { n = byId[id] = { id: id, label: id, external: false, x: 0, y: 0, vx: 0, vy: 0 }; nodes.push(n); }
+      return n;
+    }
+    text.split(/\r?\n/).forEach(function (line) {
+      var e = line.match(reEdge);
+      if (e) { links.push({ s: node(e[1]), t: node(e[2]) }); return; }
+      var m = line.match(reNode);
+      if (!m) return;
+      var n = node(m[1]), attrs = m[2] || '';
+      var l = attrs.match(reLabel);
+      if (l) n.label = l[1].split('\\n')[0].replace(/\\"/g, '"');
+      if (/style\s*=\s*dashed/.test(attrs)) n.external = true;
+    });
+    return { nodes: nodes, links: links };
+  }
+
+  // layout places the nodes with springs along the edges, repulsion between
+  // all pairs and a pull to the centre; a few hundred steps settle a graph of
+  // the size a playground program makes.
+  function layout(g) {
+    var n = g.nodes.length, rest = 60;
+    g.nodes.forEach(function (v, i) {
+      var a = i * 2.399963, r = rest * Math.sqrt(i + 1); // A sunflower spiral to start from.
+      v.x = r * Math.cos(a); v.y = r * Math.sin(a);
+    });
+    var steps = n > 400 ? 120 : 300;
+    for (var s = 0; s < steps; s++) {
+      var heat = 1 - s / steps;
+      for (var i = 0; i < n; i++) {
+        var a = g.nodes[i];
+        for (var j = i + 1; j < n; j++) {
+          var b = g.nodes[j], dx = a.x - b.x, dy = a.y - b.y, d2 = dx * dx + dy * dy + 0.01;
+          var f = rest * rest / d2;
+          a.vx += dx * f; a.vy += dy * f; b.vx -= dx * f; b.vy -= dy * f;
+        }
+      }
+      g.links.forEach(function (l) {
+        var dx = l.t.x - l.s.x, dy = l.t.y - l.s.y, d = Math.sqrt(dx * dx + dy * dy) + 0.01;
+        var f = (d - rest) / d * 0.1;
+        l.s.vx += dx * f; l.s.vy += dy * f; l.t.vx -= dx * f; l.t.vy -= dy * f;
+      });
+      g.nodes.forEach(function (v) {
+        v.vx -= v.x * 0.01; v.vy -= v.y * 0.01;
+        var sp = Math.sqrt(v.vx * v.vx + v.vy * v.vy), max = 20 * heat + 1;
+        if (sp > max) { v.vx *= max / sp; v.vy *= max / sp; }
+        v.x += v.vx; v.y += v.vy;
+        v.vx *= 0.5; v.vy *= 0.5;
+      });
+    }
+  }
+
+  var SVG = 'http://www.w3.org/2000/svg';
+  var drag = null; // The last mouse position of a pan going on.
+  window.addEventListener('mouseup', function () { drag = null; });
+  function svgEl(name, attrs, parent) {
+    var el = document.createElementNS(SVG, name);
+    for (var k in attrs) el.setAttribute(k, attrs[k]);
+    if (parent) parent.appendChild(el);
+    return el;
+  }
+
+  // draw lays the graph out and draws it; the wheel zooms and a drag pans.
+  function draw(g) {
+    if (!g.nodes.length) { empty('The graph has no nodes.'); return; }
+    layout(g);
+    var minX = Infinity, minY = Infinity, maxX = -Infinity, maxY = -Infinity;
+    g.nodes.forEach(function (v) {
+      minX = Math.min(minX, v.x); maxX = Math.max(maxX, v.x);
+      minY = Math.min(minY, v.y); maxY = Math.max(maxY, v.y);
+    });
+    var pad = 60, box = [minX - pad, minY - pad, maxX - minX + 2 * pad, maxY - minY + 2 * pad];
+    var svg = svgEl('svg', { viewBox: box.join(' ') }, elView);
+    var defs = svgEl('defs', {}, svg);
+    var marker = svgEl('marker', { id: 'arrow', viewBox: '0 0 10 10', refX: 16, refY: 5, markerWidth: 6, markerHeight: 6, orient: 'auto' }, defs);
+    svgEl('path', { d: 'M0,0 L10,5 L0,10 z', fill: '#3a4560' }, marker);
+    g.links.forEach(function (l) {
+      svgEl('line', { x1: l.s.x, y1: l.s.y, x2: l.t.x, y2: l.t.y, 'marker-end': 'url(#arrow)' }, svg);
+    });
+    g.nodes.forEach(function (v) {
+      svgEl('circle', { cx: v.x, cy: v.y, r: 5, 'class': v.external ? 'external' : '' }, svg);
+      svgEl('text', { x: v.x + 7, y: v.y + 3 }, svg).textContent = v.label;
+    });
+
+    svg.addEventListener('wheel', function (e) {
+      e.preventDefault();
+      var k = e.deltaY > 0 ? 1.15 : 1 / 1.15, r = svg.getBoundingClientRect();
+      var fx = box[0] + (e.clientX - r.left) / r.width * box[2];
+      var fy = box[1] + (e.clientY - r.top) / r.height * box[3];
+      box = [fx - (fx - box[0]) * k, fy - (fy - box[1]) * k, box[2] * k, box[3] * k];
+      svg.setAttribute('viewBox', box.join(' '));
+    });
+    svg.addEventListener('mousedown', function (e) { drag = { x: e.clientX, y: e.clientY }; });
+    svg.addEventListener('mousemove', function (e) {
+      if (!drag) return;
+      var r = svg.getBoundingClientRect();
+      box[0] -= (e.clientX - drag.x) / r.width * box[2];
+      box[1] -= (e.clientY - drag.y) / r.height * box[3];
+      drag = { x: e.clientX, y: e.clientY };
+      svg.setAttribute('viewBox', box.join(' '));
+    });
+  }
+
+  show();
+  loadGrammars();
+})();
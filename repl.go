@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+// -repl reads statements and runs them in the scope of a program:
+//
+//	./mec -repl languages/python-interpreter.abnf [prog.py]
+//
+// The program, or an empty one, is loaded first: its declarations are made and
+// its top-level code runs, but a main() is not called (type main() at the
+// prompt). Then every line read from stdin is parsed from the grammar's
+// Statement production and run where the program's top-level code ran, and the
+// value of an expression is printed. A line that ends before its statement does
+// (an open block, a call without its closing parenthesis) is continued on the
+// next; an empty line ends the statement anyway, and so reports what is wrong
+// with it. The grammar runs the loop, so only the grammars that implement it
+// have a REPL: see abnf/repl.go.
+
+// checkRepl rejects what does not combine with -repl: it reads stdin, runs one
+// program interactively, and never builds one.
+func checkRepl(o *options) error {
+	switch {
+	case o.codeStdin || o.stdin:
+		return fmt.Errorf("-repl reads its statements from stdin; -code-stdin and -stdin cannot read from there too")
+	case o.batch || o.watch:
+		return fmt.Errorf("-repl cannot be combined with -batch or -watch")
+	case o.exePath != "":
+		return fmt.Errorf("-repl runs the program in the IR interpreter; -exe builds it")
+	case len(o.pipeBounds) > 0:
+		return fmt.Errorf("-repl cannot be combined with -pipe")
+	case o.verify || o.pretty || o.pack || o.exportFormat != "" || o.speedTest:
+		return fmt.Errorf("-repl runs a program; -verify, -pretty, -pack, -export and -speed inspect a grammar")
+	}
+	return nil
+}
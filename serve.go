@@ -0,0 +1,341 @@
+package main
+
+// mec -serve ADDR: a web playground for the languages of the search path.
+//
+// The page (playground/, embedded in the binary like the viz/graph3d viewer it
+// opens graphs in) lists the interpreter and compiler grammars the language
+// registry knows (languages.go), takes a program and shows what a run of it
+// gives: the program's output, the ASG of its parse, the LLVM IR a -to-llvm-ir
+// grammar emits, and the control flow and call graphs of the modules it runs.
+// The same runs are a JSON API for other tools:
+//
+//	GET  /grammars   [{"path", "title", "language", "compiler", "ext"}, ...]
+//	POST /run        {"grammar": PATH, "code": SRC, "flags": [...]}
+//
+// Every run is a mec process of its own, so a program that loops, crashes or
+// calls exit() ends only its run: it runs in a fresh temporary directory with
+// an empty stdin, under -sandbox (files only there and in the grammar's
+// directory, a memory limit, and a time limit that reports before the deadline
+// kills the process), an IR step budget (-max-steps, which a request may lower
+// but not raise) and a cap on the output kept. The run is the plain command line
+//
+//	mec GRAMMAR prog.EXT -q -sandbox -sandbox-timeout 15s -asg asg.json -ir prog.ll -cfgraph cfg.dot -callgraph calls.dot
+//
+// whose dumps are the answer: the -ir files are taken out of the output too,
+// where the grammar's println(m) shows them before the program runs.
+// A request's flags are limited to the ones that change how the program runs,
+// not what the process touches: no -o, -exe, -trace or -i.
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed playground viz/graph3d.html viz/graph3d.js
+var playgroundFiles embed.FS
+
+const (
+	serveTimeout   = 20 * time.Second // The deadline of one run.
+	serveSandbox   = 15 * time.Second // The -sandbox-timeout of a run, which says why it stopped.
+	serveMaxSteps  = 20000000         // The -max-steps of a run, a fifth of the command line's default.
+	serveOutputCap = 1 << 20          // The bytes of stdout (and of stderr) a run keeps.
+	serveCodeCap   = 1 << 20          // The largest program a request may send.
+)
+
+// serveFlags are the flags a /run request may pass, with whether each takes a
+// value. Everything after -- is the program's arguments.
+var serveFlags = map[string]bool{
+	"-frozen":           false,
+	"-warn-unsupported": false,
+	"-warn-imports":     false,
+	"-rt-prims":         false,
+	"-main":             true,
+	"-max-steps":        true,
+	"-error":            true,
+}
+
+// playground is the server: the grammars it offers and the runs going on.
+type playground struct {
+	exe      string                      // This mec binary, which every run starts.
+	reg      *languageRegistry           // The grammars of the search path.
+	grammars map[string]*registryGrammar // By absolute path.
+	list     []serveGrammar
+	slots    chan struct{} // One per run that may go on at a time.
+}
+
+// serveGrammar is a grammar of GET /grammars.
+type serveGrammar struct {
+	Path     string `json:"path"`
+	Title    string `json:"title"`
+	Language string `json:"language"`
+	Compiler bool   `json:"compiler"`
+	Ext      string `json:"ext"` // The extension the program file gets, e.g. ".py".
+}
+
+// serveRequest is the body of POST /run.
+type serveRequest struct {
+	Grammar string   `json:"grammar"`
+	Code    string   `json:"code"`
+	Flags   []string `json:"flags"`
+}
+
+// serveResult is the answer of POST /run. A run that failed still answers 200
+// with what it gave: the failure is in Errors and ExitCode.
+type serveResult struct {
+	Output    string          `json:"output"`
+	Errors    string          `json:"errors"`
+	ASG       json.RawMessage `json:"asg,omitempty"`       // The JSON interchange format of abnf/r/marshal.go.
+	IR        []string        `json:"ir,omitempty"`        // One per module run.
+	CFG       []string        `json:"cfg,omitempty"`       // DOT, one per module run.
+	CallGraph []string        `json:"callgraph,omitempty"` // DOT, one per module run.
+	ExitCode  int             `json:"exitCode"`
+	TimedOut  bool            `json:"timedOut,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"` // The output passed the cap and was cut.
+	Millis    int64           `json:"millis"`
+}
+
+// runServe serves the playground on addr until the process is stopped.
+func runServe(addr string) {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	pg := &playground{exe: exe, reg: loadRegistry(languageSearchPath()), grammars: map[string]*registryGrammar{}, slots: make(chan struct{}, runtime.NumCPU())}
+	for _, g := range pg.reg.grammars {
+		abs, err := filepath.Abs(g.path)
+		if err != nil || pg.grammars[abs] != nil {
+			continue
+		}
+		pg.grammars[abs] = g
+		pg.list = append(pg.list, serveGrammar{Path: g.path, Title: g.title, Language: g.language, Compiler: g.compiler, Ext: pg.programExt(g.language)})
+	}
+	sort.SliceStable(pg.list, func(i, j int) bool { return pg.list[i].Language < pg.list[j].Language })
+	if len(pg.list) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no grammars in %s\n", strings.Join(languageSearchPath(), string(filepath.ListSeparator)))
+		os.Exit(1)
+	}
+
+	page, _ := fs.Sub(playgroundFiles, "playground")
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(page)))
+	mux.Handle("/viz/", http.FileServer(http.FS(playgroundFiles)))
+	mux.HandleFunc("/grammars", pg.serveGrammars)
+	mux.HandleFunc("/run", pg.serveRun)
+	fmt.Fprintf(os.Stderr, "mec playground on http://%s/ (%d grammars)\n", displayAddr(addr), len(pg.list))
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.ListenAndServe(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// displayAddr is addr as a browser reaches it: ":8777" is localhost:8777.
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
+
+func (pg *playground) serveGrammars(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, pg.list)
+}
+
+func (pg *playground) serveRun(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	var sr serveRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, serveCodeCap+64<<10)).Decode(&sr); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "the body is not a run request: " + err.Error()})
+		return
+	}
+	res, err := pg.run(req.Context(), &sr)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// run runs one request in a mec process of its own and collects what it gave.
+// The error is for a request that cannot run at all.
+func (pg *playground) run(ctx context.Context, sr *serveRequest) (*serveResult, error) {
+	abs, err := filepath.Abs(sr.Grammar)
+	if err != nil {
+		return nil, err
+	}
+	g := pg.grammars[abs]
+	if g == nil {
+		return nil, fmt.Errorf("%s is not a grammar of the playground (see /grammars)", sr.Grammar)
+	}
+	if len(sr.Code) > serveCodeCap {
+		return nil, fmt.Errorf("the program is %d bytes, more than %d", len(sr.Code), serveCodeCap)
+	}
+	flags, err := serveCheckFlags(sr.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case pg.slots <- struct{}{}:
+		defer func() { <-pg.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	dir, err := ioutil.TempDir("", "mec-serve-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	prog := "prog" + pg.programExt(g.language)
+	if err := ioutil.WriteFile(filepath.Join(dir, prog), []byte(sr.Code), 0644); err != nil {
+		return nil, err
+	}
+
+	args := []string{abs, prog, "-q", "-sandbox", "-sandbox-timeout", serveSandbox.String(),
+		"-asg", "asg.json", "-ir", "prog.ll", "-cfgraph", "cfg.dot", "-callgraph", "calls.dot",
+		"-max-steps", strconv.Itoa(serveMaxSteps)}
+	args = append(args, flags...) // A lower -max-steps of the request comes last and wins.
+	ctx, cancel := context.WithTimeout(ctx, serveTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, pg.exe, args...)
+	cmd.Dir = dir
+	stdout, stderr := &cappedBuffer{max: serveOutputCap}, &cappedBuffer{max: serveOutputCap}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	start := time.Now()
+	err = cmd.Run()
+	res := &serveResult{Millis: time.Since(start).Milliseconds(), Truncated: stdout.cut || stderr.cut}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.TimedOut, res.ExitCode = true, -1
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		return nil, err
+	}
+
+	res.IR = readDumps(dir, "prog.ll")
+	res.CFG = readDumps(dir, "cfg.dot")
+	res.CallGraph = readDumps(dir, "calls.dot")
+	if dat, err := ioutil.ReadFile(filepath.Join(dir, "asg.json")); err == nil {
+		res.ASG = dat
+	}
+	res.Output, res.Errors = stdout.String(), stderr.String()
+	for _, m := range res.IR { // The grammar printed each module before it ran it.
+		res.Output = strings.Replace(res.Output, m+"\n", "", 1)
+	}
+	if res.TimedOut {
+		res.Errors += fmt.Sprintf("the run took longer than %s and was stopped\n", serveTimeout)
+	}
+	return res, nil
+}
+
+// serveCheckFlags returns the flags of a request when they are all ones a run
+// may take, and -max-steps stays within the server's budget.
+func serveCheckFlags(flags []string) ([]string, error) {
+	for i := 0; i < len(flags); i++ {
+		f := flags[i]
+		if f == "--" {
+			break
+		}
+		takesValue, ok := serveFlags[f]
+		if !ok {
+			return nil, fmt.Errorf("the playground does not take %s (it takes -- ARGS and %s)", f, strings.Join(serveFlagNames(), ", "))
+		}
+		if !takesValue {
+			continue
+		}
+		if i++; i == len(flags) {
+			return nil, fmt.Errorf("%s needs a value", f)
+		}
+		if f == "-max-steps" {
+			if n, err := strconv.Atoi(flags[i]); err != nil || n <= 0 || n > serveMaxSteps {
+				return nil, fmt.Errorf("-max-steps is 1 to %d in the playground", serveMaxSteps)
+			}
+		}
+	}
+	return flags, nil
+}
+
+func serveFlagNames() []string {
+	var names []string
+	for f := range serveFlags {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// programExt is the first extension of lang, or ".txt".
+func (pg *playground) programExt(lang string) string {
+	if exts, _ := pg.reg.detection(lang); len(exts) > 0 {
+		return exts[0]
+	}
+	return ".txt"
+}
+
+// readDumps reads the dumps a run wrote to name in dir: name, name-2, ... in
+// order (abnf numbers the second module's dump that way).
+func readDumps(dir, name string) []string {
+	var dumps []string
+	ext := filepath.Ext(name)
+	for n := 1; ; n++ {
+		path := filepath.Join(dir, name)
+		if n > 1 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), n, ext))
+		}
+		dat, err := ioutil.ReadFile(path)
+		if err != nil {
+			return dumps
+		}
+		dumps = append(dumps, string(dat))
+	}
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest, so
+// a program printing without end cannot fill the server's memory.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+	cut bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.cut = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -625,7 +625,17 @@ run_entry() {
     local og="$RESDIR/$idx.og" of="$RESDIR/$idx.of" eg="$RESDIR/$idx.eg" ef="$RESDIR/$idx.ef"
 
     local has_q=0 a
-    for a in "${args[@]}"; do [ "$a" = "-q" ] && has_q=1; done
+    for a in "${args[@]}"; do [ "$a" = "--" ] && break; [ "$a" = "-q" ] && has_q=1; done
+    # The -frozen run: -frozen goes in front of the program's own arguments
+    # (after --), where it would be one of them. An entry with -stdin reads
+    # tests/program-stdin.txt on both runs; the others read nothing.
+    local fargs=() dashdash=0 in=/dev/null
+    for a in "${args[@]}"; do
+        if [ "$a" = "--" ] && [ "$dashdash" -eq 0 ]; then fargs+=(-frozen); dashdash=1; fi
+        [ "$dashdash" -eq 0 ] && [ "$a" = "-stdin" ] && in=tests/program-stdin.txt
+        fargs+=("$a")
+    done
+    [ "$dashdash" -eq 0 ] && fargs+=(-frozen)
     # Expected-to-fail: author-declared (name mentions FAIL) or the two grammar
     # guards that fail by design (their names do not carry FAIL).
     local should_fail=0
@@ -664,9 +674,9 @@ run_entry() {
     local rc_ng=0 rc_nf=0
 
     local rc_g rc_f
-    RUN "$BIN" "${args[@]}"          >"$og" 2>"$eg"; rc_g=$?
+    RUN "$BIN" "${args[@]}"  <"$in" >"$og" 2>"$eg"; rc_g=$?
     [ "$abort_exe" -eq 1 ] && [ -x "$exe" ] && { RUN "$exe" >/dev/null 2>"$ng"; rc_ng=$?; }
-    RUN "$BIN" "${args[@]}" -frozen  >"$of" 2>"$ef"; rc_f=$?
+    RUN "$BIN" "${fargs[@]}" <"$in" >"$of" 2>"$ef"; rc_f=$?
     [ "$abort_exe" -eq 1 ] && [ -x "$exe" ] && { RUN "$exe" >/dev/null 2>"$nf"; rc_nf=$?; }
     [ "$abort_exe" -eq 1 ] && RUN "$BIN" "${twin[@]}" >/dev/null 2>"$nt"
 
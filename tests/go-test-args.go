@@ -0,0 +1,15 @@
+// The program's command line (mec ... -- ARGS): os.Args holds the file name
+// and the arguments.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println(len(os.Args))
+	for i, a := range os.Args[1:] {
+		fmt.Println(i, a)
+	}
+}
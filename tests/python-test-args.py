@@ -0,0 +1,14 @@
+# The program's command line (mec ... -- ARGS) and standard input (-stdin):
+# sys.argv holds the file name and the arguments, input() reads the lines
+# of tests/program-stdin.txt (in the test matrix) and raises EOFError after
+# the last one.
+import sys
+
+print(len(sys.argv), sys.argv[1:])
+while True:
+    try:
+        line = input("> ")
+    except EOFError:
+        print("(end of input)")
+        break
+    print("read:", line)
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"14.gy/mec/abnf"
+	r "14.gy/mec/abnf/r"
+)
+
+// -watch keeps mec running while a grammar is being developed:
+//
+//	./mec languages/kotlin-interpreter.abnf prog.kt -watch
+//
+// It runs the pipeline, then polls every file the run depended on and runs it
+// again when one of them changes: the files of the command line, and what the
+// session read for the languages on the way (abnf.Session.Inputs) - :include()d
+// grammar fragments, include()d script libraries, runtime modules and imported
+// project files. The set is taken anew after every run, so a new import is
+// watched from the run that first reads it. Polling the modification times needs
+// nothing from the operating system, and a few dozen stat calls every interval
+// cost nothing next to a run.
+//
+// Every run gets a session of its own, and ends with a status line; exit() in a
+// program and a failed stage end that run only (exit, abnf.Engine.CatchExit). A
+// grammar file that did not change is not compiled again: its compiled form is
+// kept in memory (watchGrammars), in addition to the grammar cache on disk.
+
+// watchInterval is how often the inputs are polled.
+const watchInterval = 300 * time.Millisecond
+
+// watchExit is the panic exit raises under -watch, to end the current run.
+type watchExit struct{ code int }
+
+// checkWatch rejects the modes -watch does not rerun: only the pipeline is.
+func checkWatch(o *options) error {
+	switch {
+	case o.batch:
+		return fmt.Errorf("-watch and -batch cannot be combined")
+	case o.verify || o.pretty || o.pack || o.exportFormat != "" || o.speedTest:
+		return fmt.Errorf("-watch reruns the pipeline; -verify, -pretty, -pack, -export and -speed do not combine with it")
+	case o.diagnostics == "sarif":
+		return fmt.Errorf("-watch does not end, and a SARIF log is written at the end of the run; use -diagnostics json")
+	}
+	return nil
+}
+
+// fileStamp is what the poll compares: a file that changed, appeared or
+// vanished has a different stamp.
+type fileStamp struct {
+	mod  time.Time
+	size int64
+	ok   bool
+}
+
+func stampFiles(files []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(files))
+	for _, f := range files {
+		if st, err := os.Stat(f); err == nil {
+			stamps[f] = fileStamp{st.ModTime(), st.Size(), true}
+		} else {
+			stamps[f] = fileStamp{}
+		}
+	}
+	return stamps
+}
+
+// changedFiles lists the files whose stamps differ, sorted.
+func changedFiles(old, cur map[string]fileStamp) []string {
+	var changed []string
+	for f, st := range cur {
+		if old[f] != st {
+			changed = append(changed, f)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// runWatch runs the pipeline and reruns it on every change, until the process
+// is interrupted. codeIdx and codeText are the synthetic -code / -code-stdin
+// file, as in main.
+func runWatch(o *options, codeIdx int, codeText string, parseropts *abnf.Parseropts) {
+	watchGrammars = map[string]watchGrammar{}
+	exit = func(code int) { panic(watchExit{code}) }
+	fmt.Fprintf(os.Stderr, "=== [%s] run 1 ===\n", time.Now().Format("15:04:05"))
+	for run := 1; ; run++ {
+		inputs, code := runWatched(o, codeIdx, codeText, *parseropts)
+		stamps := stampFiles(inputs)
+		fmt.Fprintf(os.Stderr, "=== [%s] run %d: exit status %d - watching %d file(s), Ctrl-C to stop ===\n",
+			time.Now().Format("15:04:05"), run, code, len(inputs))
+		var changed []string
+		for changed == nil {
+			time.Sleep(watchInterval)
+			cur := stampFiles(inputs)
+			if changed = changedFiles(stamps, cur); changed != nil {
+				// An editor may write a file in several steps: wait until a poll
+				// sees the same state twice.
+				for {
+					time.Sleep(watchInterval)
+					next := stampFiles(inputs)
+					if len(changedFiles(cur, next)) == 0 {
+						break
+					}
+					cur = next
+				}
+			}
+		}
+		fmt.Fprintf(os.Stderr, "\n=== [%s] run %d: %s changed ===\n", time.Now().Format("15:04:05"), run+1, strings.Join(changed, ", "))
+	}
+}
+
+// runWatched does one run in a session of its own and returns the files it
+// depended on and its exit status.
+func runWatched(o *options, codeIdx int, codeText string, parseropts abnf.Parseropts) (inputs []string, code int) {
+	for i, f := range o.files {
+		if i != codeIdx {
+			inputs = append(inputs, f)
+		}
+	}
+	sess := newSession(o)
+	sess.Open()
+	defer func() {
+		sess.Close()
+		if p := recover(); p != nil {
+			exited, ok := p.(watchExit)
+			if !ok {
+				panic(p)
+			}
+			code = exited.code
+		}
+		seen := map[string]bool{}
+		for _, f := range inputs {
+			seen[f] = true
+		}
+		for _, f := range sess.Inputs() {
+			if !seen[f] {
+				inputs = append(inputs, f)
+			}
+		}
+	}()
+
+	srcs := make([]string, len(o.files))
+	for i, f := range o.files {
+		if i == codeIdx {
+			srcs[i] = codeText
+			continue
+		}
+		dat, err := ioutil.ReadFile(f)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: ", err)
+			return inputs, 1
+		}
+		srcs[i] = abnf.StripBOM(string(dat))
+	}
+	runPipeline(sess, o, srcs, &parseropts)
+	return inputs, 0
+}
+
+// watchGrammars is the in-memory grammar cache of -watch, nil otherwise: the
+// compiled a-grammar of every grammar file and slot, for the source it was
+// compiled from. An edit replaces the entry, so the cache holds one version
+// per file and slot however long the watch runs. An entry is marshaled, not
+// the *r.Rules itself, because the first parse with an a-grammar merges its
+// :include()s into it, and an edited fragment must be merged anew.
+var watchGrammars map[string]watchGrammar
+
+// watchGrammar is an entry of watchGrammars.
+type watchGrammar struct {
+	sum  [sha256.Size]byte // The sha256 of the source.
+	data []byte            // The a-grammar, marshaled.
+}
+
+func watchGrammarKey(file string, slot int) string {
+	return file + "\x00" + strconv.Itoa(slot)
+}
+
+// watchGrammarStore keeps the a-grammar of file and slot, compiled from src.
+func watchGrammarStore(file, src string, slot int, grammar *r.Rules) {
+	if watchGrammars == nil || grammar == nil {
+		return
+	}
+	if dat, err := r.Marshal(grammar, r.MarshalBinary); err == nil {
+		watchGrammars[watchGrammarKey(file, slot)] = watchGrammar{sha256.Sum256([]byte(src)), dat}
+	}
+}
+
+// loadCachedGrammar is abnf.LoadCachedGrammar behind watchGrammars.
+func loadCachedGrammar(file, src string, slot int) *r.Rules {
+	if e, ok := watchGrammars[watchGrammarKey(file, slot)]; ok && e.sum == sha256.Sum256([]byte(src)) {
+		if grammar, err := r.Unmarshal(e.data); err == nil {
+			return grammar
+		}
+	}
+	grammar := abnf.LoadCachedGrammar(file, src, slot)
+	watchGrammarStore(file, src, slot, grammar)
+	return grammar
+}
+
+// storeCachedGrammar is abnf.StoreCachedGrammar, and under -watch also stores
+// into watchGrammars.
+func storeCachedGrammar(file, src string, slot int, grammar *r.Rules) {
+	abnf.StoreCachedGrammar(file, src, slot, grammar)
+	watchGrammarStore(file, src, slot, grammar)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"14.gy/mec/abnf/r"
+)
+
+// TestWatchGrammars keeps two versions of one grammar file in the -watch cache
+// and expects only the last: an edit replaces the entry instead of adding one.
+func TestWatchGrammars(t *testing.T) {
+	watchGrammars = map[string]watchGrammar{}
+	defer func() { watchGrammars = nil }()
+	grammar := &r.Rules{&r.Rule{Operator: r.Production, String: "A"}}
+	watchGrammarStore("g.abnf", "A = 1 ;", 0, grammar)
+	watchGrammarStore("g.abnf", "A = 2 ;", 0, grammar)
+	watchGrammarStore("g.abnf", "A = 2 ;", 1, grammar)
+	if len(watchGrammars) != 2 {
+		t.Fatalf("%d entries for one file in two slots, want 2", len(watchGrammars))
+	}
+	if g := loadCachedGrammar("g.abnf", "A = 2 ;", 0); g == nil || len(*g) != 1 || (*g)[0].String != "A" {
+		t.Errorf("the last version is not found: %v", g)
+	}
+}